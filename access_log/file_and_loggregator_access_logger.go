@@ -1,8 +1,11 @@
 package access_log
 
 import (
+	"fmt"
 	"io"
 	"log/syslog"
+	"math/rand"
+	"net"
 	"regexp"
 
 	"strconv"
@@ -37,16 +40,42 @@ type FileAndLoggregatorAccessLogger struct {
 	stopCh                  chan struct{}
 	writer                  io.Writer
 	writerCount             int
-	logger                  logger.Logger
+	// jsonFields are the fields of records written as JSON, which are
+	// written as text when it is nil.
+	jsonFields []string
+	sampling   config.AccessLogSamplingConfig
+	logger     logger.Logger
+	// virtualHosts write the records of their requests to the writers of
+	// their domains instead.
+	virtualHosts       []config.VirtualHostConfig
+	virtualHostWriters map[string]io.Writer
 }
 
 func CreateRunningAccessLogger(logger logger.Logger, config *config.Config) (AccessLogger, error) {
 
-	if config.AccessLog.File == "" && !config.Logging.LoggregatorEnabled {
+	virtualHostWriters := map[string]io.Writer{}
+	for _, vh := range config.VirtualHosts {
+		if vh.AccessLogFile == "" {
+			continue
+		}
+		file, err := os.OpenFile(vh.AccessLogFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+		if err != nil {
+			logger.Error("error-creating-accesslog-file", zap.String("filename", vh.AccessLogFile), zap.Error(err))
+			return nil, err
+		}
+		virtualHostWriters[vh.Domain] = file
+	}
+
+	if config.AccessLog.File == "" && config.AccessLog.Syslog.Address == "" && !config.Logging.LoggregatorEnabled && len(virtualHostWriters) == 0 {
 		return &NullAccessLogger{}, nil
 	}
 
-	var err error
+	jsonFields, err := accessLogJSONFields(config.AccessLog)
+	if err != nil {
+		logger.Error("error-creating-access-logger", zap.Error(err))
+		return nil, err
+	}
+
 	var file *os.File
 	var writers []io.Writer
 	if config.AccessLog.File != "" {
@@ -67,12 +96,22 @@ func CreateRunningAccessLogger(logger logger.Logger, config *config.Config) (Acc
 		writers = append(writers, syslogWriter)
 	}
 
+	// the remote collector comes last, so that the file and local syslog
+	// are written while it is unreachable
+	if config.AccessLog.Syslog.Address != "" {
+		writers = append(writers, NewSyslogWriter(config.AccessLog.Syslog))
+	}
+
 	var dropsondeSourceInstance string
 	if config.Logging.LoggregatorEnabled {
 		dropsondeSourceInstance = strconv.FormatUint(uint64(config.Index), 10)
 	}
 
 	accessLogger := NewFileAndLoggregatorAccessLogger(logger, dropsondeSourceInstance, writers...)
+	accessLogger.jsonFields = jsonFields
+	accessLogger.sampling = config.AccessLog.Sampling
+	accessLogger.virtualHosts = config.VirtualHosts
+	accessLogger.virtualHostWriters = virtualHostWriters
 	go accessLogger.Run()
 	return accessLogger, nil
 }
@@ -82,6 +121,7 @@ func NewFileAndLoggregatorAccessLogger(logger logger.Logger, dropsondeSourceInst
 		dropsondeSourceInstance: dropsondeSourceInstance,
 		channel:                 make(chan schema.AccessLogRecord, 1024),
 		stopCh:                  make(chan struct{}),
+		sampling:                config.AccessLogSamplingConfig{SuccessPercentage: 100},
 		logger:                  logger,
 	}
 	configureWriters(a, ws)
@@ -92,8 +132,14 @@ func (x *FileAndLoggregatorAccessLogger) Run() {
 	for {
 		select {
 		case record := <-x.channel:
-			if x.writer != nil {
-				_, err := record.WriteTo(x.writer)
+			writer := x.recordWriter(record)
+			if writer != nil {
+				var err error
+				if x.jsonFields != nil {
+					_, err = record.WriteJSONTo(writer, x.jsonFields)
+				} else {
+					_, err = record.WriteTo(writer)
+				}
 				if err != nil {
 					x.logger.Error("error-emitting-access-log-to-writers", zap.Error(err))
 				}
@@ -107,6 +153,24 @@ func (x *FileAndLoggregatorAccessLogger) Run() {
 	}
 }
 
+// recordWriter returns the writer of the virtual host of the record, if it
+// has one, or else the writer of the access log.
+func (x *FileAndLoggregatorAccessLogger) recordWriter(record schema.AccessLogRecord) io.Writer {
+	if len(x.virtualHostWriters) == 0 || record.Request == nil {
+		return x.writer
+	}
+	host := record.Request.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if vh := config.MatchVirtualHost(x.virtualHosts, host); vh != nil {
+		if w, ok := x.virtualHostWriters[vh.Domain]; ok {
+			return w
+		}
+	}
+	return x.writer
+}
+
 func (x *FileAndLoggregatorAccessLogger) FileWriter() io.Writer {
 	return x.writer
 }
@@ -114,6 +178,10 @@ func (x *FileAndLoggregatorAccessLogger) WriterCount() int {
 	return x.writerCount
 }
 
+func (x *FileAndLoggregatorAccessLogger) JSONFields() []string {
+	return x.jsonFields
+}
+
 func (x *FileAndLoggregatorAccessLogger) DropsondeSourceInstance() string {
 	return x.dropsondeSourceInstance
 }
@@ -123,12 +191,56 @@ func (x *FileAndLoggregatorAccessLogger) Stop() {
 }
 
 func (x *FileAndLoggregatorAccessLogger) Log(r schema.AccessLogRecord) {
+	if !x.sampled(r) {
+		return
+	}
 	x.channel <- r
 }
 
+// sampled reports whether the record is logged. Records of failed and slow
+// requests always are, and the others are sampled by the configured
+// percentage.
+func (x *FileAndLoggregatorAccessLogger) sampled(r schema.AccessLogRecord) bool {
+	if x.sampling.SuccessPercentage >= 100 || r.StatusCode < 200 || r.StatusCode > 299 {
+		return true
+	}
+	threshold := x.sampling.SlowRequestThreshold
+	if threshold > 0 && r.FinishedAt.Sub(r.StartedAt) >= threshold {
+		return true
+	}
+	return rand.Float64()*100 < x.sampling.SuccessPercentage
+}
+
 var ipAddressRegex, _ = regexp.Compile(`^(([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])\.){3}([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])(:[0-9]{1,5}){1}$`)
 var hostnameRegex, _ = regexp.Compile(`^(([a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9\-]*[a-zA-Z0-9])\.)*([A-Za-z0-9]|[A-Za-z0-9][A-Za-z0-9\-]*[A-Za-z0-9])(:[0-9]{1,5}){1}$`)
 
+// accessLogJSONFields returns the fields of records written as JSON, or nil if
+// records are written as text.
+func accessLogJSONFields(accessLog config.AccessLog) ([]string, error) {
+	if accessLog.Format != config.ACCESS_LOG_FORMAT_JSON {
+		return nil, nil
+	}
+	fields := schema.JSONFields
+	if len(accessLog.Fields) > 0 {
+		fields = accessLog.Fields
+	}
+	for _, field := range fields {
+		if !isJSONField(field) {
+			return nil, fmt.Errorf("invalid access log field %s, allowed fields are %s", field, schema.JSONFields)
+		}
+	}
+	return fields, nil
+}
+
+func isJSONField(field string) bool {
+	for _, f := range schema.JSONFields {
+		if field == f {
+			return true
+		}
+	}
+	return false
+}
+
 func isValidUrl(url string) bool {
 	return ipAddressRegex.MatchString(url) || hostnameRegex.MatchString(url)
 }
@@ -197,6 +197,145 @@ var _ = Describe("AccessLog", func() {
 			Expect(accessLogger.(*FileAndLoggregatorAccessLogger).DropsondeSourceInstance()).ToNot(BeEmpty())
 		})
 
+		It("creates an access log if a syslog collector is specified", func() {
+			cfg.AccessLog.Syslog.Address = "127.0.0.1:514"
+
+			accessLogger, err := CreateRunningAccessLogger(logger, cfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(accessLogger.(*FileAndLoggregatorAccessLogger).WriterCount()).To(Equal(1))
+		})
+
+		It("writes JSON with the configured fields", func() {
+			cfg.AccessLog.File = "/dev/null"
+			cfg.AccessLog.Format = "json"
+			cfg.AccessLog.Fields = []string{"host", "status"}
+
+			accessLogger, err := CreateRunningAccessLogger(logger, cfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(accessLogger.(*FileAndLoggregatorAccessLogger).JSONFields()).To(Equal([]string{"host", "status"}))
+		})
+
+		It("writes JSON with all fields when none are configured", func() {
+			cfg.AccessLog.File = "/dev/null"
+			cfg.AccessLog.Format = "json"
+
+			accessLogger, err := CreateRunningAccessLogger(logger, cfg)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(accessLogger.(*FileAndLoggregatorAccessLogger).JSONFields()).To(Equal(schema.JSONFields))
+		})
+
+		Context("with sampling", func() {
+			var logFile string
+
+			BeforeEach(func() {
+				f, err := ioutil.TempFile("", "access-log")
+				Expect(err).ToNot(HaveOccurred())
+				f.Close()
+				logFile = f.Name()
+
+				cfg.AccessLog.File = logFile
+				cfg.AccessLog.Sampling.SuccessPercentage = 0
+				cfg.AccessLog.Sampling.SlowRequestThreshold = 150 * time.Millisecond
+			})
+
+			AfterEach(func() {
+				os.Remove(logFile)
+			})
+
+			It("logs failed and slow requests but not sampled out successful ones", func() {
+				accessLogger, err := CreateRunningAccessLogger(logger, cfg)
+				Expect(err).ToNot(HaveOccurred())
+				defer accessLogger.Stop()
+
+				successful := CreateAccessLogRecord()
+				successful.Request.Host = "successful.bar"
+				successful.FinishedAt = successful.StartedAt.Add(100 * time.Millisecond)
+				accessLogger.Log(*successful)
+
+				failed := CreateAccessLogRecord()
+				failed.Request.Host = "failed.bar"
+				failed.StatusCode = http.StatusBadGateway
+				failed.FinishedAt = failed.StartedAt.Add(100 * time.Millisecond)
+				accessLogger.Log(*failed)
+
+				slow := CreateAccessLogRecord()
+				slow.Request.Host = "slow.bar"
+				slow.FinishedAt = slow.StartedAt.Add(200 * time.Millisecond)
+				accessLogger.Log(*slow)
+
+				var payload []byte
+				Eventually(func() string {
+					payload, _ = ioutil.ReadFile(logFile)
+					return string(payload)
+				}).Should(ContainSubstring("slow.bar"))
+				Expect(string(payload)).To(ContainSubstring("failed.bar"))
+				Expect(string(payload)).ToNot(ContainSubstring("successful.bar"))
+			})
+		})
+
+		Context("with virtual hosts", func() {
+			var dir string
+
+			BeforeEach(func() {
+				var err error
+				dir, err = ioutil.TempDir("", "access-log")
+				Expect(err).ToNot(HaveOccurred())
+
+				cfg.AccessLog.File = filepath.Join(dir, "access.log")
+				cfg.VirtualHosts = []config.VirtualHostConfig{
+					{Domain: "*.tenant.bar", AccessLogFile: filepath.Join(dir, "tenant.log")},
+					{Domain: "other.bar"},
+				}
+			})
+
+			AfterEach(func() {
+				os.RemoveAll(dir)
+			})
+
+			It("writes the records of virtual hosts to their own files", func() {
+				accessLogger, err := CreateRunningAccessLogger(logger, cfg)
+				Expect(err).ToNot(HaveOccurred())
+				defer accessLogger.Stop()
+
+				for _, host := range []string{"app.tenant.bar:8080", "other.bar", "foo.bar"} {
+					record := CreateAccessLogRecord()
+					record.Request.Host = host
+					accessLogger.Log(*record)
+				}
+
+				Eventually(func() string {
+					payload, _ := ioutil.ReadFile(filepath.Join(dir, "access.log"))
+					return string(payload)
+				}).Should(And(ContainSubstring("other.bar"), ContainSubstring("foo.bar")))
+				payload, err := ioutil.ReadFile(filepath.Join(dir, "access.log"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(payload)).ToNot(ContainSubstring("tenant.bar"))
+
+				payload, err = ioutil.ReadFile(filepath.Join(dir, "tenant.log"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(payload)).To(ContainSubstring("app.tenant.bar"))
+				Expect(string(payload)).ToNot(ContainSubstring("foo.bar"))
+			})
+
+			It("creates an access log for virtual hosts with their own files", func() {
+				cfg.AccessLog.File = ""
+
+				accessLogger, err := CreateRunningAccessLogger(logger, cfg)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(accessLogger).To(BeAssignableToTypeOf(&FileAndLoggregatorAccessLogger{}))
+			})
+		})
+
+		It("reports an error if an access log field is invalid", func() {
+			cfg.AccessLog.File = "/dev/null"
+			cfg.AccessLog.Format = "json"
+			cfg.AccessLog.Fields = []string{"host", "bogus"}
+
+			a, err := CreateRunningAccessLogger(logger, cfg)
+			Expect(err).To(HaveOccurred())
+			Expect(a).To(BeNil())
+		})
+
 		It("reports an error if the access log location is invalid", func() {
 			cfg.AccessLog.File = "/this\\is/illegal"
 
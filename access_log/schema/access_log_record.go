@@ -2,6 +2,8 @@ package schema
 
 import (
 	"bytes"
+	"crypto/tls"
+	"encoding/json"
 	"io"
 	"net/http"
 	"strconv"
@@ -87,7 +89,26 @@ type AccessLogRecord struct {
 	BodyBytesSent        int
 	RequestBytesReceived int
 	ExtraHeadersToLog    []string
-	record               []byte
+	// RouteTagsToLog are the tags of the route registration logged as
+	// tag_<name>.
+	RouteTagsToLog []string
+	// RouterError is the X-Cf-RouterError header of the response, set when
+	// the router rather than the endpoint failed the request.
+	RouterError string
+	// RequestID is the ID of the request, which is otherwise read from the
+	// X-Vcap-Request-Id header.
+	RequestID string
+	record    []byte
+}
+
+// JSONFields are the fields of records in the JSON format, in the order they
+// are written by default.
+var JSONFields = []string{
+	"timestamp", "host", "method", "path", "protocol", "status",
+	"request_bytes_received", "body_bytes_sent", "referer", "user_agent",
+	"remote_addr", "backend_addr", "x_forwarded_for", "x_forwarded_proto",
+	"vcap_request_id", "response_time", "app_id", "app_index", "instance_id",
+	"tls_version", "router_error",
 }
 
 func (r *AccessLogRecord) formatStartedAt() string {
@@ -98,6 +119,13 @@ func (r *AccessLogRecord) responseTime() float64 {
 	return float64(r.FinishedAt.UnixNano()-r.StartedAt.UnixNano()) / float64(time.Second)
 }
 
+func (r *AccessLogRecord) requestID() string {
+	if r.RequestID != "" {
+		return r.RequestID
+	}
+	return r.Request.Header.Get("X-Vcap-Request-Id")
+}
+
 // getRecord memoizes makeRecord()
 func (r *AccessLogRecord) getRecord() []byte {
 	if len(r.record) == 0 {
@@ -139,7 +167,7 @@ func (r *AccessLogRecord) makeRecord() []byte {
 	b.WriteDashOrStringValue(r.Request.Header.Get("X-Forwarded-Proto"))
 
 	b.WriteString(`vcap_request_id:`)
-	b.WriteDashOrStringValue(r.Request.Header.Get("X-Vcap-Request-Id"))
+	b.WriteDashOrStringValue(r.requestID())
 
 	b.WriteString(`response_time:`)
 	b.WriteDashOrFloatValue(r.responseTime())
@@ -152,12 +180,124 @@ func (r *AccessLogRecord) makeRecord() []byte {
 	b.WriteDashOrStringValue(appIndex)
 
 	r.addExtraHeaders(b)
+	r.addRouteTags(b)
 
 	b.WriteByte('\n')
 
 	return b.Bytes()
 }
 
+// WriteJSONTo writes the record as a line of JSON with the fields, followed
+// by the extra headers. Fields without a value are omitted.
+func (r *AccessLogRecord) WriteJSONTo(w io.Writer, fields []string) (int64, error) {
+	b := new(bytes.Buffer)
+	b.WriteByte('{')
+	for _, field := range fields {
+		if v := r.jsonValue(field); v != nil {
+			writeJSONField(b, field, v)
+		}
+	}
+	for _, header := range r.ExtraHeadersToLog {
+		if v := r.Request.Header.Get(header); v != "" {
+			writeJSONField(b, strings.Replace(strings.ToLower(header), "-", "_", -1), v)
+		}
+	}
+	for _, tag := range r.RouteTagsToLog {
+		if v := r.routeTag(tag); v != "" {
+			writeJSONField(b, "tag_"+tag, v)
+		}
+	}
+	b.WriteString("}\n")
+
+	n, err := w.Write(b.Bytes())
+	return int64(n), err
+}
+
+func writeJSONField(b *bytes.Buffer, name string, value interface{}) {
+	if b.Len() > 1 {
+		b.WriteByte(',')
+	}
+	key, _ := json.Marshal(name)
+	b.Write(key)
+	b.WriteByte(':')
+	v, _ := json.Marshal(value)
+	b.Write(v)
+}
+
+// jsonValue returns the value of the field, or nil if it has none.
+func (r *AccessLogRecord) jsonValue(field string) interface{} {
+	var s string
+	switch field {
+	case "timestamp":
+		return r.StartedAt.Format("2006-01-02T15:04:05.000Z07:00")
+	case "status":
+		if r.StatusCode == 0 {
+			return nil
+		}
+		return r.StatusCode
+	case "request_bytes_received":
+		return r.RequestBytesReceived
+	case "body_bytes_sent":
+		return r.BodyBytesSent
+	case "response_time":
+		if t := r.responseTime(); t >= 0 {
+			return t
+		}
+		return nil
+	case "host":
+		s = r.Request.Host
+	case "method":
+		s = r.Request.Method
+	case "path":
+		s = r.Request.URL.RequestURI()
+	case "protocol":
+		s = r.Request.Proto
+	case "referer":
+		s = r.Request.Header.Get("Referer")
+	case "user_agent":
+		s = r.Request.Header.Get("User-Agent")
+	case "remote_addr":
+		s = r.Request.RemoteAddr
+	case "x_forwarded_for":
+		s = r.Request.Header.Get("X-Forwarded-For")
+	case "x_forwarded_proto":
+		s = r.Request.Header.Get("X-Forwarded-Proto")
+	case "vcap_request_id":
+		s = r.requestID()
+	case "tls_version":
+		if r.Request.TLS != nil {
+			s = tlsVersions[r.Request.TLS.Version]
+		}
+	case "router_error":
+		s = r.RouterError
+	case "backend_addr":
+		if r.RouteEndpoint != nil {
+			s = r.RouteEndpoint.CanonicalAddr()
+		}
+	case "app_id":
+		s = r.ApplicationID()
+	case "app_index":
+		if r.RouteEndpoint != nil {
+			s = r.RouteEndpoint.PrivateInstanceIndex
+		}
+	case "instance_id":
+		if r.RouteEndpoint != nil {
+			s = r.RouteEndpoint.PrivateInstanceId
+		}
+	}
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "TLSv1.0",
+	tls.VersionTLS11: "TLSv1.1",
+	tls.VersionTLS12: "TLSv1.2",
+	tls.VersionTLS13: "TLSv1.3",
+}
+
 // WriteTo allows the AccessLogRecord to implement the io.WriterTo interface
 func (r *AccessLogRecord) WriteTo(w io.Writer) (int64, error) {
 	bytesWritten, err := w.Write(r.getRecord())
@@ -204,3 +344,20 @@ func (r *AccessLogRecord) addExtraHeaders(b *recordBuffer) {
 		b.WriteDashOrStringValue(r.Request.Header.Get(header))
 	}
 }
+
+func (r *AccessLogRecord) addRouteTags(b *recordBuffer) {
+	for _, tag := range r.RouteTagsToLog {
+		b.WriteByte(' ')
+		b.WriteString("tag_" + tag + ":")
+		b.WriteDashOrStringValue(r.routeTag(tag))
+	}
+}
+
+// routeTag returns the value of the tag of the route registration, or "" if
+// the request was not routed or the registration has no such tag.
+func (r *AccessLogRecord) routeTag(tag string) string {
+	if r.RouteEndpoint == nil {
+		return ""
+	}
+	return r.RouteEndpoint.Tags[tag]
+}
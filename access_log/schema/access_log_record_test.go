@@ -72,6 +72,16 @@ var _ = Describe("AccessLogRecord", func() {
 			Expect(record.LogMessage()).To(Equal(recordString))
 		})
 
+		Context("with the request ID set", func() {
+			BeforeEach(func() {
+				record.RequestID = "some-request-id"
+			})
+
+			It("logs the request ID rather than the X-Vcap-Request-Id header", func() {
+				Expect(record.LogMessage()).To(ContainSubstring(`vcap_request_id:"some-request-id" `))
+			})
+		})
+
 		Context("with values missing", func() {
 			BeforeEach(func() {
 				record.Request.Header = http.Header{}
@@ -150,6 +160,23 @@ var _ = Describe("AccessLogRecord", func() {
 			})
 		})
 
+		Context("with route tags", func() {
+			BeforeEach(func() {
+				record.RouteEndpoint = route.NewEndpoint("FakeApplicationId", "1.2.3.4", 1234, "", "3", map[string]string{"team": "payments"}, 0, "", models.ModificationTag{}, "")
+				record.Request.Header.Set("Cache-Control", "no-cache")
+				record.ExtraHeadersToLog = []string{"Cache-Control"}
+				record.RouteTagsToLog = []string{"team", "environment"}
+			})
+
+			It("appends the route tags after the extra headers", func() {
+				Expect(record.LogMessage()).To(HaveSuffix(`app_index:"3" ` +
+					`cache_control:"no-cache" ` +
+					`tag_team:"payments" ` +
+					`tag_environment:"-"` +
+					"\n"))
+			})
+		})
+
 		Context("when extra headers is an empty slice", func() {
 			It("Makes a record with all values", func() {
 				record := schema.AccessLogRecord{
@@ -228,6 +255,48 @@ var _ = Describe("AccessLogRecord", func() {
 		})
 	})
 
+	Describe("WriteJSONTo", func() {
+		It("writes the fields as a line of JSON", func() {
+			record.ExtraHeadersToLog = []string{"X-Custom-Header"}
+			record.Request.Header.Set("X-Custom-Header", "custom")
+			record.RouterError = "endpoint_failure"
+
+			b := new(bytes.Buffer)
+			_, err := record.WriteJSONTo(b, []string{"timestamp", "host", "path", "status", "backend_addr", "vcap_request_id", "response_time", "app_index", "router_error"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b.String()).To(Equal(`{"timestamp":"2000-01-01T00:00:00.000Z",` +
+				`"host":"FakeRequestHost",` +
+				`"path":"http://example.com/request",` +
+				`"status":200,` +
+				`"backend_addr":"1.2.3.4:1234",` +
+				`"vcap_request_id":"abc-123-xyz-pdq",` +
+				`"response_time":60,` +
+				`"app_index":"3",` +
+				`"router_error":"endpoint_failure",` +
+				`"x_custom_header":"custom"}` + "\n"))
+		})
+
+		It("writes the route tags of the route registration", func() {
+			record.RouteEndpoint = route.NewEndpoint("FakeApplicationId", "1.2.3.4", 1234, "", "3", map[string]string{"team": "payments"}, 0, "", models.ModificationTag{}, "")
+			record.RouteTagsToLog = []string{"team", "environment"}
+
+			b := new(bytes.Buffer)
+			_, err := record.WriteJSONTo(b, []string{"host"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b.String()).To(Equal(`{"host":"FakeRequestHost","tag_team":"payments"}` + "\n"))
+		})
+
+		It("omits fields without a value", func() {
+			record.RouteEndpoint = nil
+			record.StatusCode = 0
+
+			b := new(bytes.Buffer)
+			_, err := record.WriteJSONTo(b, []string{"host", "status", "backend_addr", "app_id", "tls_version", "router_error"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b.String()).To(Equal(`{"host":"FakeRequestHost"}` + "\n"))
+		})
+	})
+
 	Describe("ApplicationID", func() {
 		var emptyRecord schema.AccessLogRecord
 		Context("when RouteEndpoint is nil", func() {
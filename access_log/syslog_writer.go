@@ -0,0 +1,131 @@
+package access_log
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/config"
+)
+
+const (
+	syslogSeverityInfo = 6
+	syslogAppName      = "gorouter"
+	syslogDialTimeout  = 5 * time.Second
+)
+
+// SyslogWriter sends each write to a remote collector as an RFC 5424 syslog
+// message. Messages sent over TCP and TLS are framed by octet counting, as in
+// RFC 6587. The connection is dialed on the first write and redialed after it
+// fails.
+type SyslogWriter struct {
+	network   string
+	address   string
+	tlsConfig *tls.Config
+	priority  int
+	hostname  string
+	procID    string
+
+	lock sync.Mutex
+	conn net.Conn
+}
+
+func NewSyslogWriter(c config.AccessLogSyslogConfig) *SyslogWriter {
+	hostname := c.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	if hostname == "" {
+		hostname = "-"
+	}
+
+	w := &SyslogWriter{
+		network:  c.Network,
+		address:  c.Address,
+		priority: config.SyslogFacilities[c.Facility]*8 + syslogSeverityInfo,
+		hostname: hostname,
+		procID:   strconv.Itoa(os.Getpid()),
+	}
+	if c.Network == config.SYSLOG_NETWORK_TLS {
+		w.tlsConfig = &tls.Config{
+			RootCAs:            c.CAPool,
+			InsecureSkipVerify: c.SkipSSLValidation,
+		}
+	}
+	return w
+}
+
+func (w *SyslogWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	msg := w.message(p)
+	err := w.send(msg)
+	if err != nil {
+		// a connection closed by the collector is only noticed when it is
+		// written to, so the message is sent once more on a new connection
+		err = w.send(msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *SyslogWriter) send(msg []byte) error {
+	if w.conn == nil {
+		conn, err := w.dial()
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+	}
+	_, err := w.conn.Write(msg)
+	if err != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+	return err
+}
+
+func (w *SyslogWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+func (w *SyslogWriter) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: syslogDialTimeout}
+	if w.tlsConfig != nil {
+		return tls.DialWithDialer(dialer, "tcp", w.address, w.tlsConfig)
+	}
+	return dialer.Dial(w.network, w.address)
+}
+
+func (w *SyslogWriter) message(p []byte) []byte {
+	if len(p) > 0 && p[len(p)-1] == '\n' {
+		p = p[:len(p)-1]
+	}
+	msg := fmt.Sprintf("<%d>1 %s %s %s %s - - %s",
+		w.priority,
+		time.Now().UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		w.hostname,
+		syslogAppName,
+		w.procID,
+		p,
+	)
+	if w.network == config.SYSLOG_NETWORK_UDP {
+		return []byte(msg)
+	}
+	return []byte(fmt.Sprintf("%d %s", len(msg), msg))
+}
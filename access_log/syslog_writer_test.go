@@ -0,0 +1,112 @@
+package access_log_test
+
+import (
+	"io/ioutil"
+	"net"
+
+	. "code.cloudfoundry.org/gorouter/access_log"
+	"code.cloudfoundry.org/gorouter/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SyslogWriter", func() {
+	var syslogConfig config.AccessLogSyslogConfig
+
+	BeforeEach(func() {
+		syslogConfig = config.AccessLogSyslogConfig{
+			Facility: "local1",
+			Hostname: "router-host",
+		}
+	})
+
+	Context("over UDP", func() {
+		var conn net.PacketConn
+
+		BeforeEach(func() {
+			var err error
+			conn, err = net.ListenPacket("udp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+
+			syslogConfig.Network = "udp"
+			syslogConfig.Address = conn.LocalAddr().String()
+		})
+
+		AfterEach(func() {
+			conn.Close()
+		})
+
+		It("sends each write as an RFC 5424 message", func() {
+			w := NewSyslogWriter(syslogConfig)
+			defer w.Close()
+
+			n, err := w.Write([]byte("foo.bar - [access log line]\n"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(29))
+
+			b := make([]byte, 1024)
+			n, _, err = conn.ReadFrom(b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(b[:n])).To(MatchRegexp(`^<142>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}Z router-host gorouter \d+ - - foo\.bar - \[access log line\]$`))
+		})
+	})
+
+	Context("over TCP", func() {
+		var (
+			listener net.Listener
+			received chan string
+		)
+
+		BeforeEach(func() {
+			var err error
+			listener, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+
+			received = make(chan string, 1)
+			go func() {
+				defer GinkgoRecover()
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				b, _ := ioutil.ReadAll(conn)
+				received <- string(b)
+			}()
+
+			syslogConfig.Network = "tcp"
+			syslogConfig.Address = listener.Addr().String()
+		})
+
+		AfterEach(func() {
+			listener.Close()
+		})
+
+		It("frames messages by octet counting", func() {
+			w := NewSyslogWriter(syslogConfig)
+			defer w.Close()
+
+			_, err := w.Write([]byte("first\n"))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = w.Write([]byte("second\n"))
+			Expect(err).ToNot(HaveOccurred())
+			w.Close()
+
+			var messages string
+			Eventually(received).Should(Receive(&messages))
+			Expect(messages).To(MatchRegexp(`^\d+ <142>1 \S+ router-host gorouter \d+ - - first\d+ <142>1 \S+ router-host gorouter \d+ - - second$`))
+		})
+	})
+
+	It("returns an error when the collector cannot be reached", func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		syslogConfig.Network = "tcp"
+		syslogConfig.Address = listener.Addr().String()
+		listener.Close()
+
+		w := NewSyslogWriter(syslogConfig)
+		_, err = w.Write([]byte("foo\n"))
+		Expect(err).To(HaveOccurred())
+	})
+})
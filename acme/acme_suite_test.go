@@ -0,0 +1,13 @@
+package acme_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestACME(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "ACME Suite")
+}
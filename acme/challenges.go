@@ -0,0 +1,56 @@
+package acme
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const challengePathPrefix = "/.well-known/acme-challenge/"
+
+// Challenges are the responses to the http-01 challenges of the ACME
+// certificate authority that are in progress. They are answered by the proxy
+// on its HTTP listener, so that the router can obtain certificates for
+// domains that are routed to it.
+type Challenges struct {
+	lock      sync.RWMutex
+	responses map[string]string
+}
+
+func NewChallenges() *Challenges {
+	return &Challenges{responses: map[string]string{}}
+}
+
+func (c *Challenges) set(token, response string) {
+	c.lock.Lock()
+	c.responses[token] = response
+	c.lock.Unlock()
+}
+
+func (c *Challenges) remove(token string) {
+	c.lock.Lock()
+	delete(c.responses, token)
+	c.lock.Unlock()
+}
+
+func (c *Challenges) response(token string) (string, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	response, ok := c.responses[token]
+	return response, ok
+}
+
+// ServeHTTP answers the http-01 challenges in progress. Other requests,
+// including challenges of apps obtaining their own certificates, are passed
+// to the next handler.
+func (c *Challenges) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if (r.Method == "GET" || r.Method == "HEAD") && strings.HasPrefix(r.URL.Path, challengePathPrefix) {
+		if response, ok := c.response(strings.TrimPrefix(r.URL.Path, challengePathPrefix)); ok {
+			rw.Header().Set("Content-Type", "text/plain")
+			rw.WriteHeader(http.StatusOK)
+			rw.Write([]byte(response))
+			return
+		}
+	}
+	next(rw, r)
+}
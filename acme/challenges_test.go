@@ -0,0 +1,41 @@
+package acme_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/gorouter/acme"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Challenges", func() {
+	var (
+		challenges *acme.Challenges
+		nextCalled bool
+	)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		nextCalled = false
+		resp := httptest.NewRecorder()
+		challenges.ServeHTTP(resp, httptest.NewRequest(method, "http://example.com"+path, nil), func(rw http.ResponseWriter, r *http.Request) {
+			nextCalled = true
+		})
+		return resp
+	}
+
+	BeforeEach(func() {
+		challenges = acme.NewChallenges()
+	})
+
+	It("passes requests on when no challenge is in progress", func() {
+		serve("GET", "/.well-known/acme-challenge/token")
+		Expect(nextCalled).To(BeTrue())
+	})
+
+	It("passes other requests on", func() {
+		serve("GET", "/")
+		Expect(nextCalled).To(BeTrue())
+	})
+})
@@ -0,0 +1,86 @@
+package acme
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"sync"
+)
+
+// DNSProvider creates and removes the TXT records answering the dns-01
+// challenges of the ACME certificate authority. Present should only return
+// once the record can be resolved by the certificate authority.
+type DNSProvider interface {
+	// Present creates the TXT record fqdn with the value.
+	Present(fqdn, value string) error
+	// CleanUp removes the TXT record fqdn with the value.
+	CleanUp(fqdn, value string) error
+}
+
+// DNSProviderFactory creates a DNSProvider from the dns_provider_options of
+// the acme config.
+type DNSProviderFactory func(options map[string]string) (DNSProvider, error)
+
+var (
+	dnsProvidersLock sync.Mutex
+	dnsProviders     = map[string]DNSProviderFactory{
+		"exec": newExecProvider,
+	}
+)
+
+// RegisterDNSProvider registers the factory of the DNS provider with the name
+// that is configured as the dns_provider of the acme config. It is usually
+// called from an init function, and panics if the name is already registered
+// or the factory is nil.
+func RegisterDNSProvider(name string, factory DNSProviderFactory) {
+	if factory == nil {
+		panic("acme: nil DNS provider factory")
+	}
+
+	dnsProvidersLock.Lock()
+	defer dnsProvidersLock.Unlock()
+	if _, ok := dnsProviders[name]; ok {
+		panic(fmt.Sprintf("acme: DNS provider %s registered twice", name))
+	}
+	dnsProviders[name] = factory
+}
+
+// NewDNSProvider creates the DNS provider registered with the name.
+func NewDNSProvider(name string, options map[string]string) (DNSProvider, error) {
+	dnsProvidersLock.Lock()
+	factory, ok := dnsProviders[name]
+	dnsProvidersLock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("acme: unknown DNS provider %s", name)
+	}
+	return factory(options)
+}
+
+// execProvider runs a command to create and remove records, as
+// `command present <fqdn> <value>` and `command cleanup <fqdn> <value>`.
+type execProvider struct {
+	command string
+}
+
+func newExecProvider(options map[string]string) (DNSProvider, error) {
+	if options["command"] == "" {
+		return nil, errors.New("acme: the exec DNS provider requires a command option")
+	}
+	return &execProvider{command: options["command"]}, nil
+}
+
+func (p *execProvider) Present(fqdn, value string) error {
+	return p.run("present", fqdn, value)
+}
+
+func (p *execProvider) CleanUp(fqdn, value string) error {
+	return p.run("cleanup", fqdn, value)
+}
+
+func (p *execProvider) run(action, fqdn, value string) error {
+	out, err := exec.Command(p.command, action, fqdn, value).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("acme: %s %s: %s: %s", p.command, action, err, out)
+	}
+	return nil
+}
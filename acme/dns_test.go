@@ -0,0 +1,61 @@
+package acme_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/gorouter/acme"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DNSProvider", func() {
+	It("panics when a name is registered twice", func() {
+		Expect(func() {
+			acme.RegisterDNSProvider("exec", func(map[string]string) (acme.DNSProvider, error) { return nil, nil })
+		}).To(Panic())
+	})
+
+	Describe("exec", func() {
+		var (
+			dir      string
+			provider acme.DNSProvider
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "gorouter-acme-dns")
+			Expect(err).ToNot(HaveOccurred())
+			command := filepath.Join(dir, "dns-challenge")
+			script := "#!/bin/sh\necho \"$@\" >> " + filepath.Join(dir, "calls") + "\n[ \"$2\" != fail.example.com ]\n"
+			Expect(ioutil.WriteFile(command, []byte(script), 0755)).To(Succeed())
+
+			provider, err = acme.NewDNSProvider("exec", map[string]string{"command": command})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("runs the command to present and clean up records", func() {
+			Expect(provider.Present("_acme-challenge.example.com", "value")).To(Succeed())
+			Expect(provider.CleanUp("_acme-challenge.example.com", "value")).To(Succeed())
+
+			calls, err := ioutil.ReadFile(filepath.Join(dir, "calls"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(calls)).To(Equal("present _acme-challenge.example.com value\ncleanup _acme-challenge.example.com value\n"))
+		})
+
+		It("returns an error when the command fails", func() {
+			Expect(provider.Present("fail.example.com", "value")).ToNot(Succeed())
+		})
+
+		It("requires a command", func() {
+			_, err := acme.NewDNSProvider("exec", nil)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,380 @@
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"github.com/uber-go/zap"
+	acmeapi "golang.org/x/crypto/acme"
+)
+
+const (
+	accountKeyFile = "account.key"
+	obtainTimeout  = 10 * time.Minute
+)
+
+// CertificateStore serves the certificates obtained by a Manager.
+type CertificateStore interface {
+	SetACMECertificates(byHostname map[string]*tls.Certificate)
+}
+
+// Manager obtains a certificate for each of the configured domains from an
+// ACME certificate authority, such as Let's Encrypt, and renews it before it
+// expires. The certificates are kept in the cache directory, so that they are
+// served again when the router restarts, and are passed to the store keyed by
+// their domain whenever one of them changes.
+type Manager struct {
+	config     config.ACMEConfig
+	client     *acmeapi.Client
+	challenges *Challenges
+	dns        DNSProvider
+	store      CertificateStore
+	logger     logger.Logger
+	clock      clock.Clock
+
+	registered   bool
+	certificates map[string]*tls.Certificate
+}
+
+// NewManager creates the account key in the cache directory unless it
+// exists, and passes the certificates in the cache directory to the store.
+// The http-01 challenges of the certificate authority are answered by
+// challenges, which must be handled by the proxy.
+func NewManager(
+	logger logger.Logger,
+	cfg config.ACMEConfig,
+	challenges *Challenges,
+	store CertificateStore,
+	clock clock.Clock,
+) (*Manager, error) {
+	if err := os.MkdirAll(cfg.CacheDir, 0700); err != nil {
+		return nil, err
+	}
+	key, err := loadAccountKey(filepath.Join(cfg.CacheDir, accountKeyFile))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		config: cfg,
+		client: &acmeapi.Client{
+			Key:          key,
+			DirectoryURL: cfg.DirectoryURL,
+			UserAgent:    "gorouter",
+		},
+		challenges:   challenges,
+		store:        store,
+		logger:       logger,
+		clock:        clock,
+		certificates: map[string]*tls.Certificate{},
+	}
+	if cfg.Challenge == config.ACME_CHALLENGE_DNS01 {
+		m.dns, err = NewDNSProvider(cfg.DNSProvider, cfg.DNSProviderOptions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, domain := range cfg.Domains {
+		certificate, err := loadCertificate(m.certificatePath(domain))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				logger.Error("cached-certificate-invalid", zap.String("domain", domain), zap.Error(err))
+			}
+			continue
+		}
+		m.certificates[domain] = certificate
+	}
+	if len(m.certificates) > 0 {
+		m.updateStore()
+	}
+	return m, nil
+}
+
+func (m *Manager) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ticker := m.clock.NewTicker(m.config.CheckInterval)
+	m.logger.Info("acme-manager-started", zap.Duration("check_interval", m.config.CheckInterval))
+
+	// certificates are obtained in the background, as the certificate
+	// authority may take minutes to validate the challenges
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Renew(ctx)
+		for {
+			select {
+			case <-ticker.C():
+				m.Renew(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	close(ready)
+	<-signals
+	m.logger.Info("stopping")
+	cancel()
+	ticker.Stop()
+	<-done
+	return nil
+}
+
+// Renew obtains a certificate for each domain that has none, or whose
+// certificate expires within the renewal period. Domains whose certificate
+// cannot be obtained keep their current certificate, and are retried at the
+// next check.
+func (m *Manager) Renew(ctx context.Context) {
+	changed := false
+	for _, domain := range m.config.Domains {
+		if !m.needsRenewal(domain) {
+			continue
+		}
+		certificate, err := m.obtain(ctx, domain)
+		if err != nil {
+			m.logger.Error("certificate-failed", zap.String("domain", domain), zap.Error(err))
+			continue
+		}
+		if err := saveCertificate(m.certificatePath(domain), certificate); err != nil {
+			m.logger.Error("certificate-cache-failed", zap.String("domain", domain), zap.Error(err))
+		}
+		m.logger.Info("certificate-obtained", zap.String("domain", domain), zap.Time("not_after", certificate.Leaf.NotAfter))
+		m.certificates[domain] = certificate
+		changed = true
+	}
+	if changed {
+		m.updateStore()
+	}
+}
+
+func (m *Manager) needsRenewal(domain string) bool {
+	certificate, ok := m.certificates[domain]
+	return !ok || m.clock.Now().Add(m.config.RenewBefore).After(certificate.Leaf.NotAfter)
+}
+
+func (m *Manager) updateStore() {
+	byHostname := make(map[string]*tls.Certificate, len(m.certificates))
+	for domain, certificate := range m.certificates {
+		byHostname[domain] = certificate
+	}
+	m.store.SetACMECertificates(byHostname)
+}
+
+// obtain orders a certificate for the domain and answers the challenges of
+// its authorizations.
+func (m *Manager) obtain(ctx context.Context, domain string) (*tls.Certificate, error) {
+	ctx, cancel := context.WithTimeout(ctx, obtainTimeout)
+	defer cancel()
+
+	if err := m.register(ctx); err != nil {
+		return nil, err
+	}
+	order, err := m.client.AuthorizeOrder(ctx, acmeapi.DomainIDs(domain))
+	if err != nil {
+		return nil, err
+	}
+	for _, url := range order.AuthzURLs {
+		if err := m.authorize(ctx, url); err != nil {
+			return nil, err
+		}
+	}
+	order, err = m.client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{domain}}, key)
+	if err != nil {
+		return nil, err
+	}
+	der, _, err := m.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der[0])
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{Certificate: der, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// register registers the account key with the certificate authority once.
+func (m *Manager) register(ctx context.Context) error {
+	if m.registered {
+		return nil
+	}
+	account := &acmeapi.Account{}
+	if m.config.Email != "" {
+		account.Contact = []string{"mailto:" + m.config.Email}
+	}
+	_, err := m.client.Register(ctx, account, acmeapi.AcceptTOS)
+	if err != nil && err != acmeapi.ErrAccountAlreadyExists {
+		return err
+	}
+	m.registered = true
+	return nil
+}
+
+// authorize answers the configured challenge of the authorization, unless
+// it is already valid, and waits for the certificate authority to validate
+// it.
+func (m *Manager) authorize(ctx context.Context, url string) error {
+	authz, err := m.client.GetAuthorization(ctx, url)
+	if err != nil {
+		return err
+	}
+	if authz.Status == acmeapi.StatusValid {
+		return nil
+	}
+
+	var challenge *acmeapi.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == m.config.Challenge {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("acme: the %s challenge is not offered for %s", m.config.Challenge, authz.Identifier.Value)
+	}
+
+	cleanUp, err := m.prepare(authz.Identifier.Value, challenge)
+	if err != nil {
+		return err
+	}
+	defer cleanUp()
+
+	if _, err := m.client.Accept(ctx, challenge); err != nil {
+		return err
+	}
+	_, err = m.client.WaitAuthorization(ctx, authz.URI)
+	return err
+}
+
+// prepare sets up the response to the challenge for the domain, and returns
+// the function removing it.
+func (m *Manager) prepare(domain string, challenge *acmeapi.Challenge) (func(), error) {
+	if m.config.Challenge == config.ACME_CHALLENGE_DNS01 {
+		value, err := m.client.DNS01ChallengeRecord(challenge.Token)
+		if err != nil {
+			return nil, err
+		}
+		fqdn := "_acme-challenge." + domain
+		if err := m.dns.Present(fqdn, value); err != nil {
+			return nil, err
+		}
+		return func() {
+			if err := m.dns.CleanUp(fqdn, value); err != nil {
+				m.logger.Error("dns-challenge-cleanup-failed", zap.String("fqdn", fqdn), zap.Error(err))
+			}
+		}, nil
+	}
+
+	response, err := m.client.HTTP01ChallengeResponse(challenge.Token)
+	if err != nil {
+		return nil, err
+	}
+	m.challenges.set(challenge.Token, response)
+	return func() { m.challenges.remove(challenge.Token) }, nil
+}
+
+// certificatePath returns the path of the cached certificate of the domain.
+func (m *Manager) certificatePath(domain string) string {
+	return filepath.Join(m.config.CacheDir, strings.Replace(domain, "*", "_wildcard", 1)+".pem")
+}
+
+// loadAccountKey reads the account key at path, or generates it and writes
+// it to path if it does not exist.
+func loadAccountKey(path string) (crypto.Signer, error) {
+	b, err := ioutil.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(b)
+		if block == nil || block.Type != "EC PRIVATE KEY" {
+			return nil, fmt.Errorf("acme: invalid account key %s", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// loadCertificate reads the certificate chain and private key at path.
+func loadCertificate(path string) (*tls.Certificate, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	certificate, err := tls.X509KeyPair(b, b)
+	if err != nil {
+		return nil, err
+	}
+	certificate.Leaf, err = x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	return &certificate, nil
+}
+
+// saveCertificate writes the certificate chain and private key to path.
+func saveCertificate(path string, certificate *tls.Certificate) error {
+	key, ok := certificate.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return errors.New("acme: unsupported private key")
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	var b []byte
+	for _, der := range certificate.Certificate {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	b = append(b, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...)
+	return writeFile(path, b)
+}
+
+// writeFile replaces the file at path, so that it is never read partially
+// written.
+func writeFile(path string, b []byte) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,552 @@
+package acme_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/gorouter/acme"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/test_util"
+	acmeapi "golang.org/x/crypto/acme"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+type fakeStore struct {
+	lock    sync.Mutex
+	updates []map[string]*tls.Certificate
+}
+
+func (s *fakeStore) SetACMECertificates(byHostname map[string]*tls.Certificate) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.updates = append(s.updates, byHostname)
+}
+
+func (s *fakeStore) last() map[string]*tls.Certificate {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.updates) == 0 {
+		return nil
+	}
+	return s.updates[len(s.updates)-1]
+}
+
+func (s *fakeStore) count() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.updates)
+}
+
+// fakeDNS records the TXT records presented by the manager.
+type fakeDNS struct {
+	lock     sync.Mutex
+	records  map[string]string
+	cleanUps []string
+}
+
+func (d *fakeDNS) Present(fqdn, value string) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.records[fqdn] = value
+	return nil
+}
+
+func (d *fakeDNS) CleanUp(fqdn, value string) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.records, fqdn)
+	d.cleanUps = append(d.cleanUps, fqdn)
+	return nil
+}
+
+func (d *fakeDNS) record(fqdn string) string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.records[fqdn]
+}
+
+var testDNS = &fakeDNS{}
+
+func init() {
+	acme.RegisterDNSProvider("test", func(options map[string]string) (acme.DNSProvider, error) {
+		return testDNS, nil
+	})
+}
+
+var _ = Describe("Manager", func() {
+	var (
+		logger     *test_util.TestZapLogger
+		cfg        config.ACMEConfig
+		clock      *fakeclock.FakeClock
+		challenges *acme.Challenges
+		store      *fakeStore
+		ca         *fakeCA
+		manager    *acme.Manager
+	)
+
+	newManager := func() *acme.Manager {
+		m, err := acme.NewManager(logger, cfg, challenges, store, clock)
+		Expect(err).ToNot(HaveOccurred())
+		return m
+	}
+
+	BeforeEach(func() {
+		logger = test_util.NewTestZapLogger("test")
+		clock = fakeclock.NewFakeClock(time.Now())
+		challenges = acme.NewChallenges()
+		store = &fakeStore{}
+		testDNS.records = map[string]string{}
+		testDNS.cleanUps = nil
+		ca = newFakeCA(challenges, testDNS)
+
+		cacheDir, err := ioutil.TempDir("", "gorouter-acme")
+		Expect(err).ToNot(HaveOccurred())
+		cfg = config.ACMEConfig{
+			Enabled:       true,
+			DirectoryURL:  ca.server.URL + "/directory",
+			Email:         "ops@example.com",
+			Domains:       []string{"example.com", "www.example.com"},
+			Challenge:     config.ACME_CHALLENGE_HTTP01,
+			CacheDir:      cacheDir,
+			RenewBefore:   30 * 24 * time.Hour,
+			CheckInterval: 12 * time.Hour,
+		}
+	})
+
+	AfterEach(func() {
+		ca.server.Close()
+		os.RemoveAll(cfg.CacheDir)
+	})
+
+	JustBeforeEach(func() {
+		manager = newManager()
+	})
+
+	It("creates the account key", func() {
+		_, err := os.Stat(filepath.Join(cfg.CacheDir, "account.key"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(store.count()).To(Equal(0))
+	})
+
+	Context("when the certificates are obtained", func() {
+		JustBeforeEach(func() {
+			manager.Renew(context.Background())
+		})
+
+		It("answers the http-01 challenges and passes the certificates to the store", func() {
+			Expect(ca.contacts()).To(Equal([]string{"mailto:ops@example.com"}))
+			Expect(store.count()).To(Equal(1))
+			certificates := store.last()
+			Expect(certificates).To(HaveLen(2))
+			Expect(certificates["example.com"].Leaf.DNSNames).To(Equal([]string{"example.com"}))
+			Expect(certificates["www.example.com"].Leaf.DNSNames).To(Equal([]string{"www.example.com"}))
+			Expect(certificates["example.com"].Certificate).To(HaveLen(2))
+			Expect(logger.Buffer()).To(gbytes.Say("certificate-obtained"))
+		})
+
+		It("removes the responses to the challenges", func() {
+			token := ca.tokens()[0]
+			resp := httptest.NewRecorder()
+			nextCalled := false
+			challenges.ServeHTTP(resp, httptest.NewRequest("GET", "http://example.com/.well-known/acme-challenge/"+token, nil), func(http.ResponseWriter, *http.Request) {
+				nextCalled = true
+			})
+			Expect(nextCalled).To(BeTrue())
+		})
+
+		It("does not renew certificates that do not expire soon", func() {
+			manager.Renew(context.Background())
+			Expect(ca.orderCount()).To(Equal(2))
+			Expect(store.count()).To(Equal(1))
+		})
+
+		It("renews certificates that expire within the renewal period", func() {
+			clock.Increment(61 * 24 * time.Hour)
+			manager.Renew(context.Background())
+			Expect(ca.orderCount()).To(Equal(4))
+			Expect(store.count()).To(Equal(2))
+		})
+
+		It("serves the cached certificates when the manager is created again", func() {
+			previous := store.last()
+			newManager()
+
+			Expect(store.count()).To(Equal(2))
+			Expect(store.last()["example.com"].Certificate).To(Equal(previous["example.com"].Certificate))
+			Expect(store.last()["example.com"].Leaf).ToNot(BeNil())
+		})
+	})
+
+	Context("when a challenge fails", func() {
+		BeforeEach(func() {
+			ca.failChallenges = true
+		})
+
+		It("logs the error and does not update the store", func() {
+			manager.Renew(context.Background())
+			Expect(logger.Buffer()).To(gbytes.Say("certificate-failed"))
+			Expect(store.count()).To(Equal(0))
+		})
+	})
+
+	Context("when the dns-01 challenge is configured", func() {
+		BeforeEach(func() {
+			cfg.Challenge = config.ACME_CHALLENGE_DNS01
+			cfg.DNSProvider = "test"
+			cfg.Domains = []string{"*.apps.example.com"}
+		})
+
+		It("presents the TXT records with the DNS provider and removes them", func() {
+			manager.Renew(context.Background())
+			Expect(store.last()).To(HaveKey("*.apps.example.com"))
+			Expect(store.last()["*.apps.example.com"].Leaf.DNSNames).To(Equal([]string{"*.apps.example.com"}))
+			Expect(testDNS.cleanUps).To(Equal([]string{"_acme-challenge.apps.example.com"}))
+			_, err := os.Stat(filepath.Join(cfg.CacheDir, "_wildcard.apps.example.com.pem"))
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	Context("when the DNS provider is unknown", func() {
+		It("returns an error", func() {
+			cfg.Challenge = config.ACME_CHALLENGE_DNS01
+			cfg.DNSProvider = "unknown"
+			_, err := acme.NewManager(logger, cfg, challenges, store, clock)
+			Expect(err).To(MatchError("acme: unknown DNS provider unknown"))
+		})
+	})
+
+	Describe("Run", func() {
+		It("obtains the certificates and stops when signalled", func() {
+			signals := make(chan os.Signal)
+			ready := make(chan struct{})
+			errChan := make(chan error)
+			go func() {
+				errChan <- manager.Run(signals, ready)
+			}()
+			Eventually(ready).Should(BeClosed())
+			Eventually(store.count).Should(Equal(1))
+
+			signals <- os.Interrupt
+			Eventually(errChan).Should(Receive(BeNil()))
+		})
+	})
+})
+
+// fakeCA is an ACME certificate authority that validates the challenges of
+// authorizations as soon as they are accepted.
+type fakeCA struct {
+	server     *httptest.Server
+	key        *ecdsa.PrivateKey
+	cert       *x509.Certificate
+	challenges *acme.Challenges
+	dns        *fakeDNS
+
+	failChallenges bool
+
+	lock       sync.Mutex
+	nonce      int
+	thumbprint string
+	accounts   [][]string
+	orders     []*fakeOrder
+	authzs     map[string]*fakeAuthz
+}
+
+type fakeOrder struct {
+	authzs      []string
+	certificate []byte
+}
+
+type fakeAuthz struct {
+	domain   string
+	wildcard bool
+	token    string
+	status   string
+}
+
+func newFakeCA(challenges *acme.Challenges, dns *fakeDNS) *fakeCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake ACME CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).ToNot(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).ToNot(HaveOccurred())
+
+	ca := &fakeCA{
+		key:        key,
+		cert:       cert,
+		challenges: challenges,
+		dns:        dns,
+		authzs:     map[string]*fakeAuthz{},
+	}
+	ca.server = httptest.NewServer(http.HandlerFunc(ca.serveHTTP))
+	return ca
+}
+
+func (ca *fakeCA) contacts() []string {
+	ca.lock.Lock()
+	defer ca.lock.Unlock()
+	return ca.accounts[0]
+}
+
+func (ca *fakeCA) orderCount() int {
+	ca.lock.Lock()
+	defer ca.lock.Unlock()
+	return len(ca.orders)
+}
+
+func (ca *fakeCA) tokens() []string {
+	ca.lock.Lock()
+	defer ca.lock.Unlock()
+	var tokens []string
+	for _, authz := range ca.authzs {
+		tokens = append(tokens, authz.token)
+	}
+	return tokens
+}
+
+func (ca *fakeCA) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	defer GinkgoRecover()
+	ca.lock.Lock()
+	ca.nonce++
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", ca.nonce))
+	ca.lock.Unlock()
+
+	if r.URL.Path == "/directory" {
+		ca.writeJSON(w, http.StatusOK, "", map[string]string{
+			"newNonce":   ca.server.URL + "/new-nonce",
+			"newAccount": ca.server.URL + "/new-account",
+			"newOrder":   ca.server.URL + "/new-order",
+		})
+		return
+	}
+	if r.URL.Path == "/new-nonce" {
+		return
+	}
+
+	var jws struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+	}
+	Expect(json.NewDecoder(r.Body).Decode(&jws)).To(Succeed())
+	payload, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	Expect(err).ToNot(HaveOccurred())
+
+	ca.lock.Lock()
+	defer ca.lock.Unlock()
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch parts[0] {
+	case "new-account":
+		ca.newAccount(w, jws.Protected, payload)
+	case "new-order":
+		ca.newOrder(w, payload)
+	case "order":
+		ca.writeOrder(w, http.StatusOK, parts[1])
+	case "authz":
+		ca.writeJSON(w, http.StatusOK, "", ca.authzJSON(parts[1]))
+	case "challenge":
+		ca.validate(w, parts[1], parts[2])
+	case "finalize":
+		ca.finalize(w, parts[1], payload)
+	case "cert":
+		var i int
+		fmt.Sscan(parts[1], &i)
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(ca.orders[i].certificate)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (ca *fakeCA) newAccount(w http.ResponseWriter, protected string, payload []byte) {
+	b, err := base64.RawURLEncoding.DecodeString(protected)
+	Expect(err).ToNot(HaveOccurred())
+	var header struct {
+		JWK struct {
+			X string `json:"x"`
+			Y string `json:"y"`
+		} `json:"jwk"`
+	}
+	Expect(json.Unmarshal(b, &header)).To(Succeed())
+	x, err := base64.RawURLEncoding.DecodeString(header.JWK.X)
+	Expect(err).ToNot(HaveOccurred())
+	y, err := base64.RawURLEncoding.DecodeString(header.JWK.Y)
+	Expect(err).ToNot(HaveOccurred())
+	ca.thumbprint, err = acmeapi.JWKThumbprint(&ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	})
+	Expect(err).ToNot(HaveOccurred())
+
+	var account struct {
+		Contact []string `json:"contact"`
+	}
+	Expect(json.Unmarshal(payload, &account)).To(Succeed())
+	ca.accounts = append(ca.accounts, account.Contact)
+	ca.writeJSON(w, http.StatusCreated, ca.server.URL+"/account/1", map[string]string{"status": "valid"})
+}
+
+func (ca *fakeCA) newOrder(w http.ResponseWriter, payload []byte) {
+	var request struct {
+		Identifiers []struct {
+			Value string `json:"value"`
+		} `json:"identifiers"`
+	}
+	Expect(json.Unmarshal(payload, &request)).To(Succeed())
+
+	order := &fakeOrder{}
+	id := fmt.Sprint(len(ca.orders))
+	for i, identifier := range request.Identifiers {
+		authzID := fmt.Sprintf("%s-%d", id, i)
+		ca.authzs[authzID] = &fakeAuthz{
+			domain:   strings.TrimPrefix(identifier.Value, "*."),
+			wildcard: strings.HasPrefix(identifier.Value, "*."),
+			token:    "token-" + authzID,
+			status:   acmeapi.StatusPending,
+		}
+		order.authzs = append(order.authzs, authzID)
+	}
+	ca.orders = append(ca.orders, order)
+	ca.writeOrder(w, http.StatusCreated, id)
+}
+
+func (ca *fakeCA) writeOrder(w http.ResponseWriter, status int, id string) {
+	var i int
+	fmt.Sscan(id, &i)
+	order := ca.orders[i]
+
+	orderStatus := acmeapi.StatusReady
+	var authzURLs []string
+	for _, authzID := range order.authzs {
+		authzURLs = append(authzURLs, ca.server.URL+"/authz/"+authzID)
+		if s := ca.authzs[authzID].status; s != acmeapi.StatusValid {
+			orderStatus = s
+		}
+	}
+	body := map[string]interface{}{
+		"authorizations": authzURLs,
+		"finalize":       ca.server.URL + "/finalize/" + id,
+	}
+	if order.certificate != nil {
+		orderStatus = acmeapi.StatusValid
+		body["certificate"] = ca.server.URL + "/cert/" + id
+	}
+	body["status"] = orderStatus
+	ca.writeJSON(w, status, ca.server.URL+"/order/"+id, body)
+}
+
+func (ca *fakeCA) authzJSON(id string) map[string]interface{} {
+	authz := ca.authzs[id]
+	var challenges []map[string]string
+	for _, typ := range []string{"http-01", "dns-01"} {
+		challenges = append(challenges, map[string]string{
+			"type":   typ,
+			"url":    ca.server.URL + "/challenge/" + id + "/" + typ,
+			"token":  authz.token,
+			"status": authz.status,
+		})
+	}
+	return map[string]interface{}{
+		"status":     authz.status,
+		"identifier": map[string]string{"type": "dns", "value": authz.domain},
+		"wildcard":   authz.wildcard,
+		"challenges": challenges,
+	}
+}
+
+// validate checks the response to the challenge, as the certificate
+// authority would by requesting it from the router or resolving its record.
+func (ca *fakeCA) validate(w http.ResponseWriter, id, typ string) {
+	authz := ca.authzs[id]
+	keyAuth := authz.token + "." + ca.thumbprint
+
+	valid := false
+	if typ == "dns-01" {
+		sum := sha256.Sum256([]byte(keyAuth))
+		valid = ca.dns.record("_acme-challenge."+authz.domain) == base64.RawURLEncoding.EncodeToString(sum[:])
+	} else {
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://"+authz.domain+"/.well-known/acme-challenge/"+authz.token, nil)
+		ca.challenges.ServeHTTP(resp, req, func(rw http.ResponseWriter, r *http.Request) {
+			rw.WriteHeader(http.StatusNotFound)
+		})
+		valid = resp.Code == http.StatusOK && resp.Body.String() == keyAuth
+	}
+
+	authz.status = acmeapi.StatusValid
+	if !valid || ca.failChallenges {
+		authz.status = acmeapi.StatusInvalid
+	}
+	ca.writeJSON(w, http.StatusOK, "", map[string]string{"status": authz.status, "token": authz.token})
+}
+
+func (ca *fakeCA) finalize(w http.ResponseWriter, id string, payload []byte) {
+	var request struct {
+		CSR string `json:"csr"`
+	}
+	Expect(json.Unmarshal(payload, &request)).To(Succeed())
+	der, err := base64.RawURLEncoding.DecodeString(request.CSR)
+	Expect(err).ToNot(HaveOccurred())
+	csr, err := x509.ParseCertificateRequest(der)
+	Expect(err).ToNot(HaveOccurred())
+
+	var i int
+	fmt.Sscan(id, &i)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(int64(i + 2)),
+		Subject:      pkix.Name{CommonName: csr.DNSNames[0]},
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leaf, err := x509.CreateCertificate(rand.Reader, template, ca.cert, csr.PublicKey, ca.key)
+	Expect(err).ToNot(HaveOccurred())
+	ca.orders[i].certificate = append(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})...,
+	)
+	ca.writeOrder(w, http.StatusOK, id)
+}
+
+func (ca *fakeCA) writeJSON(w http.ResponseWriter, status int, location string, body interface{}) {
+	if location != "" {
+		w.Header().Set("Location", location)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	Expect(json.NewEncoder(w).Encode(body)).To(Succeed())
+}
@@ -0,0 +1,89 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/gorouter/logger"
+	"github.com/uber-go/zap"
+)
+
+// LogLevelPath shows and changes the level of the logs of the router.
+const LogLevelPath = "/log-level"
+
+// LogLevel is the level of the logs changed by the admin API.
+type LogLevel interface {
+	Level() zap.Level
+	Set(level zap.Level)
+}
+
+type logLevelHandler struct {
+	level  LogLevel
+	logger logger.Logger
+}
+
+type logLevelJSON struct {
+	Level string `json:"level"`
+}
+
+// NewLogLevelHandler returns the handler of LogLevelPath.
+func NewLogLevelHandler(level LogLevel, logger logger.Logger) http.Handler {
+	return &logLevelHandler{level: level, logger: logger}
+}
+
+func (h *logLevelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(logLevelJSON{Level: h.level.Level().String()})
+	case "PUT":
+		h.set(w, r)
+	default:
+		methodNotAllowed(w, "GET, PUT")
+	}
+}
+
+// set changes the level to the one named in the request body, either as is or
+// as the level of a JSON object.
+func (h *logLevelHandler) set(w http.ResponseWriter, r *http.Request) {
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(string(data))
+	if strings.HasPrefix(name, "{") {
+		var body logLevelJSON
+		if err := json.Unmarshal(data, &body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		name = body.Level
+	}
+
+	level, ok := parseLogLevel(name)
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown log level %q, allowed levels are %s", name, logger.Levels), http.StatusBadRequest)
+		return
+	}
+	previous := h.level.Level()
+	// the change is logged at the more verbose of the levels
+	if level < previous {
+		h.level.Set(level)
+	}
+	h.logger.Info("log-level-changed", zap.String("from", previous.String()), zap.String("to", level.String()))
+	h.level.Set(level)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func parseLogLevel(name string) (zap.Level, bool) {
+	for _, level := range logger.Levels {
+		if level.String() == name {
+			return level, true
+		}
+	}
+	return 0, false
+}
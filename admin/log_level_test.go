@@ -0,0 +1,76 @@
+package admin_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"code.cloudfoundry.org/gorouter/admin"
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/test_util"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/uber-go/zap"
+)
+
+var _ = Describe("LogLevel", func() {
+	var (
+		level   *logger.Level
+		handler http.Handler
+	)
+
+	BeforeEach(func() {
+		level = logger.NewLevel(zap.InfoLevel)
+		handler = admin.NewLogLevelHandler(level, test_util.NewTestZapLogger("test"))
+	})
+
+	serve := func(method, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, admin.LogLevelPath, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	Describe("GET /log-level", func() {
+		It("shows the level", func() {
+			res := serve("GET", "")
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(res.Header().Get("Content-Type")).To(Equal("application/json"))
+			Expect(res.Body.String()).To(MatchJSON(`{"level": "info"}`))
+		})
+	})
+
+	Describe("PUT /log-level", func() {
+		It("changes the level to the one in the body", func() {
+			res := serve("PUT", "debug\n")
+			Expect(res.Code).To(Equal(http.StatusNoContent))
+			Expect(level.Level()).To(Equal(zap.DebugLevel))
+		})
+
+		It("changes the level to the one in a JSON body", func() {
+			res := serve("PUT", `{"level": "error"}`)
+			Expect(res.Code).To(Equal(http.StatusNoContent))
+			Expect(level.Level()).To(Equal(zap.ErrorLevel))
+		})
+
+		It("keeps the level when the level is not allowed", func() {
+			res := serve("PUT", "fatal")
+			Expect(res.Code).To(Equal(http.StatusBadRequest))
+			Expect(res.Body.String()).To(ContainSubstring("[debug info error]"))
+			Expect(level.Level()).To(Equal(zap.InfoLevel))
+		})
+
+		It("keeps the level when the JSON body is not valid", func() {
+			res := serve("PUT", `{"level":`)
+			Expect(res.Code).To(Equal(http.StatusBadRequest))
+			Expect(level.Level()).To(Equal(zap.InfoLevel))
+		})
+	})
+
+	It("does not allow other methods", func() {
+		res := serve("POST", "debug")
+		Expect(res.Code).To(Equal(http.StatusMethodNotAllowed))
+		Expect(res.Header().Get("Allow")).To(Equal("GET, PUT"))
+	})
+})
@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"github.com/uber-go/zap"
+)
+
+// RewriteRulesPath lists and replaces the rules rewriting and redirecting
+// requests.
+const RewriteRulesPath = "/v1/rewrite_rules"
+
+// RewriteRules are the rewrite and redirect rules managed by the admin API.
+type RewriteRules interface {
+	Configs() []config.RewriteRuleConfig
+	Set(configs []config.RewriteRuleConfig) error
+}
+
+type rewriteRulesHandler struct {
+	rules  RewriteRules
+	logger logger.Logger
+}
+
+// NewRewriteRulesHandler returns the handler of RewriteRulesPath.
+func NewRewriteRulesHandler(rules RewriteRules, logger logger.Logger) http.Handler {
+	return &rewriteRulesHandler{rules: rules, logger: logger}
+}
+
+func (h *rewriteRulesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h.rules.Configs())
+	case "PUT":
+		h.set(w, r)
+	default:
+		methodNotAllowed(w, "GET, PUT")
+	}
+}
+
+// set replaces the rules with the rules in the request body.
+func (h *rewriteRulesHandler) set(w http.ResponseWriter, r *http.Request) {
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	configs := []config.RewriteRuleConfig{}
+	if err := json.Unmarshal(data, &configs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.rules.Set(configs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.logger.Info("rewrite-rules-set", zap.Int("rules", len(configs)))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,87 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"code.cloudfoundry.org/gorouter/admin"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/handlers"
+	"code.cloudfoundry.org/gorouter/test_util"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RewriteRules", func() {
+	var (
+		rules   *handlers.RewriteRules
+		handler http.Handler
+	)
+
+	BeforeEach(func() {
+		var err error
+		rules, err = handlers.NewRewriteRules([]config.RewriteRuleConfig{
+			{Match: "^example.com(/.*)$", Redirect: "https://www.example.com$1"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		handler = admin.NewRewriteRulesHandler(rules, test_util.NewTestZapLogger("test"))
+	})
+
+	serve := func(method, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, admin.RewriteRulesPath, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	Describe("GET /v1/rewrite_rules", func() {
+		It("lists the rules", func() {
+			res := serve("GET", "")
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(res.Header().Get("Content-Type")).To(Equal("application/json"))
+
+			var configs []config.RewriteRuleConfig
+			Expect(json.Unmarshal(res.Body.Bytes(), &configs)).To(Succeed())
+			Expect(configs).To(Equal([]config.RewriteRuleConfig{
+				{Match: "^example.com(/.*)$", Redirect: "https://www.example.com$1"},
+			}))
+		})
+	})
+
+	Describe("PUT /v1/rewrite_rules", func() {
+		It("replaces the rules", func() {
+			res := serve("PUT", `[{"match": "^old.example.com/(.*)$", "rewrite": "new.example.com/$1"}]`)
+			Expect(res.Code).To(Equal(http.StatusNoContent))
+			Expect(rules.Configs()).To(Equal([]config.RewriteRuleConfig{
+				{Match: "^old.example.com/(.*)$", Rewrite: "new.example.com/$1"},
+			}))
+		})
+
+		It("removes the rules when given none", func() {
+			res := serve("PUT", `[]`)
+			Expect(res.Code).To(Equal(http.StatusNoContent))
+			Expect(rules.Configs()).To(BeEmpty())
+		})
+
+		It("keeps the rules when a rule is not valid", func() {
+			res := serve("PUT", `[{"match": "(", "rewrite": "new.example.com/"}]`)
+			Expect(res.Code).To(Equal(http.StatusBadRequest))
+			Expect(rules.Configs()).To(HaveLen(1))
+		})
+
+		It("keeps the rules when the body is not JSON", func() {
+			res := serve("PUT", `rules`)
+			Expect(res.Code).To(Equal(http.StatusBadRequest))
+			Expect(rules.Configs()).To(HaveLen(1))
+		})
+	})
+
+	It("does not allow other methods", func() {
+		res := serve("DELETE", "")
+		Expect(res.Code).To(Equal(http.StatusMethodNotAllowed))
+		Expect(res.Header().Get("Allow")).To(Equal("GET, PUT"))
+	})
+})
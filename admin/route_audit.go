@@ -0,0 +1,86 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/registry"
+	"code.cloudfoundry.org/gorouter/route"
+)
+
+// RouteAuditPath lists the last endpoints added to and removed from the
+// routing table.
+const RouteAuditPath = "/v1/routes/audit"
+
+// RouteAudit is the record of the changes to the routing table queried by
+// the admin API.
+type RouteAudit interface {
+	AuditEvents() []registry.AuditEvent
+}
+
+type routeAuditHandler struct {
+	audit RouteAudit
+}
+
+// NewRouteAuditHandler returns the handler of RouteAuditPath.
+func NewRouteAuditHandler(audit RouteAudit) http.Handler {
+	return &routeAuditHandler{audit: audit}
+}
+
+// ServeHTTP responds with the events, newest first, of the route, endpoint
+// and source given by the query parameters of the same names, since the time
+// given by the since query parameter and up to the number given by limit.
+func (h *routeAuditHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		methodNotAllowed(w, "GET")
+		return
+	}
+
+	query := r.URL.Query()
+	var since time.Time
+	if s := query.Get("since"); s != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			http.Error(w, "since must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := -1
+	if l := query.Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 0 {
+			http.Error(w, "limit must be a non-negative number", http.StatusBadRequest)
+			return
+		}
+	}
+	var uri route.Uri
+	if u := query.Get("route"); u != "" {
+		uri = route.Uri(u).RouteKey()
+	}
+
+	events := h.audit.AuditEvents()
+	matched := []registry.AuditEvent{}
+	for i := len(events) - 1; i >= 0 && limit != len(matched); i-- {
+		e := events[i]
+		if e.Time.Before(since) {
+			break
+		}
+		if (uri == "" || e.Route == uri) &&
+			matches(query.Get("endpoint"), e.Endpoint) &&
+			matches(query.Get("source"), e.Source) {
+			matched = append(matched, e)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(matched)
+}
+
+// matches reports whether the value is the one queried, if any.
+func matches(queried, value string) bool {
+	return queried == "" || queried == value
+}
@@ -0,0 +1,94 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/admin"
+	"code.cloudfoundry.org/gorouter/registry"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type routeAudit []registry.AuditEvent
+
+func (a routeAudit) AuditEvents() []registry.AuditEvent {
+	return a
+}
+
+var _ = Describe("RouteAudit", func() {
+	var (
+		handler http.Handler
+		now     time.Time
+	)
+
+	BeforeEach(func() {
+		now = time.Now()
+		handler = admin.NewRouteAuditHandler(routeAudit{
+			{Time: now.Add(-time.Hour), Action: registry.AuditRegister, Route: "foo.example.com", Endpoint: "10.0.0.1:8080", Source: "nats"},
+			{Time: now.Add(-time.Minute), Action: registry.AuditRegister, Route: "bar.example.com", Endpoint: "10.0.0.2:8080", Source: "routing-api"},
+			{Time: now, Action: registry.AuditUnregister, Route: "foo.example.com", Endpoint: "10.0.0.1:8080", Source: "admin"},
+		})
+	})
+
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, target, nil)
+		Expect(err).NotTo(HaveOccurred())
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	events := func(target string) []registry.AuditEvent {
+		res := serve("GET", target)
+		Expect(res.Code).To(Equal(http.StatusOK))
+		var events []registry.AuditEvent
+		Expect(json.Unmarshal(res.Body.Bytes(), &events)).To(Succeed())
+		return events
+	}
+
+	sources := func(events []registry.AuditEvent) []string {
+		var sources []string
+		for _, e := range events {
+			sources = append(sources, e.Source)
+		}
+		return sources
+	}
+
+	It("lists the events, newest first", func() {
+		Expect(sources(events(admin.RouteAuditPath))).To(Equal([]string{"admin", "routing-api", "nats"}))
+	})
+
+	It("filters the events by route, endpoint and source", func() {
+		Expect(sources(events(admin.RouteAuditPath + "?route=FOO.example.com"))).To(Equal([]string{"admin", "nats"}))
+		Expect(sources(events(admin.RouteAuditPath + "?endpoint=10.0.0.2:8080"))).To(Equal([]string{"routing-api"}))
+		Expect(sources(events(admin.RouteAuditPath + "?route=foo.example.com&source=nats"))).To(Equal([]string{"nats"}))
+	})
+
+	It("lists the events since a time", func() {
+		since := now.Add(-10 * time.Minute).UTC().Format(time.RFC3339)
+		Expect(sources(events(admin.RouteAuditPath + "?since=" + since))).To(Equal([]string{"admin", "routing-api"}))
+	})
+
+	It("limits the number of events", func() {
+		Expect(sources(events(admin.RouteAuditPath + "?limit=1"))).To(Equal([]string{"admin"}))
+	})
+
+	It("responds with an empty list when there are no events", func() {
+		Expect(events(admin.RouteAuditPath + "?route=baz.example.com")).To(BeEmpty())
+		Expect(serve("GET", admin.RouteAuditPath+"?route=baz.example.com").Body.String()).To(Equal("[]\n"))
+	})
+
+	It("rejects invalid queries", func() {
+		Expect(serve("GET", admin.RouteAuditPath+"?since=yesterday").Code).To(Equal(http.StatusBadRequest))
+		Expect(serve("GET", admin.RouteAuditPath+"?limit=-1").Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("only allows GET", func() {
+		res := serve("POST", admin.RouteAuditPath)
+		Expect(res.Code).To(Equal(http.StatusMethodNotAllowed))
+		Expect(res.Header().Get("Allow")).To(Equal("GET"))
+	})
+})
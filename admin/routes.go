@@ -0,0 +1,337 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/mbus"
+	"code.cloudfoundry.org/gorouter/route"
+	"github.com/uber-go/zap"
+)
+
+const (
+	// RoutesPath lists, registers and removes routes.
+	RoutesPath = "/v1/routes"
+	// FrozenRoutesPath freezes and unfreezes routes.
+	FrozenRoutesPath = "/v1/routes/frozen"
+	// MaintenanceRoutesPath puts routes in maintenance and takes them out of
+	// maintenance.
+	MaintenanceRoutesPath = "/v1/routes/maintenance"
+	// DrainingEndpointsPath lists, drains and re-enables endpoints.
+	DrainingEndpointsPath = "/v1/endpoints/draining"
+
+	maxBodySize = 1024 * 1024
+)
+
+// RouteTable is the routing table managed by the admin API.
+type RouteTable interface {
+	EachRoute(f func(uri route.Uri, pool *route.Pool))
+	FrozenRoutes() []route.Uri
+	ForceRegister(uri route.Uri, endpoint *route.Endpoint)
+	ForceUnregister(uri route.Uri, endpoint *route.Endpoint)
+	RemoveRoute(uri route.Uri) bool
+	Freeze(uri route.Uri, frozen bool)
+	SetMaintenance(uri route.Uri, m *route.Maintenance) bool
+	SetEndpointDraining(address string, draining bool) bool
+	DrainingEndpoints() []string
+}
+
+type routeInfo struct {
+	Route       route.Uri                `json:"route"`
+	Frozen      bool                     `json:"frozen"`
+	Maintenance *route.Maintenance       `json:"maintenance,omitempty"`
+	Endpoints   []map[string]interface{} `json:"endpoints"`
+}
+
+type routesHandler struct {
+	table  RouteTable
+	logger logger.Logger
+}
+
+// NewRoutesHandler returns the handler of RoutesPath, FrozenRoutesPath,
+// MaintenanceRoutesPath and DrainingEndpointsPath.
+func NewRoutesHandler(table RouteTable, logger logger.Logger) http.Handler {
+	return &routesHandler{table: table, logger: logger}
+}
+
+func (h *routesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case RoutesPath:
+		switch r.Method {
+		case "GET":
+			h.list(w, r)
+		case "POST":
+			h.register(w, r)
+		case "DELETE":
+			if r.URL.Query().Get("route") != "" {
+				h.remove(w, r)
+			} else {
+				h.unregister(w, r)
+			}
+		default:
+			methodNotAllowed(w, "GET, POST, DELETE")
+		}
+	case FrozenRoutesPath:
+		switch r.Method {
+		case "PUT":
+			h.freeze(w, r, true)
+		case "DELETE":
+			h.freeze(w, r, false)
+		default:
+			methodNotAllowed(w, "PUT, DELETE")
+		}
+	case MaintenanceRoutesPath:
+		switch r.Method {
+		case "PUT":
+			h.setMaintenance(w, r, true)
+		case "DELETE":
+			h.setMaintenance(w, r, false)
+		default:
+			methodNotAllowed(w, "PUT, DELETE")
+		}
+	case DrainingEndpointsPath:
+		switch r.Method {
+		case "GET":
+			h.listDraining(w)
+		case "PUT":
+			h.drain(w, r, true)
+		case "DELETE":
+			h.drain(w, r, false)
+		default:
+			methodNotAllowed(w, "GET, PUT, DELETE")
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// list responds with the routes, or with the route given by the route query
+// parameter, and the time each endpoint was last registered.
+func (h *routesHandler) list(w http.ResponseWriter, r *http.Request) {
+	routes, err := h.routes()
+	if err != nil {
+		h.logger.Error("list-routes-failed", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var body interface{} = routes
+	if uri := r.URL.Query().Get("route"); uri != "" {
+		key := route.Uri(uri).RouteKey()
+		body = nil
+		for _, info := range routes {
+			if info.Route == key {
+				body = info
+			}
+		}
+		if body == nil {
+			http.Error(w, fmt.Sprintf("route %s not found", key), http.StatusNotFound)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+func (h *routesHandler) routes() ([]*routeInfo, error) {
+	now := time.Now()
+	draining := map[string]bool{}
+	for _, address := range h.table.DrainingEndpoints() {
+		draining[address] = true
+	}
+
+	byURI := map[route.Uri]*routeInfo{}
+	var err error
+	h.table.EachRoute(func(uri route.Uri, pool *route.Pool) {
+		info := &routeInfo{Route: uri, Maintenance: pool.Maintenance(), Endpoints: []map[string]interface{}{}}
+		pool.EachWithUpdateTime(func(e *route.Endpoint, updated time.Time) {
+			endpoint, marshalErr := endpointDetails(e)
+			if marshalErr != nil {
+				err = marshalErr
+				return
+			}
+			endpoint["updated_at"] = updated.UTC().Format(time.RFC3339)
+			endpoint["seconds_since_update"] = int(now.Sub(updated).Seconds())
+			endpoint["draining"] = draining[e.CanonicalAddr()]
+			info.Endpoints = append(info.Endpoints, endpoint)
+		})
+		byURI[uri] = info
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, uri := range h.table.FrozenRoutes() {
+		info, ok := byURI[uri]
+		if !ok {
+			info = &routeInfo{Route: uri, Endpoints: []map[string]interface{}{}}
+			byURI[uri] = info
+		}
+		info.Frozen = true
+	}
+
+	uris := make([]string, 0, len(byURI))
+	for uri := range byURI {
+		uris = append(uris, string(uri))
+	}
+	sort.Strings(uris)
+
+	routes := make([]*routeInfo, 0, len(uris))
+	for _, uri := range uris {
+		routes = append(routes, byURI[route.Uri(uri)])
+	}
+	return routes, nil
+}
+
+// endpointDetails returns the fields of the endpoint as in the routes
+// endpoint of the status listener.
+func endpointDetails(e *route.Endpoint) (map[string]interface{}, error) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	var details map[string]interface{}
+	err = json.Unmarshal(b, &details)
+	return details, err
+}
+
+func (h *routesHandler) register(w http.ResponseWriter, r *http.Request) {
+	msg, ok := h.readMessage(w, r)
+	if !ok {
+		return
+	}
+	for _, rt := range msg.Routes() {
+		rt.Endpoint.Source = "admin"
+		h.table.ForceRegister(rt.Uri, rt.Endpoint)
+		h.logger.Info("endpoint-registered", zap.Stringer("uri", rt.Uri), zap.String("backend", rt.Endpoint.CanonicalAddr()))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *routesHandler) unregister(w http.ResponseWriter, r *http.Request) {
+	msg, ok := h.readMessage(w, r)
+	if !ok {
+		return
+	}
+	for _, rt := range msg.Routes() {
+		rt.Endpoint.Source = "admin"
+		h.table.ForceUnregister(rt.Uri, rt.Endpoint)
+		h.logger.Info("endpoint-unregistered", zap.Stringer("uri", rt.Uri), zap.String("backend", rt.Endpoint.CanonicalAddr()))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readMessage reads a registration message of HTTP routes from the request
+// body, and responds with an error if the message is not valid.
+func (h *routesHandler) readMessage(w http.ResponseWriter, r *http.Request) (*mbus.RegistryMessage, bool) {
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	msg, err := mbus.ParseRegistryMessage(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if msg.TCPRoute {
+		http.Error(w, "tcp routes are not supported", http.StatusBadRequest)
+		return nil, false
+	}
+	if len(msg.Uris) == 0 {
+		http.Error(w, "uris must not be empty", http.StatusBadRequest)
+		return nil, false
+	}
+	return msg, true
+}
+
+func (h *routesHandler) remove(w http.ResponseWriter, r *http.Request) {
+	uri := route.Uri(r.URL.Query().Get("route"))
+	if !h.table.RemoveRoute(uri) {
+		http.Error(w, fmt.Sprintf("route %s not found", uri.RouteKey()), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *routesHandler) freeze(w http.ResponseWriter, r *http.Request, frozen bool) {
+	uri := r.URL.Query().Get("route")
+	if uri == "" {
+		http.Error(w, "route must be given", http.StatusBadRequest)
+		return
+	}
+	h.table.Freeze(route.Uri(uri), frozen)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setMaintenance puts the route given by the route query parameter in
+// maintenance with the response in the request body, if any, or takes it out
+// of maintenance.
+func (h *routesHandler) setMaintenance(w http.ResponseWriter, r *http.Request, inMaintenance bool) {
+	uri := r.URL.Query().Get("route")
+	if uri == "" {
+		http.Error(w, "route must be given", http.StatusBadRequest)
+		return
+	}
+
+	var m *route.Maintenance
+	if inMaintenance {
+		m = &route.Maintenance{}
+		data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, m); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if !m.Valid() {
+			http.Error(w, "status must be a valid status code and retry_after_seconds must not be negative", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !h.table.SetMaintenance(route.Uri(uri), m) {
+		http.Error(w, fmt.Sprintf("route %s not found", route.Uri(uri).RouteKey()), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *routesHandler) listDraining(w http.ResponseWriter) {
+	addresses := h.table.DrainingEndpoints()
+	sort.Strings(addresses)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(addresses)
+}
+
+// drain sets whether the endpoint given by the address query parameter is
+// draining.
+func (h *routesHandler) drain(w http.ResponseWriter, r *http.Request, draining bool) {
+	address := r.URL.Query().Get("address")
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		http.Error(w, "address must be given as host:port", http.StatusBadRequest)
+		return
+	}
+	if !h.table.SetEndpointDraining(address, draining) {
+		http.Error(w, fmt.Sprintf("endpoint %s not found", address), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,254 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"code.cloudfoundry.org/gorouter/admin"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/metrics/fakes"
+	"code.cloudfoundry.org/gorouter/registry"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/routing-api/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Routes", func() {
+	var (
+		r       *registry.RouteRegistry
+		handler http.Handler
+	)
+
+	BeforeEach(func() {
+		logger := test_util.NewTestZapLogger("test")
+		r = registry.NewRouteRegistry(logger, config.DefaultConfig(), new(fakes.FakeRouteRegistryReporter))
+		handler = admin.NewRoutesHandler(r, logger)
+	})
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, target, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	endpoint := func(host string, port uint16) *route.Endpoint {
+		return route.NewEndpoint("app", host, port, "", "", nil, -1, "", models.ModificationTag{}, "")
+	}
+
+	addresses := func(uri route.Uri) []string {
+		pool := r.Lookup(uri)
+		if pool == nil {
+			return nil
+		}
+		var addrs []string
+		pool.Each(func(e *route.Endpoint) {
+			addrs = append(addrs, e.CanonicalAddr())
+		})
+		return addrs
+	}
+
+	Describe("GET /v1/routes", func() {
+		BeforeEach(func() {
+			r.Register("foo.com", endpoint("10.0.0.1", 8080))
+			r.Register("bar.com/path", endpoint("10.0.0.2", 8080))
+			r.Freeze("baz.com", true)
+		})
+
+		It("lists the routes with their endpoints and whether they are frozen", func() {
+			res := serve("GET", "/v1/routes", "")
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(res.Header().Get("Content-Type")).To(Equal("application/json"))
+
+			var routes []map[string]interface{}
+			Expect(json.Unmarshal(res.Body.Bytes(), &routes)).To(Succeed())
+			Expect(routes).To(HaveLen(3))
+			Expect(routes[0]["route"]).To(Equal("bar.com/path"))
+			Expect(routes[1]["route"]).To(Equal("baz.com"))
+			Expect(routes[1]["frozen"]).To(BeTrue())
+			Expect(routes[1]["endpoints"]).To(BeEmpty())
+			Expect(routes[2]["route"]).To(Equal("foo.com"))
+			Expect(routes[2]["frozen"]).To(BeFalse())
+
+			endpoints := routes[2]["endpoints"].([]interface{})
+			Expect(endpoints).To(HaveLen(1))
+			e := endpoints[0].(map[string]interface{})
+			Expect(e["address"]).To(Equal("10.0.0.1:8080"))
+			Expect(e).To(HaveKey("updated_at"))
+			Expect(e["seconds_since_update"]).To(BeNumerically("==", 0))
+			Expect(e["draining"]).To(BeFalse())
+		})
+
+		It("shows a single route", func() {
+			res := serve("GET", "/v1/routes?route=FOO.com", "")
+			Expect(res.Code).To(Equal(http.StatusOK))
+
+			var route map[string]interface{}
+			Expect(json.Unmarshal(res.Body.Bytes(), &route)).To(Succeed())
+			Expect(route["route"]).To(Equal("foo.com"))
+		})
+
+		It("responds with not found for unknown routes", func() {
+			res := serve("GET", "/v1/routes?route=unknown.com", "")
+			Expect(res.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("POST /v1/routes", func() {
+		It("registers the endpoint for each uri", func() {
+			res := serve("POST", "/v1/routes", `{"host":"10.0.0.1","port":8080,"uris":["foo.com","bar.com"]}`)
+			Expect(res.Code).To(Equal(http.StatusNoContent))
+
+			Expect(addresses("foo.com")).To(ConsistOf("10.0.0.1:8080"))
+			Expect(addresses("bar.com")).To(ConsistOf("10.0.0.1:8080"))
+		})
+
+		It("registers endpoints of frozen routes", func() {
+			r.Freeze("foo.com", true)
+
+			res := serve("POST", "/v1/routes", `{"host":"10.0.0.1","port":8080,"uris":["foo.com"]}`)
+			Expect(res.Code).To(Equal(http.StatusNoContent))
+			Expect(addresses("foo.com")).To(ConsistOf("10.0.0.1:8080"))
+		})
+
+		It("rejects invalid messages", func() {
+			Expect(serve("POST", "/v1/routes", `{"host":`).Code).To(Equal(http.StatusBadRequest))
+			Expect(serve("POST", "/v1/routes", `{"host":"10.0.0.1","port":8080,"uris":["foo.com"],"weight":-1}`).Code).To(Equal(http.StatusBadRequest))
+			Expect(serve("POST", "/v1/routes", `{"host":"10.0.0.1","port":8080}`).Code).To(Equal(http.StatusBadRequest))
+			Expect(serve("POST", "/v1/routes", `{"host":"10.0.0.1","port":8080,"tcp_route":true,"external_port":61000}`).Code).To(Equal(http.StatusBadRequest))
+			Expect(r.NumUris()).To(Equal(0))
+		})
+	})
+
+	Describe("DELETE /v1/routes", func() {
+		BeforeEach(func() {
+			r.Register("foo.com", endpoint("10.0.0.1", 8080))
+			r.Register("foo.com", endpoint("10.0.0.2", 8080))
+		})
+
+		It("unregisters the endpoint", func() {
+			res := serve("DELETE", "/v1/routes", `{"host":"10.0.0.1","port":8080,"uris":["foo.com"]}`)
+			Expect(res.Code).To(Equal(http.StatusNoContent))
+
+			Expect(addresses("foo.com")).To(ConsistOf("10.0.0.2:8080"))
+		})
+
+		It("removes the route", func() {
+			res := serve("DELETE", "/v1/routes?route=foo.com", "")
+			Expect(res.Code).To(Equal(http.StatusNoContent))
+
+			Expect(r.Lookup("foo.com")).To(BeNil())
+		})
+
+		It("responds with not found when removing unknown routes", func() {
+			res := serve("DELETE", "/v1/routes?route=unknown.com", "")
+			Expect(res.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("/v1/routes/frozen", func() {
+		It("freezes and unfreezes the route", func() {
+			res := serve("PUT", "/v1/routes/frozen?route=foo.com", "")
+			Expect(res.Code).To(Equal(http.StatusNoContent))
+			Expect(r.FrozenRoutes()).To(ConsistOf(route.Uri("foo.com")))
+
+			r.Register("foo.com", endpoint("10.0.0.1", 8080))
+			Expect(r.Lookup("foo.com")).To(BeNil())
+
+			res = serve("DELETE", "/v1/routes/frozen?route=foo.com", "")
+			Expect(res.Code).To(Equal(http.StatusNoContent))
+			Expect(r.FrozenRoutes()).To(BeEmpty())
+		})
+
+		It("requires a route", func() {
+			res := serve("PUT", "/v1/routes/frozen", "")
+			Expect(res.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Describe("/v1/routes/maintenance", func() {
+		BeforeEach(func() {
+			r.Register("foo.com", endpoint("10.0.0.1", 8080))
+		})
+
+		It("puts the route in maintenance and takes it out of maintenance", func() {
+			res := serve("PUT", "/v1/routes/maintenance?route=foo.com", `{"status":503,"content_type":"text/html","body":"<h1>Back soon</h1>"}`)
+			Expect(res.Code).To(Equal(http.StatusNoContent))
+			Expect(r.Lookup("foo.com").Maintenance()).To(Equal(&route.Maintenance{
+				Status:      503,
+				ContentType: "text/html",
+				Body:        "<h1>Back soon</h1>",
+			}))
+
+			res = serve("GET", "/v1/routes?route=foo.com", "")
+			Expect(res.Body.String()).To(ContainSubstring(`"maintenance":{"status":503`))
+
+			res = serve("DELETE", "/v1/routes/maintenance?route=foo.com", "")
+			Expect(res.Code).To(Equal(http.StatusNoContent))
+			Expect(r.Lookup("foo.com").Maintenance()).To(BeNil())
+		})
+
+		It("uses the default response without a body", func() {
+			res := serve("PUT", "/v1/routes/maintenance?route=foo.com", "")
+			Expect(res.Code).To(Equal(http.StatusNoContent))
+			Expect(r.Lookup("foo.com").Maintenance()).To(Equal(&route.Maintenance{}))
+		})
+
+		It("rejects invalid responses", func() {
+			res := serve("PUT", "/v1/routes/maintenance?route=foo.com", `{"status":42}`)
+			Expect(res.Code).To(Equal(http.StatusBadRequest))
+			Expect(r.Lookup("foo.com").Maintenance()).To(BeNil())
+		})
+
+		It("responds with not found for unknown routes", func() {
+			res := serve("PUT", "/v1/routes/maintenance?route=unknown.com", "")
+			Expect(res.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("/v1/endpoints/draining", func() {
+		BeforeEach(func() {
+			r.Register("foo.com", endpoint("10.0.0.1", 8080))
+			r.Register("foo.com", endpoint("10.0.0.2", 8080))
+		})
+
+		It("drains and re-enables the endpoint", func() {
+			res := serve("PUT", "/v1/endpoints/draining?address=10.0.0.1:8080", "")
+			Expect(res.Code).To(Equal(http.StatusNoContent))
+			Expect(r.DrainingEndpoints()).To(ConsistOf("10.0.0.1:8080"))
+			Expect(addresses("foo.com")).To(ConsistOf("10.0.0.1:8080", "10.0.0.2:8080"))
+
+			res = serve("GET", "/v1/endpoints/draining", "")
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(res.Body.String()).To(MatchJSON(`["10.0.0.1:8080"]`))
+
+			res = serve("GET", "/v1/routes?route=foo.com", "")
+			Expect(res.Body.String()).To(ContainSubstring(`"draining":true`))
+
+			res = serve("DELETE", "/v1/endpoints/draining?address=10.0.0.1:8080", "")
+			Expect(res.Code).To(Equal(http.StatusNoContent))
+			Expect(r.DrainingEndpoints()).To(BeEmpty())
+		})
+
+		It("requires an address", func() {
+			res := serve("PUT", "/v1/endpoints/draining?address=10.0.0.1", "")
+			Expect(res.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("responds with not found for unknown endpoints", func() {
+			res := serve("PUT", "/v1/endpoints/draining?address=10.0.0.3:8080", "")
+			Expect(res.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	It("rejects other methods", func() {
+		res := serve("PATCH", "/v1/routes", "")
+		Expect(res.Code).To(Equal(http.StatusMethodNotAllowed))
+		Expect(res.Header().Get("Allow")).To(Equal("GET, POST, DELETE"))
+	})
+})
@@ -7,6 +7,7 @@ import (
 	"net"
 	"net/http"
 	"runtime"
+	"strconv"
 	"sync"
 	"syscall"
 	"time"
@@ -15,6 +16,7 @@ import (
 	. "code.cloudfoundry.org/gorouter/common/http"
 	"code.cloudfoundry.org/gorouter/common/schema"
 	"code.cloudfoundry.org/gorouter/common/uuid"
+	"code.cloudfoundry.org/gorouter/handoff"
 	"code.cloudfoundry.org/gorouter/logger"
 	"code.cloudfoundry.org/localip"
 	"github.com/nats-io/nats"
@@ -88,6 +90,7 @@ type VcapComponent struct {
 	Healthz    *health.Healthz `json:"-"`
 	Health     http.Handler
 	InfoRoutes map[string]json.Marshaler `json:"-"`
+	Handlers   map[string]http.Handler   `json:"-"`
 	Logger     logger.Logger             `json:"-"`
 
 	listener net.Listener
@@ -141,7 +144,7 @@ func (c *VcapComponent) Start() error {
 			return err
 		}
 
-		c.Varz.Host = fmt.Sprintf("%s:%d", host, port)
+		c.Varz.Host = net.JoinHostPort(host, strconv.Itoa(int(port)))
 	}
 
 	if c.Varz.Credentials == nil || len(c.Varz.Credentials) != 2 {
@@ -243,6 +246,10 @@ func (c *VcapComponent) ListenAndServe() {
 		})
 	}
 
+	for path, handler := range c.Handlers {
+		hs.Handle(path, handler)
+	}
+
 	f := func(user, password string) bool {
 		return user == c.Varz.Credentials[0] && password == c.Varz.Credentials[1]
 	}
@@ -255,7 +262,7 @@ func (c *VcapComponent) ListenAndServe() {
 	}
 
 	c.statusCh = make(chan error, 1)
-	l, err := net.Listen("tcp", c.Varz.Host)
+	l, err := handoff.Listen("status", c.Varz.Host, net.Listen)
 	if err != nil {
 		c.statusCh <- err
 		return
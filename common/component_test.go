@@ -139,6 +139,26 @@ var _ = Describe("Component", func() {
 		Expect(duration).NotTo(Equal(`"uptime":"0d:0h:0m:0s"`))
 	})
 
+	It("serves handlers behind basic auth", func() {
+		path := "/handler"
+
+		component.Handlers = map[string]http.Handler{
+			path: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+			}),
+		}
+		serveComponent(component)
+
+		req := buildGetRequest(component, path)
+		code, _, _ := doGetRequest(req)
+		Expect(code).To(Equal(401))
+
+		req = buildGetRequest(component, path)
+		req.SetBasicAuth("username", "password")
+		code, _, _ = doGetRequest(req)
+		Expect(code).To(Equal(http.StatusAccepted))
+	})
+
 	It("returns 404 for non existent paths", func() {
 		serveComponent(component)
 
@@ -0,0 +1,144 @@
+// Package connlimit limits the connections that each client IP may have open
+// with a listener at the same time.
+package connlimit
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrTooManyConnections is returned by reads from connections of clients
+// that have the maximum number of connections open already.
+var ErrTooManyConnections = errors.New("too many connections from the client IP")
+
+// Listener limits the connections open at the same time from each client IP
+// to MaxPerIP. Connections beyond the limit are closed on their first read,
+// rather than when they are accepted, so that the client IP can be read from
+// a PROXY protocol header of the wrapped listener without blocking Accept.
+type Listener struct {
+	net.Listener
+	MaxPerIP int
+
+	*limits
+}
+
+// limits are the connections open from each client IP, which listeners
+// sharing a port count together.
+type limits struct {
+	lock     sync.Mutex
+	conns    map[string]int
+	rejected uint64
+}
+
+// NewListener creates a Listener that limits the connections of each client
+// IP of l to maxPerIP.
+func NewListener(l net.Listener, maxPerIP int) *Listener {
+	return &Listener{
+		Listener: l,
+		MaxPerIP: maxPerIP,
+		limits:   &limits{conns: map[string]int{}},
+	}
+}
+
+// Share creates a Listener that limits the connections of each client IP of
+// other together with those of l, for listeners sharing a port. Its rejected
+// connections are counted by both.
+func (l *Listener) Share(other net.Listener) *Listener {
+	return &Listener{
+		Listener: other,
+		MaxPerIP: l.MaxPerIP,
+		limits:   l.limits,
+	}
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: c, listener: l}, nil
+}
+
+// Rejected returns the number of connections closed because their client IP
+// had the maximum number of connections open.
+func (l *Listener) Rejected() uint64 {
+	return atomic.LoadUint64(&l.rejected)
+}
+
+func (l *Listener) acquire(ip string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.conns[ip] >= l.MaxPerIP {
+		atomic.AddUint64(&l.rejected, 1)
+		return false
+	}
+	l.conns[ip]++
+	return true
+}
+
+func (l *Listener) release(ip string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.conns[ip]--
+	if l.conns[ip] <= 0 {
+		delete(l.conns, ip)
+	}
+}
+
+type conn struct {
+	net.Conn
+	listener *Listener
+
+	once      sync.Once
+	closeOnce sync.Once
+	lock      sync.Mutex
+	ip        string
+	acquired  bool
+	closed    bool
+	err       error
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	c.once.Do(c.acquire)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *conn) acquire() {
+	ip := c.Conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		c.err = errors.New("use of closed network connection")
+		return
+	}
+	if !c.listener.acquire(ip) {
+		c.err = ErrTooManyConnections
+		c.Conn.Close()
+		return
+	}
+	c.ip = ip
+	c.acquired = true
+}
+
+func (c *conn) Close() error {
+	c.closeOnce.Do(func() {
+		c.lock.Lock()
+		c.closed = true
+		if c.acquired {
+			c.listener.release(c.ip)
+		}
+		c.lock.Unlock()
+	})
+	return c.Conn.Close()
+}
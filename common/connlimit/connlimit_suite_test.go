@@ -0,0 +1,13 @@
+package connlimit_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestConnlimit(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Connlimit Suite")
+}
@@ -0,0 +1,108 @@
+package connlimit_test
+
+import (
+	"net"
+
+	"code.cloudfoundry.org/gorouter/common/connlimit"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Listener", func() {
+	var (
+		listener *connlimit.Listener
+		clients  []net.Conn
+	)
+
+	BeforeEach(func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		listener = connlimit.NewListener(l, 2)
+		clients = nil
+	})
+
+	AfterEach(func() {
+		for _, c := range clients {
+			c.Close()
+		}
+		listener.Close()
+	})
+
+	accept := func() net.Conn {
+		client, err := net.Dial("tcp", listener.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+		clients = append(clients, client)
+		_, err = client.Write([]byte("x"))
+		Expect(err).ToNot(HaveOccurred())
+
+		conn, err := listener.Accept()
+		Expect(err).ToNot(HaveOccurred())
+		return conn
+	}
+
+	read := func(conn net.Conn) error {
+		_, err := conn.Read(make([]byte, 1))
+		return err
+	}
+
+	It("accepts connections of a client up to the maximum", func() {
+		Expect(read(accept())).To(Succeed())
+		Expect(read(accept())).To(Succeed())
+		Expect(listener.Rejected()).To(BeZero())
+	})
+
+	It("closes connections of a client beyond the maximum", func() {
+		Expect(read(accept())).To(Succeed())
+		Expect(read(accept())).To(Succeed())
+
+		Expect(read(accept())).To(Equal(connlimit.ErrTooManyConnections))
+		Expect(listener.Rejected()).To(Equal(uint64(1)))
+	})
+
+	It("accepts connections again once others are closed", func() {
+		first := accept()
+		Expect(read(first)).To(Succeed())
+		Expect(read(accept())).To(Succeed())
+
+		Expect(first.Close()).To(Succeed())
+		Expect(read(accept())).To(Succeed())
+		Expect(listener.Rejected()).To(BeZero())
+	})
+
+	It("does not count connections that are closed before they are read", func() {
+		Expect(accept().Close()).To(Succeed())
+		Expect(read(accept())).To(Succeed())
+		Expect(read(accept())).To(Succeed())
+	})
+
+	Context("when the listener is shared", func() {
+		var shared *connlimit.Listener
+
+		BeforeEach(func() {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			shared = listener.Share(l)
+		})
+
+		AfterEach(func() {
+			shared.Close()
+		})
+
+		It("counts the connections of a client on both listeners", func() {
+			Expect(read(accept())).To(Succeed())
+
+			client, err := net.Dial("tcp", shared.Addr().String())
+			Expect(err).ToNot(HaveOccurred())
+			clients = append(clients, client)
+			conn, err := shared.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(read(accept())).To(Succeed())
+
+			_, err = client.Write([]byte("x"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(read(conn)).To(Equal(connlimit.ErrTooManyConnections))
+			Expect(listener.Rejected()).To(Equal(uint64(1)))
+			Expect(shared.Rejected()).To(Equal(uint64(1)))
+		})
+	})
+})
@@ -7,6 +7,7 @@ const (
 	CfRouteEndpointHeader = "X-Cf-RouteEndpoint"
 	VcapRouterHeader      = "X-Vcap-Router"
 	VcapTraceHeader       = "X-Vcap-Trace"
+	VcapTraceTimingHeader = "X-Vcap-Trace-Timing"
 	CfInstanceIdHeader    = "X-CF-InstanceID"
 	CfAppInstance         = "X-CF-APP-INSTANCE"
 	CfRouterError         = "X-Cf-RouterError"
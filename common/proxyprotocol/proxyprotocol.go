@@ -0,0 +1,306 @@
+// Package proxyprotocol reads and writes the headers of the HAProxy PROXY
+// protocol, versions 1 and 2, which carry the addresses of the original
+// connection of a client through TCP proxies.
+package proxyprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxV1HeaderSize is the size of the longest version 1 header, CRLF
+	// included.
+	maxV1HeaderSize = 107
+
+	v2CommandLocal = 0x0
+	v2CommandProxy = 0x1
+
+	v2FamilyTCP4 = 0x11
+	v2FamilyTCP6 = 0x21
+)
+
+var (
+	v1Signature = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	// ErrInvalidHeader is returned by reads of connections that start with
+	// a PROXY protocol signature but no valid header.
+	ErrInvalidHeader = errors.New("invalid PROXY protocol header")
+)
+
+// Listener accepts connections that may start with a PROXY protocol header,
+// of version 1 or 2. The remote and local addresses of the connections are
+// the ones in the header, if there is one.
+type Listener struct {
+	net.Listener
+	// HeaderTimeout limits the time waited for the first bytes of a
+	// connection to tell whether it starts with a header. Connections that
+	// send nothing in time are taken not to have a header.
+	HeaderTimeout time.Duration
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(conn, l.HeaderTimeout), nil
+}
+
+// Conn is a connection that may start with a PROXY protocol header. The
+// header is read on the first read or the first call for its addresses.
+type Conn struct {
+	net.Conn
+	reader        *bufio.Reader
+	headerTimeout time.Duration
+
+	once       sync.Once
+	remoteAddr net.Addr
+	localAddr  net.Addr
+	err        error
+}
+
+// NewConn returns a Conn reading the header from conn.
+func NewConn(conn net.Conn, headerTimeout time.Duration) *Conn {
+	return &Conn{
+		Conn:          conn,
+		reader:        bufio.NewReader(conn),
+		headerTimeout: headerTimeout,
+	}
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the source address of the header, or the remote address
+// of the connection when it has no header.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the destination address of the header, or the local
+// address of the connection when it has no header.
+func (c *Conn) LocalAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+func (c *Conn) readHeader() {
+	if c.headerTimeout > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.headerTimeout))
+	}
+	c.remoteAddr, c.localAddr, c.err = ReadHeader(c.reader)
+	if c.headerTimeout > 0 {
+		c.Conn.SetReadDeadline(time.Time{})
+	}
+	if c.err != nil {
+		c.Conn.Close()
+	}
+}
+
+// ReadHeader reads the PROXY protocol header at the start of the reader, if
+// there is one, and returns its source and destination addresses. The
+// addresses are nil when there is no header, or when the header does not
+// carry addresses.
+func ReadHeader(r *bufio.Reader) (src, dst net.Addr, err error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		// nothing was sent in time, so there is no header
+		return nil, nil, nil
+	}
+
+	switch b[0] {
+	case v1Signature[0]:
+		if b, _ := r.Peek(len(v1Signature)); bytes.Equal(b, v1Signature) {
+			return readV1Header(r)
+		}
+	case v2Signature[0]:
+		if b, _ := r.Peek(len(v2Signature)); bytes.Equal(b, v2Signature) {
+			return readV2Header(r)
+		}
+	}
+	return nil, nil, nil
+}
+
+func readV1Header(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	var line []byte
+	for len(line) < maxV1HeaderSize {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, ErrInvalidHeader
+		}
+		line = append(line, c)
+		if c == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, ErrInvalidHeader
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, ErrInvalidHeader
+	}
+
+	src, err := parseV1Addr(fields[2], fields[4], fields[1] == "TCP4")
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := parseV1Addr(fields[3], fields[5], fields[1] == "TCP4")
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+func parseV1Addr(host, port string, ipv4 bool) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil || (ipv4 && ip.To4() == nil) {
+		return nil, ErrInvalidHeader
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, ErrInvalidHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+func readV2Header(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	header := make([]byte, len(v2Signature)+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, ErrInvalidHeader
+	}
+	verCmd, family := header[12], header[13]
+	length := binary.BigEndian.Uint16(header[14:16])
+
+	if verCmd>>4 != 2 {
+		return nil, nil, ErrInvalidHeader
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, nil, ErrInvalidHeader
+	}
+
+	switch verCmd & 0xf {
+	case v2CommandLocal:
+		return nil, nil, nil
+	case v2CommandProxy:
+	default:
+		return nil, nil, ErrInvalidHeader
+	}
+
+	var ipLen int
+	switch family {
+	case v2FamilyTCP4:
+		ipLen = net.IPv4len
+	case v2FamilyTCP6:
+		ipLen = net.IPv6len
+	default:
+		// addresses of other families are not used
+		return nil, nil, nil
+	}
+	if len(body) < 2*ipLen+4 {
+		return nil, nil, ErrInvalidHeader
+	}
+
+	src := &net.TCPAddr{
+		IP:   net.IP(body[:ipLen]),
+		Port: int(binary.BigEndian.Uint16(body[2*ipLen:])),
+	}
+	dst := &net.TCPAddr{
+		IP:   net.IP(body[ipLen : 2*ipLen]),
+		Port: int(binary.BigEndian.Uint16(body[2*ipLen+2:])),
+	}
+	return src, dst, nil
+}
+
+// Header returns the PROXY protocol header of the version, 1 or 2, carrying
+// the source and destination addresses. The header carries no addresses
+// when either address is not a TCP address.
+func Header(version int, src, dst net.Addr) []byte {
+	srcAddr, srcOK := src.(*net.TCPAddr)
+	dstAddr, dstOK := dst.(*net.TCPAddr)
+	known := srcOK && dstOK
+	ipv4 := known && srcAddr.IP.To4() != nil && dstAddr.IP.To4() != nil
+
+	if version == 1 {
+		if !known {
+			return []byte("PROXY UNKNOWN\r\n")
+		}
+		proto, srcIP, dstIP := "TCP6", ipv6String(srcAddr.IP), ipv6String(dstAddr.IP)
+		if ipv4 {
+			proto, srcIP, dstIP = "TCP4", srcAddr.IP.To4().String(), dstAddr.IP.To4().String()
+		}
+		return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", proto, srcIP, dstIP, srcAddr.Port, dstAddr.Port))
+	}
+
+	header := append([]byte{}, v2Signature...)
+	if !known {
+		return append(header, 0x20|v2CommandLocal, 0, 0, 0)
+	}
+
+	family, srcIP, dstIP := byte(v2FamilyTCP6), srcAddr.IP.To16(), dstAddr.IP.To16()
+	if ipv4 {
+		family, srcIP, dstIP = v2FamilyTCP4, srcAddr.IP.To4(), dstAddr.IP.To4()
+	}
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(2*len(srcIP)+4))
+	ports := make([]byte, 4)
+	binary.BigEndian.PutUint16(ports, uint16(srcAddr.Port))
+	binary.BigEndian.PutUint16(ports[2:], uint16(dstAddr.Port))
+
+	header = append(header, 0x20|v2CommandProxy, family)
+	header = append(header, length...)
+	header = append(header, srcIP...)
+	header = append(header, dstIP...)
+	return append(header, ports...)
+}
+
+// ipv6String formats the IP as an IPv6 address, mapping IPv4 addresses.
+func ipv6String(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return "::ffff:" + ip4.String()
+	}
+	return ip.String()
+}
+
+type headerKey struct{}
+
+// WithHeader returns a context carrying the header to send on connections
+// dialed for requests with the context.
+func WithHeader(ctx context.Context, header []byte) context.Context {
+	return context.WithValue(ctx, headerKey{}, header)
+}
+
+// ContextHeader returns the header carried by the context, if any.
+func ContextHeader(ctx context.Context) ([]byte, bool) {
+	header, ok := ctx.Value(headerKey{}).([]byte)
+	return header, ok
+}
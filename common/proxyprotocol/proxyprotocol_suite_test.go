@@ -0,0 +1,13 @@
+package proxyprotocol_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestProxyprotocol(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Proxyprotocol Suite")
+}
@@ -0,0 +1,153 @@
+package proxyprotocol_test
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/common/proxyprotocol"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PROXY protocol", func() {
+	var (
+		src *net.TCPAddr
+		dst *net.TCPAddr
+	)
+
+	BeforeEach(func() {
+		src = &net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 12345}
+		dst = &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443}
+	})
+
+	read := func(data []byte) (net.Addr, net.Addr, string, error) {
+		r := bufio.NewReader(bytes.NewReader(data))
+		s, d, err := proxyprotocol.ReadHeader(r)
+		rest, _ := ioutil.ReadAll(r)
+		return s, d, string(rest), err
+	}
+
+	Describe("Header", func() {
+		It("writes version 1 headers", func() {
+			Expect(string(proxyprotocol.Header(1, src, dst))).To(Equal("PROXY TCP4 192.168.0.1 10.0.0.1 12345 443\r\n"))
+
+			src.IP = net.ParseIP("fd00::1")
+			Expect(string(proxyprotocol.Header(1, src, dst))).To(Equal("PROXY TCP6 fd00::1 ::ffff:10.0.0.1 12345 443\r\n"))
+
+			Expect(string(proxyprotocol.Header(1, nil, dst))).To(Equal("PROXY UNKNOWN\r\n"))
+		})
+
+		It("writes version 2 headers", func() {
+			header := proxyprotocol.Header(2, src, dst)
+			Expect(header).To(Equal(append([]byte("\r\n\r\n\x00\r\nQUIT\n\x21\x11\x00\x0c"),
+				192, 168, 0, 1, 10, 0, 0, 1, 0x30, 0x39, 0x01, 0xbb)))
+
+			Expect(proxyprotocol.Header(2, nil, dst)).To(Equal([]byte("\r\n\r\n\x00\r\nQUIT\n\x20\x00\x00\x00")))
+		})
+	})
+
+	Describe("ReadHeader", func() {
+		It("reads version 1 and 2 headers", func() {
+			for _, version := range []int{1, 2} {
+				s, d, rest, err := read(append(proxyprotocol.Header(version, src, dst), "GET / HTTP/1.1\r\n"...))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s.String()).To(Equal("192.168.0.1:12345"))
+				Expect(d.String()).To(Equal("10.0.0.1:443"))
+				Expect(rest).To(Equal("GET / HTTP/1.1\r\n"))
+
+				src.IP = net.ParseIP("fd00::1")
+				dst.IP = net.ParseIP("fd00::2")
+				s, d, _, err = read(proxyprotocol.Header(version, src, dst))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s.String()).To(Equal("[fd00::1]:12345"))
+				Expect(d.String()).To(Equal("[fd00::2]:443"))
+
+				src.IP = net.ParseIP("192.168.0.1")
+				dst.IP = net.ParseIP("10.0.0.1")
+			}
+		})
+
+		It("reads headers without addresses", func() {
+			for _, version := range []int{1, 2} {
+				s, d, rest, err := read(append(proxyprotocol.Header(version, nil, nil), "data"...))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s).To(BeNil())
+				Expect(d).To(BeNil())
+				Expect(rest).To(Equal("data"))
+			}
+		})
+
+		It("leaves data without a header", func() {
+			s, _, rest, err := read([]byte("POST / HTTP/1.1\r\n"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(BeNil())
+			Expect(rest).To(Equal("POST / HTTP/1.1\r\n"))
+		})
+
+		It("fails for invalid headers", func() {
+			_, _, _, err := read([]byte("PROXY TCP4 192.168.0.1\r\n"))
+			Expect(err).To(Equal(proxyprotocol.ErrInvalidHeader))
+
+			_, _, _, err = read([]byte("PROXY TCP4 fd00::1 10.0.0.1 1 2\r\n"))
+			Expect(err).To(Equal(proxyprotocol.ErrInvalidHeader))
+
+			_, _, _, err = read([]byte("\r\n\r\n\x00\r\nQUIT\n\x21\x11\x00\x0c\x01"))
+			Expect(err).To(Equal(proxyprotocol.ErrInvalidHeader))
+		})
+	})
+
+	Describe("Listener", func() {
+		var listener net.Listener
+
+		BeforeEach(func() {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			listener = &proxyprotocol.Listener{Listener: ln, HeaderTimeout: 100 * time.Millisecond}
+		})
+
+		AfterEach(func() {
+			listener.Close()
+		})
+
+		accept := func(data string) (net.Conn, string) {
+			client, err := net.Dial("tcp", listener.Addr().String())
+			Expect(err).ToNot(HaveOccurred())
+			defer client.Close()
+			_, err = client.Write([]byte(data))
+			Expect(err).ToNot(HaveOccurred())
+
+			conn, err := listener.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			buf := make([]byte, 4)
+			n, _ := conn.Read(buf)
+			return conn, string(buf[:n])
+		}
+
+		It("uses the addresses of the header", func() {
+			conn, data := accept(string(proxyprotocol.Header(2, src, dst)) + "data")
+			defer conn.Close()
+			Expect(data).To(Equal("data"))
+			Expect(conn.RemoteAddr().String()).To(Equal("192.168.0.1:12345"))
+			Expect(conn.LocalAddr().String()).To(Equal("10.0.0.1:443"))
+		})
+
+		It("uses the addresses of connections without a header", func() {
+			conn, data := accept("data")
+			defer conn.Close()
+			Expect(data).To(Equal("data"))
+			Expect(conn.LocalAddr().String()).To(Equal(listener.Addr().String()))
+		})
+
+		It("fails reads of connections with invalid headers", func() {
+			conn, data := accept("PROXY TCP5\r\n")
+			defer conn.Close()
+			Expect(data).To(BeEmpty())
+
+			_, err := conn.Read(make([]byte, 1))
+			Expect(err).To(Equal(proxyprotocol.ErrInvalidHeader))
+		})
+	})
+})
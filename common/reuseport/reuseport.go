@@ -0,0 +1,20 @@
+// Package reuseport opens listeners with SO_REUSEPORT, so that several
+// listeners, each with its own accept loop, can listen on the same port. The
+// kernel balances the connections to the port across them.
+package reuseport
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// ErrUnsupported is returned by Listen on platforms without SO_REUSEPORT.
+var ErrUnsupported = errors.New("SO_REUSEPORT is not supported on this platform")
+
+// Listen announces on the local network address with SO_REUSEPORT set. Each
+// call opens another listener on the address.
+func Listen(network, address string) (net.Listener, error) {
+	lc := net.ListenConfig{Control: control}
+	return lc.Listen(context.Background(), network, address)
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package reuseport
+
+import "syscall"
+
+func control(network, address string, c syscall.RawConn) error {
+	return ErrUnsupported
+}
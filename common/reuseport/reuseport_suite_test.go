@@ -0,0 +1,13 @@
+package reuseport_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestReuseport(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Reuseport Suite")
+}
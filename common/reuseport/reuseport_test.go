@@ -0,0 +1,40 @@
+package reuseport_test
+
+import (
+	"net"
+
+	"code.cloudfoundry.org/gorouter/common/reuseport"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Listen", func() {
+	It("opens several listeners on the same port", func() {
+		first, err := reuseport.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer first.Close()
+
+		second, err := reuseport.Listen("tcp", first.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+		defer second.Close()
+		Expect(second.Addr()).To(Equal(first.Addr()))
+
+		first.Close()
+		client, err := net.Dial("tcp", second.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+		defer client.Close()
+
+		conn, err := second.Accept()
+		Expect(err).ToNot(HaveOccurred())
+		conn.Close()
+	})
+
+	It("does not share the port with listeners without SO_REUSEPORT", func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		defer l.Close()
+
+		_, err = reuseport.Listen("tcp", l.Addr().String())
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,56 @@
+package secure
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+)
+
+// ErrInvalidMAC is returned by HmacSHA256 for messages whose MAC does not
+// match.
+var ErrInvalidMAC = errors.New("message authentication failed")
+
+const hmacNonceSize = 12
+
+// HmacSHA256 authenticates messages with an HMAC-SHA256 of the nonce and
+// the message, rather than encrypting them. Its cipher texts are the message
+// followed by the MAC, so the messages can be read by anyone.
+type HmacSHA256 struct {
+	key []byte
+}
+
+func NewHmacSHA256(key []byte) (*HmacSHA256, error) {
+	if len(key) == 0 {
+		return &HmacSHA256{}, errors.New("hmac key must not be empty")
+	}
+	return &HmacSHA256{key: key}, nil
+}
+
+func (h *HmacSHA256) Encrypt(plainText []byte) (cipherText, nonce []byte, err error) {
+	nonce, err = RandomBytes(hmacNonceSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cipherText = append(append([]byte{}, plainText...), h.mac(plainText, nonce)...)
+	return cipherText, nonce, nil
+}
+
+func (h *HmacSHA256) Decrypt(cipherText, nonce []byte) ([]byte, error) {
+	if len(cipherText) < sha256.Size {
+		return nil, ErrInvalidMAC
+	}
+
+	plainText := cipherText[:len(cipherText)-sha256.Size]
+	if !hmac.Equal(cipherText[len(plainText):], h.mac(plainText, nonce)) {
+		return nil, ErrInvalidMAC
+	}
+	return plainText, nil
+}
+
+func (h *HmacSHA256) mac(plainText, nonce []byte) []byte {
+	m := hmac.New(sha256.New, h.key)
+	m.Write(nonce)
+	m.Write(plainText)
+	return m.Sum(nil)
+}
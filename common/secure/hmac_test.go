@@ -0,0 +1,63 @@
+package secure_test
+
+import (
+	"code.cloudfoundry.org/gorouter/common/secure"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HmacSHA256", func() {
+	var (
+		hmac      secure.Crypto
+		plainText = []byte("this is a signed message!")
+	)
+
+	BeforeEach(func() {
+		var err error
+		hmac, err = secure.NewHmacSHA256([]byte("super-secret-key"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("authenticates messages without encrypting them", func() {
+		cipherText, nonce, err := hmac.Encrypt(plainText)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nonce).To(HaveLen(12))
+		Expect(cipherText).To(HavePrefix(string(plainText)))
+
+		decrypted, err := hmac.Decrypt(cipherText, nonce)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decrypted).To(Equal(plainText))
+	})
+
+	It("rejects messages that were changed", func() {
+		cipherText, nonce, err := hmac.Encrypt(plainText)
+		Expect(err).ToNot(HaveOccurred())
+
+		cipherText[0] = 'T'
+		_, err = hmac.Decrypt(cipherText, nonce)
+		Expect(err).To(Equal(secure.ErrInvalidMAC))
+	})
+
+	It("rejects messages with another nonce", func() {
+		cipherText, _, err := hmac.Encrypt(plainText)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = hmac.Decrypt(cipherText, []byte("other-nonce!"))
+		Expect(err).To(Equal(secure.ErrInvalidMAC))
+	})
+
+	It("rejects messages signed with another key", func() {
+		other, err := secure.NewHmacSHA256([]byte("another-secret-key"))
+		Expect(err).ToNot(HaveOccurred())
+		cipherText, nonce, err := other.Encrypt(plainText)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = hmac.Decrypt(cipherText, nonce)
+		Expect(err).To(Equal(secure.ErrInvalidMAC))
+	})
+
+	It("rejects empty keys", func() {
+		_, err := secure.NewHmacSHA256(nil)
+		Expect(err).To(HaveOccurred())
+	})
+})
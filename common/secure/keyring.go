@@ -0,0 +1,27 @@
+package secure
+
+import "errors"
+
+// Keyring is a Crypto of several keys, such as the current and previous keys
+// of a key rotation. It encrypts with the first key, and decrypts with the
+// first key that succeeds.
+type Keyring []Crypto
+
+func (k Keyring) Encrypt(plainText []byte) (cipherText, nonce []byte, err error) {
+	if len(k) == 0 {
+		return nil, nil, errors.New("keyring has no keys")
+	}
+	return k[0].Encrypt(plainText)
+}
+
+func (k Keyring) Decrypt(cipherText, nonce []byte) ([]byte, error) {
+	err := errors.New("keyring has no keys")
+	for _, c := range k {
+		var plainText []byte
+		plainText, err = c.Decrypt(cipherText, nonce)
+		if err == nil {
+			return plainText, nil
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,59 @@
+package secure_test
+
+import (
+	"code.cloudfoundry.org/gorouter/common/secure"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Keyring", func() {
+	var (
+		current, previous, other secure.Crypto
+		keyring                  secure.Keyring
+		plainText                = []byte("this is a secret message!")
+	)
+
+	BeforeEach(func() {
+		var err error
+		current, err = secure.NewAesGCM([]byte("current-key-1234"))
+		Expect(err).ToNot(HaveOccurred())
+		previous, err = secure.NewAesGCM([]byte("previous-key-123"))
+		Expect(err).ToNot(HaveOccurred())
+		other, err = secure.NewAesGCM([]byte("other-key-123456"))
+		Expect(err).ToNot(HaveOccurred())
+		keyring = secure.Keyring{current, previous}
+	})
+
+	It("encrypts with the first key", func() {
+		cipherText, nonce, err := keyring.Encrypt(plainText)
+		Expect(err).ToNot(HaveOccurred())
+
+		decrypted, err := current.Decrypt(cipherText, nonce)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decrypted).To(Equal(plainText))
+	})
+
+	It("decrypts with any of its keys", func() {
+		cipherText, nonce, err := previous.Encrypt(plainText)
+		Expect(err).ToNot(HaveOccurred())
+
+		decrypted, err := keyring.Decrypt(cipherText, nonce)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decrypted).To(Equal(plainText))
+	})
+
+	It("fails to decrypt with other keys", func() {
+		cipherText, nonce, err := other.Encrypt(plainText)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = keyring.Decrypt(cipherText, nonce)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("fails without keys", func() {
+		_, _, err := secure.Keyring{}.Encrypt(plainText)
+		Expect(err).To(HaveOccurred())
+		_, err = secure.Keyring{}.Decrypt(plainText, nil)
+		Expect(err).To(HaveOccurred())
+	})
+})
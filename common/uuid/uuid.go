@@ -1,6 +1,20 @@
 package uuid
 
-import . "github.com/nu7hatch/gouuid"
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"time"
+
+	. "github.com/nu7hatch/gouuid"
+)
+
+// ksuidEpoch is the start of KSUID timestamps, in seconds since the Unix
+// epoch.
+const ksuidEpoch = 1400000000
+
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
 
 func GenerateUUID() (string, error) {
 	guid, err := NewV4()
@@ -9,3 +23,39 @@ func GenerateUUID() (string, error) {
 	}
 	return guid.String(), nil
 }
+
+// GenerateUUIDv7 generates a version 7 UUID, which starts with the current
+// Unix time in milliseconds so that IDs sort by the time they were made.
+func GenerateUUIDv7() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> uint(40-8*i))
+	}
+	b[6] = b[6]&0x0f | 0x70
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// GenerateKSUID generates a KSUID, the 27 character base62 encoding of a
+// timestamp in seconds followed by 16 random bytes.
+func GenerateKSUID() (string, error) {
+	var b [20]byte
+	binary.BigEndian.PutUint32(b[:4], uint32(time.Now().Unix()-ksuidEpoch))
+	if _, err := rand.Read(b[4:]); err != nil {
+		return "", err
+	}
+
+	var s [27]byte
+	n := new(big.Int).SetBytes(b[:])
+	base := big.NewInt(62)
+	mod := new(big.Int)
+	for i := len(s) - 1; i >= 0; i-- {
+		n.DivMod(n, base, mod)
+		s[i] = base62Alphabet[mod.Int64()]
+	}
+	return string(s[:]), nil
+}
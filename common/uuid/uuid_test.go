@@ -12,4 +12,25 @@ var _ = Describe("UUID", func() {
 		Expect(err).ToNot(HaveOccurred())
 		Expect(uuid).To(HaveLen(36))
 	})
+
+	It("creates a version 7 uuid", func() {
+		first, err := uuid.GenerateUUIDv7()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(first).To(MatchRegexp(`^[[:xdigit:]]{8}-[[:xdigit:]]{4}-7[[:xdigit:]]{3}-[89ab][[:xdigit:]]{3}-[[:xdigit:]]{12}$`))
+
+		second, err := uuid.GenerateUUIDv7()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(second).ToNot(Equal(first))
+		Expect(second[:8] >= first[:8]).To(BeTrue())
+	})
+
+	It("creates a ksuid", func() {
+		first, err := uuid.GenerateKSUID()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(first).To(MatchRegexp(`^[0-9A-Za-z]{27}$`))
+
+		second, err := uuid.GenerateKSUID()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(second).ToNot(Equal(first))
+	})
 })
@@ -0,0 +1,96 @@
+package diagnostics
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rpprof "runtime/pprof"
+	"sort"
+
+	"code.cloudfoundry.org/gorouter/route"
+)
+
+const (
+	// PprofPath serves the profiles of the Go runtime in the format of
+	// net/http/pprof.
+	PprofPath = "/debug/pprof/"
+	// VarsPath serves the variables published with expvar.
+	VarsPath = "/debug/vars"
+	// DumpPath serves a dump of the runtime statistics, the routing table and
+	// the stacks of all goroutines.
+	DumpPath = "/debug/dump"
+)
+
+// RouteTable is the routing table that is dumped.
+type RouteTable interface {
+	EachRoute(f func(uri route.Uri, pool *route.Pool))
+}
+
+// NewHandlers returns the handlers of PprofPath, VarsPath and DumpPath by
+// their paths, to be served on the status listener.
+func NewHandlers(table RouteTable) map[string]http.Handler {
+	return map[string]http.Handler{
+		PprofPath:             http.HandlerFunc(pprof.Index),
+		PprofPath + "cmdline": http.HandlerFunc(pprof.Cmdline),
+		PprofPath + "profile": http.HandlerFunc(pprof.Profile),
+		PprofPath + "symbol":  http.HandlerFunc(pprof.Symbol),
+		PprofPath + "trace":   http.HandlerFunc(pprof.Trace),
+		VarsPath:              expvar.Handler(),
+		DumpPath:              &dumpHandler{table: table},
+	}
+}
+
+type dumpHandler struct {
+	table RouteTable
+}
+
+func (h *dumpHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	fmt.Fprintln(w, "# runtime")
+	fmt.Fprintf(w, "go_version: %s\n", runtime.Version())
+	fmt.Fprintf(w, "gomaxprocs: %d\n", runtime.GOMAXPROCS(0))
+	fmt.Fprintf(w, "goroutines: %d\n", runtime.NumGoroutine())
+	fmt.Fprintf(w, "heap_alloc_bytes: %d\n", mem.HeapAlloc)
+	fmt.Fprintf(w, "heap_sys_bytes: %d\n", mem.HeapSys)
+	fmt.Fprintf(w, "heap_objects: %d\n", mem.HeapObjects)
+	fmt.Fprintf(w, "num_gc: %d\n", mem.NumGC)
+	fmt.Fprintf(w, "gc_pause_total_ns: %d\n", mem.PauseTotalNs)
+
+	fmt.Fprintln(w, "\n# routes")
+	h.dumpRoutes(w)
+
+	fmt.Fprintln(w, "\n# goroutines")
+	rpprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+// dumpRoutes writes the routes in order, each followed by the addresses of
+// its endpoints and the requests in flight to them.
+func (h *dumpHandler) dumpRoutes(w http.ResponseWriter) {
+	pools := map[route.Uri]*route.Pool{}
+	uris := []string{}
+	h.table.EachRoute(func(uri route.Uri, pool *route.Pool) {
+		pools[uri] = pool
+		uris = append(uris, string(uri))
+	})
+	sort.Strings(uris)
+
+	for _, uri := range uris {
+		pool := pools[route.Uri(uri)]
+		fmt.Fprintf(w, "%s queued=%d\n", uri, pool.QueueDepth())
+		pool.Each(func(e *route.Endpoint) {
+			fmt.Fprintf(w, "  %s connections=%d\n", e.CanonicalAddr(), e.Stats.NumberConnections.Count())
+		})
+	}
+}
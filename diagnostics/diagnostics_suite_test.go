@@ -0,0 +1,13 @@
+package diagnostics_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestDiagnostics(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Diagnostics Suite")
+}
@@ -0,0 +1,80 @@
+package diagnostics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/diagnostics"
+	"code.cloudfoundry.org/gorouter/metrics/fakes"
+	"code.cloudfoundry.org/gorouter/registry"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/routing-api/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Diagnostics", func() {
+	var (
+		r        *registry.RouteRegistry
+		handlers map[string]http.Handler
+	)
+
+	BeforeEach(func() {
+		logger := test_util.NewTestZapLogger("test")
+		r = registry.NewRouteRegistry(logger, config.DefaultConfig(), new(fakes.FakeRouteRegistryReporter))
+		handlers = diagnostics.NewHandlers(r)
+	})
+
+	serve := func(method, path, target string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, target, nil)
+		Expect(err).NotTo(HaveOccurred())
+		res := httptest.NewRecorder()
+		Expect(handlers).To(HaveKey(path))
+		handlers[path].ServeHTTP(res, req)
+		return res
+	}
+
+	It("serves the pprof index", func() {
+		res := serve("GET", diagnostics.PprofPath, "/debug/pprof/")
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(res.Body.String()).To(ContainSubstring("goroutine"))
+	})
+
+	It("serves profiles by name", func() {
+		res := serve("GET", diagnostics.PprofPath, "/debug/pprof/heap?debug=1")
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(res.Body.String()).To(ContainSubstring("heap profile"))
+	})
+
+	It("serves the expvar variables", func() {
+		res := serve("GET", diagnostics.VarsPath, "/debug/vars")
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(res.Body.String()).To(ContainSubstring(`"memstats"`))
+	})
+
+	Describe("the dump", func() {
+		BeforeEach(func() {
+			e := route.NewEndpoint("app", "10.0.0.1", 8080, "", "", nil, -1, "", models.ModificationTag{}, "")
+			r.Register("foo.com", e)
+			e.Stats.NumberConnections.Increment()
+			r.Register("bar.com", route.NewEndpoint("app", "10.0.0.2", 8080, "", "", nil, -1, "", models.ModificationTag{}, ""))
+		})
+
+		It("dumps the runtime, the routing table and the goroutines", func() {
+			res := serve("GET", diagnostics.DumpPath, "/debug/dump")
+			Expect(res.Code).To(Equal(http.StatusOK))
+
+			body := res.Body.String()
+			Expect(body).To(MatchRegexp(`# runtime\n(.|\n)*goroutines: \d+\n`))
+			Expect(body).To(ContainSubstring("# routes\nbar.com queued=0\n  10.0.0.2:8080 connections=0\nfoo.com queued=0\n  10.0.0.1:8080 connections=1\n"))
+			Expect(body).To(ContainSubstring("# goroutines\ngoroutine "))
+		})
+
+		It("only allows GET", func() {
+			res := serve("POST", diagnostics.DumpPath, "/debug/dump")
+			Expect(res.Code).To(Equal(http.StatusMethodNotAllowed))
+		})
+	})
+})
@@ -8,6 +8,7 @@ import (
 
 	"code.cloudfoundry.org/gorouter/access_log"
 	"code.cloudfoundry.org/gorouter/access_log/schema"
+	router_http "code.cloudfoundry.org/gorouter/common/http"
 	"code.cloudfoundry.org/gorouter/logger"
 	"code.cloudfoundry.org/gorouter/proxy/utils"
 
@@ -18,19 +19,23 @@ import (
 type accessLog struct {
 	accessLogger      access_log.AccessLogger
 	extraHeadersToLog []string
+	routeTagsToLog    []string
 	logger            logger.Logger
 }
 
 // NewAccessLog creates a new handler that handles logging requests to the
-// access log
+// access log, along with the extra headers of the request and the tags of the
+// route registration it was routed with
 func NewAccessLog(
 	accessLogger access_log.AccessLogger,
 	extraHeadersToLog []string,
+	routeTagsToLog []string,
 	logger logger.Logger,
 ) negroni.Handler {
 	return &accessLog{
 		accessLogger:      accessLogger,
 		extraHeadersToLog: extraHeadersToLog,
+		routeTagsToLog:    routeTagsToLog,
 		logger:            logger,
 	}
 }
@@ -42,6 +47,7 @@ func (a *accessLog) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http
 		Request:           r,
 		StartedAt:         time.Now(),
 		ExtraHeadersToLog: a.extraHeadersToLog,
+		RouteTagsToLog:    a.routeTagsToLog,
 	}
 
 	requestBodyCounter := &countingReadCloser{delegate: r.Body}
@@ -55,10 +61,12 @@ func (a *accessLog) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http
 		return
 	}
 	alr.RouteEndpoint = reqInfo.RouteEndpoint
+	alr.RequestID = reqInfo.RequestID
 	alr.RequestBytesReceived = requestBodyCounter.GetCount()
 	alr.BodyBytesSent = proxyWriter.Size()
 	alr.FinishedAt = time.Now()
 	alr.StatusCode = proxyWriter.Status()
+	alr.RouterError = proxyWriter.Header().Get(router_http.CfRouterError)
 	a.accessLogger.Log(*alr)
 }
 
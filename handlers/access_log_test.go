@@ -28,6 +28,7 @@ var _ = Describe("AccessLog", func() {
 
 		accessLogger      *fakes.FakeAccessLogger
 		extraHeadersToLog []string
+		routeTagsToLog    []string
 
 		nextCalled bool
 
@@ -62,6 +63,7 @@ var _ = Describe("AccessLog", func() {
 		resp = httptest.NewRecorder()
 
 		extraHeadersToLog = []string{}
+		routeTagsToLog = []string{"team"}
 
 		accessLogger = &fakes.FakeAccessLogger{}
 
@@ -70,7 +72,7 @@ var _ = Describe("AccessLog", func() {
 		handler = negroni.New()
 		handler.Use(handlers.NewRequestInfo())
 		handler.Use(handlers.NewProxyWriter(fakeLogger))
-		handler.Use(handlers.NewAccessLog(accessLogger, extraHeadersToLog, fakeLogger))
+		handler.Use(handlers.NewAccessLog(accessLogger, extraHeadersToLog, routeTagsToLog, fakeLogger))
 		handler.UseHandlerFunc(nextHandler)
 
 		reqChan = make(chan *http.Request, 1)
@@ -96,6 +98,7 @@ var _ = Describe("AccessLog", func() {
 		Expect(alr.Request.URL).To(Equal(req.URL))
 		Expect(alr.Request.RemoteAddr).To(Equal(req.RemoteAddr))
 		Expect(alr.ExtraHeadersToLog).To(Equal(extraHeadersToLog))
+		Expect(alr.RouteTagsToLog).To(Equal(routeTagsToLog))
 		Expect(alr.FinishedAt).ToNot(BeZero())
 		Expect(alr.RequestBytesReceived).To(Equal(13))
 		Expect(alr.BodyBytesSent).To(Equal(37))
@@ -103,13 +106,33 @@ var _ = Describe("AccessLog", func() {
 		Expect(alr.RouteEndpoint).To(Equal(testEndpoint))
 	})
 
+	Context("when the router fails the request", func() {
+		BeforeEach(func() {
+			handler = negroni.New()
+			handler.Use(handlers.NewRequestInfo())
+			handler.Use(handlers.NewProxyWriter(new(logger_fakes.FakeLogger)))
+			handler.Use(handlers.NewAccessLog(accessLogger, extraHeadersToLog, routeTagsToLog, new(logger_fakes.FakeLogger)))
+			handler.UseHandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				rw.Header().Set("X-Cf-RouterError", "unknown_route")
+				nextHandler(rw, req)
+			})
+		})
+
+		It("records the router error", func() {
+			handler.ServeHTTP(resp, req)
+
+			Expect(accessLogger.LogCallCount()).To(Equal(1))
+			Expect(accessLogger.LogArgsForCall(0).RouterError).To(Equal("unknown_route"))
+		})
+	})
+
 	Context("when request info is not set on the request context", func() {
 		var fakeLogger *logger_fakes.FakeLogger
 		BeforeEach(func() {
 			fakeLogger = new(logger_fakes.FakeLogger)
 			handler = negroni.New()
 			handler.UseFunc(testProxyWriterHandler)
-			handler.Use(handlers.NewAccessLog(accessLogger, extraHeadersToLog, fakeLogger))
+			handler.Use(handlers.NewAccessLog(accessLogger, extraHeadersToLog, routeTagsToLog, fakeLogger))
 			handler.UseHandler(nextHandler)
 		})
 		It("calls Fatal on the logger", func() {
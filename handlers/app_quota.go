@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/metrics"
+	"github.com/uber-go/zap"
+	"github.com/urfave/negroni"
+)
+
+// ErrAppQuotaExceeded is returned by AppQuotas when an application has no
+// quota left for a request.
+var ErrAppQuotaExceeded = errors.New("app quota exceeded")
+
+// AppQuotas counts the requests to each application against its quota.
+type AppQuotas interface {
+	// Take takes a request to the application from its quota, and returns
+	// the function that gives it back once the request is done. When the
+	// application is over its quota it returns ErrAppQuotaExceeded and, if
+	// its rate was exceeded, how long to wait before retrying.
+	Take(appID string) (release func(), wait time.Duration, err error)
+}
+
+type appQuota struct {
+	logger   logger.Logger
+	reporter metrics.CombinedReporter
+	quota    quota
+	apps     map[string]quota
+
+	// the token buckets of the applications, keyed by application
+	buckets *rateLimit
+
+	lock     sync.Mutex
+	inFlight map[string]int
+}
+
+type quota struct {
+	limit         bucketLimit
+	maxConcurrent int
+}
+
+// NewAppQuota creates a handler that sets the AppQuotas of requests. Requests
+// are counted against the quota of the application of the endpoint they are
+// sent to once it has been selected, so that routes shared by several
+// applications count each request against the right one.
+func NewAppQuota(cfg config.AppQuotaConfig, reporter metrics.CombinedReporter, logger logger.Logger, clock clock.Clock) negroni.Handler {
+	apps := make(map[string]quota, len(cfg.Apps))
+	for _, a := range cfg.Apps {
+		apps[a.AppID] = quota{
+			limit:         newBucketLimit(a.RequestsPerSecond, a.Burst),
+			maxConcurrent: a.MaxConcurrentRequests,
+		}
+	}
+
+	return &appQuota{
+		logger:   logger,
+		reporter: reporter,
+		quota: quota{
+			limit:         newBucketLimit(cfg.RequestsPerSecond, cfg.Burst),
+			maxConcurrent: cfg.MaxConcurrentRequests,
+		},
+		apps: apps,
+		buckets: &rateLimit{
+			clock:     clock,
+			buckets:   map[string]*tokenBucket{},
+			lastSweep: clock.Now(),
+		},
+		inFlight: map[string]int{},
+	}
+}
+
+func (q *appQuota) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	reqInfo, err := ContextRequestInfo(r)
+	if err != nil {
+		q.logger.Fatal("request-info-err", zap.Error(err))
+		return
+	}
+	reqInfo.AppQuotas = q
+
+	next(rw, r)
+}
+
+func (q *appQuota) Take(appID string) (func(), time.Duration, error) {
+	if appID == "" {
+		return func() {}, 0, nil
+	}
+	q.reporter.CaptureAppRequest(appID)
+
+	quota, ok := q.apps[appID]
+	if !ok {
+		quota = q.quota
+	}
+
+	if quota.limit.rate > 0 {
+		wait, ok := q.buckets.take(appID, quota.limit)
+		if !ok {
+			q.reporter.CaptureAppQuotaExceeded(appID)
+			return nil, wait, ErrAppQuotaExceeded
+		}
+	}
+	if quota.maxConcurrent > 0 {
+		if !q.acquire(appID, quota.maxConcurrent) {
+			q.reporter.CaptureAppQuotaExceeded(appID)
+			return nil, 0, ErrAppQuotaExceeded
+		}
+		var once sync.Once
+		return func() { once.Do(func() { q.release(appID) }) }, 0, nil
+	}
+	return func() {}, 0, nil
+}
+
+// WriteAppQuotaExceeded responds with 429 Too Many Requests to a request
+// rejected by the quota of its application, asking the client to retry after
+// wait if the rate of the application was exceeded.
+func WriteAppQuotaExceeded(rw http.ResponseWriter, wait time.Duration, logger logger.Logger) {
+	if wait > 0 {
+		rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	}
+	rw.Header().Set("X-Cf-RouterError", "app_quota_exceeded")
+	writeStatus(
+		rw,
+		http.StatusTooManyRequests,
+		"App quota exceeded.",
+		logger,
+	)
+}
+
+// acquire counts a request in flight to the application, unless it already
+// has max requests in flight.
+func (q *appQuota) acquire(appID string, max int) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.inFlight[appID] >= max {
+		return false
+	}
+	q.inFlight[appID]++
+	return true
+}
+
+func (q *appQuota) release(appID string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.inFlight[appID]--
+	if q.inFlight[appID] <= 0 {
+		delete(q.inFlight, appID)
+	}
+}
@@ -0,0 +1,167 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/handlers"
+	logger_fakes "code.cloudfoundry.org/gorouter/logger/fakes"
+	metrics_fakes "code.cloudfoundry.org/gorouter/metrics/fakes"
+	"code.cloudfoundry.org/gorouter/test_util"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("AppQuota", func() {
+	var (
+		handler  *negroni.Negroni
+		cfg      config.AppQuotaConfig
+		clock    *fakeclock.FakeClock
+		reporter *metrics_fakes.FakeCombinedReporter
+		quotas   handlers.AppQuotas
+
+		req  *http.Request
+		resp *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		clock = fakeclock.NewFakeClock(time.Now())
+		reporter = new(metrics_fakes.FakeCombinedReporter)
+		cfg = config.AppQuotaConfig{}
+		quotas = nil
+
+		req = test_util.NewRequest("GET", "example.com", "/", nil)
+		resp = httptest.NewRecorder()
+	})
+
+	JustBeforeEach(func() {
+		handler = negroni.New()
+		handler.Use(handlers.NewRequestInfo())
+		handler.Use(handlers.NewAppQuota(cfg, reporter, new(logger_fakes.FakeLogger), clock))
+		handler.UseHandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			reqInfo, err := handlers.ContextRequestInfo(req)
+			Expect(err).ToNot(HaveOccurred())
+			quotas = reqInfo.AppQuotas
+			rw.WriteHeader(http.StatusOK)
+		})
+
+		handler.ServeHTTP(resp, req)
+	})
+
+	It("sets the app quotas of the request", func() {
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(quotas).ToNot(BeNil())
+		Expect(reporter.CaptureAppRequestCallCount()).To(BeZero())
+	})
+
+	It("counts the requests to the application", func() {
+		_, _, err := quotas.Take("app-guid")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reporter.CaptureAppRequestCallCount()).To(Equal(1))
+		Expect(reporter.CaptureAppRequestArgsForCall(0)).To(Equal("app-guid"))
+		Expect(reporter.CaptureAppQuotaExceededCallCount()).To(BeZero())
+	})
+
+	Context("with a rate quota", func() {
+		BeforeEach(func() {
+			cfg.RequestsPerSecond = 1
+			cfg.Burst = 2
+		})
+
+		It("rejects requests once the quota is exceeded", func() {
+			for i := 0; i < 2; i++ {
+				_, _, err := quotas.Take("app-guid")
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			_, wait, err := quotas.Take("app-guid")
+			Expect(err).To(Equal(handlers.ErrAppQuotaExceeded))
+			Expect(wait).To(BeNumerically(">", 0))
+			Expect(reporter.CaptureAppQuotaExceededCallCount()).To(Equal(1))
+			Expect(reporter.CaptureAppQuotaExceededArgsForCall(0)).To(Equal("app-guid"))
+
+			_, _, err = quotas.Take("other-app-guid")
+			Expect(err).ToNot(HaveOccurred())
+
+			clock.Increment(time.Second)
+			_, _, err = quotas.Take("app-guid")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		Context("when the application has its own quota", func() {
+			BeforeEach(func() {
+				cfg.Apps = []config.AppQuota{{AppID: "app-guid", RequestsPerSecond: 10, Burst: 10}}
+			})
+
+			It("uses the quota of the application", func() {
+				for i := 0; i < 10; i++ {
+					_, _, err := quotas.Take("app-guid")
+					Expect(err).ToNot(HaveOccurred())
+				}
+				_, _, err := quotas.Take("app-guid")
+				Expect(err).To(Equal(handlers.ErrAppQuotaExceeded))
+			})
+		})
+	})
+
+	Context("with a concurrency quota", func() {
+		BeforeEach(func() {
+			cfg.MaxConcurrentRequests = 1
+		})
+
+		It("rejects requests while the application has the maximum requests in flight", func() {
+			release, _, err := quotas.Take("app-guid")
+			Expect(err).ToNot(HaveOccurred())
+
+			_, wait, err := quotas.Take("app-guid")
+			Expect(err).To(Equal(handlers.ErrAppQuotaExceeded))
+			Expect(wait).To(BeZero())
+
+			release()
+			release()
+			_, _, err = quotas.Take("app-guid")
+			Expect(err).ToNot(HaveOccurred())
+			_, _, err = quotas.Take("app-guid")
+			Expect(err).To(Equal(handlers.ErrAppQuotaExceeded))
+		})
+	})
+
+	Context("for endpoints without an application", func() {
+		BeforeEach(func() {
+			cfg.RequestsPerSecond = 1
+			cfg.Burst = 1
+		})
+
+		It("does not count the requests", func() {
+			for i := 0; i < 2; i++ {
+				_, _, err := quotas.Take("")
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(reporter.CaptureAppRequestCallCount()).To(BeZero())
+		})
+	})
+
+	Describe("WriteAppQuotaExceeded", func() {
+		It("responds with 429 Too Many Requests and a Retry-After", func() {
+			rec := httptest.NewRecorder()
+			handlers.WriteAppQuotaExceeded(rec, 1500*time.Millisecond, new(logger_fakes.FakeLogger))
+
+			Expect(rec.Code).To(Equal(http.StatusTooManyRequests))
+			Expect(rec.Header().Get("Retry-After")).To(Equal("2"))
+			Expect(rec.Header().Get("X-Cf-RouterError")).To(Equal("app_quota_exceeded"))
+		})
+
+		It("does not set a Retry-After without a wait", func() {
+			rec := httptest.NewRecorder()
+			handlers.WriteAppQuotaExceeded(rec, 0, new(logger_fakes.FakeLogger))
+
+			Expect(rec.Code).To(Equal(http.StatusTooManyRequests))
+			Expect(rec.Header().Get("Retry-After")).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"github.com/urfave/negroni"
+)
+
+const xfcc = "X-Forwarded-Client-Cert"
+
+type clientCert struct {
+	forwardingMode string
+	logger         logger.Logger
+}
+
+// NewClientCert creates a handler that strips, forwards or sets the
+// X-Forwarded-Client-Cert header according to forwardingMode
+func NewClientCert(forwardingMode string, logger logger.Logger) negroni.Handler {
+	return &clientCert{
+		forwardingMode: forwardingMode,
+		logger:         logger,
+	}
+}
+
+func (c *clientCert) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	switch c.forwardingMode {
+	case config.FORWARD:
+		if !isMutualTLS(r) {
+			r.Header.Del(xfcc)
+		}
+	case config.SANITIZE_SET:
+		r.Header.Del(xfcc)
+		if isMutualTLS(r) {
+			r.Header.Set(xfcc, base64.StdEncoding.EncodeToString(r.TLS.PeerCertificates[0].Raw))
+		}
+	}
+
+	next(rw, r)
+}
+
+func isMutualTLS(r *http.Request) bool {
+	return r.TLS != nil && len(r.TLS.PeerCertificates) > 0
+}
@@ -0,0 +1,103 @@
+package handlers_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/handlers"
+	"code.cloudfoundry.org/gorouter/test_util"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("Clientcert", func() {
+	var (
+		handler        negroni.Handler
+		forwardingMode string
+		req            *http.Request
+		resp           *httptest.ResponseRecorder
+		nextReq        *http.Request
+		nextHandler    http.HandlerFunc
+		clientCert     *x509.Certificate
+	)
+
+	nextHandler = http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		nextReq = r
+	})
+
+	BeforeEach(func() {
+		nextReq = nil
+		req = test_util.NewRequest("GET", "example.com", "/", nil)
+		req.Header.Set("X-Forwarded-Client-Cert", "from-client")
+		resp = httptest.NewRecorder()
+
+		cert := test_util.CreateCert("client")
+		var err error
+		clientCert, err = x509.ParseCertificate(cert.Certificate[0])
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	JustBeforeEach(func() {
+		handler = handlers.NewClientCert(forwardingMode, test_util.NewTestZapLogger("clientcert"))
+		handler.ServeHTTP(resp, req, nextHandler)
+		Expect(nextReq).ToNot(BeNil())
+	})
+
+	withMutualTLS := func() {
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{clientCert}}
+	}
+
+	Context("when the mode is always_forward", func() {
+		BeforeEach(func() {
+			forwardingMode = config.ALWAYS_FORWARD
+		})
+
+		It("forwards the header", func() {
+			Expect(nextReq.Header.Get("X-Forwarded-Client-Cert")).To(Equal("from-client"))
+		})
+	})
+
+	Context("when the mode is forward", func() {
+		BeforeEach(func() {
+			forwardingMode = config.FORWARD
+		})
+
+		It("removes the header when the connection is not mTLS", func() {
+			Expect(nextReq.Header).ToNot(HaveKey("X-Forwarded-Client-Cert"))
+		})
+
+		Context("when the connection is mTLS", func() {
+			BeforeEach(withMutualTLS)
+
+			It("forwards the header", func() {
+				Expect(nextReq.Header.Get("X-Forwarded-Client-Cert")).To(Equal("from-client"))
+			})
+		})
+	})
+
+	Context("when the mode is sanitize_set", func() {
+		BeforeEach(func() {
+			forwardingMode = config.SANITIZE_SET
+		})
+
+		It("removes the header when the connection is not mTLS", func() {
+			Expect(nextReq.Header).ToNot(HaveKey("X-Forwarded-Client-Cert"))
+		})
+
+		Context("when the connection is mTLS", func() {
+			BeforeEach(withMutualTLS)
+
+			It("sets the header to the client certificate", func() {
+				Expect(nextReq.Header["X-Forwarded-Client-Cert"]).To(Equal([]string{
+					base64.StdEncoding.EncodeToString(clientCert.Raw),
+				}))
+			})
+		})
+	})
+})
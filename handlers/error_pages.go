@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	htmltemplate "html/template"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+
+	router_http "code.cloudfoundry.org/gorouter/common/http"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"github.com/uber-go/zap"
+	"github.com/urfave/negroni"
+)
+
+// maxErrorMessageSize limits the error message passed to error page
+// templates.
+const maxErrorMessageSize = 4096
+
+// ErrorPageData is the data error page templates are executed with. In JSON
+// templates the strings are JSON strings, quotes included.
+type ErrorPageData struct {
+	Status     int
+	StatusText string
+	// Message is the plain text body of the error.
+	Message string
+	// Error is the X-Cf-RouterError of the error, such as unknown_route.
+	Error     string
+	RequestID string
+	Host      string
+}
+
+type errorPage struct {
+	html *htmltemplate.Template
+	json *texttemplate.Template
+}
+
+type errorPages struct {
+	pages  map[int]*errorPage
+	logger logger.Logger
+}
+
+// NewErrorPages creates a handler that renders the errors the router responds
+// with using the templates of their status. It must run before the proxy
+// writer handler so that it sees the errors written by the round trippers.
+// The templates must have been validated by config.Process.
+func NewErrorPages(cfg []config.ErrorPageConfig, logger logger.Logger) negroni.Handler {
+	pages := make(map[int]*errorPage, len(cfg))
+	for _, c := range cfg {
+		page := &errorPage{}
+		if c.HTML != "" {
+			page.html = htmltemplate.Must(htmltemplate.New("html").Parse(c.HTML))
+		}
+		if c.JSON != "" {
+			page.json = texttemplate.Must(texttemplate.New("json").Parse(c.JSON))
+		}
+		pages[c.Status] = page
+	}
+
+	return &errorPages{pages: pages, logger: logger}
+}
+
+func (e *errorPages) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	w := &errorPageWriter{ResponseWriter: rw, pages: e.pages}
+	next(w, r)
+
+	if w.page != nil {
+		e.render(rw, r, w)
+	}
+}
+
+// render writes the error page of the intercepted error, or the error as it
+// was written when the request accepts neither HTML nor JSON.
+func (e *errorPages) render(rw http.ResponseWriter, r *http.Request, w *errorPageWriter) {
+	data := ErrorPageData{
+		Status:     w.status,
+		StatusText: http.StatusText(w.status),
+		Message:    strings.TrimSpace(w.body.String()),
+		Error:      rw.Header().Get(router_http.CfRouterError),
+		RequestID:  requestId(r),
+		Host:       hostWithoutPort(r.Host),
+	}
+
+	var body bytes.Buffer
+	var err error
+	contentType := ""
+	switch acceptedErrorFormat(r.Header.Get("Accept"), w.page) {
+	case "json":
+		contentType = "application/json"
+		err = w.page.json.Execute(&body, jsonErrorPageData(data))
+	case "html":
+		contentType = "text/html; charset=utf-8"
+		err = w.page.html.Execute(&body, data)
+	}
+	if err != nil {
+		e.logger.Error("error-page-failed", zap.Int("status", w.status), zap.Error(err))
+		contentType = ""
+	}
+	if contentType == "" {
+		body.Reset()
+		body.Write(w.body.Bytes())
+	} else {
+		rw.Header().Set("Content-Type", contentType)
+	}
+
+	rw.Header().Set("Content-Length", strconv.Itoa(body.Len()))
+	rw.WriteHeader(w.status)
+	rw.Write(body.Bytes())
+}
+
+// acceptedErrorFormat returns json when the accept header lists JSON before
+// HTML, html when it lists HTML or accepts any type, and otherwise an empty
+// string, considering only the formats the page has a template for. JSON is
+// used for any type when the page has no HTML template.
+func acceptedErrorFormat(accept string, page *errorPage) string {
+	jsonIdx := strings.Index(accept, "json")
+	htmlIdx := strings.Index(accept, "text/html")
+	anyType := accept == "" || strings.Contains(accept, "*/*")
+
+	switch {
+	case page.json != nil && jsonIdx >= 0 && (page.html == nil || htmlIdx == -1 || jsonIdx < htmlIdx):
+		return "json"
+	case page.html != nil && (htmlIdx >= 0 || anyType):
+		return "html"
+	case page.json != nil && anyType:
+		return "json"
+	}
+	return ""
+}
+
+func jsonErrorPageData(data ErrorPageData) ErrorPageData {
+	data.StatusText = jsonString(data.StatusText)
+	data.Message = jsonString(data.Message)
+	data.Error = jsonString(data.Error)
+	data.RequestID = jsonString(data.RequestID)
+	data.Host = jsonString(data.Host)
+	return data
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// errorPageWriter holds back the errors written by the router that have an
+// error page, and passes everything else through.
+type errorPageWriter struct {
+	http.ResponseWriter
+	pages map[int]*errorPage
+
+	wroteHeader bool
+	page        *errorPage
+	status      int
+	body        bytes.Buffer
+}
+
+func (w *errorPageWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	routerError := w.Header().Get(router_http.CfRouterError)
+	if page, ok := w.pages[status]; ok && routerError != "" && routerError != "route_in_maintenance" {
+		w.page = page
+		w.status = status
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *errorPageWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.page != nil {
+		if w.body.Len() < maxErrorMessageSize {
+			w.body.Write(b)
+		}
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *errorPageWriter) Flush() {
+	if w.page != nil {
+		return
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *errorPageWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer cannot hijack")
+	}
+	return hijacker.Hijack()
+}
+
+func (w *errorPageWriter) CloseNotify() <-chan bool {
+	if closeNotifier, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return closeNotifier.CloseNotify()
+	}
+	return make(chan bool)
+}
@@ -0,0 +1,170 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/handlers"
+	logger_fakes "code.cloudfoundry.org/gorouter/logger/fakes"
+	"code.cloudfoundry.org/gorouter/test_util"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("ErrorPages", func() {
+	var (
+		handler     *negroni.Negroni
+		pages       []config.ErrorPageConfig
+		nextHandler http.HandlerFunc
+		req         *http.Request
+		resp        *httptest.ResponseRecorder
+	)
+
+	routerError := func(status int, routerError, message string) http.HandlerFunc {
+		return func(rw http.ResponseWriter, req *http.Request) {
+			rw.Header().Set("X-Cf-RouterError", routerError)
+			http.Error(rw, message, status)
+		}
+	}
+
+	BeforeEach(func() {
+		pages = []config.ErrorPageConfig{{
+			Status: http.StatusBadGateway,
+			HTML:   "<h1>{{.Status}} {{.StatusText}}</h1><p>{{.Message}}</p><p>{{.Host}} {{.RequestID}}</p>",
+			JSON:   `{"status":{{.Status}},"error":{{.Error}},"message":{{.Message}},"request_id":{{.RequestID}}}`,
+		}}
+		nextHandler = routerError(http.StatusBadGateway, "endpoint_failure", "502 Bad Gateway: <failed>")
+
+		req = test_util.NewRequest("GET", "example.com:8080", "/", nil)
+		req.Header.Set(handlers.VcapRequestIdHeader, "some-request-id")
+		req.Header.Set("Accept", "text/html")
+		resp = httptest.NewRecorder()
+	})
+
+	JustBeforeEach(func() {
+		handler = negroni.New()
+		handler.Use(handlers.NewErrorPages(pages, new(logger_fakes.FakeLogger)))
+		handler.UseHandlerFunc(nextHandler)
+		handler.ServeHTTP(resp, req)
+	})
+
+	Context("when the request is from a browser", func() {
+		BeforeEach(func() {
+			req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+		})
+
+		It("renders the HTML template", func() {
+			Expect(resp.Code).To(Equal(http.StatusBadGateway))
+			Expect(resp.Header().Get("Content-Type")).To(Equal("text/html; charset=utf-8"))
+			Expect(resp.Header().Get("X-Cf-RouterError")).To(Equal("endpoint_failure"))
+			Expect(resp.Body.String()).To(Equal(
+				"<h1>502 Bad Gateway</h1><p>502 Bad Gateway: &lt;failed&gt;</p><p>example.com some-request-id</p>",
+			))
+			Expect(resp.Header().Get("Content-Length")).To(Equal("96"))
+		})
+	})
+
+	Context("when the request accepts any type", func() {
+		BeforeEach(func() {
+			req.Header.Set("Accept", "*/*")
+		})
+
+		It("renders the HTML template", func() {
+			Expect(resp.Header().Get("Content-Type")).To(Equal("text/html; charset=utf-8"))
+		})
+	})
+
+	Context("when the request has no Accept header", func() {
+		BeforeEach(func() {
+			req.Header.Del("Accept")
+		})
+
+		It("renders the HTML template", func() {
+			Expect(resp.Header().Get("Content-Type")).To(Equal("text/html; charset=utf-8"))
+		})
+	})
+
+	Context("when the request accepts JSON", func() {
+		BeforeEach(func() {
+			req.Header.Set("Accept", "application/json")
+		})
+
+		It("renders the JSON template", func() {
+			Expect(resp.Code).To(Equal(http.StatusBadGateway))
+			Expect(resp.Header().Get("Content-Type")).To(Equal("application/json"))
+			Expect(resp.Body.String()).To(MatchJSON(
+				`{"status":502,"error":"endpoint_failure","message":"502 Bad Gateway: <failed>","request_id":"some-request-id"}`,
+			))
+		})
+	})
+
+	Context("when the request accepts neither HTML nor JSON", func() {
+		BeforeEach(func() {
+			req.Header.Set("Accept", "text/plain")
+		})
+
+		It("writes the error as it is", func() {
+			Expect(resp.Code).To(Equal(http.StatusBadGateway))
+			Expect(resp.Header().Get("Content-Type")).To(Equal("text/plain; charset=utf-8"))
+			Expect(resp.Body.String()).To(Equal("502 Bad Gateway: <failed>\n"))
+		})
+	})
+
+	Context("when the page only has a JSON template", func() {
+		BeforeEach(func() {
+			pages[0].HTML = ""
+		})
+
+		It("writes the error as it is to browsers", func() {
+			Expect(resp.Body.String()).To(Equal("502 Bad Gateway: <failed>\n"))
+		})
+
+		Context("when the request accepts any type", func() {
+			BeforeEach(func() {
+				req.Header.Set("Accept", "*/*")
+			})
+
+			It("renders the JSON template", func() {
+				Expect(resp.Header().Get("Content-Type")).To(Equal("application/json"))
+			})
+		})
+	})
+
+	Context("when the error has no page", func() {
+		BeforeEach(func() {
+			nextHandler = routerError(http.StatusNotFound, "unknown_route", "404 Not Found")
+		})
+
+		It("writes the error as it is", func() {
+			Expect(resp.Code).To(Equal(http.StatusNotFound))
+			Expect(resp.Body.String()).To(Equal("404 Not Found\n"))
+		})
+	})
+
+	Context("when the response is not an error of the router", func() {
+		BeforeEach(func() {
+			nextHandler = func(rw http.ResponseWriter, req *http.Request) {
+				rw.WriteHeader(http.StatusBadGateway)
+				rw.Write([]byte("backend error"))
+			}
+		})
+
+		It("passes the response through", func() {
+			Expect(resp.Code).To(Equal(http.StatusBadGateway))
+			Expect(resp.Body.String()).To(Equal("backend error"))
+		})
+	})
+
+	Context("when the route is in maintenance", func() {
+		BeforeEach(func() {
+			nextHandler = routerError(http.StatusBadGateway, "route_in_maintenance", "maintenance")
+		})
+
+		It("passes the maintenance response through", func() {
+			Expect(resp.Body.String()).To(Equal("maintenance\n"))
+		})
+	})
+})
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/routeservice"
+	"github.com/uber-go/zap"
+	"github.com/urfave/negroni"
+)
+
+type forceHTTPS struct {
+	global              bool
+	forwardedProtoHTTPS bool
+	logger              logger.Logger
+}
+
+// NewForceHTTPS creates a handler that redirects plain HTTP requests to HTTPS
+// with a 301, keeping their host, path and query, when global is true, the
+// route of the request is registered with force_https or its virtual host
+// sets force_https. Requests are plain HTTP unless they arrived over TLS or
+// their X-Forwarded-Proto is https. No request is redirected when
+// forwardedProtoHTTPS is true, as TLS is then terminated in front of the
+// router. It must run after the route of the request has been looked up.
+func NewForceHTTPS(global, forwardedProtoHTTPS bool, logger logger.Logger) negroni.Handler {
+	return &forceHTTPS{
+		global:              global,
+		forwardedProtoHTTPS: forwardedProtoHTTPS,
+		logger:              logger,
+	}
+}
+
+func (h *forceHTTPS) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if h.forwardedProtoHTTPS || isHTTPS(r) {
+		next(rw, r)
+		return
+	}
+
+	reqInfo, err := ContextRequestInfo(r)
+	if err != nil {
+		h.logger.Fatal("request-info-err", zap.Error(err))
+		return
+	}
+	pool := reqInfo.RoutePool
+	vhForceHTTPS := reqInfo.VirtualHost != nil && reqInfo.VirtualHost.ForceHTTPS
+	if !h.global && !vhForceHTTPS && (pool == nil || !pool.ForceHTTPS()) {
+		next(rw, r)
+		return
+	}
+	// requests returning from a route service were redirected on their way
+	// to it
+	if pool != nil && hasBeenToRouteService(pool.RouteServiceUrl(), r.Header.Get(routeservice.RouteServiceSignature)) {
+		next(rw, r)
+		return
+	}
+
+	target := "https://" + hostWithoutPort(r.Host) + r.URL.RequestURI()
+	h.logger.Debug("redirecting-to-https", zap.String("location", target))
+	http.Redirect(rw, r, target, http.StatusMovedPermanently)
+}
+
+// isHTTPS returns whether the request arrived over TLS, or was sent over TLS
+// to the proxy in front of the router that forwarded it.
+func isHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	proto := strings.Split(r.Header.Get("X-Forwarded-Proto"), ",")[0]
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
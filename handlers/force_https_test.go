@@ -0,0 +1,128 @@
+package handlers_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/handlers"
+	logger_fakes "code.cloudfoundry.org/gorouter/logger/fakes"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/routing-api/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("ForceHTTPS", func() {
+	var (
+		global              bool
+		forwardedProtoHTTPS bool
+		pool                *route.Pool
+		endpoint            *route.Endpoint
+		req                 *http.Request
+		resp                *httptest.ResponseRecorder
+		nextCalled          bool
+	)
+
+	BeforeEach(func() {
+		global = false
+		forwardedProtoHTTPS = false
+		nextCalled = false
+		pool = route.NewPool(2*time.Minute, "/")
+		endpoint = route.NewEndpoint("app", "1.2.3.4", 5678, "", "", nil, -1, "", models.ModificationTag{}, "")
+		pool.Put(endpoint)
+		req = httptest.NewRequest("GET", "http://example.com:8080/some/path?q=1", nil)
+		resp = httptest.NewRecorder()
+	})
+
+	JustBeforeEach(func() {
+		handler := negroni.New()
+		handler.Use(handlers.NewRequestInfo())
+		handler.UseFunc(func(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+			reqInfo, err := handlers.ContextRequestInfo(req)
+			Expect(err).ToNot(HaveOccurred())
+			reqInfo.RoutePool = pool
+			next(rw, req)
+		})
+		handler.Use(handlers.NewForceHTTPS(global, forwardedProtoHTTPS, new(logger_fakes.FakeLogger)))
+		handler.UseHandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			nextCalled = true
+			rw.WriteHeader(http.StatusOK)
+		})
+		handler.ServeHTTP(resp, req)
+	})
+
+	Context("when the route does not force HTTPS", func() {
+		It("proxies the request", func() {
+			Expect(nextCalled).To(BeTrue())
+			Expect(resp.Code).To(Equal(http.StatusOK))
+		})
+	})
+
+	Context("when the route forces HTTPS", func() {
+		BeforeEach(func() {
+			endpoint.ForceHTTPS = true
+		})
+
+		It("redirects the request to HTTPS with its host, path and query", func() {
+			Expect(nextCalled).To(BeFalse())
+			Expect(resp.Code).To(Equal(http.StatusMovedPermanently))
+			Expect(resp.Header().Get("Location")).To(Equal("https://example.com/some/path?q=1"))
+		})
+
+		Context("when the host is an IPv6 address", func() {
+			BeforeEach(func() {
+				req = httptest.NewRequest("GET", "http://[2001:db8::1]:8080/some/path", nil)
+			})
+
+			It("redirects to the bracketed address", func() {
+				Expect(resp.Header().Get("Location")).To(Equal("https://[2001:db8::1]/some/path"))
+			})
+		})
+
+		Context("when the request arrived over TLS", func() {
+			BeforeEach(func() {
+				req.TLS = &tls.ConnectionState{}
+			})
+
+			It("proxies the request", func() {
+				Expect(nextCalled).To(BeTrue())
+			})
+		})
+
+		Context("when the request was forwarded from HTTPS", func() {
+			BeforeEach(func() {
+				req.Header.Set("X-Forwarded-Proto", "HTTPS, http")
+			})
+
+			It("proxies the request", func() {
+				Expect(nextCalled).To(BeTrue())
+			})
+		})
+
+		Context("when the forwarded proto is forced to https", func() {
+			BeforeEach(func() {
+				forwardedProtoHTTPS = true
+			})
+
+			It("proxies the request", func() {
+				Expect(nextCalled).To(BeTrue())
+			})
+		})
+	})
+
+	Context("when HTTPS is forced globally", func() {
+		BeforeEach(func() {
+			global = true
+		})
+
+		It("redirects the request to HTTPS", func() {
+			Expect(nextCalled).To(BeFalse())
+			Expect(resp.Code).To(Equal(http.StatusMovedPermanently))
+			Expect(resp.Header().Get("Location")).To(Equal("https://example.com/some/path?q=1"))
+		})
+	})
+})
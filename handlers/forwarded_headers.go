@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/urfave/negroni"
+)
+
+// untrustedForwardedHeaders are the headers that describe the client and the
+// original request, which are removed from requests of untrusted clients.
+var untrustedForwardedHeaders = []string{
+	"Forwarded",
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Port",
+}
+
+type forwardedHeaders struct {
+	trustedNets []*net.IPNet
+}
+
+// NewForwardedHeaders creates a handler that honors the X-Forwarded-*
+// headers only of requests from the trusted proxies. Otherwise the headers
+// are removed, so that X-Forwarded-For is set to the remote address only,
+// and X-Forwarded-Proto is set to the scheme of the request.
+func NewForwardedHeaders(trustedNets []*net.IPNet) negroni.Handler {
+	return &forwardedHeaders{
+		trustedNets: trustedNets,
+	}
+}
+
+func (f *forwardedHeaders) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if !remoteIPIn(r, f.trustedNets) {
+		for _, name := range untrustedForwardedHeaders {
+			r.Header.Del(name)
+		}
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		r.Header.Set("X-Forwarded-Proto", scheme)
+	}
+	next(rw, r)
+}
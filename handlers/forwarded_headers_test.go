@@ -0,0 +1,82 @@
+package handlers_test
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/gorouter/handlers"
+	"code.cloudfoundry.org/gorouter/test_util"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("ForwardedHeaders", func() {
+	var (
+		req         *http.Request
+		nextRequest *http.Request
+	)
+
+	BeforeEach(func() {
+		req = test_util.NewRequest("GET", "example.com", "/", nil)
+		req.RemoteAddr = "10.0.16.5:43210"
+		req.Header.Set("X-Forwarded-For", "1.2.3.4")
+		req.Header.Set("X-Forwarded-Proto", "https")
+		req.Header.Set("X-Forwarded-Host", "spoofed.example.com")
+		req.Header.Set("Forwarded", "for=1.2.3.4")
+		req.Header.Set("X-Forwarded-Client-Cert", "some-cert")
+	})
+
+	JustBeforeEach(func() {
+		_, trusted, err := net.ParseCIDR("10.0.16.0/24")
+		Expect(err).ToNot(HaveOccurred())
+
+		handler := negroni.New()
+		handler.Use(handlers.NewForwardedHeaders([]*net.IPNet{trusted}))
+		handler.UseHandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			nextRequest = r
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	It("keeps the headers of requests from trusted proxies", func() {
+		Expect(nextRequest.Header.Get("X-Forwarded-For")).To(Equal("1.2.3.4"))
+		Expect(nextRequest.Header.Get("X-Forwarded-Proto")).To(Equal("https"))
+		Expect(nextRequest.Header.Get("X-Forwarded-Host")).To(Equal("spoofed.example.com"))
+		Expect(nextRequest.Header.Get("Forwarded")).To(Equal("for=1.2.3.4"))
+	})
+
+	Context("when the request is not from a trusted proxy", func() {
+		BeforeEach(func() {
+			req.RemoteAddr = "192.168.0.1:43210"
+		})
+
+		It("removes the headers describing the client", func() {
+			Expect(nextRequest.Header).ToNot(HaveKey("X-Forwarded-For"))
+			Expect(nextRequest.Header).ToNot(HaveKey("X-Forwarded-Host"))
+			Expect(nextRequest.Header).ToNot(HaveKey("Forwarded"))
+		})
+
+		It("sets X-Forwarded-Proto to the scheme of the request", func() {
+			Expect(nextRequest.Header.Get("X-Forwarded-Proto")).To(Equal("http"))
+		})
+
+		It("leaves X-Forwarded-Client-Cert to the forwarded client cert mode", func() {
+			Expect(nextRequest.Header.Get("X-Forwarded-Client-Cert")).To(Equal("some-cert"))
+		})
+
+		Context("when the request was received over TLS", func() {
+			BeforeEach(func() {
+				req.TLS = &tls.ConnectionState{}
+				req.Header.Set("X-Forwarded-Proto", "http")
+			})
+
+			It("sets X-Forwarded-Proto to https", func() {
+				Expect(nextRequest.Header.Get("X-Forwarded-Proto")).To(Equal("https"))
+			})
+		})
+	})
+})
@@ -1,6 +1,9 @@
 package handlers_test
 
 import (
+	"net/http"
+	"net/http/httptest"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -11,3 +14,11 @@ func TestHandlers(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Handlers Suite")
 }
+
+// serve serves the request with the handler, for tests that send several
+// requests, and returns the response.
+func serve(handler http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	return resp
+}
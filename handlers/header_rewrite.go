@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/routeservice"
+	"github.com/uber-go/zap"
+	"github.com/urfave/negroni"
+)
+
+type headerRewrite struct {
+	reloadable *config.ReloadableConfig
+	logger     logger.Logger
+}
+
+// NewHeaderRewrite creates a handler that applies the request rules of the
+// current config, followed by the request rules of the route, to requests.
+// It must run after the route of the request has been looked up.
+func NewHeaderRewrite(reloadable *config.ReloadableConfig, logger logger.Logger) negroni.Handler {
+	return &headerRewrite{
+		reloadable: reloadable,
+		logger:     logger,
+	}
+}
+
+func (h *headerRewrite) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	reqInfo, err := ContextRequestInfo(r)
+	if err != nil {
+		h.logger.Fatal("request-info-err", zap.Error(err))
+		return
+	}
+
+	// requests returning from a route service were rewritten on their way
+	// to it
+	if reqInfo.RoutePool != nil && hasBeenToRouteService(reqInfo.RoutePool.RouteServiceUrl(), r.Header.Get(routeservice.RouteServiceSignature)) {
+		next(rw, r)
+		return
+	}
+
+	ApplyHeaderRules(h.reloadable.Get().HeaderRewrites.Request, r.Header)
+	if reqInfo.RoutePool != nil {
+		if rewrites := reqInfo.RoutePool.HeaderRewrites(); rewrites != nil {
+			ApplyHeaderRules(rewrites.Request, r.Header)
+		}
+	}
+	next(rw, r)
+}
+
+// ApplyHeaderRules removes, sets and then adds the headers of the rules.
+func ApplyHeaderRules(rules config.HeaderRules, header http.Header) {
+	for _, name := range rules.Remove {
+		header.Del(name)
+	}
+	for _, h := range rules.Set {
+		header.Set(h.Name, h.Value)
+	}
+	for _, h := range rules.Add {
+		header.Add(h.Name, h.Value)
+	}
+}
@@ -0,0 +1,119 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/handlers"
+	logger_fakes "code.cloudfoundry.org/gorouter/logger/fakes"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/routeservice"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/routing-api/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("HeaderRewrite", func() {
+	var (
+		handler     *negroni.Negroni
+		rewrites    config.HeaderRewriteConfig
+		reloadable  *config.ReloadableConfig
+		pool        *route.Pool
+		req         *http.Request
+		nextRequest *http.Request
+	)
+
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		nextRequest = req
+	})
+
+	BeforeEach(func() {
+		nextRequest = nil
+		pool = route.NewPool(2*time.Minute, "")
+		rewrites = config.HeaderRewriteConfig{
+			Request: config.HeaderRules{
+				Add:    []config.HeaderValue{{Name: "X-Added", Value: "global"}},
+				Set:    []config.HeaderValue{{Name: "X-Set", Value: "global"}},
+				Remove: []string{"X-Internal"},
+			},
+		}
+
+		req = test_util.NewRequest("GET", "example.com", "/", nil)
+		req.Header.Set("X-Added", "client")
+		req.Header.Set("X-Set", "client")
+		req.Header.Set("X-Internal", "secret")
+	})
+
+	JustBeforeEach(func() {
+		handler = negroni.New()
+		handler.Use(handlers.NewRequestInfo())
+		handler.UseFunc(func(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+			reqInfo, err := handlers.ContextRequestInfo(req)
+			Expect(err).ToNot(HaveOccurred())
+			reqInfo.RoutePool = pool
+			next(rw, req)
+		})
+		reloadable = config.NewReloadableConfig(&config.Config{HeaderRewrites: rewrites})
+		handler.Use(handlers.NewHeaderRewrite(reloadable, new(logger_fakes.FakeLogger)))
+		handler.UseHandler(nextHandler)
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	It("applies the request rules", func() {
+		Expect(nextRequest.Header["X-Added"]).To(Equal([]string{"client", "global"}))
+		Expect(nextRequest.Header["X-Set"]).To(Equal([]string{"global"}))
+		Expect(nextRequest.Header).ToNot(HaveKey("X-Internal"))
+	})
+
+	It("applies the request rules of the reloaded config", func() {
+		reloadable.Set(&config.Config{HeaderRewrites: config.HeaderRewriteConfig{
+			Request: config.HeaderRules{
+				Set: []config.HeaderValue{{Name: "X-Set", Value: "reloaded"}},
+			},
+		}})
+
+		req := test_util.NewRequest("GET", "example.com", "/", nil)
+		req.Header.Set("X-Internal", "secret")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		Expect(nextRequest.Header["X-Set"]).To(Equal([]string{"reloaded"}))
+		Expect(nextRequest.Header.Get("X-Internal")).To(Equal("secret"))
+	})
+
+	Context("when the route has header rules", func() {
+		BeforeEach(func() {
+			endpoint := route.NewEndpoint("", "1.2.3.4", 80, "", "", nil, -1, "", models.ModificationTag{}, "")
+			endpoint.HeaderRewrites = &config.HeaderRewriteConfig{
+				Request: config.HeaderRules{
+					Set:    []config.HeaderValue{{Name: "X-Set", Value: "route"}},
+					Remove: []string{"X-Added"},
+				},
+			}
+			pool.Put(endpoint)
+		})
+
+		It("applies them after the global rules", func() {
+			Expect(nextRequest.Header["X-Set"]).To(Equal([]string{"route"}))
+			Expect(nextRequest.Header).ToNot(HaveKey("X-Added"))
+			Expect(nextRequest.Header).ToNot(HaveKey("X-Internal"))
+		})
+	})
+
+	Context("when the request returns from a route service", func() {
+		BeforeEach(func() {
+			endpoint := route.NewEndpoint("", "1.2.3.4", 80, "", "", nil, -1, "https://rs.example.com", models.ModificationTag{}, "")
+			pool.Put(endpoint)
+			req.Header.Set(routeservice.RouteServiceSignature, "some-signature")
+		})
+
+		It("does not apply the rules again", func() {
+			Expect(nextRequest.Header["X-Added"]).To(Equal([]string{"client"}))
+			Expect(nextRequest.Header.Get("X-Internal")).To(Equal("secret"))
+		})
+	})
+})
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
 
@@ -23,6 +24,14 @@ func writeStatus(rw http.ResponseWriter, code int, message string, logger logger
 func hostWithoutPort(reqHost string) string {
 	host := reqHost
 
+	// IPv6 hosts keep their brackets
+	if strings.HasPrefix(host, "[") {
+		if pos := strings.Index(host, "]"); pos >= 0 {
+			return host[0 : pos+1]
+		}
+		return host
+	}
+
 	// Remove :<port>
 	pos := strings.Index(host, ":")
 	if pos >= 0 {
@@ -31,3 +40,70 @@ func hostWithoutPort(reqHost string) string {
 
 	return host
 }
+
+// forwardedIP returns the IP of an address of X-Forwarded-For, which some
+// proxies send with a port, or bracket when it is an IPv6 address.
+func forwardedIP(addr string) string {
+	addr = strings.TrimSpace(addr)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
+
+// ClientIP returns the first address of X-Forwarded-For, which is the client
+// when the router is behind load balancers, or else the remote address.
+func ClientIP(request *http.Request) string {
+	if xff := request.Header.Get("X-Forwarded-For"); xff != "" {
+		return forwardedIP(strings.Split(xff, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
+// trustedClientIP returns the IP of the client that cannot be spoofed by
+// clients behind the trusted proxies: the remote address, or the last address
+// of X-Forwarded-For that is not a trusted proxy when it is. Without trusted
+// proxies it is the remote address.
+func trustedClientIP(request *http.Request, trustedNets []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	var forwarded []string
+	if xff := request.Header.Get("X-Forwarded-For"); xff != "" {
+		forwarded = strings.Split(xff, ",")
+	}
+	for i := len(forwarded) - 1; i >= 0 && ip != nil && ipIn(ip, trustedNets); i-- {
+		ip = net.ParseIP(forwardedIP(forwarded[i]))
+	}
+	return ip
+}
+
+// remoteIPIn returns whether the remote address of the request is in one of
+// the networks.
+func remoteIPIn(request *http.Request, nets []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	return ipIn(ip, nets)
+}
+
+// ipIn returns whether the IP is in one of the networks.
+func ipIn(ip net.IP, nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
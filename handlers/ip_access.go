@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/routeservice"
+	"github.com/uber-go/zap"
+	"github.com/urfave/negroni"
+)
+
+type ipAccess struct {
+	logger      logger.Logger
+	allowNets   []*net.IPNet
+	denyNets    []*net.IPNet
+	trustedNets []*net.IPNet
+	perRoute    bool
+}
+
+// NewIPAccess creates a handler that responds with 403 Forbidden to requests
+// from clients that are denied by the IP access lists of the router. Clients
+// are identified by the trusted client IP for the trusted proxies. It must
+// run before the route of the request is looked up, so that denied clients
+// cannot tell which routes exist. Requests with a route service signature
+// are checked by the handler of NewRouteIPAccess instead, as only their route
+// tells whether they return from a route service.
+func NewIPAccess(cfg config.IPAccessConfig, trustedNets []*net.IPNet, logger logger.Logger) negroni.Handler {
+	return &ipAccess{
+		logger:      logger,
+		allowNets:   cfg.AllowNets,
+		denyNets:    cfg.DenyNets,
+		trustedNets: trustedNets,
+	}
+}
+
+// NewRouteIPAccess creates a handler that responds with 403 Forbidden to
+// requests from clients that are denied by the IP access lists of their
+// route, and to requests with a route service signature from clients denied
+// by the IP access lists of the router. It must run after the route of the
+// request has been looked up.
+func NewRouteIPAccess(cfg config.IPAccessConfig, trustedNets []*net.IPNet, logger logger.Logger) negroni.Handler {
+	return &ipAccess{
+		logger:      logger,
+		allowNets:   cfg.AllowNets,
+		denyNets:    cfg.DenyNets,
+		trustedNets: trustedNets,
+		perRoute:    true,
+	}
+}
+
+func (a *ipAccess) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	signed := r.Header.Get(routeservice.RouteServiceSignature) != ""
+	if !a.perRoute {
+		if !signed && !a.routerAllows(r) {
+			a.deny(rw, r)
+			return
+		}
+		next(rw, r)
+		return
+	}
+
+	reqInfo, err := ContextRequestInfo(r)
+	if err != nil {
+		a.logger.Fatal("request-info-err", zap.Error(err))
+		return
+	}
+	if reqInfo.RoutePool == nil {
+		next(rw, r)
+		return
+	}
+
+	// requests returning from a route service come from the route service,
+	// and were checked on their way to it
+	if hasBeenToRouteService(reqInfo.RoutePool.RouteServiceUrl(), r.Header.Get(routeservice.RouteServiceSignature)) {
+		next(rw, r)
+		return
+	}
+
+	if signed && !a.routerAllows(r) {
+		a.deny(rw, r)
+		return
+	}
+	if routeAccess := reqInfo.RoutePool.IPAccess(); routeAccess != nil && !routeAccess.Allowed(trustedClientIP(r, a.trustedNets)) {
+		a.deny(rw, r)
+		return
+	}
+
+	next(rw, r)
+}
+
+// routerAllows reports whether the IP access lists of the router allow the
+// client of the request.
+func (a *ipAccess) routerAllows(r *http.Request) bool {
+	if len(a.allowNets) == 0 && len(a.denyNets) == 0 {
+		return true
+	}
+	return route.IPAllowed(trustedClientIP(r, a.trustedNets), a.allowNets, a.denyNets)
+}
+
+func (a *ipAccess) deny(rw http.ResponseWriter, r *http.Request) {
+	a.logger.Info("ip-access-denied", zap.String("client-ip", trustedClientIP(r, a.trustedNets).String()))
+	rw.Header().Set("X-Cf-RouterError", "forbidden")
+	writeStatus(
+		rw,
+		http.StatusForbidden,
+		"Access from your IP address is not allowed.",
+		a.logger,
+	)
+}
@@ -0,0 +1,299 @@
+package handlers_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/handlers"
+	logger_fakes "code.cloudfoundry.org/gorouter/logger/fakes"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/routeservice"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/routing-api/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("IPAccess", func() {
+	var (
+		handler     *negroni.Negroni
+		cfg         config.IPAccessConfig
+		trustedNets []*net.IPNet
+		access      *route.IPAccess
+		rsURL       string
+		noRoute     bool
+		req         *http.Request
+		resp        *httptest.ResponseRecorder
+		nextCalled  bool
+	)
+
+	cidrs := func(cidrs ...string) []*net.IPNet {
+		nets := []*net.IPNet{}
+		for _, cidr := range cidrs {
+			_, n, err := net.ParseCIDR(cidr)
+			Expect(err).ToNot(HaveOccurred())
+			nets = append(nets, n)
+		}
+		return nets
+	}
+
+	BeforeEach(func() {
+		nextCalled = false
+		cfg = config.IPAccessConfig{}
+		trustedNets = nil
+		access = nil
+		rsURL = ""
+		noRoute = false
+		req = test_util.NewRequest("GET", "example.com", "/", nil)
+		req.RemoteAddr = "10.0.16.4:41234"
+		resp = httptest.NewRecorder()
+	})
+
+	JustBeforeEach(func() {
+		pool := route.NewPool(2*time.Minute, "/")
+		endpoint := route.NewEndpoint("app-guid", "10.0.32.4", 8080, "", "", nil, -1, rsURL, models.ModificationTag{}, "")
+		endpoint.IPAccess = access
+		pool.Put(endpoint)
+
+		handler = negroni.New()
+		handler.Use(handlers.NewRequestInfo())
+		handler.Use(handlers.NewIPAccess(cfg, trustedNets, new(logger_fakes.FakeLogger)))
+		handler.UseFunc(func(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+			if noRoute {
+				rw.WriteHeader(http.StatusNotFound)
+				return
+			}
+			reqInfo, err := handlers.ContextRequestInfo(req)
+			Expect(err).ToNot(HaveOccurred())
+			reqInfo.RoutePool = pool
+			next(rw, req)
+		})
+		handler.Use(handlers.NewRouteIPAccess(cfg, trustedNets, new(logger_fakes.FakeLogger)))
+		handler.UseHandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			nextCalled = true
+			rw.WriteHeader(http.StatusOK)
+		})
+		handler.ServeHTTP(resp, req)
+	})
+
+	It("allows all clients without access lists", func() {
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(nextCalled).To(BeTrue())
+	})
+
+	Context("with access lists of the router", func() {
+		BeforeEach(func() {
+			cfg.AllowNets = cidrs("10.0.0.0/8")
+			cfg.DenyNets = cidrs("10.0.16.0/24")
+		})
+
+		It("responds with 403 to denied clients", func() {
+			Expect(resp.Code).To(Equal(http.StatusForbidden))
+			Expect(resp.Header().Get("X-Cf-RouterError")).To(Equal("forbidden"))
+			Expect(nextCalled).To(BeFalse())
+		})
+
+		Context("when the client is not allowed", func() {
+			BeforeEach(func() {
+				req.RemoteAddr = "192.168.0.1:41234"
+			})
+
+			It("responds with 403", func() {
+				Expect(resp.Code).To(Equal(http.StatusForbidden))
+			})
+		})
+
+		Context("when the client is allowed and not denied", func() {
+			BeforeEach(func() {
+				req.RemoteAddr = "10.0.17.4:41234"
+			})
+
+			It("allows the client", func() {
+				Expect(resp.Code).To(Equal(http.StatusOK))
+			})
+
+			Context("when the route does not exist", func() {
+				BeforeEach(func() {
+					noRoute = true
+				})
+
+				It("responds with 404", func() {
+					Expect(resp.Code).To(Equal(http.StatusNotFound))
+				})
+			})
+		})
+
+		Context("when the route does not exist", func() {
+			BeforeEach(func() {
+				noRoute = true
+			})
+
+			It("responds with 403 to denied clients before their route is looked up", func() {
+				Expect(resp.Code).To(Equal(http.StatusForbidden))
+			})
+		})
+
+		Context("when the client sends a route service signature", func() {
+			BeforeEach(func() {
+				req.Header.Set(routeservice.RouteServiceSignature, "signature")
+			})
+
+			It("responds with 403 to denied clients", func() {
+				Expect(resp.Code).To(Equal(http.StatusForbidden))
+			})
+		})
+	})
+
+	Context("with access lists of the route", func() {
+		BeforeEach(func() {
+			access = &route.IPAccess{Allow: []string{"10.0.16.0/24", "fd00::/8"}}
+		})
+
+		It("allows clients that are allowed", func() {
+			Expect(resp.Code).To(Equal(http.StatusOK))
+		})
+
+		Context("when the client has an allowed IPv6 address", func() {
+			BeforeEach(func() {
+				req.RemoteAddr = "[fd00::1]:41234"
+			})
+
+			It("allows the client", func() {
+				Expect(resp.Code).To(Equal(http.StatusOK))
+			})
+		})
+
+		Context("when the client is not allowed", func() {
+			BeforeEach(func() {
+				req.RemoteAddr = "10.0.17.4:41234"
+			})
+
+			It("responds with 403", func() {
+				Expect(resp.Code).To(Equal(http.StatusForbidden))
+			})
+		})
+
+		Context("and of the router", func() {
+			BeforeEach(func() {
+				cfg.DenyNets = cidrs("10.0.16.4/32")
+			})
+
+			It("responds with 403 to clients that the router denies", func() {
+				Expect(resp.Code).To(Equal(http.StatusForbidden))
+			})
+		})
+	})
+
+	Context("with X-Forwarded-For", func() {
+		BeforeEach(func() {
+			access = &route.IPAccess{Deny: []string{"203.0.113.0/24"}}
+			req.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.7")
+		})
+
+		Context("when the route allows an address of X-Forwarded-For", func() {
+			BeforeEach(func() {
+				access = &route.IPAccess{Allow: []string{"198.51.100.0/24"}}
+			})
+
+			It("uses the remote address without trusted proxies", func() {
+				Expect(resp.Code).To(Equal(http.StatusForbidden))
+			})
+		})
+
+		Context("when a client spoofs an allowed address", func() {
+			BeforeEach(func() {
+				cfg.AllowNets = cidrs("198.51.100.0/24")
+				req.RemoteAddr = "203.0.113.9:41234"
+				req.Header.Set("X-Forwarded-For", "198.51.100.1")
+			})
+
+			It("responds with 403 without trusted proxies", func() {
+				Expect(resp.Code).To(Equal(http.StatusForbidden))
+			})
+
+			Context("with trusted proxies", func() {
+				BeforeEach(func() {
+					trustedNets = cidrs("10.0.16.0/24")
+				})
+
+				It("responds with 403", func() {
+					Expect(resp.Code).To(Equal(http.StatusForbidden))
+				})
+			})
+		})
+
+		Context("with trusted proxies", func() {
+			BeforeEach(func() {
+				trustedNets = cidrs("10.0.16.0/24")
+			})
+
+			It("uses the last address that is not a trusted proxy", func() {
+				Expect(resp.Code).To(Equal(http.StatusForbidden))
+			})
+
+			Context("when the remote address is not a trusted proxy", func() {
+				BeforeEach(func() {
+					req.RemoteAddr = "198.51.100.1:41234"
+				})
+
+				It("uses the remote address", func() {
+					Expect(resp.Code).To(Equal(http.StatusOK))
+				})
+			})
+		})
+
+		Context("with bracketed IPv6 addresses", func() {
+			BeforeEach(func() {
+				trustedNets = cidrs("10.0.16.0/24")
+				access = &route.IPAccess{Deny: []string{"2001:db8::/32"}}
+			})
+
+			Context("with a port", func() {
+				BeforeEach(func() {
+					req.Header.Set("X-Forwarded-For", "[2001:db8::1]:41234")
+				})
+
+				It("uses the address without brackets or port", func() {
+					Expect(resp.Code).To(Equal(http.StatusForbidden))
+				})
+			})
+
+			Context("without a port", func() {
+				BeforeEach(func() {
+					req.Header.Set("X-Forwarded-For", "[2001:db8::1]")
+				})
+
+				It("uses the address without brackets", func() {
+					Expect(resp.Code).To(Equal(http.StatusForbidden))
+				})
+			})
+		})
+	})
+
+	Context("when the request returns from a route service", func() {
+		BeforeEach(func() {
+			access = &route.IPAccess{Deny: []string{"10.0.0.0/8"}}
+			rsURL = "https://rs.example.com"
+			req.Header.Set(routeservice.RouteServiceSignature, "signature")
+		})
+
+		It("does not check it again", func() {
+			Expect(resp.Code).To(Equal(http.StatusOK))
+		})
+
+		Context("and the router denies the route service", func() {
+			BeforeEach(func() {
+				cfg.DenyNets = cidrs("10.0.0.0/8")
+			})
+
+			It("does not check it against the access lists of the router", func() {
+				Expect(resp.Code).To(Equal(http.StatusOK))
+			})
+		})
+	})
+})
@@ -1,11 +1,11 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
-	"fmt"
-
 	router_http "code.cloudfoundry.org/gorouter/common/http"
 	"code.cloudfoundry.org/gorouter/logger"
 	"code.cloudfoundry.org/gorouter/metrics"
@@ -26,7 +26,10 @@ type lookupHandler struct {
 	logger   logger.Logger
 }
 
-// NewLookup creates a handler responsible for looking up a route.
+// NewLookup creates a handler responsible for looking up a route. Requests
+// with an X-CF-APP-INSTANCE header are routed to that instance of the app
+// only; they are answered with 400 Bad Request if the header is malformed
+// and with 404 Not Found if the route has no such instance.
 func NewLookup(registry registry.Registry, rep metrics.CombinedReporter, logger logger.Logger) negroni.Handler {
 	return &lookupHandler{
 		registry: registry,
@@ -36,11 +39,27 @@ func NewLookup(registry registry.Registry, rep metrics.CombinedReporter, logger
 }
 
 func (l *lookupHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-	pool := l.lookup(r)
-	if pool == nil {
-		l.handleMissingRoute(rw, r)
-		return
+	var pool *route.Pool
+	if appInstanceHeader := r.Header.Get(router_http.CfAppInstance); appInstanceHeader != "" {
+		appID, appIndex, err := validateCfAppInstance(appInstanceHeader)
+		if err != nil {
+			l.handleInvalidAppInstance(rw, err)
+			return
+		}
+
+		pool = l.registry.LookupWithInstance(l.uri(r), appID, appIndex)
+		if pool == nil {
+			l.handleMissingInstance(rw, r, appID, appIndex)
+			return
+		}
+	} else {
+		pool = l.registry.Lookup(l.uri(r))
+		if pool == nil {
+			l.handleMissingRoute(rw, r)
+			return
+		}
 	}
+
 	requestInfo, err := ContextRequestInfo(r)
 	if err != nil {
 		l.logger.Fatal("request-info-err", zap.Error(err))
@@ -64,26 +83,40 @@ func (l *lookupHandler) handleMissingRoute(rw http.ResponseWriter, r *http.Reque
 	)
 }
 
-func (l *lookupHandler) lookup(r *http.Request) *route.Pool {
-	requestPath := r.URL.EscapedPath()
+func (l *lookupHandler) handleMissingInstance(rw http.ResponseWriter, r *http.Request, appID, appIndex string) {
+	l.reporter.CaptureBadRequest()
+	l.logger.Info("unknown-instance", zap.String("app_id", appID), zap.String("app_index", appIndex))
 
-	uri := route.Uri(hostWithoutPort(r.Host) + requestPath)
-	appInstanceHeader := r.Header.Get(router_http.CfAppInstance)
+	rw.Header().Set("X-Cf-RouterError", "unknown_route")
 
-	if appInstanceHeader != "" {
-		appID, appIndex, err := validateCfAppInstance(appInstanceHeader)
+	writeStatus(
+		rw,
+		http.StatusNotFound,
+		fmt.Sprintf("Requested instance ('%s') with guid ('%s') does not exist for route ('%s').", appIndex, appID, r.Host),
+		l.logger,
+	)
+}
 
-		if err != nil {
-			l.logger.Error("invalid-app-instance-header", zap.Error(err))
-			return nil
-		}
+func (l *lookupHandler) handleInvalidAppInstance(rw http.ResponseWriter, err error) {
+	l.reporter.CaptureBadRequest()
+	l.logger.Error("invalid-app-instance-header", zap.Error(err))
 
-		return l.registry.LookupWithInstance(uri, appID, appIndex)
-	}
+	rw.Header().Set("X-Cf-RouterError", "invalid_cf_app_instance_header")
+
+	writeStatus(
+		rw,
+		http.StatusBadRequest,
+		fmt.Sprintf("Invalid %s header.", CfAppInstance),
+		l.logger,
+	)
+}
 
-	return l.registry.Lookup(uri)
+func (l *lookupHandler) uri(r *http.Request) route.Uri {
+	return route.Uri(hostWithoutPort(r.Host) + r.URL.EscapedPath())
 }
 
+// validateCfAppInstance splits the X-CF-APP-INSTANCE header, of the form
+// <app-guid>:<index>, into the app guid and the index of the instance.
 func validateCfAppInstance(appInstanceHeader string) (string, string, error) {
 	appDetails := strings.Split(appInstanceHeader, ":")
 	if len(appDetails) != 2 {
@@ -94,5 +127,9 @@ func validateCfAppInstance(appInstanceHeader string) (string, string, error) {
 		return "", "", fmt.Errorf("Incorrect %s header : %s", CfAppInstance, appInstanceHeader)
 	}
 
+	if index, err := strconv.Atoi(appDetails[1]); err != nil || index < 0 {
+		return "", "", fmt.Errorf("Incorrect %s header : %s", CfAppInstance, appInstanceHeader)
+	}
+
 	return appDetails[0], appDetails[1], nil
 }
@@ -94,7 +94,7 @@ var _ = Describe("Lookup", func() {
 
 		Context("when a specific instance is requested", func() {
 			BeforeEach(func() {
-				req.Header.Add("X-CF-App-Instance", "app-guid:instance-id")
+				req.Header.Add("X-CF-App-Instance", "app-guid:1")
 
 				reg.LookupWithInstanceReturns(pool)
 			})
@@ -105,7 +105,25 @@ var _ = Describe("Lookup", func() {
 
 				Expect(uri.String()).To(Equal("example.com"))
 				Expect(appGuid).To(Equal("app-guid"))
-				Expect(appIndex).To(Equal("instance-id"))
+				Expect(appIndex).To(Equal("1"))
+			})
+
+			It("calls next with the pool of the instance", func() {
+				Expect(nextCalled).To(BeTrue())
+				Expect(reg.LookupCallCount()).To(Equal(0))
+			})
+
+			Context("when the instance does not exist", func() {
+				BeforeEach(func() {
+					reg.LookupWithInstanceReturns(nil)
+				})
+
+				It("responds with 404", func() {
+					Expect(nextCalled).To(BeFalse())
+					Expect(resp.Code).To(Equal(http.StatusNotFound))
+					Expect(resp.Header().Get("X-Cf-RouterError")).To(Equal("unknown_route"))
+					Expect(resp.Body.String()).To(ContainSubstring("Requested instance ('1') with guid ('app-guid') does not exist for route ('example.com')"))
+				})
 			})
 		})
 
@@ -120,9 +138,10 @@ var _ = Describe("Lookup", func() {
 				Expect(reg.LookupWithInstanceCallCount()).To(Equal(0))
 			})
 
-			It("responds with 404", func() {
+			It("responds with 400", func() {
 				Expect(nextCalled).To(BeFalse())
-				Expect(resp.Code).To(Equal(http.StatusNotFound))
+				Expect(resp.Code).To(Equal(http.StatusBadRequest))
+				Expect(resp.Header().Get("X-Cf-RouterError")).To(Equal("invalid_cf_app_instance_header"))
 			})
 		})
 
@@ -136,9 +155,10 @@ var _ = Describe("Lookup", func() {
 				Expect(reg.LookupWithInstanceCallCount()).To(Equal(0))
 			})
 
-			It("responds with 404", func() {
+			It("responds with 400", func() {
 				Expect(nextCalled).To(BeFalse())
-				Expect(resp.Code).To(Equal(http.StatusNotFound))
+				Expect(resp.Code).To(Equal(http.StatusBadRequest))
+				Expect(resp.Header().Get("X-Cf-RouterError")).To(Equal("invalid_cf_app_instance_header"))
 			})
 		})
 
@@ -152,9 +172,26 @@ var _ = Describe("Lookup", func() {
 				Expect(reg.LookupWithInstanceCallCount()).To(Equal(0))
 			})
 
-			It("responds with 404", func() {
+			It("responds with 400", func() {
+				Expect(nextCalled).To(BeFalse())
+				Expect(resp.Code).To(Equal(http.StatusBadRequest))
+				Expect(resp.Header().Get("X-Cf-RouterError")).To(Equal("invalid_cf_app_instance_header"))
+			})
+		})
+
+		Context("when the instance index is not a number", func() {
+			BeforeEach(func() {
+				req.Header.Add("X-CF-App-Instance", "app-guid:instance-id")
+				reg.LookupWithInstanceReturns(pool)
+			})
+			It("does not lookup the instance", func() {
+				Expect(reg.LookupWithInstanceCallCount()).To(Equal(0))
+			})
+
+			It("responds with 400", func() {
 				Expect(nextCalled).To(BeFalse())
-				Expect(resp.Code).To(Equal(http.StatusNotFound))
+				Expect(resp.Code).To(Equal(http.StatusBadRequest))
+				Expect(resp.Header().Get("X-Cf-RouterError")).To(Equal("invalid_cf_app_instance_header"))
 			})
 		})
 
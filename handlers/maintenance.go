@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"code.cloudfoundry.org/gorouter/logger"
+	"github.com/uber-go/zap"
+	"github.com/urfave/negroni"
+)
+
+type maintenance struct {
+	logger logger.Logger
+}
+
+// NewMaintenance creates a handler that responds with the maintenance
+// response of routes that are in maintenance instead of proxying their
+// requests. It must run after the route of the request has been looked up.
+func NewMaintenance(logger logger.Logger) negroni.Handler {
+	return &maintenance{logger: logger}
+}
+
+func (m *maintenance) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	reqInfo, err := ContextRequestInfo(r)
+	if err != nil {
+		m.logger.Fatal("request-info-err", zap.Error(err))
+		return
+	}
+	if reqInfo.RoutePool == nil {
+		next(rw, r)
+		return
+	}
+
+	mt := reqInfo.RoutePool.Maintenance()
+	if mt == nil {
+		next(rw, r)
+		return
+	}
+
+	status := mt.Status
+	if status == 0 {
+		status = http.StatusServiceUnavailable
+	}
+	contentType := mt.ContentType
+	if contentType == "" {
+		contentType = "text/plain; charset=utf-8"
+	}
+	body := mt.Body
+	if body == "" {
+		body = fmt.Sprintf("Requested route ('%s') is in maintenance.\n", hostWithoutPort(r.Host))
+	}
+
+	rw.Header().Set("Content-Type", contentType)
+	rw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if mt.RetryAfterSeconds > 0 {
+		rw.Header().Set("Retry-After", strconv.Itoa(mt.RetryAfterSeconds))
+	}
+	rw.Header().Set("X-Cf-RouterError", "route_in_maintenance")
+	rw.WriteHeader(status)
+	rw.Write([]byte(body))
+}
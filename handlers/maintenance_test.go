@@ -0,0 +1,105 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/handlers"
+	logger_fakes "code.cloudfoundry.org/gorouter/logger/fakes"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/routing-api/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("Maintenance", func() {
+	var (
+		handler    *negroni.Negroni
+		pool       *route.Pool
+		endpoint   *route.Endpoint
+		req        *http.Request
+		resp       *httptest.ResponseRecorder
+		nextCalled bool
+	)
+
+	BeforeEach(func() {
+		nextCalled = false
+		pool = route.NewPool(2*time.Minute, "/")
+		endpoint = route.NewEndpoint("app", "1.2.3.4", 5678, "", "", nil, -1, "", models.ModificationTag{}, "")
+		pool.Put(endpoint)
+
+		handler = negroni.New()
+		handler.Use(handlers.NewRequestInfo())
+		handler.UseFunc(func(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+			reqInfo, err := handlers.ContextRequestInfo(req)
+			Expect(err).ToNot(HaveOccurred())
+			reqInfo.RoutePool = pool
+			next(rw, req)
+		})
+		handler.Use(handlers.NewMaintenance(new(logger_fakes.FakeLogger)))
+		handler.UseHandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			nextCalled = true
+			rw.WriteHeader(http.StatusOK)
+		})
+
+		req = test_util.NewRequest("GET", "example.com:8080", "/", nil)
+		resp = httptest.NewRecorder()
+	})
+
+	JustBeforeEach(func() {
+		handler.ServeHTTP(resp, req)
+	})
+
+	It("proxies requests for routes that are not in maintenance", func() {
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(nextCalled).To(BeTrue())
+	})
+
+	Context("when the route is in maintenance", func() {
+		BeforeEach(func() {
+			pool.SetMaintenance(&route.Maintenance{})
+		})
+
+		It("responds with 503 and a default body", func() {
+			Expect(nextCalled).To(BeFalse())
+			Expect(resp.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(resp.Header().Get("Content-Type")).To(Equal("text/plain; charset=utf-8"))
+			Expect(resp.Header().Get("X-Cf-RouterError")).To(Equal("route_in_maintenance"))
+			Expect(resp.Header().Get("Retry-After")).To(BeEmpty())
+			Expect(resp.Body.String()).To(Equal("Requested route ('example.com') is in maintenance.\n"))
+		})
+	})
+
+	Context("when the endpoint is registered with a maintenance response", func() {
+		BeforeEach(func() {
+			endpoint.Maintenance = &route.Maintenance{
+				Status:            http.StatusOK,
+				ContentType:       "text/html",
+				Body:              "<h1>Back soon</h1>",
+				RetryAfterSeconds: 600,
+			}
+		})
+
+		It("responds with the configured response", func() {
+			Expect(nextCalled).To(BeFalse())
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(resp.Header().Get("Content-Type")).To(Equal("text/html"))
+			Expect(resp.Header().Get("Retry-After")).To(Equal("600"))
+			Expect(resp.Body.String()).To(Equal("<h1>Back soon</h1>"))
+		})
+
+		Context("when the route is in maintenance", func() {
+			BeforeEach(func() {
+				pool.SetMaintenance(&route.Maintenance{Body: "admin"})
+			})
+
+			It("prefers the maintenance response set for the route", func() {
+				Expect(resp.Body.String()).To(Equal("admin"))
+			})
+		})
+	})
+})
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/proxy/utils"
+	"code.cloudfoundry.org/gorouter/registry"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/routeservice"
+	"github.com/uber-go/zap"
+	"github.com/urfave/negroni"
+)
+
+// MirroredRequestHeader is set on the copies of requests sent to mirrors.
+const MirroredRequestHeader = "X-Cf-Mirrored"
+
+var errMirrorUnavailable = errors.New("mirror route has no available endpoints")
+
+type mirror struct {
+	registry    registry.Registry
+	config      config.MirroringConfig
+	loadBalance string
+	tlsConfig   *tls.Config
+	client      *http.Client
+	inFlight    int64
+	logger      logger.Logger
+}
+
+// NewMirror creates a handler that copies requests for routes with a mirror
+// to an endpoint of the mirror route. Copies are sent asynchronously and their
+// responses are discarded. It must run after the route of the request has
+// been looked up.
+func NewMirror(
+	registry registry.Registry,
+	cfg config.MirroringConfig,
+	loadBalance string,
+	tlsConfig *tls.Config,
+	logger logger.Logger,
+) negroni.Handler {
+	return &mirror{
+		registry:    registry,
+		config:      cfg,
+		loadBalance: loadBalance,
+		tlsConfig:   tlsConfig,
+		client:      newMirrorClient(cfg, nil),
+		logger:      logger,
+	}
+}
+
+func (m *mirror) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	reqInfo, err := ContextRequestInfo(r)
+	if err != nil {
+		m.logger.Fatal("request-info-err", zap.Error(err))
+		return
+	}
+
+	if reqInfo.RoutePool != nil {
+		if mirror := reqInfo.RoutePool.Mirror(); mirror != nil && m.shouldMirror(r, reqInfo.RoutePool, mirror) {
+			m.mirror(r, mirror)
+		}
+	}
+	next(rw, r)
+}
+
+func (m *mirror) shouldMirror(r *http.Request, pool *route.Pool, mirror *route.Mirror) bool {
+	// requests returning from a route service were mirrored on their way to
+	// it, and upgraded connections cannot be copied
+	if hasBeenToRouteService(pool.RouteServiceUrl(), r.Header.Get(routeservice.RouteServiceSignature)) ||
+		r.Header.Get("Upgrade") != "" {
+		return false
+	}
+	// bodies of unknown length would have to be read in full before the
+	// request is proxied
+	if r.ContentLength < 0 || r.ContentLength > m.config.MaxBodySizeBytes {
+		return false
+	}
+	return mirror.Percentage == nil || rand.Float64()*100 < *mirror.Percentage
+}
+
+// mirror reads the body of the request, so that it can be sent to both the
+// route and the mirror, and sends the copy.
+func (m *mirror) mirror(r *http.Request, mirror *route.Mirror) {
+	if atomic.AddInt64(&m.inFlight, 1) > int64(m.config.MaxConcurrent) {
+		atomic.AddInt64(&m.inFlight, -1)
+		m.logger.Debug("mirror-limit-reached", zap.String("mirror", mirror.Uri.String()))
+		return
+	}
+
+	var body []byte
+	if r.ContentLength > 0 {
+		var err error
+		body, err = ioutil.ReadAll(io.LimitReader(r.Body, r.ContentLength))
+		// the request is proxied with the part of the body that was read
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		if err != nil {
+			atomic.AddInt64(&m.inFlight, -1)
+			m.logger.Debug("mirror-read-body-failed", zap.Error(err))
+			return
+		}
+	}
+
+	header := http.Header{}
+	for name, values := range r.Header {
+		header[name] = append([]string(nil), values...)
+	}
+	header.Set(MirroredRequestHeader, "true")
+
+	requestURI := r.RequestURI
+	if requestURI == "" {
+		requestURI = r.URL.RequestURI()
+	}
+
+	go func() {
+		defer atomic.AddInt64(&m.inFlight, -1)
+
+		err := m.send(r.Method, requestURI, header, body, mirror)
+		if err != nil {
+			m.logger.Debug("mirror-failed", zap.String("mirror", mirror.Uri.String()), zap.Error(err))
+		}
+	}()
+}
+
+func (m *mirror) send(method, requestURI string, header http.Header, body []byte, mirror *route.Mirror) error {
+	pool := m.registry.Lookup(mirror.Uri)
+	if pool == nil {
+		return errMirrorUnavailable
+	}
+	endpoint := pool.Endpoints(m.loadBalance, "", "").Next()
+	// HTTP/2 endpoints may not accept HTTP/1.1 requests
+	if endpoint == nil || endpoint.IsHTTP2() {
+		return errMirrorUnavailable
+	}
+
+	client := m.client
+	scheme := "http"
+	if endpoint.UseTLS {
+		tlsConfig := &tls.Config{}
+		if m.tlsConfig != nil {
+			tlsConfig = m.tlsConfig.Clone()
+		}
+		tlsConfig.ServerName = endpoint.ServerCertDomainSAN
+		client = newMirrorClient(m.config, tlsConfig)
+		scheme = "https"
+	}
+
+	// the path of unix sockets is not a valid host
+	req, err := http.NewRequest(method, scheme+"://localhost"+requestURI, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.URL.Host = endpoint.CanonicalAddr()
+	req.Header = header
+	req.Host = strings.SplitN(mirror.Uri.String(), "/", 2)[0]
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+	return nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func newMirrorClient(cfg config.MirroringConfig, tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return utils.DialEndpoint(network, addr, cfg.Timeout)
+			},
+			// TLS clients are created for each copy
+			DisableKeepAlives: tlsConfig != nil,
+			TLSClientConfig:   tlsConfig,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
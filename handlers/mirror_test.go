@@ -0,0 +1,148 @@
+package handlers_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/handlers"
+	logger_fakes "code.cloudfoundry.org/gorouter/logger/fakes"
+	fakeRegistry "code.cloudfoundry.org/gorouter/registry/fakes"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/routing-api/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("Mirror", func() {
+	type mirroredRequest struct {
+		method, host, requestURI, body string
+		header                         http.Header
+	}
+
+	var (
+		cfg       config.MirroringConfig
+		reg       *fakeRegistry.FakeRegistry
+		pool      *route.Pool
+		mirror    *httptest.Server
+		mirrored  chan mirroredRequest
+		req       *http.Request
+		nextBody  string
+		routeEndp *route.Endpoint
+	)
+
+	BeforeEach(func() {
+		mirrored = make(chan mirroredRequest, 10)
+		mirror = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			Expect(err).ToNot(HaveOccurred())
+			mirrored <- mirroredRequest{r.Method, r.Host, r.RequestURI, string(body), r.Header}
+		}))
+
+		host, portStr, err := net.SplitHostPort(strings.TrimPrefix(mirror.URL, "http://"))
+		Expect(err).ToNot(HaveOccurred())
+		port, err := strconv.Atoi(portStr)
+		Expect(err).ToNot(HaveOccurred())
+
+		mirrorPool := route.NewPool(2*time.Minute, "")
+		mirrorPool.Put(route.NewEndpoint("", host, uint16(port), "", "", nil, -1, "", models.ModificationTag{}, ""))
+		reg = &fakeRegistry.FakeRegistry{}
+		reg.LookupReturns(mirrorPool)
+
+		routeEndp = route.NewEndpoint("", "1.2.3.4", 80, "", "", nil, -1, "", models.ModificationTag{}, "")
+		routeEndp.Mirror = &route.Mirror{Uri: "mirror.example.com"}
+		pool = route.NewPool(2*time.Minute, "")
+		pool.Put(routeEndp)
+
+		cfg = config.MirroringConfig{
+			MaxBodySizeBytes: 1024,
+			MaxConcurrent:    10,
+			Timeout:          time.Second,
+		}
+
+		req = test_util.NewRequest("POST", "example.com", "/orders?id=1", strings.NewReader("some body"))
+		req.Header.Set("X-Foo", "bar")
+		nextBody = ""
+	})
+
+	AfterEach(func() {
+		mirror.Close()
+	})
+
+	JustBeforeEach(func() {
+		handler := negroni.New()
+		handler.Use(handlers.NewRequestInfo())
+		handler.UseFunc(func(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+			reqInfo, err := handlers.ContextRequestInfo(req)
+			Expect(err).ToNot(HaveOccurred())
+			reqInfo.RoutePool = pool
+			next(rw, req)
+		})
+		handler.Use(handlers.NewMirror(reg, cfg, config.LOAD_BALANCE_RR, nil, new(logger_fakes.FakeLogger)))
+		handler.UseHandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			body, err := ioutil.ReadAll(req.Body)
+			Expect(err).ToNot(HaveOccurred())
+			nextBody = string(body)
+		})
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	It("sends a copy of the request to the mirror route", func() {
+		var m mirroredRequest
+		Eventually(mirrored).Should(Receive(&m))
+		Expect(m.method).To(Equal("POST"))
+		Expect(m.host).To(Equal("mirror.example.com"))
+		Expect(m.requestURI).To(Equal("/orders?id=1"))
+		Expect(m.body).To(Equal("some body"))
+		Expect(m.header.Get("X-Foo")).To(Equal("bar"))
+		Expect(m.header.Get(handlers.MirroredRequestHeader)).To(Equal("true"))
+
+		Expect(reg.LookupArgsForCall(0)).To(Equal(route.Uri("mirror.example.com")))
+	})
+
+	It("proxies the request with its body", func() {
+		Expect(nextBody).To(Equal("some body"))
+	})
+
+	Context("when the body is larger than the maximum size", func() {
+		BeforeEach(func() {
+			cfg.MaxBodySizeBytes = 4
+		})
+
+		It("does not mirror the request", func() {
+			Consistently(mirrored).ShouldNot(Receive())
+			Expect(nextBody).To(Equal("some body"))
+		})
+	})
+
+	Context("when the mirrored percentage is 0", func() {
+		BeforeEach(func() {
+			percentage := 0.0
+			routeEndp.Mirror.Percentage = &percentage
+		})
+
+		It("does not mirror the request", func() {
+			Consistently(mirrored).ShouldNot(Receive())
+		})
+	})
+
+	Context("when the maximum number of copies are in flight", func() {
+		BeforeEach(func() {
+			cfg.MaxConcurrent = 0
+		})
+
+		It("does not mirror the request", func() {
+			Consistently(mirrored).ShouldNot(Receive())
+			Expect(nextBody).To(Equal("some body"))
+		})
+	})
+})
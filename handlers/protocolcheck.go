@@ -56,5 +56,9 @@ func (p *protocolCheck) hijack(rw http.ResponseWriter) (net.Conn, *bufio.ReadWri
 }
 
 func isProtocolSupported(request *http.Request) bool {
+	if request.ProtoMajor == 2 {
+		// HTTP/2 is only served when negotiated via ALPN on the TLS listener
+		return request.TLS != nil && request.TLS.NegotiatedProtocol == "h2"
+	}
 	return request.ProtoMajor == 1 && (request.ProtoMinor == 0 || request.ProtoMinor == 1)
 }
@@ -2,8 +2,10 @@ package handlers_test
 
 import (
 	"bufio"
+	"crypto/tls"
 	"net"
 	"net/http"
+	"net/http/httptest"
 
 	"code.cloudfoundry.org/gorouter/handlers"
 	"code.cloudfoundry.org/gorouter/logger"
@@ -105,4 +107,20 @@ var _ = Describe("Protocolcheck", func() {
 			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
 		})
 	})
+
+	Context("http2 negotiated over TLS", func() {
+		It("passes the request through", func() {
+			req := test_util.NewRequest("GET", "example.com", "/", nil)
+			req.Proto = "HTTP/2.0"
+			req.ProtoMajor = 2
+			req.ProtoMinor = 0
+			req.TLS = &tls.ConnectionState{NegotiatedProtocol: "h2"}
+
+			resp := httptest.NewRecorder()
+			n.ServeHTTP(resp, req)
+
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(nextCalled).To(BeTrue())
+		})
+	})
 })
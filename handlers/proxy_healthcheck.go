@@ -9,18 +9,21 @@ import (
 )
 
 type proxyHealthcheck struct {
-	userAgent   string
+	userAgents  []string
+	path        string
 	heartbeatOK *int32
 	logger      logger.Logger
 }
 
 // NewHealthcheck creates a handler that responds to healthcheck requests.
-// If userAgent is set to a non-empty string, it will use that user agent to
-// differentiate between healthcheck requests and non-healthcheck requests.
-// Otherwise, it will treat all requests as healthcheck requests.
-func NewProxyHealthcheck(userAgent string, heartbeatOK *int32, logger logger.Logger) negroni.Handler {
+// Requests whose User-Agent is one of userAgents are healthcheck requests; an
+// empty user agent matches requests without one. When path is not empty,
+// requests for the path are healthcheck requests too, whatever their
+// User-Agent.
+func NewProxyHealthcheck(userAgents []string, path string, heartbeatOK *int32, logger logger.Logger) negroni.Handler {
 	return &proxyHealthcheck{
-		userAgent:   userAgent,
+		userAgents:  userAgents,
+		path:        path,
 		heartbeatOK: heartbeatOK,
 		logger:      logger,
 	}
@@ -28,7 +31,7 @@ func NewProxyHealthcheck(userAgent string, heartbeatOK *int32, logger logger.Log
 
 func (h *proxyHealthcheck) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 	// If reqeust is not intended for healthcheck
-	if r.Header.Get("User-Agent") != h.userAgent {
+	if !h.isHealthcheck(r) {
 		next(rw, r)
 		return
 	}
@@ -47,3 +50,16 @@ func (h *proxyHealthcheck) ServeHTTP(rw http.ResponseWriter, r *http.Request, ne
 	rw.Write([]byte("ok\n"))
 	r.Close = true
 }
+
+func (h *proxyHealthcheck) isHealthcheck(r *http.Request) bool {
+	if h.path != "" && r.URL.Path == h.path {
+		return true
+	}
+	userAgent := r.Header.Get("User-Agent")
+	for _, ua := range h.userAgents {
+		if userAgent == ua {
+			return true
+		}
+	}
+	return false
+}
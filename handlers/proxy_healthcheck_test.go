@@ -29,7 +29,7 @@ var _ = Describe("Proxy Healthcheck", func() {
 		resp = httptest.NewRecorder()
 		heartbeatOK = 1
 
-		handler = handlers.NewProxyHealthcheck("HTTP-Monitor/1.1", &heartbeatOK, logger)
+		handler = handlers.NewProxyHealthcheck([]string{"HTTP-Monitor/1.1", "ELB-HealthChecker/1.0"}, "", &heartbeatOK, logger)
 		nextHandler = http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
 			nextCalled = true
 		})
@@ -109,4 +109,42 @@ var _ = Describe("Proxy Healthcheck", func() {
 			Expect(nextCalled).To(BeTrue())
 		})
 	})
+
+	Context("when User-Agent is set to another healthcheck User-Agent", func() {
+		BeforeEach(func() {
+			req.Header.Set("User-Agent", "ELB-HealthChecker/1.0")
+		})
+
+		It("responds with 200 OK", func() {
+			handler.ServeHTTP(resp, req, nextHandler)
+			Expect(resp.Code).To(Equal(200))
+			Expect(nextCalled).To(BeFalse())
+		})
+	})
+
+	Context("when a healthcheck path is set", func() {
+		BeforeEach(func() {
+			handler = handlers.NewProxyHealthcheck([]string{"HTTP-Monitor/1.1"}, "/router-health", &heartbeatOK, logger)
+			req.Header.Set("User-Agent", "GoogleHC/1.0")
+		})
+
+		It("responds to requests for the path", func() {
+			req.URL.Path = "/router-health"
+			handler.ServeHTTP(resp, req, nextHandler)
+			Expect(resp.Code).To(Equal(200))
+			Expect(nextCalled).To(BeFalse())
+		})
+
+		It("responds with a 503 Service Unavailable to requests for the path while draining", func() {
+			heartbeatOK = 0
+			req.URL.Path = "/router-health"
+			handler.ServeHTTP(resp, req, nextHandler)
+			Expect(resp.Code).To(Equal(503))
+		})
+
+		It("forwards requests for other paths to the next handler", func() {
+			handler.ServeHTTP(resp, req, nextHandler)
+			Expect(nextCalled).To(BeTrue())
+		})
+	})
 })
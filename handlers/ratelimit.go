@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/routeservice"
+	"github.com/uber-go/zap"
+	"github.com/urfave/negroni"
+)
+
+// rateLimitSweepInterval is how often buckets that have refilled completely,
+// and so are no different from new ones, are dropped.
+const rateLimitSweepInterval = time.Minute
+
+type rateLimit struct {
+	logger logger.Logger
+	clock  clock.Clock
+	limits atomic.Value // *rateLimits
+
+	lock      sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type rateLimits struct {
+	byClient    bool
+	trustedNets []*net.IPNet
+	limit       bucketLimit
+	routes      map[route.Uri]bucketLimit
+}
+
+type bucketLimit struct {
+	rate  float64
+	burst float64
+}
+
+type tokenBucket struct {
+	limit   bucketLimit
+	tokens  float64
+	updated time.Time
+}
+
+// NewRateLimit creates a handler that responds with 429 Too Many Requests to
+// requests exceeding the rate limit of their route. It must run after the
+// route of the request has been looked up. The limits are replaced when the
+// config is reloaded.
+func NewRateLimit(reloadable *config.ReloadableConfig, logger logger.Logger, clock clock.Clock) negroni.Handler {
+	l := &rateLimit{
+		logger:    logger,
+		clock:     clock,
+		buckets:   map[string]*tokenBucket{},
+		lastSweep: clock.Now(),
+	}
+	l.limits.Store(newRateLimits(reloadable.Get()))
+	reloadable.OnReload(func(c *config.Config) {
+		l.limits.Store(newRateLimits(c))
+	})
+	return l
+}
+
+func newRateLimits(c *config.Config) *rateLimits {
+	cfg := c.RateLimit
+	routes := make(map[route.Uri]bucketLimit, len(cfg.Routes))
+	for _, r := range cfg.Routes {
+		routes[route.Uri(r.Route).RouteKey()] = newBucketLimit(r.RequestsPerSecond, r.Burst)
+	}
+
+	return &rateLimits{
+		byClient:    cfg.Key == config.RATE_LIMIT_KEY_CLIENT_IP,
+		trustedNets: c.TrustedProxyNets,
+		limit:       newBucketLimit(cfg.RequestsPerSecond, cfg.Burst),
+		routes:      routes,
+	}
+}
+
+// newBucketLimit defaults the burst to one second of requests.
+func newBucketLimit(rate float64, burst int) bucketLimit {
+	if burst == 0 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	return bucketLimit{rate: rate, burst: float64(burst)}
+}
+
+func (l *rateLimit) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	reqInfo, err := ContextRequestInfo(r)
+	if err != nil {
+		l.logger.Fatal("request-info-err", zap.Error(err))
+		return
+	}
+	if reqInfo.RoutePool == nil {
+		next(rw, r)
+		return
+	}
+
+	// requests returning from a route service were limited on their way to it
+	if hasBeenToRouteService(reqInfo.RoutePool.RouteServiceUrl(), r.Header.Get(routeservice.RouteServiceSignature)) {
+		next(rw, r)
+		return
+	}
+
+	limits := l.limits.Load().(*rateLimits)
+	routeKey := route.Uri(hostWithoutPort(r.Host) + reqInfo.RoutePool.ContextPath()).RouteKey()
+	limit, ok := limits.routes[routeKey]
+	if !ok {
+		limit = limits.limit
+	}
+	if limit.rate <= 0 {
+		next(rw, r)
+		return
+	}
+
+	key := string(routeKey)
+	if limits.byClient {
+		// clients behind the trusted proxies cannot choose their bucket
+		key += "|" + trustedClientIP(r, limits.trustedNets).String()
+	}
+
+	wait, ok := l.take(key, limit)
+	if !ok {
+		retryAfter := strconv.Itoa(int(math.Ceil(wait.Seconds())))
+		rw.Header().Set("Retry-After", retryAfter)
+		rw.Header().Set("RateLimit-Limit", strconv.Itoa(int(limit.burst)))
+		rw.Header().Set("RateLimit-Remaining", "0")
+		rw.Header().Set("RateLimit-Reset", retryAfter)
+		rw.Header().Set("X-Cf-RouterError", "rate_limited")
+		writeStatus(
+			rw,
+			http.StatusTooManyRequests,
+			"Rate limit exceeded.",
+			l.logger,
+		)
+		return
+	}
+
+	next(rw, r)
+}
+
+// take removes a token from the bucket of the key. If the bucket is empty, it
+// returns false and how long it takes until the bucket has a token again.
+func (l *rateLimit) take(key string, limit bucketLimit) (time.Duration, bool) {
+	now := l.clock.Now()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok || b.limit != limit {
+		b = &tokenBucket{limit: limit, tokens: limit.burst, updated: now}
+		l.buckets[key] = b
+	}
+	b.refill(now)
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / limit.rate * float64(time.Second))
+		return wait, false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// sweep drops the buckets that are full. rateLimit.lock must be held.
+func (l *rateLimit) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= b.limit.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = math.Min(b.limit.burst, b.tokens+elapsed.Seconds()*b.limit.rate)
+		b.updated = now
+	}
+}
@@ -0,0 +1,229 @@
+package handlers_test
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/handlers"
+	logger_fakes "code.cloudfoundry.org/gorouter/logger/fakes"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/routeservice"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/routing-api/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("RateLimit", func() {
+	var (
+		handler     *negroni.Negroni
+		cfg         config.RateLimitConfig
+		reloadable  *config.ReloadableConfig
+		clock       *fakeclock.FakeClock
+		pool        *route.Pool
+		trustedNets []*net.IPNet
+		req         *http.Request
+		nextCalled  int
+	)
+
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		nextCalled++
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	BeforeEach(func() {
+		nextCalled = 0
+		trustedNets = nil
+		clock = fakeclock.NewFakeClock(time.Now())
+		pool = route.NewPool(2*time.Minute, "/")
+		cfg = config.RateLimitConfig{
+			RequestsPerSecond: 2,
+			Burst:             2,
+			Key:               config.RATE_LIMIT_KEY_ROUTE,
+		}
+		req = test_util.NewRequest("GET", "example.com", "/", nil)
+		req.RemoteAddr = "10.0.16.4:41234"
+	})
+
+	JustBeforeEach(func() {
+		handler = negroni.New()
+		handler.Use(handlers.NewRequestInfo())
+		handler.UseFunc(func(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+			reqInfo, err := handlers.ContextRequestInfo(req)
+			Expect(err).ToNot(HaveOccurred())
+			reqInfo.RoutePool = pool
+			next(rw, req)
+		})
+		reloadable = config.NewReloadableConfig(&config.Config{RateLimit: cfg, TrustedProxyNets: trustedNets})
+		handler.Use(handlers.NewRateLimit(reloadable, new(logger_fakes.FakeLogger), clock))
+		handler.UseHandler(nextHandler)
+	})
+
+	It("allows requests up to the burst", func() {
+		Expect(serve(handler, req).Code).To(Equal(http.StatusOK))
+		Expect(serve(handler, req).Code).To(Equal(http.StatusOK))
+		Expect(nextCalled).To(Equal(2))
+	})
+
+	It("responds with 429 and rate limit headers when the limit is exceeded", func() {
+		serve(handler, req)
+		serve(handler, req)
+
+		resp := serve(handler, req)
+		Expect(resp.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(resp.Header().Get("Retry-After")).To(Equal("1"))
+		Expect(resp.Header().Get("RateLimit-Limit")).To(Equal("2"))
+		Expect(resp.Header().Get("RateLimit-Remaining")).To(Equal("0"))
+		Expect(resp.Header().Get("RateLimit-Reset")).To(Equal("1"))
+		Expect(resp.Header().Get("X-Cf-RouterError")).To(Equal("rate_limited"))
+		Expect(resp.Body.String()).To(ContainSubstring("Rate limit exceeded."))
+		Expect(nextCalled).To(Equal(2))
+	})
+
+	It("refills the bucket over time", func() {
+		serve(handler, req)
+		serve(handler, req)
+		Expect(serve(handler, req).Code).To(Equal(http.StatusTooManyRequests))
+
+		clock.Increment(500 * time.Millisecond)
+		Expect(serve(handler, req).Code).To(Equal(http.StatusOK))
+		Expect(serve(handler, req).Code).To(Equal(http.StatusTooManyRequests))
+	})
+
+	It("limits each route separately", func() {
+		serve(handler, req)
+		serve(handler, req)
+
+		req.Host = "other.example.com"
+		Expect(serve(handler, req).Code).To(Equal(http.StatusOK))
+	})
+
+	It("ignores the port of the host", func() {
+		serve(handler, req)
+		req.Host = "example.com:8080"
+		serve(handler, req)
+
+		req.Host = "example.com"
+		Expect(serve(handler, req).Code).To(Equal(http.StatusTooManyRequests))
+	})
+
+	It("uses the limits of the reloaded config", func() {
+		serve(handler, req)
+		serve(handler, req)
+		Expect(serve(handler, req).Code).To(Equal(http.StatusTooManyRequests))
+
+		reloadable.Set(&config.Config{RateLimit: config.RateLimitConfig{
+			RequestsPerSecond: 10,
+			Burst:             10,
+			Key:               config.RATE_LIMIT_KEY_ROUTE,
+		}})
+		for i := 0; i < 10; i++ {
+			Expect(serve(handler, req).Code).To(Equal(http.StatusOK))
+		}
+		Expect(serve(handler, req).Code).To(Equal(http.StatusTooManyRequests))
+	})
+
+	Context("when keyed by client IP", func() {
+		BeforeEach(func() {
+			cfg.Key = config.RATE_LIMIT_KEY_CLIENT_IP
+		})
+
+		forwardedFor := func(clientIP string) *http.Request {
+			req.Header.Set("X-Forwarded-For", clientIP)
+			return req
+		}
+
+		It("identifies clients by the remote address without trusted proxies", func() {
+			serve(handler, forwardedFor("10.0.0.1"))
+			serve(handler, forwardedFor("10.0.0.2"))
+			Expect(serve(handler, forwardedFor("10.0.0.3")).Code).To(Equal(http.StatusTooManyRequests))
+		})
+
+		Context("with trusted proxies", func() {
+			BeforeEach(func() {
+				_, ipNet, err := net.ParseCIDR("10.0.16.0/24")
+				Expect(err).ToNot(HaveOccurred())
+				trustedNets = []*net.IPNet{ipNet}
+			})
+
+			It("limits each client of a route separately", func() {
+				serve(handler, forwardedFor("10.0.0.1"))
+				serve(handler, forwardedFor("10.0.0.1"))
+				Expect(serve(handler, forwardedFor("10.0.0.1")).Code).To(Equal(http.StatusTooManyRequests))
+
+				Expect(serve(handler, forwardedFor("10.0.0.2")).Code).To(Equal(http.StatusOK))
+			})
+
+			It("does not let clients choose their bucket with X-Forwarded-For", func() {
+				serve(handler, forwardedFor("192.168.0.1, 10.0.0.1"))
+				serve(handler, forwardedFor("192.168.0.2, 10.0.0.1"))
+				Expect(serve(handler, forwardedFor("192.168.0.3, 10.0.0.1")).Code).To(Equal(http.StatusTooManyRequests))
+			})
+		})
+	})
+
+	Context("when the route has its own limit", func() {
+		BeforeEach(func() {
+			cfg.Routes = []config.RouteRateLimitConfig{
+				{Route: "Example.com", RequestsPerSecond: 1},
+				{Route: "unlimited.example.com", RequestsPerSecond: 0},
+			}
+		})
+
+		It("uses the limit of the route", func() {
+			Expect(serve(handler, req).Code).To(Equal(http.StatusOK))
+			Expect(serve(handler, req).Code).To(Equal(http.StatusTooManyRequests))
+		})
+
+		It("does not limit routes with a limit of 0", func() {
+			req.Host = "unlimited.example.com"
+			for i := 0; i < 5; i++ {
+				Expect(serve(handler, req).Code).To(Equal(http.StatusOK))
+			}
+		})
+
+		Context("and the route has a context path", func() {
+			BeforeEach(func() {
+				pool = route.NewPool(2*time.Minute, "/api")
+				cfg.Routes = []config.RouteRateLimitConfig{{Route: "example.com/api", RequestsPerSecond: 1}}
+			})
+
+			It("uses the limit of the route", func() {
+				Expect(serve(handler, test_util.NewRequest("GET", "example.com", "/api/users", nil)).Code).To(Equal(http.StatusOK))
+				Expect(serve(handler, test_util.NewRequest("GET", "example.com", "/api/orders", nil)).Code).To(Equal(http.StatusTooManyRequests))
+			})
+		})
+	})
+
+	Context("when no limit is configured", func() {
+		BeforeEach(func() {
+			cfg = config.RateLimitConfig{Key: config.RATE_LIMIT_KEY_ROUTE}
+		})
+
+		It("does not limit requests", func() {
+			for i := 0; i < 5; i++ {
+				Expect(serve(handler, req).Code).To(Equal(http.StatusOK))
+			}
+		})
+	})
+
+	Context("when the request returns from a route service", func() {
+		BeforeEach(func() {
+			endpoint := route.NewEndpoint("", "1.2.3.4", 80, "", "", nil, -1, "https://rs.example.com", models.ModificationTag{}, "")
+			pool.Put(endpoint)
+		})
+
+		It("does not count the request again", func() {
+			serve(handler, req)
+			serve(handler, req)
+
+			req.Header.Set(routeservice.RouteServiceSignature, "some-signature")
+			Expect(serve(handler, req).Code).To(Equal(http.StatusOK))
+		})
+	})
+})
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync/atomic"
+
+	"code.cloudfoundry.org/gorouter/logger"
+	"github.com/uber-go/zap"
+)
+
+// ReadinessCheck returns why the router is not ready to receive traffic, or
+// nil when it is.
+type ReadinessCheck func() error
+
+type liveness struct{}
+
+// NewLiveness creates a handler that responds with 200 OK for as long as the
+// process serves requests.
+func NewLiveness() http.Handler {
+	return &liveness{}
+}
+
+func (l *liveness) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Cache-Control", "private, max-age=0")
+	rw.Header().Set("Expires", "0")
+	rw.WriteHeader(http.StatusOK)
+	rw.Write([]byte("ok\n"))
+	r.Close = true
+}
+
+type readiness struct {
+	heartbeatOK *int32
+	checks      map[string]ReadinessCheck
+	names       []string
+	logger      logger.Logger
+}
+
+// NewReadiness creates a handler that responds with 200 OK when the router is
+// ready to receive traffic, and with 503 Service Unavailable listing the
+// failed checks when it is not. The router is not ready while it is starting
+// or draining, or while any of the checks fails.
+func NewReadiness(heartbeatOK *int32, checks map[string]ReadinessCheck, logger logger.Logger) http.Handler {
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return &readiness{
+		heartbeatOK: heartbeatOK,
+		checks:      checks,
+		names:       names,
+		logger:      logger,
+	}
+}
+
+func (h *readiness) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Cache-Control", "private, max-age=0")
+	rw.Header().Set("Expires", "0")
+	r.Close = true
+
+	var failures []string
+	if atomic.LoadInt32(h.heartbeatOK) == 0 {
+		failures = append(failures, "heartbeat: starting or draining")
+	}
+	for _, name := range h.names {
+		if err := h.checks[name](); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", name, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		h.logger.Debug("not-ready", zap.Object("failures", failures))
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		for _, f := range failures {
+			fmt.Fprintln(rw, f)
+		}
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	rw.Write([]byte("ok\n"))
+}
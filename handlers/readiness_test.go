@@ -0,0 +1,86 @@
+package handlers_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/gorouter/handlers"
+	"code.cloudfoundry.org/gorouter/test_util"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Liveness", func() {
+	It("responds with 200 OK", func() {
+		req := test_util.NewRequest("GET", "example.com", "/health/live", nil)
+		resp := httptest.NewRecorder()
+		handlers.NewLiveness().ServeHTTP(resp, req)
+
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Body.String()).To(Equal("ok\n"))
+		Expect(resp.Header().Get("Cache-Control")).To(Equal("private, max-age=0"))
+	})
+})
+
+var _ = Describe("Readiness", func() {
+	var (
+		handler     http.Handler
+		checks      map[string]handlers.ReadinessCheck
+		natsErr     error
+		routesErr   error
+		heartbeatOK int32
+		req         *http.Request
+		resp        *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		heartbeatOK = 1
+		natsErr = nil
+		routesErr = nil
+		checks = map[string]handlers.ReadinessCheck{
+			"routes": func() error { return routesErr },
+			"nats":   func() error { return natsErr },
+		}
+
+		req = test_util.NewRequest("GET", "example.com", "/health/ready", nil)
+		resp = httptest.NewRecorder()
+	})
+
+	JustBeforeEach(func() {
+		handler = handlers.NewReadiness(&heartbeatOK, checks, test_util.NewTestZapLogger("readiness"))
+		handler.ServeHTTP(resp, req)
+	})
+
+	It("closes the connection", func() {
+		Expect(req.Close).To(BeTrue())
+	})
+
+	It("responds with 200 OK when all checks pass", func() {
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Body.String()).To(Equal("ok\n"))
+	})
+
+	Context("when checks fail", func() {
+		BeforeEach(func() {
+			natsErr = errors.New("not connected")
+			routesErr = errors.New("0 of 10 routes")
+		})
+
+		It("responds with 503 listing the failed checks in order", func() {
+			Expect(resp.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(resp.Body.String()).To(Equal("nats: not connected\nroutes: 0 of 10 routes\n"))
+		})
+	})
+
+	Context("while starting or draining", func() {
+		BeforeEach(func() {
+			heartbeatOK = 0
+		})
+
+		It("responds with 503", func() {
+			Expect(resp.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(resp.Body.String()).To(Equal("heartbeat: starting or draining\n"))
+		})
+	})
+})
@@ -2,10 +2,12 @@ package handlers
 
 import (
 	"net/http"
+	"strings"
 	"time"
 
 	"code.cloudfoundry.org/gorouter/metrics"
 	"code.cloudfoundry.org/gorouter/proxy/utils"
+	"code.cloudfoundry.org/gorouter/route"
 
 	"code.cloudfoundry.org/gorouter/logger"
 	"github.com/uber-go/zap"
@@ -52,4 +54,18 @@ func (rh *reporterHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request, ne
 		requestInfo.RouteEndpoint, proxyWriter.Status(),
 		requestInfo.StartedAt, requestInfo.StoppedAt.Sub(requestInfo.StartedAt),
 	)
+	if requestInfo.RoutePool != nil {
+		rh.reporter.CaptureRouteResponseLatency(
+			routeName(r, requestInfo.RoutePool), requestInfo.StoppedAt.Sub(requestInfo.StartedAt),
+		)
+	}
+}
+
+// routeName returns the host and context path of the route of the request.
+func routeName(r *http.Request, pool *route.Pool) string {
+	host := strings.ToLower(hostWithoutPort(r.Host))
+	if pool.ContextPath() == "/" {
+		return host
+	}
+	return host + pool.ContextPath()
 }
@@ -90,6 +90,28 @@ var _ = Describe("Reporter Handler", func() {
 		Expect(nextCalled).To(BeTrue(), "Expected the next handler to be called.")
 	})
 
+	Context("when the route pool is set", func() {
+		BeforeEach(func() {
+			req.Host = "Example.com:8080"
+			next := nextHandler
+			nextHandler = http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				reqInfo, err := handlers.ContextRequestInfo(req)
+				Expect(err).NotTo(HaveOccurred())
+				reqInfo.RoutePool = route.NewPool(0, "/api")
+				next(rw, req)
+			})
+		})
+
+		It("emits the latency of the route", func() {
+			handler.ServeHTTP(resp, req)
+
+			Expect(fakeReporter.CaptureRouteResponseLatencyCallCount()).To(Equal(1))
+			capturedRoute, latency := fakeReporter.CaptureRouteResponseLatencyArgsForCall(0)
+			Expect(capturedRoute).To(Equal("example.com/api"))
+			Expect(latency).To(BeNumerically(">", 0))
+		})
+	})
+
 	Context("when reqInfo.StoppedAt is 0", func() {
 		BeforeEach(func() {
 			nextHandler = http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
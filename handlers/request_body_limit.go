@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"code.cloudfoundry.org/gorouter/logger"
+	"github.com/uber-go/zap"
+	"github.com/urfave/negroni"
+)
+
+// ErrRequestBodyTooLarge is returned by the bodies of requests that are read
+// past their maximum size.
+var ErrRequestBodyTooLarge = errors.New("request body too large")
+
+type requestBodyLimit struct {
+	logger   logger.Logger
+	maxBytes int64
+}
+
+// NewRequestBodyLimit creates a handler that limits the size of request
+// bodies to the maximum of their route, of their virtual host or else
+// maxBytes, when it is greater than zero. Requests whose Content-Length is
+// larger are answered with 413 Request Entity Too Large, and the bodies of
+// others fail with ErrRequestBodyTooLarge when more is read. It must run after
+// the route of the request has been looked up.
+func NewRequestBodyLimit(maxBytes int64, logger logger.Logger) negroni.Handler {
+	return &requestBodyLimit{
+		logger:   logger,
+		maxBytes: maxBytes,
+	}
+}
+
+func (l *requestBodyLimit) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	reqInfo, err := ContextRequestInfo(r)
+	if err != nil {
+		l.logger.Fatal("request-info-err", zap.Error(err))
+		return
+	}
+	if reqInfo.RoutePool == nil {
+		next(rw, r)
+		return
+	}
+
+	limit := reqInfo.RoutePool.MaxRequestBodySize()
+	if limit == 0 && reqInfo.VirtualHost != nil {
+		limit = reqInfo.VirtualHost.MaxRequestBodySizeBytes
+	}
+	if limit == 0 {
+		limit = l.maxBytes
+	}
+	if limit == 0 || r.Body == nil || r.Body == http.NoBody {
+		next(rw, r)
+		return
+	}
+
+	if r.ContentLength > limit {
+		// the body is not read, so the connection cannot be reused
+		rw.Header().Set("Connection", "close")
+		rw.Header().Set("X-Cf-RouterError", "request_body_too_large")
+		writeStatus(
+			rw,
+			http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("Request body is larger than %d bytes.", limit),
+			l.logger,
+		)
+		return
+	}
+
+	r.Body = &limitedBody{ReadCloser: r.Body, remaining: limit}
+	next(rw, r)
+}
+
+// limitedBody fails with ErrRequestBodyTooLarge once more than remaining
+// bytes are read.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	exceeded  bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, ErrRequestBodyTooLarge
+	}
+	// read one byte more than remains to detect bodies that are too large
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) <= b.remaining {
+		b.remaining -= int64(n)
+		return n, err
+	}
+	n = int(b.remaining)
+	b.remaining = 0
+	b.exceeded = true
+	return n, ErrRequestBodyTooLarge
+}
@@ -0,0 +1,159 @@
+package handlers_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/handlers"
+	logger_fakes "code.cloudfoundry.org/gorouter/logger/fakes"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/routing-api/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("RequestBodyLimit", func() {
+	var (
+		handler     *negroni.Negroni
+		maxBytes    int64
+		routeMax    int64
+		virtualHost *config.VirtualHostConfig
+		req         *http.Request
+		resp        *httptest.ResponseRecorder
+		nextCalled  bool
+		nextBody    []byte
+		nextReadErr error
+		requestBody string
+		// unknownLength sends the body without a Content-Length
+		unknownLength bool
+	)
+
+	bodyOfLength := func(n int) string {
+		return strings.Repeat("a", n)
+	}
+
+	BeforeEach(func() {
+		nextCalled = false
+		nextBody = nil
+		nextReadErr = nil
+		maxBytes = 10
+		routeMax = 0
+		virtualHost = nil
+		requestBody = bodyOfLength(10)
+		unknownLength = false
+		resp = httptest.NewRecorder()
+	})
+
+	JustBeforeEach(func() {
+		req = test_util.NewRequest("POST", "example.com", "/", strings.NewReader(requestBody))
+		if unknownLength {
+			req.ContentLength = -1
+		}
+
+		pool := route.NewPool(2*time.Minute, "/")
+		endpoint := route.NewEndpoint("app-guid", "10.0.16.4", 8080, "", "", nil, -1, "", models.ModificationTag{}, "")
+		endpoint.MaxRequestBodySize = routeMax
+		pool.Put(endpoint)
+
+		handler = negroni.New()
+		handler.Use(handlers.NewRequestInfo())
+		handler.UseFunc(func(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+			reqInfo, err := handlers.ContextRequestInfo(req)
+			Expect(err).ToNot(HaveOccurred())
+			reqInfo.RoutePool = pool
+			reqInfo.VirtualHost = virtualHost
+			next(rw, req)
+		})
+		handler.Use(handlers.NewRequestBodyLimit(maxBytes, new(logger_fakes.FakeLogger)))
+		handler.UseHandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			nextCalled = true
+			nextBody, nextReadErr = ioutil.ReadAll(req.Body)
+			rw.WriteHeader(http.StatusOK)
+		})
+		handler.ServeHTTP(resp, req)
+	})
+
+	It("proxies requests with bodies of the maximum size", func() {
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(nextReadErr).ToNot(HaveOccurred())
+		Expect(string(nextBody)).To(Equal(requestBody))
+	})
+
+	Context("when the Content-Length is larger than the maximum", func() {
+		BeforeEach(func() {
+			requestBody = bodyOfLength(11)
+		})
+
+		It("responds with 413 and closes the connection", func() {
+			Expect(resp.Code).To(Equal(http.StatusRequestEntityTooLarge))
+			Expect(resp.Header().Get("Connection")).To(Equal("close"))
+			Expect(resp.Header().Get("X-Cf-RouterError")).To(Equal("request_body_too_large"))
+			Expect(nextCalled).To(BeFalse())
+		})
+	})
+
+	Context("when a body of unknown length is larger than the maximum", func() {
+		BeforeEach(func() {
+			requestBody = bodyOfLength(11)
+			unknownLength = true
+		})
+
+		It("fails reading the body past the maximum", func() {
+			Expect(nextCalled).To(BeTrue())
+			Expect(nextReadErr).To(Equal(handlers.ErrRequestBodyTooLarge))
+			Expect(nextBody).To(HaveLen(10))
+		})
+	})
+
+	Context("when the virtual host has a maximum", func() {
+		BeforeEach(func() {
+			virtualHost = &config.VirtualHostConfig{Domain: "example.com", MaxRequestBodySizeBytes: 20}
+			requestBody = bodyOfLength(20)
+		})
+
+		It("uses the maximum of the virtual host", func() {
+			Expect(resp.Code).To(Equal(http.StatusOK))
+		})
+
+		Context("and the route has a maximum too", func() {
+			BeforeEach(func() {
+				routeMax = 15
+			})
+
+			It("uses the maximum of the route", func() {
+				Expect(resp.Code).To(Equal(http.StatusRequestEntityTooLarge))
+			})
+		})
+	})
+
+	Context("when the route has a maximum", func() {
+		BeforeEach(func() {
+			routeMax = 20
+			requestBody = bodyOfLength(20)
+		})
+
+		It("uses the maximum of the route", func() {
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(nextReadErr).ToNot(HaveOccurred())
+		})
+	})
+
+	Context("without a maximum", func() {
+		BeforeEach(func() {
+			maxBytes = 0
+			requestBody = bodyOfLength(1024)
+		})
+
+		It("does not limit the body", func() {
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(nextBody).To(HaveLen(1024))
+		})
+	})
+})
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/route"
+	"github.com/uber-go/zap"
+	"github.com/urfave/negroni"
+)
+
+type requestBuffering struct {
+	logger   logger.Logger
+	enabled  bool
+	maxBytes int64
+}
+
+// NewRequestBuffering creates a handler that reads the bodies of requests
+// into memory before they are passed on, so that connections to endpoints
+// are only opened once slow clients have finished uploading. Requests for
+// routes registered with request_buffering: buffer are buffered, those for
+// routes registered with request_buffering: stream are not, and the others
+// are buffered when buffering is enabled. Bodies of unknown length are
+// buffered up to the maximum size and the rest is streamed; requests with a
+// larger Content-Length are streamed. It must run after the route of the
+// request has been looked up and its body size has been limited.
+func NewRequestBuffering(cfg config.RequestBufferingConfig, logger logger.Logger) negroni.Handler {
+	return &requestBuffering{
+		logger:   logger,
+		enabled:  cfg.Enabled,
+		maxBytes: cfg.MaxSizeBytes,
+	}
+}
+
+func (b *requestBuffering) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	reqInfo, err := ContextRequestInfo(r)
+	if err != nil {
+		b.logger.Fatal("request-info-err", zap.Error(err))
+		return
+	}
+	if !b.buffers(reqInfo.RoutePool) || r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 || r.ContentLength > b.maxBytes {
+		next(rw, r)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	n, err := buf.ReadFrom(io.LimitReader(r.Body, b.maxBytes))
+	if err == ErrRequestBodyTooLarge {
+		rw.Header().Set("Connection", "close")
+		rw.Header().Set("X-Cf-RouterError", "request_body_too_large")
+		writeStatus(rw, http.StatusRequestEntityTooLarge, "Request body is larger than the route allows.", b.logger)
+		return
+	}
+	if err != nil {
+		rw.Header().Set("Connection", "close")
+		writeStatus(rw, http.StatusBadRequest, "Failed to read the request body.", b.logger)
+		return
+	}
+
+	if n < b.maxBytes || r.ContentLength == b.maxBytes {
+		// the whole body is buffered, so endpoints are sent its length
+		r.Body = ioutil.NopCloser(buf)
+		r.ContentLength = n
+		r.TransferEncoding = nil
+	} else {
+		r.Body = &bufferedBody{Reader: io.MultiReader(buf, r.Body), Closer: r.Body}
+	}
+	// the client has already been told to continue by reading its body
+	r.Header.Del("Expect")
+
+	next(rw, r)
+}
+
+// buffers returns whether the bodies of requests for the route are buffered.
+func (b *requestBuffering) buffers(pool *route.Pool) bool {
+	if pool == nil {
+		return false
+	}
+	switch pool.RequestBuffering() {
+	case route.RequestBufferingBuffer:
+		return true
+	case route.RequestBufferingStream:
+		return false
+	default:
+		return b.enabled
+	}
+}
+
+// bufferedBody reads the buffered start of a request body followed by the
+// rest of it, and closes the original body.
+type bufferedBody struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,174 @@
+package handlers_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/handlers"
+	logger_fakes "code.cloudfoundry.org/gorouter/logger/fakes"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/routing-api/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("RequestBuffering", func() {
+	var (
+		handler       *negroni.Negroni
+		cfg           config.RequestBufferingConfig
+		routeMode     string
+		bodyMax       int64
+		body          *strings.Reader
+		req           *http.Request
+		resp          *httptest.ResponseRecorder
+		unknownLength bool
+		nextCalled    bool
+		unreadAtNext  int
+		nextLength    int64
+		nextBody      []byte
+		nextExpectHdr string
+	)
+
+	BeforeEach(func() {
+		cfg = config.RequestBufferingConfig{Enabled: true, MaxSizeBytes: 10}
+		routeMode = ""
+		bodyMax = 0
+		body = strings.NewReader("hello")
+		unknownLength = false
+		nextCalled = false
+		resp = httptest.NewRecorder()
+	})
+
+	JustBeforeEach(func() {
+		req = test_util.NewRequest("POST", "example.com", "/", ioutil.NopCloser(body))
+		req.ContentLength = body.Size()
+		if unknownLength {
+			req.ContentLength = -1
+		}
+		req.Header.Set("Expect", "100-continue")
+
+		pool := route.NewPool(2*time.Minute, "/")
+		endpoint := route.NewEndpoint("app-guid", "10.0.16.4", 8080, "", "", nil, -1, "", models.ModificationTag{}, "")
+		endpoint.RequestBuffering = routeMode
+		pool.Put(endpoint)
+
+		handler = negroni.New()
+		handler.Use(handlers.NewRequestInfo())
+		handler.UseFunc(func(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+			reqInfo, err := handlers.ContextRequestInfo(req)
+			Expect(err).ToNot(HaveOccurred())
+			reqInfo.RoutePool = pool
+			next(rw, req)
+		})
+		handler.Use(handlers.NewRequestBodyLimit(bodyMax, new(logger_fakes.FakeLogger)))
+		handler.Use(handlers.NewRequestBuffering(cfg, new(logger_fakes.FakeLogger)))
+		handler.UseHandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			nextCalled = true
+			unreadAtNext = body.Len()
+			nextLength = req.ContentLength
+			nextExpectHdr = req.Header.Get("Expect")
+			var err error
+			nextBody, err = ioutil.ReadAll(req.Body)
+			Expect(err).ToNot(HaveOccurred())
+			rw.WriteHeader(http.StatusOK)
+		})
+		handler.ServeHTTP(resp, req)
+	})
+
+	It("reads the whole body before passing the request on", func() {
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(unreadAtNext).To(BeZero())
+		Expect(string(nextBody)).To(Equal("hello"))
+		Expect(nextExpectHdr).To(BeEmpty())
+	})
+
+	Context("when the body is of unknown length", func() {
+		BeforeEach(func() {
+			unknownLength = true
+		})
+
+		It("passes the request on with the length of the buffered body", func() {
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(nextLength).To(Equal(int64(5)))
+			Expect(string(nextBody)).To(Equal("hello"))
+		})
+
+		Context("and larger than the maximum size", func() {
+			BeforeEach(func() {
+				body = strings.NewReader("hello, world")
+			})
+
+			It("buffers the maximum size and streams the rest", func() {
+				Expect(resp.Code).To(Equal(http.StatusOK))
+				Expect(unreadAtNext).To(Equal(2))
+				Expect(nextLength).To(Equal(int64(-1)))
+				Expect(string(nextBody)).To(Equal("hello, world"))
+			})
+		})
+
+		Context("and larger than the maximum body size", func() {
+			BeforeEach(func() {
+				bodyMax = 3
+			})
+
+			It("responds with 413", func() {
+				Expect(resp.Code).To(Equal(http.StatusRequestEntityTooLarge))
+				Expect(resp.Header().Get("X-Cf-RouterError")).To(Equal("request_body_too_large"))
+				Expect(nextCalled).To(BeFalse())
+			})
+		})
+	})
+
+	Context("when the Content-Length is larger than the maximum size", func() {
+		BeforeEach(func() {
+			body = strings.NewReader("hello, world")
+		})
+
+		It("streams the body", func() {
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(unreadAtNext).To(Equal(12))
+			Expect(nextExpectHdr).To(Equal("100-continue"))
+			Expect(string(nextBody)).To(Equal("hello, world"))
+		})
+	})
+
+	Context("when the route streams requests", func() {
+		BeforeEach(func() {
+			routeMode = route.RequestBufferingStream
+		})
+
+		It("streams the body", func() {
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(unreadAtNext).To(Equal(5))
+		})
+	})
+
+	Context("when buffering is disabled", func() {
+		BeforeEach(func() {
+			cfg.Enabled = false
+		})
+
+		It("streams the body", func() {
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(unreadAtNext).To(Equal(5))
+		})
+
+		Context("and the route buffers requests", func() {
+			BeforeEach(func() {
+				routeMode = route.RequestBufferingBuffer
+			})
+
+			It("buffers the body", func() {
+				Expect(resp.Code).To(Equal(http.StatusOK))
+				Expect(unreadAtNext).To(BeZero())
+			})
+		})
+	})
+})
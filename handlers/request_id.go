@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"net"
 	"net/http"
 
 	"code.cloudfoundry.org/gorouter/common/uuid"
+	"code.cloudfoundry.org/gorouter/config"
 	"code.cloudfoundry.org/gorouter/logger"
 	"github.com/uber-go/zap"
 	"github.com/urfave/negroni"
@@ -11,15 +13,47 @@ import (
 
 const (
 	VcapRequestIdHeader = "X-Vcap-Request-Id"
+
+	// maxRequestIdSize limits the size of the request IDs kept from trusted
+	// clients.
+	maxRequestIdSize = 256
 )
 
 type setVcapRequestIdHeader struct {
-	logger logger.Logger
+	header      string
+	generate    func() (string, error)
+	trustedNets []*net.IPNet
+	logger      logger.Logger
 }
 
+// NewsetVcapRequestIdHeader creates a handler that sets the X-Vcap-Request-Id
+// header of requests to a new uuid4.
 func NewsetVcapRequestIdHeader(logger logger.Logger) negroni.Handler {
+	return NewRequestIdHeader(config.RequestIDConfig{
+		HeaderName: VcapRequestIdHeader,
+		Format:     config.REQUEST_ID_UUID4,
+	}, logger)
+}
+
+// NewRequestIdHeader creates a handler that sets the configured header of
+// requests to a new ID of the configured format, unless the request comes
+// from a trusted client and already has an ID. When the header is not
+// X-Vcap-Request-Id, the X-Vcap-Request-Id of requests from other clients is
+// removed. The config must have been processed by config.Process.
+func NewRequestIdHeader(cfg config.RequestIDConfig, logger logger.Logger) negroni.Handler {
+	generate := uuid.GenerateUUID
+	switch cfg.Format {
+	case config.REQUEST_ID_UUID7:
+		generate = uuid.GenerateUUIDv7
+	case config.REQUEST_ID_KSUID:
+		generate = uuid.GenerateKSUID
+	}
+
 	return &setVcapRequestIdHeader{
-		logger: logger,
+		header:      cfg.HeaderName,
+		generate:    generate,
+		trustedNets: cfg.TrustedNets,
+		logger:      logger,
 	}
 }
 
@@ -27,13 +61,49 @@ func (s *setVcapRequestIdHeader) ServeHTTP(rw http.ResponseWriter, r *http.Reque
 	// The X-Vcap-Request-Id must be set before the request is passed into the
 	// dropsonde InstrumentedHandler
 
-	guid, err := uuid.GenerateUUID()
+	guid := r.Header.Get(s.header)
+	trusted := remoteIPIn(r, s.trustedNets)
+	var err error
+	if !trusted || !validRequestId(guid) {
+		guid, err = s.generate()
+	}
+	// apps must not be sent an X-Vcap-Request-Id chosen by an untrusted
+	// client when the ID is set in another header
+	if !trusted && s.header != VcapRequestIdHeader {
+		r.Header.Del(VcapRequestIdHeader)
+	}
 	if err == nil {
-		r.Header.Set(VcapRequestIdHeader, guid)
+		r.Header.Set(s.header, guid)
 		s.logger.Debug("vcap-request-id-header-set", zap.String("VcapRequestIdHeader", guid))
+		if reqInfo, infoErr := ContextRequestInfo(r); infoErr == nil {
+			reqInfo.RequestID = guid
+		}
 	} else {
 		s.logger.Error("failed-to-set-vcap-request-id-header", zap.Error(err))
 	}
 
 	next(rw, r)
 }
+
+// validRequestId returns whether the ID is a non-empty string of at most
+// maxRequestIdSize printable ASCII characters other than space.
+func validRequestId(id string) bool {
+	if id == "" || len(id) > maxRequestIdSize {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// requestId returns the ID set for the request by the request ID handler,
+// or the X-Vcap-Request-Id header when there is none.
+func requestId(r *http.Request) string {
+	if reqInfo, err := ContextRequestInfo(r); err == nil && reqInfo.RequestID != "" {
+		return reqInfo.RequestID
+	}
+	return r.Header.Get(VcapRequestIdHeader)
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 
+	"code.cloudfoundry.org/gorouter/config"
 	"code.cloudfoundry.org/gorouter/handlers"
 	"code.cloudfoundry.org/gorouter/logger"
 	"code.cloudfoundry.org/gorouter/test_util"
@@ -80,3 +81,124 @@ var _ = Describe("Set Vcap Request Id header", func() {
 		})
 	})
 })
+
+var _ = Describe("Request ID header", func() {
+	var (
+		cfg         config.RequestIDConfig
+		req         *http.Request
+		requestId   string
+		nextRequest *http.Request
+	)
+
+	BeforeEach(func() {
+		cfg = config.DefaultConfig().RequestID
+		req = test_util.NewRequest("GET", "example.com", "/", nil)
+		req.RemoteAddr = "10.0.0.1:34567"
+	})
+
+	JustBeforeEach(func() {
+		logger := test_util.NewTestZapLogger("requestIdHeader")
+		handler := negroni.New()
+		handler.Use(handlers.NewRequestInfo())
+		handler.Use(handlers.NewRequestIdHeader(cfg, logger))
+		handler.UseHandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			requestId = r.Header.Get(cfg.HeaderName)
+			nextRequest = r
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	It("stores the ID in the request info", func() {
+		reqInfo, err := handlers.ContextRequestInfo(nextRequest)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reqInfo.RequestID).To(Equal(requestId))
+		Expect(requestId).To(MatchRegexp(uuid_regex))
+	})
+
+	Context("when a header name is configured", func() {
+		BeforeEach(func() {
+			cfg.HeaderName = "X-Request-Id"
+			req.Header.Set(handlers.VcapRequestIdHeader, "client-id")
+		})
+
+		It("sets the configured header", func() {
+			Expect(requestId).To(MatchRegexp(uuid_regex))
+		})
+
+		It("removes the X-Vcap-Request-Id of the client", func() {
+			Expect(nextRequest.Header.Get(handlers.VcapRequestIdHeader)).To(BeEmpty())
+		})
+
+		Context("when the client is trusted", func() {
+			BeforeEach(func() {
+				c := config.DefaultConfig()
+				c.RequestID.HeaderName = "X-Request-Id"
+				c.RequestID.TrustedCIDRs = []string{"10.0.0.0/24"}
+				c.Process()
+				cfg = c.RequestID
+			})
+
+			It("keeps the X-Vcap-Request-Id of the client", func() {
+				Expect(nextRequest.Header.Get(handlers.VcapRequestIdHeader)).To(Equal("client-id"))
+			})
+		})
+	})
+
+	Context("when the uuid7 format is configured", func() {
+		BeforeEach(func() {
+			cfg.Format = config.REQUEST_ID_UUID7
+		})
+
+		It("generates version 7 UUIDs", func() {
+			Expect(requestId).To(MatchRegexp(`^[[:xdigit:]]{8}-[[:xdigit:]]{4}-7[[:xdigit:]]{3}-[89ab][[:xdigit:]]{3}-[[:xdigit:]]{12}$`))
+		})
+	})
+
+	Context("when the ksuid format is configured", func() {
+		BeforeEach(func() {
+			cfg.Format = config.REQUEST_ID_KSUID
+		})
+
+		It("generates KSUIDs", func() {
+			Expect(requestId).To(MatchRegexp(`^[0-9A-Za-z]{27}$`))
+		})
+	})
+
+	Context("when trusted CIDRs are configured", func() {
+		BeforeEach(func() {
+			c := config.DefaultConfig()
+			c.RequestID.TrustedCIDRs = []string{"10.0.0.0/24"}
+			c.Process()
+			cfg = c.RequestID
+			req.Header.Set(handlers.VcapRequestIdHeader, "upstream-id")
+		})
+
+		It("keeps the ID of requests from trusted clients", func() {
+			Expect(requestId).To(Equal("upstream-id"))
+
+			reqInfo, err := handlers.ContextRequestInfo(nextRequest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reqInfo.RequestID).To(Equal("upstream-id"))
+		})
+
+		Context("when the client is not trusted", func() {
+			BeforeEach(func() {
+				req.RemoteAddr = "10.0.1.1:34567"
+			})
+
+			It("replaces the ID", func() {
+				Expect(requestId).To(MatchRegexp(uuid_regex))
+			})
+		})
+
+		Context("when the ID is not valid", func() {
+			BeforeEach(func() {
+				req.Header.Set(handlers.VcapRequestIdHeader, "bad id")
+			})
+
+			It("replaces the ID", func() {
+				Expect(requestId).To(MatchRegexp(uuid_regex))
+			})
+		})
+	})
+})
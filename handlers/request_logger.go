@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/route"
+	"github.com/uber-go/zap"
+)
+
+// RequestLogger returns the logger with the fields identifying the request,
+// so that the logs of a request can be told apart from those of others
+// across handlers: vcap_request_id, and the route, endpoint, app_id,
+// app_index and instance_id once they are known.
+func RequestLogger(logger logger.Logger, r *http.Request) logger.Logger {
+	reqInfo, err := ContextRequestInfo(r)
+	if err != nil {
+		return logger
+	}
+	return logger.With(requestLogFields(r, reqInfo)...)
+}
+
+func requestLogFields(r *http.Request, reqInfo *RequestInfo) []zap.Field {
+	var fields []zap.Field
+	if reqInfo.RequestID != "" {
+		fields = append(fields, zap.String("vcap_request_id", reqInfo.RequestID))
+	}
+	if reqInfo.RoutePool != nil {
+		routeKey := route.Uri(hostWithoutPort(r.Host) + reqInfo.RoutePool.ContextPath()).RouteKey()
+		fields = append(fields, zap.String("route", strings.TrimSuffix(string(routeKey), "/")))
+	}
+	if endpoint := reqInfo.RouteEndpoint; endpoint != nil {
+		fields = append(fields,
+			zap.String("endpoint", endpoint.CanonicalAddr()),
+			zap.String("app_id", endpoint.ApplicationId),
+			zap.String("app_index", endpoint.PrivateInstanceIndex),
+			zap.String("instance_id", endpoint.PrivateInstanceId),
+		)
+	}
+	return fields
+}
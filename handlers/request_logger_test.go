@@ -0,0 +1,90 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/handlers"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/routing-api/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("RequestLogger", func() {
+	var (
+		handler  *negroni.Negroni
+		logger   *test_util.TestZapLogger
+		pool     *route.Pool
+		endpoint *route.Endpoint
+	)
+
+	BeforeEach(func() {
+		logger = test_util.NewTestZapLogger("test")
+		pool = nil
+		endpoint = nil
+
+		handler = negroni.New()
+		handler.Use(handlers.NewRequestInfo())
+		handler.UseHandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			reqInfo, err := handlers.ContextRequestInfo(req)
+			Expect(err).ToNot(HaveOccurred())
+			reqInfo.RequestID = "request-id"
+			reqInfo.RoutePool = pool
+			reqInfo.RouteEndpoint = endpoint
+
+			handlers.RequestLogger(logger, req).Info("handled")
+		})
+	})
+
+	Context("when the request has request info", func() {
+		var log string
+
+		JustBeforeEach(func() {
+			req := test_util.NewRequest("GET", "example.com:8080", "/foo/bar", nil)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			log = string(logger.Buffer().Contents())
+		})
+
+		It("logs the request ID", func() {
+			Expect(log).To(ContainSubstring(`"vcap_request_id":"request-id"`))
+			Expect(log).ToNot(ContainSubstring(`"route"`))
+			Expect(log).ToNot(ContainSubstring(`"endpoint"`))
+		})
+
+		Context("once the request is routed", func() {
+			BeforeEach(func() {
+				pool = route.NewPool(2*time.Minute, "/foo")
+			})
+
+			It("logs the route", func() {
+				Expect(log).To(ContainSubstring(`"route":"example.com/foo"`))
+			})
+		})
+
+		Context("once the endpoint is chosen", func() {
+			BeforeEach(func() {
+				pool = route.NewPool(2*time.Minute, "/")
+				endpoint = route.NewEndpoint("app-guid", "1.2.3.4", 5678, "instance-guid", "2", nil, -1, "", models.ModificationTag{}, "")
+			})
+
+			It("logs the endpoint", func() {
+				Expect(log).To(ContainSubstring(`"route":"example.com"`))
+				Expect(log).To(ContainSubstring(`"endpoint":"1.2.3.4:5678"`))
+				Expect(log).To(ContainSubstring(`"app_id":"app-guid"`))
+				Expect(log).To(ContainSubstring(`"app_index":"2"`))
+				Expect(log).To(ContainSubstring(`"instance_id":"instance-guid"`))
+			})
+		})
+	})
+
+	It("returns the logger as is for requests without request info", func() {
+		req := test_util.NewRequest("GET", "example.com", "/", nil)
+		handlers.RequestLogger(logger, req).Info("handled")
+		Expect(string(logger.Buffer().Contents())).ToNot(ContainSubstring(`"vcap_request_id"`))
+	})
+})
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/routeservice"
+	"github.com/uber-go/zap"
+	"github.com/urfave/negroni"
+)
+
+type requestQueue struct {
+	logger   logger.Logger
+	maxDepth int
+	timeout  time.Duration
+}
+
+// NewRequestQueue creates a handler that holds requests for routes whose
+// endpoints are all at their connection limit until one of the endpoints
+// completes a request. Up to the maximum queue depth of the route, or else
+// the configured one, requests wait for at most the queue timeout. Requests
+// that cannot be queued or time out are passed on, and the proxy responds to
+// them with 503 Service Unavailable if the endpoints are still at their
+// limit. It must run after the route of the request has been looked up.
+func NewRequestQueue(cfg config.RequestQueueConfig, logger logger.Logger) negroni.Handler {
+	return &requestQueue{
+		logger:   logger,
+		maxDepth: cfg.MaxQueueDepth,
+		timeout:  cfg.QueueTimeout,
+	}
+}
+
+func (q *requestQueue) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	reqInfo, err := ContextRequestInfo(r)
+	if err != nil {
+		q.logger.Fatal("request-info-err", zap.Error(err))
+		return
+	}
+	pool := reqInfo.RoutePool
+	if pool == nil {
+		next(rw, r)
+		return
+	}
+
+	// requests for routes with a route service go to the route service
+	// before they go to an endpoint
+	if pool.RouteServiceUrl() != "" && !hasBeenToRouteService(pool.RouteServiceUrl(), r.Header.Get(routeservice.RouteServiceSignature)) {
+		next(rw, r)
+		return
+	}
+
+	if pool.Saturated() {
+		maxDepth := pool.MaxQueueDepth()
+		if maxDepth == 0 {
+			maxDepth = q.maxDepth
+		}
+		if maxDepth > 0 {
+			q.wait(r.Context(), pool, maxDepth)
+		}
+	}
+
+	next(rw, r)
+}
+
+// wait waits until not all endpoints of the pool are at their connection
+// limit, the request cannot be queued, the queue timeout has expired or the
+// request is canceled.
+func (q *requestQueue) wait(ctx context.Context, pool *route.Pool, maxDepth int) {
+	timer := time.NewTimer(q.timeout)
+	defer timer.Stop()
+
+	for pool.Saturated() {
+		wait, ok := pool.Enqueue(maxDepth)
+		if !ok {
+			q.logger.Info("request-queue-full", zap.Int("max-queue-depth", maxDepth))
+			return
+		}
+		select {
+		case <-wait:
+		case <-timer.C:
+			pool.Dequeue(wait)
+			q.logger.Info("request-queue-timeout", zap.Duration("queue-timeout", q.timeout))
+			return
+		case <-ctx.Done():
+			pool.Dequeue(wait)
+			return
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/handlers"
+	logger_fakes "code.cloudfoundry.org/gorouter/logger/fakes"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/routing-api/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("RequestQueue", func() {
+	var (
+		handler    *negroni.Negroni
+		cfg        config.RequestQueueConfig
+		pool       *route.Pool
+		endpoint   *route.Endpoint
+		req        *http.Request
+		elapsed    time.Duration
+		nextCalled bool
+	)
+
+	BeforeEach(func() {
+		nextCalled = false
+		cfg = config.RequestQueueConfig{MaxQueueDepth: 1, QueueTimeout: time.Second}
+		pool = route.NewPool(2*time.Minute, "/")
+		endpoint = route.NewEndpoint("app-guid", "10.0.16.4", 8080, "", "", nil, -1, "", models.ModificationTag{}, "")
+		endpoint.MaxConnections = 1
+		pool.Put(endpoint)
+		req = test_util.NewRequest("GET", "example.com", "/", nil)
+	})
+
+	JustBeforeEach(func() {
+		handler = negroni.New()
+		handler.Use(handlers.NewRequestInfo())
+		handler.UseFunc(func(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+			reqInfo, err := handlers.ContextRequestInfo(req)
+			Expect(err).ToNot(HaveOccurred())
+			reqInfo.RoutePool = pool
+			next(rw, req)
+		})
+		handler.Use(handlers.NewRequestQueue(cfg, new(logger_fakes.FakeLogger)))
+		handler.UseHandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			nextCalled = true
+			rw.WriteHeader(http.StatusOK)
+		})
+
+		start := time.Now()
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		elapsed = time.Since(start)
+	})
+
+	It("does not hold requests while an endpoint is below its limit", func() {
+		Expect(elapsed).To(BeNumerically("<", 100*time.Millisecond))
+		Expect(nextCalled).To(BeTrue())
+	})
+
+	Context("when every endpoint is at its connection limit", func() {
+		var iter route.EndpointIterator
+
+		BeforeEach(func() {
+			iter = pool.Endpoints("", "", "")
+			iter.PreRequest(endpoint)
+		})
+
+		Context("when an endpoint completes a request", func() {
+			BeforeEach(func() {
+				go func() {
+					defer GinkgoRecover()
+					time.Sleep(100 * time.Millisecond)
+					iter.PostRequest(endpoint)
+				}()
+			})
+
+			It("holds requests until then", func() {
+				Expect(elapsed).To(And(
+					BeNumerically(">=", 100*time.Millisecond),
+					BeNumerically("<", time.Second),
+				))
+				Expect(nextCalled).To(BeTrue())
+				Expect(pool.QueueDepth()).To(BeZero())
+			})
+		})
+
+		Context("when no endpoint completes a request", func() {
+			BeforeEach(func() {
+				cfg.QueueTimeout = 100 * time.Millisecond
+			})
+
+			It("passes requests on after the queue timeout", func() {
+				Expect(elapsed).To(BeNumerically(">=", 100*time.Millisecond))
+				Expect(nextCalled).To(BeTrue())
+				Expect(pool.QueueDepth()).To(BeZero())
+			})
+		})
+
+		Context("when the queue is full", func() {
+			var wait chan struct{}
+
+			BeforeEach(func() {
+				var ok bool
+				wait, ok = pool.Enqueue(1)
+				Expect(ok).To(BeTrue())
+			})
+
+			AfterEach(func() {
+				pool.Dequeue(wait)
+			})
+
+			It("does not hold requests", func() {
+				Expect(elapsed).To(BeNumerically("<", 100*time.Millisecond))
+				Expect(nextCalled).To(BeTrue())
+			})
+		})
+
+		Context("without a queue depth", func() {
+			BeforeEach(func() {
+				cfg.MaxQueueDepth = 0
+			})
+
+			It("does not hold requests", func() {
+				Expect(elapsed).To(BeNumerically("<", 100*time.Millisecond))
+			})
+
+			Context("when the route has a queue depth", func() {
+				BeforeEach(func() {
+					endpoint.MaxQueueDepth = 1
+					cfg.QueueTimeout = 100 * time.Millisecond
+				})
+
+				It("uses the queue depth of the route", func() {
+					Expect(elapsed).To(BeNumerically(">=", 100*time.Millisecond))
+				})
+			})
+		})
+	})
+})
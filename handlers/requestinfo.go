@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"time"
 
+	"code.cloudfoundry.org/gorouter/config"
 	"code.cloudfoundry.org/gorouter/proxy/utils"
 	"code.cloudfoundry.org/gorouter/route"
 
@@ -26,6 +27,60 @@ type RequestInfo struct {
 	ProxyResponseWriter    utils.ProxyResponseWriter
 	RouteServiceURL        *url.URL
 	IsInternalRouteService bool
+	// HashKey is the request attribute hashed by the hash balancing
+	// algorithm.
+	HashKey string
+	// SplitTraffic is true when requests are routed to the endpoints of
+	// TrafficGroup, as selected by the traffic rules of the route.
+	SplitTraffic bool
+	TrafficGroup string
+	// Attempts is the number of round trips made to endpoints or route
+	// services for the request, including retries.
+	Attempts int
+	// RequestID is the ID of the request, set in the configured request ID
+	// header.
+	RequestID string
+	// InitialEndpointID is the private instance ID or address of the
+	// endpoint the request is sent to first, when it is not left to the load
+	// balancing algorithm. It takes precedence over sticky sessions.
+	InitialEndpointID string
+	// LongLived is true for server-sent event and long-poll requests, which
+	// are pinned to an endpoint and are not subject to endpoint timeouts.
+	LongLived bool
+	// RecordTiming asks the round tripper to record the Timing of the
+	// request.
+	RecordTiming bool
+	// Timing is the timing of the last round trip of the request, recorded
+	// when the request is traced or RecordTiming is set.
+	Timing RequestTiming
+	// VirtualHost overrides settings of the router for the request, if its
+	// host matches one of the virtual hosts.
+	VirtualHost *config.VirtualHostConfig
+	// AppQuotas counts the request against the quota of the application of
+	// the endpoint it is sent to.
+	AppQuotas AppQuotas
+}
+
+// LoadBalance returns the load balancing algorithm of the request: hash for
+// long-lived requests, so that they are pinned to an endpoint, and the
+// default algorithm of the router otherwise.
+func (r *RequestInfo) LoadBalance(defaultLoadBalance string) string {
+	if r.LongLived && r.HashKey != "" {
+		return config.LOAD_BALANCE_HASH
+	}
+	return defaultLoadBalance
+}
+
+// RequestTiming breaks down the time a round trip to an endpoint took.
+type RequestTiming struct {
+	DNS  time.Duration
+	Dial time.Duration
+	TLS  time.Duration
+	// TTFB is the time until the first byte of the response.
+	TTFB time.Duration
+	// Reused is true when the connection to the endpoint was reused, so
+	// that no time was spent dialing it.
+	Reused bool
 }
 
 // ContextRequestInfo gets the RequestInfo from the request Context
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"github.com/uber-go/zap"
+	"github.com/urfave/negroni"
+)
+
+type rewriteRule struct {
+	match    *regexp.Regexp
+	rewrite  string
+	redirect string
+	status   int
+}
+
+// RewriteRules are the rules rewriting and redirecting requests, which can be
+// replaced while requests are handled.
+type RewriteRules struct {
+	lock    sync.RWMutex
+	configs []config.RewriteRuleConfig
+	rules   []rewriteRule
+}
+
+// NewRewriteRules returns the rules of the configs.
+func NewRewriteRules(configs []config.RewriteRuleConfig) (*RewriteRules, error) {
+	r := &RewriteRules{}
+	if err := r.Set(configs); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Configs returns the configs of the rules.
+func (r *RewriteRules) Configs() []config.RewriteRuleConfig {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return append([]config.RewriteRuleConfig{}, r.configs...)
+}
+
+// Set replaces the rules with the rules of the configs, unless a config is
+// not valid.
+func (r *RewriteRules) Set(configs []config.RewriteRuleConfig) error {
+	rules := make([]rewriteRule, 0, len(configs))
+	for _, c := range configs {
+		if err := c.Validate(); err != nil {
+			return err
+		}
+		rule := rewriteRule{
+			match:    regexp.MustCompile(c.Match),
+			rewrite:  c.Rewrite,
+			redirect: c.Redirect,
+			status:   c.Status,
+		}
+		if rule.redirect != "" && rule.status == 0 {
+			rule.status = http.StatusMovedPermanently
+		}
+		rules = append(rules, rule)
+	}
+
+	r.lock.Lock()
+	r.configs = append([]config.RewriteRuleConfig{}, configs...)
+	r.rules = rules
+	r.lock.Unlock()
+	return nil
+}
+
+// match returns the first rule matching the host and path, and the
+// expansion of its rewrite or redirect.
+func (r *RewriteRules) match(hostAndPath string) (rewriteRule, string, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for _, rule := range r.rules {
+		submatches := rule.match.FindStringSubmatchIndex(hostAndPath)
+		if submatches == nil {
+			continue
+		}
+		template := rule.rewrite
+		if rule.redirect != "" {
+			template = rule.redirect
+		}
+		return rule, string(rule.match.ExpandString(nil, template, hostAndPath, submatches)), true
+	}
+	return rewriteRule{}, "", false
+}
+
+type rewrite struct {
+	rules  *RewriteRules
+	logger logger.Logger
+}
+
+// NewRewrite creates a handler that rewrites or redirects requests with the
+// first of the rules that matches their host and escaped path. Rewritten
+// requests are routed to their new host and path, with their query. Requests
+// are redirected with their query, unless the URL they are redirected to has
+// a query. It must run before the route of the request is looked up.
+func NewRewrite(rules *RewriteRules, logger logger.Logger) negroni.Handler {
+	return &rewrite{
+		rules:  rules,
+		logger: logger,
+	}
+}
+
+func (h *rewrite) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	path := r.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	rule, target, ok := h.rules.match(strings.ToLower(hostWithoutPort(r.Host)) + path)
+	if !ok {
+		next(rw, r)
+		return
+	}
+
+	if rule.redirect != "" {
+		if r.URL.RawQuery != "" && !strings.Contains(target, "?") {
+			target += "?" + r.URL.RawQuery
+		}
+		h.logger.Debug("request-redirected", zap.String("location", target))
+		http.Redirect(rw, r, target, rule.status)
+		return
+	}
+
+	host, newPath := target, "/"
+	if i := strings.Index(target, "/"); i >= 0 {
+		host, newPath = target[:i], target[i:]
+	}
+	u, err := url.Parse(newPath)
+	if err != nil || host == "" {
+		h.logger.Error("rewrite-failed", zap.String("target", target))
+		writeStatus(rw, http.StatusInternalServerError, "Rewrite failed.", h.logger)
+		return
+	}
+	h.logger.Debug("request-rewritten", zap.String("host", host), zap.String("path", newPath))
+	r.Host = host
+	r.URL.Path, r.URL.RawPath = u.Path, u.RawPath
+	next(rw, r)
+}
@@ -0,0 +1,129 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/handlers"
+	logger_fakes "code.cloudfoundry.org/gorouter/logger/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("Rewrite", func() {
+	var (
+		handler     *negroni.Negroni
+		rules       *handlers.RewriteRules
+		resp        *httptest.ResponseRecorder
+		req         *http.Request
+		nextRequest *http.Request
+	)
+
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		nextRequest = req
+	})
+
+	BeforeEach(func() {
+		nextRequest = nil
+		var err error
+		rules, err = handlers.NewRewriteRules([]config.RewriteRuleConfig{
+			{Match: `^example\.com(/.*)$`, Redirect: "https://www.example.com$1"},
+			{Match: `^old\.example\.com/docs/(.*)$`, Redirect: "/manual/$1", Status: http.StatusFound},
+			{Match: `^old\.example\.com/api/v1/(.*)$`, Rewrite: "api.example.com/v2/$1"},
+			{Match: `^legacy\.example\.com`, Rewrite: "app.example.com"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		resp = httptest.NewRecorder()
+	})
+
+	JustBeforeEach(func() {
+		handler = negroni.New()
+		handler.Use(handlers.NewRewrite(rules, new(logger_fakes.FakeLogger)))
+		handler.UseHandler(nextHandler)
+
+		handler.ServeHTTP(resp, req)
+	})
+
+	Context("when a redirect rule matches", func() {
+		BeforeEach(func() {
+			req = httptest.NewRequest("GET", "http://EXAMPLE.com:8080/some/path?q=1", nil)
+		})
+
+		It("redirects the request with its query", func() {
+			Expect(nextRequest).To(BeNil())
+			Expect(resp.Code).To(Equal(http.StatusMovedPermanently))
+			Expect(resp.Header().Get("Location")).To(Equal("https://www.example.com/some/path?q=1"))
+		})
+	})
+
+	Context("when a redirect rule with a status matches", func() {
+		BeforeEach(func() {
+			req = httptest.NewRequest("GET", "http://old.example.com/docs/intro", nil)
+		})
+
+		It("redirects the request with the status", func() {
+			Expect(resp.Code).To(Equal(http.StatusFound))
+			Expect(resp.Header().Get("Location")).To(Equal("/manual/intro"))
+		})
+	})
+
+	Context("when a rewrite rule matches", func() {
+		BeforeEach(func() {
+			req = httptest.NewRequest("GET", "http://old.example.com/api/v1/users?id=2", nil)
+		})
+
+		It("rewrites the host and path of the request", func() {
+			Expect(nextRequest).ToNot(BeNil())
+			Expect(nextRequest.Host).To(Equal("api.example.com"))
+			Expect(nextRequest.URL.Path).To(Equal("/v2/users"))
+			Expect(nextRequest.URL.RawQuery).To(Equal("id=2"))
+		})
+	})
+
+	Context("when a rewrite rule has no path", func() {
+		BeforeEach(func() {
+			req = httptest.NewRequest("GET", "http://legacy.example.com/foo", nil)
+		})
+
+		It("rewrites the request to the root path", func() {
+			Expect(nextRequest.Host).To(Equal("app.example.com"))
+			Expect(nextRequest.URL.Path).To(Equal("/"))
+		})
+	})
+
+	Context("when no rule matches", func() {
+		BeforeEach(func() {
+			req = httptest.NewRequest("GET", "http://www.example.com/foo", nil)
+		})
+
+		It("does not change the request", func() {
+			Expect(nextRequest.Host).To(Equal("www.example.com"))
+			Expect(nextRequest.URL.Path).To(Equal("/foo"))
+		})
+	})
+
+	Context("when the rules are replaced", func() {
+		BeforeEach(func() {
+			Expect(rules.Set(nil)).To(Succeed())
+			req = httptest.NewRequest("GET", "http://example.com/", nil)
+		})
+
+		It("applies the new rules", func() {
+			Expect(nextRequest).ToNot(BeNil())
+		})
+	})
+
+	Context("when a replacement is not valid", func() {
+		BeforeEach(func() {
+			req = httptest.NewRequest("GET", "http://example.com/", nil)
+		})
+
+		It("keeps the rules", func() {
+			Expect(rules.Set([]config.RewriteRuleConfig{{Match: "("}})).ToNot(Succeed())
+			Expect(rules.Configs()).To(HaveLen(4))
+		})
+	})
+})
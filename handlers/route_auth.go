@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/routeservice"
+	"github.com/uber-go/zap"
+	"github.com/urfave/negroni"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxVerifiedCredentials bounds the basic auth credentials whose bcrypt
+// verification is remembered.
+const maxVerifiedCredentials = 1024
+
+// TokenValidator validates the bearer token of an Authorization header and
+// checks that it has one of the permissions. It is implemented by the UAA
+// client.
+type TokenValidator interface {
+	DecodeToken(uaaToken string, desiredPermissions ...string) error
+}
+
+type routeAuth struct {
+	logger    logger.Logger
+	htpasswd  map[string]map[string]string
+	validator TokenValidator
+	issuer    string
+	audiences []string
+
+	// credentials that matched their bcrypt hash, as bcrypt is too slow to
+	// run on every request
+	lock     sync.Mutex
+	verified map[[sha256.Size]byte]struct{}
+}
+
+// NewRouteAuth creates a handler that responds with 401 Unauthorized to
+// requests for routes that require authentication and are not authenticated.
+// validator may be nil when JWT authentication is not enabled, in which case
+// requests for routes that require it are not authenticated. Requests with
+// JWT authentication get the claim headers of their route. It must run after
+// the route of the request has been looked up, and before the endpoint is
+// picked so that traffic rules can match the claim headers.
+func NewRouteAuth(cfg config.RouteAuthConfig, validator TokenValidator, logger logger.Logger) negroni.Handler {
+	return &routeAuth{
+		logger:    logger,
+		htpasswd:  cfg.Htpasswd,
+		validator: validator,
+		issuer:    cfg.JWTIssuer,
+		audiences: cfg.JWTAudiences,
+		verified:  map[[sha256.Size]byte]struct{}{},
+	}
+}
+
+func (a *routeAuth) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	reqInfo, err := ContextRequestInfo(r)
+	if err != nil {
+		a.logger.Fatal("request-info-err", zap.Error(err))
+		return
+	}
+	if reqInfo.RoutePool == nil {
+		next(rw, r)
+		return
+	}
+
+	// requests returning from a route service were authenticated on their
+	// way to it
+	if hasBeenToRouteService(reqInfo.RoutePool.RouteServiceUrl(), r.Header.Get(routeservice.RouteServiceSignature)) {
+		next(rw, r)
+		return
+	}
+
+	auth := reqInfo.RoutePool.Auth()
+	if auth == nil {
+		next(rw, r)
+		return
+	}
+
+	var authenticated bool
+	switch auth.Type {
+	case route.AuthBasic:
+		authenticated = a.basic(r, auth)
+	case route.AuthJWT:
+		authenticated = a.jwt(r, auth)
+	}
+	if !authenticated {
+		a.unauthorized(rw, r, auth)
+		return
+	}
+
+	next(rw, r)
+}
+
+func (a *routeAuth) basic(r *http.Request, auth *route.Auth) bool {
+	users, ok := a.htpasswd[auth.Htpasswd]
+	if !ok {
+		a.logger.Error("route-auth-htpasswd-not-found", zap.String("htpasswd", auth.Htpasswd))
+		return false
+	}
+
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	hash, ok := users[user]
+	if !ok {
+		return false
+	}
+
+	key := sha256.Sum256([]byte(auth.Htpasswd + "\x00" + user + "\x00" + password + "\x00" + hash))
+	a.lock.Lock()
+	_, verified := a.verified[key]
+	a.lock.Unlock()
+	if verified {
+		return true
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return false
+	}
+
+	a.lock.Lock()
+	if len(a.verified) >= maxVerifiedCredentials {
+		a.verified = map[[sha256.Size]byte]struct{}{}
+	}
+	a.verified[key] = struct{}{}
+	a.lock.Unlock()
+	return true
+}
+
+func (a *routeAuth) jwt(r *http.Request, auth *route.Auth) bool {
+	if a.validator == nil {
+		a.logger.Error("route-auth-jwt-not-enabled")
+		return false
+	}
+
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "bearer") || parts[1] == "" {
+		return false
+	}
+
+	err := a.validator.DecodeToken("bearer "+parts[1], auth.Scopes...)
+	if err != nil {
+		a.logger.Info("route-auth-invalid-token", zap.Error(err))
+		return false
+	}
+	if a.issuer == "" && len(a.audiences) == 0 && len(auth.ClaimHeaders) == 0 {
+		return true
+	}
+
+	claims, err := tokenClaims(parts[1])
+	if err != nil {
+		a.logger.Info("route-auth-invalid-token", zap.Error(err))
+		return false
+	}
+	if a.issuer != "" && claims["iss"] != a.issuer {
+		a.logger.Info("route-auth-invalid-token", zap.Error(errors.New("token has the wrong issuer")))
+		return false
+	}
+	if len(a.audiences) > 0 && !hasAudience(claims["aud"], a.audiences) {
+		a.logger.Info("route-auth-invalid-token", zap.Error(errors.New("token has none of the audiences")))
+		return false
+	}
+
+	for header, claim := range auth.ClaimHeaders {
+		r.Header.Del(header)
+		if value, ok := claimValue(claims[claim]); ok {
+			r.Header.Set(header, value)
+		}
+	}
+	return true
+}
+
+// tokenClaims returns the claims of the payload of a JWT, whose signature has
+// been validated.
+func tokenClaims(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, err
+	}
+
+	claims := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	err = decoder.Decode(&claims)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// hasAudience reports whether the aud claim of a token, a string or a list of
+// strings, has one of the audiences.
+func hasAudience(aud interface{}, audiences []string) bool {
+	var tokenAudiences []interface{}
+	switch aud := aud.(type) {
+	case string:
+		tokenAudiences = []interface{}{aud}
+	case []interface{}:
+		tokenAudiences = aud
+	}
+	for _, tokenAudience := range tokenAudiences {
+		for _, audience := range audiences {
+			if tokenAudience == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// claimValue returns the value of a header for a claim. The values of lists,
+// such as scopes, are separated by spaces and objects are JSON encoded.
+// Claims that are missing or have line breaks have no header.
+func claimValue(claim interface{}) (string, bool) {
+	var value string
+	switch claim := claim.(type) {
+	case nil:
+		return "", false
+	case string:
+		value = claim
+	case []interface{}:
+		values := make([]string, 0, len(claim))
+		for _, c := range claim {
+			if v, ok := claimValue(c); ok {
+				values = append(values, v)
+			}
+		}
+		value = strings.Join(values, " ")
+	case map[string]interface{}:
+		b, err := json.Marshal(claim)
+		if err != nil {
+			return "", false
+		}
+		value = string(b)
+	default:
+		value = fmt.Sprint(claim)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return "", false
+	}
+	return value, true
+}
+
+func (a *routeAuth) unauthorized(rw http.ResponseWriter, r *http.Request, auth *route.Auth) {
+	realm := auth.Realm
+	if realm == "" {
+		realm = hostWithoutPort(r.Host)
+	}
+	scheme := "Basic"
+	if auth.Type == route.AuthJWT {
+		scheme = "Bearer"
+	}
+
+	rw.Header().Set("WWW-Authenticate", fmt.Sprintf("%s realm=%q", scheme, realm))
+	rw.Header().Set("X-Cf-RouterError", "unauthorized")
+	writeStatus(
+		rw,
+		http.StatusUnauthorized,
+		"Authentication required.",
+		a.logger,
+	)
+}
@@ -0,0 +1,311 @@
+package handlers_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/handlers"
+	logger_fakes "code.cloudfoundry.org/gorouter/logger/fakes"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/routeservice"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/routing-api/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type fakeTokenValidator struct {
+	token  string
+	scopes []string
+	err    error
+}
+
+func (v *fakeTokenValidator) DecodeToken(token string, scopes ...string) error {
+	v.token = token
+	v.scopes = scopes
+	return v.err
+}
+
+func jwtWithClaims(claims string) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	return encode([]byte(`{"alg":"RS256"}`)) + "." + encode([]byte(claims)) + "." + encode([]byte("signature"))
+}
+
+var _ = Describe("RouteAuth", func() {
+	var (
+		handler    *negroni.Negroni
+		cfg        config.RouteAuthConfig
+		validator  handlers.TokenValidator
+		fake       *fakeTokenValidator
+		auth       *route.Auth
+		rsURL      string
+		req        *http.Request
+		resp       *httptest.ResponseRecorder
+		nextCalled bool
+		nextHeader http.Header
+	)
+
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		nextCalled = true
+		nextHeader = req.Header
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	BeforeEach(func() {
+		nextCalled = false
+		nextHeader = nil
+		hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+		Expect(err).ToNot(HaveOccurred())
+		cfg = config.RouteAuthConfig{
+			Htpasswd: map[string]map[string]string{"admins": {"alice": string(hash)}},
+		}
+		fake = &fakeTokenValidator{}
+		validator = fake
+		auth = nil
+		rsURL = ""
+		req = test_util.NewRequest("GET", "example.com", "/", nil)
+		resp = httptest.NewRecorder()
+	})
+
+	JustBeforeEach(func() {
+		pool := route.NewPool(2*time.Minute, "/")
+		endpoint := route.NewEndpoint("app-guid", "10.0.16.4", 8080, "", "", nil, -1, rsURL, models.ModificationTag{}, "")
+		endpoint.Auth = auth
+		pool.Put(endpoint)
+
+		handler = negroni.New()
+		handler.Use(handlers.NewRequestInfo())
+		handler.UseFunc(func(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+			reqInfo, err := handlers.ContextRequestInfo(req)
+			Expect(err).ToNot(HaveOccurred())
+			reqInfo.RoutePool = pool
+			next(rw, req)
+		})
+		handler.Use(handlers.NewRouteAuth(cfg, validator, new(logger_fakes.FakeLogger)))
+		handler.UseHandler(nextHandler)
+		handler.ServeHTTP(resp, req)
+	})
+
+	It("does not authenticate requests for routes that do not require it", func() {
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(nextCalled).To(BeTrue())
+	})
+
+	Context("with basic authentication", func() {
+		BeforeEach(func() {
+			auth = &route.Auth{Type: route.AuthBasic, Htpasswd: "admins"}
+		})
+
+		It("responds with 401 to requests without credentials", func() {
+			Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+			Expect(resp.Header().Get("WWW-Authenticate")).To(Equal(`Basic realm="example.com"`))
+			Expect(resp.Header().Get("X-Cf-RouterError")).To(Equal("unauthorized"))
+			Expect(nextCalled).To(BeFalse())
+		})
+
+		Context("when the request has the password of a user", func() {
+			BeforeEach(func() {
+				req.SetBasicAuth("alice", "secret")
+			})
+
+			It("proxies the request", func() {
+				Expect(resp.Code).To(Equal(http.StatusOK))
+				Expect(nextCalled).To(BeTrue())
+				Expect(serve(handler, req).Code).To(Equal(http.StatusOK))
+			})
+		})
+
+		Context("when the request has a wrong password", func() {
+			BeforeEach(func() {
+				req.SetBasicAuth("alice", "guess")
+			})
+
+			It("responds with 401", func() {
+				Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+			})
+		})
+
+		Context("when the request is of an unknown user", func() {
+			BeforeEach(func() {
+				req.SetBasicAuth("bob", "secret")
+			})
+
+			It("responds with 401", func() {
+				Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+			})
+		})
+
+		Context("when the route has a realm", func() {
+			BeforeEach(func() {
+				auth.Realm = "Admin Area"
+			})
+
+			It("uses the realm of the route", func() {
+				Expect(resp.Header().Get("WWW-Authenticate")).To(Equal(`Basic realm="Admin Area"`))
+			})
+		})
+
+		Context("when the htpasswd file is not configured", func() {
+			BeforeEach(func() {
+				auth.Htpasswd = "operators"
+				req.SetBasicAuth("alice", "secret")
+			})
+
+			It("responds with 401", func() {
+				Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+			})
+		})
+	})
+
+	Context("with JWT authentication", func() {
+		BeforeEach(func() {
+			auth = &route.Auth{Type: route.AuthJWT, Scopes: []string{"app.read", "app.admin"}}
+			req.Header.Set("Authorization", "Bearer some-token")
+		})
+
+		It("proxies requests with a valid token", func() {
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(fake.token).To(Equal("bearer some-token"))
+			Expect(fake.scopes).To(Equal([]string{"app.read", "app.admin"}))
+		})
+
+		Context("when the token is not valid", func() {
+			BeforeEach(func() {
+				fake.err = errors.New("token is expired")
+			})
+
+			It("responds with 401", func() {
+				Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+				Expect(resp.Header().Get("WWW-Authenticate")).To(Equal(`Bearer realm="example.com"`))
+				Expect(nextCalled).To(BeFalse())
+			})
+		})
+
+		Context("when the request has no bearer token", func() {
+			BeforeEach(func() {
+				req.Header.Del("Authorization")
+				req.SetBasicAuth("alice", "secret")
+			})
+
+			It("responds with 401", func() {
+				Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+				Expect(fake.token).To(BeEmpty())
+			})
+		})
+
+		Context("with claim headers", func() {
+			BeforeEach(func() {
+				auth.ClaimHeaders = map[string]string{
+					"X-User-Id":   "user_id",
+					"X-Scopes":    "scope",
+					"X-Expires":   "exp",
+					"X-Zone":      "zone",
+					"X-Client-Id": "client_id",
+				}
+				token := jwtWithClaims(`{"user_id":"u-1","scope":["app.read","openid"],"exp":1700000000,"zone":{"id":"uaa"}}`)
+				req.Header.Set("Authorization", "Bearer "+token)
+				req.Header.Set("X-User-Id", "spoofed")
+				req.Header.Set("X-Client-Id", "spoofed")
+			})
+
+			It("sets the headers to the claims of the token", func() {
+				Expect(resp.Code).To(Equal(http.StatusOK))
+				Expect(nextHeader.Get("X-User-Id")).To(Equal("u-1"))
+				Expect(nextHeader.Get("X-Scopes")).To(Equal("app.read openid"))
+				Expect(nextHeader.Get("X-Expires")).To(Equal("1700000000"))
+				Expect(nextHeader.Get("X-Zone")).To(Equal(`{"id":"uaa"}`))
+			})
+
+			It("removes the headers of claims the token does not have", func() {
+				Expect(resp.Code).To(Equal(http.StatusOK))
+				Expect(nextHeader).ToNot(HaveKey("X-Client-Id"))
+			})
+
+			Context("when the token is not a JWT", func() {
+				BeforeEach(func() {
+					req.Header.Set("Authorization", "Bearer some-token")
+				})
+
+				It("responds with 401", func() {
+					Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+				})
+			})
+		})
+
+		Context("with an issuer and audiences", func() {
+			BeforeEach(func() {
+				cfg.JWTIssuer = "https://uaa.example.com/oauth/token"
+				cfg.JWTAudiences = []string{"gorouter", "apps"}
+			})
+
+			Context("when the token is of the issuer and one of the audiences", func() {
+				BeforeEach(func() {
+					req.Header.Set("Authorization", "Bearer "+jwtWithClaims(`{"iss":"https://uaa.example.com/oauth/token","aud":["cloud_controller","apps"]}`))
+				})
+
+				It("proxies the request", func() {
+					Expect(resp.Code).To(Equal(http.StatusOK))
+				})
+			})
+
+			Context("when the token has a single audience", func() {
+				BeforeEach(func() {
+					req.Header.Set("Authorization", "Bearer "+jwtWithClaims(`{"iss":"https://uaa.example.com/oauth/token","aud":"gorouter"}`))
+				})
+
+				It("accepts it", func() {
+					Expect(resp.Code).To(Equal(http.StatusOK))
+				})
+			})
+
+			Context("when the token is of another issuer", func() {
+				BeforeEach(func() {
+					req.Header.Set("Authorization", "Bearer "+jwtWithClaims(`{"iss":"https://other.example.com/oauth/token","aud":"gorouter"}`))
+				})
+
+				It("responds with 401", func() {
+					Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+				})
+			})
+
+			Context("when the token is for other audiences", func() {
+				BeforeEach(func() {
+					req.Header.Set("Authorization", "Bearer "+jwtWithClaims(`{"iss":"https://uaa.example.com/oauth/token","aud":["cloud_controller"]}`))
+				})
+
+				It("responds with 401", func() {
+					Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+				})
+			})
+		})
+
+		Context("when JWT authentication is not enabled", func() {
+			BeforeEach(func() {
+				validator = nil
+			})
+
+			It("responds with 401", func() {
+				Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+			})
+		})
+	})
+
+	Context("when the request returns from a route service", func() {
+		BeforeEach(func() {
+			auth = &route.Auth{Type: route.AuthBasic, Htpasswd: "admins"}
+			rsURL = "https://rs.example.com"
+			req.Header.Set(routeservice.RouteServiceSignature, "signature")
+		})
+
+		It("does not authenticate it again", func() {
+			Expect(resp.Code).To(Equal(http.StatusOK))
+		})
+	})
+})
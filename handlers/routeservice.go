@@ -14,17 +14,22 @@ import (
 )
 
 type routeService struct {
-	config   *routeservice.RouteServiceConfig
-	logger   logger.Logger
-	registry registry.Registry
+	config         *routeservice.RouteServiceConfig
+	logger         logger.Logger
+	registry       registry.Registry
+	internalLookup bool
 }
 
-// NewRouteService creates a handler responsible for handling route services
-func NewRouteService(config *routeservice.RouteServiceConfig, logger logger.Logger, routeRegistry registry.Registry) negroni.Handler {
+// NewRouteService creates a handler responsible for handling route services.
+// With internalLookup, requests to route services that are routes of the
+// registry are proxied to them directly rather than through the load
+// balancer.
+func NewRouteService(config *routeservice.RouteServiceConfig, logger logger.Logger, routeRegistry registry.Registry, internalLookup bool) negroni.Handler {
 	return &routeService{
-		config:   config,
-		logger:   logger,
-		registry: routeRegistry,
+		config:         config,
+		logger:         logger,
+		registry:       routeRegistry,
+		internalLookup: internalLookup,
 	}
 }
 
@@ -67,10 +72,12 @@ func (r *routeService) ServeHTTP(rw http.ResponseWriter, req *http.Request, next
 		}
 
 		forwardedURLRaw := recommendedScheme + "://" + hostWithoutPort(req.Host) + req.RequestURI
+		hop := 0
 		if hasBeenToRouteService(routeServiceURL, rsSignature) {
-			// A request from a route service destined for a backend instances
+			// A request from a route service destined for the next route
+			// service of the route or for a backend instance
 			routeServiceArgs.URLString = routeServiceURL
-			err := r.config.ValidateSignature(&req.Header, forwardedURLRaw)
+			lastHop, err := r.config.ValidateHopSignature(&req.Header, forwardedURLRaw)
 			if err != nil {
 				r.logger.Error("signature-validation-failed", zap.Error(err))
 
@@ -86,10 +93,15 @@ func (r *routeService) ServeHTTP(rw http.ResponseWriter, req *http.Request, next
 			req.Header.Del(routeservice.RouteServiceSignature)
 			req.Header.Del(routeservice.RouteServiceMetadata)
 			req.Header.Del(routeservice.RouteServiceForwardedURL)
-		} else {
+
+			hop = lastHop + 1
+		}
+
+		chain := reqInfo.RoutePool.RouteServiceChain()
+		if hop < len(chain) {
 			var err error
 			// should not hardcode http, will be addressed by #100982038
-			routeServiceArgs, err = r.config.Request(routeServiceURL, forwardedURLRaw)
+			routeServiceArgs, err = r.config.HopRequest(chain[hop], forwardedURLRaw, hop)
 			if err != nil {
 				r.logger.Error("route-service-failed", zap.Error(err))
 
@@ -107,10 +119,12 @@ func (r *routeService) ServeHTTP(rw http.ResponseWriter, req *http.Request, next
 
 			reqInfo.RouteServiceURL = routeServiceArgs.ParsedUrl
 
-			rsu := routeServiceArgs.ParsedUrl
-			uri := route.Uri(hostWithoutPort(rsu.Host) + rsu.EscapedPath())
-			if r.registry.Lookup(uri) != nil {
-				reqInfo.IsInternalRouteService = true
+			if r.internalLookup {
+				rsu := routeServiceArgs.ParsedUrl
+				uri := route.Uri(hostWithoutPort(rsu.Host) + rsu.EscapedPath())
+				if r.registry.Lookup(uri) != nil {
+					reqInfo.IsInternalRouteService = true
+				}
 			}
 		}
 	}
@@ -42,7 +42,8 @@ var _ = Describe("Route Service Handler", func() {
 
 		reqChan chan *http.Request
 
-		nextCalled bool
+		nextCalled     bool
+		internalLookup bool
 	)
 
 	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
@@ -89,6 +90,7 @@ var _ = Describe("Route Service Handler", func() {
 		)
 
 		nextCalled = false
+		internalLookup = true
 	})
 
 	AfterEach(func() {
@@ -99,7 +101,7 @@ var _ = Describe("Route Service Handler", func() {
 		handler = negroni.New()
 		handler.Use(handlers.NewRequestInfo())
 		handler.UseFunc(testSetupHandler)
-		handler.Use(handlers.NewRouteService(config, fakeLogger, reg))
+		handler.Use(handlers.NewRouteService(config, fakeLogger, reg, internalLookup))
 		handler.UseHandlerFunc(nextHandler)
 	})
 
@@ -241,6 +243,25 @@ var _ = Describe("Route Service Handler", func() {
 					Expect(reqInfo.IsInternalRouteService).To(BeTrue())
 					Expect(nextCalled).To(BeTrue(), "Expected the next handler to be called.")
 				})
+
+				Context("when internal lookup is disabled", func() {
+					BeforeEach(func() {
+						internalLookup = false
+					})
+
+					It("does not flag the route service as internal", func() {
+						handler.ServeHTTP(resp, req)
+
+						var passedReq *http.Request
+						Eventually(reqChan).Should(Receive(&passedReq))
+
+						reqInfo, err := handlers.ContextRequestInfo(passedReq)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(reqInfo.RouteServiceURL.Host).To(Equal("route-service.com"))
+						Expect(reqInfo.IsInternalRouteService).To(BeFalse())
+						Expect(reg.LookupCallCount()).To(BeZero())
+					})
+				})
 			})
 
 			Context("when recommendHttps is set to false", func() {
@@ -504,6 +525,81 @@ var _ = Describe("Route Service Handler", func() {
 			})
 		})
 
+		Context("with a chain of route services configured for the route", func() {
+			BeforeEach(func() {
+				endpoint := route.NewEndpoint(
+					"appId", "1.1.1.1", uint16(9090), "id", "1", map[string]string{}, 0,
+					"https://waf.example.com", models.ModificationTag{}, "",
+				)
+				endpoint.RouteServiceChain = []string{"https://waf.example.com", "https://auth.example.com"}
+
+				added := routePool.Put(endpoint)
+				Expect(added).To(BeTrue())
+			})
+
+			It("sends the request to the first route service", func() {
+				handler.ServeHTTP(resp, req)
+
+				var passedReq *http.Request
+				Eventually(reqChan).Should(Receive(&passedReq))
+
+				Expect(passedReq.Header.Get(routeservice.RouteServiceSignature)).ToNot(BeEmpty())
+				reqInfo, err := handlers.ContextRequestInfo(passedReq)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(reqInfo.RouteServiceURL.Host).To(Equal("waf.example.com"))
+			})
+
+			Context("when the request returns from the first route service", func() {
+				BeforeEach(func() {
+					reqArgs, err := config.HopRequest("https://waf.example.com", forwardedUrl, 0)
+					Expect(err).ToNot(HaveOccurred())
+					req.Header.Set(routeservice.RouteServiceSignature, reqArgs.Signature)
+					req.Header.Set(routeservice.RouteServiceMetadata, reqArgs.Metadata)
+				})
+
+				It("sends the request to the next route service with a new signature", func() {
+					signature := req.Header.Get(routeservice.RouteServiceSignature)
+					handler.ServeHTTP(resp, req)
+
+					var passedReq *http.Request
+					Eventually(reqChan).Should(Receive(&passedReq))
+
+					Expect(passedReq.Header.Get(routeservice.RouteServiceSignature)).ToNot(BeEmpty())
+					Expect(passedReq.Header.Get(routeservice.RouteServiceSignature)).ToNot(Equal(signature))
+					Expect(passedReq.Header.Get(routeservice.RouteServiceForwardedURL)).To(Equal(forwardedUrl))
+					reqInfo, err := handlers.ContextRequestInfo(passedReq)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(reqInfo.RouteServiceURL.Host).To(Equal("auth.example.com"))
+
+					hop, err := config.ValidateHopSignature(&passedReq.Header, forwardedUrl)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(hop).To(Equal(1))
+				})
+			})
+
+			Context("when the request returns from the last route service", func() {
+				BeforeEach(func() {
+					reqArgs, err := config.HopRequest("https://auth.example.com", forwardedUrl, 1)
+					Expect(err).ToNot(HaveOccurred())
+					req.Header.Set(routeservice.RouteServiceSignature, reqArgs.Signature)
+					req.Header.Set(routeservice.RouteServiceMetadata, reqArgs.Metadata)
+				})
+
+				It("strips headers and sends the request to the backend instance", func() {
+					handler.ServeHTTP(resp, req)
+
+					var passedReq *http.Request
+					Eventually(reqChan).Should(Receive(&passedReq))
+
+					Expect(passedReq.Header.Get(routeservice.RouteServiceSignature)).To(BeEmpty())
+					Expect(passedReq.Header.Get(routeservice.RouteServiceMetadata)).To(BeEmpty())
+					reqInfo, err := handlers.ContextRequestInfo(passedReq)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(reqInfo.RouteServiceURL).To(BeNil())
+				})
+			})
+		})
+
 		Context("when a bad route service url is used", func() {
 			BeforeEach(func() {
 				endpoint := route.NewEndpoint(
@@ -530,7 +626,7 @@ var _ = Describe("Route Service Handler", func() {
 		var badHandler *negroni.Negroni
 		BeforeEach(func() {
 			badHandler = negroni.New()
-			badHandler.Use(handlers.NewRouteService(config, fakeLogger, reg))
+			badHandler.Use(handlers.NewRouteService(config, fakeLogger, reg, internalLookup))
 			badHandler.UseHandlerFunc(nextHandler)
 		})
 		It("calls Fatal on the logger", func() {
@@ -545,7 +641,7 @@ var _ = Describe("Route Service Handler", func() {
 		BeforeEach(func() {
 			badHandler = negroni.New()
 			badHandler.Use(handlers.NewRequestInfo())
-			badHandler.Use(handlers.NewRouteService(config, fakeLogger, reg))
+			badHandler.Use(handlers.NewRouteService(config, fakeLogger, reg, internalLookup))
 			badHandler.UseHandlerFunc(nextHandler)
 		})
 		It("calls Fatal on the logger", func() {
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/registry"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/routeservice"
+	"code.cloudfoundry.org/gorouter/scripting"
+	"github.com/uber-go/zap"
+	"github.com/urfave/negroni"
+)
+
+type scriptHandler struct {
+	script   *scripting.Script
+	registry registry.Registry
+	logger   logger.Logger
+}
+
+// NewScripting creates a handler that calls the on_request hook of the script
+// for requests, followed by its on_backend_select hook, which selects the
+// endpoint they are sent to first. Requests whose host or path on_request
+// changes are routed to the route they match afterwards. It must run after
+// the route of the request has been looked up.
+func NewScripting(script *scripting.Script, registry registry.Registry, logger logger.Logger) negroni.Handler {
+	return &scriptHandler{
+		script:   script,
+		registry: registry,
+		logger:   logger,
+	}
+}
+
+func (s *scriptHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	reqInfo, err := ContextRequestInfo(r)
+	if err != nil {
+		s.logger.Fatal("request-info-err", zap.Error(err))
+		return
+	}
+
+	// requests returning from a route service were passed to on_request on
+	// their way to it
+	if !hasBeenToRouteService(reqInfo.RoutePool.RouteServiceUrl(), r.Header.Get(routeservice.RouteServiceSignature)) {
+		host, path := r.Host, r.URL.EscapedPath()
+		res, err := s.script.OnRequest(r, reqInfo.RoutePool)
+		if err != nil {
+			s.logger.Error("script-failed", zap.Error(err))
+			writeStatus(rw, http.StatusInternalServerError, "Script failed.", s.logger)
+			return
+		}
+		if res != nil {
+			writeScriptResponse(rw, res)
+			return
+		}
+
+		if r.Host != host || r.URL.EscapedPath() != path {
+			pool := s.registry.Lookup(route.Uri(hostWithoutPort(r.Host) + r.URL.EscapedPath()))
+			if pool == nil {
+				s.logger.Info("unknown-route")
+				rw.Header().Set("X-Cf-RouterError", "unknown_route")
+				writeStatus(rw, http.StatusNotFound, fmt.Sprintf("Requested route ('%s') does not exist.", r.Host), s.logger)
+				return
+			}
+			reqInfo.RoutePool = pool
+		}
+	}
+
+	endpoint, err := s.script.OnBackendSelect(r, reqInfo.RoutePool)
+	if err != nil {
+		// the load balancing algorithm selects the endpoint instead
+		s.logger.Error("script-failed", zap.Error(err))
+	} else if endpoint != nil {
+		reqInfo.InitialEndpointID = endpoint.CanonicalAddr()
+	}
+	next(rw, r)
+}
+
+func writeScriptResponse(rw http.ResponseWriter, res *http.Response) {
+	defer res.Body.Close()
+	for name, values := range res.Header {
+		rw.Header()[name] = values
+	}
+	rw.WriteHeader(res.StatusCode)
+	io.Copy(rw, res.Body)
+}
@@ -0,0 +1,162 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/handlers"
+	logger_fakes "code.cloudfoundry.org/gorouter/logger/fakes"
+	fakeRegistry "code.cloudfoundry.org/gorouter/registry/fakes"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/scripting"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/routing-api/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("Scripting", func() {
+	var (
+		handler     *negroni.Negroni
+		source      string
+		reg         *fakeRegistry.FakeRegistry
+		pool        *route.Pool
+		resp        *httptest.ResponseRecorder
+		req         *http.Request
+		nextCalled  bool
+		nextReqInfo *handlers.RequestInfo
+	)
+
+	nextHandler := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		nextCalled = true
+		var err error
+		nextReqInfo, err = handlers.ContextRequestInfo(req)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	BeforeEach(func() {
+		nextCalled = false
+		nextReqInfo = nil
+		reg = &fakeRegistry.FakeRegistry{}
+		pool = route.NewPool(2*time.Minute, "")
+		pool.Put(route.NewEndpoint("app-guid", "10.0.16.4", 8080, "instance-0", "0", nil, -1, "", models.ModificationTag{}, ""))
+		pool.Put(route.NewEndpoint("app-guid", "10.0.16.5", 8080, "instance-1", "1", map[string]string{"canary": "true"}, -1, "", models.ModificationTag{}, ""))
+		req = test_util.NewRequest("GET", "example.com", "/", nil)
+		resp = httptest.NewRecorder()
+	})
+
+	JustBeforeEach(func() {
+		logger := new(logger_fakes.FakeLogger)
+		script, err := scripting.NewScript(config.ScriptingConfig{Path: "test.star", MaxSteps: 1000, Source: []byte(source)}, logger)
+		Expect(err).ToNot(HaveOccurred())
+
+		handler = negroni.New()
+		handler.Use(handlers.NewRequestInfo())
+		handler.UseFunc(func(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+			reqInfo, err := handlers.ContextRequestInfo(req)
+			Expect(err).ToNot(HaveOccurred())
+			reqInfo.RoutePool = pool
+			next(rw, req)
+		})
+		handler.Use(handlers.NewScripting(script, reg, logger))
+		handler.UseHandler(nextHandler)
+
+		handler.ServeHTTP(resp, req)
+	})
+
+	Context("when on_request responds to the request", func() {
+		BeforeEach(func() {
+			source = `
+def on_request(req):
+    return response(301, headers={"Location": "https://example.com" + req.path})
+`
+		})
+
+		It("writes the response and does not call next", func() {
+			Expect(nextCalled).To(BeFalse())
+			Expect(resp.Code).To(Equal(http.StatusMovedPermanently))
+			Expect(resp.Header().Get("Location")).To(Equal("https://example.com/"))
+		})
+	})
+
+	Context("when on_request changes the host of the request", func() {
+		var newPool *route.Pool
+
+		BeforeEach(func() {
+			source = `
+def on_request(req):
+    req.host = "new.example.com"
+`
+			newPool = route.NewPool(2*time.Minute, "")
+			reg.LookupReturns(newPool)
+		})
+
+		It("routes the request to the route it matches", func() {
+			Expect(reg.LookupCallCount()).To(Equal(1))
+			Expect(reg.LookupArgsForCall(0)).To(Equal(route.Uri("new.example.com/")))
+			Expect(nextCalled).To(BeTrue())
+			Expect(nextReqInfo.RoutePool).To(BeIdenticalTo(newPool))
+		})
+
+		Context("when no route matches", func() {
+			BeforeEach(func() {
+				reg.LookupReturns(nil)
+			})
+
+			It("returns a 404 Not Found", func() {
+				Expect(nextCalled).To(BeFalse())
+				Expect(resp.Code).To(Equal(http.StatusNotFound))
+				Expect(resp.Header().Get("X-Cf-RouterError")).To(Equal("unknown_route"))
+			})
+		})
+	})
+
+	Context("when on_request fails", func() {
+		BeforeEach(func() {
+			source = `
+def on_request(req):
+    fail("broken")
+`
+		})
+
+		It("returns a 500 Internal Server Error", func() {
+			Expect(nextCalled).To(BeFalse())
+			Expect(resp.Code).To(Equal(http.StatusInternalServerError))
+		})
+	})
+
+	Context("when on_backend_select selects an endpoint", func() {
+		BeforeEach(func() {
+			source = `
+def on_backend_select(req, endpoints):
+    for e in endpoints:
+        if e.tags.get("canary") == "true":
+            return e
+`
+		})
+
+		It("sends the request to the endpoint first", func() {
+			Expect(reg.LookupCallCount()).To(Equal(0))
+			Expect(nextCalled).To(BeTrue())
+			Expect(nextReqInfo.InitialEndpointID).To(Equal("10.0.16.5:8080"))
+		})
+	})
+
+	Context("when on_backend_select fails", func() {
+		BeforeEach(func() {
+			source = `
+def on_backend_select(req, endpoints):
+    return endpoints[5]
+`
+		})
+
+		It("leaves the selection to the load balancing algorithm", func() {
+			Expect(nextCalled).To(BeTrue())
+			Expect(nextReqInfo.InitialEndpointID).To(BeEmpty())
+		})
+	})
+})
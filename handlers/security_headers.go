@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"github.com/urfave/negroni"
+)
+
+type securityHeaders struct {
+	header http.Header
+}
+
+// NewSecurityHeaders creates a handler that adds the configured security
+// headers to responses to requests received over TLS.
+func NewSecurityHeaders(cfg config.SecurityHeadersConfig) negroni.Handler {
+	return &securityHeaders{
+		header: SecurityHeaders(cfg),
+	}
+}
+
+func (s *securityHeaders) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if r.TLS != nil {
+		for name, values := range s.header {
+			rw.Header()[name] = values
+		}
+	}
+	next(rw, r)
+}
+
+// SecurityHeaders returns the headers enabled by the configuration.
+func SecurityHeaders(cfg config.SecurityHeadersConfig) http.Header {
+	header := http.Header{}
+	if hsts := cfg.StrictTransportSecurity; hsts.Enabled {
+		value := "max-age=" + strconv.Itoa(int(hsts.MaxAge.Seconds()))
+		if hsts.IncludeSubDomains {
+			value += "; includeSubDomains"
+		}
+		header.Set("Strict-Transport-Security", value)
+	}
+	if cfg.ContentTypeOptions {
+		header.Set("X-Content-Type-Options", "nosniff")
+	}
+	if cfg.FrameOptions != "" {
+		header.Set("X-Frame-Options", cfg.FrameOptions)
+	}
+	return header
+}
@@ -0,0 +1,76 @@
+package handlers_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/handlers"
+	"code.cloudfoundry.org/gorouter/test_util"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("SecurityHeaders", func() {
+	var (
+		cfg  config.SecurityHeadersConfig
+		req  *http.Request
+		resp *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		cfg = config.SecurityHeadersConfig{
+			StrictTransportSecurity: config.StrictTransportSecurityConfig{
+				Enabled: true,
+				MaxAge:  365 * 24 * time.Hour,
+			},
+			ContentTypeOptions: true,
+			FrameOptions:       "SAMEORIGIN",
+		}
+		req = test_util.NewRequest("GET", "example.com", "/", nil)
+		req.TLS = &tls.ConnectionState{}
+		resp = httptest.NewRecorder()
+	})
+
+	JustBeforeEach(func() {
+		handler := negroni.New()
+		handler.Use(handlers.NewSecurityHeaders(cfg))
+		handler.UseHandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(http.StatusOK)
+		})
+		handler.ServeHTTP(resp, req)
+	})
+
+	It("adds the enabled headers to responses to TLS requests", func() {
+		Expect(resp.Header().Get("Strict-Transport-Security")).To(Equal("max-age=31536000"))
+		Expect(resp.Header().Get("X-Content-Type-Options")).To(Equal("nosniff"))
+		Expect(resp.Header().Get("X-Frame-Options")).To(Equal("SAMEORIGIN"))
+	})
+
+	Context("when only some headers are enabled", func() {
+		BeforeEach(func() {
+			cfg.StrictTransportSecurity.Enabled = false
+			cfg.FrameOptions = ""
+		})
+
+		It("adds only those headers", func() {
+			Expect(resp.Header()).ToNot(HaveKey("Strict-Transport-Security"))
+			Expect(resp.Header()).ToNot(HaveKey("X-Frame-Options"))
+			Expect(resp.Header().Get("X-Content-Type-Options")).To(Equal("nosniff"))
+		})
+	})
+
+	Context("when the request is not received over TLS", func() {
+		BeforeEach(func() {
+			req.TLS = nil
+		})
+
+		It("does not add the headers", func() {
+			Expect(resp.Header()).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/proxy/utils"
+
+	"github.com/uber-go/zap"
+	"github.com/urfave/negroni"
+)
+
+type slowRequestLog struct {
+	threshold time.Duration
+	logger    logger.Logger
+}
+
+// NewSlowRequestLog creates a handler that logs the requests taking at least
+// threshold, with the timing of their round trip to the endpoint, regardless
+// of the sampling of the access log.
+func NewSlowRequestLog(threshold time.Duration, logger logger.Logger) negroni.Handler {
+	return &slowRequestLog{
+		threshold: threshold,
+		logger:    logger,
+	}
+}
+
+func (s *slowRequestLog) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	reqInfo, err := ContextRequestInfo(r)
+	if err != nil {
+		s.logger.Fatal("request-info-err", zap.Error(err))
+		return
+	}
+	reqInfo.RecordTiming = true
+
+	startedAt := time.Now()
+	next(rw, r)
+	total := time.Since(startedAt)
+	if total < s.threshold {
+		return
+	}
+
+	retries := reqInfo.Attempts - 1
+	if retries < 0 {
+		retries = 0
+	}
+	RequestLogger(s.logger, r).Info("slow-request",
+		zap.String("host", r.Host),
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.RequestURI()),
+		zap.Int("status", rw.(utils.ProxyResponseWriter).Status()),
+		zap.Duration("total", total),
+		zap.Duration("dns", reqInfo.Timing.DNS),
+		zap.Duration("dial", reqInfo.Timing.Dial),
+		zap.Duration("tls", reqInfo.Timing.TLS),
+		zap.Duration("ttfb", reqInfo.Timing.TTFB),
+		zap.Bool("reused", reqInfo.Timing.Reused),
+		zap.Int("retries", retries),
+	)
+}
@@ -0,0 +1,80 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/handlers"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/routing-api/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("SlowRequestLog", func() {
+	var (
+		handler      *negroni.Negroni
+		logger       *test_util.TestZapLogger
+		delay        time.Duration
+		recordTiming bool
+	)
+
+	BeforeEach(func() {
+		logger = test_util.NewTestZapLogger("test")
+		delay = 0
+		recordTiming = false
+
+		handler = negroni.New()
+		handler.Use(handlers.NewRequestInfo())
+		handler.Use(handlers.NewProxyWriter(logger))
+		handler.Use(handlers.NewSlowRequestLog(20*time.Millisecond, logger))
+		handler.UseHandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			reqInfo, err := handlers.ContextRequestInfo(req)
+			Expect(err).ToNot(HaveOccurred())
+			recordTiming = reqInfo.RecordTiming
+			reqInfo.RouteEndpoint = route.NewEndpoint("app-guid", "1.2.3.4", 5678, "instance-guid", "2", nil, -1, "", models.ModificationTag{}, "")
+			reqInfo.Attempts = 2
+			reqInfo.Timing = handlers.RequestTiming{Dial: time.Millisecond, TTFB: 15 * time.Millisecond}
+
+			time.Sleep(delay)
+			rw.WriteHeader(http.StatusOK)
+		})
+	})
+
+	JustBeforeEach(func() {
+		req := test_util.NewRequest("GET", "example.com", "/slow?q=1", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	It("asks for the timing of the request to be recorded", func() {
+		Expect(recordTiming).To(BeTrue())
+	})
+
+	It("does not log requests faster than the threshold", func() {
+		Expect(logger.Buffer()).ToNot(gbytes.Say("slow-request"))
+	})
+
+	Context("when the request takes at least the threshold", func() {
+		BeforeEach(func() {
+			delay = 30 * time.Millisecond
+		})
+
+		It("logs the request with its timing and endpoint", func() {
+			Expect(logger.Buffer()).To(gbytes.Say("slow-request"))
+			log := string(logger.Buffer().Contents())
+			Expect(log).To(ContainSubstring(`"path":"/slow?q=1"`))
+			Expect(log).To(ContainSubstring(`"status":200`))
+			Expect(log).To(ContainSubstring(`"ttfb":15000000`))
+			Expect(log).To(ContainSubstring(`"retries":1`))
+			Expect(log).To(ContainSubstring(`"endpoint":"1.2.3.4:5678"`))
+			Expect(log).To(ContainSubstring(`"app_id":"app-guid"`))
+			Expect(log).To(ContainSubstring(`"app_index":"2"`))
+			Expect(log).To(ContainSubstring(`"instance_id":"instance-guid"`))
+		})
+	})
+})
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/uber-go/zap"
+	"github.com/urfave/negroni"
+
+	router_http "code.cloudfoundry.org/gorouter/common/http"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/proxy/utils"
+	"code.cloudfoundry.org/gorouter/tracing"
+)
+
+// Tracing is a handler that records a span for each sampled request and
+// passes it to an exporter once the response has been written
+type Tracing struct {
+	exporter         tracing.Exporter
+	samplePercentage float64
+	propagateB3      bool
+	propagateW3C     bool
+	logger           logger.Logger
+}
+
+var _ negroni.Handler = new(Tracing)
+
+// NewTracing creates a new handler that records spans of requests. Requests
+// that continue a trace are sampled as decided by the client, and the
+// samplePercentage of other requests are sampled. The trace headers of the
+// given propagation formats are set to identify the span to the backend.
+func NewTracing(exporter tracing.Exporter, samplePercentage float64, propagation []string, logger logger.Logger) *Tracing {
+	return &Tracing{
+		exporter:         exporter,
+		samplePercentage: samplePercentage,
+		propagateB3:      contains(propagation, config.TRACE_PROPAGATION_B3),
+		propagateW3C:     contains(propagation, config.TRACE_PROPAGATION_W3C),
+		logger:           logger,
+	}
+}
+
+func (t *Tracing) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	span, err := t.startSpan(r)
+	if err != nil {
+		t.logger.Info("failed-to-start-span", zap.Error(err))
+	}
+
+	next(rw, r)
+	if span == nil {
+		return
+	}
+
+	span.End = time.Now()
+	span.Attributes = map[string]interface{}{
+		"http.request.method": r.Method,
+		"url.path":            r.URL.Path,
+		"server.address":      hostWithoutPort(r.Host),
+	}
+	if userAgent := r.UserAgent(); userAgent != "" {
+		span.Attributes["user_agent.original"] = userAgent
+	}
+
+	if proxyWriter, ok := rw.(utils.ProxyResponseWriter); ok {
+		status := proxyWriter.Status()
+		span.Attributes["http.response.status_code"] = status
+		if status >= http.StatusInternalServerError {
+			span.Status = tracing.StatusError
+		}
+		if routerError := proxyWriter.Header().Get(router_http.CfRouterError); routerError != "" {
+			span.Attributes["gorouter.error"] = routerError
+		}
+	}
+
+	if reqInfo, err := ContextRequestInfo(r); err == nil {
+		if reqInfo.RouteEndpoint != nil {
+			span.Attributes["network.peer.address"] = reqInfo.RouteEndpoint.CanonicalAddr()
+			if reqInfo.RouteEndpoint.ApplicationId != "" {
+				span.Attributes["gorouter.app_id"] = reqInfo.RouteEndpoint.ApplicationId
+			}
+		}
+		if reqInfo.Attempts > 1 {
+			span.Attributes["http.request.resend_count"] = reqInfo.Attempts - 1
+		}
+		if !reqInfo.StoppedAt.IsZero() {
+			span.Attributes["gorouter.response_latency_ms"] = float64(reqInfo.StoppedAt.Sub(reqInfo.StartedAt)) / float64(time.Millisecond)
+		}
+	}
+
+	t.exporter.Export(span)
+}
+
+// startSpan returns the span of the request, continuing the trace of the
+// traceparent or B3 headers of the request if there is one, or nil if the
+// request is not sampled. The trace headers are set to identify the span to
+// the backend.
+func (t *Tracing) startSpan(r *http.Request) (*tracing.Span, error) {
+	span := &tracing.Span{
+		Name:  r.Method,
+		Kind:  tracing.SpanKindServer,
+		Start: time.Now(),
+	}
+
+	var err error
+	span.SpanID, err = tracing.NewSpanID()
+	if err != nil {
+		return nil, err
+	}
+
+	var decision string
+	if traceID, parentID, sampled, ok := tracing.ParseTraceparent(r.Header.Get(W3CTraceparentHeader)); ok {
+		span.TraceID = traceID
+		span.ParentSpanID = parentID
+		decision = "0"
+		if sampled {
+			decision = "1"
+		}
+	} else {
+		// the tracestate of an invalid traceparent must not be propagated
+		r.Header.Del(W3CTracestateHeader)
+
+		traceID, traceOK := tracing.ParseTraceID(r.Header.Get(B3TraceIdHeader))
+		parentID, parentOK := tracing.ParseSpanID(r.Header.Get(B3SpanIdHeader))
+		if traceOK && parentOK {
+			span.TraceID = traceID
+			span.ParentSpanID = parentID
+		} else {
+			span.TraceID, err = tracing.NewTraceID()
+			if err != nil {
+				return nil, err
+			}
+		}
+		decision = r.Header.Get(B3SampledHeader)
+	}
+	sampled := t.sampled(decision)
+
+	if t.propagateB3 {
+		// 64-bit trace IDs of the caller are forwarded as they were received
+		if traceID, ok := tracing.ParseTraceID(r.Header.Get(B3TraceIdHeader)); !ok || traceID != span.TraceID {
+			r.Header.Set(B3TraceIdHeader, span.TraceID.String())
+		}
+		r.Header.Set(B3SpanIdHeader, span.SpanID.String())
+		if span.ParentSpanID.IsValid() {
+			r.Header.Set(B3ParentSpanIdHeader, span.ParentSpanID.String())
+		} else {
+			r.Header.Del(B3ParentSpanIdHeader)
+		}
+		if sampled {
+			r.Header.Set(B3SampledHeader, "1")
+		} else {
+			r.Header.Set(B3SampledHeader, "0")
+		}
+	}
+	if t.propagateW3C {
+		r.Header.Set(W3CTraceparentHeader, tracing.FormatTraceparent(span.TraceID, span.SpanID, sampled))
+	}
+
+	if !sampled {
+		return nil, nil
+	}
+	return span, nil
+}
+
+func (t *Tracing) sampled(decision string) bool {
+	switch strings.ToLower(decision) {
+	case "1", "true":
+		return true
+	case "0", "false":
+		return false
+	}
+	return rand.Float64()*100 < t.samplePercentage
+}
+
+// isNotSampled returns whether the X-B3-Sampled header is a decision not to
+// sample the trace.
+func isNotSampled(decision string) bool {
+	decision = strings.ToLower(decision)
+	return decision == "0" || decision == "false"
+}
@@ -0,0 +1,219 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/handlers"
+	logger_fakes "code.cloudfoundry.org/gorouter/logger/fakes"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/gorouter/tracing"
+	tracing_fakes "code.cloudfoundry.org/gorouter/tracing/fakes"
+	"code.cloudfoundry.org/routing-api/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("Tracing", func() {
+	var (
+		handler          *negroni.Negroni
+		exporter         *tracing_fakes.FakeExporter
+		samplePercentage float64
+		propagation      []string
+		status           int
+
+		resp *httptest.ResponseRecorder
+		req  *http.Request
+
+		backendHeaders http.Header
+	)
+
+	BeforeEach(func() {
+		exporter = new(tracing_fakes.FakeExporter)
+		samplePercentage = 100
+		propagation = []string{config.TRACE_PROPAGATION_B3}
+		status = http.StatusOK
+
+		req = test_util.NewRequest("GET", "example.com:8080", "/foo?bar=baz", nil)
+		req.Header.Set("User-Agent", "curl")
+		resp = httptest.NewRecorder()
+	})
+
+	JustBeforeEach(func() {
+		fakeLogger := new(logger_fakes.FakeLogger)
+		handler = negroni.New()
+		handler.Use(handlers.NewRequestInfo())
+		handler.Use(handlers.NewProxyWriter(fakeLogger))
+		handler.Use(handlers.NewTracing(exporter, samplePercentage, propagation, fakeLogger))
+		handler.UseHandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			backendHeaders = r.Header
+			reqInfo, err := handlers.ContextRequestInfo(r)
+			Expect(err).NotTo(HaveOccurred())
+			reqInfo.RouteEndpoint = route.NewEndpoint(
+				"appID", "10.0.0.1", uint16(1234), "id", "1", nil, 0, "",
+				models.ModificationTag{}, "")
+			reqInfo.Attempts = 2
+			reqInfo.StoppedAt = time.Now()
+			rw.WriteHeader(status)
+		})
+	})
+
+	It("exports a span of the request", func() {
+		handler.ServeHTTP(resp, req)
+
+		Expect(exporter.ExportCallCount()).To(Equal(1))
+		span := exporter.ExportArgsForCall(0)
+		Expect(span.TraceID.IsValid()).To(BeTrue())
+		Expect(span.SpanID.IsValid()).To(BeTrue())
+		Expect(span.ParentSpanID.IsValid()).To(BeFalse())
+		Expect(span.Name).To(Equal("GET"))
+		Expect(span.Kind).To(Equal(tracing.SpanKindServer))
+		Expect(span.Start).To(BeTemporally("~", time.Now(), 100*time.Millisecond))
+		Expect(span.End).To(BeTemporally(">=", span.Start))
+		Expect(span.Status).To(Equal(tracing.StatusUnset))
+		Expect(span.Attributes).To(HaveKeyWithValue("http.request.method", "GET"))
+		Expect(span.Attributes).To(HaveKeyWithValue("url.path", "/foo"))
+		Expect(span.Attributes).To(HaveKeyWithValue("server.address", "example.com"))
+		Expect(span.Attributes).To(HaveKeyWithValue("user_agent.original", "curl"))
+		Expect(span.Attributes).To(HaveKeyWithValue("http.response.status_code", http.StatusOK))
+		Expect(span.Attributes).To(HaveKeyWithValue("network.peer.address", "10.0.0.1:1234"))
+		Expect(span.Attributes).To(HaveKeyWithValue("gorouter.app_id", "appID"))
+		Expect(span.Attributes).To(HaveKeyWithValue("http.request.resend_count", 1))
+		Expect(span.Attributes).To(HaveKey("gorouter.response_latency_ms"))
+	})
+
+	It("sets the B3 headers of the span on the request to the backend", func() {
+		handler.ServeHTTP(resp, req)
+
+		span := exporter.ExportArgsForCall(0)
+		Expect(backendHeaders.Get(handlers.B3TraceIdHeader)).To(Equal(span.TraceID.String()))
+		Expect(backendHeaders.Get(handlers.B3SpanIdHeader)).To(Equal(span.SpanID.String()))
+		Expect(backendHeaders.Get(handlers.B3ParentSpanIdHeader)).To(BeEmpty())
+		Expect(backendHeaders.Get(handlers.B3SampledHeader)).To(Equal("1"))
+		Expect(backendHeaders.Get(handlers.W3CTraceparentHeader)).To(BeEmpty())
+	})
+
+	Context("when the request continues a trace", func() {
+		BeforeEach(func() {
+			req.Header.Set(handlers.B3TraceIdHeader, "463ac35c9f6413ad")
+			req.Header.Set(handlers.B3SpanIdHeader, "a2fb4a1d1a96d312")
+		})
+
+		It("records the span in the trace", func() {
+			handler.ServeHTTP(resp, req)
+
+			span := exporter.ExportArgsForCall(0)
+			Expect(span.TraceID.String()).To(Equal("0000000000000000463ac35c9f6413ad"))
+			Expect(span.ParentSpanID.String()).To(Equal("a2fb4a1d1a96d312"))
+
+			Expect(backendHeaders.Get(handlers.B3TraceIdHeader)).To(Equal("463ac35c9f6413ad"))
+			Expect(backendHeaders.Get(handlers.B3SpanIdHeader)).To(Equal(span.SpanID.String()))
+			Expect(backendHeaders.Get(handlers.B3ParentSpanIdHeader)).To(Equal("a2fb4a1d1a96d312"))
+		})
+
+		Context("when the client decided not to sample the trace", func() {
+			BeforeEach(func() {
+				req.Header.Set(handlers.B3SampledHeader, "0")
+			})
+
+			It("does not export a span", func() {
+				handler.ServeHTTP(resp, req)
+				Expect(exporter.ExportCallCount()).To(Equal(0))
+				Expect(backendHeaders.Get(handlers.B3SampledHeader)).To(Equal("0"))
+			})
+		})
+	})
+
+	Context("with W3C propagation", func() {
+		BeforeEach(func() {
+			propagation = []string{config.TRACE_PROPAGATION_W3C}
+		})
+
+		It("sets the traceparent of the span on the request to the backend", func() {
+			handler.ServeHTTP(resp, req)
+
+			span := exporter.ExportArgsForCall(0)
+			Expect(backendHeaders.Get(handlers.W3CTraceparentHeader)).To(Equal(tracing.FormatTraceparent(span.TraceID, span.SpanID, true)))
+			Expect(backendHeaders.Get(handlers.B3TraceIdHeader)).To(BeEmpty())
+		})
+
+		Context("when the request has a traceparent", func() {
+			BeforeEach(func() {
+				req.Header.Set(handlers.W3CTraceparentHeader, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+				req.Header.Set(handlers.W3CTracestateHeader, "congo=t61rcWkgMzE")
+			})
+
+			It("records the span in the trace and forwards the tracestate", func() {
+				handler.ServeHTTP(resp, req)
+
+				span := exporter.ExportArgsForCall(0)
+				Expect(span.TraceID.String()).To(Equal("0af7651916cd43dd8448eb211c80319c"))
+				Expect(span.ParentSpanID.String()).To(Equal("b7ad6b7169203331"))
+				Expect(backendHeaders.Get(handlers.W3CTraceparentHeader)).To(Equal("00-0af7651916cd43dd8448eb211c80319c-" + span.SpanID.String() + "-01"))
+				Expect(backendHeaders.Get(handlers.W3CTracestateHeader)).To(Equal("congo=t61rcWkgMzE"))
+			})
+
+			It("respects the sampling decision of the caller", func() {
+				req.Header.Set(handlers.W3CTraceparentHeader, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00")
+				handler.ServeHTTP(resp, req)
+
+				Expect(exporter.ExportCallCount()).To(Equal(0))
+				Expect(backendHeaders.Get(handlers.W3CTraceparentHeader)).To(HaveSuffix("-00"))
+			})
+		})
+
+		Context("with B3 propagation too", func() {
+			BeforeEach(func() {
+				propagation = []string{config.TRACE_PROPAGATION_B3, config.TRACE_PROPAGATION_W3C}
+				req.Header.Set(handlers.W3CTraceparentHeader, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+			})
+
+			It("sets the headers of the span in both formats", func() {
+				handler.ServeHTTP(resp, req)
+
+				span := exporter.ExportArgsForCall(0)
+				Expect(backendHeaders.Get(handlers.B3TraceIdHeader)).To(Equal("0af7651916cd43dd8448eb211c80319c"))
+				Expect(backendHeaders.Get(handlers.B3SpanIdHeader)).To(Equal(span.SpanID.String()))
+				Expect(backendHeaders.Get(handlers.B3ParentSpanIdHeader)).To(Equal("b7ad6b7169203331"))
+				Expect(backendHeaders.Get(handlers.W3CTraceparentHeader)).To(Equal("00-0af7651916cd43dd8448eb211c80319c-" + span.SpanID.String() + "-01"))
+			})
+		})
+	})
+
+	Context("when the sample percentage is 0", func() {
+		BeforeEach(func() {
+			samplePercentage = 0
+		})
+
+		It("does not export spans", func() {
+			handler.ServeHTTP(resp, req)
+			Expect(exporter.ExportCallCount()).To(Equal(0))
+			Expect(backendHeaders.Get(handlers.B3SampledHeader)).To(Equal("0"))
+		})
+
+		It("exports spans the client decided to sample", func() {
+			req.Header.Set(handlers.B3SampledHeader, "1")
+			handler.ServeHTTP(resp, req)
+			Expect(exporter.ExportCallCount()).To(Equal(1))
+		})
+	})
+
+	Context("when the response is a server error", func() {
+		BeforeEach(func() {
+			status = http.StatusBadGateway
+		})
+
+		It("sets the error status on the span", func() {
+			handler.ServeHTTP(resp, req)
+
+			span := exporter.ExportArgsForCall(0)
+			Expect(span.Status).To(Equal(tracing.StatusError))
+			Expect(span.Attributes).To(HaveKeyWithValue("http.response.status_code", http.StatusBadGateway))
+		})
+	})
+})
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"github.com/uber-go/zap"
+	"github.com/urfave/negroni"
+)
+
+type virtualHost struct {
+	virtualHosts []config.VirtualHostConfig
+	logger       logger.Logger
+}
+
+// NewVirtualHost creates a handler that sets the virtual host of requests
+// whose host matches one, whose settings the handlers after it and the round
+// trip to the endpoint use in place of those of the router. Requests sent
+// over a TLS version older than the minimum of their virtual host are
+// answered with 403 Forbidden. It must run after the route of the request
+// has been looked up.
+func NewVirtualHost(virtualHosts []config.VirtualHostConfig, logger logger.Logger) negroni.Handler {
+	return &virtualHost{
+		virtualHosts: virtualHosts,
+		logger:       logger,
+	}
+}
+
+func (v *virtualHost) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	reqInfo, err := ContextRequestInfo(r)
+	if err != nil {
+		v.logger.Fatal("request-info-err", zap.Error(err))
+		return
+	}
+
+	vh := config.MatchVirtualHost(v.virtualHosts, hostWithoutPort(r.Host))
+	reqInfo.VirtualHost = vh
+	if vh == nil {
+		next(rw, r)
+		return
+	}
+
+	if r.TLS != nil && r.TLS.Version < vh.MinTLSVersion {
+		rw.Header().Set("X-Cf-RouterError", "tls_version_not_allowed")
+		writeStatus(
+			rw,
+			http.StatusForbidden,
+			"TLS version is older than the minimum of the host.",
+			RequestLogger(v.logger, r),
+		)
+		return
+	}
+	next(rw, r)
+}
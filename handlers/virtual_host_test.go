@@ -0,0 +1,109 @@
+package handlers_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/handlers"
+	logger_fakes "code.cloudfoundry.org/gorouter/logger/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("VirtualHost", func() {
+	var (
+		handler     *negroni.Negroni
+		req         *http.Request
+		resp        *httptest.ResponseRecorder
+		nextCalled  bool
+		virtualHost *config.VirtualHostConfig
+	)
+
+	BeforeEach(func() {
+		virtualHosts := []config.VirtualHostConfig{
+			{Domain: "*.tenant.example.com", MinTLSVersion: tls.VersionTLS12, ForceHTTPS: true},
+			{Domain: "other.example.com"},
+		}
+		nextCalled = false
+		virtualHost = nil
+		resp = httptest.NewRecorder()
+
+		handler = negroni.New()
+		handler.Use(handlers.NewRequestInfo())
+		handler.Use(handlers.NewVirtualHost(virtualHosts, new(logger_fakes.FakeLogger)))
+		handler.Use(handlers.NewForceHTTPS(false, false, new(logger_fakes.FakeLogger)))
+		handler.UseHandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			nextCalled = true
+			reqInfo, err := handlers.ContextRequestInfo(req)
+			Expect(err).ToNot(HaveOccurred())
+			virtualHost = reqInfo.VirtualHost
+			rw.WriteHeader(http.StatusOK)
+		})
+	})
+
+	JustBeforeEach(func() {
+		handler.ServeHTTP(resp, req)
+	})
+
+	Context("when the request is for a virtual host", func() {
+		BeforeEach(func() {
+			req = httptest.NewRequest("GET", "http://other.example.com:8080/", nil)
+		})
+
+		It("sets the virtual host of the request", func() {
+			Expect(nextCalled).To(BeTrue())
+			Expect(virtualHost).ToNot(BeNil())
+			Expect(virtualHost.Domain).To(Equal("other.example.com"))
+		})
+	})
+
+	Context("when the request is for another host", func() {
+		BeforeEach(func() {
+			req = httptest.NewRequest("GET", "http://example.com/", nil)
+		})
+
+		It("sets no virtual host", func() {
+			Expect(nextCalled).To(BeTrue())
+			Expect(virtualHost).To(BeNil())
+		})
+	})
+
+	Context("when the virtual host has a minimum TLS version", func() {
+		BeforeEach(func() {
+			req = httptest.NewRequest("GET", "https://app.tenant.example.com/", nil)
+			req.TLS = &tls.ConnectionState{Version: tls.VersionTLS13}
+		})
+
+		It("proxies requests over the minimum TLS version", func() {
+			Expect(resp.Code).To(Equal(http.StatusOK))
+			Expect(virtualHost.Domain).To(Equal("*.tenant.example.com"))
+		})
+
+		Context("when the request is over an older TLS version", func() {
+			BeforeEach(func() {
+				req.TLS = &tls.ConnectionState{Version: tls.VersionTLS11}
+			})
+
+			It("rejects the request", func() {
+				Expect(resp.Code).To(Equal(http.StatusForbidden))
+				Expect(resp.Header().Get("X-Cf-RouterError")).To(Equal("tls_version_not_allowed"))
+				Expect(nextCalled).To(BeFalse())
+			})
+		})
+	})
+
+	Context("when the virtual host forces HTTPS", func() {
+		BeforeEach(func() {
+			req = httptest.NewRequest("GET", "http://app.tenant.example.com/path", nil)
+		})
+
+		It("redirects plain HTTP requests", func() {
+			Expect(resp.Code).To(Equal(http.StatusMovedPermanently))
+			Expect(resp.Header().Get("Location")).To(Equal("https://app.tenant.example.com/path"))
+		})
+	})
+})
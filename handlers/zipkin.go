@@ -7,7 +7,9 @@ import (
 	"github.com/uber-go/zap"
 	"github.com/urfave/negroni"
 
+	"code.cloudfoundry.org/gorouter/config"
 	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/tracing"
 
 	"code.cloudfoundry.org/gorouter/common/secure"
 )
@@ -16,21 +18,30 @@ const (
 	B3TraceIdHeader      = "X-B3-TraceId"
 	B3SpanIdHeader       = "X-B3-SpanId"
 	B3ParentSpanIdHeader = "X-B3-ParentSpanId"
+	B3SampledHeader      = "X-B3-Sampled"
+
+	W3CTraceparentHeader = "traceparent"
+	W3CTracestateHeader  = "tracestate"
 )
 
-// Zipkin is a handler that sets Zipkin headers on requests
+// Zipkin is a handler that sets trace headers on requests
 type Zipkin struct {
 	zipkinEnabled bool
+	propagateB3   bool
+	propagateW3C  bool
 	logger        logger.Logger
 	headersToLog  []string // Shared state with proxy for access logs
 }
 
 var _ negroni.Handler = new(Zipkin)
 
-// NewZipkin creates a new handler that sets Zipkin headers on requests
-func NewZipkin(enabled bool, headersToLog []string, logger logger.Logger) *Zipkin {
+// NewZipkin creates a new handler that sets the trace headers of the given
+// propagation formats on requests
+func NewZipkin(enabled bool, propagation []string, headersToLog []string, logger logger.Logger) *Zipkin {
 	return &Zipkin{
 		zipkinEnabled: enabled,
+		propagateB3:   contains(propagation, config.TRACE_PROPAGATION_B3),
+		propagateW3C:  contains(propagation, config.TRACE_PROPAGATION_W3C),
 		headersToLog:  headersToLog,
 		logger:        logger,
 	}
@@ -42,26 +53,71 @@ func (z *Zipkin) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.Ha
 		return
 	}
 
+	if z.propagateB3 {
+		z.setB3Headers(r)
+	}
+	if z.propagateW3C {
+		z.setTraceparent(r)
+	}
+}
+
+func (z *Zipkin) setB3Headers(r *http.Request) {
 	existingTraceId := r.Header.Get(B3TraceIdHeader)
 	existingSpanId := r.Header.Get(B3SpanIdHeader)
 
-	if existingTraceId == "" || existingSpanId == "" {
-		randBytes, err := secure.RandomBytes(8)
-		if err != nil {
-			z.logger.Info("failed-to-create-b3-trace-id", zap.Error(err))
-			return
-		}
-
-		id := hex.EncodeToString(randBytes)
-		r.Header.Set(B3TraceIdHeader, id)
-		r.Header.Set(B3SpanIdHeader, r.Header.Get(B3TraceIdHeader))
-	} else {
+	if existingTraceId != "" && existingSpanId != "" {
 		z.logger.Debug("b3-trace-id-span-id-header-exists",
 			zap.String("B3TraceIdHeader", existingTraceId),
 			zap.String("B3SpanIdHeader", existingSpanId),
 		)
+		return
+	}
+
+	// continue the trace of the caller when it only sent a traceparent
+	if traceID, spanID, _, ok := tracing.ParseTraceparent(r.Header.Get(W3CTraceparentHeader)); ok {
+		r.Header.Set(B3TraceIdHeader, traceID.String())
+		r.Header.Set(B3SpanIdHeader, spanID.String())
+		return
+	}
+
+	randBytes, err := secure.RandomBytes(8)
+	if err != nil {
+		z.logger.Info("failed-to-create-b3-trace-id", zap.Error(err))
+		return
 	}
-	return
+
+	id := hex.EncodeToString(randBytes)
+	r.Header.Set(B3TraceIdHeader, id)
+	r.Header.Set(B3SpanIdHeader, r.Header.Get(B3TraceIdHeader))
+}
+
+func (z *Zipkin) setTraceparent(r *http.Request) {
+	existing := r.Header.Get(W3CTraceparentHeader)
+	if _, _, _, ok := tracing.ParseTraceparent(existing); ok {
+		z.logger.Debug("traceparent-header-exists", zap.String("traceparent", existing))
+		return
+	}
+	// the tracestate of an invalid traceparent must not be propagated
+	r.Header.Del(W3CTracestateHeader)
+
+	sampled := !isNotSampled(r.Header.Get(B3SampledHeader))
+	traceID, traceOK := tracing.ParseTraceID(r.Header.Get(B3TraceIdHeader))
+	spanID, spanOK := tracing.ParseSpanID(r.Header.Get(B3SpanIdHeader))
+	if traceOK && spanOK {
+		r.Header.Set(W3CTraceparentHeader, tracing.FormatTraceparent(traceID, spanID, sampled))
+		return
+	}
+
+	var err error
+	traceID, err = tracing.NewTraceID()
+	if err == nil {
+		spanID, err = tracing.NewSpanID()
+	}
+	if err != nil {
+		z.logger.Info("failed-to-create-traceparent", zap.Error(err))
+		return
+	}
+	r.Header.Set(W3CTraceparentHeader, tracing.FormatTraceparent(traceID, spanID, sampled))
 }
 
 // HeadersToLog returns headers that should be logged in the access logs and
@@ -71,6 +127,13 @@ func (z *Zipkin) HeadersToLog() []string {
 		return z.headersToLog
 	}
 	headersToLog := z.headersToLog
+	if z.propagateW3C && !contains(headersToLog, W3CTraceparentHeader) {
+		headersToLog = append(headersToLog, W3CTraceparentHeader)
+	}
+	if !z.propagateB3 {
+		return headersToLog
+	}
+
 	if !contains(headersToLog, B3TraceIdHeader) {
 		headersToLog = append(headersToLog, B3TraceIdHeader)
 	}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 
+	"code.cloudfoundry.org/gorouter/config"
 	"code.cloudfoundry.org/gorouter/handlers"
 	"code.cloudfoundry.org/gorouter/test_util"
 
@@ -15,10 +16,13 @@ import (
 // 64-bit random hexadecimal string
 const b3_id_regex = `^[[:xdigit:]]{16}$`
 
+const traceparent_regex = `^00-[[:xdigit:]]{32}-[[:xdigit:]]{16}-01$`
+
 var _ = Describe("Zipkin", func() {
 	var (
 		handler      *handlers.Zipkin
 		headersToLog []string
+		propagation  []string
 		logger       logger.Logger
 		resp         http.ResponseWriter
 		req          *http.Request
@@ -35,6 +39,7 @@ var _ = Describe("Zipkin", func() {
 		resp = httptest.NewRecorder()
 		nextCalled = false
 		headersToLog = []string{"foo-header"}
+		propagation = []string{config.TRACE_PROPAGATION_B3}
 	})
 
 	AfterEach(func() {
@@ -42,7 +47,7 @@ var _ = Describe("Zipkin", func() {
 
 	Context("with Zipkin enabled", func() {
 		BeforeEach(func() {
-			handler = handlers.NewZipkin(true, headersToLog, logger)
+			handler = handlers.NewZipkin(true, propagation, headersToLog, logger)
 		})
 
 		It("sets zipkin headers", func() {
@@ -156,9 +161,89 @@ var _ = Describe("Zipkin", func() {
 		})
 	})
 
+	Context("with W3C propagation", func() {
+		BeforeEach(func() {
+			propagation = []string{config.TRACE_PROPAGATION_W3C}
+		})
+
+		JustBeforeEach(func() {
+			handler = handlers.NewZipkin(true, propagation, headersToLog, logger)
+		})
+
+		It("sets a traceparent header instead of zipkin headers", func() {
+			handler.ServeHTTP(resp, req, nextHandler)
+			Expect(req.Header.Get(handlers.W3CTraceparentHeader)).To(MatchRegexp(traceparent_regex))
+			Expect(req.Header.Get(handlers.B3TraceIdHeader)).To(BeEmpty())
+			Expect(req.Header.Get(handlers.B3SpanIdHeader)).To(BeEmpty())
+
+			Expect(nextCalled).To(BeTrue(), "Expected the next handler to be called.")
+		})
+
+		It("adds the traceparent header to access log record", func() {
+			newHeadersToLog := handler.HeadersToLog()
+			Expect(newHeadersToLog).To(ContainElement(handlers.W3CTraceparentHeader))
+			Expect(newHeadersToLog).NotTo(ContainElement(handlers.B3TraceIdHeader))
+		})
+
+		Context("with a valid traceparent and tracestate already set", func() {
+			BeforeEach(func() {
+				req.Header.Set(handlers.W3CTraceparentHeader, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+				req.Header.Set(handlers.W3CTracestateHeader, "congo=t61rcWkgMzE")
+			})
+
+			It("doesn't overwrite them", func() {
+				handler.ServeHTTP(resp, req, nextHandler)
+				Expect(req.Header.Get(handlers.W3CTraceparentHeader)).To(Equal("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"))
+				Expect(req.Header.Get(handlers.W3CTracestateHeader)).To(Equal("congo=t61rcWkgMzE"))
+			})
+		})
+
+		Context("with an invalid traceparent set", func() {
+			BeforeEach(func() {
+				req.Header.Set(handlers.W3CTraceparentHeader, "Bogus Value")
+				req.Header.Set(handlers.W3CTracestateHeader, "congo=t61rcWkgMzE")
+			})
+
+			It("replaces the traceparent and removes the tracestate", func() {
+				handler.ServeHTTP(resp, req, nextHandler)
+				Expect(req.Header.Get(handlers.W3CTraceparentHeader)).To(MatchRegexp(traceparent_regex))
+				Expect(req.Header.Get(handlers.W3CTracestateHeader)).To(BeEmpty())
+			})
+		})
+
+		Context("with B3 propagation too", func() {
+			BeforeEach(func() {
+				propagation = []string{config.TRACE_PROPAGATION_B3, config.TRACE_PROPAGATION_W3C}
+			})
+
+			It("sets headers of the same trace in both formats", func() {
+				handler.ServeHTTP(resp, req, nextHandler)
+				traceID := req.Header.Get(handlers.B3TraceIdHeader)
+				spanID := req.Header.Get(handlers.B3SpanIdHeader)
+				Expect(traceID).To(MatchRegexp(b3_id_regex))
+				Expect(req.Header.Get(handlers.W3CTraceparentHeader)).To(Equal("00-0000000000000000" + traceID + "-" + spanID + "-01"))
+			})
+
+			It("continues the trace of a traceparent in the zipkin headers", func() {
+				req.Header.Set(handlers.W3CTraceparentHeader, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+				handler.ServeHTTP(resp, req, nextHandler)
+				Expect(req.Header.Get(handlers.B3TraceIdHeader)).To(Equal("0af7651916cd43dd8448eb211c80319c"))
+				Expect(req.Header.Get(handlers.B3SpanIdHeader)).To(Equal("b7ad6b7169203331"))
+			})
+
+			It("keeps the sampling decision of the zipkin headers", func() {
+				req.Header.Set(handlers.B3TraceIdHeader, "463ac35c9f6413ad")
+				req.Header.Set(handlers.B3SpanIdHeader, "a2fb4a1d1a96d312")
+				req.Header.Set(handlers.B3SampledHeader, "0")
+				handler.ServeHTTP(resp, req, nextHandler)
+				Expect(req.Header.Get(handlers.W3CTraceparentHeader)).To(Equal("00-0000000000000000463ac35c9f6413ad-a2fb4a1d1a96d312-00"))
+			})
+		})
+	})
+
 	Context("with Zipkin disabled", func() {
 		BeforeEach(func() {
-			handler = handlers.NewZipkin(false, headersToLog, logger)
+			handler = handlers.NewZipkin(false, propagation, headersToLog, logger)
 		})
 
 		It("doesn't set any headers", func() {
@@ -181,7 +266,7 @@ var _ = Describe("Zipkin", func() {
 		Context("when X-B3-* headers are already set to be logged", func() {
 			It("adds zipkin headers to access log record", func() {
 				newSlice := []string{handlers.B3TraceIdHeader, handlers.B3SpanIdHeader, handlers.B3ParentSpanIdHeader}
-				handler := handlers.NewZipkin(false, newSlice, logger)
+				handler := handlers.NewZipkin(false, propagation, newSlice, logger)
 				newHeadersToLog := handler.HeadersToLog()
 				Expect(newHeadersToLog).To(ContainElement(handlers.B3SpanIdHeader))
 				Expect(newHeadersToLog).To(ContainElement(handlers.B3ParentSpanIdHeader))
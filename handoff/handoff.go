@@ -0,0 +1,233 @@
+// Package handoff hands the listeners of the router over to a new process of
+// the router binary, so that the binary can be upgraded without refusing
+// connections. The new process inherits the listening sockets and serves them
+// alongside the old process, which drains once the new process is ready.
+// Listeners can also be inherited from systemd socket activation.
+//
+// The listeners are inherited the way systemd passes them: from file
+// descriptor 3 on, with their number in LISTEN_FDS and their names in
+// LISTEN_FDNAMES. They are process-wide, as file descriptors are.
+package handoff
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	listenFDsStart = 3
+	readyFDEnv     = "GOROUTER_HANDOFF_READY_FD"
+)
+
+// ListenFunc opens a listener on the address.
+type ListenFunc func(network, address string) (net.Listener, error)
+
+type filer interface {
+	File() (*os.File, error)
+}
+
+var (
+	lock sync.Mutex
+	// inherited are the files of the listeners inherited by name, until
+	// they are listened on
+	inherited map[string]*os.File
+	// listeners are the listeners opened or inherited by name, which are
+	// handed over on upgrades
+	listeners = map[string]net.Listener{}
+	readyFile *os.File
+)
+
+func init() {
+	inherited, readyFile = inheritedFiles()
+}
+
+// inheritedFiles returns the files of the listeners passed to the process,
+// and the file to write to once the process is ready, if it was started by an
+// upgrade. The variables are unset so that they are not passed on to
+// processes started by the router.
+func inheritedFiles() (map[string]*os.File, *os.File) {
+	files := map[string]*os.File{}
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+	defer os.Unsetenv(readyFDEnv)
+
+	if pid := os.Getenv("LISTEN_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return files, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return files, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for i := 0; i < n; i++ {
+		fd := listenFDsStart + i
+		syscall.CloseOnExec(fd)
+		name := "fd-" + strconv.Itoa(fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		files[name] = os.NewFile(uintptr(fd), name)
+	}
+
+	var ready *os.File
+	if fd, err := strconv.Atoi(os.Getenv(readyFDEnv)); err == nil {
+		syscall.CloseOnExec(fd)
+		ready = os.NewFile(uintptr(fd), "handoff-ready")
+	}
+	return files, ready
+}
+
+// Listen returns the listener inherited under name, or opens one on the
+// address with listen. Inherited listeners on another port than the address
+// are closed rather than used. The listener is handed over on upgrades under
+// name.
+func Listen(name, address string, listen ListenFunc) (net.Listener, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if f, ok := inherited[name]; ok {
+		delete(inherited, name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err == nil && samePort(l.Addr(), address) {
+			listeners[name] = l
+			return l, nil
+		}
+		if l != nil {
+			l.Close()
+		}
+	}
+
+	l, err := listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	listeners[name] = l
+	return l, nil
+}
+
+func samePort(addr net.Addr, address string) bool {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	return ok && (port == "0" || port == strconv.Itoa(tcpAddr.Port))
+}
+
+// Ready tells the process that started this one by an upgrade that it serves
+// its listeners, and closes the inherited listeners that were not used.
+func Ready() error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	for name, f := range inherited {
+		f.Close()
+		delete(inherited, name)
+	}
+	if readyFile == nil {
+		return nil
+	}
+	_, err := readyFile.Write([]byte{1})
+	readyFile.Close()
+	readyFile = nil
+	return err
+}
+
+// Upgrade starts the binary of the process again with the same arguments,
+// handing the listeners over to the new process, and waits up to timeout for
+// it to be ready. The new process is killed if it is not.
+func Upgrade(timeout time.Duration) (*os.Process, error) {
+	names, files, err := listenerFiles()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer ready.Close()
+
+	env := os.Environ()
+	env = append(env,
+		"LISTEN_FDS="+strconv.Itoa(len(files)),
+		"LISTEN_FDNAMES="+strings.Join(names, ":"),
+		readyFDEnv+"="+strconv.Itoa(listenFDsStart+len(files)),
+	)
+	procFiles := append([]*os.File{os.Stdin, os.Stdout, os.Stderr}, files...)
+	process, err := os.StartProcess(executable, os.Args, &os.ProcAttr{
+		Env:   env,
+		Files: append(procFiles, readyWriter),
+	})
+	readyWriter.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	ready.SetReadDeadline(time.Now().Add(timeout))
+	_, err = ready.Read(make([]byte, 1))
+	if err != nil {
+		process.Kill()
+		process.Wait()
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil, fmt.Errorf("new process was not ready within %s", timeout)
+		}
+		return nil, errors.New("new process exited before it was ready")
+	}
+	return process, nil
+}
+
+// listenerFiles returns duplicates of the files of the open listeners, with
+// their names. Closed listeners are forgotten.
+func listenerFiles() ([]string, []*os.File, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	sorted := make([]string, 0, len(listeners))
+	for name := range listeners {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var names []string
+	var files []*os.File
+	for _, name := range sorted {
+		l, ok := listeners[name].(filer)
+		if !ok {
+			continue
+		}
+		f, err := l.File()
+		if errors.Is(err, net.ErrClosed) {
+			delete(listeners, name)
+			continue
+		}
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, nil, fmt.Errorf("listener %s: %s", name, err)
+		}
+		names = append(names, name)
+		files = append(files, f)
+	}
+	return names, files, nil
+}
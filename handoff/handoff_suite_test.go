@@ -0,0 +1,50 @@
+package handoff_test
+
+import (
+	"net"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/handoff"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+const childEnv = "HANDOFF_TEST_CHILD"
+
+// the test binary is started again by the upgrades of the tests, in which
+// case it serves the listener it inherits instead of running the tests
+func init() {
+	switch os.Getenv(childEnv) {
+	case "":
+		return
+	case "serve":
+		listener, err := handoff.Listen("test", "127.0.0.1:0", func(string, string) (net.Listener, error) {
+			os.Exit(2)
+			return nil, nil
+		})
+		if err != nil {
+			os.Exit(1)
+		}
+		handoff.Ready()
+		conn, err := listener.Accept()
+		if err != nil {
+			os.Exit(1)
+		}
+		conn.Write([]byte("new process"))
+		conn.Close()
+		os.Exit(0)
+	case "hang":
+		time.Sleep(time.Minute)
+		os.Exit(1)
+	default:
+		os.Exit(1)
+	}
+}
+
+func TestHandoff(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Handoff Suite")
+}
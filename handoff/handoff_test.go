@@ -0,0 +1,63 @@
+package handoff_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/handoff"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Handoff", func() {
+	var listener net.Listener
+
+	BeforeEach(func() {
+		var err error
+		listener, err = handoff.Listen("test", "127.0.0.1:0", net.Listen)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		listener.Close()
+		os.Unsetenv(childEnv)
+	})
+
+	It("opens listeners that were not inherited", func() {
+		Expect(listener.Addr().(*net.TCPAddr).Port).ToNot(BeZero())
+	})
+
+	It("hands the listeners over to the new process", func() {
+		os.Setenv(childEnv, "serve")
+		process, err := handoff.Upgrade(10 * time.Second)
+		Expect(err).ToNot(HaveOccurred())
+		defer process.Wait()
+
+		// connections are accepted by the new process once the old one
+		// stops listening
+		addr := listener.Addr().String()
+		listener.Close()
+		conn, err := net.Dial("tcp", addr)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		response, err := ioutil.ReadAll(conn)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(response)).To(Equal("new process"))
+	})
+
+	It("returns an error when the new process exits before it is ready", func() {
+		os.Setenv(childEnv, "fail")
+		_, err := handoff.Upgrade(10 * time.Second)
+		Expect(err).To(MatchError("new process exited before it was ready"))
+	})
+
+	It("returns an error when the new process is not ready in time", func() {
+		os.Setenv(childEnv, "hang")
+		_, err := handoff.Upgrade(100 * time.Millisecond)
+		Expect(err).To(MatchError(ContainSubstring("not ready within")))
+	})
+})
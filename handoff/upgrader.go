@@ -0,0 +1,67 @@
+package handoff
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"github.com/uber-go/zap"
+)
+
+// Upgrader tells the process that started the router by an upgrade that the
+// router is ready, and upgrades the router on SIGUSR2 when upgrades are
+// enabled. Once a new process is ready, handOff is called for the router to
+// stop accepting connections and drain.
+type Upgrader struct {
+	logger  logger.Logger
+	config  config.UpgradeConfig
+	handOff func()
+}
+
+// NewUpgrader creates an Upgrader. It must be run once the router serves its
+// listeners.
+func NewUpgrader(logger logger.Logger, cfg config.UpgradeConfig, handOff func()) *Upgrader {
+	return &Upgrader{
+		logger:  logger,
+		config:  cfg,
+		handOff: handOff,
+	}
+}
+
+func (u *Upgrader) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	if err := Ready(); err != nil {
+		u.logger.Error("handoff-ready-failed", zap.Error(err))
+	}
+
+	upgrades := make(chan os.Signal, 1)
+	if u.config.Enabled {
+		signal.Notify(upgrades, syscall.SIGUSR2)
+		defer signal.Stop(upgrades)
+	}
+	close(ready)
+
+	for {
+		select {
+		case <-upgrades:
+			if u.upgrade() {
+				u.handOff()
+			}
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+func (u *Upgrader) upgrade() bool {
+	u.logger.Info("upgrade-started")
+	process, err := Upgrade(u.config.Timeout)
+	if err != nil {
+		u.logger.Error("upgrade-failed", zap.Error(err))
+		return false
+	}
+	u.logger.Info("upgrade-handed-off", zap.Int("pid", process.Pid))
+	process.Release()
+	return true
+}
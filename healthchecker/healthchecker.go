@@ -0,0 +1,198 @@
+package healthchecker
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/proxy/utils"
+	"code.cloudfoundry.org/gorouter/route"
+	"github.com/uber-go/zap"
+)
+
+const (
+	UserAgent           = "GoRouter-HealthCheck"
+	maxConcurrentProbes = 100
+)
+
+type Registry interface {
+	EachPool(f func(pool *route.Pool))
+}
+
+// HealthChecker periodically probes the endpoints of all HTTP routes and
+// marks endpoints that fail the probe as unhealthy in their pools, so they
+// stop receiving traffic before they are pruned.
+type HealthChecker struct {
+	registry  Registry
+	config    config.EndpointHealthCheckConfig
+	tlsConfig *tls.Config
+	client    *http.Client
+	logger    logger.Logger
+	clock     clock.Clock
+}
+
+// target is an endpoint and the pools it is registered in.
+type target struct {
+	endpoint *route.Endpoint
+	pools    []*route.Pool
+}
+
+func NewHealthChecker(
+	logger logger.Logger,
+	registry Registry,
+	cfg config.EndpointHealthCheckConfig,
+	tlsConfig *tls.Config,
+	clock clock.Clock,
+) *HealthChecker {
+	return &HealthChecker{
+		registry:  registry,
+		config:    cfg,
+		tlsConfig: tlsConfig,
+		client:    newClient(cfg.Timeout, nil),
+		logger:    logger,
+		clock:     clock,
+	}
+}
+
+func (h *HealthChecker) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ticker := h.clock.NewTicker(h.config.Interval)
+	h.logger.Info("health-checker-started", zap.Duration("interval", h.config.Interval))
+
+	close(ready)
+	for {
+		select {
+		case <-ticker.C():
+			h.Check()
+		case <-signals:
+			h.logger.Info("stopping")
+			ticker.Stop()
+			return nil
+		}
+	}
+}
+
+// Check probes every endpoint once and records the results in its pools.
+func (h *HealthChecker) Check() {
+	targets := map[string]*target{}
+	h.registry.EachPool(func(pool *route.Pool) {
+		pool.Each(func(e *route.Endpoint) {
+			// HTTP/2 endpoints may not accept HTTP/1.1 probes
+			if e.IsHTTP2() {
+				return
+			}
+			t, ok := targets[e.CanonicalAddr()]
+			if !ok {
+				t = &target{endpoint: e}
+				targets[e.CanonicalAddr()] = t
+			}
+			t.pools = append(t.pools, pool)
+		})
+	})
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentProbes)
+	for _, t := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(t *target) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			h.check(t)
+		}(t)
+	}
+	wg.Wait()
+}
+
+func (h *HealthChecker) check(t *target) {
+	err := h.probe(t.endpoint)
+	healthy := err == nil
+
+	changed := false
+	for _, pool := range t.pools {
+		if pool.SetEndpointHealthy(t.endpoint, healthy) {
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	if healthy {
+		h.logger.Info("endpoint-healthy", zap.Nest("route-endpoint", t.endpoint.ToLogData()...))
+	} else {
+		h.logger.Info("endpoint-unhealthy", zap.Nest("route-endpoint", t.endpoint.ToLogData()...), zap.Error(err))
+	}
+}
+
+// probe returns an error if the endpoint cannot be connected to, does not
+// respond within the timeout or responds with a server error.
+func (h *HealthChecker) probe(e *route.Endpoint) error {
+	client := h.client
+	scheme := "http"
+	if e.UseTLS {
+		tlsConfig := &tls.Config{}
+		if h.tlsConfig != nil {
+			tlsConfig = h.tlsConfig.Clone()
+		}
+		tlsConfig.ServerName = e.ServerCertDomainSAN
+		client = newClient(h.config.Timeout, tlsConfig)
+		scheme = "https"
+	}
+
+	// the path of unix sockets is not a valid host
+	host := e.CanonicalAddr()
+	if e.UnixSocket() != "" {
+		host = "localhost"
+	}
+	req, err := http.NewRequest("GET", scheme+"://"+host+h.config.Path, nil)
+	if err != nil {
+		return err
+	}
+	req.URL.Host = e.CanonicalAddr()
+	req.Header.Set("User-Agent", UserAgent)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode >= http.StatusInternalServerError {
+		return &statusError{statusCode: res.StatusCode}
+	}
+	return nil
+}
+
+type statusError struct {
+	statusCode int
+}
+
+func (e *statusError) Error() string {
+	return "health check responded with " + http.StatusText(e.statusCode)
+}
+
+func newClient(timeout time.Duration, tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return utils.DialEndpoint(network, addr, timeout)
+			},
+			DisableKeepAlives: true,
+			TLSClientConfig:   tlsConfig,
+		},
+		// a redirect is a response, which is all the probe needs
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
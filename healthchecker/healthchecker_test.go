@@ -0,0 +1,190 @@
+package healthchecker_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/gorouter/config"
+	. "code.cloudfoundry.org/gorouter/healthchecker"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/routing-api/models"
+	"github.com/tedsuo/ifrit"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+type poolRegistry struct {
+	pools []*route.Pool
+}
+
+func (r *poolRegistry) EachPool(f func(pool *route.Pool)) {
+	for _, p := range r.pools {
+		f(p)
+	}
+}
+
+var _ = Describe("HealthChecker", func() {
+	var (
+		logger   *test_util.TestZapLogger
+		cfg      config.EndpointHealthCheckConfig
+		clock    *fakeclock.FakeClock
+		pool     *route.Pool
+		registry *poolRegistry
+		checker  *HealthChecker
+
+		healthy, unhealthy *httptest.Server
+		healthyEndpoint    *route.Endpoint
+		unhealthyEndpoint  *route.Endpoint
+		status             int32
+		paths              chan string
+		userAgent          atomic.Value
+	)
+
+	newEndpoint := func(server *httptest.Server) *route.Endpoint {
+		host, portStr, err := net.SplitHostPort(server.Listener.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+		port, err := strconv.Atoi(portStr)
+		Expect(err).ToNot(HaveOccurred())
+		return route.NewEndpoint("", host, uint16(port), "", "", nil, -1, "", models.ModificationTag{}, "")
+	}
+
+	// next returns the endpoints selected by two consecutive picks
+	next := func() []*route.Endpoint {
+		iter := pool.Endpoints("", "", "")
+		return []*route.Endpoint{iter.Next(), iter.Next()}
+	}
+
+	BeforeEach(func() {
+		logger = test_util.NewTestZapLogger("test")
+		cfg = config.EndpointHealthCheckConfig{
+			Enabled:  true,
+			Path:     "/health",
+			Interval: time.Second,
+			Timeout:  500 * time.Millisecond,
+		}
+		clock = fakeclock.NewFakeClock(time.Now())
+
+		paths = make(chan string, 10)
+		healthy = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userAgent.Store(r.Header.Get("User-Agent"))
+			paths <- r.URL.Path
+			w.WriteHeader(http.StatusOK)
+		}))
+		atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+		unhealthy = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(int(atomic.LoadInt32(&status)))
+		}))
+
+		healthyEndpoint = newEndpoint(healthy)
+		unhealthyEndpoint = newEndpoint(unhealthy)
+
+		pool = route.NewPool(time.Minute, "")
+		pool.Put(healthyEndpoint)
+		pool.Put(unhealthyEndpoint)
+		registry = &poolRegistry{pools: []*route.Pool{pool}}
+	})
+
+	JustBeforeEach(func() {
+		checker = NewHealthChecker(logger, registry, cfg, nil, clock)
+	})
+
+	AfterEach(func() {
+		healthy.Close()
+		unhealthy.Close()
+	})
+
+	Describe("Check", func() {
+		It("probes the configured path", func() {
+			checker.Check()
+			Expect(paths).To(Receive(Equal("/health")))
+			Expect(userAgent.Load()).To(Equal(UserAgent))
+		})
+
+		It("marks endpoints that respond with a server error as unhealthy", func() {
+			checker.Check()
+			Expect(next()).To(Equal([]*route.Endpoint{healthyEndpoint, healthyEndpoint}))
+			Expect(logger.Buffer()).To(gbytes.Say("endpoint-unhealthy"))
+		})
+
+		It("marks endpoints healthy again once they pass the probe", func() {
+			checker.Check()
+			atomic.StoreInt32(&status, http.StatusNotFound)
+			checker.Check()
+
+			Expect(next()).To(ConsistOf(healthyEndpoint, unhealthyEndpoint))
+			Expect(logger.Buffer()).To(gbytes.Say("endpoint-healthy"))
+		})
+
+		It("marks endpoints that cannot be connected to as unhealthy", func() {
+			unhealthy.Close()
+			checker.Check()
+			Expect(next()).To(Equal([]*route.Endpoint{healthyEndpoint, healthyEndpoint}))
+		})
+
+		Context("when the endpoint does not respond within the timeout", func() {
+			BeforeEach(func() {
+				cfg.Timeout = 50 * time.Millisecond
+				unhealthy.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					time.Sleep(200 * time.Millisecond)
+				})
+			})
+
+			It("marks the endpoint as unhealthy", func() {
+				checker.Check()
+				Expect(next()).To(Equal([]*route.Endpoint{healthyEndpoint, healthyEndpoint}))
+			})
+		})
+
+		Context("when the endpoint is registered for several routes", func() {
+			var otherPool *route.Pool
+
+			BeforeEach(func() {
+				otherPool = route.NewPool(time.Minute, "")
+				otherPool.Put(unhealthyEndpoint)
+				otherPool.Put(healthyEndpoint)
+				registry.pools = append(registry.pools, otherPool)
+			})
+
+			It("probes it once and marks it in every pool", func() {
+				checker.Check()
+				Expect(paths).To(HaveLen(1))
+
+				iter := otherPool.Endpoints("", "", "")
+				Expect(iter.Next()).To(Equal(healthyEndpoint))
+				Expect(iter.Next()).To(Equal(healthyEndpoint))
+			})
+		})
+	})
+
+	Describe("Run", func() {
+		var process ifrit.Process
+
+		JustBeforeEach(func() {
+			process = ifrit.Invoke(checker)
+		})
+
+		AfterEach(func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive())
+		})
+
+		It("checks the endpoints on every interval", func() {
+			Consistently(paths).ShouldNot(Receive())
+
+			clock.Increment(cfg.Interval)
+			Eventually(paths).Should(Receive())
+
+			clock.Increment(cfg.Interval)
+			Eventually(paths).Should(Receive())
+		})
+	})
+})
@@ -0,0 +1,71 @@
+package logger
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/uber-go/zap"
+)
+
+// Levels are the levels the logs can be changed to while the router runs,
+// from the most to the least verbose.
+var Levels = []zap.Level{zap.DebugLevel, zap.InfoLevel, zap.ErrorLevel}
+
+// LevelSignals makes the logs of a level more verbose on SIGTTIN and less
+// verbose on SIGTTOU, stepping through debug, info and error. SIGUSR1 and
+// SIGUSR2 already drain and upgrade the router.
+type LevelSignals struct {
+	level  *Level
+	logger Logger
+}
+
+// NewLevelSignals creates a LevelSignals changing the level.
+func NewLevelSignals(level *Level, logger Logger) *LevelSignals {
+	return &LevelSignals{level: level, logger: logger}
+}
+
+func (s *LevelSignals) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	levelSignals := make(chan os.Signal, 1)
+	signal.Notify(levelSignals, syscall.SIGTTIN, syscall.SIGTTOU)
+	defer signal.Stop(levelSignals)
+	close(ready)
+
+	for {
+		select {
+		case sig := <-levelSignals:
+			s.step(sig == syscall.SIGTTIN)
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+// step sets the level to the next more or less verbose one, if any.
+func (s *LevelSignals) step(moreVerbose bool) {
+	previous := s.level.Level()
+	next := previous
+	if moreVerbose {
+		for _, level := range Levels {
+			if level < previous {
+				next = level
+			}
+		}
+	} else {
+		for i := len(Levels) - 1; i >= 0; i-- {
+			if Levels[i] > previous {
+				next = Levels[i]
+			}
+		}
+	}
+	if next == previous {
+		return
+	}
+
+	// the change is logged at the more verbose of the levels
+	if moreVerbose {
+		s.level.Set(next)
+	}
+	s.logger.Info("log-level-changed", zap.String("from", previous.String()), zap.String("to", next.String()))
+	s.level.Set(next)
+}
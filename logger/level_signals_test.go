@@ -0,0 +1,57 @@
+package logger_test
+
+import (
+	"os"
+	"syscall"
+
+	. "code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"github.com/tedsuo/ifrit"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/uber-go/zap"
+)
+
+var _ = Describe("LevelSignals", func() {
+	var (
+		level   *Level
+		logger  *test_util.TestZapLogger
+		process ifrit.Process
+	)
+
+	BeforeEach(func() {
+		level = NewLevel(zap.InfoLevel)
+		logger = test_util.NewTestZapLogger("test")
+		process = ifrit.Invoke(NewLevelSignals(level, logger))
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+	})
+
+	It("makes the logs more verbose on SIGTTIN", func() {
+		Expect(syscall.Kill(os.Getpid(), syscall.SIGTTIN)).To(Succeed())
+		Eventually(level.Level).Should(Equal(zap.DebugLevel))
+		Expect(logger).To(gbytes.Say(`log-level-changed.*"from":"info","to":"debug"`))
+
+		Expect(syscall.Kill(os.Getpid(), syscall.SIGTTIN)).To(Succeed())
+		Consistently(level.Level).Should(Equal(zap.DebugLevel))
+	})
+
+	It("makes the logs less verbose on SIGTTOU", func() {
+		Expect(syscall.Kill(os.Getpid(), syscall.SIGTTOU)).To(Succeed())
+		Eventually(level.Level).Should(Equal(zap.ErrorLevel))
+
+		Expect(syscall.Kill(os.Getpid(), syscall.SIGTTOU)).To(Succeed())
+		Consistently(level.Level).Should(Equal(zap.ErrorLevel))
+	})
+
+	It("steps from levels in between to the next allowed one", func() {
+		level.Set(zap.WarnLevel)
+		Expect(syscall.Kill(os.Getpid(), syscall.SIGTTIN)).To(Succeed())
+		Eventually(level.Level).Should(Equal(zap.InfoLevel))
+	})
+})
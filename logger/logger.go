@@ -1,6 +1,11 @@
 package logger
 
-import "github.com/uber-go/zap"
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/uber-go/zap"
+)
 
 // Logger is the zap.Logger interface with additional Session methods.
 //go:generate counterfeiter -o fakes/fake_logger.go . Logger
@@ -20,12 +25,81 @@ type Logger interface {
 }
 
 type logger struct {
-	source     string
+	source string
+	// session is the source within the component of the logger
+	session    string
 	origLogger zap.Logger
 	context    []zap.Field
+	options    *Options
+	level      *Level
 	zap.Logger
 }
 
+// Options configure the loggers created by NewLoggerWithOptions beyond their
+// zap options.
+type Options struct {
+	// Level is the level of the logs, unless their session has its own.
+	Level *Level
+	// SessionLevels are the levels of the logs of sessions, by the name
+	// passed to Session, e.g. registry. A name also covers the sessions
+	// within the session, so proxy covers proxy.request-handler, unless
+	// it has its own level.
+	SessionLevels map[string]*Level
+	// Sampler limits the logs with the same level and message, if set.
+	Sampler *Sampler
+}
+
+// levelOf returns the level of the logs of the session.
+func (o *Options) levelOf(session string) *Level {
+	for name := session; name != ""; {
+		if level, ok := o.SessionLevels[name]; ok {
+			return level
+		}
+		i := strings.LastIndex(name, ".")
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+	return o.Level
+}
+
+// Level is the minimum level of the messages logged by the loggers created
+// with it. It can be changed while they log.
+type Level struct {
+	level int32
+}
+
+// NewLevel returns the level.
+func NewLevel(level zap.Level) *Level {
+	return &Level{level: int32(level)}
+}
+
+// Set changes the level of the loggers created with l.
+func (l *Level) Set(level zap.Level) {
+	atomic.StoreInt32(&l.level, int32(level))
+}
+
+// Level returns the current level.
+func (l *Level) Level() zap.Level {
+	return zap.Level(atomic.LoadInt32(&l.level))
+}
+
+// UnmarshalText sets the level from its name, e.g. debug or info.
+func (l *Level) UnmarshalText(text []byte) error {
+	var level zap.Level
+	if err := level.UnmarshalText(text); err != nil {
+		return err
+	}
+	l.Set(level)
+	return nil
+}
+
+// Enabled reports whether messages of the level are logged.
+func (l *Level) Enabled(level zap.Level) bool {
+	return level >= l.Level()
+}
+
 // NewLogger returns a new zap logger that implements the Logger interface.
 func NewLogger(component string, options ...zap.Option) Logger {
 	enc := zap.NewJSONEncoder(
@@ -43,13 +117,40 @@ func NewLogger(component string, options ...zap.Option) Logger {
 	}
 }
 
+// NewLoggerWithLevel returns a new zap logger that implements the Logger
+// interface and logs the messages enabled by level, which can be changed
+// while it logs.
+func NewLoggerWithLevel(component string, level *Level, options ...zap.Option) Logger {
+	return NewLoggerWithOptions(component, Options{Level: level}, options...)
+}
+
+// NewLoggerWithOptions returns a new zap logger that implements the Logger
+// interface, with the levels and sampling of opts.
+func NewLoggerWithOptions(component string, opts Options, options ...zap.Option) Logger {
+	options = append(options, zap.DebugLevel)
+	l := NewLogger(component, options...).(*logger)
+	l.options = &opts
+	l.level = opts.Level
+	return l
+}
+
 func (l *logger) Session(component string) Logger {
 	newSource := l.source + "." + component
+	session := component
+	if l.session != "" {
+		session = l.session + "." + component
+	}
 	lggr := &logger{
 		source:     newSource,
+		session:    session,
 		origLogger: l.origLogger,
 		Logger:     l.origLogger.With(zap.String("source", newSource)),
 		context:    l.context,
+		options:    l.options,
+		level:      l.level,
+	}
+	if l.options != nil {
+		lggr.level = l.options.levelOf(session)
 	}
 	return lggr
 }
@@ -66,13 +167,29 @@ func (l *logger) wrapDataFields(fields ...zap.Field) zap.Field {
 func (l *logger) With(fields ...zap.Field) Logger {
 	return &logger{
 		source:     l.source,
+		session:    l.session,
 		origLogger: l.origLogger,
 		Logger:     l.Logger,
 		context:    append(l.context, fields...),
+		options:    l.options,
+		level:      l.level,
 	}
 }
 
+func (l *logger) Check(level zap.Level, msg string) *zap.CheckedMessage {
+	if l.level != nil && !l.level.Enabled(level) {
+		return nil
+	}
+	return l.Logger.Check(level, msg)
+}
+
 func (l *logger) Log(level zap.Level, msg string, fields ...zap.Field) {
+	if l.level != nil && !l.level.Enabled(level) {
+		return
+	}
+	if l.options != nil && l.options.Sampler != nil && !l.options.Sampler.Sample(level, msg) {
+		return
+	}
 	l.Logger.Log(level, msg, l.wrapDataFields(fields...))
 }
 func (l *logger) Debug(msg string, fields ...zap.Field) {
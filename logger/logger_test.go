@@ -2,6 +2,7 @@ package logger_test
 
 import (
 	"fmt"
+	"time"
 
 	. "code.cloudfoundry.org/gorouter/logger"
 	"code.cloudfoundry.org/gorouter/test_util"
@@ -144,4 +145,104 @@ var _ = Describe("Logger", func() {
 			Expect(testSink.Lines()[0]).To(MatchRegexp(`{.*"data":{"new-key":"new-value"}}`))
 		})
 	})
+
+	Describe("NewLoggerWithLevel", func() {
+		var level *Level
+
+		BeforeEach(func() {
+			level = NewLevel(zap.InfoLevel)
+			logger = NewLoggerWithLevel(
+				component,
+				level,
+				zap.Output(zap.MultiWriteSyncer(testSink, zap.AddSync(GinkgoWriter))),
+				zap.ErrorOutput(zap.MultiWriteSyncer(testSink, zap.AddSync(GinkgoWriter))))
+		})
+
+		It("logs the messages enabled by the level", func() {
+			logger.Debug(action)
+			logger.Info(action)
+			Expect(testSink.Lines()).To(HaveLen(1))
+			Expect(testSink.Lines()[0]).To(MatchRegexp(`{.*"log_level":1.*}`))
+		})
+
+		It("logs the messages enabled once the level changes", func() {
+			session := logger.Session("my-subcomponent").With(testField)
+			Expect(level.UnmarshalText([]byte("debug"))).To(Succeed())
+			session.Debug(action)
+			Expect(testSink.Lines()).To(HaveLen(1))
+
+			level.Set(zap.ErrorLevel)
+			session.Warn(action)
+			logger.Info(action)
+			Expect(testSink.Lines()).To(HaveLen(1))
+		})
+
+		It("does not change the level to an unknown one", func() {
+			Expect(level.UnmarshalText([]byte("loud"))).ToNot(Succeed())
+			Expect(level.Level()).To(Equal(zap.InfoLevel))
+		})
+	})
+
+	Describe("NewLoggerWithOptions", func() {
+		var (
+			level         *Level
+			registryLevel *Level
+			sampler       *Sampler
+		)
+
+		BeforeEach(func() {
+			level = NewLevel(zap.InfoLevel)
+			registryLevel = NewLevel(zap.DebugLevel)
+			sampler = nil
+		})
+
+		JustBeforeEach(func() {
+			logger = NewLoggerWithOptions(
+				component,
+				Options{
+					Level:         level,
+					SessionLevels: map[string]*Level{"registry": registryLevel},
+					Sampler:       sampler,
+				},
+				zap.Output(zap.MultiWriteSyncer(testSink, zap.AddSync(GinkgoWriter))),
+				zap.ErrorOutput(zap.MultiWriteSyncer(testSink, zap.AddSync(GinkgoWriter))))
+		})
+
+		It("logs the sessions with their own level at that level", func() {
+			logger.Debug(action)
+			logger.Session("proxy").Debug(action)
+			Expect(testSink.Lines()).To(BeEmpty())
+
+			logger.Session("registry").Debug(action)
+			logger.Session("registry").Session("pruner").With(testField).Debug(action)
+			Expect(testSink.Lines()).To(HaveLen(2))
+			Expect(testSink.Lines()[1]).To(MatchRegexp(`{.*"source":"my-component.registry.pruner".*}`))
+		})
+
+		It("follows the changes of the levels", func() {
+			session := logger.Session("registry")
+			registryLevel.Set(zap.ErrorLevel)
+			session.Info(action)
+			Expect(testSink.Lines()).To(BeEmpty())
+
+			level.Set(zap.DebugLevel)
+			logger.Session("proxy").Debug(action)
+			Expect(testSink.Lines()).To(HaveLen(1))
+		})
+
+		Context("when sampling", func() {
+			BeforeEach(func() {
+				sampler = NewSampler(2, 3, time.Hour)
+			})
+
+			It("logs the first messages and every thereafter-th of the rest", func() {
+				for i := 0; i < 8; i++ {
+					logger.Session("proxy").Info(action)
+				}
+				logger.Info("other-action")
+				Expect(testSink.Lines()).To(HaveLen(5))
+				Expect(testSink.Lines()[4]).To(ContainSubstring("other-action"))
+			})
+		})
+	})
 })
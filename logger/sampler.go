@@ -0,0 +1,63 @@
+package logger
+
+import (
+	"sync"
+	"time"
+
+	"github.com/uber-go/zap"
+)
+
+// Sampler limits the logs with the same level and message, so that messages
+// logged for every request or registration cannot flood the logs. Of the
+// messages logged each interval, the first initial are logged, and every
+// thereafter-th of the rest. A thereafter of 0 drops the rest.
+type Sampler struct {
+	initial    uint64
+	thereafter uint64
+	interval   time.Duration
+
+	lock   sync.Mutex
+	counts map[sampleKey]*sampleCount
+}
+
+type sampleKey struct {
+	level   zap.Level
+	message string
+}
+
+type sampleCount struct {
+	resetAt time.Time
+	n       uint64
+}
+
+// NewSampler creates a Sampler.
+func NewSampler(initial, thereafter int, interval time.Duration) *Sampler {
+	return &Sampler{
+		initial:    uint64(initial),
+		thereafter: uint64(thereafter),
+		interval:   interval,
+		counts:     map[sampleKey]*sampleCount{},
+	}
+}
+
+// Sample counts the message and reports whether it is logged.
+func (s *Sampler) Sample(level zap.Level, message string) bool {
+	now := time.Now()
+	key := sampleKey{level: level, message: message}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// the messages are constants of the code, so there are few keys
+	count, ok := s.counts[key]
+	if !ok || !now.Before(count.resetAt) {
+		count = &sampleCount{resetAt: now.Add(s.interval)}
+		s.counts[key] = count
+	}
+	count.n++
+
+	if count.n <= s.initial {
+		return true
+	}
+	return s.thereafter > 0 && (count.n-s.initial)%s.thereafter == 0
+}
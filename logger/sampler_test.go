@@ -0,0 +1,47 @@
+package logger_test
+
+import (
+	"time"
+
+	. "code.cloudfoundry.org/gorouter/logger"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/uber-go/zap"
+)
+
+var _ = Describe("Sampler", func() {
+	sample := func(sampler *Sampler, n int, level zap.Level, message string) []bool {
+		sampled := make([]bool, n)
+		for i := range sampled {
+			sampled[i] = sampler.Sample(level, message)
+		}
+		return sampled
+	}
+
+	It("samples the first messages and every thereafter-th of the rest", func() {
+		sampler := NewSampler(2, 3, time.Hour)
+		Expect(sample(sampler, 8, zap.InfoLevel, "message")).To(Equal([]bool{true, true, false, false, true, false, false, true}))
+	})
+
+	It("drops the rest when thereafter is 0", func() {
+		sampler := NewSampler(1, 0, time.Hour)
+		Expect(sample(sampler, 3, zap.InfoLevel, "message")).To(Equal([]bool{true, false, false}))
+	})
+
+	It("counts the messages of each level separately", func() {
+		sampler := NewSampler(1, 0, time.Hour)
+		Expect(sampler.Sample(zap.InfoLevel, "message")).To(BeTrue())
+		Expect(sampler.Sample(zap.ErrorLevel, "message")).To(BeTrue())
+		Expect(sampler.Sample(zap.InfoLevel, "other-message")).To(BeTrue())
+		Expect(sampler.Sample(zap.InfoLevel, "message")).To(BeFalse())
+	})
+
+	It("counts again after the interval", func() {
+		sampler := NewSampler(1, 0, 50*time.Millisecond)
+		Expect(sample(sampler, 2, zap.InfoLevel, "message")).To(Equal([]bool{true, false}))
+
+		time.Sleep(60 * time.Millisecond)
+		Expect(sampler.Sample(zap.InfoLevel, "message")).To(BeTrue())
+	})
+})
@@ -1,27 +1,44 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
+	"net"
+	"net/http"
 	"net/url"
 	"sync/atomic"
 
 	"code.cloudfoundry.org/clock"
 	"code.cloudfoundry.org/debugserver"
 	"code.cloudfoundry.org/gorouter/access_log"
+	"code.cloudfoundry.org/gorouter/acme"
+	"code.cloudfoundry.org/gorouter/admin"
 	"code.cloudfoundry.org/gorouter/common/schema"
 	"code.cloudfoundry.org/gorouter/common/secure"
 	"code.cloudfoundry.org/gorouter/common/uuid"
 	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/diagnostics"
+	"code.cloudfoundry.org/gorouter/handlers"
+	"code.cloudfoundry.org/gorouter/handoff"
+	"code.cloudfoundry.org/gorouter/healthchecker"
 	goRouterLogger "code.cloudfoundry.org/gorouter/logger"
 	"code.cloudfoundry.org/gorouter/mbus"
 	"code.cloudfoundry.org/gorouter/metrics/monitor"
 	"code.cloudfoundry.org/gorouter/proxy"
+	"code.cloudfoundry.org/gorouter/proxy/utils"
 	rregistry "code.cloudfoundry.org/gorouter/registry"
+	"code.cloudfoundry.org/gorouter/resolver"
 	"code.cloudfoundry.org/gorouter/route_fetcher"
 	"code.cloudfoundry.org/gorouter/router"
 	"code.cloudfoundry.org/gorouter/routeservice"
+	"code.cloudfoundry.org/gorouter/routesource"
+	"code.cloudfoundry.org/gorouter/scripting"
+	"code.cloudfoundry.org/gorouter/sessiontickets"
+	"code.cloudfoundry.org/gorouter/stapling"
+	"code.cloudfoundry.org/gorouter/tracing"
 	rvarz "code.cloudfoundry.org/gorouter/varz"
+	"code.cloudfoundry.org/gorouter/wasm"
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/routing-api"
 	uaa_client "code.cloudfoundry.org/uaa-go-client"
@@ -65,7 +82,7 @@ func main() {
 	if c.Logging.Syslog != "" {
 		prefix = c.Logging.Syslog
 	}
-	logger, minLagerLogLevel := createLogger(prefix, c.Logging.Level)
+	logger, logLevel, minLagerLogLevel := createLogger(prefix, c.Logging)
 
 	logger.Info("starting")
 
@@ -91,7 +108,8 @@ func main() {
 
 	logger.Info("setting-up-nats-connection")
 	startMsgChan := make(chan struct{})
-	natsClient := connectToNatsServer(logger.Session("nats"), c, startMsgChan)
+	natsMonitor := mbus.NewConnectionMonitor(clock.NewClock())
+	natsClient := connectToNatsServer(logger.Session("nats"), c, natsMonitor, startMsgChan)
 
 	var routingAPIClient routing_api.Client
 
@@ -108,13 +126,64 @@ func main() {
 	sender := metric_sender.NewMetricSender(dropsonde.AutowiredEmitter())
 	metricsReporter := initializeMetrics(sender)
 	fdMonitor := initializeFDMonitor(sender, logger)
-	registry := rregistry.NewRouteRegistry(logger.Session("registry"), c, metricsReporter)
+	proxyReporters := []metrics.ProxyReporter{metricsReporter}
+	var registryReporter metrics.RouteRegistryReporter = metricsReporter
+	if c.Statsd.Enabled {
+		statsdReporter := initializeStatsd(logger, c)
+		proxyReporters = append(proxyReporters, statsdReporter)
+		registryReporter = metrics.NewCompositeRegistryReporter(metricsReporter, statsdReporter)
+	}
+	registry := rregistry.NewRouteRegistry(logger.Session("registry"), c, registryReporter)
+	if c.RouteAudit.NatsSubject != "" {
+		registry.SetAuditPublisher(natsClient)
+	}
 	if c.SuspendPruningIfNatsUnavailable {
 		registry.SuspendPruning(func() bool { return !(natsClient.Status() == nats.CONNECTED) })
 	}
 
-	varz := rvarz.NewVarz(registry)
-	compositeReporter := metrics.NewCompositeReporter(varz, metricsReporter)
+	var routeLatencies *metrics.RouteLatencies
+	if c.RouteLatency.Enabled {
+		routeLatencies = metrics.NewRouteLatencies(c.RouteLatency.MaxRoutes)
+	}
+	varz := rvarz.NewVarz(registry, routeLatencies)
+	statusHandlers := map[string]http.Handler{}
+	messageReporter := registryReporter
+	var prometheusReporter *metrics.PrometheusReporter
+	if c.Prometheus.Enabled {
+		prometheusReporter = initializePrometheus(c, registry, natsClient, natsMonitor)
+		proxyReporters = append(proxyReporters, prometheusReporter)
+		messageReporter = metrics.NewCompositeRegistryReporter(registryReporter, prometheusReporter)
+		statusHandlers[c.Prometheus.Path] = prometheusReporter
+	}
+	rewriteRules, err := handlers.NewRewriteRules(c.RewriteRules)
+	if err != nil {
+		logger.Fatal("rewrite-rules-error", zap.Error(err))
+	}
+	// the settings the router reloads from the config file on SIGHUP
+	reloadableConfig := config.NewReloadableConfig(c)
+	reloadableConfig.OnReload(func(c *config.Config) {
+		if err := logLevel.UnmarshalText([]byte(c.Logging.Level)); err != nil {
+			logger.Error("log-level-reload-failed", zap.Error(err))
+		}
+	})
+	if c.AdminAPI.Enabled {
+		adminHandler := admin.NewRoutesHandler(registry, logger.Session("admin-api"))
+		statusHandlers[admin.RoutesPath] = adminHandler
+		statusHandlers[admin.FrozenRoutesPath] = adminHandler
+		statusHandlers[admin.MaintenanceRoutesPath] = adminHandler
+		statusHandlers[admin.DrainingEndpointsPath] = adminHandler
+		statusHandlers[admin.RewriteRulesPath] = admin.NewRewriteRulesHandler(rewriteRules, logger.Session("admin-api"))
+		if c.RouteAudit.Enabled {
+			statusHandlers[admin.RouteAuditPath] = admin.NewRouteAuditHandler(registry)
+		}
+	}
+	statusHandlers[admin.LogLevelPath] = admin.NewLogLevelHandler(logLevel, logger.Session("log-level"))
+	if c.Diagnostics.Enabled {
+		for path, handler := range diagnostics.NewHandlers(registry) {
+			statusHandlers[path] = handler
+		}
+	}
+	compositeReporter := metrics.NewCompositeReporter(varz, proxyReporters...)
 
 	accessLogger, err := access_log.CreateRunningAccessLogger(logger.Session("access-log"), c)
 	if err != nil {
@@ -124,30 +193,184 @@ func main() {
 	var crypto secure.Crypto
 	var cryptoPrev secure.Crypto
 	if c.RouteServiceEnabled {
-		crypto = createCrypto(logger, c.RouteServiceSecret)
+		algorithm := c.RouteServiceSigning.Algorithm
+		crypto = createCrypto(logger, algorithm, c.RouteServiceSecret)
+
+		var previous secure.Keyring
 		if c.RouteServiceSecretPrev != "" {
-			cryptoPrev = createCrypto(logger, c.RouteServiceSecretPrev)
+			previous = append(previous, createCrypto(logger, algorithm, c.RouteServiceSecretPrev))
+		}
+		for _, secret := range c.RouteServiceSigning.DecryptOnlySecrets {
+			previous = append(previous, createCrypto(logger, algorithm, secret))
+		}
+		if len(previous) > 0 {
+			cryptoPrev = previous
+		}
+	}
+
+	var spanExporter tracing.Exporter
+	var otlpExporter *tracing.OTLPExporter
+	if c.Tracing.OTLP.Enabled {
+		otlpExporter = tracing.NewOTLPExporter(logger.Session("otlp-exporter"), c.Tracing.OTLP)
+		spanExporter = otlpExporter
+	}
+
+	var tokenValidator handlers.TokenValidator
+	if c.RouteAuth.EnableJWT {
+		tokenValidator = newOAuthClient(logger.Session("route-auth"), clock.NewClock(), c)
+	}
+
+	var wasmPlugins *wasm.Plugins
+	if len(c.Wasm.Filters) > 0 {
+		wasmPlugins, err = wasm.NewPlugins(context.Background(), c.Wasm, logger.Session("wasm"))
+		if err != nil {
+			logger.Fatal("wasm-filters-error", zap.Error(err))
+		}
+	}
+
+	var script *scripting.Script
+	if c.Scripting.Path != "" {
+		script, err = scripting.NewScript(c.Scripting, logger.Session("scripting"))
+		if err != nil {
+			logger.Fatal("scripting-error", zap.Error(err))
+		}
+	}
+
+	// the http-01 challenges of the certificate authority are answered before
+	// the route of the request is looked up, so that domains need no route
+	var acmeChallenges *acme.Challenges
+	if c.ACME.Enabled {
+		acmeChallenges = acme.NewChallenges()
+		proxy.RegisterHandler(proxy.BeforeLookup, acmeChallenges)
+	}
+
+	// endpoints registered with a hostname are dialed through the resolver
+	var dnsResolver *resolver.Resolver
+	if c.Backends.DNS.Enabled {
+		dnsResolver, err = resolver.NewResolver(logger.Session("dns-resolver"), c.Backends.DNS, clock.NewClock())
+		if err != nil {
+			logger.Fatal("dns-resolver-error", zap.Error(err))
 		}
+		utils.Dial = dnsResolver.DialTimeout
 	}
 
-	proxy := buildProxy(logger.Session("proxy"), c, registry, accessLogger, compositeReporter, crypto, cryptoPrev)
+	proxy := buildProxy(logger.Session("proxy"), c, registry, accessLogger, compositeReporter, crypto, cryptoPrev, spanExporter, tokenValidator, wasmPlugins, script, rewriteRules, reloadableConfig)
 	healthCheck = 0
-	router, err := router.NewRouter(logger.Session("router"), c, proxy, natsClient, registry, varz, &healthCheck, logCounter, nil)
+	router, err := router.NewRouter(logger.Session("router"), c, proxy, natsClient, registry, varz, &healthCheck, logCounter, statusHandlers, nil)
 	if err != nil {
 		logger.Fatal("initialize-router-error", zap.Error(err))
 	}
+	router.SetReloadableConfig(reloadableConfig)
+	// the cached certificates are passed to the router before it starts
+	// serving TLS
+	var acmeManager *acme.Manager
+	if c.ACME.Enabled {
+		acmeManager, err = acme.NewManager(logger.Session("acme"), c.ACME, acmeChallenges, router, clock.NewClock())
+		if err != nil {
+			logger.Fatal("acme-error", zap.Error(err))
+		}
+	}
+	if c.EnableSSL {
+		router.SetTLSReporter(compositeReporter)
+	}
+	var ocspStapler *stapling.Stapler
+	if c.EnableSSL && c.OCSPStapling.Enabled {
+		ocspStapler = stapling.NewStapler(logger.Session("ocsp-stapler"), c.OCSPStapling, clock.NewClock())
+		router.SetOCSPStapler(ocspStapler)
+	}
+	var ticketRotator *sessiontickets.Rotator
+	if c.EnableSSL && c.SessionTickets.Source != "" {
+		ticketRotator, err = sessiontickets.NewRotator(logger.Session("session-tickets"), c.SessionTickets, router, natsClient, clock.NewClock())
+		if err != nil {
+			logger.Fatal("session-tickets-error", zap.Error(err))
+		}
+	}
+	if prometheusReporter != nil {
+		prometheusReporter.AddGauge("gorouter_rejected_connections", "Client connections closed because their client IP was at its connection limit.", func() float64 {
+			return float64(router.RejectedConnections())
+		})
+		prometheusReporter.AddLabeledCounter("gorouter_accepted_connections_total", "Client connections accepted by listener.", "listener", router.AcceptedConnections)
+	}
 	members := grouper.Members{}
 
+	// the exporter stops after the router so that the spans of requests
+	// served while draining are exported
+	if otlpExporter != nil {
+		members = append(members, grouper.Member{Name: "otlp-exporter", Runner: otlpExporter})
+	}
+
+	// the snapshot is loaded before the routes are registered by the route
+	// sources, and saved once more after the router stops
+	if c.RouteSnapshot.Path != "" {
+		snapshotter := rregistry.NewSnapshotter(logger.Session("route-snapshot"), registry, c.RouteSnapshot, clock.NewClock())
+		members = append(members, grouper.Member{Name: "route-snapshot", Runner: snapshotter})
+	}
+
 	if c.RoutingApiEnabled() {
 		routeFetcher := setupRouteFetcher(logger.Session("route-fetcher"), c, registry, routingAPIClient)
 		members = append(members, grouper.Member{Name: "router-fetcher", Runner: routeFetcher})
 	}
 
-	subscriber := createSubscriber(logger, c, natsClient, registry, startMsgChan)
+	if c.StaticRoutesFile != "" {
+		staticFile := routesource.NewStaticFile(logger.Session("static-routes"), c.StaticRoutesFile, clock.NewClock())
+		members = append(members, grouper.Member{Name: "static-routes", Runner: routeSourceRunner(logger.Session("static-routes"), c, staticFile, registry)})
+	}
+
+	if c.ConsulEnabled() {
+		consul := routesource.NewConsul(logger.Session("consul"), c.Consul, clock.NewClock())
+		members = append(members, grouper.Member{Name: "consul", Runner: routeSourceRunner(logger.Session("consul"), c, consul, registry)})
+	}
+
+	if c.Kubernetes.Enabled {
+		kubernetes, err := routesource.NewKubernetes(logger.Session("kubernetes"), c.Kubernetes, clock.NewClock())
+		if err != nil {
+			logger.Fatal("kubernetes-route-source-error", zap.Error(err))
+		}
+		members = append(members, grouper.Member{Name: "kubernetes", Runner: routeSourceRunner(logger.Session("kubernetes"), c, kubernetes, registry)})
+	}
+
+	// the consumer is created before the subscriber sends the start message,
+	// so the registrations it prompts are delivered
+	if c.NatsClient.JetStream.Enabled {
+		jetStream, err := mbus.NewJetStream(logger.Session("jetstream"), natsClient, c.NatsClient.JetStream, messageReporter, clock.NewClock())
+		if err != nil {
+			logger.Fatal("jetstream-route-source-error", zap.Error(err))
+		}
+		members = append(members, grouper.Member{Name: "jetstream", Runner: routeSourceRunner(logger.Session("jetstream"), c, jetStream, registry)})
+	}
+
+	if c.EndpointHealthCheck.Enabled {
+		healthChecker := healthchecker.NewHealthChecker(logger.Session("health-checker"), registry, c.EndpointHealthCheck, backendTLSConfig(c), clock.NewClock())
+		members = append(members, grouper.Member{Name: "health-checker", Runner: healthChecker})
+	}
+
+	subscriber := createSubscriber(logger, c, natsClient, registry, messageReporter, startMsgChan)
 
 	members = append(members, grouper.Member{Name: "fdMonitor", Runner: fdMonitor})
+	if routeLatencies != nil {
+		ticker := time.NewTicker(c.RouteLatency.EmitInterval)
+		routeLatencyMonitor := monitor.NewRouteLatency(routeLatencies, ticker.C, sender, logger.Session("route-latency"))
+		members = append(members, grouper.Member{Name: "routeLatencyMonitor", Runner: routeLatencyMonitor})
+	}
 	members = append(members, grouper.Member{Name: "subscriber", Runner: subscriber})
+	if dnsResolver != nil {
+		members = append(members, grouper.Member{Name: "dns-resolver", Runner: dnsResolver})
+	}
+	if ocspStapler != nil {
+		members = append(members, grouper.Member{Name: "ocsp-stapler", Runner: ocspStapler})
+	}
+	if ticketRotator != nil {
+		members = append(members, grouper.Member{Name: "session-tickets", Runner: ticketRotator})
+	}
+	members = append(members, grouper.Member{Name: "log-level", Runner: goRouterLogger.NewLevelSignals(logLevel, logger.Session("log-level"))})
 	members = append(members, grouper.Member{Name: "router", Runner: router})
+	// the process upgraded by this one drains once the router serves the
+	// listeners it handed off
+	members = append(members, grouper.Member{Name: "handoff", Runner: handoff.NewUpgrader(logger.Session("handoff"), c.Upgrades, router.HandOff)})
+	// certificates are obtained once the router answers http-01 challenges
+	if acmeManager != nil {
+		members = append(members, grouper.Member{Name: "acme", Runner: acmeManager})
+	}
 
 	group := grouper.NewOrdered(os.Interrupt, members)
 
@@ -169,6 +392,43 @@ func initializeFDMonitor(sender *metric_sender.MetricSender, logger goRouterLogg
 	return monitor.NewFileDescriptor(path, ticker.C, sender, logger.Session("FileDescriptor"))
 }
 
+func initializeStatsd(logger goRouterLogger.Logger, c *config.Config) *metrics.StatsdReporter {
+	conn, err := net.Dial("udp", c.Statsd.Address)
+	if err != nil {
+		logger.Fatal("statsd-connection-failed", zap.Error(err))
+	}
+	return metrics.NewStatsdReporter(conn, c.Statsd.Prefix, c.Statsd.Tags, c.RouteTags.Metrics)
+}
+
+func initializePrometheus(c *config.Config, registry *rregistry.RouteRegistry, natsClient *nats.Conn, natsMonitor *mbus.ConnectionMonitor) *metrics.PrometheusReporter {
+	reporter := metrics.NewPrometheusReporter(c.Prometheus.MaxRoutes, c.RouteTags.Metrics)
+	reporter.AddGauge("gorouter_routes", "Registered routes.", func() float64 {
+		return float64(registry.NumUris())
+	})
+	reporter.AddGauge("gorouter_endpoints", "Registered endpoints.", func() float64 {
+		return float64(registry.NumEndpoints())
+	})
+	reporter.AddGauge("gorouter_nats_connected", "Whether the router is connected to NATS.", func() float64 {
+		if natsClient.Status() == nats.CONNECTED {
+			return 1
+		}
+		return 0
+	})
+	reporter.AddGauge("gorouter_nats_disconnected_seconds", "Time the router has spent disconnected from NATS.", func() float64 {
+		return natsMonitor.DisconnectedDuration().Seconds()
+	})
+	reporter.AddGauge("gorouter_proxy_buffers_in_use", "Buffers of the proxy buffer pool in use.", func() float64 {
+		return float64(utils.Buffers.Stats().InUse)
+	})
+	reporter.AddGauge("gorouter_proxy_buffer_gets", "Buffers taken from the proxy buffer pool.", func() float64 {
+		return float64(utils.Buffers.Stats().Gets)
+	})
+	reporter.AddGauge("gorouter_proxy_buffer_allocations", "Buffers allocated by the proxy buffer pool.", func() float64 {
+		return float64(utils.Buffers.Stats().Allocations)
+	})
+	return reporter
+}
+
 func initializeMetrics(sender *metric_sender.MetricSender) *metrics.MetricsReporter {
 	// 5 sec is dropsonde default batching interval
 	batcher := metricbatcher.New(sender, 5*time.Second)
@@ -188,17 +448,22 @@ func initializeMetrics(sender *metric_sender.MetricSender) *metrics.MetricsRepor
 	return metrics.NewMetricsReporter(sender, batcher)
 }
 
-func createCrypto(logger goRouterLogger.Logger, secret string) *secure.AesGCM {
+func createCrypto(logger goRouterLogger.Logger, algorithm, secret string) secure.Crypto {
+	var crypto secure.Crypto
+	var err error
 	// generate secure encryption key using key derivation function (pbkdf2)
-	secretPbkdf2 := secure.NewPbkdf2([]byte(secret), 16)
-	crypto, err := secure.NewAesGCM(secretPbkdf2)
+	if algorithm == config.ROUTE_SERVICE_SIGNING_HMAC_SHA256 {
+		crypto, err = secure.NewHmacSHA256(secure.NewPbkdf2([]byte(secret), 32))
+	} else {
+		crypto, err = secure.NewAesGCM(secure.NewPbkdf2([]byte(secret), 16))
+	}
 	if err != nil {
 		logger.Fatal("error-creating-route-service-crypto", zap.Error(err))
 	}
 	return crypto
 }
 
-func buildProxy(logger goRouterLogger.Logger, c *config.Config, registry rregistry.Registry, accessLogger access_log.AccessLogger, reporter metrics.CombinedReporter, crypto secure.Crypto, cryptoPrev secure.Crypto) proxy.Proxy {
+func buildProxy(logger goRouterLogger.Logger, c *config.Config, registry rregistry.Registry, accessLogger access_log.AccessLogger, reporter metrics.CombinedReporter, crypto secure.Crypto, cryptoPrev secure.Crypto, spanExporter tracing.Exporter, tokenValidator handlers.TokenValidator, wasmPlugins *wasm.Plugins, script *scripting.Script, rewriteRules *handlers.RewriteRules, reloadableConfig *config.ReloadableConfig) proxy.Proxy {
 	routeServiceConfig := routeservice.NewRouteServiceConfig(
 		logger,
 		c.RouteServiceEnabled,
@@ -208,13 +473,20 @@ func buildProxy(logger goRouterLogger.Logger, c *config.Config, registry rregist
 		c.RouteServiceRecommendHttps,
 	)
 
+	return proxy.NewProxy(logger, accessLogger, c, registry,
+		reporter, routeServiceConfig, backendTLSConfig(c), &healthCheck, spanExporter, tokenValidator, wasmPlugins, script, rewriteRules, reloadableConfig)
+}
+
+func backendTLSConfig(c *config.Config) *tls.Config {
 	tlsConfig := &tls.Config{
 		CipherSuites:       c.CipherSuites,
 		InsecureSkipVerify: c.SkipSSLValidation,
+		RootCAs:            c.CAPool,
 	}
-
-	return proxy.NewProxy(logger, accessLogger, c, registry,
-		reporter, routeServiceConfig, tlsConfig, &healthCheck)
+	if len(c.Backends.ClientAuthCertificate.Certificate) > 0 {
+		tlsConfig.Certificates = []tls.Certificate{c.Backends.ClientAuthCertificate}
+	}
+	return tlsConfig
 }
 
 func setupRoutingAPIClient(logger goRouterLogger.Logger, c *config.Config) (routing_api.Client, error) {
@@ -259,12 +531,23 @@ func setupRouteFetcher(logger goRouterLogger.Logger, c *config.Config, registry
 	return routeFetcher
 }
 
+// routeSourceRunner syncs the routes of the source with the registry as
+// often as the route fetcher does, so that they are not pruned.
+func routeSourceRunner(logger goRouterLogger.Logger, c *config.Config, source routesource.RouteSource, registry rregistry.Registry) *routesource.Runner {
+	return routesource.NewRunner(logger, source, registry, c.PruneStaleDropletsInterval/2, clock.NewClock())
+}
+
 func newUaaClient(logger goRouterLogger.Logger, clock clock.Clock, c *config.Config) uaa_client.Client {
 	if c.RoutingApi.AuthDisabled {
 		logger.Info("using-noop-token-fetcher")
 		return uaa_client.NewNoOpUaaClient()
 	}
+	return newOAuthClient(logger, clock, c)
+}
 
+// newOAuthClient creates a client of the UAA in the oauth config, which
+// fetches tokens for the router and validates the tokens of requests.
+func newOAuthClient(logger goRouterLogger.Logger, clock clock.Clock, c *config.Config) uaa_client.Client {
 	if c.OAuth.Port == -1 {
 		logger.Fatal(
 			"tls-not-enabled",
@@ -294,13 +577,30 @@ func newUaaClient(logger goRouterLogger.Logger, clock clock.Clock, c *config.Con
 	return uaaClient
 }
 
-func natsOptions(logger goRouterLogger.Logger, c *config.Config, natsHost *atomic.Value, startMsg chan<- struct{}) nats.Options {
+func natsOptions(logger goRouterLogger.Logger, c *config.Config, natsHost *atomic.Value, monitor *mbus.ConnectionMonitor, startMsg chan<- struct{}) nats.Options {
 	natsServers := c.NatsServers()
 
 	options := nats.DefaultOptions
 	options.Servers = natsServers
 	options.PingInterval = c.NatsClientPingInterval
 	options.MaxReconnect = -1
+	options.CustomReconnectDelayCB = mbus.ReconnectDelay(c.NatsClient.ReconnectWait, c.NatsClient.MaxReconnectWait)
+	if c.NatsClient.TLS.Enabled {
+		options.Secure = true
+		options.TLSConfig = &tls.Config{
+			RootCAs:    c.NatsClient.TLS.CAPool,
+			MinVersion: tls.VersionTLS12,
+		}
+		if c.NatsClient.TLS.ClientCertificate != nil {
+			options.TLSConfig.Certificates = []tls.Certificate{*c.NatsClient.TLS.ClientCertificate}
+		}
+	}
+	if c.NatsClient.CredentialsFile != "" {
+		err := nats.UserCredentials(c.NatsClient.CredentialsFile)(&options)
+		if err != nil {
+			logger.Fatal("nats-credentials-error", zap.Error(err))
+		}
+	}
 	connectedChan := make(chan struct{})
 
 	options.ClosedCB = func(conn *nats.Conn) {
@@ -312,6 +612,7 @@ func natsOptions(logger goRouterLogger.Logger, c *config.Config, natsHost *atomi
 	}
 
 	options.DisconnectedCB = func(conn *nats.Conn) {
+		monitor.Disconnected()
 		hostStr := natsHost.Load().(string)
 		logger.Info("nats-connection-disconnected", zap.String("nats-host", hostStr))
 
@@ -331,6 +632,7 @@ func natsOptions(logger goRouterLogger.Logger, c *config.Config, natsHost *atomi
 
 	options.ReconnectedCB = func(conn *nats.Conn) {
 		connectedChan <- struct{}{}
+		outage := monitor.Reconnected()
 
 		natsURL, err := url.Parse(conn.ConnectedUrl())
 		natsHostStr := ""
@@ -341,19 +643,19 @@ func natsOptions(logger goRouterLogger.Logger, c *config.Config, natsHost *atomi
 		}
 		natsHost.Store(natsHostStr)
 
-		logger.Info("nats-connection-reconnected", zap.String("nats-host", natsHostStr))
+		logger.Info("nats-connection-reconnected", zap.String("nats-host", natsHostStr), zap.Duration("disconnected", outage))
 		startMsg <- struct{}{}
 	}
 
 	return options
 }
 
-func connectToNatsServer(logger goRouterLogger.Logger, c *config.Config, startMsg chan<- struct{}) *nats.Conn {
+func connectToNatsServer(logger goRouterLogger.Logger, c *config.Config, monitor *mbus.ConnectionMonitor, startMsg chan<- struct{}) *nats.Conn {
 	var natsClient *nats.Conn
 	var natsHost atomic.Value
 	var err error
 
-	options := natsOptions(logger, c, &natsHost, startMsg)
+	options := natsOptions(logger, c, &natsHost, monitor, startMsg)
 	attempts := 3
 	for attempts > 0 {
 		natsClient, err = options.Connect()
@@ -386,6 +688,7 @@ func createSubscriber(
 	c *config.Config,
 	natsClient *nats.Conn,
 	registry rregistry.Registry,
+	reporter metrics.RouteRegistryReporter,
 	startMsgChan chan struct{},
 ) ifrit.Runner {
 
@@ -398,11 +701,13 @@ func createSubscriber(
 		ID: fmt.Sprintf("%d-%s", c.Index, guid),
 		MinimumRegisterIntervalInSeconds: int(c.StartResponseDelayInterval.Seconds()),
 		PruneThresholdInSeconds:          int(c.DropletStaleThreshold.Seconds()),
+		JetStream:                        c.NatsClient.JetStream.Enabled,
 	}
-	return mbus.NewSubscriber(logger.Session("subscriber"), natsClient, registry, startMsgChan, opts)
+	return mbus.NewSubscriber(logger.Session("subscriber"), natsClient, registry, startMsgChan, opts, reporter)
 }
 
-func createLogger(component string, level string) (goRouterLogger.Logger, lager.LogLevel) {
+func createLogger(component string, cfg config.LoggingConfig) (goRouterLogger.Logger, *goRouterLogger.Level, lager.LogLevel) {
+	level := cfg.Level
 	var logLevel zap.Level
 	logLevel.UnmarshalText([]byte(level))
 
@@ -420,6 +725,18 @@ func createLogger(component string, level string) (goRouterLogger.Logger, lager.
 		panic(fmt.Errorf("unknown log level: %s", level))
 	}
 
-	lggr := goRouterLogger.NewLogger(component, logLevel, zap.Output(os.Stdout))
-	return lggr, minLagerLogLevel
+	options := goRouterLogger.Options{
+		Level:         goRouterLogger.NewLevel(logLevel),
+		SessionLevels: map[string]*goRouterLogger.Level{},
+	}
+	for session, name := range cfg.Components {
+		var sessionLevel zap.Level
+		sessionLevel.UnmarshalText([]byte(name))
+		options.SessionLevels[session] = goRouterLogger.NewLevel(sessionLevel)
+	}
+	if cfg.Sampling.Initial > 0 {
+		options.Sampler = goRouterLogger.NewSampler(cfg.Sampling.Initial, cfg.Sampling.Thereafter, cfg.Sampling.Interval)
+	}
+	lggr := goRouterLogger.NewLoggerWithOptions(component, options, zap.Output(os.Stdout))
+	return lggr, options.Level, minLagerLogLevel
 }
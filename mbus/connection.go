@@ -0,0 +1,81 @@
+package mbus
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+)
+
+// ReconnectDelay returns the delays between the attempts to reconnect to the
+// NATS servers. The delay doubles with every attempt from min up to max, and
+// is shortened by a random jitter of up to half, so that routers disconnected
+// by the same NATS server do not reconnect to the next one all at once.
+func ReconnectDelay(min, max time.Duration) func(attempts int) time.Duration {
+	return func(attempts int) time.Duration {
+		delay := min
+		for i := 1; i < attempts && delay < max; i++ {
+			delay *= 2
+		}
+		if delay > max {
+			delay = max
+		}
+		if delay <= 1 {
+			return delay
+		}
+		return delay - time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+}
+
+// ConnectionMonitor keeps the time the router has spent disconnected from
+// NATS.
+type ConnectionMonitor struct {
+	clock clock.Clock
+
+	lock           sync.Mutex
+	disconnectedAt time.Time
+	disconnected   time.Duration
+}
+
+func NewConnectionMonitor(clock clock.Clock) *ConnectionMonitor {
+	return &ConnectionMonitor{clock: clock}
+}
+
+// Disconnected records the start of a disconnection.
+func (m *ConnectionMonitor) Disconnected() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.disconnectedAt.IsZero() {
+		m.disconnectedAt = m.clock.Now()
+	}
+}
+
+// Reconnected records the end of a disconnection, and returns how long it
+// lasted.
+func (m *ConnectionMonitor) Reconnected() time.Duration {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.disconnectedAt.IsZero() {
+		return 0
+	}
+	outage := m.clock.Since(m.disconnectedAt)
+	m.disconnected += outage
+	m.disconnectedAt = time.Time{}
+	return outage
+}
+
+// DisconnectedDuration returns the total time spent disconnected, including
+// the current disconnection.
+func (m *ConnectionMonitor) DisconnectedDuration() time.Duration {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	total := m.disconnected
+	if !m.disconnectedAt.IsZero() {
+		total += m.clock.Since(m.disconnectedAt)
+	}
+	return total
+}
@@ -0,0 +1,79 @@
+package mbus_test
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/gorouter/mbus"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ReconnectDelay", func() {
+	var delay func(int) time.Duration
+
+	BeforeEach(func() {
+		delay = mbus.ReconnectDelay(time.Second, 30*time.Second)
+	})
+
+	It("doubles the delay with every attempt", func() {
+		for i := 0; i < 100; i++ {
+			Expect(delay(1)).To(BeNumerically("~", 750*time.Millisecond, 250*time.Millisecond))
+			Expect(delay(2)).To(BeNumerically("~", 1500*time.Millisecond, 500*time.Millisecond))
+			Expect(delay(3)).To(BeNumerically("~", 3*time.Second, time.Second))
+		}
+	})
+
+	It("does not exceed the maximum delay", func() {
+		for i := 0; i < 100; i++ {
+			Expect(delay(1000)).To(BeNumerically("~", 22500*time.Millisecond, 7500*time.Millisecond))
+		}
+	})
+
+	It("jitters the delay", func() {
+		delays := map[time.Duration]bool{}
+		for i := 0; i < 100; i++ {
+			delays[delay(5)] = true
+		}
+		Expect(len(delays)).To(BeNumerically(">", 1))
+	})
+})
+
+var _ = Describe("ConnectionMonitor", func() {
+	var (
+		clock   *fakeclock.FakeClock
+		monitor *mbus.ConnectionMonitor
+	)
+
+	BeforeEach(func() {
+		clock = fakeclock.NewFakeClock(time.Now())
+		monitor = mbus.NewConnectionMonitor(clock)
+	})
+
+	It("keeps the time spent disconnected", func() {
+		Expect(monitor.DisconnectedDuration()).To(BeZero())
+
+		monitor.Disconnected()
+		clock.Increment(3 * time.Second)
+		Expect(monitor.DisconnectedDuration()).To(Equal(3 * time.Second))
+
+		clock.Increment(2 * time.Second)
+		Expect(monitor.Reconnected()).To(Equal(5 * time.Second))
+
+		clock.Increment(time.Minute)
+		Expect(monitor.DisconnectedDuration()).To(Equal(5 * time.Second))
+
+		monitor.Disconnected()
+		clock.Increment(time.Second)
+		monitor.Disconnected()
+		clock.Increment(time.Second)
+		Expect(monitor.Reconnected()).To(Equal(2 * time.Second))
+		Expect(monitor.DisconnectedDuration()).To(Equal(7 * time.Second))
+	})
+
+	It("does not count reconnects without a disconnect", func() {
+		Expect(monitor.Reconnected()).To(BeZero())
+		Expect(monitor.DisconnectedDuration()).To(BeZero())
+	})
+})
@@ -0,0 +1,105 @@
+package mbus
+
+import (
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/metrics"
+	"code.cloudfoundry.org/gorouter/routesource"
+
+	"github.com/nats-io/nats"
+	"github.com/uber-go/zap"
+)
+
+// JetStreamSubjects are the subjects of the registrations kept by the stream.
+var JetStreamSubjects = []string{"router.register", "router.unregister"}
+
+// JetStream is a RouteSource of the router.register and router.unregister
+// messages kept by a NATS JetStream stream. Unlike a subscription, its
+// durable consumer delivers the registrations of the last replay interval
+// when the router starts, and the registrations published while the router
+// is disconnected from NATS once it reconnects.
+type JetStream struct {
+	logger   logger.Logger
+	js       nats.JetStreamContext
+	config   config.JetStreamConfig
+	reporter metrics.RouteRegistryReporter
+	clock    clock.Clock
+}
+
+func NewJetStream(logger logger.Logger, natsClient *nats.Conn, cfg config.JetStreamConfig, reporter metrics.RouteRegistryReporter, clock clock.Clock) (*JetStream, error) {
+	js, err := natsClient.JetStream()
+	if err != nil {
+		return nil, err
+	}
+	return &JetStream{
+		logger:   logger,
+		js:       js,
+		config:   cfg,
+		reporter: reporter,
+		clock:    clock,
+	}, nil
+}
+
+// Snapshot returns no routes, as the routes of the stream are kept alive by
+// their clients registering them again.
+func (j *JetStream) Snapshot() ([]routesource.Route, error) {
+	return nil, nil
+}
+
+// Subscribe creates the stream if it does not exist, and replaces the
+// durable consumer of the router with one that delivers the registrations
+// since the start of the replay interval, until stop is closed.
+func (j *JetStream) Subscribe(events chan<- routesource.Event, stop <-chan struct{}) error {
+	err := j.ensureStream()
+	if err != nil {
+		return err
+	}
+
+	// the consumer left by the previous run would deliver from where that
+	// run stopped, rather than from the start of the replay interval
+	err = j.js.DeleteConsumer(j.config.Stream, j.config.Durable)
+	if err != nil && err != nats.ErrConsumerNotFound {
+		return err
+	}
+
+	sub, err := j.js.Subscribe("", func(message *nats.Msg) {
+		handleRegistryMessage(j.logger, j.reporter, "jetstream", message, events, stop)
+		_ = message.Ack()
+	},
+		nats.BindStream(j.config.Stream),
+		nats.Durable(j.config.Durable),
+		nats.StartTime(j.clock.Now().Add(-j.config.Replay)),
+		nats.ManualAck(),
+		nats.AckExplicit(),
+	)
+	if err != nil {
+		return err
+	}
+	j.logger.Info("jetstream-consumer-created", zap.String("stream", j.config.Stream), zap.String("durable", j.config.Durable))
+
+	go func() {
+		<-stop
+		_ = sub.Unsubscribe()
+	}()
+	return nil
+}
+
+func (j *JetStream) ensureStream() error {
+	_, err := j.js.StreamInfo(j.config.Stream)
+	if err != nats.ErrStreamNotFound {
+		return err
+	}
+
+	_, err = j.js.AddStream(&nats.StreamConfig{
+		Name:     j.config.Stream,
+		Subjects: JetStreamSubjects,
+		MaxAge:   j.config.Replay,
+		Storage:  nats.FileStorage,
+	})
+	if err != nil {
+		return err
+	}
+	j.logger.Info("jetstream-stream-created", zap.String("stream", j.config.Stream))
+	return nil
+}
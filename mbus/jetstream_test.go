@@ -0,0 +1,122 @@
+package mbus_test
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/mbus"
+	metricsFakes "code.cloudfoundry.org/gorouter/metrics/fakes"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/routesource"
+	"code.cloudfoundry.org/gorouter/test_util"
+
+	"github.com/nats-io/nats"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JetStream", func() {
+	var (
+		natsRunner *test_util.NATSRunner
+		natsClient *nats.Conn
+		cfg        config.JetStreamConfig
+		clock      *fakeclock.FakeClock
+		events     chan routesource.Event
+		stop       chan struct{}
+	)
+
+	subscribe := func() {
+		source, err := mbus.NewJetStream(test_util.NewTestZapLogger("jetstream-test"), natsClient, cfg, new(metricsFakes.FakeRouteRegistryReporter), clock)
+		Expect(err).ToNot(HaveOccurred())
+		stop = make(chan struct{})
+		Expect(source.Subscribe(events, stop)).To(Succeed())
+	}
+
+	createStream := func() {
+		js, err := natsClient.JetStream()
+		Expect(err).ToNot(HaveOccurred())
+		_, err = js.AddStream(&nats.StreamConfig{Name: cfg.Stream, Subjects: mbus.JetStreamSubjects})
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	register := func(uri string) {
+		err := natsClient.Publish("router.register", []byte(`{"host": "10.0.16.4", "port": 8080, "uris": ["`+uri+`"]}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(natsClient.Flush()).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		natsRunner = test_util.NewJetStreamNATSRunner(int(test_util.NextAvailPort()))
+		natsRunner.Start()
+		natsClient = natsRunner.MessageBus
+
+		cfg = config.DefaultConfig().NatsClient.JetStream
+		cfg.Enabled = true
+		cfg.Durable = "gorouter-test"
+		clock = fakeclock.NewFakeClock(time.Now())
+		events = make(chan routesource.Event, 10)
+	})
+
+	AfterEach(func() {
+		if stop != nil {
+			close(stop)
+			stop = nil
+		}
+		natsRunner.Cleanup()
+	})
+
+	It("creates the stream and delivers registrations", func() {
+		subscribe()
+
+		js, err := natsClient.JetStream()
+		Expect(err).ToNot(HaveOccurred())
+		info, err := js.StreamInfo(cfg.Stream)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Config.Subjects).To(Equal(mbus.JetStreamSubjects))
+		Expect(info.Config.MaxAge).To(Equal(cfg.Replay))
+
+		register("foo.example.com")
+		var e routesource.Event
+		Eventually(events).Should(Receive(&e))
+		Expect(e.Action).To(Equal(routesource.Register))
+		Expect(e.Route.Uri).To(Equal(route.Uri("foo.example.com")))
+	})
+
+	It("delivers unregistrations", func() {
+		subscribe()
+
+		err := natsClient.Publish("router.unregister", []byte(`{"host": "10.0.16.4", "port": 8080, "uris": ["foo.example.com"]}`))
+		Expect(err).ToNot(HaveOccurred())
+		var e routesource.Event
+		Eventually(events).Should(Receive(&e))
+		Expect(e.Action).To(Equal(routesource.Unregister))
+	})
+
+	It("uses an existing stream", func() {
+		createStream()
+		subscribe()
+
+		register("foo.example.com")
+		Eventually(events).Should(Receive())
+	})
+
+	It("replays the registrations of the replay interval when it starts", func() {
+		createStream()
+		register("foo.example.com")
+		subscribe()
+
+		var e routesource.Event
+		Eventually(events).Should(Receive(&e))
+		Expect(e.Route.Uri).To(Equal(route.Uri("foo.example.com")))
+	})
+
+	It("does not replay registrations older than the replay interval", func() {
+		createStream()
+		register("foo.example.com")
+		clock.Increment(cfg.Replay + time.Minute)
+		subscribe()
+
+		Consistently(events).ShouldNot(Receive())
+	})
+})
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 
 	. "code.cloudfoundry.org/gorouter/mbus"
+	"code.cloudfoundry.org/gorouter/route"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -50,6 +51,184 @@ var _ = Describe("RegistryMessage", func() {
 			})
 		})
 
+		Describe("With a payload with a weight", func() {
+			BeforeEach(func() {
+				payload = []byte(`{"dea":"dea1","app":"app1","uris":["test.com"],"host":"1.2.3.4","port":1234,"tags":{},"private_instance_id":"private_instance_id","weight":5}`)
+			})
+
+			It("passes validation", func() {
+				Expect(message.ValidateMessage()).To(BeTrue())
+				Expect(message.Weight).To(Equal(5))
+			})
+		})
+
+		Describe("With a payload with a negative weight", func() {
+			BeforeEach(func() {
+				payload = []byte(`{"dea":"dea1","app":"app1","uris":["test.com"],"host":"1.2.3.4","port":1234,"tags":{},"private_instance_id":"private_instance_id","weight":-1}`)
+			})
+
+			It("fails validation", func() {
+				Expect(message.ValidateMessage()).To(BeFalse())
+			})
+		})
+
+		Describe("With a payload with an http2 protocol", func() {
+			BeforeEach(func() {
+				payload = []byte(`{"dea":"dea1","app":"app1","uris":["test.com"],"host":"1.2.3.4","port":1234,"tags":{},"private_instance_id":"private_instance_id","protocol":"http2"}`)
+			})
+
+			It("passes validation", func() {
+				Expect(message.ValidateMessage()).To(BeTrue())
+				Expect(message.Protocol).To(Equal("http2"))
+			})
+		})
+
+		Describe("With a payload with an unknown protocol", func() {
+			BeforeEach(func() {
+				payload = []byte(`{"dea":"dea1","app":"app1","uris":["test.com"],"host":"1.2.3.4","port":1234,"tags":{},"private_instance_id":"private_instance_id","protocol":"spdy"}`)
+			})
+
+			It("fails validation", func() {
+				Expect(message.ValidateMessage()).To(BeFalse())
+			})
+		})
+
+		Describe("With a payload for a tcp route", func() {
+			BeforeEach(func() {
+				payload = []byte(`{"app":"app1","host":"1.2.3.4","port":1234,"private_instance_id":"private_instance_id","tcp_route":true,"external_port":61000}`)
+			})
+
+			It("passes validation", func() {
+				Expect(message.ValidateMessage()).To(BeTrue())
+				Expect(message.TCPRoute).To(BeTrue())
+				Expect(message.ExternalPort).To(Equal(uint16(61000)))
+			})
+		})
+
+		Describe("With a payload for a tcp route without an external port", func() {
+			BeforeEach(func() {
+				payload = []byte(`{"app":"app1","host":"1.2.3.4","port":1234,"private_instance_id":"private_instance_id","tcp_route":true}`)
+			})
+
+			It("fails validation", func() {
+				Expect(message.ValidateMessage()).To(BeFalse())
+			})
+		})
+
+		Describe("With a payload with a chain of route services", func() {
+			BeforeEach(func() {
+				payload = []byte(`{"app":"app1","uris":["test.com"],"host":"1.2.3.4","port":1234,"route_service_urls":["https://waf.example.com","https://auth.example.com"]}`)
+			})
+
+			It("passes validation", func() {
+				Expect(message.ValidateMessage()).To(BeTrue())
+			})
+		})
+
+		Describe("With a payload with an http route service in its chain", func() {
+			BeforeEach(func() {
+				payload = []byte(`{"app":"app1","uris":["test.com"],"host":"1.2.3.4","port":1234,"route_service_urls":["https://waf.example.com","http://auth.example.com"]}`)
+			})
+
+			It("fails validation", func() {
+				Expect(message.ValidateMessage()).To(BeFalse())
+			})
+		})
+
+		Describe("With a payload with both a route service url and a chain", func() {
+			BeforeEach(func() {
+				payload = []byte(`{"app":"app1","uris":["test.com"],"host":"1.2.3.4","port":1234,"route_service_url":"https://waf.example.com","route_service_urls":["https://auth.example.com"]}`)
+			})
+
+			It("fails validation", func() {
+				Expect(message.ValidateMessage()).To(BeFalse())
+			})
+		})
+
+		Describe("With a payload requiring basic authentication", func() {
+			BeforeEach(func() {
+				payload = []byte(`{"app":"app1","uris":["test.com"],"host":"1.2.3.4","port":1234,"auth":{"type":"basic","htpasswd":"admins"}}`)
+			})
+
+			It("passes validation", func() {
+				Expect(message.ValidateMessage()).To(BeTrue())
+				Expect(message.Auth).To(Equal(&route.Auth{Type: route.AuthBasic, Htpasswd: "admins"}))
+			})
+		})
+
+		Describe("With a payload requiring JWT authentication without scopes", func() {
+			BeforeEach(func() {
+				payload = []byte(`{"app":"app1","uris":["test.com"],"host":"1.2.3.4","port":1234,"auth":{"type":"jwt"}}`)
+			})
+
+			It("fails validation", func() {
+				Expect(message.ValidateMessage()).To(BeFalse())
+			})
+		})
+
+		Describe("With a payload injecting claims of JWT authentication", func() {
+			BeforeEach(func() {
+				payload = []byte(`{"app":"app1","uris":["test.com"],"host":"1.2.3.4","port":1234,"auth":{"type":"jwt","scopes":["app.read"],"claim_headers":{"X-User-Id":"user_id"}}}`)
+			})
+
+			It("passes validation", func() {
+				Expect(message.ValidateMessage()).To(BeTrue())
+				Expect(message.Auth.ClaimHeaders).To(Equal(map[string]string{"X-User-Id": "user_id"}))
+			})
+		})
+
+		Describe("With a payload injecting claims of basic authentication", func() {
+			BeforeEach(func() {
+				payload = []byte(`{"app":"app1","uris":["test.com"],"host":"1.2.3.4","port":1234,"auth":{"type":"basic","htpasswd":"admins","claim_headers":{"X-User-Id":"user_id"}}}`)
+			})
+
+			It("fails validation", func() {
+				Expect(message.ValidateMessage()).To(BeFalse())
+			})
+		})
+
+		Describe("With a payload requiring an unknown authentication", func() {
+			BeforeEach(func() {
+				payload = []byte(`{"app":"app1","uris":["test.com"],"host":"1.2.3.4","port":1234,"auth":{"type":"digest"}}`)
+			})
+
+			It("fails validation", func() {
+				Expect(message.ValidateMessage()).To(BeFalse())
+			})
+		})
+
+		Describe("With a payload restricting client IPs", func() {
+			BeforeEach(func() {
+				payload = []byte(`{"app":"app1","uris":["test.com"],"host":"1.2.3.4","port":1234,"ip_access":{"allow":["10.0.0.0/8"],"deny":["10.0.16.0/24"]}}`)
+			})
+
+			It("passes validation", func() {
+				Expect(message.ValidateMessage()).To(BeTrue())
+				Expect(message.IPAccess.Allow).To(Equal([]string{"10.0.0.0/8"}))
+				Expect(message.IPAccess.Deny).To(Equal([]string{"10.0.16.0/24"}))
+			})
+		})
+
+		Describe("With a payload restricting client IPs with an invalid CIDR", func() {
+			BeforeEach(func() {
+				payload = []byte(`{"app":"app1","uris":["test.com"],"host":"1.2.3.4","port":1234,"ip_access":{"deny":["10.0.16.0/33"]}}`)
+			})
+
+			It("fails validation", func() {
+				Expect(message.ValidateMessage()).To(BeFalse())
+			})
+		})
+
+		Describe("With a payload with a negative max_request_body_size_bytes", func() {
+			BeforeEach(func() {
+				payload = []byte(`{"app":"app1","uris":["test.com"],"host":"1.2.3.4","port":1234,"max_request_body_size_bytes":-1}`)
+			})
+
+			It("fails validation", func() {
+				Expect(message.ValidateMessage()).To(BeFalse())
+			})
+		})
+
 		Describe("With a payload with an http route service url", func() {
 			BeforeEach(func() {
 				payload = []byte(`{"dea":"dea1","app":"app1","uris":["test.com"],"host":"1.2.3.4","port":1234,"tags":{},"route_service_url":"http://www.my-insecure-route.com","private_instance_id":"private_instance_id"}`)
@@ -60,4 +239,66 @@ var _ = Describe("RegistryMessage", func() {
 			})
 		})
 	})
+
+	Describe("ParseRegistryMessage", func() {
+		reason := func(data string) string {
+			_, err := ParseRegistryMessage([]byte(data))
+			Expect(err).To(BeAssignableToTypeOf(&RejectionError{}))
+			return err.(*RejectionError).Reason
+		}
+
+		It("parses version 1 messages leniently", func() {
+			msg, err := ParseRegistryMessage([]byte(`{"host":"1.2.3.4","unknown":true}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(msg.Host).To(Equal("1.2.3.4"))
+		})
+
+		It("parses version 2 messages", func() {
+			msg, err := ParseRegistryMessage([]byte(`{"version":2,"host":"1.2.3.4","tls_port":1234,"server_cert_domain_san":"app.internal","uris":["test.com"],"tags":{"component":"app"},"weight":2,"route_ttl":30}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(msg.Version).To(Equal(SchemaV2))
+			Expect(msg.Uris).To(Equal([]route.Uri{"test.com"}))
+			Expect(msg.RouteTTLInSeconds).To(Equal(30))
+		})
+
+		It("rejects malformed messages", func() {
+			Expect(reason(`{"host":`)).To(Equal(RejectedMalformed))
+			Expect(reason(`{"port":"1234"}`)).To(Equal(RejectedMalformed))
+		})
+
+		It("rejects unsupported versions", func() {
+			Expect(reason(`{"version":3,"host":"1.2.3.4","port":1234,"uris":["test.com"]}`)).To(Equal(RejectedUnsupportedVersion))
+		})
+
+		It("rejects version 2 messages with unknown fields", func() {
+			Expect(reason(`{"version":2,"host":"1.2.3.4","port":1234,"uris":["test.com"],"dea":"dea1"}`)).To(Equal(RejectedUnknownField))
+		})
+
+		It("rejects version 2 messages without required fields", func() {
+			Expect(reason(`{"version":2,"port":1234,"uris":["test.com"]}`)).To(Equal(RejectedMissingField))
+			Expect(reason(`{"version":2,"host":"1.2.3.4","uris":["test.com"]}`)).To(Equal(RejectedMissingField))
+			Expect(reason(`{"version":2,"host":"1.2.3.4","port":1234}`)).To(Equal(RejectedMissingField))
+		})
+
+		It("does not require uris of version 2 messages for tcp routes", func() {
+			_, err := ParseRegistryMessage([]byte(`{"version":2,"host":"1.2.3.4","port":1234,"tcp_route":true,"external_port":61000}`))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("rejects version 2 messages with invalid fields", func() {
+			Expect(reason(`{"version":2,"host":"1.2.3.4","port":1234,"uris":[""]}`)).To(Equal(RejectedInvalidField))
+			Expect(reason(`{"version":2,"host":"1.2.3.4","port":1234,"uris":["test.com"],"tags":{"":"app"}}`)).To(Equal(RejectedInvalidField))
+			Expect(reason(`{"version":2,"host":"1.2.3.4","port":1234,"uris":["test.com"],"route_ttl":-1}`)).To(Equal(RejectedInvalidField))
+			Expect(reason(`{"version":2,"host":"1.2.3.4","port":1234,"uris":["test.com"],"weight":-1}`)).To(Equal(RejectedInvalidField))
+		})
+
+		It("names the field that is not valid", func() {
+			_, err := ParseRegistryMessage([]byte(`{"host":"1.2.3.4","port":1234,"uris":["test.com"],"endpoint_idle_timeout_ms":-1}`))
+			Expect(err).To(MatchError(ContainSubstring("endpoint_idle_timeout_ms must not be negative")))
+
+			_, err = ParseRegistryMessage([]byte(`{"host":"1.2.3.4","port":1234,"uris":["test.com"],"unix_socket":"app.sock"}`))
+			Expect(err).To(MatchError(ContainSubstring("unix_socket must be an absolute path")))
+			Expect(err.(*RejectionError).Reason).To(Equal(RejectedInvalidField))
+		})
+	})
 })
@@ -0,0 +1,84 @@
+package mbus
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Versions of the registration message schema. Messages without a version
+// are version 1, whose fields are all optional and whose unknown fields are
+// ignored. Version 2 messages must name the host, a port or unix socket and,
+// unless they are for a TCP route, the routes of the endpoint, and must not
+// have unknown fields.
+const (
+	SchemaV1 = 1
+	SchemaV2 = 2
+)
+
+// Reasons for rejecting registration messages.
+const (
+	RejectedMalformed          = "malformed"
+	RejectedUnsupportedVersion = "unsupported_version"
+	RejectedUnknownField       = "unknown_field"
+	RejectedMissingField       = "missing_field"
+	RejectedInvalidField       = "invalid_field"
+)
+
+// RejectionError is returned by ParseRegistryMessage for messages that are
+// rejected, with the reason they were rejected.
+type RejectionError struct {
+	Reason  string
+	Message string
+}
+
+func (e *RejectionError) Error() string {
+	return e.Message
+}
+
+func rejection(reason, format string, args ...interface{}) *RejectionError {
+	return &RejectionError{Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
+func invalidField(format string, args ...interface{}) *RejectionError {
+	return rejection(RejectedInvalidField, "Unable to validate message. "+format, args...)
+}
+
+// validateV2 checks the message against the version 2 schema. data is the
+// message the fields of rm were decoded from.
+func (rm *RegistryMessage) validateV2(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(new(RegistryMessage))
+	if err != nil && strings.HasPrefix(err.Error(), "json: unknown field") {
+		return rejection(RejectedUnknownField, "Unable to validate message. %s", strings.TrimPrefix(err.Error(), "json: "))
+	}
+
+	if rm.Host == "" {
+		return rejection(RejectedMissingField, "Unable to validate message. host is required")
+	}
+	if strings.ContainsAny(rm.Host, " \t/") {
+		return rejection(RejectedInvalidField, "Unable to validate message. host %q is not a host name or IP address", rm.Host)
+	}
+	if rm.Port == 0 && rm.TLSPort == 0 && rm.UnixSocket == "" {
+		return rejection(RejectedMissingField, "Unable to validate message. port, tls_port or unix_socket is required")
+	}
+	if !rm.TCPRoute && len(rm.Uris) == 0 {
+		return rejection(RejectedMissingField, "Unable to validate message. uris are required")
+	}
+	for _, uri := range rm.Uris {
+		if strings.TrimSpace(string(uri)) == "" {
+			return rejection(RejectedInvalidField, "Unable to validate message. uris must not be empty")
+		}
+	}
+	for key := range rm.Tags {
+		if key == "" {
+			return rejection(RejectedInvalidField, "Unable to validate message. tags must not have empty keys")
+		}
+	}
+	if rm.StaleThresholdInSeconds < 0 || rm.RouteTTLInSeconds < 0 {
+		return rejection(RejectedInvalidField, "Unable to validate message. stale_threshold_in_seconds and route_ttl must not be negative")
+	}
+	return nil
+}
@@ -2,14 +2,18 @@ package mbus
 
 import (
 	"encoding/json"
-	"errors"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"code.cloudfoundry.org/gorouter/common"
+	"code.cloudfoundry.org/gorouter/config"
 	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/metrics"
 	"code.cloudfoundry.org/gorouter/registry"
 	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/routesource"
 	"code.cloudfoundry.org/localip"
 	"code.cloudfoundry.org/routing-api/models"
 
@@ -19,36 +23,198 @@ import (
 
 // RegistryMessage defines the format of a route registration/unregistration
 type RegistryMessage struct {
-	Host                    string            `json:"host"`
-	Port                    uint16            `json:"port"`
-	Uris                    []route.Uri       `json:"uris"`
-	Tags                    map[string]string `json:"tags"`
-	App                     string            `json:"app"`
-	StaleThresholdInSeconds int               `json:"stale_threshold_in_seconds"`
-	RouteServiceURL         string            `json:"route_service_url"`
-	PrivateInstanceID       string            `json:"private_instance_id"`
-	PrivateInstanceIndex    string            `json:"private_instance_index"`
-	IsolationSegment        string            `json:"isolation_segment"`
+	Version                 int                         `json:"version"`
+	Host                    string                      `json:"host"`
+	Port                    uint16                      `json:"port"`
+	Uris                    []route.Uri                 `json:"uris"`
+	Tags                    map[string]string           `json:"tags"`
+	App                     string                      `json:"app"`
+	StaleThresholdInSeconds int                         `json:"stale_threshold_in_seconds"`
+	RouteTTLInSeconds       int                         `json:"route_ttl"`
+	RouteServiceURL         string                      `json:"route_service_url"`
+	RouteServiceURLs        []string                    `json:"route_service_urls"`
+	PrivateInstanceID       string                      `json:"private_instance_id"`
+	PrivateInstanceIndex    string                      `json:"private_instance_index"`
+	IsolationSegment        string                      `json:"isolation_segment"`
+	Weight                  int                         `json:"weight"`
+	Protocol                string                      `json:"protocol"`
+	TCPRoute                bool                        `json:"tcp_route"`
+	ExternalPort            uint16                      `json:"external_port"`
+	TLSPort                 uint16                      `json:"tls_port"`
+	ServerCertDomainSAN     string                      `json:"server_cert_domain_san"`
+	EndpointTimeoutMs       int                         `json:"endpoint_timeout_ms"`
+	DialTimeoutMs           int                         `json:"endpoint_dial_timeout_ms"`
+	HeaderTimeoutMs         int                         `json:"endpoint_response_header_timeout_ms"`
+	IdleTimeoutMs           int                         `json:"endpoint_idle_timeout_ms"`
+	MaxConnections          int                         `json:"max_connections_per_endpoint"`
+	MaxQueueDepth           int                         `json:"max_queue_depth"`
+	MaxRequestBodySizeBytes int64                       `json:"max_request_body_size_bytes"`
+	CacheResponses          bool                        `json:"cache_responses"`
+	RequestBuffering        string                      `json:"request_buffering"`
+	StripPathPrefix         bool                        `json:"strip_path_prefix"`
+	Group                   string                      `json:"group"`
+	Backup                  bool                        `json:"backup"`
+	AvailabilityZone        string                      `json:"availability_zone"`
+	TrafficRules            []route.TrafficRule         `json:"traffic_rules"`
+	Mirror                  *route.Mirror               `json:"mirror"`
+	HeaderRewrites          *config.HeaderRewriteConfig `json:"header_rewrites"`
+	Maintenance             *route.Maintenance          `json:"maintenance"`
+	Auth                    *route.Auth                 `json:"auth"`
+	IPAccess                *route.IPAccess             `json:"ip_access"`
+	WasmFilters             []string                    `json:"wasm_filters"`
+	ForceHTTPS              bool                        `json:"force_https"`
+	UnixSocket              string                      `json:"unix_socket"`
 }
 
 func (rm *RegistryMessage) makeEndpoint() *route.Endpoint {
-	return route.NewEndpoint(
+	port := rm.Port
+	if rm.TLSPort != 0 {
+		port = rm.TLSPort
+	}
+	host := rm.Host
+	if rm.UnixSocket != "" {
+		host, port = route.UnixSocketPrefix+rm.UnixSocket, 0
+	}
+	routeServiceURL := rm.RouteServiceURL
+	if len(rm.RouteServiceURLs) > 0 {
+		routeServiceURL = rm.RouteServiceURLs[0]
+	}
+
+	endpoint := route.NewEndpoint(
 		rm.App,
-		rm.Host,
-		rm.Port,
+		host,
+		port,
 		rm.PrivateInstanceID,
 		rm.PrivateInstanceIndex,
 		rm.Tags,
 		rm.StaleThresholdInSeconds,
-		rm.RouteServiceURL,
+		routeServiceURL,
 		models.ModificationTag{},
 		rm.IsolationSegment,
 	)
+	endpoint.Weight = rm.Weight
+	endpoint.Protocol = rm.Protocol
+	endpoint.UseTLS = rm.TLSPort != 0
+	endpoint.ServerCertDomainSAN = rm.ServerCertDomainSAN
+	if len(rm.RouteServiceURLs) > 1 {
+		endpoint.RouteServiceChain = rm.RouteServiceURLs
+	}
+	endpoint.Timeout = time.Duration(rm.EndpointTimeoutMs) * time.Millisecond
+	endpoint.DialTimeout = time.Duration(rm.DialTimeoutMs) * time.Millisecond
+	endpoint.ResponseHeaderTimeout = time.Duration(rm.HeaderTimeoutMs) * time.Millisecond
+	endpoint.IdleTimeout = time.Duration(rm.IdleTimeoutMs) * time.Millisecond
+	endpoint.MaxConnections = rm.MaxConnections
+	endpoint.MaxQueueDepth = rm.MaxQueueDepth
+	endpoint.MaxRequestBodySize = rm.MaxRequestBodySizeBytes
+	endpoint.CacheResponses = rm.CacheResponses
+	endpoint.RequestBuffering = rm.RequestBuffering
+	endpoint.StripPathPrefix = rm.StripPathPrefix
+	endpoint.Group = rm.Group
+	endpoint.Backup = rm.Backup
+	endpoint.Zone = rm.AvailabilityZone
+	endpoint.TrafficRules = rm.TrafficRules
+	endpoint.Mirror = rm.Mirror
+	endpoint.HeaderRewrites = rm.HeaderRewrites
+	endpoint.Maintenance = rm.Maintenance
+	endpoint.Auth = rm.Auth
+	endpoint.IPAccess = rm.IPAccess
+	endpoint.WasmFilters = rm.WasmFilters
+	endpoint.ForceHTTPS = rm.ForceHTTPS
+	endpoint.TTL = time.Duration(rm.RouteTTLInSeconds) * time.Second
+	return endpoint
+}
+
+// Routes returns the routes of the message, which are TCP routes if the
+// message is for a TCP route.
+func (rm *RegistryMessage) Routes() []routesource.Route {
+	endpoint := rm.makeEndpoint()
+	if rm.TCPRoute {
+		return []routesource.Route{{ExternalPort: rm.ExternalPort, Endpoint: endpoint}}
+	}
+
+	routes := make([]routesource.Route, 0, len(rm.Uris))
+	for _, uri := range rm.Uris {
+		routes = append(routes, routesource.Route{Uri: uri, Endpoint: endpoint})
+	}
+	return routes
 }
 
 // ValidateMessage checks to ensure the registry message is valid
 func (rm *RegistryMessage) ValidateMessage() bool {
-	return rm.RouteServiceURL == "" || strings.HasPrefix(rm.RouteServiceURL, "https")
+	return rm.validate() == nil
+}
+
+// validate returns the rejection of the first field of the message that is
+// not valid, if any.
+func (rm *RegistryMessage) validate() error {
+	if len(rm.RouteServiceURLs) > 0 {
+		if rm.RouteServiceURL != "" {
+			return invalidField("route_service_url and route_service_urls must not both be set")
+		}
+		for _, u := range rm.RouteServiceURLs {
+			if !strings.HasPrefix(u, "https") {
+				return invalidField("route_service_urls must be https")
+			}
+		}
+	} else if rm.RouteServiceURL != "" && !strings.HasPrefix(rm.RouteServiceURL, "https") {
+		return invalidField("route_service_url must be https")
+	}
+	if rm.Protocol != "" && rm.Protocol != route.ProtocolHTTP1 && rm.Protocol != route.ProtocolHTTP2 {
+		return invalidField("protocol must be http1 or http2")
+	}
+	if rm.TCPRoute && rm.ExternalPort == 0 {
+		return invalidField("tcp routes must have an external_port")
+	}
+	if rm.TLSPort != 0 && (rm.ServerCertDomainSAN == "" || rm.TCPRoute) {
+		return invalidField("tls_port requires a server_cert_domain_san and an http route")
+	}
+	if rm.UnixSocket != "" && !strings.HasPrefix(rm.UnixSocket, "/") {
+		return invalidField("unix_socket must be an absolute path")
+	}
+	if rm.RequestBuffering != "" && rm.RequestBuffering != route.RequestBufferingBuffer && rm.RequestBuffering != route.RequestBufferingStream {
+		return invalidField("request_buffering must be %s or %s", route.RequestBufferingBuffer, route.RequestBufferingStream)
+	}
+
+	nonNegative := []struct {
+		name  string
+		value int64
+	}{
+		{"weight", int64(rm.Weight)},
+		{"endpoint_timeout_ms", int64(rm.EndpointTimeoutMs)},
+		{"endpoint_dial_timeout_ms", int64(rm.DialTimeoutMs)},
+		{"endpoint_response_header_timeout_ms", int64(rm.HeaderTimeoutMs)},
+		{"endpoint_idle_timeout_ms", int64(rm.IdleTimeoutMs)},
+		{"max_connections_per_endpoint", int64(rm.MaxConnections)},
+		{"max_queue_depth", int64(rm.MaxQueueDepth)},
+		{"max_request_body_size_bytes", rm.MaxRequestBodySizeBytes},
+	}
+	for _, f := range nonNegative {
+		if f.value < 0 {
+			return invalidField("%s must not be negative", f.name)
+		}
+	}
+
+	for _, rule := range rm.TrafficRules {
+		if !rule.Valid() {
+			return invalidField("traffic_rules are not valid")
+		}
+	}
+	if rm.Mirror != nil && !rm.Mirror.Valid() {
+		return invalidField("mirror is not valid")
+	}
+	if rm.HeaderRewrites != nil && !rm.HeaderRewrites.Valid() {
+		return invalidField("header_rewrites are not valid")
+	}
+	if rm.Maintenance != nil && !rm.Maintenance.Valid() {
+		return invalidField("maintenance is not valid")
+	}
+	if rm.Auth != nil && !rm.Auth.Valid() {
+		return invalidField("auth is not valid")
+	}
+	if rm.IPAccess != nil && !rm.IPAccess.Valid() {
+		return invalidField("ip_access is not valid")
+	}
+	return nil
 }
 
 // Subscriber subscribes to NATS for all router.* messages and handles them
@@ -58,6 +224,18 @@ type Subscriber struct {
 	startMsgChan  <-chan struct{}
 	opts          *SubscriberOpts
 	routeRegistry registry.Registry
+	reporter      metrics.RouteRegistryReporter
+
+	subscriptionsLock sync.Mutex
+	subscriptions     []*subscription
+}
+
+// subscription keeps the subject and handler of a NATS subscription, to
+// subscribe again when the subscription is no longer valid.
+type subscription struct {
+	subject string
+	handler nats.MsgHandler
+	sub     *nats.Subscription
 }
 
 // SubscriberOpts contains configuration for Subscriber struct
@@ -65,6 +243,9 @@ type SubscriberOpts struct {
 	ID                               string
 	MinimumRegisterIntervalInSeconds int
 	PruneThresholdInSeconds          int
+	// JetStream is set when the registrations are consumed from JetStream,
+	// so the subscriber only sends start messages and answers greetings.
+	JetStream bool
 }
 
 // NewSubscriber returns a new Subscriber
@@ -74,11 +255,13 @@ func NewSubscriber(
 	routeRegistry registry.Registry,
 	startMsgChan <-chan struct{},
 	opts *SubscriberOpts,
+	reporter metrics.RouteRegistryReporter,
 ) *Subscriber {
 	return &Subscriber{
 		logger:        logger,
 		natsClient:    natsClient,
 		routeRegistry: routeRegistry,
+		reporter:      reporter,
 		startMsgChan:  startMsgChan,
 		opts:          opts,
 	}
@@ -95,16 +278,24 @@ func (s *Subscriber) Run(signals <-chan os.Signal, ready chan<- struct{}) error
 	if err != nil {
 		return err
 	}
-	err = s.subscribeRoutes()
-	if err != nil {
-		return err
+	events := make(chan routesource.Event, 1024)
+	stop := make(chan struct{})
+	defer close(stop)
+	if !s.opts.JetStream {
+		err = s.Subscribe(events, stop)
+		if err != nil {
+			return err
+		}
 	}
 
 	close(ready)
 	s.logger.Info("subscriber-started")
 	for {
 		select {
+		case e := <-events:
+			routesource.Apply(s.routeRegistry, e)
 		case <-s.startMsgChan:
+			s.resubscribe()
 			err := s.sendStartMessage()
 			if err != nil {
 				s.logger.Error("failed-to-send-start-message", zap.Error(err))
@@ -116,55 +307,140 @@ func (s *Subscriber) Run(signals <-chan os.Signal, ready chan<- struct{}) error
 	}
 }
 
-func (s *Subscriber) subscribeToGreetMessage() error {
-	_, err := s.natsClient.Subscribe("router.greet", func(msg *nats.Msg) {
-		response, _ := s.startMessage()
-		_ = s.natsClient.Publish(msg.Reply, response)
+// Snapshot returns no routes, as routes registered over NATS are kept alive
+// by their clients registering them again.
+func (s *Subscriber) Snapshot() ([]routesource.Route, error) {
+	return nil, nil
+}
+
+// Subscribe delivers the routes of router.register and router.unregister
+// messages on events until stop is closed.
+func (s *Subscriber) Subscribe(events chan<- routesource.Event, stop <-chan struct{}) error {
+	sub, err := s.subscribe("router.*", func(message *nats.Msg) {
+		handleRegistryMessage(s.logger, s.reporter, "nats", message, events, stop)
 	})
+	if err != nil {
+		return err
+	}
 
-	return err
+	go func() {
+		<-stop
+		s.unsubscribe(sub)
+	}()
+	return nil
 }
 
-func (s *Subscriber) subscribeRoutes() error {
-	natsSubscriber, err := s.natsClient.Subscribe("router.*", func(message *nats.Msg) {
-		msg, regErr := createRegistryMessage(message.Data)
-		if regErr != nil {
-			s.logger.Error("validation-error",
-				zap.Error(regErr),
-				zap.String("payload", string(message.Data)),
-				zap.String("subject", message.Subject),
-			)
-			return
-		}
-		switch message.Subject {
-		case "router.register":
-			s.registerEndpoint(msg)
-		case "router.unregister":
-			s.unregisterEndpoint(msg)
-			s.logger.Info("unregister-route", zap.String("message", string(message.Data)))
-		default:
-		}
-	})
+func (s *Subscriber) subscribe(subject string, handler nats.MsgHandler) (*subscription, error) {
+	natsSubscriber, err := s.natsSubscribe(subject, handler)
+	if err != nil {
+		return nil, err
+	}
 
+	sub := &subscription{subject: subject, handler: handler, sub: natsSubscriber}
+	s.subscriptionsLock.Lock()
+	s.subscriptions = append(s.subscriptions, sub)
+	s.subscriptionsLock.Unlock()
+	return sub, nil
+}
+
+func (s *Subscriber) natsSubscribe(subject string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	natsSubscriber, err := s.natsClient.Subscribe(subject, handler)
+	if err != nil {
+		return nil, err
+	}
 	// Pending limits are set to twice the defaults
 	natsSubscriber.SetPendingLimits(131072, 131072*1024)
-	return err
+	return natsSubscriber, nil
 }
 
-func (s *Subscriber) registerEndpoint(msg *RegistryMessage) {
-	endpoint := msg.makeEndpoint()
-	for _, uri := range msg.Uris {
-		s.routeRegistry.Register(uri, endpoint)
+func (s *Subscriber) unsubscribe(sub *subscription) {
+	s.subscriptionsLock.Lock()
+	defer s.subscriptionsLock.Unlock()
+
+	for i, other := range s.subscriptions {
+		if other == sub {
+			s.subscriptions = append(s.subscriptions[:i], s.subscriptions[i+1:]...)
+			break
+		}
 	}
+	_ = sub.sub.Unsubscribe()
 }
 
-func (s *Subscriber) unregisterEndpoint(msg *RegistryMessage) {
-	endpoint := msg.makeEndpoint()
-	for _, uri := range msg.Uris {
-		s.routeRegistry.Unregister(uri, endpoint)
+// resubscribe subscribes again to the subjects of the subscriptions that are
+// no longer valid, and waits for the NATS server to process the
+// subscriptions, so that no registrations prompted by the start message sent
+// after reconnecting are missed.
+func (s *Subscriber) resubscribe() {
+	s.subscriptionsLock.Lock()
+	for _, sub := range s.subscriptions {
+		if sub.sub.IsValid() {
+			continue
+		}
+		natsSubscriber, err := s.natsSubscribe(sub.subject, sub.handler)
+		if err != nil {
+			s.logger.Error("failed-to-resubscribe", zap.String("subject", sub.subject), zap.Error(err))
+			continue
+		}
+		sub.sub = natsSubscriber
+		s.logger.Info("resubscribed", zap.String("subject", sub.subject))
+	}
+	s.subscriptionsLock.Unlock()
+
+	err := s.natsClient.Flush()
+	if err != nil {
+		s.logger.Error("failed-to-flush-subscriptions", zap.Error(err))
 	}
 }
 
+// handleRegistryMessage delivers the routes of a router.register or
+// router.unregister message on events, with the source of their endpoints,
+// or reports why the message was rejected.
+func handleRegistryMessage(logger logger.Logger, reporter metrics.RouteRegistryReporter, source string, message *nats.Msg, events chan<- routesource.Event, stop <-chan struct{}) {
+	msg, regErr := ParseRegistryMessage(message.Data)
+	if regErr != nil {
+		reason := regErr.(*RejectionError).Reason
+		logger.Error("validation-error",
+			zap.Error(regErr),
+			zap.String("reason", reason),
+			zap.String("payload", string(message.Data)),
+			zap.String("subject", message.Subject),
+		)
+		reporter.CaptureRejectedRegistryMessage(reason)
+		return
+	}
+	routes := msg.Routes()
+	for _, r := range routes {
+		r.Endpoint.Source = source
+	}
+	switch message.Subject {
+	case "router.register":
+		sendEvents(events, stop, routesource.Register, routes)
+	case "router.unregister":
+		sendEvents(events, stop, routesource.Unregister, routes)
+		logger.Info("unregister-route", zap.String("message", string(message.Data)))
+	default:
+	}
+}
+
+func sendEvents(events chan<- routesource.Event, stop <-chan struct{}, action routesource.Action, routes []routesource.Route) {
+	for _, route := range routes {
+		select {
+		case events <- routesource.Event{Action: action, Route: route}:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (s *Subscriber) subscribeToGreetMessage() error {
+	_, err := s.subscribe("router.greet", func(msg *nats.Msg) {
+		response, _ := s.startMessage()
+		_ = s.natsClient.Publish(msg.Reply, response)
+	})
+
+	return err
+}
+
 func (s *Subscriber) startMessage() ([]byte, error) {
 	host, err := localip.LocalIP()
 	if err != nil {
@@ -194,16 +470,30 @@ func (s *Subscriber) sendStartMessage() error {
 	return s.natsClient.Publish("router.start", message)
 }
 
-func createRegistryMessage(data []byte) (*RegistryMessage, error) {
+// ParseRegistryMessage parses and validates a route registration message
+// against the schema of its version. Messages that are rejected return a
+// *RejectionError.
+func ParseRegistryMessage(data []byte) (*RegistryMessage, error) {
 	var msg RegistryMessage
 
 	jsonErr := json.Unmarshal(data, &msg)
 	if jsonErr != nil {
-		return nil, jsonErr
+		return nil, &RejectionError{Reason: RejectedMalformed, Message: jsonErr.Error()}
 	}
 
-	if !msg.ValidateMessage() {
-		return nil, errors.New("Unable to validate message. route_service_url must be https")
+	switch msg.Version {
+	case 0, SchemaV1:
+	case SchemaV2:
+		err := msg.validateV2(data)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, rejection(RejectedUnsupportedVersion, "Unable to validate message. version %d is not supported", msg.Version)
+	}
+
+	if err := msg.validate(); err != nil {
+		return nil, err
 	}
 
 	return &msg, nil
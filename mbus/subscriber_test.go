@@ -4,10 +4,12 @@ import (
 	"encoding/json"
 	"os"
 	"sync/atomic"
+	"time"
 
 	"code.cloudfoundry.org/gorouter/common"
 	"code.cloudfoundry.org/gorouter/logger"
 	"code.cloudfoundry.org/gorouter/mbus"
+	metricsFakes "code.cloudfoundry.org/gorouter/metrics/fakes"
 	"code.cloudfoundry.org/gorouter/registry/fakes"
 	"code.cloudfoundry.org/gorouter/route"
 	"code.cloudfoundry.org/gorouter/test_util"
@@ -25,6 +27,7 @@ var _ = Describe("Subscriber", func() {
 		process ifrit.Process
 
 		registry *fakes.FakeRegistry
+		reporter *metricsFakes.FakeRouteRegistryReporter
 
 		natsRunner   *test_util.NATSRunner
 		natsPort     uint16
@@ -42,6 +45,7 @@ var _ = Describe("Subscriber", func() {
 		natsClient = natsRunner.MessageBus
 
 		registry = new(fakes.FakeRegistry)
+		reporter = new(metricsFakes.FakeRouteRegistryReporter)
 
 		logger = test_util.NewTestZapLogger("mbus-test")
 
@@ -53,7 +57,7 @@ var _ = Describe("Subscriber", func() {
 			PruneThresholdInSeconds:          120,
 		}
 
-		sub = mbus.NewSubscriber(logger, natsClient, registry, startMsgChan, subOpts)
+		sub = mbus.NewSubscriber(logger, natsClient, registry, startMsgChan, subOpts, reporter)
 	})
 
 	AfterEach(func() {
@@ -102,7 +106,7 @@ var _ = Describe("Subscriber", func() {
 	})
 
 	It("errors when publish start message fails", func() {
-		sub = mbus.NewSubscriber(logger, nil, registry, startMsgChan, subOpts)
+		sub = mbus.NewSubscriber(logger, nil, registry, startMsgChan, subOpts, reporter)
 		process = ifrit.Invoke(sub)
 
 		var err error
@@ -155,6 +159,24 @@ var _ = Describe("Subscriber", func() {
 			Expect(startMsg.MinimumRegisterIntervalInSeconds).To(Equal(subOpts.MinimumRegisterIntervalInSeconds))
 			Expect(startMsg.PruneThresholdInSeconds).To(Equal(subOpts.PruneThresholdInSeconds))
 		})
+
+		It("receives greetings and registrations again", func() {
+			natsRunner.Stop()
+			natsRunner.Start()
+			Eventually(natsClient.Status, 4).Should(Equal(nats.CONNECTED))
+			startMsgChan <- struct{}{}
+
+			msgChan := make(chan *nats.Msg, 1)
+			_, err := natsClient.ChanSubscribe("router.greet.test.response", msgChan)
+			Expect(err).ToNot(HaveOccurred())
+			err = natsClient.PublishRequest("router.greet", "router.greet.test.response", []byte{})
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(msgChan).Should(Receive())
+
+			err = natsClient.Publish("router.register", []byte(`{"host": "10.0.16.4", "port": 8080, "uris": ["foo.example.com"]}`))
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+		})
 	})
 
 	Context("when a greeting message is received", func() {
@@ -195,6 +217,46 @@ var _ = Describe("Subscriber", func() {
 		})
 	})
 
+	Context("when a message is rejected", func() {
+		BeforeEach(func() {
+			process = ifrit.Invoke(sub)
+			Eventually(process.Ready()).Should(BeClosed())
+		})
+
+		It("reports the reason", func() {
+			err := natsClient.Publish("router.register", []byte(`{"host": "10.0.16.4", "port": 8080, "uris": ["foo.example.com"], "weight": -1}`))
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(reporter.CaptureRejectedRegistryMessageCallCount).Should(Equal(1))
+			Expect(reporter.CaptureRejectedRegistryMessageArgsForCall(0)).To(Equal(mbus.RejectedInvalidField))
+			Expect(registry.RegisterCallCount()).To(BeZero())
+		})
+	})
+
+	Context("when the message has version 2", func() {
+		BeforeEach(func() {
+			process = ifrit.Invoke(sub)
+			Eventually(process.Ready()).Should(BeClosed())
+		})
+
+		It("registers a valid message", func() {
+			err := natsClient.Publish("router.register", []byte(`{"version": 2, "host": "10.0.16.4", "port": 8080, "uris": ["foo.example.com"], "route_ttl": 30}`))
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			Expect(reporter.CaptureRejectedRegistryMessageCallCount()).To(BeZero())
+		})
+
+		It("rejects a message with unknown fields", func() {
+			err := natsClient.Publish("router.register", []byte(`{"version": 2, "host": "10.0.16.4", "port": 8080, "uris": ["foo.example.com"], "wieght": 5}`))
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(reporter.CaptureRejectedRegistryMessageCallCount).Should(Equal(1))
+			Expect(reporter.CaptureRejectedRegistryMessageArgsForCall(0)).To(Equal(mbus.RejectedUnknownField))
+			Expect(registry.RegisterCallCount()).To(BeZero())
+		})
+	})
+
 	Context("when the message contains an http url for route services", func() {
 		It("does not update the registry", func() {
 			msg := mbus.RegistryMessage{
@@ -218,9 +280,721 @@ var _ = Describe("Subscriber", func() {
 			Consistently(registry.RegisterCallCount).Should(BeZero())
 		})
 	})
+	Context("when the message contains a chain of route services", func() {
+		BeforeEach(func() {
+			process = ifrit.Invoke(sub)
+			Eventually(process.Ready()).Should(BeClosed())
+		})
+
+		It("registers the endpoint with the chain, starting at the first route service", func() {
+			msg := mbus.RegistryMessage{
+				Host:             "host",
+				App:              "app",
+				Port:             1111,
+				Uris:             []route.Uri{"test.example.com"},
+				RouteServiceURLs: []string{"https://waf.example.com", "https://auth.example.com"},
+			}
+
+			data, err := json.Marshal(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			_, endpoint := registry.RegisterArgsForCall(0)
+			Expect(endpoint.RouteServiceUrl).To(Equal("https://waf.example.com"))
+			Expect(endpoint.RouteServiceChain).To(Equal(msg.RouteServiceURLs))
+		})
+	})
+
+	Context("when the message contains a weight", func() {
+		BeforeEach(func() {
+			process = ifrit.Invoke(sub)
+			Eventually(process.Ready()).Should(BeClosed())
+		})
+
+		It("registers the endpoint with that weight", func() {
+			msg := mbus.RegistryMessage{
+				Host:                    "host",
+				App:                     "app",
+				PrivateInstanceID:       "id",
+				PrivateInstanceIndex:    "index",
+				Port:                    1111,
+				StaleThresholdInSeconds: 120,
+				Uris:                    []route.Uri{"test.example.com"},
+				Weight:                  3,
+			}
+
+			data, err := json.Marshal(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			_, endpoint := registry.RegisterArgsForCall(0)
+			Expect(endpoint.Weight).To(Equal(3))
+		})
+	})
+
+	Context("when the message contains a protocol", func() {
+		BeforeEach(func() {
+			process = ifrit.Invoke(sub)
+			Eventually(process.Ready()).Should(BeClosed())
+		})
+
+		It("registers the endpoint with that protocol", func() {
+			msg := mbus.RegistryMessage{
+				Host:                    "host",
+				App:                     "app",
+				PrivateInstanceID:       "id",
+				PrivateInstanceIndex:    "index",
+				Port:                    1111,
+				StaleThresholdInSeconds: 120,
+				Uris:                    []route.Uri{"test.example.com"},
+				Protocol:                "http2",
+			}
+
+			data, err := json.Marshal(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			_, endpoint := registry.RegisterArgsForCall(0)
+			Expect(endpoint.Protocol).To(Equal("http2"))
+			Expect(endpoint.IsHTTP2()).To(BeTrue())
+		})
+	})
+
+	Context("when the message contains an endpoint_timeout_ms", func() {
+		BeforeEach(func() {
+			process = ifrit.Invoke(sub)
+			Eventually(process.Ready()).Should(BeClosed())
+		})
+
+		It("registers the endpoint with that timeout", func() {
+			msg := mbus.RegistryMessage{
+				Host:                    "host",
+				App:                     "app",
+				PrivateInstanceID:       "id",
+				PrivateInstanceIndex:    "index",
+				Port:                    1111,
+				StaleThresholdInSeconds: 120,
+				Uris:                    []route.Uri{"test.example.com"},
+				EndpointTimeoutMs:       1500,
+			}
+
+			data, err := json.Marshal(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			_, endpoint := registry.RegisterArgsForCall(0)
+			Expect(endpoint.Timeout).To(Equal(1500 * time.Millisecond))
+		})
+
+		It("registers the endpoint with the dial, response header and idle timeouts", func() {
+			msg := mbus.RegistryMessage{
+				Host:                    "host",
+				App:                     "app",
+				Port:                    1111,
+				StaleThresholdInSeconds: 120,
+				Uris:                    []route.Uri{"test.example.com"},
+				DialTimeoutMs:           100,
+				HeaderTimeoutMs:         2000,
+				IdleTimeoutMs:           30000,
+			}
+
+			data, err := json.Marshal(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			_, endpoint := registry.RegisterArgsForCall(0)
+			Expect(endpoint.DialTimeout).To(Equal(100 * time.Millisecond))
+			Expect(endpoint.ResponseHeaderTimeout).To(Equal(2 * time.Second))
+			Expect(endpoint.IdleTimeout).To(Equal(30 * time.Second))
+		})
+
+		It("does not register the endpoint when the timeout is negative", func() {
+			msg := mbus.RegistryMessage{
+				Host:                    "host",
+				App:                     "app",
+				Port:                    1111,
+				StaleThresholdInSeconds: 120,
+				Uris:                    []route.Uri{"test.example.com"},
+				EndpointTimeoutMs:       -1,
+			}
+
+			data, err := json.Marshal(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Consistently(registry.RegisterCallCount).Should(BeZero())
+		})
+
+		It("does not register the endpoint when the response header timeout is negative", func() {
+			msg := mbus.RegistryMessage{
+				Host:                    "host",
+				App:                     "app",
+				Port:                    1111,
+				StaleThresholdInSeconds: 120,
+				Uris:                    []route.Uri{"test.example.com"},
+				HeaderTimeoutMs:         -1,
+			}
+
+			data, err := json.Marshal(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Consistently(registry.RegisterCallCount).Should(BeZero())
+		})
+	})
+
+	Context("when the message contains a max_connections_per_endpoint", func() {
+		BeforeEach(func() {
+			process = ifrit.Invoke(sub)
+			Eventually(process.Ready()).Should(BeClosed())
+		})
+
+		It("registers the endpoint with that limit", func() {
+			msg := mbus.RegistryMessage{
+				Host:                    "host",
+				App:                     "app",
+				PrivateInstanceID:       "id",
+				PrivateInstanceIndex:    "index",
+				Port:                    1111,
+				StaleThresholdInSeconds: 120,
+				Uris:                    []route.Uri{"test.example.com"},
+				MaxConnections:          10,
+			}
+
+			data, err := json.Marshal(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			_, endpoint := registry.RegisterArgsForCall(0)
+			Expect(endpoint.MaxConnections).To(Equal(10))
+		})
+
+		It("does not register the endpoint when the limit is negative", func() {
+			msg := mbus.RegistryMessage{
+				Host:                    "host",
+				App:                     "app",
+				Port:                    1111,
+				StaleThresholdInSeconds: 120,
+				Uris:                    []route.Uri{"test.example.com"},
+				MaxConnections:          -1,
+			}
+
+			data, err := json.Marshal(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Consistently(registry.RegisterCallCount).Should(BeZero())
+		})
+	})
+
+	Context("when the message contains a max_queue_depth", func() {
+		BeforeEach(func() {
+			process = ifrit.Invoke(sub)
+			Eventually(process.Ready()).Should(BeClosed())
+		})
+
+		It("registers the endpoint with that queue depth", func() {
+			data := []byte(`{"host": "host", "port": 1111, "uris": ["test.example.com"], "max_queue_depth": 20}`)
+
+			err := natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			_, endpoint := registry.RegisterArgsForCall(0)
+			Expect(endpoint.MaxQueueDepth).To(Equal(20))
+		})
+
+		It("does not register the endpoint when the queue depth is negative", func() {
+			data := []byte(`{"host": "host", "port": 1111, "uris": ["test.example.com"], "max_queue_depth": -1}`)
+
+			err := natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Consistently(registry.RegisterCallCount).Should(BeZero())
+		})
+	})
+
+	Context("when the message contains cache_responses", func() {
+		BeforeEach(func() {
+			process = ifrit.Invoke(sub)
+			Eventually(process.Ready()).Should(BeClosed())
+		})
+
+		It("registers the endpoint with caching enabled", func() {
+			msg := mbus.RegistryMessage{
+				Host:                    "host",
+				App:                     "app",
+				Port:                    1111,
+				StaleThresholdInSeconds: 120,
+				Uris:                    []route.Uri{"test.example.com"},
+				CacheResponses:          true,
+			}
+
+			data, err := json.Marshal(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			_, endpoint := registry.RegisterArgsForCall(0)
+			Expect(endpoint.CacheResponses).To(BeTrue())
+		})
+	})
+
+	Context("when the message contains request_buffering", func() {
+		BeforeEach(func() {
+			process = ifrit.Invoke(sub)
+			Eventually(process.Ready()).Should(BeClosed())
+		})
+
+		It("registers the endpoint with the request buffering mode", func() {
+			data := []byte(`{"host": "host", "port": 1111, "uris": ["test.example.com"], "request_buffering": "stream"}`)
+
+			err := natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			_, endpoint := registry.RegisterArgsForCall(0)
+			Expect(endpoint.RequestBuffering).To(Equal(route.RequestBufferingStream))
+		})
+
+		It("does not register the endpoint when the mode is not supported", func() {
+			data := []byte(`{"host": "host", "port": 1111, "uris": ["test.example.com"], "request_buffering": "always"}`)
+
+			err := natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Consistently(registry.RegisterCallCount).Should(BeZero())
+		})
+	})
+
+	Context("when the message contains strip_path_prefix", func() {
+		BeforeEach(func() {
+			process = ifrit.Invoke(sub)
+			Eventually(process.Ready()).Should(BeClosed())
+		})
+
+		It("registers the endpoint with the context path stripped", func() {
+			data := []byte(`{"host": "host", "port": 1111, "uris": ["test.example.com/api/v2"], "strip_path_prefix": true}`)
+
+			err := natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			uri, endpoint := registry.RegisterArgsForCall(0)
+			Expect(uri).To(Equal(route.Uri("test.example.com/api/v2")))
+			Expect(endpoint.StripPathPrefix).To(BeTrue())
+		})
+	})
+
+	Context("when the message contains header_rewrites", func() {
+		BeforeEach(func() {
+			process = ifrit.Invoke(sub)
+			Eventually(process.Ready()).Should(BeClosed())
+		})
+
+		It("registers the endpoint with the header rules", func() {
+			data := []byte(`{"host": "host", "port": 1111, "uris": ["test.example.com"],
+				"header_rewrites": {"response": {"remove": ["X-Powered-By"]}}}`)
+
+			err := natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			_, endpoint := registry.RegisterArgsForCall(0)
+			Expect(endpoint.HeaderRewrites.Response.Remove).To(Equal([]string{"X-Powered-By"}))
+		})
+
+		It("does not register the endpoint when a rule does not name a header", func() {
+			data := []byte(`{"host": "host", "port": 1111, "uris": ["test.example.com"],
+				"header_rewrites": {"request": {"set": [{"value": "foo"}]}}}`)
+
+			err := natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Consistently(registry.RegisterCallCount).Should(BeZero())
+		})
+	})
+
+	Context("when the message contains traffic_rules", func() {
+		BeforeEach(func() {
+			process = ifrit.Invoke(sub)
+			Eventually(process.Ready()).Should(BeClosed())
+		})
+
+		It("registers the endpoint with its group and the traffic rules", func() {
+			data := []byte(`{"host": "host", "port": 1111, "uris": ["test.example.com"], "group": "v2",
+				"traffic_rules": [{"group": "v2", "header": {"name": "X-Version", "value": "2"}, "percentage": 50}]}`)
+
+			err := natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			_, endpoint := registry.RegisterArgsForCall(0)
+			Expect(endpoint.Group).To(Equal("v2"))
+			Expect(endpoint.TrafficRules).To(Equal([]route.TrafficRule{
+				{Group: "v2", Header: &route.TrafficMatch{Name: "X-Version", Value: "2"}, Percentage: 50},
+			}))
+		})
+
+		It("does not register the endpoint when a rule does not name a group", func() {
+			data := []byte(`{"host": "host", "port": 1111, "uris": ["test.example.com"],
+				"traffic_rules": [{"query": {"name": "version"}}]}`)
+
+			err := natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Consistently(registry.RegisterCallCount).Should(BeZero())
+		})
+	})
+
+	Context("when the message registers a backup endpoint", func() {
+		BeforeEach(func() {
+			process = ifrit.Invoke(sub)
+			Eventually(process.Ready()).Should(BeClosed())
+		})
+
+		It("registers the endpoint as a backup", func() {
+			data := []byte(`{"host": "host", "port": 1111, "uris": ["test.example.com"], "backup": true}`)
+
+			err := natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			_, endpoint := registry.RegisterArgsForCall(0)
+			Expect(endpoint.Backup).To(BeTrue())
+		})
+	})
+
+	Context("when the message contains an availability zone", func() {
+		BeforeEach(func() {
+			process = ifrit.Invoke(sub)
+			Eventually(process.Ready()).Should(BeClosed())
+		})
+
+		It("registers the endpoint in the zone", func() {
+			data := []byte(`{"host": "host", "port": 1111, "uris": ["test.example.com"], "availability_zone": "z1"}`)
+
+			err := natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			_, endpoint := registry.RegisterArgsForCall(0)
+			Expect(endpoint.Zone).To(Equal("z1"))
+		})
+	})
+
+	Context("when the message contains wasm filters", func() {
+		BeforeEach(func() {
+			process = ifrit.Invoke(sub)
+			Eventually(process.Ready()).Should(BeClosed())
+		})
+
+		It("registers the endpoint with the filters", func() {
+			data := []byte(`{"host": "host", "port": 1111, "uris": ["test.example.com"], "wasm_filters": ["add-header", "auth"]}`)
+
+			err := natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			_, endpoint := registry.RegisterArgsForCall(0)
+			Expect(endpoint.WasmFilters).To(Equal([]string{"add-header", "auth"}))
+		})
+	})
+
+	Context("when the message forces HTTPS", func() {
+		BeforeEach(func() {
+			process = ifrit.Invoke(sub)
+			Eventually(process.Ready()).Should(BeClosed())
+		})
+
+		It("registers the endpoint forcing HTTPS", func() {
+			data := []byte(`{"host": "host", "port": 1111, "uris": ["test.example.com"], "force_https": true}`)
+
+			err := natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			_, endpoint := registry.RegisterArgsForCall(0)
+			Expect(endpoint.ForceHTTPS).To(BeTrue())
+		})
+	})
+
+	Context("when the message contains a mirror", func() {
+		BeforeEach(func() {
+			process = ifrit.Invoke(sub)
+			Eventually(process.Ready()).Should(BeClosed())
+		})
+
+		It("registers the endpoint with the mirror", func() {
+			data := []byte(`{"host": "host", "port": 1111, "uris": ["test.example.com"],
+				"mirror": {"uri": "test-v2.example.com", "percentage": 10}}`)
+
+			err := natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			_, endpoint := registry.RegisterArgsForCall(0)
+			percentage := 10.0
+			Expect(endpoint.Mirror).To(Equal(&route.Mirror{Uri: "test-v2.example.com", Percentage: &percentage}))
+		})
+
+		It("does not set the percentage when the mirror has none", func() {
+			data := []byte(`{"host": "host", "port": 1111, "uris": ["test.example.com"],
+				"mirror": {"uri": "test-v2.example.com"}}`)
+
+			err := natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			_, endpoint := registry.RegisterArgsForCall(0)
+			Expect(endpoint.Mirror.Percentage).To(BeNil())
+		})
+
+		It("does not register the endpoint when the mirror does not name a route", func() {
+			data := []byte(`{"host": "host", "port": 1111, "uris": ["test.example.com"],
+				"mirror": {"percentage": 10}}`)
+
+			err := natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Consistently(registry.RegisterCallCount).Should(BeZero())
+		})
+	})
+
+	Context("when the message puts the route in maintenance", func() {
+		BeforeEach(func() {
+			process = ifrit.Invoke(sub)
+			Eventually(process.Ready()).Should(BeClosed())
+		})
+
+		It("registers the endpoint with the maintenance response", func() {
+			data := []byte(`{"host": "host", "port": 1111, "uris": ["test.example.com"],
+				"maintenance": {"status": 503, "content_type": "text/html", "body": "<h1>Back soon</h1>", "retry_after_seconds": 600}}`)
+
+			err := natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			_, endpoint := registry.RegisterArgsForCall(0)
+			Expect(endpoint.Maintenance).To(Equal(&route.Maintenance{
+				Status:            503,
+				ContentType:       "text/html",
+				Body:              "<h1>Back soon</h1>",
+				RetryAfterSeconds: 600,
+			}))
+		})
+
+		It("does not register the endpoint when the status is invalid", func() {
+			data := []byte(`{"host": "host", "port": 1111, "uris": ["test.example.com"],
+				"maintenance": {"status": 42}}`)
+
+			err := natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Consistently(registry.RegisterCallCount).Should(BeZero())
+		})
+	})
+
+	Context("when the message has a route_ttl", func() {
+		BeforeEach(func() {
+			process = ifrit.Invoke(sub)
+			Eventually(process.Ready()).Should(BeClosed())
+		})
+
+		It("registers the endpoint with the TTL", func() {
+			data := []byte(`{"host": "host", "port": 1111, "uris": ["test.example.com"], "route_ttl": 300}`)
+
+			err := natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			_, endpoint := registry.RegisterArgsForCall(0)
+			Expect(endpoint.TTL).To(Equal(300 * time.Second))
+		})
+	})
+
+	Context("when the message contains a tls_port", func() {
+		var msg mbus.RegistryMessage
+
+		BeforeEach(func() {
+			process = ifrit.Invoke(sub)
+			Eventually(process.Ready()).Should(BeClosed())
+
+			msg = mbus.RegistryMessage{
+				Host:                    "host",
+				App:                     "app",
+				PrivateInstanceID:       "id",
+				PrivateInstanceIndex:    "index",
+				Port:                    1111,
+				TLSPort:                 1112,
+				ServerCertDomainSAN:     "some-san",
+				StaleThresholdInSeconds: 120,
+				Uris:                    []route.Uri{"test.example.com"},
+			}
+		})
+
+		It("registers a TLS endpoint on the tls_port", func() {
+			data, err := json.Marshal(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			_, endpoint := registry.RegisterArgsForCall(0)
+			Expect(endpoint.CanonicalAddr()).To(Equal("host:1112"))
+			Expect(endpoint.UseTLS).To(BeTrue())
+			Expect(endpoint.ServerCertDomainSAN).To(Equal("some-san"))
+		})
+
+		It("does not register the endpoint without a server_cert_domain_san", func() {
+			msg.ServerCertDomainSAN = ""
+			data, err := json.Marshal(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Consistently(registry.RegisterCallCount).Should(BeZero())
+		})
+
+		It("registers an http2 endpoint over TLS", func() {
+			msg.Protocol = "http2"
+			data, err := json.Marshal(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			_, endpoint := registry.RegisterArgsForCall(0)
+			Expect(endpoint.IsHTTP2()).To(BeTrue())
+			Expect(endpoint.UseTLS).To(BeTrue())
+			Expect(endpoint.ServerCertDomainSAN).To(Equal("some-san"))
+		})
+	})
+
+	Context("when the message contains a unix_socket", func() {
+		var msg mbus.RegistryMessage
+
+		BeforeEach(func() {
+			process = ifrit.Invoke(sub)
+			Eventually(process.Ready()).Should(BeClosed())
+
+			msg = mbus.RegistryMessage{
+				Host:                    "host",
+				App:                     "app",
+				PrivateInstanceID:       "id",
+				PrivateInstanceIndex:    "index",
+				Port:                    1111,
+				UnixSocket:              "/var/vcap/data/app.sock",
+				StaleThresholdInSeconds: 120,
+				Uris:                    []route.Uri{"test.example.com"},
+			}
+		})
+
+		It("registers an endpoint on the unix socket", func() {
+			data, err := json.Marshal(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterCallCount).Should(Equal(1))
+			_, endpoint := registry.RegisterArgsForCall(0)
+			Expect(endpoint.CanonicalAddr()).To(Equal("unix:/var/vcap/data/app.sock"))
+			Expect(endpoint.UnixSocket()).To(Equal("/var/vcap/data/app.sock"))
+		})
+
+		It("does not register the endpoint with a relative path", func() {
+			msg.UnixSocket = "app.sock"
+			data, err := json.Marshal(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Consistently(registry.RegisterCallCount).Should(BeZero())
+		})
+	})
+
+	Context("when the message is for a tcp route", func() {
+		var msg mbus.RegistryMessage
+
+		BeforeEach(func() {
+			process = ifrit.Invoke(sub)
+			Eventually(process.Ready()).Should(BeClosed())
+
+			msg = mbus.RegistryMessage{
+				Host:                    "host",
+				App:                     "app",
+				PrivateInstanceID:       "id",
+				PrivateInstanceIndex:    "index",
+				Port:                    1111,
+				StaleThresholdInSeconds: 120,
+				TCPRoute:                true,
+				ExternalPort:            61000,
+			}
+		})
+
+		It("registers the endpoint by port", func() {
+			data, err := json.Marshal(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = natsClient.Publish("router.register", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.RegisterTCPCallCount).Should(Equal(1))
+			port, endpoint := registry.RegisterTCPArgsForCall(0)
+			Expect(port).To(Equal(uint16(61000)))
+			Expect(endpoint.CanonicalAddr()).To(Equal("host:1111"))
+			Expect(registry.RegisterCallCount()).To(BeZero())
+		})
+
+		It("unregisters the endpoint by port", func() {
+			data, err := json.Marshal(msg)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = natsClient.Publish("router.unregister", data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(registry.UnregisterTCPCallCount).Should(Equal(1))
+			port, endpoint := registry.UnregisterTCPArgsForCall(0)
+			Expect(port).To(Equal(uint16(61000)))
+			Expect(endpoint.CanonicalAddr()).To(Equal("host:1111"))
+			Expect(registry.UnregisterCallCount()).To(BeZero())
+		})
+	})
+
 	Context("when a route is unregistered", func() {
 		BeforeEach(func() {
-			sub = mbus.NewSubscriber(logger, natsClient, registry, startMsgChan, subOpts)
+			sub = mbus.NewSubscriber(logger, natsClient, registry, startMsgChan, subOpts, reporter)
 			process = ifrit.Invoke(sub)
 			Eventually(process.Ready()).Should(BeClosed())
 		})
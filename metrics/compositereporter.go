@@ -27,6 +27,7 @@ type ProxyReporter interface {
 	CaptureRouteServiceResponse(res *http.Response)
 	CaptureWebSocketUpdate()
 	CaptureWebSocketFailure()
+	CaptureWebSocketConnections(active int)
 }
 
 type ComponentTagged interface {
@@ -39,6 +40,7 @@ type RouteRegistryReporter interface {
 	CaptureLookupTime(t time.Duration)
 	CaptureRegistryMessage(msg ComponentTagged)
 	CaptureUnregistryMessage(msg ComponentTagged)
+	CaptureRejectedRegistryMessage(reason string)
 }
 
 //go:generate counterfeiter -o fakes/fake_combinedreporter.go . CombinedReporter
@@ -48,55 +50,193 @@ type CombinedReporter interface {
 	CaptureRoutingRequest(b *route.Endpoint)
 	CaptureRoutingResponse(statusCode int)
 	CaptureRoutingResponseLatency(b *route.Endpoint, statusCode int, t time.Time, d time.Duration)
+	CaptureRouteResponseLatency(route string, d time.Duration)
 	CaptureRouteServiceResponse(res *http.Response)
 	CaptureWebSocketUpdate()
 	CaptureWebSocketFailure()
+	CaptureWebSocketConnections(active int)
+	CaptureAppRequest(appID string)
+	CaptureAppQuotaExceeded(appID string)
+	CaptureTLSHandshake(version, cipherSuite string, resumed bool)
+	CaptureTLSHandshakeFailure(reason string)
+	CaptureTLSConnections(active int)
 }
 
+// CompositeReporter reports to varz and to each of its proxy reporters.
 type CompositeReporter struct {
-	varzReporter  VarzReporter
-	proxyReporter ProxyReporter
+	varzReporter   VarzReporter
+	proxyReporters []ProxyReporter
 }
 
-func NewCompositeReporter(varzReporter VarzReporter, proxyReporter ProxyReporter) CombinedReporter {
+func NewCompositeReporter(varzReporter VarzReporter, proxyReporters ...ProxyReporter) CombinedReporter {
 	return &CompositeReporter{
-		varzReporter:  varzReporter,
-		proxyReporter: proxyReporter,
+		varzReporter:   varzReporter,
+		proxyReporters: proxyReporters,
 	}
 }
 
 func (c *CompositeReporter) CaptureBadRequest() {
 	c.varzReporter.CaptureBadRequest()
-	c.proxyReporter.CaptureBadRequest()
+	for _, r := range c.proxyReporters {
+		r.CaptureBadRequest()
+	}
 }
 
 func (c *CompositeReporter) CaptureBadGateway() {
 	c.varzReporter.CaptureBadGateway()
-	c.proxyReporter.CaptureBadGateway()
+	for _, r := range c.proxyReporters {
+		r.CaptureBadGateway()
+	}
 }
 
 func (c *CompositeReporter) CaptureRoutingRequest(b *route.Endpoint) {
 	c.varzReporter.CaptureRoutingRequest(b)
-	c.proxyReporter.CaptureRoutingRequest(b)
+	for _, r := range c.proxyReporters {
+		r.CaptureRoutingRequest(b)
+	}
 }
 
 func (c *CompositeReporter) CaptureRouteServiceResponse(res *http.Response) {
-	c.proxyReporter.CaptureRouteServiceResponse(res)
+	for _, r := range c.proxyReporters {
+		r.CaptureRouteServiceResponse(res)
+	}
 }
 
 func (c *CompositeReporter) CaptureRoutingResponse(statusCode int) {
-	c.proxyReporter.CaptureRoutingResponse(statusCode)
+	for _, r := range c.proxyReporters {
+		r.CaptureRoutingResponse(statusCode)
+	}
 }
 
 func (c *CompositeReporter) CaptureRoutingResponseLatency(b *route.Endpoint, statusCode int, t time.Time, d time.Duration) {
 	c.varzReporter.CaptureRoutingResponseLatency(b, statusCode, t, d)
-	c.proxyReporter.CaptureRoutingResponseLatency(b, d)
+	for _, r := range c.proxyReporters {
+		r.CaptureRoutingResponseLatency(b, d)
+	}
+}
+
+// CaptureRouteResponseLatency reports the latency to varz and the proxy
+// reporters that track latencies per route.
+func (c *CompositeReporter) CaptureRouteResponseLatency(route string, d time.Duration) {
+	if rr, ok := c.varzReporter.(RouteReporter); ok {
+		rr.CaptureRouteResponseLatency(route, d)
+	}
+	for _, r := range c.proxyReporters {
+		if rr, ok := r.(RouteReporter); ok {
+			rr.CaptureRouteResponseLatency(route, d)
+		}
+	}
+}
+
+// CaptureAppRequest reports the request to the proxy reporters that count
+// requests per application.
+func (c *CompositeReporter) CaptureAppRequest(appID string) {
+	for _, r := range c.proxyReporters {
+		if ar, ok := r.(AppReporter); ok {
+			ar.CaptureAppRequest(appID)
+		}
+	}
+}
+
+// CaptureAppQuotaExceeded reports the rejected request to the proxy
+// reporters that count requests per application.
+func (c *CompositeReporter) CaptureAppQuotaExceeded(appID string) {
+	for _, r := range c.proxyReporters {
+		if ar, ok := r.(AppReporter); ok {
+			ar.CaptureAppQuotaExceeded(appID)
+		}
+	}
+}
+
+// tlsReporters returns varz and the proxy reporters that track the TLS
+// listener.
+func (c *CompositeReporter) tlsReporters() []TLSReporter {
+	var reporters []TLSReporter
+	if tr, ok := c.varzReporter.(TLSReporter); ok {
+		reporters = append(reporters, tr)
+	}
+	for _, r := range c.proxyReporters {
+		if tr, ok := r.(TLSReporter); ok {
+			reporters = append(reporters, tr)
+		}
+	}
+	return reporters
+}
+
+func (c *CompositeReporter) CaptureTLSHandshake(version, cipherSuite string, resumed bool) {
+	for _, r := range c.tlsReporters() {
+		r.CaptureTLSHandshake(version, cipherSuite, resumed)
+	}
+}
+
+func (c *CompositeReporter) CaptureTLSHandshakeFailure(reason string) {
+	for _, r := range c.tlsReporters() {
+		r.CaptureTLSHandshakeFailure(reason)
+	}
+}
+
+func (c *CompositeReporter) CaptureTLSConnections(active int) {
+	for _, r := range c.tlsReporters() {
+		r.CaptureTLSConnections(active)
+	}
 }
 
 func (c *CompositeReporter) CaptureWebSocketUpdate() {
-	c.proxyReporter.CaptureWebSocketUpdate()
+	for _, r := range c.proxyReporters {
+		r.CaptureWebSocketUpdate()
+	}
 }
 
 func (c *CompositeReporter) CaptureWebSocketFailure() {
-	c.proxyReporter.CaptureWebSocketFailure()
+	for _, r := range c.proxyReporters {
+		r.CaptureWebSocketFailure()
+	}
+}
+
+func (c *CompositeReporter) CaptureWebSocketConnections(active int) {
+	for _, r := range c.proxyReporters {
+		r.CaptureWebSocketConnections(active)
+	}
+}
+
+// CompositeRegistryReporter reports registry metrics to each of its
+// reporters.
+type CompositeRegistryReporter struct {
+	reporters []RouteRegistryReporter
+}
+
+func NewCompositeRegistryReporter(reporters ...RouteRegistryReporter) RouteRegistryReporter {
+	return &CompositeRegistryReporter{
+		reporters: reporters,
+	}
+}
+
+func (c *CompositeRegistryReporter) CaptureRouteStats(totalRoutes int, msSinceLastUpdate uint64) {
+	for _, r := range c.reporters {
+		r.CaptureRouteStats(totalRoutes, msSinceLastUpdate)
+	}
+}
+
+func (c *CompositeRegistryReporter) CaptureLookupTime(t time.Duration) {
+	for _, r := range c.reporters {
+		r.CaptureLookupTime(t)
+	}
+}
+
+func (c *CompositeRegistryReporter) CaptureRegistryMessage(msg ComponentTagged) {
+	for _, r := range c.reporters {
+		r.CaptureRegistryMessage(msg)
+	}
+}
+
+func (c *CompositeRegistryReporter) CaptureUnregistryMessage(msg ComponentTagged) {
+	for _, r := range c.reporters {
+		r.CaptureUnregistryMessage(msg)
+	}
+}
+
+func (c *CompositeRegistryReporter) CaptureRejectedRegistryMessage(reason string) {
+	for _, r := range c.reporters {
+		r.CaptureRejectedRegistryMessage(reason)
+	}
 }
@@ -106,4 +106,116 @@ var _ = Describe("CompositeReporter", func() {
 
 		Expect(fakeProxyReporter.CaptureWebSocketFailureCallCount()).To(Equal(1))
 	})
+
+	It("forwards CaptureWebSocketConnections to proxy reporter", func() {
+		composite.CaptureWebSocketConnections(3)
+
+		Expect(fakeProxyReporter.CaptureWebSocketConnectionsCallCount()).To(Equal(1))
+		Expect(fakeProxyReporter.CaptureWebSocketConnectionsArgsForCall(0)).To(Equal(3))
+	})
+
+	Context("when varz tracks the latencies of routes", func() {
+		var routeLatencies *metrics.RouteLatencies
+
+		BeforeEach(func() {
+			routeLatencies = metrics.NewRouteLatencies(10)
+			varzReporter := struct {
+				*fakes.FakeVarzReporter
+				*metrics.RouteLatencies
+			}{fakeVarzReporter, routeLatencies}
+			composite = metrics.NewCompositeReporter(varzReporter, fakeProxyReporter)
+		})
+
+		It("forwards CaptureRouteResponseLatency to varz", func() {
+			composite.CaptureRouteResponseLatency("example.com", responseDuration)
+
+			Expect(routeLatencies.Snapshot()["example.com"].Requests).To(Equal(int64(1)))
+		})
+	})
+
+	Context("with several proxy reporters", func() {
+		var prometheusReporter *metrics.PrometheusReporter
+
+		BeforeEach(func() {
+			prometheusReporter = metrics.NewPrometheusReporter(10, nil)
+			composite = metrics.NewCompositeReporter(fakeVarzReporter, fakeProxyReporter, prometheusReporter)
+		})
+
+		It("forwards to each of them", func() {
+			composite.CaptureBadGateway()
+
+			Expect(fakeProxyReporter.CaptureBadGatewayCallCount()).To(Equal(1))
+			Expect(prometheusText(prometheusReporter)).To(ContainSubstring("gorouter_bad_gateways_total 1\n"))
+		})
+
+		It("forwards CaptureRouteResponseLatency to the reporters that track routes", func() {
+			composite.CaptureRouteResponseLatency("example.com", responseDuration)
+
+			Expect(prometheusText(prometheusReporter)).To(ContainSubstring(`gorouter_request_duration_seconds_count{route="example.com"} 1`))
+		})
+
+		It("forwards application requests to the reporters that track applications", func() {
+			composite.CaptureAppRequest("app-guid")
+			composite.CaptureAppQuotaExceeded("app-guid")
+
+			text := prometheusText(prometheusReporter)
+			Expect(text).To(ContainSubstring(`gorouter_app_requests_total{app_id="app-guid"} 1`))
+			Expect(text).To(ContainSubstring(`gorouter_app_quota_rejections_total{app_id="app-guid"} 1`))
+		})
+
+		It("forwards TLS metrics to the reporters that track the TLS listener", func() {
+			composite.CaptureTLSHandshake("TLSv1.2", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", false)
+			composite.CaptureTLSHandshakeFailure("timeout")
+			composite.CaptureTLSConnections(1)
+
+			text := prometheusText(prometheusReporter)
+			Expect(text).To(ContainSubstring(`gorouter_tls_handshakes_total{version="TLSv1.2"} 1`))
+			Expect(text).To(ContainSubstring(`gorouter_tls_handshake_failures_total{reason="timeout"} 1`))
+			Expect(text).To(ContainSubstring("gorouter_tls_connections 1\n"))
+		})
+	})
+})
+
+var _ = Describe("CompositeRegistryReporter", func() {
+	var (
+		fakeRegistryReporters []*fakes.FakeRouteRegistryReporter
+		composite             metrics.RouteRegistryReporter
+	)
+
+	BeforeEach(func() {
+		fakeRegistryReporters = []*fakes.FakeRouteRegistryReporter{
+			new(fakes.FakeRouteRegistryReporter),
+			new(fakes.FakeRouteRegistryReporter),
+		}
+		composite = metrics.NewCompositeRegistryReporter(fakeRegistryReporters[0], fakeRegistryReporters[1])
+	})
+
+	It("forwards CaptureRouteStats to each reporter", func() {
+		composite.CaptureRouteStats(3, 100)
+
+		for _, r := range fakeRegistryReporters {
+			Expect(r.CaptureRouteStatsCallCount()).To(Equal(1))
+			totalRoutes, msSinceLastUpdate := r.CaptureRouteStatsArgsForCall(0)
+			Expect(totalRoutes).To(Equal(3))
+			Expect(msSinceLastUpdate).To(Equal(uint64(100)))
+		}
+	})
+
+	It("forwards CaptureLookupTime to each reporter", func() {
+		composite.CaptureLookupTime(time.Millisecond)
+
+		for _, r := range fakeRegistryReporters {
+			Expect(r.CaptureLookupTimeCallCount()).To(Equal(1))
+		}
+	})
+
+	It("forwards registry messages to each reporter", func() {
+		composite.CaptureRegistryMessage(componentTagged("uaa"))
+		composite.CaptureUnregistryMessage(componentTagged("uaa"))
+
+		for _, r := range fakeRegistryReporters {
+			Expect(r.CaptureRegistryMessageCallCount()).To(Equal(1))
+			Expect(r.CaptureUnregistryMessageCallCount()).To(Equal(1))
+		}
+	})
 })
@@ -35,17 +35,55 @@ type FakeCombinedReporter struct {
 		t          time.Time
 		d          time.Duration
 	}
+	CaptureRouteResponseLatencyStub        func(route string, d time.Duration)
+	captureRouteResponseLatencyMutex       sync.RWMutex
+	captureRouteResponseLatencyArgsForCall []struct {
+		route string
+		d     time.Duration
+	}
 	CaptureRouteServiceResponseStub        func(res *http.Response)
 	captureRouteServiceResponseMutex       sync.RWMutex
 	captureRouteServiceResponseArgsForCall []struct {
 		res *http.Response
 	}
-	CaptureWebSocketUpdateStub         func()
-	captureWebSocketUpdateMutex        sync.RWMutex
-	captureWebSocketUpdateArgsForCall  []struct{}
-	CaptureWebSocketFailureStub        func()
-	captureWebSocketFailureMutex       sync.RWMutex
-	captureWebSocketFailureArgsForCall []struct{}
+	CaptureWebSocketUpdateStub             func()
+	captureWebSocketUpdateMutex            sync.RWMutex
+	captureWebSocketUpdateArgsForCall      []struct{}
+	CaptureWebSocketFailureStub            func()
+	captureWebSocketFailureMutex           sync.RWMutex
+	captureWebSocketFailureArgsForCall     []struct{}
+	CaptureWebSocketConnectionsStub        func(active int)
+	captureWebSocketConnectionsMutex       sync.RWMutex
+	captureWebSocketConnectionsArgsForCall []struct {
+		active int
+	}
+	CaptureAppRequestStub        func(appID string)
+	captureAppRequestMutex       sync.RWMutex
+	captureAppRequestArgsForCall []struct {
+		appID string
+	}
+	CaptureAppQuotaExceededStub        func(appID string)
+	captureAppQuotaExceededMutex       sync.RWMutex
+	captureAppQuotaExceededArgsForCall []struct {
+		appID string
+	}
+	CaptureTLSHandshakeStub        func(version, cipherSuite string, resumed bool)
+	captureTLSHandshakeMutex       sync.RWMutex
+	captureTLSHandshakeArgsForCall []struct {
+		version     string
+		cipherSuite string
+		resumed     bool
+	}
+	CaptureTLSHandshakeFailureStub        func(reason string)
+	captureTLSHandshakeFailureMutex       sync.RWMutex
+	captureTLSHandshakeFailureArgsForCall []struct {
+		reason string
+	}
+	CaptureTLSConnectionsStub        func(active int)
+	captureTLSConnectionsMutex       sync.RWMutex
+	captureTLSConnectionsArgsForCall []struct {
+		active int
+	}
 }
 
 func (fake *FakeCombinedReporter) CaptureBadRequest() {
@@ -150,6 +188,30 @@ func (fake *FakeCombinedReporter) CaptureRoutingResponseLatencyArgsForCall(i int
 	return fake.captureRoutingResponseLatencyArgsForCall[i].b, fake.captureRoutingResponseLatencyArgsForCall[i].statusCode, fake.captureRoutingResponseLatencyArgsForCall[i].t, fake.captureRoutingResponseLatencyArgsForCall[i].d
 }
 
+func (fake *FakeCombinedReporter) CaptureRouteResponseLatency(route string, d time.Duration) {
+	fake.captureRouteResponseLatencyMutex.Lock()
+	fake.captureRouteResponseLatencyArgsForCall = append(fake.captureRouteResponseLatencyArgsForCall, struct {
+		route string
+		d     time.Duration
+	}{route, d})
+	fake.captureRouteResponseLatencyMutex.Unlock()
+	if fake.CaptureRouteResponseLatencyStub != nil {
+		fake.CaptureRouteResponseLatencyStub(route, d)
+	}
+}
+
+func (fake *FakeCombinedReporter) CaptureRouteResponseLatencyCallCount() int {
+	fake.captureRouteResponseLatencyMutex.RLock()
+	defer fake.captureRouteResponseLatencyMutex.RUnlock()
+	return len(fake.captureRouteResponseLatencyArgsForCall)
+}
+
+func (fake *FakeCombinedReporter) CaptureRouteResponseLatencyArgsForCall(i int) (string, time.Duration) {
+	fake.captureRouteResponseLatencyMutex.RLock()
+	defer fake.captureRouteResponseLatencyMutex.RUnlock()
+	return fake.captureRouteResponseLatencyArgsForCall[i].route, fake.captureRouteResponseLatencyArgsForCall[i].d
+}
+
 func (fake *FakeCombinedReporter) CaptureRouteServiceResponse(res *http.Response) {
 	fake.captureRouteServiceResponseMutex.Lock()
 	fake.captureRouteServiceResponseArgsForCall = append(fake.captureRouteServiceResponseArgsForCall, struct {
@@ -203,4 +265,144 @@ func (fake *FakeCombinedReporter) CaptureWebSocketFailureCallCount() int {
 	return len(fake.captureWebSocketFailureArgsForCall)
 }
 
+func (fake *FakeCombinedReporter) CaptureWebSocketConnections(active int) {
+	fake.captureWebSocketConnectionsMutex.Lock()
+	fake.captureWebSocketConnectionsArgsForCall = append(fake.captureWebSocketConnectionsArgsForCall, struct {
+		active int
+	}{active})
+	fake.captureWebSocketConnectionsMutex.Unlock()
+	if fake.CaptureWebSocketConnectionsStub != nil {
+		fake.CaptureWebSocketConnectionsStub(active)
+	}
+}
+
+func (fake *FakeCombinedReporter) CaptureWebSocketConnectionsCallCount() int {
+	fake.captureWebSocketConnectionsMutex.RLock()
+	defer fake.captureWebSocketConnectionsMutex.RUnlock()
+	return len(fake.captureWebSocketConnectionsArgsForCall)
+}
+
+func (fake *FakeCombinedReporter) CaptureWebSocketConnectionsArgsForCall(i int) int {
+	fake.captureWebSocketConnectionsMutex.RLock()
+	defer fake.captureWebSocketConnectionsMutex.RUnlock()
+	return fake.captureWebSocketConnectionsArgsForCall[i].active
+}
+
+func (fake *FakeCombinedReporter) CaptureAppRequest(appID string) {
+	fake.captureAppRequestMutex.Lock()
+	fake.captureAppRequestArgsForCall = append(fake.captureAppRequestArgsForCall, struct {
+		appID string
+	}{appID})
+	fake.captureAppRequestMutex.Unlock()
+	if fake.CaptureAppRequestStub != nil {
+		fake.CaptureAppRequestStub(appID)
+	}
+}
+
+func (fake *FakeCombinedReporter) CaptureAppRequestCallCount() int {
+	fake.captureAppRequestMutex.RLock()
+	defer fake.captureAppRequestMutex.RUnlock()
+	return len(fake.captureAppRequestArgsForCall)
+}
+
+func (fake *FakeCombinedReporter) CaptureAppRequestArgsForCall(i int) string {
+	fake.captureAppRequestMutex.RLock()
+	defer fake.captureAppRequestMutex.RUnlock()
+	return fake.captureAppRequestArgsForCall[i].appID
+}
+
+func (fake *FakeCombinedReporter) CaptureAppQuotaExceeded(appID string) {
+	fake.captureAppQuotaExceededMutex.Lock()
+	fake.captureAppQuotaExceededArgsForCall = append(fake.captureAppQuotaExceededArgsForCall, struct {
+		appID string
+	}{appID})
+	fake.captureAppQuotaExceededMutex.Unlock()
+	if fake.CaptureAppQuotaExceededStub != nil {
+		fake.CaptureAppQuotaExceededStub(appID)
+	}
+}
+
+func (fake *FakeCombinedReporter) CaptureAppQuotaExceededCallCount() int {
+	fake.captureAppQuotaExceededMutex.RLock()
+	defer fake.captureAppQuotaExceededMutex.RUnlock()
+	return len(fake.captureAppQuotaExceededArgsForCall)
+}
+
+func (fake *FakeCombinedReporter) CaptureAppQuotaExceededArgsForCall(i int) string {
+	fake.captureAppQuotaExceededMutex.RLock()
+	defer fake.captureAppQuotaExceededMutex.RUnlock()
+	return fake.captureAppQuotaExceededArgsForCall[i].appID
+}
+
+func (fake *FakeCombinedReporter) CaptureTLSHandshake(version string, cipherSuite string, resumed bool) {
+	fake.captureTLSHandshakeMutex.Lock()
+	fake.captureTLSHandshakeArgsForCall = append(fake.captureTLSHandshakeArgsForCall, struct {
+		version     string
+		cipherSuite string
+		resumed     bool
+	}{version, cipherSuite, resumed})
+	fake.captureTLSHandshakeMutex.Unlock()
+	if fake.CaptureTLSHandshakeStub != nil {
+		fake.CaptureTLSHandshakeStub(version, cipherSuite, resumed)
+	}
+}
+
+func (fake *FakeCombinedReporter) CaptureTLSHandshakeCallCount() int {
+	fake.captureTLSHandshakeMutex.RLock()
+	defer fake.captureTLSHandshakeMutex.RUnlock()
+	return len(fake.captureTLSHandshakeArgsForCall)
+}
+
+func (fake *FakeCombinedReporter) CaptureTLSHandshakeArgsForCall(i int) (string, string, bool) {
+	fake.captureTLSHandshakeMutex.RLock()
+	defer fake.captureTLSHandshakeMutex.RUnlock()
+	return fake.captureTLSHandshakeArgsForCall[i].version, fake.captureTLSHandshakeArgsForCall[i].cipherSuite, fake.captureTLSHandshakeArgsForCall[i].resumed
+}
+
+func (fake *FakeCombinedReporter) CaptureTLSHandshakeFailure(reason string) {
+	fake.captureTLSHandshakeFailureMutex.Lock()
+	fake.captureTLSHandshakeFailureArgsForCall = append(fake.captureTLSHandshakeFailureArgsForCall, struct {
+		reason string
+	}{reason})
+	fake.captureTLSHandshakeFailureMutex.Unlock()
+	if fake.CaptureTLSHandshakeFailureStub != nil {
+		fake.CaptureTLSHandshakeFailureStub(reason)
+	}
+}
+
+func (fake *FakeCombinedReporter) CaptureTLSHandshakeFailureCallCount() int {
+	fake.captureTLSHandshakeFailureMutex.RLock()
+	defer fake.captureTLSHandshakeFailureMutex.RUnlock()
+	return len(fake.captureTLSHandshakeFailureArgsForCall)
+}
+
+func (fake *FakeCombinedReporter) CaptureTLSHandshakeFailureArgsForCall(i int) string {
+	fake.captureTLSHandshakeFailureMutex.RLock()
+	defer fake.captureTLSHandshakeFailureMutex.RUnlock()
+	return fake.captureTLSHandshakeFailureArgsForCall[i].reason
+}
+
+func (fake *FakeCombinedReporter) CaptureTLSConnections(active int) {
+	fake.captureTLSConnectionsMutex.Lock()
+	fake.captureTLSConnectionsArgsForCall = append(fake.captureTLSConnectionsArgsForCall, struct {
+		active int
+	}{active})
+	fake.captureTLSConnectionsMutex.Unlock()
+	if fake.CaptureTLSConnectionsStub != nil {
+		fake.CaptureTLSConnectionsStub(active)
+	}
+}
+
+func (fake *FakeCombinedReporter) CaptureTLSConnectionsCallCount() int {
+	fake.captureTLSConnectionsMutex.RLock()
+	defer fake.captureTLSConnectionsMutex.RUnlock()
+	return len(fake.captureTLSConnectionsArgsForCall)
+}
+
+func (fake *FakeCombinedReporter) CaptureTLSConnectionsArgsForCall(i int) int {
+	fake.captureTLSConnectionsMutex.RLock()
+	defer fake.captureTLSConnectionsMutex.RUnlock()
+	return fake.captureTLSConnectionsArgsForCall[i].active
+}
+
 var _ metrics.CombinedReporter = new(FakeCombinedReporter)
@@ -38,12 +38,17 @@ type FakeProxyReporter struct {
 	captureRouteServiceResponseArgsForCall []struct {
 		res *http.Response
 	}
-	CaptureWebSocketUpdateStub         func()
-	captureWebSocketUpdateMutex        sync.RWMutex
-	captureWebSocketUpdateArgsForCall  []struct{}
-	CaptureWebSocketFailureStub        func()
-	captureWebSocketFailureMutex       sync.RWMutex
-	captureWebSocketFailureArgsForCall []struct{}
+	CaptureWebSocketUpdateStub             func()
+	captureWebSocketUpdateMutex            sync.RWMutex
+	captureWebSocketUpdateArgsForCall      []struct{}
+	CaptureWebSocketFailureStub            func()
+	captureWebSocketFailureMutex           sync.RWMutex
+	captureWebSocketFailureArgsForCall     []struct{}
+	CaptureWebSocketConnectionsStub        func(active int)
+	captureWebSocketConnectionsMutex       sync.RWMutex
+	captureWebSocketConnectionsArgsForCall []struct {
+		active int
+	}
 }
 
 func (fake *FakeProxyReporter) CaptureBadRequest() {
@@ -199,4 +204,27 @@ func (fake *FakeProxyReporter) CaptureWebSocketFailureCallCount() int {
 	return len(fake.captureWebSocketFailureArgsForCall)
 }
 
+func (fake *FakeProxyReporter) CaptureWebSocketConnections(active int) {
+	fake.captureWebSocketConnectionsMutex.Lock()
+	fake.captureWebSocketConnectionsArgsForCall = append(fake.captureWebSocketConnectionsArgsForCall, struct {
+		active int
+	}{active})
+	fake.captureWebSocketConnectionsMutex.Unlock()
+	if fake.CaptureWebSocketConnectionsStub != nil {
+		fake.CaptureWebSocketConnectionsStub(active)
+	}
+}
+
+func (fake *FakeProxyReporter) CaptureWebSocketConnectionsCallCount() int {
+	fake.captureWebSocketConnectionsMutex.RLock()
+	defer fake.captureWebSocketConnectionsMutex.RUnlock()
+	return len(fake.captureWebSocketConnectionsArgsForCall)
+}
+
+func (fake *FakeProxyReporter) CaptureWebSocketConnectionsArgsForCall(i int) int {
+	fake.captureWebSocketConnectionsMutex.RLock()
+	defer fake.captureWebSocketConnectionsMutex.RUnlock()
+	return fake.captureWebSocketConnectionsArgsForCall[i].active
+}
+
 var _ metrics.ProxyReporter = new(FakeProxyReporter)
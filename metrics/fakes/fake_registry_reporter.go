@@ -30,6 +30,11 @@ type FakeRouteRegistryReporter struct {
 	captureUnregistryMessageArgsForCall []struct {
 		msg metrics.ComponentTagged
 	}
+	CaptureRejectedRegistryMessageStub        func(reason string)
+	captureRejectedRegistryMessageMutex       sync.RWMutex
+	captureRejectedRegistryMessageArgsForCall []struct {
+		reason string
+	}
 }
 
 func (fake *FakeRouteRegistryReporter) CaptureRouteStats(totalRoutes int, msSinceLastUpdate uint64) {
@@ -125,4 +130,27 @@ func (fake *FakeRouteRegistryReporter) CaptureUnregistryMessageArgsForCall(i int
 	return fake.captureUnregistryMessageArgsForCall[i].msg
 }
 
+func (fake *FakeRouteRegistryReporter) CaptureRejectedRegistryMessage(reason string) {
+	fake.captureRejectedRegistryMessageMutex.Lock()
+	fake.captureRejectedRegistryMessageArgsForCall = append(fake.captureRejectedRegistryMessageArgsForCall, struct {
+		reason string
+	}{reason})
+	fake.captureRejectedRegistryMessageMutex.Unlock()
+	if fake.CaptureRejectedRegistryMessageStub != nil {
+		fake.CaptureRejectedRegistryMessageStub(reason)
+	}
+}
+
+func (fake *FakeRouteRegistryReporter) CaptureRejectedRegistryMessageCallCount() int {
+	fake.captureRejectedRegistryMessageMutex.RLock()
+	defer fake.captureRejectedRegistryMessageMutex.RUnlock()
+	return len(fake.captureRejectedRegistryMessageArgsForCall)
+}
+
+func (fake *FakeRouteRegistryReporter) CaptureRejectedRegistryMessageArgsForCall(i int) string {
+	fake.captureRejectedRegistryMessageMutex.RLock()
+	defer fake.captureRejectedRegistryMessageMutex.RUnlock()
+	return fake.captureRejectedRegistryMessageArgsForCall[i].reason
+}
+
 var _ metrics.RouteRegistryReporter = new(FakeRouteRegistryReporter)
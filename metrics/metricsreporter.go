@@ -97,6 +97,13 @@ func (m *MetricsReporter) CaptureUnregistryMessage(msg ComponentTagged) {
 	m.sender.IncrementCounter(componentName)
 }
 
+// CaptureRejectedRegistryMessage counts the registration messages rejected
+// in total and by reason.
+func (m *MetricsReporter) CaptureRejectedRegistryMessage(reason string) {
+	m.batcher.BatchIncrementCounter("rejected_registry_messages")
+	m.batcher.BatchIncrementCounter("rejected_registry_messages." + reason)
+}
+
 func (m *MetricsReporter) CaptureWebSocketUpdate() {
 	m.batcher.BatchIncrementCounter("websocket_upgrades")
 }
@@ -105,6 +112,32 @@ func (m *MetricsReporter) CaptureWebSocketFailure() {
 	m.batcher.BatchIncrementCounter("websocket_failures")
 }
 
+func (m *MetricsReporter) CaptureWebSocketConnections(active int) {
+	m.sender.SendValue("websocket_connections", float64(active), "")
+}
+
+// CaptureTLSHandshake counts the handshakes of the TLS listener in total, by
+// version and cipher suite, and those that resumed a session.
+func (m *MetricsReporter) CaptureTLSHandshake(version, cipherSuite string, resumed bool) {
+	m.batcher.BatchIncrementCounter("tls_handshakes")
+	m.batcher.BatchIncrementCounter("tls_handshakes.version." + version)
+	m.batcher.BatchIncrementCounter("tls_handshakes.cipher_suite." + cipherSuite)
+	if resumed {
+		m.batcher.BatchIncrementCounter("tls_handshakes.resumed")
+	}
+}
+
+// CaptureTLSHandshakeFailure counts the failed handshakes of the TLS listener
+// in total and by reason.
+func (m *MetricsReporter) CaptureTLSHandshakeFailure(reason string) {
+	m.batcher.BatchIncrementCounter("tls_handshake_failures")
+	m.batcher.BatchIncrementCounter("tls_handshake_failures." + reason)
+}
+
+func (m *MetricsReporter) CaptureTLSConnections(active int) {
+	m.sender.SendValue("tls_connections", float64(active), "")
+}
+
 func getResponseCounterName(statusCode int) string {
 	statusCode = statusCode / 100
 	if statusCode >= 2 && statusCode <= 5 {
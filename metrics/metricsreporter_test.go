@@ -329,6 +329,14 @@ var _ = Describe("MetricsReporter", func() {
 			Expect(batcher.BatchIncrementCounterArgsForCall(1)).To(Equal("registry_message.route-emitter"))
 		})
 
+		It("sends the number of rejected registration messages in total and by reason", func() {
+			metricReporter.CaptureRejectedRegistryMessage("missing_field")
+
+			Expect(batcher.BatchIncrementCounterCallCount()).To(Equal(2))
+			Expect(batcher.BatchIncrementCounterArgsForCall(0)).To(Equal("rejected_registry_messages"))
+			Expect(batcher.BatchIncrementCounterArgsForCall(1)).To(Equal("rejected_registry_messages.missing_field"))
+		})
+
 		It("sends the total routes", func() {
 			metricReporter.CaptureRouteStats(12, 5)
 
@@ -408,6 +416,38 @@ var _ = Describe("MetricsReporter", func() {
 			Expect(batcher.BatchIncrementCounterCallCount()).To(Equal(1))
 			Expect(batcher.BatchIncrementCounterArgsForCall(0)).To(Equal("websocket_failures"))
 		})
+		It("sends the number of active websocket connections", func() {
+			metricReporter.CaptureWebSocketConnections(3)
+			Expect(sender.SendValueCallCount()).To(Equal(1))
+			name, value, unit := sender.SendValueArgsForCall(0)
+			Expect(name).To(Equal("websocket_connections"))
+			Expect(value).To(BeEquivalentTo(3))
+			Expect(unit).To(Equal(""))
+		})
+	})
+
+	Context("TLS metrics", func() {
+		It("increments the handshake metrics by version and cipher suite", func() {
+			metricReporter.CaptureTLSHandshake("TLSv1.3", "TLS_AES_128_GCM_SHA256", true)
+			Expect(batcher.BatchIncrementCounterCallCount()).To(Equal(4))
+			Expect(batcher.BatchIncrementCounterArgsForCall(0)).To(Equal("tls_handshakes"))
+			Expect(batcher.BatchIncrementCounterArgsForCall(1)).To(Equal("tls_handshakes.version.TLSv1.3"))
+			Expect(batcher.BatchIncrementCounterArgsForCall(2)).To(Equal("tls_handshakes.cipher_suite.TLS_AES_128_GCM_SHA256"))
+			Expect(batcher.BatchIncrementCounterArgsForCall(3)).To(Equal("tls_handshakes.resumed"))
+		})
+		It("increments the handshake failures metric by reason", func() {
+			metricReporter.CaptureTLSHandshakeFailure("timeout")
+			Expect(batcher.BatchIncrementCounterCallCount()).To(Equal(2))
+			Expect(batcher.BatchIncrementCounterArgsForCall(0)).To(Equal("tls_handshake_failures"))
+			Expect(batcher.BatchIncrementCounterArgsForCall(1)).To(Equal("tls_handshake_failures.timeout"))
+		})
+		It("sends the number of active TLS connections", func() {
+			metricReporter.CaptureTLSConnections(5)
+			Expect(sender.SendValueCallCount()).To(Equal(1))
+			name, value, _ := sender.SendValueArgsForCall(0)
+			Expect(name).To(Equal("tls_connections"))
+			Expect(value).To(BeEquivalentTo(5))
+		})
 	})
 
 })
@@ -0,0 +1,55 @@
+package monitor
+
+import (
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/logger"
+	router_metrics "code.cloudfoundry.org/gorouter/metrics"
+	"github.com/cloudfoundry/dropsonde/metrics"
+	"github.com/uber-go/zap"
+)
+
+// RouteLatency emits the latency percentiles of each route on every tick, as
+// the route_latency.p50, route_latency.p95 and route_latency.p99 values in
+// milliseconds tagged with the route.
+type RouteLatency struct {
+	latencies *router_metrics.RouteLatencies
+	tickChan  <-chan time.Time
+	sender    metrics.MetricSender
+	logger    logger.Logger
+}
+
+func NewRouteLatency(latencies *router_metrics.RouteLatencies, ticker <-chan time.Time, sender metrics.MetricSender, logger logger.Logger) *RouteLatency {
+	return &RouteLatency{
+		latencies: latencies,
+		tickChan:  ticker,
+		sender:    sender,
+		logger:    logger,
+	}
+}
+
+func (r *RouteLatency) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	close(ready)
+	for {
+		select {
+		case <-r.tickChan:
+			for route, l := range r.latencies.Snapshot() {
+				r.send("route_latency.p50", route, l.P50)
+				r.send("route_latency.p95", route, l.P95)
+				r.send("route_latency.p99", route, l.P99)
+			}
+		case <-signals:
+			r.logger.Info("exited")
+			return nil
+		}
+	}
+}
+
+func (r *RouteLatency) send(name, route string, d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+	err := r.sender.Value(name, ms, "ms").SetTag("route", route).Send()
+	if err != nil {
+		r.logger.Error("error-sending-route-latency", zap.Error(err), zap.String("route", route))
+	}
+}
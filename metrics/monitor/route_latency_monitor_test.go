@@ -0,0 +1,75 @@
+package monitor_test
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/metrics"
+	"code.cloudfoundry.org/gorouter/metrics/fakes"
+	"code.cloudfoundry.org/gorouter/metrics/monitor"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"github.com/cloudfoundry/dropsonde/metric_sender"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+// valueChainer sends the name, value and route tag of a value to a channel.
+type valueChainer struct {
+	sent  chan<- string
+	name  string
+	value float64
+	route string
+}
+
+func (v *valueChainer) SetTag(key, value string) metric_sender.ValueChainer {
+	if key == "route" {
+		v.route = value
+	}
+	return v
+}
+
+func (v *valueChainer) Send() error {
+	v.sent <- fmt.Sprintf("%s %s %g", v.name, v.route, v.value)
+	return nil
+}
+
+var _ = Describe("RouteLatency", func() {
+	var (
+		sender    *fakes.MetricSender
+		ch        chan time.Time
+		sent      chan string
+		latencies *metrics.RouteLatencies
+		process   ifrit.Process
+	)
+
+	BeforeEach(func() {
+		sender = new(fakes.MetricSender)
+		sent = make(chan string, 10)
+		sender.ValueStub = func(name string, value float64, unit string) metric_sender.ValueChainer {
+			Expect(unit).To(Equal("ms"))
+			return &valueChainer{sent: sent, name: name, value: value}
+		}
+		ch = make(chan time.Time)
+		latencies = metrics.NewRouteLatencies(10)
+
+		process = ifrit.Invoke(monitor.NewRouteLatency(latencies, ch, sender, test_util.NewTestZapLogger("test")))
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+	})
+
+	It("emits the latency percentiles of each route on every tick", func() {
+		latencies.CaptureRouteResponseLatency("example.com", 20*time.Millisecond)
+		Consistently(sent).ShouldNot(Receive())
+
+		ch <- time.Time{}
+		Eventually(sent).Should(Receive(Equal("route_latency.p50 example.com 20")))
+		Eventually(sent).Should(Receive(Equal("route_latency.p95 example.com 20")))
+		Eventually(sent).Should(Receive(Equal("route_latency.p99 example.com 20")))
+	})
+})
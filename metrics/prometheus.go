@@ -0,0 +1,452 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/route"
+)
+
+// OtherRoutes is the route label of the latencies of routes beyond the
+// maximum number of routes whose latencies are tracked.
+const OtherRoutes = "other"
+
+// LatencyBuckets are the upper bounds in seconds of the buckets of the
+// request latency histograms.
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// RouteReporter is implemented by reporters that track the latency of each
+// route rather than of each endpoint.
+type RouteReporter interface {
+	CaptureRouteResponseLatency(route string, d time.Duration)
+}
+
+// AppReporter is implemented by reporters that count the requests to each
+// application and the requests rejected by its quota.
+type AppReporter interface {
+	CaptureAppRequest(appID string)
+	CaptureAppQuotaExceeded(appID string)
+}
+
+// TLSReporter is implemented by reporters that track the handshakes and
+// connections of the TLS listener. Versions are named like TLSv1.3, and
+// cipher suites by their IANA names.
+type TLSReporter interface {
+	CaptureTLSHandshake(version, cipherSuite string, resumed bool)
+	CaptureTLSHandshakeFailure(reason string)
+	CaptureTLSConnections(active int)
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(v float64) {
+	for i, b := range LatencyBuckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+type gauge struct {
+	name  string
+	help  string
+	value func() float64
+}
+
+type labeledCounter struct {
+	name   string
+	help   string
+	label  string
+	values func() map[string]uint64
+}
+
+// PrometheusReporter keeps the proxy metrics in memory and serves them, with
+// gauges and counters added by AddGauge and AddLabeledCounter and Go runtime
+// stats, in the Prometheus text format.
+type PrometheusReporter struct {
+	lock sync.Mutex
+
+	maxRoutes int
+	routeTags []string
+
+	badRequests          uint64
+	badGateways          uint64
+	requests             uint64
+	responses            map[string]uint64
+	routeServiceResponse map[string]uint64
+	webSocketUpgrades    uint64
+	webSocketFailures    uint64
+	webSocketConnections int
+	rejectedMessages     map[string]uint64
+	appRequests          map[string]uint64
+	appQuotaRejections   map[string]uint64
+	tlsVersions          map[string]uint64
+	tlsCipherSuites      map[string]uint64
+	tlsResumed           uint64
+	tlsFailures          map[string]uint64
+	tlsConnections       int
+	latencies            map[string]*histogram
+	taggedRequests       map[string]uint64
+	taggedLatencies      map[string]*histogram
+	gauges               []gauge
+	labeledCounters      []labeledCounter
+}
+
+// NewPrometheusReporter creates a reporter that tracks the latencies of up to
+// maxRoutes routes, and of all other routes together. When routeTags are
+// given, requests and their latencies are also tracked labeled with these
+// tags of the route registrations, for up to maxRoutes combinations of
+// values.
+func NewPrometheusReporter(maxRoutes int, routeTags []string) *PrometheusReporter {
+	return &PrometheusReporter{
+		maxRoutes:            maxRoutes,
+		routeTags:            routeTags,
+		responses:            make(map[string]uint64),
+		routeServiceResponse: make(map[string]uint64),
+		rejectedMessages:     make(map[string]uint64),
+		appRequests:          make(map[string]uint64),
+		appQuotaRejections:   make(map[string]uint64),
+		tlsVersions:          make(map[string]uint64),
+		tlsCipherSuites:      make(map[string]uint64),
+		tlsFailures:          make(map[string]uint64),
+		latencies:            make(map[string]*histogram),
+		taggedRequests:       make(map[string]uint64),
+		taggedLatencies:      make(map[string]*histogram),
+	}
+}
+
+// AddGauge adds a gauge whose value is read from f on every scrape.
+func (p *PrometheusReporter) AddGauge(name, help string, f func() float64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.gauges = append(p.gauges, gauge{name: name, help: help, value: f})
+}
+
+// AddLabeledCounter adds counters labeled with label, whose values by label
+// value are read from f on every scrape.
+func (p *PrometheusReporter) AddLabeledCounter(name, help, label string, f func() map[string]uint64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.labeledCounters = append(p.labeledCounters, labeledCounter{name: name, help: help, label: label, values: f})
+}
+
+func (p *PrometheusReporter) CaptureBadRequest() {
+	p.lock.Lock()
+	p.badRequests++
+	p.lock.Unlock()
+}
+
+func (p *PrometheusReporter) CaptureBadGateway() {
+	p.lock.Lock()
+	p.badGateways++
+	p.lock.Unlock()
+}
+
+func (p *PrometheusReporter) CaptureRoutingRequest(b *route.Endpoint) {
+	p.lock.Lock()
+	p.requests++
+	if len(p.routeTags) > 0 {
+		p.taggedRequests[p.tagLabels(b)]++
+	}
+	p.lock.Unlock()
+}
+
+func (p *PrometheusReporter) CaptureRoutingResponse(statusCode int) {
+	p.lock.Lock()
+	p.responses[getResponseCounterName(statusCode)]++
+	p.lock.Unlock()
+}
+
+// CaptureRoutingResponseLatency tracks the latency by the route tags, if any.
+// Latencies are tracked per route by CaptureRouteResponseLatency.
+func (p *PrometheusReporter) CaptureRoutingResponseLatency(b *route.Endpoint, d time.Duration) {
+	if len(p.routeTags) == 0 {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	labels := p.tagLabels(b)
+	h, ok := p.taggedLatencies[labels]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(LatencyBuckets))}
+		p.taggedLatencies[labels] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// tagLabels returns the labels of the route tags of the endpoint. Once the
+// maximum number of combinations is tracked, the tags of new combinations
+// are all OtherRoutes. p.lock must be held.
+func (p *PrometheusReporter) tagLabels(b *route.Endpoint) string {
+	labels := formatTagLabels(p.routeTags, func(tag string) string { return b.Tags[tag] })
+	if _, ok := p.taggedRequests[labels]; !ok && len(p.taggedRequests) >= p.maxRoutes {
+		return formatTagLabels(p.routeTags, func(string) string { return OtherRoutes })
+	}
+	return labels
+}
+
+func formatTagLabels(tags []string, value func(tag string) string) string {
+	labels := make([]string, len(tags))
+	for i, tag := range tags {
+		labels[i] = tag + `="` + escapeLabel(value(tag)) + `"`
+	}
+	return strings.Join(labels, ",")
+}
+
+func (p *PrometheusReporter) CaptureRouteResponseLatency(route string, d time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	h, ok := p.latencies[route]
+	if !ok {
+		if len(p.latencies) >= p.maxRoutes {
+			route = OtherRoutes
+			h = p.latencies[route]
+		}
+		if h == nil {
+			h = &histogram{counts: make([]uint64, len(LatencyBuckets))}
+			p.latencies[route] = h
+		}
+	}
+	h.observe(d.Seconds())
+}
+
+func (p *PrometheusReporter) CaptureRouteServiceResponse(res *http.Response) {
+	var statusCode int
+	if res != nil {
+		statusCode = res.StatusCode
+	}
+	p.lock.Lock()
+	p.routeServiceResponse[getResponseCounterName(statusCode)]++
+	p.lock.Unlock()
+}
+
+func (p *PrometheusReporter) CaptureWebSocketUpdate() {
+	p.lock.Lock()
+	p.webSocketUpgrades++
+	p.lock.Unlock()
+}
+
+func (p *PrometheusReporter) CaptureWebSocketFailure() {
+	p.lock.Lock()
+	p.webSocketFailures++
+	p.lock.Unlock()
+}
+
+func (p *PrometheusReporter) CaptureWebSocketConnections(active int) {
+	p.lock.Lock()
+	p.webSocketConnections = active
+	p.lock.Unlock()
+}
+
+// CaptureAppRequest counts the request to the application. Applications
+// beyond the maximum number of routes are counted together as OtherRoutes.
+func (p *PrometheusReporter) CaptureAppRequest(appID string) {
+	p.lock.Lock()
+	p.appRequests[p.appLabel(appID)]++
+	p.lock.Unlock()
+}
+
+func (p *PrometheusReporter) CaptureAppQuotaExceeded(appID string) {
+	p.lock.Lock()
+	p.appQuotaRejections[p.appLabel(appID)]++
+	p.lock.Unlock()
+}
+
+// appLabel returns the label of the application, which is OtherRoutes once
+// the maximum number of applications is counted. p.lock must be held.
+func (p *PrometheusReporter) appLabel(appID string) string {
+	if _, ok := p.appRequests[appID]; !ok && len(p.appRequests) >= p.maxRoutes {
+		return OtherRoutes
+	}
+	return appID
+}
+
+func (p *PrometheusReporter) CaptureTLSHandshake(version, cipherSuite string, resumed bool) {
+	p.lock.Lock()
+	p.tlsVersions[version]++
+	p.tlsCipherSuites[cipherSuite]++
+	if resumed {
+		p.tlsResumed++
+	}
+	p.lock.Unlock()
+}
+
+func (p *PrometheusReporter) CaptureTLSHandshakeFailure(reason string) {
+	p.lock.Lock()
+	p.tlsFailures[reason]++
+	p.lock.Unlock()
+}
+
+func (p *PrometheusReporter) CaptureTLSConnections(active int) {
+	p.lock.Lock()
+	p.tlsConnections = active
+	p.lock.Unlock()
+}
+
+// CaptureRouteStats is a no-op, as the routes are reported by gauges.
+func (p *PrometheusReporter) CaptureRouteStats(totalRoutes int, msSinceLastUpdate uint64) {}
+
+// CaptureLookupTime is a no-op.
+func (p *PrometheusReporter) CaptureLookupTime(t time.Duration) {}
+
+// CaptureRegistryMessage is a no-op.
+func (p *PrometheusReporter) CaptureRegistryMessage(msg ComponentTagged) {}
+
+// CaptureUnregistryMessage is a no-op.
+func (p *PrometheusReporter) CaptureUnregistryMessage(msg ComponentTagged) {}
+
+func (p *PrometheusReporter) CaptureRejectedRegistryMessage(reason string) {
+	p.lock.Lock()
+	p.rejectedMessages[reason]++
+	p.lock.Unlock()
+}
+
+func (p *PrometheusReporter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(http.StatusOK)
+	p.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (p *PrometheusReporter) WriteTo(w io.Writer) (int64, error) {
+	e := &exposition{}
+
+	p.lock.Lock()
+	e.counter("gorouter_requests_total", "Requests routed to endpoints.", p.requests)
+	e.counter("gorouter_bad_requests_total", "Requests rejected before they were routed.", p.badRequests)
+	e.counter("gorouter_bad_gateways_total", "Requests that could not be proxied to an endpoint.", p.badGateways)
+	e.labeledCounter("gorouter_responses_total", "Responses of endpoints by status class.", "status", p.responses)
+	e.labeledCounter("gorouter_route_service_responses_total", "Responses of route services by status class.", "status", p.routeServiceResponse)
+	e.counter("gorouter_websocket_upgrades_total", "WebSocket upgrades.", p.webSocketUpgrades)
+	e.counter("gorouter_websocket_failures_total", "WebSocket upgrades that failed.", p.webSocketFailures)
+	e.gauge("gorouter_websocket_connections", "Open WebSocket connections.", float64(p.webSocketConnections))
+	e.labeledCounter("gorouter_app_requests_total", "Requests by application.", "app_id", p.appRequests)
+	e.labeledCounter("gorouter_app_quota_rejections_total", "Requests rejected by the quota of their application.", "app_id", p.appQuotaRejections)
+	e.labeledCounter("gorouter_rejected_registry_messages_total", "Route registration messages rejected by reason.", "reason", p.rejectedMessages)
+	e.labeledCounter("gorouter_tls_handshakes_total", "Completed TLS handshakes by negotiated version.", "version", p.tlsVersions)
+	e.labeledCounter("gorouter_tls_handshake_cipher_suites_total", "Completed TLS handshakes by negotiated cipher suite.", "cipher_suite", p.tlsCipherSuites)
+	e.counter("gorouter_tls_resumed_handshakes_total", "TLS handshakes that resumed a session.", p.tlsResumed)
+	e.labeledCounter("gorouter_tls_handshake_failures_total", "Failed TLS handshakes by reason.", "reason", p.tlsFailures)
+	e.gauge("gorouter_tls_connections", "Open connections of the TLS listener.", float64(p.tlsConnections))
+	e.histograms("gorouter_request_duration_seconds", "Latency of requests by route.", "route", p.latencies)
+	if len(p.routeTags) > 0 {
+		e.taggedCounter("gorouter_tagged_requests_total", "Requests routed to endpoints by route tags.", p.taggedRequests)
+		e.taggedHistograms("gorouter_tagged_request_duration_seconds", "Latency of requests by route tags.", p.taggedLatencies)
+	}
+	gauges := p.gauges
+	labeledCounters := p.labeledCounters
+	p.lock.Unlock()
+
+	for _, g := range gauges {
+		e.gauge(g.name, g.help, g.value())
+	}
+	for _, c := range labeledCounters {
+		e.labeledCounter(c.name, c.help, c.label, c.values())
+	}
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	e.gauge("go_goroutines", "Goroutines that currently exist.", float64(runtime.NumGoroutine()))
+	e.gauge("go_memstats_alloc_bytes", "Bytes allocated and still in use.", float64(m.Alloc))
+	e.gauge("go_memstats_heap_inuse_bytes", "Bytes in in-use heap spans.", float64(m.HeapInuse))
+	e.gauge("go_memstats_sys_bytes", "Bytes obtained from the system.", float64(m.Sys))
+	e.counter("go_gc_cycles_total", "Completed garbage collection cycles.", uint64(m.NumGC))
+	e.gauge("go_gc_pause_seconds_total", "Time spent in garbage collection pauses.", float64(m.PauseTotalNs)/float64(time.Second))
+
+	n, err := io.WriteString(w, e.String())
+	return int64(n), err
+}
+
+type exposition struct {
+	strings.Builder
+}
+
+func (e *exposition) header(name, help, kind string) {
+	fmt.Fprintf(e, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (e *exposition) counter(name, help string, v uint64) {
+	e.header(name, help, "counter")
+	fmt.Fprintf(e, "%s %d\n", name, v)
+}
+
+func (e *exposition) gauge(name, help string, v float64) {
+	e.header(name, help, "gauge")
+	fmt.Fprintf(e, "%s %s\n", name, formatFloat(v))
+}
+
+func (e *exposition) labeledCounter(name, help, label string, values map[string]uint64) {
+	e.header(name, help, "counter")
+	for _, k := range sortedKeys(values) {
+		fmt.Fprintf(e, "%s{%s=\"%s\"} %d\n", name, label, escapeLabel(k), values[k])
+	}
+}
+
+func (e *exposition) histograms(name, help, label string, values map[string]*histogram) {
+	labeled := make(map[string]*histogram, len(values))
+	for k, h := range values {
+		labeled[label+`="`+escapeLabel(k)+`"`] = h
+	}
+	e.taggedHistograms(name, help, labeled)
+}
+
+// taggedCounter writes counters whose keys are formatted labels.
+func (e *exposition) taggedCounter(name, help string, values map[string]uint64) {
+	e.header(name, help, "counter")
+	for _, k := range sortedKeys(values) {
+		fmt.Fprintf(e, "%s{%s} %d\n", name, k, values[k])
+	}
+}
+
+// taggedHistograms writes histograms whose keys are formatted labels.
+func (e *exposition) taggedHistograms(name, help string, values map[string]*histogram) {
+	e.header(name, help, "histogram")
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, l := range keys {
+		h := values[l]
+		for i, b := range LatencyBuckets {
+			fmt.Fprintf(e, "%s_bucket{%s,le=\"%s\"} %d\n", name, l, formatFloat(b), h.counts[i])
+		}
+		fmt.Fprintf(e, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, l, h.count)
+		fmt.Fprintf(e, "%s_sum{%s} %s\n", name, l, formatFloat(h.sum))
+		fmt.Fprintf(e, "%s_count{%s} %d\n", name, l, h.count)
+	}
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
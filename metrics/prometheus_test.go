@@ -0,0 +1,205 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/metrics"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/routing-api/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func prometheusText(p *metrics.PrometheusReporter) string {
+	b := new(bytes.Buffer)
+	_, err := p.WriteTo(b)
+	Expect(err).ToNot(HaveOccurred())
+	return b.String()
+}
+
+var _ = Describe("PrometheusReporter", func() {
+	var (
+		reporter *metrics.PrometheusReporter
+		endpoint *route.Endpoint
+	)
+
+	BeforeEach(func() {
+		reporter = metrics.NewPrometheusReporter(2, nil)
+		endpoint = route.NewEndpoint("someId", "host", 2222, "privateId", "2", map[string]string{}, 30, "", models.ModificationTag{}, "")
+	})
+
+	It("counts requests and responses", func() {
+		reporter.CaptureRoutingRequest(endpoint)
+		reporter.CaptureRoutingRequest(endpoint)
+		reporter.CaptureRoutingResponse(http.StatusOK)
+		reporter.CaptureRoutingResponse(http.StatusBadGateway)
+		reporter.CaptureBadRequest()
+		reporter.CaptureRouteServiceResponse(nil)
+
+		text := prometheusText(reporter)
+		Expect(text).To(ContainSubstring("# TYPE gorouter_requests_total counter\ngorouter_requests_total 2\n"))
+		Expect(text).To(ContainSubstring(`gorouter_responses_total{status="2xx"} 1`))
+		Expect(text).To(ContainSubstring(`gorouter_responses_total{status="5xx"} 1`))
+		Expect(text).To(ContainSubstring("gorouter_bad_requests_total 1\n"))
+		Expect(text).To(ContainSubstring(`gorouter_route_service_responses_total{status="xxx"} 1`))
+	})
+
+	It("tracks WebSocket connections", func() {
+		reporter.CaptureWebSocketUpdate()
+		reporter.CaptureWebSocketFailure()
+		reporter.CaptureWebSocketConnections(3)
+
+		text := prometheusText(reporter)
+		Expect(text).To(ContainSubstring("gorouter_websocket_upgrades_total 1\n"))
+		Expect(text).To(ContainSubstring("gorouter_websocket_failures_total 1\n"))
+		Expect(text).To(ContainSubstring("gorouter_websocket_connections 3\n"))
+	})
+
+	It("counts TLS handshakes and tracks TLS connections", func() {
+		reporter.CaptureTLSHandshake("TLSv1.3", "TLS_AES_128_GCM_SHA256", false)
+		reporter.CaptureTLSHandshake("TLSv1.3", "TLS_AES_128_GCM_SHA256", true)
+		reporter.CaptureTLSHandshakeFailure("unsupported_version")
+		reporter.CaptureTLSConnections(2)
+
+		text := prometheusText(reporter)
+		Expect(text).To(ContainSubstring(`gorouter_tls_handshakes_total{version="TLSv1.3"} 2` + "\n"))
+		Expect(text).To(ContainSubstring(`gorouter_tls_handshake_cipher_suites_total{cipher_suite="TLS_AES_128_GCM_SHA256"} 2` + "\n"))
+		Expect(text).To(ContainSubstring("gorouter_tls_resumed_handshakes_total 1\n"))
+		Expect(text).To(ContainSubstring(`gorouter_tls_handshake_failures_total{reason="unsupported_version"} 1` + "\n"))
+		Expect(text).To(ContainSubstring("gorouter_tls_connections 2\n"))
+	})
+
+	Context("with route tags", func() {
+		endpointWithTags := func(tags map[string]string) *route.Endpoint {
+			return route.NewEndpoint("someId", "host", 2222, "privateId", "2", tags, 30, "", models.ModificationTag{}, "")
+		}
+
+		BeforeEach(func() {
+			reporter = metrics.NewPrometheusReporter(2, []string{"team", "environment"})
+		})
+
+		It("counts requests and tracks their latencies by the route tags", func() {
+			payments := endpointWithTags(map[string]string{"team": "payments", "environment": "prod"})
+			reporter.CaptureRoutingRequest(payments)
+			reporter.CaptureRoutingRequest(payments)
+			reporter.CaptureRoutingRequest(endpointWithTags(map[string]string{"team": "search"}))
+			reporter.CaptureRoutingResponseLatency(payments, 30*time.Millisecond)
+
+			text := prometheusText(reporter)
+			Expect(text).To(ContainSubstring(`gorouter_tagged_requests_total{team="payments",environment="prod"} 2` + "\n"))
+			Expect(text).To(ContainSubstring(`gorouter_tagged_requests_total{team="search",environment=""} 1` + "\n"))
+			Expect(text).To(ContainSubstring(`gorouter_tagged_request_duration_seconds_bucket{team="payments",environment="prod",le="0.05"} 1` + "\n"))
+			Expect(text).To(ContainSubstring(`gorouter_tagged_request_duration_seconds_count{team="payments",environment="prod"} 1` + "\n"))
+		})
+
+		It("counts the requests beyond the maximum number of tag values together", func() {
+			reporter.CaptureRoutingRequest(endpointWithTags(map[string]string{"team": "a"}))
+			reporter.CaptureRoutingRequest(endpointWithTags(map[string]string{"team": "b"}))
+			reporter.CaptureRoutingRequest(endpointWithTags(map[string]string{"team": "c"}))
+
+			text := prometheusText(reporter)
+			Expect(text).To(ContainSubstring(`gorouter_tagged_requests_total{team="other",environment="other"} 1` + "\n"))
+			Expect(text).ToNot(ContainSubstring(`team="c"`))
+		})
+
+		It("does not expose the tagged metrics without route tags", func() {
+			reporter = metrics.NewPrometheusReporter(2, nil)
+			reporter.CaptureRoutingRequest(endpoint)
+
+			Expect(prometheusText(reporter)).ToNot(ContainSubstring("gorouter_tagged_requests_total"))
+		})
+	})
+
+	It("counts rejected registration messages by reason", func() {
+		reporter.CaptureRejectedRegistryMessage("malformed")
+		reporter.CaptureRejectedRegistryMessage("malformed")
+		reporter.CaptureRejectedRegistryMessage("unknown_field")
+
+		text := prometheusText(reporter)
+		Expect(text).To(ContainSubstring(`gorouter_rejected_registry_messages_total{reason="malformed"} 2` + "\n"))
+		Expect(text).To(ContainSubstring(`gorouter_rejected_registry_messages_total{reason="unknown_field"} 1` + "\n"))
+	})
+
+	It("counts requests and quota rejections per application", func() {
+		reporter.CaptureAppRequest("app-a")
+		reporter.CaptureAppRequest("app-a")
+		reporter.CaptureAppQuotaExceeded("app-a")
+		reporter.CaptureAppRequest("app-b")
+		reporter.CaptureAppRequest("app-c")
+
+		text := prometheusText(reporter)
+		Expect(text).To(ContainSubstring(`gorouter_app_requests_total{app_id="app-a"} 2` + "\n"))
+		Expect(text).To(ContainSubstring(`gorouter_app_requests_total{app_id="app-b"} 1` + "\n"))
+		Expect(text).To(ContainSubstring(`gorouter_app_requests_total{app_id="other"} 1` + "\n"))
+		Expect(text).To(ContainSubstring(`gorouter_app_quota_rejections_total{app_id="app-a"} 1` + "\n"))
+	})
+
+	It("keeps a latency histogram per route", func() {
+		reporter.CaptureRouteResponseLatency("example.com", 20*time.Millisecond)
+		reporter.CaptureRouteResponseLatency("example.com", 3*time.Second)
+
+		text := prometheusText(reporter)
+		Expect(text).To(ContainSubstring("# TYPE gorouter_request_duration_seconds histogram\n"))
+		Expect(text).To(ContainSubstring(`gorouter_request_duration_seconds_bucket{route="example.com",le="0.01"} 0`))
+		Expect(text).To(ContainSubstring(`gorouter_request_duration_seconds_bucket{route="example.com",le="0.025"} 1`))
+		Expect(text).To(ContainSubstring(`gorouter_request_duration_seconds_bucket{route="example.com",le="5"} 2`))
+		Expect(text).To(ContainSubstring(`gorouter_request_duration_seconds_bucket{route="example.com",le="+Inf"} 2`))
+		Expect(text).To(ContainSubstring(`gorouter_request_duration_seconds_sum{route="example.com"} 3.02`))
+		Expect(text).To(ContainSubstring(`gorouter_request_duration_seconds_count{route="example.com"} 2`))
+	})
+
+	It("tracks routes beyond the maximum together", func() {
+		reporter.CaptureRouteResponseLatency("a.example.com", time.Millisecond)
+		reporter.CaptureRouteResponseLatency("b.example.com", time.Millisecond)
+		reporter.CaptureRouteResponseLatency("c.example.com", time.Millisecond)
+		reporter.CaptureRouteResponseLatency("d.example.com", time.Millisecond)
+		reporter.CaptureRouteResponseLatency("a.example.com", time.Millisecond)
+
+		text := prometheusText(reporter)
+		Expect(text).To(ContainSubstring(`gorouter_request_duration_seconds_count{route="a.example.com"} 2`))
+		Expect(text).To(ContainSubstring(`gorouter_request_duration_seconds_count{route="b.example.com"} 1`))
+		Expect(text).To(ContainSubstring(`gorouter_request_duration_seconds_count{route="other"} 2`))
+		Expect(text).ToNot(ContainSubstring("c.example.com"))
+	})
+
+	It("escapes route labels", func() {
+		reporter.CaptureRouteResponseLatency(`example.com/"quoted"`, time.Millisecond)
+
+		Expect(prometheusText(reporter)).To(ContainSubstring(`{route="example.com/\"quoted\""}`))
+	})
+
+	It("reports added gauges and runtime stats", func() {
+		reporter.AddGauge("gorouter_nats_connected", "Whether NATS is connected.", func() float64 { return 1 })
+
+		text := prometheusText(reporter)
+		Expect(text).To(ContainSubstring("# HELP gorouter_nats_connected Whether NATS is connected.\n# TYPE gorouter_nats_connected gauge\ngorouter_nats_connected 1\n"))
+		Expect(text).To(MatchRegexp(`go_goroutines \d+\n`))
+		Expect(text).To(MatchRegexp(`go_memstats_alloc_bytes \d+`))
+	})
+
+	It("reports added labeled counters", func() {
+		reporter.AddLabeledCounter("gorouter_accepted_connections_total", "Connections accepted by listener.", "listener", func() map[string]uint64 {
+			return map[string]uint64{"http-1": 3, "http-0": 2}
+		})
+
+		text := prometheusText(reporter)
+		Expect(text).To(ContainSubstring("# TYPE gorouter_accepted_connections_total counter\n" +
+			"gorouter_accepted_connections_total{listener=\"http-0\"} 2\n" +
+			"gorouter_accepted_connections_total{listener=\"http-1\"} 3\n"))
+	})
+
+	It("serves the metrics over HTTP", func() {
+		reporter.CaptureBadGateway()
+
+		recorder := httptest.NewRecorder()
+		reporter.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Header().Get("Content-Type")).To(Equal("text/plain; version=0.0.4"))
+		Expect(recorder.Body.String()).To(ContainSubstring("gorouter_bad_gateways_total 1\n"))
+	})
+})
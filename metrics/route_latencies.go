@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	gometrics "github.com/rcrowley/go-metrics"
+)
+
+// RouteLatency is a summary of the latencies of the requests to a route.
+type RouteLatency struct {
+	Requests int64
+	P50      time.Duration
+	P95      time.Duration
+	P99      time.Duration
+}
+
+// RouteLatencies tracks the latency percentiles of up to maxRoutes routes,
+// and of all other routes together under OtherRoutes. Latencies are sampled
+// with an exponential decay, so the percentiles favor recent requests.
+type RouteLatencies struct {
+	lock      sync.Mutex
+	maxRoutes int
+	routes    map[string]gometrics.Histogram
+}
+
+func NewRouteLatencies(maxRoutes int) *RouteLatencies {
+	return &RouteLatencies{
+		maxRoutes: maxRoutes,
+		routes:    make(map[string]gometrics.Histogram),
+	}
+}
+
+func (l *RouteLatencies) CaptureRouteResponseLatency(route string, d time.Duration) {
+	l.lock.Lock()
+	h, ok := l.routes[route]
+	if !ok {
+		if len(l.routes) >= l.maxRoutes {
+			route = OtherRoutes
+			h = l.routes[route]
+		}
+		if h == nil {
+			h = gometrics.NewHistogram(gometrics.NewExpDecaySample(1028, 0.015))
+			l.routes[route] = h
+		}
+	}
+	l.lock.Unlock()
+
+	h.Update(d.Nanoseconds())
+}
+
+// Snapshot returns the latencies of the routes that have received requests.
+func (l *RouteLatencies) Snapshot() map[string]RouteLatency {
+	l.lock.Lock()
+	routes := make(map[string]gometrics.Histogram, len(l.routes))
+	for route, h := range l.routes {
+		routes[route] = h
+	}
+	l.lock.Unlock()
+
+	snapshot := make(map[string]RouteLatency, len(routes))
+	for route, h := range routes {
+		p := h.Percentiles([]float64{0.50, 0.95, 0.99})
+		snapshot[route] = RouteLatency{
+			Requests: h.Count(),
+			P50:      time.Duration(p[0]),
+			P95:      time.Duration(p[1]),
+			P99:      time.Duration(p[2]),
+		}
+	}
+	return snapshot
+}
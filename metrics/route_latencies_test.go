@@ -0,0 +1,52 @@
+package metrics_test
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/gorouter/metrics"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RouteLatencies", func() {
+	var latencies *metrics.RouteLatencies
+
+	BeforeEach(func() {
+		latencies = metrics.NewRouteLatencies(2)
+	})
+
+	It("tracks latency percentiles per route", func() {
+		for i := 1; i <= 100; i++ {
+			latencies.CaptureRouteResponseLatency("example.com", time.Duration(i)*time.Millisecond)
+		}
+		latencies.CaptureRouteResponseLatency("other.example.com", time.Second)
+
+		snapshot := latencies.Snapshot()
+		Expect(snapshot).To(HaveLen(2))
+		Expect(snapshot["example.com"].Requests).To(Equal(int64(100)))
+		Expect(snapshot["example.com"].P50).To(BeNumerically("~", 50*time.Millisecond, time.Millisecond))
+		Expect(snapshot["example.com"].P95).To(BeNumerically("~", 95*time.Millisecond, time.Millisecond))
+		Expect(snapshot["example.com"].P99).To(BeNumerically("~", 99*time.Millisecond, time.Millisecond))
+		Expect(snapshot["other.example.com"]).To(Equal(metrics.RouteLatency{
+			Requests: 1,
+			P50:      time.Second,
+			P95:      time.Second,
+			P99:      time.Second,
+		}))
+	})
+
+	It("tracks routes beyond the maximum together", func() {
+		latencies.CaptureRouteResponseLatency("a.example.com", time.Millisecond)
+		latencies.CaptureRouteResponseLatency("b.example.com", time.Millisecond)
+		latencies.CaptureRouteResponseLatency("c.example.com", time.Millisecond)
+		latencies.CaptureRouteResponseLatency("d.example.com", time.Millisecond)
+		latencies.CaptureRouteResponseLatency("a.example.com", time.Millisecond)
+
+		snapshot := latencies.Snapshot()
+		Expect(snapshot).To(HaveLen(3))
+		Expect(snapshot["a.example.com"].Requests).To(Equal(int64(2)))
+		Expect(snapshot["b.example.com"].Requests).To(Equal(int64(1)))
+		Expect(snapshot[metrics.OtherRoutes].Requests).To(Equal(int64(2)))
+	})
+})
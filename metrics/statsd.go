@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/route"
+)
+
+// StatsdReporter emits the metrics of the MetricsReporter to a StatsD server,
+// one metric per write. Metrics are tagged in the DogStatsD format when tags
+// are given.
+type StatsdReporter struct {
+	lock      sync.Mutex
+	writer    io.Writer
+	prefix    string
+	tags      string
+	routeTags []string
+}
+
+// NewStatsdReporter creates a reporter that writes metrics named with the
+// prefix to w, which is usually a UDP connection to the StatsD server. The
+// request metrics are also tagged with the routeTags of the route
+// registrations that have them.
+func NewStatsdReporter(w io.Writer, prefix string, tags map[string]string, routeTags []string) *StatsdReporter {
+	return &StatsdReporter{
+		writer:    w,
+		prefix:    prefix,
+		tags:      formatStatsdTags(tags),
+		routeTags: routeTags,
+	}
+}
+
+func (s *StatsdReporter) CaptureBadRequest() {
+	s.increment("rejected_requests")
+}
+
+func (s *StatsdReporter) CaptureBadGateway() {
+	s.increment("bad_gateways")
+}
+
+func (s *StatsdReporter) CaptureRoutingRequest(b *route.Endpoint) {
+	s.sendTagged("total_requests", "1", "c", s.endpointTags(b))
+
+	componentName, ok := b.Tags["component"]
+	if ok && len(componentName) > 0 {
+		s.increment(fmt.Sprintf("requests.%s", componentName))
+		if strings.HasPrefix(componentName, "dea-") {
+			s.increment("routed_app_requests")
+		}
+	}
+}
+
+func (s *StatsdReporter) CaptureRouteServiceResponse(res *http.Response) {
+	var statusCode int
+	if res != nil {
+		statusCode = res.StatusCode
+	}
+	s.increment(fmt.Sprintf("responses.route_services.%s", getResponseCounterName(statusCode)))
+	s.increment("responses.route_services")
+}
+
+func (s *StatsdReporter) CaptureRoutingResponse(statusCode int) {
+	s.increment(fmt.Sprintf("responses.%s", getResponseCounterName(statusCode)))
+	s.increment("responses")
+}
+
+func (s *StatsdReporter) CaptureRoutingResponseLatency(b *route.Endpoint, d time.Duration) {
+	s.sendTagged("latency", formatFloat(float64(d)/float64(time.Millisecond)), "ms", s.endpointTags(b))
+
+	componentName, ok := b.Tags["component"]
+	if ok && len(componentName) > 0 {
+		s.timing(fmt.Sprintf("latency.%s", componentName), d)
+	}
+}
+
+func (s *StatsdReporter) CaptureLookupTime(t time.Duration) {
+	s.timing("route_lookup_time", t)
+}
+
+func (s *StatsdReporter) CaptureRouteStats(totalRoutes int, msSinceLastUpdate uint64) {
+	s.gauge("total_routes", float64(totalRoutes))
+	s.gauge("ms_since_last_registry_update", float64(msSinceLastUpdate))
+}
+
+func (s *StatsdReporter) CaptureRegistryMessage(msg ComponentTagged) {
+	if msg.Component() == "" {
+		s.increment("registry_message")
+	} else {
+		s.increment("registry_message." + msg.Component())
+	}
+}
+
+func (s *StatsdReporter) CaptureUnregistryMessage(msg ComponentTagged) {
+	if msg.Component() == "" {
+		s.increment("unregistry_message")
+	} else {
+		s.increment("unregistry_message." + msg.Component())
+	}
+}
+
+func (s *StatsdReporter) CaptureRejectedRegistryMessage(reason string) {
+	s.increment("rejected_registry_messages")
+	s.increment("rejected_registry_messages." + reason)
+}
+
+func (s *StatsdReporter) CaptureWebSocketUpdate() {
+	s.increment("websocket_upgrades")
+}
+
+func (s *StatsdReporter) CaptureWebSocketFailure() {
+	s.increment("websocket_failures")
+}
+
+func (s *StatsdReporter) CaptureWebSocketConnections(active int) {
+	s.gauge("websocket_connections", float64(active))
+}
+
+func (s *StatsdReporter) increment(name string) {
+	s.send(name, "1", "c")
+}
+
+func (s *StatsdReporter) timing(name string, d time.Duration) {
+	s.send(name, formatFloat(float64(d)/float64(time.Millisecond)), "ms")
+}
+
+func (s *StatsdReporter) gauge(name string, v float64) {
+	s.send(name, formatFloat(v), "g")
+}
+
+// send writes the metric, dropping it if the server cannot be reached.
+func (s *StatsdReporter) send(name, value, kind string) {
+	s.sendTagged(name, value, kind, nil)
+}
+
+// sendTagged writes the metric with the tags in addition to the tags of the
+// reporter.
+func (s *StatsdReporter) sendTagged(name, value, kind string, tags []string) {
+	line := s.prefix + name + ":" + value + "|" + kind + s.tags
+	if len(tags) > 0 {
+		if s.tags == "" {
+			line += "|#"
+		} else {
+			line += ","
+		}
+		line += strings.Join(tags, ",")
+	}
+
+	s.lock.Lock()
+	s.writer.Write([]byte(line))
+	s.lock.Unlock()
+}
+
+// endpointTags returns the route tags of the endpoint that it has a value for.
+func (s *StatsdReporter) endpointTags(b *route.Endpoint) []string {
+	var tags []string
+	for _, tag := range s.routeTags {
+		if v := b.Tags[tag]; v != "" {
+			tags = append(tags, tag+":"+v)
+		}
+	}
+	return tags
+}
+
+func formatStatsdTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, k+":"+v)
+	}
+	sort.Strings(pairs)
+	return "|#" + strings.Join(pairs, ",")
+}
@@ -0,0 +1,139 @@
+package metrics_test
+
+import (
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/metrics"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/routing-api/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type packetWriter struct {
+	packets []string
+}
+
+func (w *packetWriter) Write(b []byte) (int, error) {
+	w.packets = append(w.packets, string(b))
+	return len(b), nil
+}
+
+type componentTagged string
+
+func (c componentTagged) Component() string {
+	return string(c)
+}
+
+var _ = Describe("StatsdReporter", func() {
+	var (
+		writer   *packetWriter
+		reporter *metrics.StatsdReporter
+		endpoint *route.Endpoint
+	)
+
+	BeforeEach(func() {
+		writer = &packetWriter{}
+		reporter = metrics.NewStatsdReporter(writer, "gorouter.", nil, nil)
+		endpoint = route.NewEndpoint("someId", "host", 2222, "privateId", "2", map[string]string{"component": "CloudController"}, 30, "", models.ModificationTag{}, "")
+	})
+
+	It("increments request counters", func() {
+		reporter.CaptureRoutingRequest(endpoint)
+		reporter.CaptureBadRequest()
+		reporter.CaptureBadGateway()
+
+		Expect(writer.packets).To(Equal([]string{
+			"gorouter.total_requests:1|c",
+			"gorouter.requests.CloudController:1|c",
+			"gorouter.rejected_requests:1|c",
+			"gorouter.bad_gateways:1|c",
+		}))
+	})
+
+	It("increments response counters by status class", func() {
+		reporter.CaptureRoutingResponse(http.StatusNotFound)
+		reporter.CaptureRouteServiceResponse(&http.Response{StatusCode: http.StatusOK})
+
+		Expect(writer.packets).To(Equal([]string{
+			"gorouter.responses.4xx:1|c",
+			"gorouter.responses:1|c",
+			"gorouter.responses.route_services.2xx:1|c",
+			"gorouter.responses.route_services:1|c",
+		}))
+	})
+
+	It("sends latencies as timers in milliseconds", func() {
+		reporter.CaptureRoutingResponseLatency(endpoint, 1500*time.Microsecond)
+		reporter.CaptureLookupTime(250 * time.Microsecond)
+
+		Expect(writer.packets).To(Equal([]string{
+			"gorouter.latency:1.5|ms",
+			"gorouter.latency.CloudController:1.5|ms",
+			"gorouter.route_lookup_time:0.25|ms",
+		}))
+	})
+
+	It("sends route stats and WebSocket connections as gauges", func() {
+		reporter.CaptureRouteStats(12, 300)
+		reporter.CaptureWebSocketConnections(4)
+
+		Expect(writer.packets).To(Equal([]string{
+			"gorouter.total_routes:12|g",
+			"gorouter.ms_since_last_registry_update:300|g",
+			"gorouter.websocket_connections:4|g",
+		}))
+	})
+
+	It("increments registry message counters by component", func() {
+		reporter.CaptureRegistryMessage(componentTagged("uaa"))
+		reporter.CaptureUnregistryMessage(componentTagged(""))
+
+		Expect(writer.packets).To(Equal([]string{
+			"gorouter.registry_message.uaa:1|c",
+			"gorouter.unregistry_message:1|c",
+		}))
+	})
+
+	Context("with tags", func() {
+		BeforeEach(func() {
+			reporter = metrics.NewStatsdReporter(writer, "", map[string]string{"env": "prod", "az": "z1"}, nil)
+		})
+
+		It("tags metrics in the DogStatsD format", func() {
+			reporter.CaptureBadGateway()
+
+			Expect(writer.packets).To(Equal([]string{"bad_gateways:1|c|#az:z1,env:prod"}))
+		})
+	})
+
+	Context("with route tags", func() {
+		BeforeEach(func() {
+			endpoint.Tags["team"] = "payments"
+		})
+
+		It("tags the request metrics with the route tags of the endpoint", func() {
+			reporter = metrics.NewStatsdReporter(writer, "", nil, []string{"team", "environment"})
+			reporter.CaptureRoutingRequest(endpoint)
+			reporter.CaptureRoutingResponseLatency(endpoint, 5*time.Millisecond)
+			reporter.CaptureBadGateway()
+
+			Expect(writer.packets).To(Equal([]string{
+				"total_requests:1|c|#team:payments",
+				"requests.CloudController:1|c",
+				"latency:5|ms|#team:payments",
+				"latency.CloudController:5|ms",
+				"bad_gateways:1|c",
+			}))
+		})
+
+		It("adds the route tags to the tags of the reporter", func() {
+			reporter = metrics.NewStatsdReporter(writer, "", map[string]string{"env": "prod"}, []string{"team"})
+			reporter.CaptureRoutingRequest(endpoint)
+
+			Expect(writer.packets[0]).To(Equal("total_requests:1|c|#env:prod,team:payments"))
+		})
+	})
+})
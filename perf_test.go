@@ -29,12 +29,12 @@ var _ = Describe("AccessLogRecord", func() {
 		logger := test_util.NewTestZapLogger("test")
 		c := config.DefaultConfig()
 		r := registry.NewRouteRegistry(logger, c, new(fakes.FakeRouteRegistryReporter))
-		combinedReporter := metrics.NewCompositeReporter(varz.NewVarz(r), metricsReporter)
+		combinedReporter := metrics.NewCompositeReporter(varz.NewVarz(r, nil), metricsReporter)
 		accesslog, err := access_log.CreateRunningAccessLogger(logger, c)
 		Expect(err).ToNot(HaveOccurred())
 
 		proxy.NewProxy(logger, accesslog, c, r, combinedReporter, &routeservice.RouteServiceConfig{},
-			&tls.Config{}, nil)
+			&tls.Config{}, nil, nil, nil, nil, nil, nil, nil)
 
 		b.Time("RegisterTime", func() {
 			for i := 0; i < 1000; i++ {
@@ -9,9 +9,13 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	router_http "code.cloudfoundry.org/gorouter/common/http"
+	"code.cloudfoundry.org/gorouter/common/proxyprotocol"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/handlers"
 	"code.cloudfoundry.org/gorouter/logger"
 	"code.cloudfoundry.org/gorouter/metrics"
 	"code.cloudfoundry.org/gorouter/proxy/utils"
@@ -25,6 +29,38 @@ const (
 
 var NoEndpointsAvailable = errors.New("No endpoints available")
 
+// EndpointsSaturated is returned when every endpoint of a route has as many
+// requests in flight as its max_connections_per_endpoint.
+var EndpointsSaturated = errors.New("All endpoints are at their connection limit")
+
+// WebSockets limits the WebSocket connections proxied at the same time and
+// reports how many are active. It is shared by the handlers of all requests.
+type WebSockets struct {
+	config   config.WebSocketConfig
+	reporter metrics.CombinedReporter
+	active   int64
+}
+
+func NewWebSockets(cfg config.WebSocketConfig, reporter metrics.CombinedReporter) *WebSockets {
+	return &WebSockets{config: cfg, reporter: reporter}
+}
+
+// acquire counts a new connection, unless the maximum number of connections
+// are already active.
+func (w *WebSockets) acquire() bool {
+	active := atomic.AddInt64(&w.active, 1)
+	if w.config.MaxConnections > 0 && active > int64(w.config.MaxConnections) {
+		atomic.AddInt64(&w.active, -1)
+		return false
+	}
+	w.reporter.CaptureWebSocketConnections(int(active))
+	return true
+}
+
+func (w *WebSockets) release() {
+	w.reporter.CaptureWebSocketConnections(int(atomic.AddInt64(&w.active, -1)))
+}
+
 type RequestHandler struct {
 	logger   logger.Logger
 	reporter metrics.CombinedReporter
@@ -44,7 +80,7 @@ func NewRequestHandler(request *http.Request, response utils.ProxyResponseWriter
 }
 
 func setupLogger(request *http.Request, logger logger.Logger) logger.Logger {
-	tmpLogger := logger.Session("request-handler")
+	tmpLogger := handlers.RequestLogger(logger.Session("request-handler"), request)
 	return tmpLogger.With(
 		zap.String("RemoteAddr", request.RemoteAddr),
 		zap.String("Host", request.Host),
@@ -70,18 +106,31 @@ func (h *RequestHandler) HandleTcpRequest(iter route.EndpointIterator) {
 	h.logger.Info("handling-tcp-request", zap.String("Upgrade", "tcp"))
 
 	onConnectionFailed := func(err error) { h.logger.Error("tcp-connection-failed", zap.Error(err)) }
-	err := h.serveTcp(iter, nil, onConnectionFailed)
+	err := h.serveTcp(iter, nil, onConnectionFailed, 0)
+	if err == handlers.ErrAppQuotaExceeded {
+		return
+	}
 	if err != nil {
 		h.logger.Error("tcp-request-failed", zap.Error(err))
+		h.response.Header().Set("X-Cf-RouterError", "endpoint_failure")
 		h.writeStatus(http.StatusBadGateway, "TCP forwarding to endpoint failed.")
 		return
 	}
 	h.response.SetStatus(http.StatusSwitchingProtocols)
 }
 
-func (h *RequestHandler) HandleWebSocketRequest(iter route.EndpointIterator) {
+func (h *RequestHandler) HandleWebSocketRequest(iter route.EndpointIterator, webSockets *WebSockets) {
 	h.logger.Info("handling-websocket-request", zap.String("Upgrade", "websocket"))
 
+	if !webSockets.acquire() {
+		h.logger.Info("websocket-limit-reached", zap.Int("max-connections", webSockets.config.MaxConnections))
+		h.response.Header().Set("X-Cf-RouterError", "websocket_limit")
+		h.writeStatus(http.StatusServiceUnavailable, "Too many WebSocket connections.")
+		h.reporter.CaptureWebSocketFailure()
+		return
+	}
+	defer webSockets.release()
+
 	onConnectionSucceeded := func(connection net.Conn, endpoint *route.Endpoint) error {
 		h.setupRequest(endpoint)
 		err := h.request.Write(connection)
@@ -92,10 +141,14 @@ func (h *RequestHandler) HandleWebSocketRequest(iter route.EndpointIterator) {
 	}
 	onConnectionFailed := func(err error) { h.logger.Error("websocket-connection-failed", zap.Error(err)) }
 
-	err := h.serveTcp(iter, onConnectionSucceeded, onConnectionFailed)
+	err := h.serveTcp(iter, onConnectionSucceeded, onConnectionFailed, webSockets.config.IdleTimeout)
+	if err == handlers.ErrAppQuotaExceeded {
+		return
+	}
 
 	if err != nil {
 		h.logger.Error("websocket-request-failed", zap.Error(err))
+		h.response.Header().Set("X-Cf-RouterError", "endpoint_failure")
 		h.writeStatus(http.StatusBadGateway, "WebSocket request to endpoint failed.")
 		h.reporter.CaptureWebSocketFailure()
 		return
@@ -115,6 +168,18 @@ func (h *RequestHandler) writeStatus(code int, message string) {
 	}
 }
 
+// NextEndpoint returns the next endpoint of the iterator and takes a
+// connection slot of it. Endpoints whose last slot another request took since
+// they were selected are skipped.
+func NextEndpoint(iter route.EndpointIterator) *route.Endpoint {
+	for {
+		endpoint := iter.Next()
+		if endpoint == nil || iter.PreRequest(endpoint) {
+			return endpoint
+		}
+	}
+}
+
 type connSuccessCB func(net.Conn, *route.Endpoint) error
 type connFailureCB func(error)
 
@@ -125,10 +190,12 @@ func (h *RequestHandler) serveTcp(
 	iter route.EndpointIterator,
 	onConnectionSucceeded connSuccessCB,
 	onConnectionFailed connFailureCB,
+	idleTimeout time.Duration,
 ) error {
 	var err error
 	var connection net.Conn
 	var endpoint *route.Endpoint
+	var releaseQuota func()
 
 	if onConnectionSucceeded == nil {
 		onConnectionSucceeded = nilConnSuccessCB
@@ -139,19 +206,28 @@ func (h *RequestHandler) serveTcp(
 
 	retry := 0
 	for {
-		endpoint = iter.Next()
+		endpoint = NextEndpoint(iter)
 		if endpoint == nil {
 			err = NoEndpointsAvailable
 			h.HandleBadGateway(err, h.request)
 			return err
 		}
 
-		connection, err = net.DialTimeout("tcp", endpoint.CanonicalAddr(), 5*time.Second)
+		releaseQuota, err = h.takeAppQuota(endpoint)
+		if err != nil {
+			iter.PostRequest(endpoint)
+			return err
+		}
+
+		connection, err = utils.DialEndpoint("tcp", endpoint.CanonicalAddr(), 5*time.Second)
 		if err == nil {
+			iter.EndpointSucceeded()
 			break
 		}
 
 		iter.EndpointFailed()
+		iter.PostRequest(endpoint)
+		releaseQuota()
 		onConnectionFailed(err)
 
 		retry++
@@ -163,6 +239,16 @@ func (h *RequestHandler) serveTcp(
 		return nil
 	}
 	defer connection.Close()
+	// the upgraded connection holds its slot, and counts against the quota of
+	// its application, for the lifetime of the stream
+	defer iter.PostRequest(endpoint)
+	defer releaseQuota()
+
+	if header, ok := proxyprotocol.ContextHeader(h.request.Context()); ok {
+		if _, err = connection.Write(header); err != nil {
+			return err
+		}
+	}
 
 	err = onConnectionSucceeded(connection, endpoint)
 	if err != nil {
@@ -175,10 +261,26 @@ func (h *RequestHandler) serveTcp(
 	}
 	defer client.Close()
 
-	forwardIO(client, connection)
+	forwardIO(client, connection, idleTimeout)
 	return nil
 }
 
+// takeAppQuota takes the request from the quota of the application of the
+// endpoint, and responds with 429 Too Many Requests when the application is
+// over its quota.
+func (h *RequestHandler) takeAppQuota(endpoint *route.Endpoint) (func(), error) {
+	reqInfo, err := handlers.ContextRequestInfo(h.request)
+	if err != nil || reqInfo.AppQuotas == nil {
+		return func() {}, nil
+	}
+	release, wait, err := reqInfo.AppQuotas.Take(endpoint.ApplicationId)
+	if err != nil {
+		handlers.WriteAppQuotaExceeded(h.response, wait, h.logger)
+		return nil, err
+	}
+	return release, nil
+}
+
 func (h *RequestHandler) setupRequest(endpoint *route.Endpoint) {
 	h.setRequestURL(endpoint.CanonicalAddr())
 	h.setRequestXForwardedFor()
@@ -221,12 +323,28 @@ func (h *RequestHandler) hijack() (client net.Conn, io *bufio.ReadWriter, err er
 	return h.response.Hijack()
 }
 
-func forwardIO(a, b net.Conn) {
+// forwardIO copies between a and b until either is closed. With an idle
+// timeout, both are closed when no data has been read from either for that
+// long.
+func forwardIO(a, b net.Conn, idleTimeout time.Duration) {
 	done := make(chan bool, 2)
 
+	var reset func()
+	if idleTimeout > 0 {
+		timer := time.AfterFunc(idleTimeout, func() {
+			a.Close()
+			b.Close()
+		})
+		defer timer.Stop()
+		reset = func() { timer.Reset(idleTimeout) }
+	}
+
 	copy := func(dst io.Writer, src io.Reader) {
+		if reset != nil {
+			src = &activityReader{Reader: src, read: reset}
+		}
 		// don't care about errors here
-		io.Copy(dst, src)
+		utils.Buffers.Copy(dst, src)
 		done <- true
 	}
 
@@ -235,3 +353,17 @@ func forwardIO(a, b net.Conn) {
 
 	<-done
 }
+
+// activityReader calls read each time data is read.
+type activityReader struct {
+	io.Reader
+	read func()
+}
+
+func (r *activityReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.read()
+	}
+	return n, err
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/urfave/negroni"
+)
+
+// HandlerPosition is a position in the chain of handlers of the proxy at which
+// handlers can be registered. The positions are in the order in which
+// requests pass them.
+type HandlerPosition int
+
+const (
+	// BeforeAccessLog is after the RequestInfo of the request, its
+	// ProxyResponseWriter and its request ID have been set up, and before it
+	// is access logged. Requests that handlers respond to at this position
+	// are not access logged or reported.
+	BeforeAccessLog HandlerPosition = iota
+	// BeforeLookup is after requests are access logged and reported, load
+	// balancer health checks are answered, the security headers and
+	// forwarded client certificates of requests are handled, and requests are
+	// rewritten or redirected by the rewrite rules, and before the route of
+	// the request is looked up.
+	BeforeLookup
+	// AfterLookup is after the route of the request has been looked up and
+	// set as the RoutePool of its RequestInfo and plain HTTP requests to
+	// routes forcing HTTPS have been redirected, and before the request is
+	// checked against the IP access lists, maintenance, authentication,
+	// limits and quotas of its route.
+	AfterLookup
+	// BeforeProxy is after all other handlers, including the one sending
+	// requests to route services, immediately before the request is proxied
+	// to an endpoint or route service.
+	BeforeProxy
+)
+
+func (p HandlerPosition) String() string {
+	switch p {
+	case BeforeAccessLog:
+		return "BeforeAccessLog"
+	case BeforeLookup:
+		return "BeforeLookup"
+	case AfterLookup:
+		return "AfterLookup"
+	case BeforeProxy:
+		return "BeforeProxy"
+	}
+	return fmt.Sprintf("HandlerPosition(%d)", int(p))
+}
+
+// Handlers are handlers registered at positions in the chain of handlers of
+// the proxy, which let the router be extended without changing the proxy.
+// Handlers registered at the same position are called in the order in which
+// they were registered. A handler that does not call the next handler
+// responds to the request itself.
+type Handlers struct {
+	lock       sync.Mutex
+	byPosition map[HandlerPosition][]negroni.Handler
+}
+
+// DefaultHandlers are the handlers that NewProxy adds to the chain of
+// handlers of proxies.
+var DefaultHandlers = &Handlers{}
+
+// RegisterHandler registers the handler at the position in DefaultHandlers.
+// Only proxies created after it is called call the handler, so it is usually
+// called from an init function.
+func RegisterHandler(position HandlerPosition, handler negroni.Handler) {
+	DefaultHandlers.Register(position, handler)
+}
+
+// Register registers the handler at the position. It panics if the position
+// is unknown or the handler is nil.
+func (h *Handlers) Register(position HandlerPosition, handler negroni.Handler) {
+	if position < BeforeAccessLog || position > BeforeProxy {
+		panic(fmt.Sprintf("proxy: unknown handler position %s", position))
+	}
+	if handler == nil {
+		panic("proxy: nil handler")
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.byPosition == nil {
+		h.byPosition = make(map[HandlerPosition][]negroni.Handler)
+	}
+	h.byPosition[position] = append(h.byPosition[position], handler)
+}
+
+// use adds the handlers registered at the position to the chain.
+func (h *Handlers) use(n *negroni.Negroni, position HandlerPosition) {
+	h.lock.Lock()
+	handlers := h.byPosition[position]
+	h.lock.Unlock()
+
+	for _, handler := range handlers {
+		n.Use(handler)
+	}
+}
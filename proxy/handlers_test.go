@@ -0,0 +1,114 @@
+package proxy_test
+
+import (
+	"net/http"
+
+	"code.cloudfoundry.org/gorouter/handlers"
+	"code.cloudfoundry.org/gorouter/proxy"
+	"code.cloudfoundry.org/gorouter/test_util"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/urfave/negroni"
+)
+
+var _ = Describe("Registered handlers", func() {
+	var (
+		defaultHandlers *proxy.Handlers
+		calls           []string
+	)
+
+	recordCall := func(name string) negroni.HandlerFunc {
+		return func(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+			reqInfo, err := handlers.ContextRequestInfo(req)
+			Expect(err).ToNot(HaveOccurred())
+			call := name
+			if reqInfo.RoutePool != nil {
+				call += " with route"
+			}
+			calls = append(calls, call)
+			req.Header.Add("X-Handlers", call)
+			next(rw, req)
+		}
+	}
+
+	BeforeEach(func() {
+		defaultHandlers = proxy.DefaultHandlers
+		proxy.DefaultHandlers = &proxy.Handlers{}
+		calls = nil
+	})
+
+	AfterEach(func() {
+		proxy.DefaultHandlers = defaultHandlers
+	})
+
+	Context("when handlers are registered", func() {
+		BeforeEach(func() {
+			proxy.RegisterHandler(proxy.BeforeProxy, recordCall("before-proxy"))
+			proxy.RegisterHandler(proxy.AfterLookup, recordCall("after-lookup"))
+			proxy.RegisterHandler(proxy.BeforeLookup, recordCall("before-lookup-1"))
+			proxy.RegisterHandler(proxy.BeforeLookup, recordCall("before-lookup-2"))
+			proxy.RegisterHandler(proxy.BeforeAccessLog, recordCall("before-access-log"))
+		})
+
+		It("calls them in the order of their positions and registration", func() {
+			ln := registerHandler(r, "app", func(conn *test_util.HttpConn) {
+				req, _ := conn.ReadRequest()
+				Expect(req.Header["X-Handlers"]).To(Equal([]string{
+					"before-access-log",
+					"before-lookup-1",
+					"before-lookup-2",
+					"after-lookup with route",
+					"before-proxy with route",
+				}))
+				conn.WriteResponse(test_util.NewResponse(http.StatusOK))
+			})
+			defer ln.Close()
+
+			conn := dialProxy(proxyServer)
+			conn.WriteRequest(test_util.NewRequest("GET", "app", "/", nil))
+
+			resp, _ := conn.ReadResponse()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		})
+
+		It("calls the handlers before the lookup for unknown routes", func() {
+			conn := dialProxy(proxyServer)
+			conn.WriteRequest(test_util.NewRequest("GET", "unknown", "/", nil))
+
+			resp, _ := conn.ReadResponse()
+			Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+			Expect(calls).To(Equal([]string{"before-access-log", "before-lookup-1", "before-lookup-2"}))
+		})
+	})
+
+	Context("when a handler responds to the request", func() {
+		BeforeEach(func() {
+			proxy.RegisterHandler(proxy.BeforeLookup, negroni.HandlerFunc(func(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+				rw.WriteHeader(http.StatusTeapot)
+			}))
+			proxy.RegisterHandler(proxy.AfterLookup, recordCall("after-lookup"))
+		})
+
+		It("does not call the following handlers", func() {
+			conn := dialProxy(proxyServer)
+			conn.WriteRequest(test_util.NewRequest("GET", "unknown", "/", nil))
+
+			resp, _ := conn.ReadResponse()
+			Expect(resp.StatusCode).To(Equal(http.StatusTeapot))
+			Expect(calls).To(BeEmpty())
+		})
+	})
+
+	It("panics when the position is unknown", func() {
+		Expect(func() {
+			proxy.RegisterHandler(proxy.HandlerPosition(42), recordCall("unknown"))
+		}).To(Panic())
+	})
+
+	It("panics when the handler is nil", func() {
+		Expect(func() {
+			proxy.RegisterHandler(proxy.BeforeProxy, nil)
+		}).To(Panic())
+	})
+})
@@ -1,17 +1,22 @@
 package proxy
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"net/http/httputil"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"code.cloudfoundry.org/clock"
 	"code.cloudfoundry.org/gorouter/access_log"
 	router_http "code.cloudfoundry.org/gorouter/common/http"
+	"code.cloudfoundry.org/gorouter/common/proxyprotocol"
 	"code.cloudfoundry.org/gorouter/config"
 	"code.cloudfoundry.org/gorouter/handlers"
 	"code.cloudfoundry.org/gorouter/logger"
@@ -22,8 +27,12 @@ import (
 	"code.cloudfoundry.org/gorouter/registry"
 	"code.cloudfoundry.org/gorouter/route"
 	"code.cloudfoundry.org/gorouter/routeservice"
+	"code.cloudfoundry.org/gorouter/scripting"
+	"code.cloudfoundry.org/gorouter/tracing"
+	"code.cloudfoundry.org/gorouter/wasm"
 	"github.com/uber-go/zap"
 	"github.com/urfave/negroni"
+	"golang.org/x/net/http2"
 )
 
 const (
@@ -42,12 +51,22 @@ type proxy struct {
 	reporter                 metrics.CombinedReporter
 	accessLogger             access_log.AccessLogger
 	secureCookies            bool
+	stickyCookieNames        []string
 	heartbeatOK              *int32
 	routeServiceConfig       *routeservice.RouteServiceConfig
 	healthCheckUserAgent     string
 	forceForwardedProtoHttps bool
+	proxyProtocolVersion     int
 	defaultLoadBalance       string
+	hashBalancing            config.HashBalancingConfig
+	retries                  config.RetryConfig
+	longLivedRequests        config.LongLivedRequestConfig
+	expectContinue           config.ExpectContinueConfig
+	reloadable               *config.ReloadableConfig
+	securityHeaders          http.Header
 	bufferPool               httputil.BufferPool
+	webSockets               *handler.WebSockets
+	script                   *scripting.Script
 }
 
 func NewProxy(
@@ -59,7 +78,18 @@ func NewProxy(
 	routeServiceConfig *routeservice.RouteServiceConfig,
 	tlsConfig *tls.Config,
 	heartbeatOK *int32,
+	spanExporter tracing.Exporter,
+	tokenValidator handlers.TokenValidator,
+	wasmPlugins *wasm.Plugins,
+	script *scripting.Script,
+	rewriteRules *handlers.RewriteRules,
+	reloadable *config.ReloadableConfig,
 ) Proxy {
+	// the reloadable settings are fixed unless they are reloaded by the
+	// router
+	if reloadable == nil {
+		reloadable = config.NewReloadableConfig(c)
+	}
 
 	p := &proxy{
 		accessLogger:             accessLogger,
@@ -68,54 +98,205 @@ func NewProxy(
 		logger:                   logger,
 		reporter:                 reporter,
 		secureCookies:            c.SecureCookies,
+		stickyCookieNames:        c.StickySessionCookieNames,
 		heartbeatOK:              heartbeatOK, // 1->true, 0->false
 		routeServiceConfig:       routeServiceConfig,
 		healthCheckUserAgent:     c.HealthCheckUserAgent,
 		forceForwardedProtoHttps: c.ForceForwardedProtoHttps,
+		proxyProtocolVersion:     c.Backends.ProxyProtocolVersion,
 		defaultLoadBalance:       c.LoadBalance,
-		bufferPool:               NewBufferPool(),
+		hashBalancing:            c.HashBalancing,
+		retries:                  c.Retries,
+		longLivedRequests:        c.LongLivedRequests,
+		expectContinue:           c.ExpectContinue,
+		reloadable:               reloadable,
+		securityHeaders:          handlers.SecurityHeaders(c.SecurityHeaders),
+		bufferPool:               utils.Buffers,
+		webSockets:               handler.NewWebSockets(c.WebSockets, reporter),
+		script:                   script,
 	}
 
-	httpTransport := &http.Transport{
-		Dial: func(network, addr string) (net.Conn, error) {
-			conn, err := net.DialTimeout(network, addr, 5*time.Second)
-			if err != nil {
-				return conn, err
-			}
-			if c.EndpointTimeout > 0 {
-				err = conn.SetDeadline(time.Now().Add(c.EndpointTimeout))
-			}
+	// requests that expect 100 Continue are only sent their body once the
+	// endpoint asks for it, or the timeout passes
+	var expectContinueTimeout time.Duration
+	if c.ExpectContinue.Mode == config.EXPECT_CONTINUE_FORWARD {
+		expectContinueTimeout = c.ExpectContinue.Timeout
+	}
+
+	// dialEndpoint connects to an endpoint with the dial timeout, deadline
+	// and PROXY protocol header of the request
+	dialEndpoint := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialTimeout := reloadable.Get().EndpointDialTimeout
+		if timeout, ok := round_tripper.ContextDialTimeout(ctx); ok {
+			dialTimeout = timeout
+		}
+		conn, err := utils.DialEndpoint(network, addr, dialTimeout)
+		if err != nil {
 			return conn, err
+		}
+		if timeout, ok := round_tripper.ContextEndpointTimeout(ctx); ok {
+			if timeout > 0 {
+				err = conn.SetDeadline(time.Now().Add(timeout))
+			}
+		} else if timeout := reloadable.Get().EndpointTimeout; timeout > 0 {
+			err = conn.SetDeadline(time.Now().Add(timeout))
+		}
+		if header, ok := proxyprotocol.ContextHeader(ctx); ok && err == nil {
+			_, err = conn.Write(header)
+		}
+		return conn, err
+	}
+
+	newTransport := func(tlsConfig *tls.Config) *http.Transport {
+		return &http.Transport{
+			DialContext: dialEndpoint,
+			// connections that start with the PROXY protocol header of a
+			// client cannot be reused for other clients
+			DisableKeepAlives:     c.DisableKeepAlives || c.Backends.ProxyProtocolVersion != 0,
+			MaxIdleConns:          c.MaxIdleConns,
+			IdleConnTimeout:       c.IdleConnTimeout,
+			MaxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+			MaxConnsPerHost:       c.MaxConnsPerHost,
+			ExpectContinueTimeout: expectContinueTimeout,
+			DisableCompression:    true,
+			TLSClientConfig:       tlsConfig,
+		}
+	}
+
+	httpTransport := newTransport(tlsConfig)
+
+	// endpoints registered with protocol http2 (e.g. gRPC applications) are
+	// reached over HTTP/2, in cleartext (h2c) unless they have a tls_port
+	newHTTP2Transport := func(tlsConfig *tls.Config) *http2RoundTripper {
+		transport := &http2.Transport{
+			AllowHTTP: tlsConfig == nil,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				conn, err := dialEndpoint(ctx, network, addr)
+				if err != nil || tlsConfig == nil {
+					return conn, err
+				}
+				// the handshake is bounded by the deadline of the connection
+				tlsConn := tls.Client(conn, tlsConfig)
+				if err := tlsConn.Handshake(); err != nil {
+					conn.Close()
+					return nil, err
+				}
+				if proto := tlsConn.ConnectionState().NegotiatedProtocol; proto != http2.NextProtoTLS {
+					conn.Close()
+					return nil, fmt.Errorf("http2: unexpected ALPN protocol %q; want %q", proto, http2.NextProtoTLS)
+				}
+				return tlsConn, nil
+			},
+			TLSClientConfig:    tlsConfig,
+			DisableCompression: true,
+		}
+		// connections that start with the PROXY protocol header of a client
+		// cannot be shared with other clients
+		if c.Backends.ProxyProtocolVersion != 0 {
+			transport.ConnPool = &singleUseConnPool{transport: transport}
+		}
+		return &http2RoundTripper{Transport: transport}
+	}
+
+	http2Transport := newHTTP2Transport(nil)
+
+	// endpoints registered with a tls_port are verified against the SAN they
+	// were registered with
+	newEndpointTLSConfig := func(serverName string) *tls.Config {
+		endpointTLSConfig := &tls.Config{}
+		if tlsConfig != nil {
+			endpointTLSConfig = tlsConfig.Clone()
+		}
+		endpointTLSConfig.ServerName = serverName
+		return endpointTLSConfig
+	}
+	tlsTransports := &tlsTransportFactory{
+		transports: map[string]round_tripper.ProxyRoundTripper{},
+		newTransport: func(serverName string) round_tripper.ProxyRoundTripper {
+			return round_tripper.NewDropsondeRoundTripper(newTransport(newEndpointTLSConfig(serverName)))
+		},
+	}
+	http2TLSTransports := &tlsTransportFactory{
+		transports: map[string]round_tripper.ProxyRoundTripper{},
+		newTransport: func(serverName string) round_tripper.ProxyRoundTripper {
+			endpointTLSConfig := newEndpointTLSConfig(serverName)
+			endpointTLSConfig.NextProtos = []string{http2.NextProtoTLS}
+			return round_tripper.NewDropsondeRoundTripper(newHTTP2Transport(endpointTLSConfig))
 		},
-		DisableKeepAlives:   c.DisableKeepAlives,
-		MaxIdleConns:        c.MaxIdleConns,
-		IdleConnTimeout:     90 * time.Second, // setting the value to golang default transport
-		MaxIdleConnsPerHost: c.MaxIdleConnsPerHost,
-		DisableCompression:  true,
-		TLSClientConfig:     tlsConfig,
+	}
+
+	proxyRoundTripper := p.proxyRoundTripper(httpTransport, http2Transport, tlsTransports, http2TLSTransports, c.Port)
+	if c.EnableCompression {
+		proxyRoundTripper = round_tripper.NewCompressionRoundTripper(proxyRoundTripper, c.Compression)
+	}
+	if c.ResponseCache.MaxSizeBytes > 0 {
+		proxyRoundTripper = round_tripper.NewCacheRoundTripper(proxyRoundTripper, c.ResponseCache, clock.NewClock())
+	}
+	if wasmPlugins != nil {
+		proxyRoundTripper = round_tripper.NewWasmRoundTripper(proxyRoundTripper, wasmPlugins, logger)
 	}
 
 	rproxy := &httputil.ReverseProxy{
 		Director:       p.setupProxyRequest,
-		Transport:      p.proxyRoundTripper(httpTransport, c.Port),
+		Transport:      proxyRoundTripper,
 		FlushInterval:  50 * time.Millisecond,
 		BufferPool:     p.bufferPool,
 		ModifyResponse: p.modifyResponse,
 	}
 
-	zipkinHandler := handlers.NewZipkin(c.Tracing.EnableZipkin, c.ExtraHeadersToLog, logger)
+	zipkinHandler := handlers.NewZipkin(c.Tracing.EnableZipkin, c.Tracing.Propagation, c.ExtraHeadersToLog, logger)
 	n := negroni.New()
 	n.Use(handlers.NewRequestInfo())
+	if len(c.ErrorPages) > 0 {
+		n.Use(handlers.NewErrorPages(c.ErrorPages, logger))
+	}
 	n.Use(handlers.NewProxyWriter(logger))
-	n.Use(handlers.NewsetVcapRequestIdHeader(logger))
-	n.Use(handlers.NewAccessLog(accessLogger, zipkinHandler.HeadersToLog(), logger))
+	if len(c.TrustedProxyNets) > 0 {
+		n.Use(handlers.NewForwardedHeaders(c.TrustedProxyNets))
+	}
+	n.Use(handlers.NewRequestIdHeader(c.RequestID, logger))
+	DefaultHandlers.use(n, BeforeAccessLog)
+	n.Use(handlers.NewAccessLog(accessLogger, zipkinHandler.HeadersToLog(), c.RouteTags.AccessLog, logger))
+	if c.SlowRequestThreshold > 0 {
+		n.Use(handlers.NewSlowRequestLog(c.SlowRequestThreshold, logger.Session("slow-requests")))
+	}
 	n.Use(handlers.NewReporter(reporter, logger))
 
-	n.Use(handlers.NewProxyHealthcheck(c.HealthCheckUserAgent, p.heartbeatOK, logger))
+	healthCheckUserAgents := append([]string{c.HealthCheckUserAgent}, c.HealthCheckUserAgents...)
+	n.Use(handlers.NewProxyHealthcheck(healthCheckUserAgents, c.HealthCheckPath, p.heartbeatOK, logger))
+	if spanExporter != nil {
+		n.Use(handlers.NewTracing(spanExporter, c.Tracing.OTLP.SamplePercentage, c.Tracing.Propagation, logger))
+	}
 	n.Use(zipkinHandler)
 	n.Use(handlers.NewProtocolCheck(logger))
+	n.Use(handlers.NewSecurityHeaders(c.SecurityHeaders))
+	n.Use(handlers.NewClientCert(c.ForwardedClientCert, logger))
+	if rewriteRules != nil {
+		n.Use(handlers.NewRewrite(rewriteRules, logger))
+	}
+	n.Use(handlers.NewIPAccess(c.IPAccess, c.TrustedProxyNets, logger))
+	DefaultHandlers.use(n, BeforeLookup)
 	n.Use(handlers.NewLookup(registry, reporter, logger))
-	n.Use(handlers.NewRouteService(routeServiceConfig, logger, registry))
+	if script != nil {
+		n.Use(handlers.NewScripting(script, registry, logger))
+	}
+	if len(c.VirtualHosts) > 0 {
+		n.Use(handlers.NewVirtualHost(c.VirtualHosts, logger))
+	}
+	n.Use(handlers.NewForceHTTPS(c.ForceHTTPS, c.ForceForwardedProtoHttps, logger))
+	DefaultHandlers.use(n, AfterLookup)
+	n.Use(handlers.NewRouteIPAccess(c.IPAccess, c.TrustedProxyNets, logger))
+	n.Use(handlers.NewMaintenance(logger))
+	n.Use(handlers.NewRouteAuth(c.RouteAuth, tokenValidator, logger))
+	n.Use(handlers.NewRequestBodyLimit(c.MaxRequestBodySizeBytes, logger))
+	n.Use(handlers.NewRateLimit(reloadable, logger, clock.NewClock()))
+	n.Use(handlers.NewAppQuota(c.AppQuotas, reporter, logger, clock.NewClock()))
+	n.Use(handlers.NewRequestBuffering(c.RequestBuffering, logger))
+	n.Use(handlers.NewRequestQueue(c.RequestQueue, logger))
+	n.Use(handlers.NewHeaderRewrite(reloadable, logger))
+	n.Use(handlers.NewMirror(registry, c.Mirroring, c.LoadBalance, tlsConfig, logger))
+	n.Use(handlers.NewRouteService(routeServiceConfig, logger, registry, c.RouteServiceInternalLookup))
+	DefaultHandlers.use(n, BeforeProxy)
 	n.Use(p)
 	n.UseHandler(rproxy)
 
@@ -125,6 +306,14 @@ func NewProxy(
 func hostWithoutPort(req *http.Request) string {
 	host := req.Host
 
+	// IPv6 hosts keep their brackets
+	if strings.HasPrefix(host, "[") {
+		if pos := strings.Index(host, "]"); pos >= 0 {
+			return host[0 : pos+1]
+		}
+		return host
+	}
+
 	// Remove :<port>
 	pos := strings.Index(host, ":")
 	if pos >= 0 {
@@ -134,35 +323,73 @@ func hostWithoutPort(req *http.Request) string {
 	return host
 }
 
-func (p *proxy) proxyRoundTripper(transport round_tripper.ProxyRoundTripper, port uint16) round_tripper.ProxyRoundTripper {
+func (p *proxy) proxyRoundTripper(
+	transport, http2Transport round_tripper.ProxyRoundTripper,
+	tlsTransports, http2TLSTransports round_tripper.RoundTripperFactory,
+	port uint16,
+) round_tripper.ProxyRoundTripper {
 	return round_tripper.NewProxyRoundTripper(
 		round_tripper.NewDropsondeRoundTripper(transport),
+		round_tripper.NewDropsondeRoundTripper(http2Transport),
+		tlsTransports, http2TLSTransports,
 		p.logger, p.traceKey, p.ip, p.defaultLoadBalance,
-		p.reporter, p.secureCookies,
+		p.reporter, p.secureCookies, p.stickyCookieNames,
+		p.retries, p.longLivedRequests.Timeout, p.reloadable,
 		port,
 	)
 }
 
-type bufferPool struct {
-	pool *sync.Pool
+// http2RoundTripper adapts http2.Transport to round_tripper.ProxyRoundTripper.
+// HTTP/2 requests are canceled through their context, so CancelRequest is a
+// no-op.
+type http2RoundTripper struct {
+	*http2.Transport
 }
 
-func NewBufferPool() httputil.BufferPool {
-	return &bufferPool{
-		pool: new(sync.Pool),
-	}
+func (t *http2RoundTripper) CancelRequest(*http.Request) {}
+
+// singleUseConnPool opens a connection for every HTTP/2 request, and closes
+// it once the request is done.
+type singleUseConnPool struct {
+	transport *http2.Transport
 }
 
-func (b *bufferPool) Get() []byte {
-	buf := b.pool.Get()
-	if buf == nil {
-		return make([]byte, 8192)
+func (p *singleUseConnPool) GetClientConn(req *http.Request, addr string) (*http2.ClientConn, error) {
+	conn, err := p.transport.DialTLSContext(req.Context(), "tcp", addr, p.transport.TLSClientConfig)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := p.transport.NewClientConn(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
 	}
-	return buf.([]byte)
+	cc.SetDoNotReuse()
+	return cc, nil
+}
+
+func (p *singleUseConnPool) MarkDead(cc *http2.ClientConn) {
+	cc.Close()
 }
 
-func (b *bufferPool) Put(buf []byte) {
-	b.pool.Put(buf)
+// tlsTransportFactory creates one transport per server name, which keeps
+// connections to endpoints pooled per SAN.
+type tlsTransportFactory struct {
+	lock         sync.Mutex
+	transports   map[string]round_tripper.ProxyRoundTripper
+	newTransport func(serverName string) round_tripper.ProxyRoundTripper
+}
+
+func (f *tlsTransportFactory) New(serverName string) round_tripper.ProxyRoundTripper {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	transport, ok := f.transports[serverName]
+	if !ok {
+		transport = f.newTransport(serverName)
+		f.transports[serverName] = transport
+	}
+	return transport
 }
 
 func (p *proxy) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request, next http.HandlerFunc) {
@@ -172,15 +399,44 @@ func (p *proxy) ServeHTTP(responseWriter http.ResponseWriter, request *http.Requ
 	if err != nil {
 		p.logger.Fatal("request-info-err", zap.Error(err))
 	}
-	handler := handler.NewRequestHandler(request, proxyWriter, p.reporter, p.logger)
-
 	if reqInfo.RoutePool == nil {
 		p.logger.Fatal("request-info-err", zap.Error(errors.New("failed-to-access-RoutePool")))
 	}
 
-	stickyEndpointId := getStickySession(request)
+	// requests to route services keep the external path; they are stripped
+	// when they return from the route service
+	if reqInfo.RoutePool.StripPathPrefix() && reqInfo.RouteServiceURL == nil {
+		request = stripPathPrefix(request, reqInfo.RoutePool.ContextPath())
+	}
+	// route services are not sent the PROXY protocol header
+	if p.proxyProtocolVersion != 0 && reqInfo.RouteServiceURL == nil {
+		request = request.WithContext(proxyprotocol.WithHeader(request.Context(), p.proxyProtocolHeader(request)))
+	}
+	handler := handler.NewRequestHandler(request, proxyWriter, p.reporter, p.logger)
+
+	stickyEndpointId := getStickySession(request, p.stickyCookieNames)
+	if p.defaultLoadBalance == config.LOAD_BALANCE_HASH {
+		reqInfo.HashKey = p.hashKey(request)
+	}
+	// requests for a specific instance are not split
+	if rules := reqInfo.RoutePool.TrafficRules(); len(rules) > 0 && request.Header.Get(router_http.CfAppInstance) == "" {
+		reqInfo.SplitTraffic = true
+		reqInfo.TrafficGroup = route.TrafficGroup(rules, request)
+	}
+	if p.longLivedRequests.Enabled && isLongLived(request, p.longLivedRequests.Headers) {
+		p.pinLongLived(request, reqInfo, stickyEndpointId)
+	}
+	initialEndpointId := stickyEndpointId
+	if reqInfo.InitialEndpointID != "" {
+		initialEndpointId = reqInfo.InitialEndpointID
+	}
+	loadBalance := reqInfo.LoadBalance(p.defaultLoadBalance)
+	nested := reqInfo.RoutePool.Endpoints(loadBalance, initialEndpointId, reqInfo.HashKey)
+	if reqInfo.SplitTraffic {
+		nested = reqInfo.RoutePool.GroupEndpoints(reqInfo.TrafficGroup, loadBalance, initialEndpointId, reqInfo.HashKey)
+	}
 	iter := &wrappedIterator{
-		nested: reqInfo.RoutePool.Endpoints(p.defaultLoadBalance, stickyEndpointId),
+		nested: nested,
 
 		afterNext: func(endpoint *route.Endpoint) {
 			if endpoint != nil {
@@ -196,13 +452,83 @@ func (p *proxy) ServeHTTP(responseWriter http.ResponseWriter, request *http.Requ
 	}
 
 	if isWebSocketUpgrade(request) {
-		handler.HandleWebSocketRequest(iter)
+		handler.HandleWebSocketRequest(iter, p.webSockets)
 		return
 	}
 
 	next(responseWriter, request)
 }
 
+// proxyProtocolHeader returns the PROXY protocol header carrying the
+// addresses of the connection the request was received on.
+func (p *proxy) proxyProtocolHeader(request *http.Request) []byte {
+	var src net.Addr
+	if host, port, err := net.SplitHostPort(request.RemoteAddr); err == nil {
+		if portNum, err := strconv.Atoi(port); err == nil && net.ParseIP(host) != nil {
+			src = &net.TCPAddr{IP: net.ParseIP(host), Port: portNum}
+		}
+	}
+	dst, _ := request.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return proxyprotocol.Header(p.proxyProtocolVersion, src, dst)
+}
+
+// stripPathPrefix returns a copy of the request without the prefix at the
+// start of its path, so that the original request is still logged with the
+// external path. The prefix is matched case-insensitively and by whole
+// segments, like routes, and "*" segments match any segment.
+func stripPathPrefix(request *http.Request, prefix string) *http.Request {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return request
+	}
+	n, ok := pathPrefixLen(request.URL.Path, prefix)
+	if !ok {
+		return request
+	}
+
+	stripped := request.WithContext(request.Context())
+	u := *request.URL
+	u.Path = "/" + strings.TrimPrefix(u.Path[n:], "/")
+	if u.RawPath != "" {
+		if n, ok := pathPrefixLen(u.RawPath, prefix); ok {
+			u.RawPath = "/" + strings.TrimPrefix(u.RawPath[n:], "/")
+		} else {
+			u.RawPath = ""
+		}
+	}
+	stripped.URL = &u
+
+	// the request URI is forwarded as is to preserve its encoding
+	if n, ok := pathPrefixLen(request.RequestURI, prefix); ok {
+		stripped.RequestURI = "/" + strings.TrimPrefix(request.RequestURI[n:], "/")
+	} else {
+		stripped.RequestURI = u.RequestURI()
+	}
+	return stripped
+}
+
+// pathPrefixLen returns the length of the start of the path that is matched
+// by the segments of the prefix.
+func pathPrefixLen(path, prefix string) (int, bool) {
+	n := 0
+	for _, segment := range strings.Split(strings.TrimPrefix(prefix, "/"), "/") {
+		if n >= len(path) || path[n] != '/' {
+			return 0, false
+		}
+		n++
+
+		end := strings.IndexAny(path[n:], "/?")
+		if end == -1 {
+			end = len(path) - n
+		}
+		if segment != "*" && !strings.EqualFold(path[n:n+end], segment) {
+			return 0, false
+		}
+		n += end
+	}
+	return n, true
+}
+
 func (p *proxy) setupProxyRequest(target *http.Request) {
 	if p.forceForwardedProtoHttps {
 		target.Header.Set("X-Forwarded-Proto", "https")
@@ -222,9 +548,37 @@ func (p *proxy) setupProxyRequest(target *http.Request) {
 
 	handler.SetRequestXRequestStart(target)
 	target.Header.Del(router_http.CfAppInstance)
+
+	// the server tells the client to continue when the body is first read
+	if p.expectContinue.Mode == config.EXPECT_CONTINUE_LOCAL {
+		target.Header.Del("Expect")
+	}
 }
 
 func (p *proxy) modifyResponse(backendResp *http.Response) error {
+	if backendResp.Request != nil && backendResp.Request.TLS != nil {
+		// the security headers added by the router take precedence
+		for name := range p.securityHeaders {
+			backendResp.Header.Del(name)
+		}
+	}
+
+	handlers.ApplyHeaderRules(p.reloadable.Get().HeaderRewrites.Response, backendResp.Header)
+
+	if backendResp.Request == nil {
+		return nil
+	}
+	reqInfo, err := handlers.ContextRequestInfo(backendResp.Request)
+	if err == nil && reqInfo.RoutePool != nil {
+		if rewrites := reqInfo.RoutePool.HeaderRewrites(); rewrites != nil {
+			handlers.ApplyHeaderRules(rewrites.Response, backendResp.Header)
+		}
+	}
+	// responses of route services are passed to on_response as responses of
+	// the endpoints the route services forward the requests to
+	if p.script != nil && err == nil && reqInfo.RouteServiceURL == nil {
+		return p.script.OnResponse(backendResp, reqInfo.RoutePool)
+	}
 	return nil
 }
 
@@ -244,23 +598,86 @@ func (i *wrappedIterator) Next() *route.Endpoint {
 func (i *wrappedIterator) EndpointFailed() {
 	i.nested.EndpointFailed()
 }
-func (i *wrappedIterator) PreRequest(e *route.Endpoint) {
-	i.nested.PreRequest(e)
+func (i *wrappedIterator) EndpointErrored() {
+	i.nested.EndpointErrored()
+}
+func (i *wrappedIterator) EndpointSucceeded() {
+	i.nested.EndpointSucceeded()
+}
+func (i *wrappedIterator) EndpointResponded(latency time.Duration) {
+	i.nested.EndpointResponded(latency)
+}
+func (i *wrappedIterator) PreRequest(e *route.Endpoint) bool {
+	return i.nested.PreRequest(e)
 }
 func (i *wrappedIterator) PostRequest(e *route.Endpoint) {
 	i.nested.PostRequest(e)
 }
 
-func getStickySession(request *http.Request) string {
+func getStickySession(request *http.Request, stickyCookieNames []string) string {
 	// Try choosing a backend using sticky session
-	if _, err := request.Cookie(StickyCookieKey); err == nil {
-		if sticky, err := request.Cookie(VcapCookieId); err == nil {
-			return sticky.Value
+	for _, name := range stickyCookieNames {
+		if _, err := request.Cookie(name); err == nil {
+			if sticky, err := request.Cookie(VcapCookieId); err == nil {
+				return sticky.Value
+			}
+			break
 		}
 	}
 	return ""
 }
 
+// pinLongLived marks a long-lived request and pins it to the endpoint of the
+// session of the client, identified by the __VCAP_ID__ cookie even without a
+// sticky session cookie, as EventSource and long-poll clients may not send
+// one. Without a session, the endpoint is selected by hashing the hash
+// balancing key of the request, so that the requests of a client keep going
+// to the same endpoint.
+func (p *proxy) pinLongLived(request *http.Request, reqInfo *handlers.RequestInfo, stickyEndpointId string) {
+	reqInfo.LongLived = true
+	if reqInfo.InitialEndpointID == "" && stickyEndpointId == "" {
+		if sticky, err := request.Cookie(VcapCookieId); err == nil {
+			reqInfo.InitialEndpointID = sticky.Value
+		}
+	}
+	if reqInfo.HashKey == "" {
+		reqInfo.HashKey = p.hashKey(request)
+	}
+}
+
+// isLongLived reports whether the request is for server-sent events, or is a
+// long-poll request carrying one of the headers.
+func isLongLived(request *http.Request, headers []string) bool {
+	for _, accept := range request.Header[http.CanonicalHeaderKey("Accept")] {
+		if strings.Contains(strings.ToLower(accept), "text/event-stream") {
+			return true
+		}
+	}
+	for _, h := range headers {
+		if request.Header.Get(h) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// hashKey returns the request attribute hashed by the hash balancing
+// algorithm, or "" when the request does not have it.
+func (p *proxy) hashKey(request *http.Request) string {
+	switch p.hashBalancing.Key {
+	case config.HASH_KEY_HEADER:
+		return request.Header.Get(p.hashBalancing.Header)
+	case config.HASH_KEY_PATH_SEGMENT:
+		segments := strings.Split(strings.TrimPrefix(request.URL.Path, "/"), "/")
+		if p.hashBalancing.PathSegment >= 1 && p.hashBalancing.PathSegment <= len(segments) {
+			return segments[p.hashBalancing.PathSegment-1]
+		}
+		return ""
+	default:
+		return handlers.ClientIP(request)
+	}
+}
+
 func isWebSocketUpgrade(request *http.Request) bool {
 	// websocket should be case insensitive per RFC6455 4.2.1
 	return strings.ToLower(upgradeHeader(request)) == "websocket"
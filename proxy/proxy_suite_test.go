@@ -82,6 +82,9 @@ var _ = JustBeforeEach(func() {
 		InsecureSkipVerify: conf.SkipSSLValidation,
 		RootCAs:            caCertPool,
 	}
+	if len(conf.Backends.ClientAuthCertificate.Certificate) > 0 {
+		tlsConfig.Certificates = []tls.Certificate{conf.Backends.ClientAuthCertificate}
+	}
 	heartbeatOK = 1
 
 	routeServiceConfig := routeservice.NewRouteServiceConfig(
@@ -103,7 +106,7 @@ var _ = JustBeforeEach(func() {
 	Expect(err).ToNot(HaveOccurred())
 	conf.Port = uint16(intPort)
 
-	p = proxy.NewProxy(testLogger, accessLog, conf, r, fakeReporter, routeServiceConfig, tlsConfig, &heartbeatOK)
+	p = proxy.NewProxy(testLogger, accessLog, conf, r, fakeReporter, routeServiceConfig, tlsConfig, &heartbeatOK, nil, nil, nil, nil, nil, nil)
 
 	server := http.Server{Handler: p}
 	go server.Serve(proxyServer)
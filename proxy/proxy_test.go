@@ -3,15 +3,18 @@ package proxy_test
 import (
 	"bytes"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/http/httputil"
 	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -20,6 +23,7 @@ import (
 	"time"
 
 	router_http "code.cloudfoundry.org/gorouter/common/http"
+	"code.cloudfoundry.org/gorouter/config"
 	"code.cloudfoundry.org/gorouter/handlers"
 	"code.cloudfoundry.org/gorouter/registry"
 	"code.cloudfoundry.org/gorouter/route"
@@ -31,6 +35,7 @@ import (
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"golang.org/x/net/http2"
 )
 
 type connHandler func(*test_util.HttpConn)
@@ -55,6 +60,24 @@ var _ = Describe("Proxy", func() {
 		conn.CheckLine("HTTP/1.0 200 OK")
 	})
 
+	It("proxies to endpoints reached over a unix socket", func() {
+		ln := registerUnixSocketHandler(r, "unix-socket", func(conn *test_util.HttpConn) {
+			req, _ := conn.ReadRequest()
+			Expect(req.Host).To(Equal("unix-socket"))
+
+			conn.WriteResponse(test_util.NewResponse(http.StatusOK))
+		})
+		defer ln.Close()
+
+		conn := dialProxy(proxyServer)
+
+		req := test_util.NewRequest("GET", "unix-socket", "/", nil)
+		conn.WriteRequest(req)
+
+		resp, _ := conn.ReadResponse()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	})
+
 	It("responds transparently to a trailing slash versus no trailing slash", func() {
 		lnWithoutSlash := registerHandler(r, "test/my%20path/your_path", func(conn *test_util.HttpConn) {
 			conn.CheckLine("GET /my%20path/your_path/ HTTP/1.1")
@@ -713,6 +736,114 @@ var _ = Describe("Proxy", func() {
 		})
 	})
 
+	Context("when trusted proxy CIDRs are configured", func() {
+		BeforeEach(func() {
+			_, trusted, err := net.ParseCIDR("10.255.0.0/16")
+			Expect(err).NotTo(HaveOccurred())
+			conf.TrustedProxyNets = []*net.IPNet{trusted}
+		})
+
+		It("replaces the X-Forwarded headers of untrusted clients", func() {
+			done := make(chan http.Header)
+
+			ln := registerHandler(r, "app", func(conn *test_util.HttpConn) {
+				req, err := http.ReadRequest(conn.Reader)
+				Expect(err).NotTo(HaveOccurred())
+
+				resp := test_util.NewResponse(http.StatusOK)
+				conn.WriteResponse(resp)
+				conn.Close()
+
+				done <- req.Header
+			})
+			defer ln.Close()
+
+			conn := dialProxy(proxyServer)
+
+			req := test_util.NewRequest("GET", "app", "/", nil)
+			req.Header.Set("X-Forwarded-For", "1.2.3.4")
+			req.Header.Set("X-Forwarded-Proto", "https")
+			conn.WriteRequest(req)
+
+			var header http.Header
+			Eventually(done).Should(Receive(&header))
+			Expect(header.Get("X-Forwarded-For")).To(Equal("127.0.0.1"))
+			Expect(header.Get("X-Forwarded-Proto")).To(Equal("http"))
+
+			conn.ReadResponse()
+		})
+	})
+
+	Context("when keep-alives to backends are enabled", func() {
+		BeforeEach(func() {
+			conf.DisableKeepAlives = false
+		})
+
+		It("reuses connections to the endpoint", func() {
+			var conns int32
+
+			ln := registerHandler(r, "app", func(conn *test_util.HttpConn) {
+				atomic.AddInt32(&conns, 1)
+				defer conn.Close()
+				for {
+					_, err := http.ReadRequest(conn.Reader)
+					if err != nil {
+						return
+					}
+					conn.WriteResponse(test_util.NewResponse(http.StatusOK))
+				}
+			})
+			defer ln.Close()
+
+			for i := 0; i < 3; i++ {
+				conn := dialProxy(proxyServer)
+				conn.WriteRequest(test_util.NewRequest("GET", "app", "/", nil))
+				resp, _ := conn.ReadResponse()
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+				conn.Close()
+			}
+
+			Expect(atomic.LoadInt32(&conns)).To(Equal(int32(1)))
+		})
+	})
+
+	Context("when a backend PROXY protocol version is configured", func() {
+		BeforeEach(func() {
+			conf.Backends.ProxyProtocolVersion = 1
+		})
+
+		It("sends the addresses of the client connection before the request", func() {
+			done := make(chan string)
+
+			ln := registerHandler(r, "app", func(conn *test_util.HttpConn) {
+				header, err := conn.Reader.ReadString('\n')
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = http.ReadRequest(conn.Reader)
+				Expect(err).NotTo(HaveOccurred())
+
+				resp := test_util.NewResponse(http.StatusOK)
+				conn.WriteResponse(resp)
+				conn.Close()
+
+				done <- header
+			})
+			defer ln.Close()
+
+			conn := dialProxy(proxyServer)
+
+			req := test_util.NewRequest("GET", "app", "/", nil)
+			conn.WriteRequest(req)
+
+			var header string
+			Eventually(done).Should(Receive(&header))
+			Expect(header).To(MatchRegexp(`^PROXY TCP4 127\.0\.0\.1 127\.0\.0\.1 \d+ \d+\r\n$`))
+
+			resp, _ := conn.ReadResponse()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		})
+	})
+
 	It("emits HTTP startstop events", func() {
 		done := make(chan struct{})
 		var vcapHeader string
@@ -1074,6 +1205,105 @@ var _ = Describe("Proxy", func() {
 				conn.Close()
 			})
 		})
+
+		Context("when the maximum number of connections are active", func() {
+			BeforeEach(func() {
+				conf.WebSockets.MaxConnections = 1
+			})
+
+			It("responds with 503 until a connection is closed", func() {
+				ln := registerHandler(r, "ws", func(conn *test_util.HttpConn) {
+					_, err := http.ReadRequest(conn.Reader)
+					Expect(err).NotTo(HaveOccurred())
+
+					resp := test_util.NewResponse(http.StatusSwitchingProtocols)
+					resp.Header.Set("Upgrade", "Websocket")
+					resp.Header.Set("Connection", "Upgrade")
+					conn.WriteResponse(resp)
+
+					conn.CheckLine("bye")
+					conn.Close()
+				})
+				defer ln.Close()
+
+				upgrade := func() (*test_util.HttpConn, *http.Response) {
+					conn := dialProxy(proxyServer)
+					req := test_util.NewRequest("GET", "ws", "/chat", nil)
+					req.Header.Set("Upgrade", "Websocket")
+					req.Header.Set("Connection", "Upgrade")
+					conn.WriteRequest(req)
+
+					resp, err := http.ReadResponse(conn.Reader, &http.Request{})
+					Expect(err).NotTo(HaveOccurred())
+					return conn, resp
+				}
+
+				conn, resp := upgrade()
+				Expect(resp.StatusCode).To(Equal(http.StatusSwitchingProtocols))
+				Expect(fakeReporter.CaptureWebSocketConnectionsArgsForCall(0)).To(Equal(1))
+
+				rejected, resp := upgrade()
+				Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+				Expect(resp.Header.Get("X-Cf-RouterError")).To(Equal("websocket_limit"))
+				Expect(fakeReporter.CaptureWebSocketFailureCallCount()).To(Equal(1))
+				rejected.Close()
+
+				conn.WriteLine("bye")
+				Eventually(func() int {
+					count := fakeReporter.CaptureWebSocketConnectionsCallCount()
+					return fakeReporter.CaptureWebSocketConnectionsArgsForCall(count - 1)
+				}).Should(Equal(0))
+				conn.Close()
+
+				conn, resp = upgrade()
+				Expect(resp.StatusCode).To(Equal(http.StatusSwitchingProtocols))
+				conn.WriteLine("bye")
+				conn.Close()
+			})
+		})
+
+		Context("when the connection is idle for the idle timeout", func() {
+			BeforeEach(func() {
+				conf.WebSockets.IdleTimeout = 100 * time.Millisecond
+			})
+
+			It("closes the connection", func() {
+				closed := make(chan struct{})
+				ln := registerHandler(r, "ws", func(conn *test_util.HttpConn) {
+					_, err := http.ReadRequest(conn.Reader)
+					Expect(err).NotTo(HaveOccurred())
+
+					resp := test_util.NewResponse(http.StatusSwitchingProtocols)
+					resp.Header.Set("Upgrade", "Websocket")
+					resp.Header.Set("Connection", "Upgrade")
+					conn.WriteResponse(resp)
+
+					conn.CheckLine("hello from client")
+					conn.WriteLine("hello from server")
+
+					_, err = conn.Reader.ReadString('\n')
+					Expect(err).To(HaveOccurred())
+					close(closed)
+				})
+				defer ln.Close()
+
+				conn := dialProxy(proxyServer)
+				req := test_util.NewRequest("GET", "ws", "/chat", nil)
+				req.Header.Set("Upgrade", "Websocket")
+				req.Header.Set("Connection", "Upgrade")
+				conn.WriteRequest(req)
+
+				resp, err := http.ReadResponse(conn.Reader, &http.Request{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusSwitchingProtocols))
+
+				conn.WriteLine("hello from client")
+				conn.CheckLine("hello from server")
+
+				Eventually(closed).Should(BeClosed())
+				conn.Close()
+			})
+		})
 	})
 
 	Context("when the request is a TCP Upgrade", func() {
@@ -1327,106 +1557,562 @@ var _ = Describe("Proxy", func() {
 		Expect(time.Since(started)).To(BeNumerically("<", time.Duration(800*time.Millisecond)))
 	})
 
-	It("proxy closes connections with slow apps", func() {
-		serverResult := make(chan error)
-		ln := registerHandler(r, "slow-app", func(conn *test_util.HttpConn) {
-			conn.CheckLine("GET / HTTP/1.1")
+	Context("when the route strips its context path", func() {
+		var requestURIs chan string
 
-			timesToTick := 2
-			time.Sleep(1 * time.Second)
+		BeforeEach(func() {
+			requestURIs = make(chan string, 1)
+		})
 
-			conn.WriteLines([]string{
-				"HTTP/1.1 200 OK",
-				fmt.Sprintf("Content-Length: %d", timesToTick),
+		JustBeforeEach(func() {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+
+			go runBackendInstance(ln, func(conn *test_util.HttpConn) {
+				req, err := http.ReadRequest(conn.Reader)
+				Expect(err).NotTo(HaveOccurred())
+				requestURIs <- req.RequestURI
+
+				conn.WriteResponse(test_util.NewResponse(http.StatusOK))
+				conn.Close()
 			})
 
-			for i := 0; i < timesToTick; i++ {
-				_, err := conn.Conn.Write([]byte("x"))
-				if err != nil {
-					serverResult <- err
-					return
-				}
+			host, portStr, err := net.SplitHostPort(ln.Addr().String())
+			Expect(err).NotTo(HaveOccurred())
+			port, err := strconv.Atoi(portStr)
+			Expect(err).NotTo(HaveOccurred())
 
-				time.Sleep(100 * time.Millisecond)
-			}
+			endpoint := route.NewEndpoint("", host, uint16(port), "", "2", nil, -1, "", models.ModificationTag{}, "")
+			endpoint.StripPathPrefix = true
+			r.Register(route.Uri("strip-app/api/v2"), endpoint)
+		})
 
-			serverResult <- nil
+		It("proxies requests without the context path", func() {
+			conn := dialProxy(proxyServer)
+			conn.WriteRequest(test_util.NewRequest("GET", "strip-app", "/API/v2/users%2Fme?q=1", nil))
+
+			resp, _ := readResponse(conn)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(<-requestURIs).To(Equal("/users%2Fme?q=1"))
 		})
-		defer ln.Close()
 
-		conn := dialProxy(proxyServer)
+		It("strips context paths with wildcard segments", func() {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
 
-		req := test_util.NewRequest("GET", "slow-app", "/", nil)
+			go runBackendInstance(ln, func(conn *test_util.HttpConn) {
+				req, err := http.ReadRequest(conn.Reader)
+				Expect(err).NotTo(HaveOccurred())
+				requestURIs <- req.RequestURI
 
-		started := time.Now()
-		conn.WriteRequest(req)
+				conn.WriteResponse(test_util.NewResponse(http.StatusOK))
+				conn.Close()
+			})
 
-		resp, _ := readResponse(conn)
+			host, portStr, err := net.SplitHostPort(ln.Addr().String())
+			Expect(err).NotTo(HaveOccurred())
+			port, err := strconv.Atoi(portStr)
+			Expect(err).NotTo(HaveOccurred())
 
-		Expect(resp.StatusCode).To(Equal(http.StatusBadGateway))
-		Expect(time.Since(started)).To(BeNumerically("<", time.Duration(800*time.Millisecond)))
+			endpoint := route.NewEndpoint("", host, uint16(port), "", "2", nil, -1, "", models.ModificationTag{}, "")
+			endpoint.StripPathPrefix = true
+			r.Register(route.Uri("strip-app/users/*/avatar"), endpoint)
 
-		var err error
-		Eventually(serverResult).Should(Receive(&err))
-		Expect(err).NotTo(BeNil())
+			conn := dialProxy(proxyServer)
+			conn.WriteRequest(test_util.NewRequest("GET", "strip-app", "/users/42/avatar/large.png", nil))
+
+			resp, _ := readResponse(conn)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(<-requestURIs).To(Equal("/large.png"))
+		})
+
+		It("proxies requests for the context path to the root path", func() {
+			conn := dialProxy(proxyServer)
+			conn.WriteRequest(test_util.NewRequest("GET", "strip-app", "/api/v2?q=1", nil))
+
+			resp, _ := readResponse(conn)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(<-requestURIs).To(Equal("/?q=1"))
+		})
 	})
 
-	It("proxy detects closed client connection", func() {
-		serverResult := make(chan error)
-		readRequest := make(chan struct{})
-		ln := registerHandler(r, "slow-app", func(conn *test_util.HttpConn) {
-			conn.CheckLine("GET / HTTP/1.1")
+	Context("when the route has traffic rules", func() {
+		var stableLn, canaryLn net.Listener
 
-			readRequest <- struct{}{}
+		registerGroup := func(group string) net.Listener {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
 
-			timesToTick := 10
+			go runBackendInstance(ln, func(conn *test_util.HttpConn) {
+				_, err := http.ReadRequest(conn.Reader)
+				Expect(err).NotTo(HaveOccurred())
 
-			conn.WriteLines([]string{
-				"HTTP/1.1 200 OK",
-				fmt.Sprintf("Content-Length: %d", timesToTick),
+				resp := test_util.NewResponse(http.StatusOK)
+				resp.Header.Set("X-Backend", group)
+				conn.WriteResponse(resp)
+				conn.Close()
 			})
 
-			for i := 0; i < timesToTick; i++ {
-				_, err := conn.Conn.Write([]byte("x"))
-				if err != nil {
-					serverResult <- err
-					return
-				}
+			host, portStr, err := net.SplitHostPort(ln.Addr().String())
+			Expect(err).NotTo(HaveOccurred())
+			port, err := strconv.Atoi(portStr)
+			Expect(err).NotTo(HaveOccurred())
 
-				time.Sleep(100 * time.Millisecond)
+			endpoint := route.NewEndpoint("", host, uint16(port), "", "2", nil, -1, "", models.ModificationTag{}, "")
+			endpoint.Group = group
+			endpoint.TrafficRules = []route.TrafficRule{
+				{Group: "canary", Header: &route.TrafficMatch{Name: "X-Canary", Value: "true"}},
 			}
+			r.Register(route.Uri("split-app"), endpoint)
+			return ln
+		}
 
-			serverResult <- nil
+		JustBeforeEach(func() {
+			stableLn = registerGroup("")
+			canaryLn = registerGroup("canary")
 		})
-		defer ln.Close()
 
-		conn := dialProxy(proxyServer)
+		AfterEach(func() {
+			stableLn.Close()
+			canaryLn.Close()
+		})
 
-		req := test_util.NewRequest("GET", "slow-app", "/", nil)
+		It("routes requests that match a rule to the group of the rule", func() {
+			for i := 0; i < 4; i++ {
+				conn := dialProxy(proxyServer)
+				req := test_util.NewRequest("GET", "split-app", "/", nil)
+				req.Header.Set("X-Canary", "true")
+				conn.WriteRequest(req)
 
-		conn.WriteRequest(req)
-		Eventually(readRequest).Should(Receive())
-		conn.Conn.Close()
+				resp, _ := readResponse(conn)
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+				Expect(resp.Header.Get("X-Backend")).To(Equal("canary"))
+			}
+		})
 
-		var err error
-		Eventually(serverResult).Should(Receive(&err))
-		Expect(err).NotTo(BeNil())
+		It("routes other requests to the endpoints without a group", func() {
+			for i := 0; i < 4; i++ {
+				conn := dialProxy(proxyServer)
+				conn.WriteRequest(test_util.NewRequest("GET", "split-app", "/", nil))
+
+				resp, _ := readResponse(conn)
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+				Expect(resp.Header.Get("X-Backend")).To(BeEmpty())
+			}
+		})
 	})
 
-	It("proxy closes connections to backends when client closes the connection", func() {
-		serverResult := make(chan error)
-		readRequest := make(chan struct{})
-		ln := registerHandler(r, "slow-app", func(conn *test_util.HttpConn) {
-			conn.CheckLine("GET / HTTP/1.1")
+	Context("when header rewrite rules are configured", func() {
+		BeforeEach(func() {
+			conf.HeaderRewrites = config.HeaderRewriteConfig{
+				Response: config.HeaderRules{
+					Set:    []config.HeaderValue{{Name: "Strict-Transport-Security", Value: "max-age=31536000"}},
+					Remove: []string{"X-Powered-By"},
+				},
+			}
+		})
 
-			readRequest <- struct{}{}
+		It("applies the response rules of the router and of the route", func() {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			defer ln.Close()
 
-			time.Sleep(600 * time.Millisecond)
+			go runBackendInstance(ln, func(conn *test_util.HttpConn) {
+				_, err := http.ReadRequest(conn.Reader)
+				Expect(err).NotTo(HaveOccurred())
 
-			for i := 0; i < 2; i++ {
-				_, err := conn.Conn.Write([]byte("x"))
-				if err != nil {
-					serverResult <- err
+				resp := test_util.NewResponse(http.StatusOK)
+				resp.Header.Set("X-Powered-By", "app-server")
+				resp.Header.Set("X-Debug", "true")
+				conn.WriteResponse(resp)
+				conn.Close()
+			})
+
+			host, portStr, err := net.SplitHostPort(ln.Addr().String())
+			Expect(err).NotTo(HaveOccurred())
+			port, err := strconv.Atoi(portStr)
+			Expect(err).NotTo(HaveOccurred())
+
+			endpoint := route.NewEndpoint("", host, uint16(port), "", "2", nil, -1, "", models.ModificationTag{}, "")
+			endpoint.HeaderRewrites = &config.HeaderRewriteConfig{
+				Response: config.HeaderRules{Remove: []string{"X-Debug"}},
+			}
+			r.Register(route.Uri("rewrite-app"), endpoint)
+
+			conn := dialProxy(proxyServer)
+			conn.WriteRequest(test_util.NewRequest("GET", "rewrite-app", "/", nil))
+
+			resp, _ := readResponse(conn)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get("Strict-Transport-Security")).To(Equal("max-age=31536000"))
+			Expect(resp.Header).ToNot(HaveKey("X-Powered-By"))
+			Expect(resp.Header).ToNot(HaveKey("X-Debug"))
+		})
+	})
+
+	Context("when error pages are configured", func() {
+		BeforeEach(func() {
+			conf.ErrorPages = []config.ErrorPageConfig{{
+				Status: http.StatusNotFound,
+				HTML:   "<p>{{.Message}}</p><p>Request {{.RequestID}}</p>",
+				JSON:   `{"error":{{.Error}},"request_id":{{.RequestID}}}`,
+			}}
+		})
+
+		It("renders errors of unknown routes with the template accepted by the request", func() {
+			req := test_util.NewRequest("GET", "unknown", "/", nil)
+			req.Header.Set("Accept", "text/html")
+			recorder := httptest.NewRecorder()
+			p.ServeHTTP(recorder, req)
+
+			Expect(recorder.Code).To(Equal(http.StatusNotFound))
+			Expect(recorder.Header().Get("Content-Type")).To(Equal("text/html; charset=utf-8"))
+			Expect(recorder.Header().Get("X-Cf-RouterError")).To(Equal("unknown_route"))
+			Expect(recorder.Body.String()).To(MatchRegexp(
+				`^<p>404 Not Found: Requested route \(&#39;unknown&#39;\) does not exist.</p><p>Request [0-9a-f-]{36}</p>$`,
+			))
+
+			req.Header.Set("Accept", "application/json")
+			recorder = httptest.NewRecorder()
+			p.ServeHTTP(recorder, req)
+
+			Expect(recorder.Code).To(Equal(http.StatusNotFound))
+			Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json"))
+			Expect(recorder.Body.String()).To(MatchRegexp(`^\{"error":"unknown_route","request_id":"[0-9a-f-]{36}"\}$`))
+		})
+	})
+
+	Context("when security headers are configured", func() {
+		BeforeEach(func() {
+			conf.SecurityHeaders = config.SecurityHeadersConfig{
+				StrictTransportSecurity: config.StrictTransportSecurityConfig{
+					Enabled:           true,
+					MaxAge:            time.Hour,
+					IncludeSubDomains: true,
+				},
+				ContentTypeOptions: true,
+				FrameOptions:       "DENY",
+			}
+		})
+
+		var serve = func(req *http.Request) *httptest.ResponseRecorder {
+			ln := registerHandler(r, "secure-app", func(conn *test_util.HttpConn) {
+				_, err := http.ReadRequest(conn.Reader)
+				Expect(err).NotTo(HaveOccurred())
+
+				resp := test_util.NewResponse(http.StatusOK)
+				resp.Header.Set("X-Frame-Options", "SAMEORIGIN")
+				conn.WriteResponse(resp)
+				conn.Close()
+			})
+			defer ln.Close()
+
+			recorder := httptest.NewRecorder()
+			p.ServeHTTP(recorder, req)
+			return recorder
+		}
+
+		It("adds them to responses to requests received over TLS", func() {
+			req := test_util.NewRequest("GET", "secure-app", "/", nil)
+			req.TLS = &tls.ConnectionState{}
+
+			recorder := serve(req)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("Strict-Transport-Security")).To(Equal("max-age=3600; includeSubDomains"))
+			Expect(recorder.Header().Get("X-Content-Type-Options")).To(Equal("nosniff"))
+			Expect(recorder.Header()["X-Frame-Options"]).To(Equal([]string{"DENY"}))
+		})
+
+		It("does not add them to responses to plain HTTP requests", func() {
+			recorder := serve(test_util.NewRequest("GET", "secure-app", "/", nil))
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header()).ToNot(HaveKey("Strict-Transport-Security"))
+			Expect(recorder.Header()["X-Frame-Options"]).To(Equal([]string{"SAMEORIGIN"}))
+		})
+	})
+
+	Context("when the endpoint has a timeout", func() {
+		slowHandler := func(conn *test_util.HttpConn) {
+			_, err := http.ReadRequest(conn.Reader)
+			Expect(err).NotTo(HaveOccurred())
+
+			time.Sleep(700 * time.Millisecond)
+			resp := test_util.NewResponse(http.StatusOK)
+			conn.WriteResponse(resp)
+			conn.Close()
+		}
+
+		It("uses the endpoint's timeout when it is longer than the endpoint_timeout", func() {
+			ln := registerHandlerWithTimeout(r, "slow-app", 2*time.Second, slowHandler)
+			defer ln.Close()
+
+			conn := dialProxy(proxyServer)
+			conn.WriteRequest(test_util.NewRequest("GET", "slow-app", "/", nil))
+
+			resp, _ := readResponse(conn)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		})
+
+		It("uses the endpoint's timeout when it is shorter than the endpoint_timeout", func() {
+			ln := registerHandlerWithTimeout(r, "slow-app", 100*time.Millisecond, slowHandler)
+			defer ln.Close()
+
+			conn := dialProxy(proxyServer)
+
+			started := time.Now()
+			conn.WriteRequest(test_util.NewRequest("GET", "slow-app", "/", nil))
+
+			resp, _ := readResponse(conn)
+			Expect(resp.StatusCode).To(Equal(http.StatusBadGateway))
+			Expect(time.Since(started)).To(BeNumerically("<", 400*time.Millisecond))
+		})
+	})
+
+	Context("when the request expects 100 Continue", func() {
+		writeExpectContinueRequest := func(conn *test_util.HttpConn) {
+			conn.WriteLines([]string{
+				"POST / HTTP/1.1",
+				"Host: upload",
+				"Content-Length: 4",
+				"Expect: 100-continue",
+			})
+		}
+
+		It("forwards the header and does not send the body of rejected requests", func() {
+			ln := registerHandler(r, "upload", func(conn *test_util.HttpConn) {
+				req, err := http.ReadRequest(conn.Reader)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(req.Header.Get("Expect")).To(Equal("100-continue"))
+
+				resp := test_util.NewResponse(http.StatusExpectationFailed)
+				resp.Close = true
+				conn.WriteResponse(resp)
+				conn.Close()
+			})
+			defer ln.Close()
+
+			conn := dialProxy(proxyServer)
+			writeExpectContinueRequest(conn)
+
+			resp, _ := conn.ReadResponse()
+			Expect(resp.StatusCode).To(Equal(http.StatusExpectationFailed))
+		})
+
+		It("tells the client to continue when the endpoint does", func() {
+			ln := registerHandler(r, "upload", func(conn *test_util.HttpConn) {
+				req, err := http.ReadRequest(conn.Reader)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(req.Header.Get("Expect")).To(Equal("100-continue"))
+
+				conn.WriteLines([]string{"HTTP/1.1 100 Continue"})
+				body, err := ioutil.ReadAll(req.Body)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(body)).To(Equal("data"))
+
+				conn.WriteResponse(test_util.NewResponse(http.StatusOK))
+				conn.Close()
+			})
+			defer ln.Close()
+
+			conn := dialProxy(proxyServer)
+			writeExpectContinueRequest(conn)
+
+			conn.CheckLine("HTTP/1.1 100 Continue")
+			conn.CheckLine("")
+			_, err := conn.Conn.Write([]byte("data"))
+			Expect(err).NotTo(HaveOccurred())
+
+			resp, _ := conn.ReadResponse()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		})
+
+		Context("when expect continue is answered locally", func() {
+			BeforeEach(func() {
+				conf.ExpectContinue.Mode = config.EXPECT_CONTINUE_LOCAL
+			})
+
+			It("tells the client to continue and sends the request without the header", func() {
+				ln := registerHandler(r, "upload", func(conn *test_util.HttpConn) {
+					req, body := conn.ReadRequest()
+					Expect(req.Header.Get("Expect")).To(BeEmpty())
+					Expect(body).To(Equal("data"))
+
+					conn.WriteResponse(test_util.NewResponse(http.StatusOK))
+					conn.Close()
+				})
+				defer ln.Close()
+
+				conn := dialProxy(proxyServer)
+				writeExpectContinueRequest(conn)
+
+				conn.CheckLine("HTTP/1.1 100 Continue")
+				conn.CheckLine("")
+				_, err := conn.Conn.Write([]byte("data"))
+				Expect(err).NotTo(HaveOccurred())
+
+				resp, _ := conn.ReadResponse()
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			})
+		})
+	})
+
+	Context("when long-lived requests are enabled", func() {
+		var ln net.Listener
+
+		BeforeEach(func() {
+			conf.LongLivedRequests = config.LongLivedRequestConfig{
+				Enabled: true,
+				Headers: []string{"X-Long-Poll"},
+			}
+		})
+
+		JustBeforeEach(func() {
+			ln = registerHandler(r, "slow-app", func(conn *test_util.HttpConn) {
+				_, err := http.ReadRequest(conn.Reader)
+				Expect(err).NotTo(HaveOccurred())
+
+				time.Sleep(700 * time.Millisecond)
+				resp := test_util.NewResponse(http.StatusOK)
+				conn.WriteResponse(resp)
+				conn.Close()
+			})
+		})
+
+		AfterEach(func() {
+			ln.Close()
+		})
+
+		It("does not time out server-sent event requests after the endpoint_timeout", func() {
+			req := test_util.NewRequest("GET", "slow-app", "/", nil)
+			req.Header.Set("Accept", "text/event-stream")
+
+			conn := dialProxy(proxyServer)
+			conn.WriteRequest(req)
+
+			resp, _ := readResponse(conn)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		})
+
+		It("does not time out long-poll requests after the endpoint_timeout", func() {
+			req := test_util.NewRequest("GET", "slow-app", "/", nil)
+			req.Header.Set("X-Long-Poll", "true")
+
+			conn := dialProxy(proxyServer)
+			conn.WriteRequest(req)
+
+			resp, _ := readResponse(conn)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		})
+
+		It("times out other requests after the endpoint_timeout", func() {
+			conn := dialProxy(proxyServer)
+			conn.WriteRequest(test_util.NewRequest("GET", "slow-app", "/", nil))
+
+			resp, _ := readResponse(conn)
+			Expect(resp.StatusCode).To(Equal(http.StatusBadGateway))
+		})
+	})
+
+	It("proxy closes connections with slow apps", func() {
+		serverResult := make(chan error)
+		ln := registerHandler(r, "slow-app", func(conn *test_util.HttpConn) {
+			conn.CheckLine("GET / HTTP/1.1")
+
+			timesToTick := 2
+			time.Sleep(1 * time.Second)
+
+			conn.WriteLines([]string{
+				"HTTP/1.1 200 OK",
+				fmt.Sprintf("Content-Length: %d", timesToTick),
+			})
+
+			for i := 0; i < timesToTick; i++ {
+				_, err := conn.Conn.Write([]byte("x"))
+				if err != nil {
+					serverResult <- err
+					return
+				}
+
+				time.Sleep(100 * time.Millisecond)
+			}
+
+			serverResult <- nil
+		})
+		defer ln.Close()
+
+		conn := dialProxy(proxyServer)
+
+		req := test_util.NewRequest("GET", "slow-app", "/", nil)
+
+		started := time.Now()
+		conn.WriteRequest(req)
+
+		resp, _ := readResponse(conn)
+
+		Expect(resp.StatusCode).To(Equal(http.StatusBadGateway))
+		Expect(time.Since(started)).To(BeNumerically("<", time.Duration(800*time.Millisecond)))
+
+		var err error
+		Eventually(serverResult).Should(Receive(&err))
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("proxy detects closed client connection", func() {
+		serverResult := make(chan error)
+		readRequest := make(chan struct{})
+		ln := registerHandler(r, "slow-app", func(conn *test_util.HttpConn) {
+			conn.CheckLine("GET / HTTP/1.1")
+
+			readRequest <- struct{}{}
+
+			timesToTick := 10
+
+			conn.WriteLines([]string{
+				"HTTP/1.1 200 OK",
+				fmt.Sprintf("Content-Length: %d", timesToTick),
+			})
+
+			for i := 0; i < timesToTick; i++ {
+				_, err := conn.Conn.Write([]byte("x"))
+				if err != nil {
+					serverResult <- err
+					return
+				}
+
+				time.Sleep(100 * time.Millisecond)
+			}
+
+			serverResult <- nil
+		})
+		defer ln.Close()
+
+		conn := dialProxy(proxyServer)
+
+		req := test_util.NewRequest("GET", "slow-app", "/", nil)
+
+		conn.WriteRequest(req)
+		Eventually(readRequest).Should(Receive())
+		conn.Conn.Close()
+
+		var err error
+		Eventually(serverResult).Should(Receive(&err))
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("proxy closes connections to backends when client closes the connection", func() {
+		serverResult := make(chan error)
+		readRequest := make(chan struct{})
+		ln := registerHandler(r, "slow-app", func(conn *test_util.HttpConn) {
+			conn.CheckLine("GET / HTTP/1.1")
+
+			readRequest <- struct{}{}
+
+			time.Sleep(600 * time.Millisecond)
+
+			for i := 0; i < 2; i++ {
+				_, err := conn.Conn.Write([]byte("x"))
+				if err != nil {
+					serverResult <- err
 					return
 				}
 
@@ -1674,6 +2360,185 @@ var _ = Describe("Proxy", func() {
 		})
 	})
 
+	Context("when the endpoint uses HTTP/2", func() {
+		var (
+			h2Listener net.Listener
+			client     *http.Client
+		)
+
+		BeforeEach(func() {
+			keyPEM, certPEM := test_util.CreateKeyPair("grpc")
+			cert, err := tls.X509KeyPair(certPEM, keyPEM)
+			Expect(err).ToNot(HaveOccurred())
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+
+			h2Listener = tls.NewListener(ln, &tls.Config{
+				Certificates: []tls.Certificate{cert},
+				NextProtos:   []string{"h2", "http/1.1"},
+			})
+
+			tr := &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			}
+			Expect(http2.ConfigureTransport(tr)).To(Succeed())
+			client = &http.Client{Transport: tr}
+		})
+
+		JustBeforeEach(func() {
+			server := &http.Server{Handler: p}
+			go server.Serve(h2Listener)
+		})
+
+		AfterEach(func() {
+			h2Listener.Close()
+		})
+
+		It("proxies gRPC requests end-to-end and propagates trailers", func() {
+			ln := registerH2CHandler(r, "grpc", func(w http.ResponseWriter, req *http.Request) {
+				defer GinkgoRecover()
+				Expect(req.ProtoMajor).To(Equal(2))
+				Expect(req.Header.Get("Te")).To(Equal("trailers"))
+
+				body, err := ioutil.ReadAll(req.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(body)).To(Equal("ping"))
+
+				w.Header().Set("Content-Type", "application/grpc")
+				w.Header().Set("Trailer", "Grpc-Status")
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte("pong"))
+				w.Header().Set("Grpc-Status", "0")
+			})
+			defer ln.Close()
+
+			req, err := http.NewRequest("POST", "https://"+h2Listener.Addr().String()+"/Greeter/SayHello", strings.NewReader("ping"))
+			Expect(err).ToNot(HaveOccurred())
+			req.Host = "grpc"
+			req.Header.Set("Content-Type", "application/grpc")
+			req.Header.Set("Te", "trailers")
+
+			resp, err := client.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+
+			Expect(resp.Proto).To(Equal("HTTP/2.0"))
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			body, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(Equal("pong"))
+			Expect(resp.Trailer.Get("Grpc-Status")).To(Equal("0"))
+		})
+
+		It("proxies to HTTP/1.1 endpoints over HTTP/1.1", func() {
+			ln := registerHandler(r, "http1-app", func(conn *test_util.HttpConn) {
+				conn.CheckLine("GET / HTTP/1.1")
+				resp := test_util.NewResponse(http.StatusOK)
+				conn.WriteResponse(resp)
+				conn.Close()
+			})
+			defer ln.Close()
+
+			req, err := http.NewRequest("GET", "https://"+h2Listener.Addr().String()+"/", nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.Host = "http1-app"
+
+			resp, err := client.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+
+			Expect(resp.Proto).To(Equal("HTTP/2.0"))
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		})
+	})
+
+	Context("when the endpoint uses TLS", func() {
+		var backendTLSConfig *tls.Config
+
+		BeforeEach(func() {
+			backendKeyPEM, backendCertPEM := test_util.CreateKeyPair("backend.example.com")
+			backendCert, err := tls.X509KeyPair(backendCertPEM, backendKeyPEM)
+			Expect(err).ToNot(HaveOccurred())
+			caCertPool = x509.NewCertPool()
+			Expect(caCertPool.AppendCertsFromPEM(backendCertPEM)).To(BeTrue())
+
+			clientKeyPEM, clientCertPEM := test_util.CreateKeyPair("gorouter")
+			conf.Backends.ClientAuthCertificate, err = tls.X509KeyPair(clientCertPEM, clientKeyPEM)
+			Expect(err).ToNot(HaveOccurred())
+			clientCertPool := x509.NewCertPool()
+			Expect(clientCertPool.AppendCertsFromPEM(clientCertPEM)).To(BeTrue())
+
+			backendTLSConfig = &tls.Config{
+				Certificates: []tls.Certificate{backendCert},
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+				ClientCAs:    clientCertPool,
+			}
+		})
+
+		It("presents the client certificate and verifies the endpoint's SAN", func() {
+			ln := registerTLSHandler(r, "tls-app", "backend.example.com", backendTLSConfig, func(conn *test_util.HttpConn) {
+				conn.CheckLine("GET / HTTP/1.1")
+				resp := test_util.NewResponse(http.StatusOK)
+				conn.WriteResponse(resp)
+				conn.Close()
+			})
+			defer ln.Close()
+
+			conn := dialProxy(proxyServer)
+			conn.WriteRequest(test_util.NewRequest("GET", "tls-app", "/", nil))
+
+			resp, _ := conn.ReadResponse()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		})
+
+		It("responds with a 502 BadGateway when the endpoint's certificate does not match the SAN", func() {
+			ln := registerTLSHandler(r, "tls-app", "other.example.com", backendTLSConfig, func(conn *test_util.HttpConn) {
+				conn.Close()
+			})
+			defer ln.Close()
+
+			conn := dialProxy(proxyServer)
+			conn.WriteRequest(test_util.NewRequest("GET", "tls-app", "/", nil))
+
+			resp, _ := conn.ReadResponse()
+			Expect(resp.StatusCode).To(Equal(http.StatusBadGateway))
+		})
+
+		Context("and HTTP/2", func() {
+			It("proxies over HTTP/2 and verifies the endpoint's SAN", func() {
+				ln := registerH2TLSHandler(r, "h2-app", "backend.example.com", backendTLSConfig, func(w http.ResponseWriter, req *http.Request) {
+					defer GinkgoRecover()
+					Expect(req.ProtoMajor).To(Equal(2))
+					Expect(req.TLS).ToNot(BeNil())
+					Expect(req.TLS.PeerCertificates).ToNot(BeEmpty())
+					w.WriteHeader(http.StatusOK)
+				})
+				defer ln.Close()
+
+				conn := dialProxy(proxyServer)
+				conn.WriteRequest(test_util.NewRequest("GET", "h2-app", "/", nil))
+
+				resp, _ := conn.ReadResponse()
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			})
+
+			It("responds with a 502 BadGateway when the endpoint's certificate does not match the SAN", func() {
+				ln := registerH2TLSHandler(r, "h2-app", "other.example.com", backendTLSConfig, func(w http.ResponseWriter, req *http.Request) {
+					w.WriteHeader(http.StatusOK)
+				})
+				defer ln.Close()
+
+				conn := dialProxy(proxyServer)
+				conn.WriteRequest(test_util.NewRequest("GET", "h2-app", "/", nil))
+
+				resp, _ := conn.ReadResponse()
+				Expect(resp.StatusCode).To(Equal(http.StatusBadGateway))
+			})
+		})
+	})
+
 	Context("when the endpoint is nil", func() {
 		removeAllEndpoints := func(pool *route.Pool) {
 			endpoints := make([]*route.Endpoint, 0)
@@ -1774,6 +2639,111 @@ func registerHandlerWithAppId(reg *registry.RouteRegistry, path string, routeSer
 	return ln
 }
 
+func registerUnixSocketHandler(reg *registry.RouteRegistry, path string, handler connHandler) net.Listener {
+	id, err := uuid.NewV4()
+	Expect(err).NotTo(HaveOccurred())
+	socket := filepath.Join(os.TempDir(), "gorouter-"+id.String()+".sock")
+
+	ln, err := net.Listen("unix", socket)
+	Expect(err).NotTo(HaveOccurred())
+
+	go runBackendInstance(ln, handler)
+
+	reg.Register(route.Uri(path), route.NewEndpoint("", route.UnixSocketPrefix+socket, 0, "", "2", nil, -1, "", models.ModificationTag{}, ""))
+
+	return ln
+}
+
+func registerHandlerWithTimeout(reg *registry.RouteRegistry, path string, timeout time.Duration, handler connHandler) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+
+	go runBackendInstance(ln, handler)
+
+	host, portStr, err := net.SplitHostPort(ln.Addr().String())
+	Expect(err).NotTo(HaveOccurred())
+	port, err := strconv.Atoi(portStr)
+	Expect(err).NotTo(HaveOccurred())
+
+	endpoint := route.NewEndpoint("", host, uint16(port), "", "2", nil, -1, "", models.ModificationTag{}, "")
+	endpoint.Timeout = timeout
+	reg.Register(route.Uri(path), endpoint)
+
+	return ln
+}
+
+func registerH2CHandler(reg *registry.RouteRegistry, path string, handler http.HandlerFunc) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+
+	go func() {
+		server := &http2.Server{}
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go server.ServeConn(conn, &http2.ServeConnOpts{Handler: handler})
+		}
+	}()
+
+	host, portStr, err := net.SplitHostPort(ln.Addr().String())
+	Expect(err).NotTo(HaveOccurred())
+	port, err := strconv.Atoi(portStr)
+	Expect(err).NotTo(HaveOccurred())
+
+	endpoint := route.NewEndpoint("", host, uint16(port), "", "2", nil, -1, "", models.ModificationTag{}, "")
+	endpoint.Protocol = route.ProtocolHTTP2
+	reg.Register(route.Uri(path), endpoint)
+
+	return ln
+}
+
+func registerTLSHandler(reg *registry.RouteRegistry, path string, serverCertDomainSAN string, tlsConfig *tls.Config, handler connHandler) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	ln = tls.NewListener(ln, tlsConfig)
+
+	go runBackendInstance(ln, handler)
+
+	host, portStr, err := net.SplitHostPort(ln.Addr().String())
+	Expect(err).NotTo(HaveOccurred())
+	port, err := strconv.Atoi(portStr)
+	Expect(err).NotTo(HaveOccurred())
+
+	endpoint := route.NewEndpoint("", host, uint16(port), "", "2", nil, -1, "", models.ModificationTag{}, "")
+	endpoint.UseTLS = true
+	endpoint.ServerCertDomainSAN = serverCertDomainSAN
+	reg.Register(route.Uri(path), endpoint)
+
+	return ln
+}
+
+func registerH2TLSHandler(reg *registry.RouteRegistry, path string, serverCertDomainSAN string, tlsConfig *tls.Config, handler http.HandlerFunc) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	h2TLSConfig := tlsConfig.Clone()
+	h2TLSConfig.NextProtos = []string{"h2"}
+	ln = tls.NewListener(ln, h2TLSConfig)
+
+	server := &http.Server{Handler: handler}
+	Expect(http2.ConfigureServer(server, nil)).To(Succeed())
+	go server.Serve(ln)
+
+	host, portStr, err := net.SplitHostPort(ln.Addr().String())
+	Expect(err).NotTo(HaveOccurred())
+	port, err := strconv.Atoi(portStr)
+	Expect(err).NotTo(HaveOccurred())
+
+	endpoint := route.NewEndpoint("", host, uint16(port), "", "2", nil, -1, "", models.ModificationTag{}, "")
+	endpoint.Protocol = route.ProtocolHTTP2
+	endpoint.UseTLS = true
+	endpoint.ServerCertDomainSAN = serverCertDomainSAN
+	reg.Register(route.Uri(path), endpoint)
+
+	return ln
+}
+
 func runBackendInstance(ln net.Listener, handler connHandler) {
 	var tempDelay time.Duration // how long to sleep on accept failure
 	for {
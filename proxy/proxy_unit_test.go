@@ -59,7 +59,7 @@ var _ = Describe("Proxy Unit tests", func() {
 
 			conf.HealthCheckUserAgent = "HTTP-Monitor/1.1"
 			proxyObj = proxy.NewProxy(logger, fakeAccessLogger, conf, r, combinedReporter,
-				routeServiceConfig, tlsConfig, nil)
+				routeServiceConfig, tlsConfig, nil, nil, nil, nil, nil, nil, nil)
 
 			r.Register(route.Uri("some-app"), &route.Endpoint{})
 
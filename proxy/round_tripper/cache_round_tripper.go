@@ -0,0 +1,448 @@
+package round_tripper
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/handlers"
+)
+
+// cacheableStatus lists the status codes of responses that are cached.
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+// NewCacheRoundTripper caches the responses of p to GET requests for routes
+// registered with cache_responses, and answers GET and HEAD requests from
+// the cache while the responses are fresh. Stale responses with an ETag or
+// Last-Modified header are revalidated with the endpoint.
+func NewCacheRoundTripper(p ProxyRoundTripper, cfg config.ResponseCacheConfig, clock clock.Clock) ProxyRoundTripper {
+	return &cacheRoundTripper{
+		p:     p,
+		clock: clock,
+		cache: newResponseCache(cfg.MaxSizeBytes, cfg.MaxEntrySizeBytes),
+	}
+}
+
+type cacheRoundTripper struct {
+	p     ProxyRoundTripper
+	clock clock.Clock
+	cache *responseCache
+}
+
+func (c *cacheRoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	reqInfo, err := handlers.ContextRequestInfo(request)
+	if err != nil || reqInfo.RoutePool == nil || reqInfo.RouteServiceURL != nil || !reqInfo.RoutePool.CacheResponses() {
+		return c.p.RoundTrip(request)
+	}
+
+	key := cacheKey(request)
+	if request.Method != "GET" && request.Method != "HEAD" {
+		res, err := c.p.RoundTrip(request)
+		// unsafe requests invalidate the cached response of their URI
+		if err == nil && res.StatusCode < http.StatusBadRequest {
+			c.cache.remove(key)
+		}
+		return res, err
+	}
+
+	requestCacheControl := parseCacheControl(request.Header)
+	_, noStore := requestCacheControl["no-store"]
+	if noStore || request.Header.Get("Authorization") != "" {
+		return c.p.RoundTrip(request)
+	}
+
+	now := c.clock.Now()
+	entry := c.cache.get(key, request)
+	if entry != nil && entry.fresh(now, requestCacheControl) {
+		return entry.response(request, now), nil
+	}
+
+	// stale responses are revalidated, unless the client sent conditions of
+	// its own
+	outRequest := request
+	revalidating := false
+	if entry != nil && request.Header.Get("If-None-Match") == "" && request.Header.Get("If-Modified-Since") == "" {
+		etag, lastModified := entry.header.Get("ETag"), entry.header.Get("Last-Modified")
+		if etag != "" || lastModified != "" {
+			outRequest = new(http.Request)
+			*outRequest = *request
+			outRequest.Header = cloneHeader(request.Header)
+			if etag != "" {
+				outRequest.Header.Set("If-None-Match", etag)
+			}
+			if lastModified != "" {
+				outRequest.Header.Set("If-Modified-Since", lastModified)
+			}
+			revalidating = true
+		}
+	}
+
+	res, err := c.p.RoundTrip(outRequest)
+	if err != nil {
+		return res, err
+	}
+	if revalidating && res.StatusCode == http.StatusNotModified {
+		res.Body.Close()
+		entry = entry.revalidated(res, c.clock.Now())
+		c.cache.put(key, entry)
+		return entry.response(request, c.clock.Now()), nil
+	}
+
+	if request.Method == "GET" && c.storable(res) {
+		// the headers are copied now, as the proxy rewrites them before the
+		// body is read
+		status, header := res.StatusCode, cloneHeader(res.Header)
+		res.Body = &cachingBody{
+			ReadCloser: res.Body,
+			limit:      c.cache.maxEntrySize,
+			store: func(body []byte) {
+				c.cache.put(key, newCacheEntry(request, status, header, body, now))
+			},
+		}
+	}
+	return res, nil
+}
+
+func (c *cacheRoundTripper) CancelRequest(request *http.Request) {
+	c.p.CancelRequest(request)
+}
+
+func (c *cacheRoundTripper) storable(res *http.Response) bool {
+	if !cacheableStatus[res.StatusCode] || res.Header.Get("Set-Cookie") != "" {
+		return false
+	}
+	if res.ContentLength > c.cache.maxEntrySize {
+		return false
+	}
+	for _, v := range res.Header["Vary"] {
+		if strings.Contains(v, "*") {
+			return false
+		}
+	}
+
+	cacheControl := parseCacheControl(res.Header)
+	for _, directive := range []string{"no-store", "private"} {
+		if _, ok := cacheControl[directive]; ok {
+			return false
+		}
+	}
+	return freshnessLifetime(res.Header, cacheControl) > 0 ||
+		res.Header.Get("ETag") != "" || res.Header.Get("Last-Modified") != ""
+}
+
+func cacheKey(request *http.Request) string {
+	return strings.ToLower(request.Host) + request.URL.RequestURI()
+}
+
+// cachingBody stores the body once it has been read completely, unless it
+// is larger than limit.
+type cachingBody struct {
+	io.ReadCloser
+	limit     int64
+	store     func([]byte)
+	buf       bytes.Buffer
+	discarded bool
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if !b.discarded {
+		if int64(b.buf.Len()+n) > b.limit {
+			b.discarded = true
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF && !b.discarded {
+		b.discarded = true
+		b.store(b.buf.Bytes())
+	}
+	return n, err
+}
+
+type cacheEntry struct {
+	status int
+	header http.Header
+	body   []byte
+	// vary holds the values of the request headers the response varies by
+	vary map[string]string
+
+	stored   time.Time
+	age      time.Duration
+	lifetime time.Duration
+	noCache  bool
+}
+
+func newCacheEntry(request *http.Request, status int, header http.Header, body []byte, now time.Time) *cacheEntry {
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	vary := map[string]string{}
+	for _, v := range header["Vary"] {
+		for _, name := range strings.Split(v, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			vary[name] = strings.Join(request.Header[name], ",")
+		}
+	}
+
+	e := &cacheEntry{
+		status: status,
+		header: header,
+		body:   body,
+		vary:   vary,
+		stored: now,
+	}
+	e.setFreshness()
+	return e
+}
+
+func (e *cacheEntry) setFreshness() {
+	cacheControl := parseCacheControl(e.header)
+	e.lifetime = freshnessLifetime(e.header, cacheControl)
+	_, e.noCache = cacheControl["no-cache"]
+	e.age = 0
+	if age, err := strconv.Atoi(e.header.Get("Age")); err == nil && age > 0 {
+		e.age = time.Duration(age) * time.Second
+	}
+	e.header.Del("Age")
+}
+
+// revalidated returns a copy of the entry with the headers of a 304 Not
+// Modified response to its revalidation.
+func (e *cacheEntry) revalidated(res *http.Response, now time.Time) *cacheEntry {
+	updated := *e
+	updated.header = cloneHeader(e.header)
+	for name, values := range res.Header {
+		if name != "Content-Length" {
+			updated.header[name] = values
+		}
+	}
+	updated.stored = now
+	updated.setFreshness()
+	return &updated
+}
+
+func (e *cacheEntry) currentAge(now time.Time) time.Duration {
+	return e.age + now.Sub(e.stored)
+}
+
+func (e *cacheEntry) fresh(now time.Time, requestCacheControl map[string]string) bool {
+	if e.noCache {
+		return false
+	}
+	if _, ok := requestCacheControl["no-cache"]; ok {
+		return false
+	}
+	age := e.currentAge(now)
+	if maxAge, ok := requestCacheControl["max-age"]; ok {
+		if seconds, err := strconv.Atoi(maxAge); err == nil && age > time.Duration(seconds)*time.Second {
+			return false
+		}
+	}
+	return age < e.lifetime
+}
+
+func (e *cacheEntry) matches(request *http.Request) bool {
+	for name, value := range e.vary {
+		if strings.Join(request.Header[name], ",") != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *cacheEntry) size() int64 {
+	size := int64(len(e.body))
+	for name, values := range e.header {
+		size += int64(len(name))
+		for _, v := range values {
+			size += int64(len(v))
+		}
+	}
+	return size
+}
+
+// response answers the request from the entry, with 304 Not Modified when
+// the request is conditional on the ETag of the entry.
+func (e *cacheEntry) response(request *http.Request, now time.Time) *http.Response {
+	header := cloneHeader(e.header)
+	header.Set("Age", strconv.Itoa(int(e.currentAge(now).Seconds())))
+
+	status := e.status
+	body := e.body
+	if etag := header.Get("ETag"); etag != "" && etagMatches(request.Header.Get("If-None-Match"), etag) {
+		status = http.StatusNotModified
+		body = nil
+		header.Del("Content-Length")
+	}
+	if request.Method == "HEAD" {
+		body = nil
+	}
+
+	return &http.Response{
+		Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}
+}
+
+// responseCache holds cache entries up to a total size, evicting the least
+// recently used entries first.
+type responseCache struct {
+	lock         sync.Mutex
+	maxSize      int64
+	maxEntrySize int64
+	size         int64
+	entries      map[string]*list.Element
+	lru          *list.List
+}
+
+type cacheElem struct {
+	key   string
+	entry *cacheEntry
+}
+
+func newResponseCache(maxSize, maxEntrySize int64) *responseCache {
+	return &responseCache{
+		maxSize:      maxSize,
+		maxEntrySize: maxEntrySize,
+		entries:      map[string]*list.Element{},
+		lru:          list.New(),
+	}
+}
+
+// get returns the entry of the key if it matches the request.
+func (c *responseCache) get(key string, request *http.Request) *cacheEntry {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := elem.Value.(*cacheElem).entry
+	if !entry.matches(request) {
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	return entry
+}
+
+func (c *responseCache) put(key string, entry *cacheEntry) {
+	size := entry.size()
+	if size > c.maxSize {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.removeElem(c.entries[key])
+	c.entries[key] = c.lru.PushFront(&cacheElem{key: key, entry: entry})
+	c.size += size
+
+	for c.size > c.maxSize {
+		c.removeElem(c.lru.Back())
+	}
+}
+
+func (c *responseCache) remove(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.removeElem(c.entries[key])
+}
+
+// removeElem removes an element of the cache. responseCache.lock must be
+// held.
+func (c *responseCache) removeElem(elem *list.Element) {
+	if elem == nil {
+		return
+	}
+	e := elem.Value.(*cacheElem)
+	c.lru.Remove(elem)
+	delete(c.entries, e.key)
+	c.size -= e.entry.size()
+}
+
+// parseCacheControl returns the directives of the Cache-Control header with
+// their arguments.
+func parseCacheControl(header http.Header) map[string]string {
+	directives := map[string]string{}
+	for _, v := range header["Cache-Control"] {
+		for _, directive := range strings.Split(v, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+			name, arg := directive, ""
+			if i := strings.Index(directive, "="); i >= 0 {
+				name, arg = directive[:i], strings.Trim(directive[i+1:], `"`)
+			}
+			directives[strings.ToLower(name)] = arg
+		}
+	}
+	return directives
+}
+
+// freshnessLifetime returns how long a response stays fresh, from its
+// s-maxage, max-age or Expires header.
+func freshnessLifetime(header http.Header, cacheControl map[string]string) time.Duration {
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if arg, ok := cacheControl[directive]; ok {
+			seconds, err := strconv.Atoi(arg)
+			if err != nil || seconds < 0 {
+				return 0
+			}
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	expires, err := http.ParseTime(header.Get("Expires"))
+	if err != nil {
+		return 0
+	}
+	date, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		return 0
+	}
+	return expires.Sub(date)
+}
+
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+func cloneHeader(header http.Header) http.Header {
+	clone := make(http.Header, len(header))
+	for name, values := range header {
+		clone[name] = append([]string(nil), values...)
+	}
+	return clone
+}
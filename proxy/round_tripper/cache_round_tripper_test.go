@@ -0,0 +1,274 @@
+package round_tripper_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/handlers"
+	"code.cloudfoundry.org/gorouter/proxy/round_tripper"
+	roundtripperfakes "code.cloudfoundry.org/gorouter/proxy/round_tripper/fakes"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/routing-api/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CacheRoundTripper", func() {
+	var (
+		cacheRoundTripper round_tripper.ProxyRoundTripper
+		proxyRoundTripper *roundtripperfakes.FakeProxyRoundTripper
+		cfg               config.ResponseCacheConfig
+		clock             *fakeclock.FakeClock
+		routePool         *route.Pool
+		endpoint          *route.Endpoint
+		backendHeader     http.Header
+		backendStatus     int
+		backendBody       string
+		backendRequests   []*http.Request
+	)
+
+	newRequest := func(method, path string) *http.Request {
+		req := test_util.NewRequest(method, "myapp.com", path, nil)
+		handlers.NewRequestInfo().ServeHTTP(nil, req, func(_ http.ResponseWriter, transformedReq *http.Request) {
+			req = transformedReq
+		})
+		reqInfo, err := handlers.ContextRequestInfo(req)
+		Expect(err).ToNot(HaveOccurred())
+		reqInfo.RoutePool = routePool
+		return req
+	}
+
+	roundTrip := func(req *http.Request) *http.Response {
+		res, err := cacheRoundTripper.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		body, err := ioutil.ReadAll(res.Body)
+		Expect(err).ToNot(HaveOccurred())
+		res.Body.Close()
+		res.Body = ioutil.NopCloser(strings.NewReader(string(body)))
+		return res
+	}
+
+	get := func(path string) *http.Response {
+		return roundTrip(newRequest("GET", path))
+	}
+
+	bodyOf := func(res *http.Response) string {
+		body, err := ioutil.ReadAll(res.Body)
+		Expect(err).ToNot(HaveOccurred())
+		return string(body)
+	}
+
+	BeforeEach(func() {
+		clock = fakeclock.NewFakeClock(time.Now())
+		cfg = config.ResponseCacheConfig{MaxSizeBytes: 1024 * 1024, MaxEntrySizeBytes: 1024}
+
+		routePool = route.NewPool(1*time.Second, "")
+		endpoint = route.NewEndpoint("appId", "1.1.1.1", uint16(9090), "instanceId", "1",
+			map[string]string{}, 0, "", models.ModificationTag{}, "")
+		endpoint.CacheResponses = true
+		routePool.Put(endpoint)
+
+		backendHeader = http.Header{"Cache-Control": []string{"max-age=60"}}
+		backendStatus = http.StatusOK
+		backendBody = "hello"
+		backendRequests = nil
+
+		proxyRoundTripper = new(roundtripperfakes.FakeProxyRoundTripper)
+		proxyRoundTripper.RoundTripStub = func(req *http.Request) (*http.Response, error) {
+			backendRequests = append(backendRequests, req)
+			header := http.Header{}
+			for name, values := range backendHeader {
+				header[name] = values
+			}
+			return &http.Response{
+				StatusCode:    backendStatus,
+				Header:        header,
+				Body:          ioutil.NopCloser(strings.NewReader(backendBody)),
+				ContentLength: int64(len(backendBody)),
+			}, nil
+		}
+	})
+
+	JustBeforeEach(func() {
+		cacheRoundTripper = round_tripper.NewCacheRoundTripper(proxyRoundTripper, cfg, clock)
+	})
+
+	It("answers requests from the cache while the response is fresh", func() {
+		Expect(bodyOf(get("/"))).To(Equal("hello"))
+
+		clock.Increment(30 * time.Second)
+		res := get("/")
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		Expect(bodyOf(res)).To(Equal("hello"))
+		Expect(res.Header.Get("Age")).To(Equal("30"))
+		Expect(proxyRoundTripper.RoundTripCallCount()).To(Equal(1))
+	})
+
+	It("forwards requests once the response is stale", func() {
+		get("/")
+
+		clock.Increment(61 * time.Second)
+		get("/")
+		Expect(proxyRoundTripper.RoundTripCallCount()).To(Equal(2))
+	})
+
+	It("caches responses of each URI separately", func() {
+		get("/a")
+		get("/a?page=2")
+		get("/b")
+		Expect(proxyRoundTripper.RoundTripCallCount()).To(Equal(3))
+	})
+
+	It("answers HEAD requests from the cache without a body", func() {
+		get("/")
+
+		res := roundTrip(newRequest("HEAD", "/"))
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		Expect(bodyOf(res)).To(BeEmpty())
+		Expect(proxyRoundTripper.RoundTripCallCount()).To(Equal(1))
+	})
+
+	It("does not cache responses for routes that did not opt in", func() {
+		endpoint.CacheResponses = false
+
+		get("/")
+		get("/")
+		Expect(proxyRoundTripper.RoundTripCallCount()).To(Equal(2))
+	})
+
+	It("does not cache requests to route services", func() {
+		req := newRequest("GET", "/")
+		reqInfo, err := handlers.ContextRequestInfo(req)
+		Expect(err).ToNot(HaveOccurred())
+		reqInfo.RouteServiceURL, err = url.Parse("https://rs.example.com")
+		Expect(err).ToNot(HaveOccurred())
+
+		roundTrip(req)
+		get("/")
+		Expect(proxyRoundTripper.RoundTripCallCount()).To(Equal(2))
+	})
+
+	uncacheable := []struct {
+		description string
+		header      http.Header
+		status      int
+	}{
+		{"with no-store", http.Header{"Cache-Control": []string{"no-store, max-age=60"}}, http.StatusOK},
+		{"with private", http.Header{"Cache-Control": []string{"private, max-age=60"}}, http.StatusOK},
+		{"with cookies", http.Header{"Cache-Control": []string{"max-age=60"}, "Set-Cookie": []string{"a=b"}}, http.StatusOK},
+		{"varying by anything", http.Header{"Cache-Control": []string{"max-age=60"}, "Vary": []string{"*"}}, http.StatusOK},
+		{"without freshness or validators", http.Header{}, http.StatusOK},
+		{"with a server error", http.Header{"Cache-Control": []string{"max-age=60"}}, http.StatusInternalServerError},
+	}
+	for _, response := range uncacheable {
+		response := response
+		It("does not cache responses "+response.description, func() {
+			backendHeader = response.header
+			backendStatus = response.status
+
+			get("/")
+			get("/")
+			Expect(proxyRoundTripper.RoundTripCallCount()).To(Equal(2))
+		})
+	}
+
+	It("does not cache responses larger than the maximum entry size", func() {
+		backendBody = strings.Repeat("a", 2048)
+
+		get("/")
+		get("/")
+		Expect(proxyRoundTripper.RoundTripCallCount()).To(Equal(2))
+	})
+
+	It("does not answer requests with no-cache from the cache", func() {
+		get("/")
+
+		req := newRequest("GET", "/")
+		req.Header.Set("Cache-Control", "no-cache")
+		roundTrip(req)
+		Expect(proxyRoundTripper.RoundTripCallCount()).To(Equal(2))
+	})
+
+	It("does not cache requests with credentials", func() {
+		req := newRequest("GET", "/")
+		req.Header.Set("Authorization", "Bearer token")
+		roundTrip(req)
+		get("/")
+		Expect(proxyRoundTripper.RoundTripCallCount()).To(Equal(2))
+	})
+
+	It("caches a response for each value of the headers it varies by", func() {
+		backendHeader.Set("Vary", "Accept-Language")
+
+		get("/")
+		req := newRequest("GET", "/")
+		req.Header.Set("Accept-Language", "de")
+		roundTrip(req)
+		Expect(proxyRoundTripper.RoundTripCallCount()).To(Equal(2))
+	})
+
+	It("invalidates the cached response after an unsafe request to the URI", func() {
+		get("/")
+		roundTrip(newRequest("POST", "/"))
+		get("/")
+		Expect(proxyRoundTripper.RoundTripCallCount()).To(Equal(3))
+	})
+
+	Context("when the cache is full", func() {
+		BeforeEach(func() {
+			cfg.MaxSizeBytes = 100
+		})
+
+		It("evicts the least recently used responses", func() {
+			get("/a")
+			get("/b")
+			get("/a")
+			get("/c")
+			Expect(proxyRoundTripper.RoundTripCallCount()).To(Equal(3))
+
+			get("/a")
+			Expect(proxyRoundTripper.RoundTripCallCount()).To(Equal(3))
+			get("/b")
+			Expect(proxyRoundTripper.RoundTripCallCount()).To(Equal(4))
+		})
+	})
+
+	Context("when the response has an ETag", func() {
+		BeforeEach(func() {
+			backendHeader.Set("ETag", `"v1"`)
+		})
+
+		It("responds with 304 to requests for the same version", func() {
+			get("/")
+
+			req := newRequest("GET", "/")
+			req.Header.Set("If-None-Match", `"v1"`)
+			res := roundTrip(req)
+			Expect(res.StatusCode).To(Equal(http.StatusNotModified))
+			Expect(bodyOf(res)).To(BeEmpty())
+			Expect(proxyRoundTripper.RoundTripCallCount()).To(Equal(1))
+		})
+
+		It("revalidates the response once it is stale", func() {
+			get("/")
+			clock.Increment(61 * time.Second)
+
+			backendStatus = http.StatusNotModified
+			backendBody = ""
+			res := get("/")
+			Expect(backendRequests[1].Header.Get("If-None-Match")).To(Equal(`"v1"`))
+			Expect(res.StatusCode).To(Equal(http.StatusOK))
+			Expect(bodyOf(res)).To(Equal("hello"))
+
+			get("/")
+			Expect(proxyRoundTripper.RoundTripCallCount()).To(Equal(2))
+		})
+	})
+})
@@ -0,0 +1,159 @@
+package round_tripper
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/gorouter/config"
+)
+
+// compressionEncodings lists the supported content codings in order of
+// preference.
+var compressionEncodings = []string{"gzip", "deflate"}
+
+// NewCompressionRoundTripper compresses the responses of p for clients that
+// accept gzip or deflate, when the response is not compressed already, has
+// one of the configured MIME types and is at least the configured size.
+func NewCompressionRoundTripper(p ProxyRoundTripper, cfg config.CompressionConfig) ProxyRoundTripper {
+	mimeTypes := make(map[string]bool, len(cfg.MimeTypes))
+	for _, t := range cfg.MimeTypes {
+		mimeTypes[strings.ToLower(t)] = true
+	}
+	return &compressionRoundTripper{
+		p:         p,
+		mimeTypes: mimeTypes,
+		minSize:   cfg.MinSizeBytes,
+	}
+}
+
+type compressionRoundTripper struct {
+	p         ProxyRoundTripper
+	mimeTypes map[string]bool
+	minSize   int64
+}
+
+func (c *compressionRoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	res, err := c.p.RoundTrip(request)
+	if err != nil || request.Method == "HEAD" {
+		return res, err
+	}
+
+	encoding := acceptedEncoding(request.Header.Get("Accept-Encoding"))
+	if encoding == "" || !c.compressible(res) {
+		return res, nil
+	}
+
+	body := &compressingBody{src: res.Body}
+	if encoding == "gzip" {
+		body.w = gzip.NewWriter(&body.buf)
+	} else {
+		body.w, _ = flate.NewWriter(&body.buf, flate.DefaultCompression)
+	}
+	res.Body = body
+
+	res.Header.Set("Content-Encoding", encoding)
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	res.Header.Add("Vary", "Accept-Encoding")
+	// the compressed response is a different representation, which only
+	// matches weakly
+	if etag := res.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		res.Header.Set("ETag", "W/"+etag)
+	}
+	return res, nil
+}
+
+func (c *compressionRoundTripper) CancelRequest(request *http.Request) {
+	c.p.CancelRequest(request)
+}
+
+func (c *compressionRoundTripper) compressible(res *http.Response) bool {
+	switch res.StatusCode {
+	case http.StatusNoContent, http.StatusPartialContent, http.StatusNotModified:
+		return false
+	}
+	if res.Header.Get("Content-Encoding") != "" || res.Header.Get("Content-Range") != "" {
+		return false
+	}
+	if res.ContentLength >= 0 && res.ContentLength < c.minSize {
+		return false
+	}
+	if strings.Contains(strings.ToLower(res.Header.Get("Cache-Control")), "no-transform") {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	return err == nil && c.mimeTypes[mediaType]
+}
+
+// acceptedEncoding returns the supported content coding the client prefers,
+// or the empty string when it accepts none of them.
+func acceptedEncoding(acceptEncoding string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		for _, encoding := range compressionEncodings {
+			if (coding == encoding || coding == "*") && q > bestQ {
+				best, bestQ = encoding, q
+				break
+			}
+		}
+	}
+	return best
+}
+
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressingBody compresses src as it is read. Each chunk read from src is
+// flushed, so streamed responses are not held back.
+type compressingBody struct {
+	src   io.ReadCloser
+	w     compressor
+	buf   bytes.Buffer
+	chunk [32 * 1024]byte
+	eof   bool
+}
+
+func (b *compressingBody) Read(p []byte) (int, error) {
+	for b.buf.Len() == 0 && !b.eof {
+		n, err := b.src.Read(b.chunk[:])
+		if n > 0 {
+			b.w.Write(b.chunk[:n])
+			b.w.Flush()
+		}
+		if err == io.EOF {
+			b.w.Close()
+			b.eof = true
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	if b.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return b.buf.Read(p)
+}
+
+func (b *compressingBody) Close() error {
+	return b.src.Close()
+}
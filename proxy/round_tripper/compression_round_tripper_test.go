@@ -0,0 +1,140 @@
+package round_tripper_test
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/proxy/round_tripper"
+	roundtripperfakes "code.cloudfoundry.org/gorouter/proxy/round_tripper/fakes"
+	"code.cloudfoundry.org/gorouter/test_util"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CompressionRoundTripper", func() {
+	var (
+		compressionRoundTripper round_tripper.ProxyRoundTripper
+		proxyRoundTripper       *roundtripperfakes.FakeProxyRoundTripper
+		req                     *http.Request
+		backendHeader           http.Header
+		backendBody             string
+	)
+
+	roundTrip := func() *http.Response {
+		res, err := compressionRoundTripper.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		return res
+	}
+
+	BeforeEach(func() {
+		req = test_util.NewRequest("GET", "myapp.com", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+
+		backendHeader = http.Header{"Content-Type": []string{"text/html; charset=utf-8"}}
+		backendBody = strings.Repeat("hello world ", 100)
+
+		proxyRoundTripper = new(roundtripperfakes.FakeProxyRoundTripper)
+		proxyRoundTripper.RoundTripStub = func(*http.Request) (*http.Response, error) {
+			header := http.Header{}
+			for name, values := range backendHeader {
+				header[name] = values
+			}
+			header.Set("Content-Length", strconv.Itoa(len(backendBody)))
+			return &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        header,
+				Body:          ioutil.NopCloser(strings.NewReader(backendBody)),
+				ContentLength: int64(len(backendBody)),
+			}, nil
+		}
+
+		compressionRoundTripper = round_tripper.NewCompressionRoundTripper(proxyRoundTripper, config.CompressionConfig{
+			MimeTypes:    []string{"text/html", "application/json"},
+			MinSizeBytes: 1024,
+		})
+	})
+
+	It("compresses the response with gzip", func() {
+		res := roundTrip()
+		Expect(res.Header.Get("Content-Encoding")).To(Equal("gzip"))
+		Expect(res.Header.Get("Content-Length")).To(BeEmpty())
+		Expect(res.ContentLength).To(Equal(int64(-1)))
+		Expect(res.Header.Get("Vary")).To(Equal("Accept-Encoding"))
+
+		r, err := gzip.NewReader(res.Body)
+		Expect(err).ToNot(HaveOccurred())
+		body, err := ioutil.ReadAll(r)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(Equal(backendBody))
+	})
+
+	It("compresses the response with deflate when the client prefers it", func() {
+		req.Header.Set("Accept-Encoding", "gzip;q=0.5, deflate")
+
+		res := roundTrip()
+		Expect(res.Header.Get("Content-Encoding")).To(Equal("deflate"))
+
+		body, err := ioutil.ReadAll(flate.NewReader(res.Body))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(Equal(backendBody))
+	})
+
+	It("weakens the ETag of the response", func() {
+		backendHeader.Set("ETag", `"v1"`)
+
+		res := roundTrip()
+		Expect(res.Header.Get("ETag")).To(Equal(`W/"v1"`))
+	})
+
+	It("does not compress for clients that do not accept a supported encoding", func() {
+		req.Header.Set("Accept-Encoding", "br, gzip;q=0")
+
+		res := roundTrip()
+		Expect(res.Header.Get("Content-Encoding")).To(BeEmpty())
+		body, err := ioutil.ReadAll(res.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(Equal(backendBody))
+	})
+
+	It("does not compress responses that are compressed already", func() {
+		backendHeader.Set("Content-Encoding", "br")
+
+		res := roundTrip()
+		Expect(res.Header.Get("Content-Encoding")).To(Equal("br"))
+		Expect(res.Header.Get("Content-Length")).To(Equal("1200"))
+	})
+
+	It("does not compress MIME types that are not allowed", func() {
+		backendHeader.Set("Content-Type", "image/png")
+
+		res := roundTrip()
+		Expect(res.Header.Get("Content-Encoding")).To(BeEmpty())
+	})
+
+	It("does not compress responses smaller than the minimum size", func() {
+		backendBody = "hello"
+
+		res := roundTrip()
+		Expect(res.Header.Get("Content-Encoding")).To(BeEmpty())
+	})
+
+	It("does not compress responses with no-transform", func() {
+		backendHeader.Set("Cache-Control", "no-transform")
+
+		res := roundTrip()
+		Expect(res.Header.Get("Content-Encoding")).To(BeEmpty())
+	})
+
+	It("does not compress responses to HEAD requests", func() {
+		req.Method = "HEAD"
+
+		res := roundTrip()
+		Expect(res.Header.Get("Content-Encoding")).To(BeEmpty())
+	})
+})
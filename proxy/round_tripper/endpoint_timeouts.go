@@ -0,0 +1,109 @@
+package round_tripper
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/handlers"
+	"code.cloudfoundry.org/gorouter/route"
+)
+
+// ErrResponseHeaderTimeout is the error of round trips to endpoints that do
+// not send the headers of their response within the response header timeout.
+var ErrResponseHeaderTimeout = errors.New("timeout awaiting response headers")
+
+// endpointTimeouts are the timeouts of a round trip to an endpoint. Zero
+// timeouts do not time out; a zero request timeout leaves the request to the
+// endpoint_timeout of the router.
+type endpointTimeouts struct {
+	// dial bounds the time to connect to the endpoint.
+	dial time.Duration
+	// responseHeader bounds the time from sending the request until the
+	// headers of the response arrive.
+	responseHeader time.Duration
+	// idle bounds the time between two reads of the response body, so that
+	// streams are only closed when they stall.
+	idle time.Duration
+	// request bounds the whole round trip, including reading the response
+	// body.
+	request time.Duration
+	// longLived is set for long-lived requests, which only time out after
+	// the timeout of long-lived requests.
+	longLived bool
+}
+
+// timeouts returns the timeouts of a request to the endpoint. The timeouts
+// the endpoint was registered with take precedence over those of the
+// virtual host of the request, which take precedence over those of the
+// router.
+func (rt *roundTripper) timeouts(request *http.Request, endpoint *route.Endpoint) endpointTimeouts {
+	c := rt.reloadable.Get()
+	t := endpointTimeouts{
+		dial:           firstPositive(endpoint.DialTimeout, c.EndpointDialTimeout),
+		responseHeader: firstPositive(endpoint.ResponseHeaderTimeout, c.EndpointResponseHeaderTimeout),
+		idle:           firstPositive(endpoint.IdleTimeout, c.EndpointIdleTimeout),
+		request:        endpoint.Timeout,
+	}
+
+	reqInfo, err := handlers.ContextRequestInfo(request)
+	if err != nil {
+		return t
+	}
+	if reqInfo.LongLived {
+		return endpointTimeouts{dial: t.dial, request: rt.longLivedTimeout, longLived: true}
+	}
+	if t.request <= 0 && reqInfo.VirtualHost != nil {
+		t.request = reqInfo.VirtualHost.EndpointTimeout
+	}
+	return t
+}
+
+func firstPositive(durations ...time.Duration) time.Duration {
+	for _, d := range durations {
+		if d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+type dialTimeoutKey struct{}
+
+// ContextDialTimeout returns the timeout for dialing the endpoint a request
+// is sent to.
+func ContextDialTimeout(ctx context.Context) (time.Duration, bool) {
+	timeout, ok := ctx.Value(dialTimeoutKey{}).(time.Duration)
+	return timeout, ok
+}
+
+// idleTimeoutBody cancels the request of a response when its body is not
+// read from for the idle timeout.
+type idleTimeoutBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+func newIdleTimeoutBody(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) *idleTimeoutBody {
+	return &idleTimeoutBody{
+		ReadCloser: body,
+		timeout:    timeout,
+		timer:      time.AfterFunc(timeout, cancel),
+	}
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.timer.Reset(b.timeout)
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,53 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/gorouter/proxy/round_tripper"
+)
+
+type FakeRoundTripperFactory struct {
+	NewStub        func(serverName string) round_tripper.ProxyRoundTripper
+	newMutex       sync.RWMutex
+	newArgsForCall []struct {
+		serverName string
+	}
+	newReturns struct {
+		result1 round_tripper.ProxyRoundTripper
+	}
+}
+
+func (fake *FakeRoundTripperFactory) New(serverName string) round_tripper.ProxyRoundTripper {
+	fake.newMutex.Lock()
+	fake.newArgsForCall = append(fake.newArgsForCall, struct {
+		serverName string
+	}{serverName})
+	fake.newMutex.Unlock()
+	if fake.NewStub != nil {
+		return fake.NewStub(serverName)
+	} else {
+		return fake.newReturns.result1
+	}
+}
+
+func (fake *FakeRoundTripperFactory) NewCallCount() int {
+	fake.newMutex.RLock()
+	defer fake.newMutex.RUnlock()
+	return len(fake.newArgsForCall)
+}
+
+func (fake *FakeRoundTripperFactory) NewArgsForCall(i int) string {
+	fake.newMutex.RLock()
+	defer fake.newMutex.RUnlock()
+	return fake.newArgsForCall[i].serverName
+}
+
+func (fake *FakeRoundTripperFactory) NewReturns(result1 round_tripper.ProxyRoundTripper) {
+	fake.NewStub = nil
+	fake.newReturns = struct {
+		result1 round_tripper.ProxyRoundTripper
+	}{result1}
+}
+
+var _ round_tripper.RoundTripperFactory = new(FakeRoundTripperFactory)
@@ -1,17 +1,23 @@
 package round_tripper
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/uber-go/zap"
 
 	router_http "code.cloudfoundry.org/gorouter/common/http"
+	"code.cloudfoundry.org/gorouter/config"
 	"code.cloudfoundry.org/gorouter/handlers"
 	"code.cloudfoundry.org/gorouter/logger"
 	"code.cloudfoundry.org/gorouter/metrics"
@@ -24,6 +30,13 @@ const (
 	StickyCookieKey   = "JSESSIONID"
 	CookieHeader      = "Set-Cookie"
 	BadGatewayMessage = "502 Bad Gateway: Registered endpoint failed to handle the request."
+	SaturatedMessage  = "503 Service Unavailable: All registered endpoints are at their connection limit."
+
+	RequestBodyTooLargeMessage = "413 Request Entity Too Large: Request body is larger than the route allows."
+
+	// SaturatedRetryAfter is the Retry-After, in seconds, of responses to
+	// requests for routes whose endpoints are all at their connection limit.
+	SaturatedRetryAfter = "1"
 )
 
 //go:generate counterfeiter -o fakes/fake_proxy_round_tripper.go . ProxyRoundTripper
@@ -32,38 +45,70 @@ type ProxyRoundTripper interface {
 	CancelRequest(*http.Request)
 }
 
+//go:generate counterfeiter -o fakes/fake_round_tripper_factory.go . RoundTripperFactory
+
+// RoundTripperFactory returns the round tripper for endpoints that are
+// reached over TLS. The certificate presented by the endpoint must be valid
+// for serverName.
+type RoundTripperFactory interface {
+	New(serverName string) ProxyRoundTripper
+}
+
 type AfterRoundTrip func(req *http.Request, rsp *http.Response, endpoint *route.Endpoint, err error)
 
 func NewProxyRoundTripper(
 	transport ProxyRoundTripper,
+	http2Transport ProxyRoundTripper,
+	tlsTransports RoundTripperFactory,
+	http2TLSTransports RoundTripperFactory,
 	logger logger.Logger,
 	traceKey string,
 	routerIP string,
 	defaultLoadBalance string,
 	combinedReporter metrics.CombinedReporter,
 	secureCookies bool,
+	stickySessionCookieNames []string,
+	retries config.RetryConfig,
+	longLivedTimeout time.Duration,
+	reloadable *config.ReloadableConfig,
 	localPort uint16,
 ) ProxyRoundTripper {
 	return &roundTripper{
 		logger:             logger,
 		transport:          transport,
+		http2Transport:     http2Transport,
+		tlsTransports:      tlsTransports,
+		http2TLSTransports: http2TLSTransports,
 		traceKey:           traceKey,
 		routerIP:           routerIP,
 		defaultLoadBalance: defaultLoadBalance,
 		combinedReporter:   combinedReporter,
 		secureCookies:      secureCookies,
+		stickyCookieNames:  stickySessionCookieNames,
+		retries:            retries,
+		retryBudget:        NewRetryBudget(retries.BudgetPercent, retries.MinRetryConcurrency),
+		longLivedTimeout:   longLivedTimeout,
+		reloadable:         reloadable,
 		localPort:          localPort,
 	}
 }
 
 type roundTripper struct {
 	transport          ProxyRoundTripper
+	http2Transport     ProxyRoundTripper
+	tlsTransports      RoundTripperFactory
+	http2TLSTransports RoundTripperFactory
 	logger             logger.Logger
 	traceKey           string
 	routerIP           string
 	defaultLoadBalance string
 	combinedReporter   metrics.CombinedReporter
 	secureCookies      bool
+	stickyCookieNames  []string
+	retries            config.RetryConfig
+	retryBudget        *RetryBudget
+	longLivedTimeout   time.Duration
+	reloadable         *config.ReloadableConfig
 	localPort          uint16
 }
 
@@ -71,6 +116,7 @@ func (rt *roundTripper) RoundTrip(request *http.Request) (*http.Response, error)
 	var err error
 	var res *http.Response
 	var endpoint *route.Endpoint
+	var quotaWait time.Duration
 
 	if request.Body != nil {
 		closer := request.Body
@@ -92,23 +138,77 @@ func (rt *roundTripper) RoundTrip(request *http.Request) (*http.Response, error)
 		return nil, errors.New("ProxyResponseWriter not set on context")
 	}
 
-	stickyEndpointID := getStickySession(request)
-	iter := reqInfo.RoutePool.Endpoints(rt.defaultLoadBalance, stickyEndpointID)
+	stickyEndpointID := getStickySession(request, rt.stickyCookieNames)
+	initialEndpointID := stickyEndpointID
+	if reqInfo.InitialEndpointID != "" {
+		initialEndpointID = reqInfo.InitialEndpointID
+	}
+	loadBalance := reqInfo.LoadBalance(rt.defaultLoadBalance)
+	iter := reqInfo.RoutePool.Endpoints(loadBalance, initialEndpointID, reqInfo.HashKey)
+	if reqInfo.SplitTraffic {
+		iter = reqInfo.RoutePool.GroupEndpoints(reqInfo.TrafficGroup, loadBalance, initialEndpointID, reqInfo.HashKey)
+	}
+
+	// requests carrying the trace key are timed for debugging
+	traced := rt.traceKey != "" && request.Header.Get(router_http.VcapTraceHeader) == rt.traceKey
+	var timing *requestTiming
+	if traced || reqInfo.RecordTiming {
+		request, timing = traceTiming(request)
+	}
+
+	rt.retryBudget.RequestStarted()
+	defer rt.retryBudget.RequestFinished()
+
+	retrying := false
+	defer func() {
+		if retrying {
+			rt.retryBudget.RetryFinished()
+		}
+	}()
+
+	requestLogger := handlers.RequestLogger(rt.logger, request)
+	logger := requestLogger
+	for retry := 0; retry <= rt.retries.MaxRetries; retry++ {
+		logger = requestLogger
 
-	logger := rt.logger
-	for retry := 0; retry < handler.MaxRetries; retry++ {
-		logger = rt.logger
+		if retry > 0 && !retrying {
+			if !rt.retryBudget.TryRetry() {
+				logger.Info("retry-budget-exhausted", zap.Int("attempt", retry))
+				break
+			}
+			retrying = true
+		}
 
 		if reqInfo.RouteServiceURL == nil {
-			endpoint, err = rt.selectEndpoint(iter, request)
+			endpoint, err = rt.selectEndpoint(iter, reqInfo.RoutePool)
 			if err != nil {
 				break
 			}
 			logger = logger.With(zap.Nest("route-endpoint", endpoint.ToLogData()...))
 
 			logger.Debug("backend", zap.Int("attempt", retry))
-			res, err = rt.backendRoundTrip(request, endpoint, iter)
-			if err == nil || !retryableError(err) {
+			reqInfo.Attempts++
+			if timing != nil {
+				timing.attempt()
+			}
+			release := func() {}
+			if reqInfo.AppQuotas != nil {
+				release, quotaWait, err = reqInfo.AppQuotas.Take(endpoint.ApplicationId)
+				if err != nil {
+					iter.PostRequest(endpoint)
+					break
+				}
+			}
+			res, err = rt.backendRoundTrip(request, endpoint, iter, release)
+			if err == nil {
+				if res != nil && res.StatusCode >= http.StatusInternalServerError {
+					iter.EndpointErrored()
+				} else {
+					iter.EndpointSucceeded()
+				}
+				break
+			}
+			if !rt.retryable(request, err) {
 				break
 			}
 			iter.EndpointFailed()
@@ -129,6 +229,10 @@ func (rt *roundTripper) RoundTrip(request *http.Request) (*http.Response, error)
 				request.URL.Host = fmt.Sprintf("localhost:%d", rt.localPort)
 			}
 
+			reqInfo.Attempts++
+			if timing != nil {
+				timing.attempt()
+			}
 			res, err = rt.transport.RoundTrip(request)
 			if err == nil {
 				if res != nil && (res.StatusCode < 200 || res.StatusCode >= 300) {
@@ -140,7 +244,7 @@ func (rt *roundTripper) RoundTrip(request *http.Request) (*http.Response, error)
 				}
 				break
 			}
-			if !retryableError(err) {
+			if !rt.retryable(request, err) {
 				break
 			}
 			logger.Error("route-service-connection-failed", zap.Error(err))
@@ -150,6 +254,68 @@ func (rt *roundTripper) RoundTrip(request *http.Request) (*http.Response, error)
 	reqInfo.RouteEndpoint = endpoint
 	reqInfo.StoppedAt = time.Now()
 
+	if timing != nil {
+		timing.finish()
+		reqInfo.Timing = timing.breakdown()
+	}
+	if traced {
+		var addr string
+		if endpoint != nil {
+			addr = endpoint.CanonicalAddr()
+		}
+		retries := reqInfo.Attempts - 1
+		if retries < 0 {
+			retries = 0
+		}
+		logger.Debug("request-timing", timing.logData(retries, addr)...)
+		if err != nil {
+			reqInfo.ProxyResponseWriter.Header().Set(router_http.VcapTraceTimingHeader, timing.header(retries, addr))
+		} else if res != nil {
+			res.Header.Set(router_http.VcapTraceTimingHeader, timing.header(retries, addr))
+		}
+	}
+
+	if err == handler.EndpointsSaturated {
+		// fail fast rather than queue requests the endpoints cannot take
+		responseWriter := reqInfo.ProxyResponseWriter
+		responseWriter.Header().Set(router_http.CfRouterError, "endpoints_saturated")
+		responseWriter.Header().Set("Retry-After", SaturatedRetryAfter)
+
+		logger.Info("status", zap.String("body", SaturatedMessage))
+
+		http.Error(responseWriter, SaturatedMessage, http.StatusServiceUnavailable)
+		responseWriter.Header().Del("Connection")
+
+		responseWriter.Done()
+
+		return nil, err
+	}
+
+	if err == handlers.ErrAppQuotaExceeded {
+		responseWriter := reqInfo.ProxyResponseWriter
+		handlers.WriteAppQuotaExceeded(responseWriter, quotaWait, logger)
+
+		responseWriter.Done()
+
+		return nil, err
+	}
+
+	if err == handlers.ErrRequestBodyTooLarge {
+		// the rest of the body is not read, so the connection cannot be
+		// reused
+		responseWriter := reqInfo.ProxyResponseWriter
+		responseWriter.Header().Set(router_http.CfRouterError, "request_body_too_large")
+		responseWriter.Header().Set("Connection", "close")
+
+		logger.Info("status", zap.String("body", RequestBodyTooLargeMessage))
+
+		http.Error(responseWriter, RequestBodyTooLargeMessage, http.StatusRequestEntityTooLarge)
+
+		responseWriter.Done()
+
+		return nil, err
+	}
+
 	if err != nil {
 		responseWriter := reqInfo.ProxyResponseWriter
 		responseWriter.Header().Set(router_http.CfRouterError, "endpoint_failure")
@@ -168,7 +334,7 @@ func (rt *roundTripper) RoundTrip(request *http.Request) (*http.Response, error)
 		return nil, err
 	}
 
-	if rt.traceKey != "" && request.Header.Get(router_http.VcapTraceHeader) == rt.traceKey {
+	if traced {
 		if res != nil && endpoint != nil {
 			res.Header.Set(router_http.VcapRouterHeader, rt.routerIP)
 			res.Header.Set(router_http.VcapBackendHeader, endpoint.CanonicalAddr())
@@ -178,8 +344,8 @@ func (rt *roundTripper) RoundTrip(request *http.Request) (*http.Response, error)
 
 	if res != nil && endpoint.PrivateInstanceId != "" {
 		setupStickySession(
-			res, endpoint, stickyEndpointID, rt.secureCookies,
-			reqInfo.RoutePool.ContextPath(),
+			res, endpoint, stickyEndpointID, rt.secureCookies, rt.stickyCookieNames,
+			stickyCookiePath(reqInfo.RoutePool.ContextPath()),
 		)
 	}
 
@@ -188,32 +354,151 @@ func (rt *roundTripper) RoundTrip(request *http.Request) (*http.Response, error)
 
 func (rt *roundTripper) CancelRequest(request *http.Request) {
 	rt.transport.CancelRequest(request)
+	rt.http2Transport.CancelRequest(request)
 }
 
 func (rt *roundTripper) backendRoundTrip(
 	request *http.Request,
 	endpoint *route.Endpoint,
 	iter route.EndpointIterator,
+	releaseQuota func(),
 ) (*http.Response, error) {
 	request.URL.Host = endpoint.CanonicalAddr()
 	request.Header.Set("X-CF-ApplicationID", endpoint.ApplicationId)
 	request.Header.Set("X-CF-InstanceIndex", endpoint.PrivateInstanceIndex)
 	handler.SetRequestXCfInstanceId(request, endpoint)
 
-	// increment connection stats
-	iter.PreRequest(endpoint)
+	transport := rt.transport
+	if endpoint.IsHTTP2() {
+		transport = rt.http2Transport
+		if endpoint.UseTLS {
+			transport = rt.http2TLSTransports.New(endpoint.ServerCertDomainSAN)
+			request.URL.Scheme = "https"
+		}
+		// gRPC servers require clients to announce support for trailers
+		if isGRPC(request) {
+			request.Header.Set("Te", "trailers")
+		}
+	} else if endpoint.UseTLS {
+		transport = rt.tlsTransports.New(endpoint.ServerCertDomainSAN)
+		request.URL.Scheme = "https"
+	}
+
+	timeouts := rt.timeouts(request, endpoint)
+	ctx := context.WithValue(request.Context(), dialTimeoutKey{}, timeouts.dial)
+	var cancel context.CancelFunc
+	if timeouts.request > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeouts.request)
+		ctx = context.WithValue(ctx, endpointTimeoutKey{}, timeouts.request)
+	} else {
+		if timeouts.longLived {
+			ctx = context.WithValue(ctx, endpointTimeoutKey{}, time.Duration(0))
+		}
+		if timeouts.responseHeader > 0 || timeouts.idle > 0 {
+			ctx, cancel = context.WithCancel(ctx)
+		}
+	}
+	request = request.WithContext(ctx)
+	if timeouts.longLived {
+		request = withConnDeadline(request, timeouts.request)
+	}
+
+	var headerTimer *time.Timer
+	if timeouts.responseHeader > 0 {
+		headerTimer = time.AfterFunc(timeouts.responseHeader, cancel)
+	}
 
 	rt.combinedReporter.CaptureRoutingRequest(endpoint)
-	res, err := rt.transport.RoundTrip(request)
+	start := time.Now()
+	res, err := transport.RoundTrip(request)
+	if headerTimer != nil && !headerTimer.Stop() {
+		// the request was canceled, possibly just as the response arrived
+		if err == nil {
+			res.Body.Close()
+			res = nil
+		}
+		err = ErrResponseHeaderTimeout
+	}
+	if err == nil {
+		iter.EndpointResponded(time.Since(start))
+	}
+
+	if err != nil || res == nil || res.Body == nil {
+		if cancel != nil {
+			cancel()
+		}
+		// give back the connection slot taken when the endpoint was selected,
+		// and the request taken from the quota of its application
+		iter.PostRequest(endpoint)
+		releaseQuota()
+		return res, err
+	}
+
+	if cancel != nil && timeouts.idle > 0 {
+		res.Body = newIdleTimeoutBody(res.Body, timeouts.idle, cancel)
+	}
+	// the request stays in flight, and its timeout applies, until the
+	// response body has been read
+	res.Body = &onCloseBody{ReadCloser: res.Body, onClose: func() {
+		if cancel != nil {
+			cancel()
+		}
+		iter.PostRequest(endpoint)
+		releaseQuota()
+	}}
+	return res, nil
+}
+
+type endpointTimeoutKey struct{}
 
-	// decrement connection stats
-	iter.PostRequest(endpoint)
-	return res, err
+// ContextEndpointTimeout returns the timeout of the endpoint a request is sent
+// to, if the endpoint or the virtual host of the request has its own
+// timeout, or the request is long-lived. Transports use it to set deadlines
+// on the connections they dial; a zero timeout sets no deadline.
+func ContextEndpointTimeout(ctx context.Context) (time.Duration, bool) {
+	timeout, ok := ctx.Value(endpointTimeoutKey{}).(time.Duration)
+	return timeout, ok
 }
 
-func (rt *roundTripper) selectEndpoint(iter route.EndpointIterator, request *http.Request) (*route.Endpoint, error) {
-	endpoint := iter.Next()
+// withConnDeadline returns the request with a trace that replaces the
+// deadline of reused connections, set when they were dialed for other
+// requests, with the timeout of the request, or none if it is zero.
+func withConnDeadline(request *http.Request, timeout time.Duration) *http.Request {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if !info.Reused {
+				return
+			}
+			var deadline time.Time
+			if timeout > 0 {
+				deadline = time.Now().Add(timeout)
+			}
+			info.Conn.SetDeadline(deadline)
+		},
+	}
+	return request.WithContext(httptrace.WithClientTrace(request.Context(), trace))
+}
+
+// onCloseBody releases the context of a request, the connection slot of its
+// endpoint and its application quota once its response body is closed.
+type onCloseBody struct {
+	io.ReadCloser
+	onClose func()
+	once    sync.Once
+}
+
+func (b *onCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.onClose)
+	return err
+}
+
+func (rt *roundTripper) selectEndpoint(iter route.EndpointIterator, pool *route.Pool) (*route.Endpoint, error) {
+	endpoint := handler.NextEndpoint(iter)
 	if endpoint == nil {
+		if pool.Saturated() {
+			return nil, handler.EndpointsSaturated
+		}
 		return nil, handler.NoEndpointsAvailable
 	}
 
@@ -225,6 +510,7 @@ func setupStickySession(
 	endpoint *route.Endpoint,
 	originalEndpointId string,
 	secureCookies bool,
+	stickyCookieNames []string,
 	path string,
 ) {
 	secure := false
@@ -234,7 +520,7 @@ func setupStickySession(
 	sticky := originalEndpointId != "" && originalEndpointId != endpoint.PrivateInstanceId
 
 	for _, v := range response.Cookies() {
-		if v.Name == StickyCookieKey {
+		if isStickyCookie(v.Name, stickyCookieNames) {
 			sticky = true
 			if v.MaxAge < 0 {
 				maxAge = v.MaxAge
@@ -245,7 +531,7 @@ func setupStickySession(
 	}
 
 	if sticky {
-		// right now secure attribute would as equal to the JSESSION ID cookie (if present),
+		// right now secure attribute would as equal to the session cookie (if present),
 		// but override if set to true in config
 		if secureCookies {
 			secure = true
@@ -266,21 +552,59 @@ func setupStickySession(
 	}
 }
 
-func getStickySession(request *http.Request) string {
+// stickyCookiePath returns the context path up to its first wildcard segment,
+// as the paths of cookies are matched literally.
+func stickyCookiePath(contextPath string) string {
+	if i := strings.Index(contextPath+"/", "/*/"); i >= 0 {
+		if i == 0 {
+			return "/"
+		}
+		return contextPath[:i]
+	}
+	return contextPath
+}
+
+func getStickySession(request *http.Request, stickyCookieNames []string) string {
 	// Try choosing a backend using sticky session
-	if _, err := request.Cookie(StickyCookieKey); err == nil {
-		if sticky, err := request.Cookie(VcapCookieId); err == nil {
-			return sticky.Value
+	for _, name := range stickyCookieNames {
+		if _, err := request.Cookie(name); err == nil {
+			if sticky, err := request.Cookie(VcapCookieId); err == nil {
+				return sticky.Value
+			}
+			break
 		}
 	}
 	return ""
 }
 
-func retryableError(err error) bool {
+func isStickyCookie(name string, stickyCookieNames []string) bool {
+	for _, n := range stickyCookieNames {
+		if name == n {
+			return true
+		}
+	}
+	return false
+}
+
+func isGRPC(request *http.Request) bool {
+	return strings.HasPrefix(request.Header.Get("Content-Type"), "application/grpc")
+}
+
+// retryable reports whether a failed request may be sent to another
+// endpoint. Requests that failed to dial never reached the endpoint and are
+// always retried; requests whose connection was reset may have been processed
+// and are only retried for the configured methods.
+func (rt *roundTripper) retryable(request *http.Request, err error) bool {
 	ne, netErr := err.(*net.OpError)
-	if netErr && (ne.Op == "dial" || ne.Op == "read" && ne.Err.Error() == "read: connection reset by peer") {
+	if !netErr {
+		return false
+	}
+	if ne.Op == "dial" {
 		return true
 	}
+	if ne.Op == "read" && ne.Err.Error() == "read: connection reset by peer" {
+		return rt.retries.Methods == nil || rt.retries.Methods[request.Method]
+	}
 	return false
 }
 
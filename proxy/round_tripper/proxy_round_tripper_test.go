@@ -2,18 +2,24 @@ package round_tripper_test
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
 	"net/url"
 	"os"
 	"regexp"
 	"syscall"
 	"time"
 
+	"code.cloudfoundry.org/clock"
 	"code.cloudfoundry.org/gorouter/access_log/schema"
+	"code.cloudfoundry.org/gorouter/config"
 	"code.cloudfoundry.org/gorouter/handlers"
 	"code.cloudfoundry.org/gorouter/metrics/fakes"
 	"code.cloudfoundry.org/gorouter/proxy/handler"
@@ -44,19 +50,43 @@ func (t *testBody) Close() error {
 	return nil
 }
 
+// slowReader returns chunks of one byte, waiting delay before each.
+type slowReader struct {
+	chunks int
+	delay  time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if r.chunks == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(r.delay)
+	r.chunks--
+	p[0] = 'a'
+	return 1, nil
+}
+
 var _ = Describe("ProxyRoundTripper", func() {
 	Context("RoundTrip", func() {
 		var (
-			proxyRoundTripper round_tripper.ProxyRoundTripper
-			routePool         *route.Pool
-			transport         *roundtripperfakes.FakeProxyRoundTripper
-			logger            *test_util.TestZapLogger
-			req               *http.Request
-			reqBody           *testBody
-			resp              *httptest.ResponseRecorder
-			alr               *schema.AccessLogRecord
-			routerIP          string
-			combinedReporter  *fakes.FakeCombinedReporter
+			proxyRoundTripper  round_tripper.ProxyRoundTripper
+			routePool          *route.Pool
+			transport          *roundtripperfakes.FakeProxyRoundTripper
+			http2Transport     *roundtripperfakes.FakeProxyRoundTripper
+			tlsTransport       *roundtripperfakes.FakeProxyRoundTripper
+			tlsTransports      *roundtripperfakes.FakeRoundTripperFactory
+			http2TLSTransport  *roundtripperfakes.FakeProxyRoundTripper
+			http2TLSTransports *roundtripperfakes.FakeRoundTripperFactory
+			logger             *test_util.TestZapLogger
+			req                *http.Request
+			reqBody            *testBody
+			resp               *httptest.ResponseRecorder
+			alr                *schema.AccessLogRecord
+			routerIP           string
+			combinedReporter   *fakes.FakeCombinedReporter
+			retries            config.RetryConfig
+			longLivedTimeout   time.Duration
+			reloadable         *config.ReloadableConfig
 
 			reqInfo *handlers.RequestInfo
 
@@ -94,6 +124,13 @@ var _ = Describe("ProxyRoundTripper", func() {
 
 			logger = test_util.NewTestZapLogger("test")
 			transport = new(roundtripperfakes.FakeProxyRoundTripper)
+			http2Transport = new(roundtripperfakes.FakeProxyRoundTripper)
+			tlsTransport = new(roundtripperfakes.FakeProxyRoundTripper)
+			tlsTransports = new(roundtripperfakes.FakeRoundTripperFactory)
+			tlsTransports.NewReturns(tlsTransport)
+			http2TLSTransport = new(roundtripperfakes.FakeProxyRoundTripper)
+			http2TLSTransports = new(roundtripperfakes.FakeRoundTripperFactory)
+			http2TLSTransports.NewReturns(http2TLSTransport)
 			routerIP = "127.0.0.1"
 
 			endpoint = route.NewEndpoint("appId", "1.1.1.1", uint16(9090), "instanceId", "1",
@@ -104,10 +141,13 @@ var _ = Describe("ProxyRoundTripper", func() {
 
 			combinedReporter = new(fakes.FakeCombinedReporter)
 
+			retries = config.DefaultConfig().Retries
+			longLivedTimeout = 0
+			reloadable = config.NewReloadableConfig(config.DefaultConfig())
 			proxyRoundTripper = round_tripper.NewProxyRoundTripper(
-				transport, logger, "my_trace_key", routerIP, "",
-				combinedReporter, false,
-				1234,
+				transport, http2Transport, tlsTransports, http2TLSTransports, logger, "my_trace_key", routerIP, "",
+				combinedReporter, false, []string{round_tripper.StickyCookieKey}, retries,
+				longLivedTimeout, reloadable, 1234,
 			)
 		})
 
@@ -166,6 +206,44 @@ var _ = Describe("ProxyRoundTripper", func() {
 					Expect(backendResp.Header.Get(router_http.VcapBackendHeader)).To(Equal("1.1.1.1:9090"))
 					Expect(backendResp.Header.Get(router_http.VcapBackendHeader)).To(Equal("1.1.1.1:9090"))
 				})
+
+				It("returns the timing of the request and logs it", func() {
+					transport.RoundTripStub = func(req *http.Request) (*http.Response, error) {
+						trace := httptrace.ContextClientTrace(req.Context())
+						Expect(trace).ToNot(BeNil())
+						trace.GotFirstResponseByte()
+						return resp.Result(), nil
+					}
+
+					backendResp, err := proxyRoundTripper.RoundTrip(req)
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(backendResp.Header.Get(router_http.VcapTraceTimingHeader)).To(MatchRegexp(
+						`^dns=0\.000000 dial=0\.000000 tls=0\.000000 ttfb=\d+\.\d{6} total=\d+\.\d{6} retries=0 reused=false endpoint=1\.1\.1\.1:9090$`,
+					))
+					Expect(logger.Buffer()).To(gbytes.Say(`request-timing.*"retries":0`))
+				})
+
+				It("counts the retries in the timing", func() {
+					transport.RoundTripStub = func(req *http.Request) (*http.Response, error) {
+						if transport.RoundTripCallCount() == 1 {
+							return nil, dialError
+						}
+						return resp.Result(), nil
+					}
+
+					backendResp, err := proxyRoundTripper.RoundTrip(req)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(backendResp.Header.Get(router_http.VcapTraceTimingHeader)).To(ContainSubstring("retries=1"))
+				})
+
+				It("returns the timing of failed requests", func() {
+					transport.RoundTripReturns(nil, errors.New("error"))
+
+					_, err := proxyRoundTripper.RoundTrip(req)
+					Expect(err).To(HaveOccurred())
+					Expect(resp.Header().Get(router_http.VcapTraceTimingHeader)).To(ContainSubstring("endpoint=1.1.1.1:9090"))
+				})
 			})
 
 			Context("when VcapTraceHeader does not match the trace key", func() {
@@ -179,6 +257,7 @@ var _ = Describe("ProxyRoundTripper", func() {
 					Expect(backendResp.Header.Get(router_http.VcapRouterHeader)).To(Equal(""))
 					Expect(backendResp.Header.Get(router_http.VcapBackendHeader)).To(Equal(""))
 					Expect(backendResp.Header.Get(router_http.VcapBackendHeader)).To(Equal(""))
+					Expect(backendResp.Header.Get(router_http.VcapTraceTimingHeader)).To(Equal(""))
 				})
 			})
 
@@ -253,6 +332,7 @@ var _ = Describe("ProxyRoundTripper", func() {
 				_, err := proxyRoundTripper.RoundTrip(req)
 				Expect(err).To(MatchError(dialError))
 				Expect(transport.RoundTripCallCount()).To(Equal(3))
+				Expect(reqInfo.Attempts).To(Equal(3))
 
 				Expect(resp.Code).To(Equal(http.StatusBadGateway))
 				Expect(resp.Header().Get(router_http.CfRouterError)).To(Equal("endpoint_failure"))
@@ -368,6 +448,72 @@ var _ = Describe("ProxyRoundTripper", func() {
 			})
 		})
 
+		Context("when retries are configured", func() {
+			newRoundTripper := func() {
+				proxyRoundTripper = round_tripper.NewProxyRoundTripper(
+					transport, http2Transport, tlsTransports, http2TLSTransports, logger, "my_trace_key", routerIP, "",
+					combinedReporter, false, []string{round_tripper.StickyCookieKey}, retries,
+					longLivedTimeout, reloadable, 1234,
+				)
+			}
+
+			Context("when max_retries is set", func() {
+				BeforeEach(func() {
+					retries.MaxRetries = 4
+					newRoundTripper()
+					transport.RoundTripReturns(nil, dialError)
+				})
+
+				It("retries max_retries times", func() {
+					_, err := proxyRoundTripper.RoundTrip(req)
+					Expect(err).To(MatchError(dialError))
+					Expect(transport.RoundTripCallCount()).To(Equal(5))
+				})
+			})
+
+			Context("when the request method is not retryable", func() {
+				BeforeEach(func() {
+					retries.Methods = map[string]bool{"GET": true}
+					newRoundTripper()
+					req.Method = "POST"
+				})
+
+				It("does not retry after the connection is reset", func() {
+					transport.RoundTripReturns(nil, connResetError)
+
+					_, err := proxyRoundTripper.RoundTrip(req)
+					Expect(err).To(MatchError(connResetError))
+					Expect(transport.RoundTripCallCount()).To(Equal(1))
+					Expect(resp.Code).To(Equal(http.StatusBadGateway))
+				})
+
+				It("retries after a dial error", func() {
+					transport.RoundTripReturns(nil, dialError)
+
+					_, err := proxyRoundTripper.RoundTrip(req)
+					Expect(err).To(MatchError(dialError))
+					Expect(transport.RoundTripCallCount()).To(Equal(3))
+				})
+			})
+
+			Context("when the retry budget is exhausted", func() {
+				BeforeEach(func() {
+					retries.BudgetPercent = 0
+					retries.MinRetryConcurrency = 0
+					newRoundTripper()
+					transport.RoundTripReturns(nil, dialError)
+				})
+
+				It("does not retry and returns status bad gateway", func() {
+					_, err := proxyRoundTripper.RoundTrip(req)
+					Expect(err).To(MatchError(dialError))
+					Expect(transport.RoundTripCallCount()).To(Equal(1))
+					Expect(resp.Code).To(Equal(http.StatusBadGateway))
+					Expect(logger.Buffer()).To(gbytes.Say(`retry-budget-exhausted`))
+				})
+			})
+		})
+
 		Context("when there are no more endpoints available", func() {
 			BeforeEach(func() {
 				removed := routePool.Remove(endpoint)
@@ -422,6 +568,167 @@ var _ = Describe("ProxyRoundTripper", func() {
 			})
 		})
 
+		Context("when the request body is larger than the route allows", func() {
+			BeforeEach(func() {
+				transport.RoundTripReturns(nil, handlers.ErrRequestBodyTooLarge)
+			})
+
+			It("does not retry and returns status request entity too large", func() {
+				_, err := proxyRoundTripper.RoundTrip(req)
+				Expect(err).To(Equal(handlers.ErrRequestBodyTooLarge))
+				Expect(transport.RoundTripCallCount()).To(Equal(1))
+
+				Expect(resp.Code).To(Equal(http.StatusRequestEntityTooLarge))
+				Expect(resp.Header().Get("Connection")).To(Equal("close"))
+				Expect(resp.Header().Get(router_http.CfRouterError)).To(Equal("request_body_too_large"))
+				bodyBytes, err := ioutil.ReadAll(resp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(bodyBytes)).To(ContainSubstring(round_tripper.RequestBodyTooLargeMessage))
+				Expect(combinedReporter.CaptureBadGatewayCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when every endpoint is at its connection limit", func() {
+			BeforeEach(func() {
+				endpoint.MaxConnections = 1
+				endpoint.Stats.NumberConnections.Increment()
+			})
+
+			It("returns a 503 Service Unavailable response with a Retry-After", func() {
+				backendRes, err := proxyRoundTripper.RoundTrip(req)
+				Expect(err).To(Equal(handler.EndpointsSaturated))
+				Expect(backendRes).To(BeNil())
+
+				Expect(resp.Code).To(Equal(http.StatusServiceUnavailable))
+				Expect(resp.Header().Get("Retry-After")).To(Equal(round_tripper.SaturatedRetryAfter))
+				Expect(resp.Header().Get(router_http.CfRouterError)).To(Equal("endpoints_saturated"))
+				bodyBytes, err := ioutil.ReadAll(resp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(bodyBytes)).To(ContainSubstring(round_tripper.SaturatedMessage))
+
+				Expect(transport.RoundTripCallCount()).To(Equal(0))
+				Expect(combinedReporter.CaptureBadGatewayCallCount()).To(Equal(0))
+			})
+
+			It("routes to the endpoint once a request in flight completes", func() {
+				endpoint.Stats.NumberConnections.Decrement()
+				transport.RoundTripReturns(&http.Response{StatusCode: http.StatusOK, Body: &testBody{}}, nil)
+
+				backendRes, err := proxyRoundTripper.RoundTrip(req)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(transport.RoundTripCallCount()).To(Equal(1))
+				Expect(endpoint.Stats.NumberConnections.Count()).To(Equal(int64(1)))
+
+				Expect(backendRes.Body.Close()).To(Succeed())
+				Expect(endpoint.Stats.NumberConnections.Count()).To(BeZero())
+			})
+
+			It("does not route more requests to the endpoint than its limit while responses are read", func() {
+				endpoint.Stats.NumberConnections.Decrement()
+				transport.RoundTripReturns(&http.Response{StatusCode: http.StatusOK, Body: &testBody{}}, nil)
+
+				backendRes, err := proxyRoundTripper.RoundTrip(req)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = proxyRoundTripper.RoundTrip(req)
+				Expect(err).To(Equal(handler.EndpointsSaturated))
+				Expect(transport.RoundTripCallCount()).To(Equal(1))
+
+				backendRes.Body.Close()
+				backendRes.Body.Close()
+				Expect(endpoint.Stats.NumberConnections.Count()).To(BeZero())
+			})
+		})
+
+		Context("when the application of the endpoint has a quota", func() {
+			BeforeEach(func() {
+				cfg := config.AppQuotaConfig{MaxConcurrentRequests: 1}
+				handlers.NewAppQuota(cfg, combinedReporter, logger, clock.NewClock()).ServeHTTP(nil, req, func(http.ResponseWriter, *http.Request) {})
+				transport.RoundTripReturns(&http.Response{StatusCode: http.StatusOK, Body: &testBody{}}, nil)
+			})
+
+			It("counts the request against the application of the endpoint", func() {
+				_, err := proxyRoundTripper.RoundTrip(req)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(combinedReporter.CaptureAppRequestCallCount()).To(Equal(1))
+				Expect(combinedReporter.CaptureAppRequestArgsForCall(0)).To(Equal("appId"))
+			})
+
+			It("returns a 429 Too Many Requests response while the application is over its quota", func() {
+				backendRes, err := proxyRoundTripper.RoundTrip(req)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = proxyRoundTripper.RoundTrip(req)
+				Expect(err).To(Equal(handlers.ErrAppQuotaExceeded))
+				Expect(resp.Code).To(Equal(http.StatusTooManyRequests))
+				Expect(resp.Header().Get(router_http.CfRouterError)).To(Equal("app_quota_exceeded"))
+				Expect(transport.RoundTripCallCount()).To(Equal(1))
+				Expect(endpoint.Stats.NumberConnections.Count()).To(Equal(int64(1)))
+				Expect(combinedReporter.CaptureAppQuotaExceededArgsForCall(0)).To(Equal("appId"))
+				Expect(combinedReporter.CaptureBadGatewayCallCount()).To(Equal(0))
+
+				Expect(backendRes.Body.Close()).To(Succeed())
+				_, err = proxyRoundTripper.RoundTrip(req)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(transport.RoundTripCallCount()).To(Equal(2))
+			})
+
+			It("gives back the request when the endpoint fails", func() {
+				transport.RoundTripReturnsOnCall(0, nil, dialError)
+
+				_, err := proxyRoundTripper.RoundTrip(req)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(transport.RoundTripCallCount()).To(Equal(2))
+			})
+		})
+
+		Context("when the circuit breaker is enabled", func() {
+			var otherEndpoint *route.Endpoint
+
+			BeforeEach(func() {
+				routePool.SetCircuitBreaker(config.CircuitBreakerConfig{
+					ConsecutiveFailures: 1,
+					BaseEjectionTime:    time.Minute,
+					MaxEjectionTime:     time.Minute,
+				})
+				otherEndpoint = route.NewEndpoint("appId", "2.2.2.2", uint16(9090), "otherId", "2",
+					map[string]string{}, 0, "", models.ModificationTag{}, "")
+				Expect(routePool.Put(otherEndpoint)).To(BeTrue())
+			})
+
+			failedEndpoint := func() *route.Endpoint {
+				Expect(transport.RoundTripCallCount()).To(Equal(1))
+				if transport.RoundTripArgsForCall(0).URL.Host == endpoint.CanonicalAddr() {
+					return endpoint
+				}
+				return otherEndpoint
+			}
+
+			It("ejects endpoints that respond with a server error", func() {
+				transport.RoundTripReturns(&http.Response{StatusCode: http.StatusServiceUnavailable}, nil)
+
+				_, err := proxyRoundTripper.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+
+				ejected := failedEndpoint()
+				iter := routePool.Endpoints("", "", "")
+				for i := 0; i < 2; i++ {
+					Expect(iter.Next()).ToNot(Equal(ejected))
+				}
+			})
+
+			It("does not eject endpoints that respond successfully", func() {
+				transport.RoundTripReturns(&http.Response{StatusCode: http.StatusOK}, nil)
+
+				_, err := proxyRoundTripper.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+
+				iter := routePool.Endpoints("", "", "")
+				Expect([]*route.Endpoint{iter.Next(), iter.Next()}).To(ConsistOf(endpoint, otherEndpoint))
+			})
+		})
+
 		Context("when the first request to the backend fails", func() {
 			var firstRequest bool
 			BeforeEach(func() {
@@ -508,6 +815,319 @@ var _ = Describe("ProxyRoundTripper", func() {
 			})
 		})
 
+		Context("when the endpoint uses HTTP/2", func() {
+			BeforeEach(func() {
+				endpoint.Protocol = route.ProtocolHTTP2
+				http2Transport.RoundTripReturns(
+					&http.Response{StatusCode: http.StatusTeapot}, nil,
+				)
+			})
+
+			It("sends the request over the HTTP/2 transport", func() {
+				resp, err := proxyRoundTripper.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusTeapot))
+
+				Expect(http2Transport.RoundTripCallCount()).To(Equal(1))
+				Expect(transport.RoundTripCallCount()).To(Equal(0))
+			})
+
+			Context("when the request is a gRPC request", func() {
+				BeforeEach(func() {
+					req.Header.Set("Content-Type", "application/grpc+proto")
+				})
+
+				It("announces support for trailers to the backend", func() {
+					_, err := proxyRoundTripper.RoundTrip(req)
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(http2Transport.RoundTripCallCount()).To(Equal(1))
+					outReq := http2Transport.RoundTripArgsForCall(0)
+					Expect(outReq.Header.Get("Te")).To(Equal("trailers"))
+				})
+			})
+
+			Context("when the endpoint uses TLS", func() {
+				BeforeEach(func() {
+					endpoint.UseTLS = true
+					endpoint.ServerCertDomainSAN = "some-san"
+					http2TLSTransport.RoundTripReturns(
+						&http.Response{StatusCode: http.StatusTeapot}, nil,
+					)
+				})
+
+				It("sends the request over https with an HTTP/2 transport for the endpoint's SAN", func() {
+					resp, err := proxyRoundTripper.RoundTrip(req)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(resp.StatusCode).To(Equal(http.StatusTeapot))
+
+					Expect(http2TLSTransports.NewCallCount()).To(Equal(1))
+					Expect(http2TLSTransports.NewArgsForCall(0)).To(Equal("some-san"))
+
+					Expect(http2TLSTransport.RoundTripCallCount()).To(Equal(1))
+					outReq := http2TLSTransport.RoundTripArgsForCall(0)
+					Expect(outReq.URL.Scheme).To(Equal("https"))
+					Expect(http2Transport.RoundTripCallCount()).To(Equal(0))
+					Expect(tlsTransports.NewCallCount()).To(Equal(0))
+				})
+			})
+
+			Context("when the backend is unavailable due to dial error", func() {
+				BeforeEach(func() {
+					http2Transport.RoundTripReturns(nil, dialError)
+				})
+
+				It("retries 3 times", func() {
+					_, err := proxyRoundTripper.RoundTrip(req)
+					Expect(err).To(MatchError(ContainSubstring("error")))
+					Expect(http2Transport.RoundTripCallCount()).To(Equal(3))
+				})
+			})
+		})
+
+		Context("when the endpoint has a timeout", func() {
+			var body *testBody
+
+			BeforeEach(func() {
+				endpoint.Timeout = time.Minute
+				body = &testBody{}
+				transport.RoundTripReturns(&http.Response{StatusCode: http.StatusTeapot, Body: body}, nil)
+			})
+
+			It("sends the request with a deadline", func() {
+				_, err := proxyRoundTripper.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(transport.RoundTripCallCount()).To(Equal(1))
+				outReq := transport.RoundTripArgsForCall(0)
+				deadline, ok := outReq.Context().Deadline()
+				Expect(ok).To(BeTrue())
+				Expect(deadline).To(BeTemporally("~", time.Now().Add(time.Minute), time.Second))
+
+				timeout, ok := round_tripper.ContextEndpointTimeout(outReq.Context())
+				Expect(ok).To(BeTrue())
+				Expect(timeout).To(Equal(time.Minute))
+			})
+
+			It("releases the request context when the response body is closed", func() {
+				resp, err := proxyRoundTripper.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+
+				outReq := transport.RoundTripArgsForCall(0)
+				Expect(outReq.Context().Err()).ToNot(HaveOccurred())
+
+				Expect(resp.Body.Close()).To(Succeed())
+				Expect(body.closeCount).To(Equal(1))
+				Expect(outReq.Context().Err()).To(Equal(context.Canceled))
+			})
+		})
+
+		Context("when the virtual host of the request has a timeout", func() {
+			BeforeEach(func() {
+				reqInfo.VirtualHost = &config.VirtualHostConfig{Domain: "myapp.com", EndpointTimeout: 2 * time.Minute}
+			})
+
+			It("sends the request with the deadline of the virtual host", func() {
+				_, err := proxyRoundTripper.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+
+				outReq := transport.RoundTripArgsForCall(0)
+				timeout, ok := round_tripper.ContextEndpointTimeout(outReq.Context())
+				Expect(ok).To(BeTrue())
+				Expect(timeout).To(Equal(2 * time.Minute))
+			})
+
+			It("prefers the timeout of the endpoint", func() {
+				endpoint.Timeout = time.Minute
+
+				_, err := proxyRoundTripper.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+
+				outReq := transport.RoundTripArgsForCall(0)
+				timeout, ok := round_tripper.ContextEndpointTimeout(outReq.Context())
+				Expect(ok).To(BeTrue())
+				Expect(timeout).To(Equal(time.Minute))
+			})
+		})
+
+		Context("when dial, response header and idle timeouts are configured", func() {
+			BeforeEach(func() {
+				c := config.DefaultConfig()
+				c.EndpointDialTimeout = 2 * time.Second
+				c.EndpointResponseHeaderTimeout = 20 * time.Millisecond
+				c.EndpointIdleTimeout = 20 * time.Millisecond
+				reloadable.Set(c)
+			})
+
+			It("sends the request with the dial timeout of the router", func() {
+				_, err := proxyRoundTripper.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+
+				outReq := transport.RoundTripArgsForCall(0)
+				timeout, ok := round_tripper.ContextDialTimeout(outReq.Context())
+				Expect(ok).To(BeTrue())
+				Expect(timeout).To(Equal(2 * time.Second))
+			})
+
+			It("prefers the dial timeout of the endpoint", func() {
+				endpoint.DialTimeout = time.Second
+
+				_, err := proxyRoundTripper.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+
+				outReq := transport.RoundTripArgsForCall(0)
+				timeout, ok := round_tripper.ContextDialTimeout(outReq.Context())
+				Expect(ok).To(BeTrue())
+				Expect(timeout).To(Equal(time.Second))
+			})
+
+			It("fails requests whose response headers do not arrive in time", func() {
+				transport.RoundTripStub = func(req *http.Request) (*http.Response, error) {
+					<-req.Context().Done()
+					return nil, req.Context().Err()
+				}
+
+				_, err := proxyRoundTripper.RoundTrip(req)
+				Expect(err).To(MatchError(round_tripper.ErrResponseHeaderTimeout))
+			})
+
+			It("does not time out a response body that keeps being read", func() {
+				endpoint.ResponseHeaderTimeout = time.Hour
+				transport.RoundTripReturns(&http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(&slowReader{chunks: 5, delay: 10 * time.Millisecond})}, nil)
+
+				resp, err := proxyRoundTripper.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+
+				outReq := transport.RoundTripArgsForCall(0)
+				_, err = ioutil.ReadAll(resp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(outReq.Context().Err()).ToNot(HaveOccurred())
+				Expect(resp.Body.Close()).To(Succeed())
+			})
+
+			It("cancels the request when the response body is idle", func() {
+				transport.RoundTripReturns(&http.Response{StatusCode: http.StatusOK, Body: &testBody{}}, nil)
+
+				_, err := proxyRoundTripper.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+
+				outReq := transport.RoundTripArgsForCall(0)
+				Eventually(outReq.Context().Err).Should(Equal(context.Canceled))
+			})
+		})
+
+		Context("when the request is long-lived", func() {
+			BeforeEach(func() {
+				reqInfo.LongLived = true
+				endpoint.Timeout = time.Minute
+			})
+
+			It("sends the request without a deadline", func() {
+				_, err := proxyRoundTripper.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+
+				outReq := transport.RoundTripArgsForCall(0)
+				_, ok := outReq.Context().Deadline()
+				Expect(ok).To(BeFalse())
+
+				timeout, ok := round_tripper.ContextEndpointTimeout(outReq.Context())
+				Expect(ok).To(BeTrue())
+				Expect(timeout).To(BeZero())
+			})
+
+			Context("when long-lived requests have a timeout", func() {
+				BeforeEach(func() {
+					longLivedTimeout = time.Hour
+					proxyRoundTripper = round_tripper.NewProxyRoundTripper(
+						transport, http2Transport, tlsTransports, http2TLSTransports, logger, "my_trace_key", routerIP, "",
+						combinedReporter, false, []string{round_tripper.StickyCookieKey}, retries,
+						longLivedTimeout, reloadable, 1234,
+					)
+				})
+
+				It("sends the request with that deadline instead of the endpoint's", func() {
+					_, err := proxyRoundTripper.RoundTrip(req)
+					Expect(err).ToNot(HaveOccurred())
+
+					outReq := transport.RoundTripArgsForCall(0)
+					timeout, ok := round_tripper.ContextEndpointTimeout(outReq.Context())
+					Expect(ok).To(BeTrue())
+					Expect(timeout).To(Equal(time.Hour))
+				})
+			})
+
+			Context("when the request has a hash key", func() {
+				BeforeEach(func() {
+					for i := 2; i <= 4; i++ {
+						e := route.NewEndpoint("appId", fmt.Sprintf("1.1.1.%d", i), uint16(9090), fmt.Sprintf("instanceId%d", i), "1",
+							map[string]string{}, 0, "", models.ModificationTag{}, "")
+						Expect(routePool.Put(e)).To(BeTrue())
+					}
+					reqInfo.HashKey = "10.0.0.1"
+				})
+
+				It("sends the requests to the same endpoint", func() {
+					var addrs []string
+					for i := 0; i < 5; i++ {
+						_, err := proxyRoundTripper.RoundTrip(req)
+						Expect(err).ToNot(HaveOccurred())
+						addrs = append(addrs, reqInfo.RouteEndpoint.CanonicalAddr())
+					}
+					for _, addr := range addrs {
+						Expect(addr).To(Equal(addrs[0]))
+					}
+				})
+			})
+		})
+
+		Context("when the endpoint does not have a timeout", func() {
+			It("sends the request without a deadline", func() {
+				_, err := proxyRoundTripper.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+
+				outReq := transport.RoundTripArgsForCall(0)
+				_, ok := outReq.Context().Deadline()
+				Expect(ok).To(BeFalse())
+			})
+		})
+
+		Context("when the endpoint uses TLS", func() {
+			BeforeEach(func() {
+				endpoint.UseTLS = true
+				endpoint.ServerCertDomainSAN = "some-san"
+				tlsTransport.RoundTripReturns(
+					&http.Response{StatusCode: http.StatusTeapot}, nil,
+				)
+			})
+
+			It("sends the request over https with a transport for the endpoint's SAN", func() {
+				resp, err := proxyRoundTripper.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusTeapot))
+
+				Expect(tlsTransports.NewCallCount()).To(Equal(1))
+				Expect(tlsTransports.NewArgsForCall(0)).To(Equal("some-san"))
+
+				Expect(tlsTransport.RoundTripCallCount()).To(Equal(1))
+				outReq := tlsTransport.RoundTripArgsForCall(0)
+				Expect(outReq.URL.Scheme).To(Equal("https"))
+				Expect(outReq.URL.Host).To(Equal("1.1.1.1:9090"))
+				Expect(transport.RoundTripCallCount()).To(Equal(0))
+			})
+
+			Context("when the backend is unavailable due to dial error", func() {
+				BeforeEach(func() {
+					tlsTransport.RoundTripReturns(nil, dialError)
+				})
+
+				It("retries 3 times", func() {
+					_, err := proxyRoundTripper.RoundTrip(req)
+					Expect(err).To(MatchError(ContainSubstring("error")))
+					Expect(tlsTransport.RoundTripCallCount()).To(Equal(3))
+				})
+			})
+		})
+
 		Context("when the request context contains a Route Service URL", func() {
 			var routeServiceURL *url.URL
 			BeforeEach(func() {
@@ -752,12 +1372,63 @@ var _ = Describe("ProxyRoundTripper", func() {
 					})
 				})
 			})
+			Context("and a custom session cookie name is configured", func() {
+				BeforeEach(func() {
+					sessionCookie.Name = "PHPSESSID"
+					proxyRoundTripper = round_tripper.NewProxyRoundTripper(
+						transport, http2Transport, tlsTransports, http2TLSTransports, logger, "my_trace_key", routerIP, "",
+						combinedReporter, false, []string{round_tripper.StickyCookieKey, "PHPSESSID"}, retries,
+						longLivedTimeout, reloadable, 1234,
+					)
+				})
+
+				It("adds the vcap cookie for the custom session cookie", func() {
+					resp, err := proxyRoundTripper.RoundTrip(req)
+					Expect(err).ToNot(HaveOccurred())
+
+					cookies := resp.Cookies()
+					Expect(cookies).To(HaveLen(2))
+					Expect(cookies[0].Name).To(Equal("PHPSESSID"))
+					Expect(cookies[1].Name).To(Equal(round_tripper.VcapCookieId))
+				})
+
+				It("selects the previous backend for the custom session cookie", func() {
+					resp, err := proxyRoundTripper.RoundTrip(req)
+					Expect(err).ToNot(HaveOccurred())
+					cookies := resp.Cookies()
+					for _, cookie := range cookies {
+						req.AddCookie(cookie)
+					}
+
+					for i := 0; i < 5; i++ {
+						resp, err = proxyRoundTripper.RoundTrip(req)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(resp.Cookies()[1].Value).To(Equal(cookies[1].Value))
+					}
+				})
+			})
+
+			Context("and the session cookie name is not configured", func() {
+				BeforeEach(func() {
+					sessionCookie.Name = "PHPSESSID"
+				})
+
+				It("does not add the vcap cookie", func() {
+					resp, err := proxyRoundTripper.RoundTrip(req)
+					Expect(err).ToNot(HaveOccurred())
+
+					cookies := resp.Cookies()
+					Expect(cookies).To(HaveLen(1))
+					Expect(cookies[0].Name).To(Equal("PHPSESSID"))
+				})
+			})
 		})
 
 		It("can cancel requests", func() {
 			proxyRoundTripper.CancelRequest(req)
 			Expect(transport.CancelRequestCallCount()).To(Equal(1))
 			Expect(transport.CancelRequestArgsForCall(0)).To(Equal(req))
+			Expect(http2Transport.CancelRequestCallCount()).To(Equal(1))
 		})
 	})
 })
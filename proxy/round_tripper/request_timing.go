@@ -0,0 +1,156 @@
+package round_tripper
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/handlers"
+	"github.com/uber-go/zap"
+)
+
+// requestTiming records the timing of a request. The DNS lookup, dial,
+// TLS handshake and time to first byte are those of the last attempt, while
+// the total includes the retries.
+type requestTiming struct {
+	lock sync.Mutex
+
+	start        time.Time
+	attemptStart time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+
+	dns    time.Duration
+	dial   time.Duration
+	tls    time.Duration
+	ttfb   time.Duration
+	total  time.Duration
+	reused bool
+}
+
+// traceTiming returns the request with a trace recording its timing.
+func traceTiming(request *http.Request) (*http.Request, *requestTiming) {
+	t := &requestTiming{start: time.Now()}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.lock.Lock()
+			t.reused = info.Reused
+			t.lock.Unlock()
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.lock.Lock()
+			t.dnsStart = time.Now()
+			t.lock.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.lock.Lock()
+			t.dns = time.Since(t.dnsStart)
+			t.lock.Unlock()
+		},
+		ConnectStart: func(string, string) {
+			t.lock.Lock()
+			// dual-stack dials start several connections
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+			t.lock.Unlock()
+		},
+		ConnectDone: func(string, string, error) {
+			t.lock.Lock()
+			t.dial = time.Since(t.connectStart)
+			t.lock.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.lock.Lock()
+			t.tlsStart = time.Now()
+			t.lock.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.lock.Lock()
+			t.tls = time.Since(t.tlsStart)
+			t.lock.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.lock.Lock()
+			t.ttfb = time.Since(t.attemptStart)
+			t.lock.Unlock()
+		},
+	}
+	return request.WithContext(httptrace.WithClientTrace(request.Context(), trace)), t
+}
+
+// attempt resets the timing of the previous attempt.
+func (t *requestTiming) attempt() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.attemptStart = time.Now()
+	t.dnsStart, t.connectStart, t.tlsStart = time.Time{}, time.Time{}, time.Time{}
+	t.dns, t.dial, t.tls, t.ttfb = 0, 0, 0, 0
+	t.reused = false
+}
+
+// finish records the total time of the request.
+func (t *requestTiming) finish() {
+	t.lock.Lock()
+	t.total = time.Since(t.start)
+	t.lock.Unlock()
+}
+
+// breakdown returns the timing of the last attempt.
+func (t *requestTiming) breakdown() handlers.RequestTiming {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return handlers.RequestTiming{
+		DNS:    t.dns,
+		Dial:   t.dial,
+		TLS:    t.tls,
+		TTFB:   t.ttfb,
+		Reused: t.reused,
+	}
+}
+
+// header returns the timing in seconds, the retries and the endpoint in the
+// format of the X-Vcap-Trace-Timing header.
+func (t *requestTiming) header(retries int, endpoint string) string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	fields := []string{
+		"dns=" + formatSeconds(t.dns),
+		"dial=" + formatSeconds(t.dial),
+		"tls=" + formatSeconds(t.tls),
+		"ttfb=" + formatSeconds(t.ttfb),
+		"total=" + formatSeconds(t.total),
+		"retries=" + strconv.Itoa(retries),
+		"reused=" + strconv.FormatBool(t.reused),
+	}
+	if endpoint != "" {
+		fields = append(fields, "endpoint="+endpoint)
+	}
+	return strings.Join(fields, " ")
+}
+
+func (t *requestTiming) logData(retries int, endpoint string) []zap.Field {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return []zap.Field{
+		zap.Duration("dns", t.dns),
+		zap.Duration("dial", t.dial),
+		zap.Duration("tls", t.tls),
+		zap.Duration("ttfb", t.ttfb),
+		zap.Duration("total", t.total),
+		zap.Int("retries", retries),
+		zap.Bool("reused", t.reused),
+		zap.String("endpoint", endpoint),
+	}
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 6, 64)
+}
@@ -0,0 +1,62 @@
+package round_tripper
+
+import "sync"
+
+// RetryBudget limits how many requests may be retried at the same time, so
+// that retries cannot multiply the load on backends that are already failing.
+// A retry is allowed while the requests being retried stay below percent of
+// the requests in flight, or below minConcurrency, whichever is larger.
+type RetryBudget struct {
+	percent        float64
+	minConcurrency int
+
+	lock     sync.Mutex
+	active   int
+	retrying int
+}
+
+func NewRetryBudget(percent float64, minConcurrency int) *RetryBudget {
+	return &RetryBudget{
+		percent:        percent,
+		minConcurrency: minConcurrency,
+	}
+}
+
+// RequestStarted records a request in flight.
+func (b *RetryBudget) RequestStarted() {
+	b.lock.Lock()
+	b.active++
+	b.lock.Unlock()
+}
+
+// RequestFinished records the end of a request started with RequestStarted.
+func (b *RetryBudget) RequestFinished() {
+	b.lock.Lock()
+	b.active--
+	b.lock.Unlock()
+}
+
+// TryRetry reports whether a request in flight may be retried. When it
+// returns true the request counts against the budget until RetryFinished is
+// called.
+func (b *RetryBudget) TryRetry() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	allowed := int(float64(b.active) * b.percent / 100)
+	if allowed < b.minConcurrency {
+		allowed = b.minConcurrency
+	}
+	if b.retrying >= allowed {
+		return false
+	}
+	b.retrying++
+	return true
+}
+
+// RetryFinished releases a retry granted by TryRetry.
+func (b *RetryBudget) RetryFinished() {
+	b.lock.Lock()
+	b.retrying--
+	b.lock.Unlock()
+}
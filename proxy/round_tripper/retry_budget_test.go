@@ -0,0 +1,57 @@
+package round_tripper_test
+
+import (
+	"code.cloudfoundry.org/gorouter/proxy/round_tripper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RetryBudget", func() {
+	var budget *round_tripper.RetryBudget
+
+	BeforeEach(func() {
+		budget = round_tripper.NewRetryBudget(20, 1)
+	})
+
+	It("allows min concurrency retries when few requests are in flight", func() {
+		budget.RequestStarted()
+		budget.RequestStarted()
+
+		Expect(budget.TryRetry()).To(BeTrue())
+		Expect(budget.TryRetry()).To(BeFalse())
+	})
+
+	It("allows retries for a percentage of the requests in flight", func() {
+		for i := 0; i < 10; i++ {
+			budget.RequestStarted()
+		}
+
+		Expect(budget.TryRetry()).To(BeTrue())
+		Expect(budget.TryRetry()).To(BeTrue())
+		Expect(budget.TryRetry()).To(BeFalse())
+	})
+
+	It("allows retries again once retries finish", func() {
+		budget.RequestStarted()
+		Expect(budget.TryRetry()).To(BeTrue())
+		Expect(budget.TryRetry()).To(BeFalse())
+
+		budget.RetryFinished()
+		Expect(budget.TryRetry()).To(BeTrue())
+	})
+
+	It("shrinks as requests finish", func() {
+		for i := 0; i < 10; i++ {
+			budget.RequestStarted()
+		}
+		Expect(budget.TryRetry()).To(BeTrue())
+		budget.RetryFinished()
+
+		for i := 0; i < 5; i++ {
+			budget.RequestFinished()
+		}
+		Expect(budget.TryRetry()).To(BeTrue())
+		Expect(budget.TryRetry()).To(BeFalse())
+	})
+})
@@ -0,0 +1,94 @@
+package round_tripper
+
+import (
+	"net/http"
+
+	"code.cloudfoundry.org/gorouter/handlers"
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/wasm"
+	"github.com/uber-go/zap"
+)
+
+// NewWasmRoundTripper passes requests through the global WebAssembly filters
+// followed by the filters of their route, and their responses through the
+// same filters in reverse order. A filter that responds to a request itself
+// stops it from reaching the following filters and p, and its response passes
+// through the filters before it. Requests on their way to a route service are
+// filtered when they return from it. Requests for routes with filters that
+// are not configured fail.
+func NewWasmRoundTripper(p ProxyRoundTripper, plugins *wasm.Plugins, logger logger.Logger) ProxyRoundTripper {
+	return &wasmRoundTripper{
+		p:       p,
+		plugins: plugins,
+		logger:  logger,
+	}
+}
+
+type wasmRoundTripper struct {
+	p       ProxyRoundTripper
+	plugins *wasm.Plugins
+	logger  logger.Logger
+}
+
+func (w *wasmRoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	reqInfo, err := handlers.ContextRequestInfo(request)
+	if err != nil || reqInfo.RoutePool == nil || reqInfo.RouteServiceURL != nil {
+		return w.p.RoundTrip(request)
+	}
+	chain, err := w.plugins.Chain(reqInfo.RoutePool.WasmFilters())
+	if err != nil {
+		return nil, err
+	}
+	if len(chain) == 0 {
+		return w.p.RoundTrip(request)
+	}
+
+	filters := make([]*wasm.Filter, 0, len(chain))
+	defer func() {
+		for _, f := range filters {
+			f.Close()
+		}
+	}()
+
+	for _, plugin := range chain {
+		f, err := plugin.NewFilter(request.Context())
+		if err != nil {
+			w.logger.Error("wasm-filter-failed", zap.String("filter", plugin.Name()), zap.Error(err))
+			return nil, err
+		}
+		res, err := f.OnRequest(request)
+		if err != nil {
+			w.logger.Error("wasm-filter-failed", zap.String("filter", plugin.Name()), zap.Error(err))
+			f.Close()
+			return nil, err
+		}
+		if res != nil {
+			f.Close()
+			return w.onResponse(filters, chain, res)
+		}
+		filters = append(filters, f)
+	}
+
+	res, err := w.p.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	return w.onResponse(filters, chain, res)
+}
+
+// onResponse passes the response through the filters in reverse order.
+func (w *wasmRoundTripper) onResponse(filters []*wasm.Filter, chain []*wasm.Plugin, res *http.Response) (*http.Response, error) {
+	for i := len(filters) - 1; i >= 0; i-- {
+		var err error
+		res, err = filters[i].OnResponse(res)
+		if err != nil {
+			w.logger.Error("wasm-filter-failed", zap.String("filter", chain[i].Name()), zap.Error(err))
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (w *wasmRoundTripper) CancelRequest(request *http.Request) {
+	w.p.CancelRequest(request)
+}
@@ -0,0 +1,125 @@
+package round_tripper_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/handlers"
+	"code.cloudfoundry.org/gorouter/proxy/round_tripper"
+	roundtripperfakes "code.cloudfoundry.org/gorouter/proxy/round_tripper/fakes"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/gorouter/wasm"
+	"code.cloudfoundry.org/routing-api/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WasmRoundTripper", func() {
+	var (
+		wasmRoundTripper  round_tripper.ProxyRoundTripper
+		proxyRoundTripper *roundtripperfakes.FakeProxyRoundTripper
+		plugins           *wasm.Plugins
+		routePool         *route.Pool
+		endpoint          *route.Endpoint
+		req               *http.Request
+	)
+
+	BeforeEach(func() {
+		code, err := ioutil.ReadFile("../../test/assets/wasm/filter.wasm")
+		Expect(err).ToNot(HaveOccurred())
+
+		logger := test_util.NewTestZapLogger("wasm-round-tripper-test")
+		plugins, err = wasm.NewPlugins(context.Background(), config.WasmConfig{
+			Filters: []config.WasmFilterConfig{
+				{Name: "global", Code: code, Configuration: "global", Global: true},
+				{Name: "route", Code: code, Configuration: "route"},
+			},
+			MaxBodySizeBytes: 1024,
+		}, logger)
+		Expect(err).ToNot(HaveOccurred())
+
+		proxyRoundTripper = new(roundtripperfakes.FakeProxyRoundTripper)
+		proxyRoundTripper.RoundTripStub = func(*http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        http.Header{},
+				Body:          ioutil.NopCloser(strings.NewReader("hello")),
+				ContentLength: 5,
+			}, nil
+		}
+		wasmRoundTripper = round_tripper.NewWasmRoundTripper(proxyRoundTripper, plugins, logger)
+
+		routePool = route.NewPool(1*time.Second, "")
+		endpoint = route.NewEndpoint("appId", "1.1.1.1", uint16(9090), "instanceId", "1",
+			map[string]string{}, 0, "", models.ModificationTag{}, "")
+		endpoint.WasmFilters = []string{"route"}
+		routePool.Put(endpoint)
+
+		req = test_util.NewRequest("GET", "myapp.com", "/", nil)
+		handlers.NewRequestInfo().ServeHTTP(nil, req, func(_ http.ResponseWriter, transformedReq *http.Request) {
+			req = transformedReq
+		})
+		reqInfo, err := handlers.ContextRequestInfo(req)
+		Expect(err).ToNot(HaveOccurred())
+		reqInfo.RoutePool = routePool
+	})
+
+	AfterEach(func() {
+		plugins.Close(context.Background())
+	})
+
+	It("passes requests through the global filters and the filters of the route, and responses back", func() {
+		res, err := wasmRoundTripper.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		Expect(res.Header["X-Wasm-Filter"]).To(Equal([]string{"route", "global"}))
+
+		Expect(proxyRoundTripper.RoundTripCallCount()).To(Equal(1))
+		backendReq := proxyRoundTripper.RoundTripArgsForCall(0)
+		Expect(backendReq.Header["X-Wasm-Filter"]).To(Equal([]string{"global", "route"}))
+	})
+
+	It("responds with the response of a filter that responds to the request", func() {
+		req.Header.Set("X-Wasm-Deny", "true")
+
+		res, err := wasmRoundTripper.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.StatusCode).To(Equal(http.StatusForbidden))
+		Expect(proxyRoundTripper.RoundTripCallCount()).To(Equal(0))
+	})
+
+	It("only passes requests through the global filters for routes without filters", func() {
+		endpoint.WasmFilters = nil
+
+		res, err := wasmRoundTripper.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Header["X-Wasm-Filter"]).To(Equal([]string{"global"}))
+	})
+
+	It("fails requests for routes with filters that are not configured", func() {
+		endpoint.WasmFilters = []string{"route", "unknown"}
+
+		_, err := wasmRoundTripper.RoundTrip(req)
+		Expect(err).To(HaveOccurred())
+		Expect(proxyRoundTripper.RoundTripCallCount()).To(Equal(0))
+	})
+
+	It("does not filter requests to route services", func() {
+		reqInfo, err := handlers.ContextRequestInfo(req)
+		Expect(err).ToNot(HaveOccurred())
+		reqInfo.RouteServiceURL, err = url.Parse("https://rs.example.com")
+		Expect(err).ToNot(HaveOccurred())
+
+		res, err := wasmRoundTripper.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Header).ToNot(HaveKey("X-Wasm-Filter"))
+		Expect(req.Header).ToNot(HaveKey("X-Wasm-Filter"))
+	})
+})
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"time"
 
+	"code.cloudfoundry.org/gorouter/config"
 	"code.cloudfoundry.org/gorouter/proxy"
 	"code.cloudfoundry.org/gorouter/test_util"
 
@@ -145,6 +146,25 @@ var _ = Describe("Session Affinity", func() {
 			})
 		})
 
+		Context("when the context path has a wildcard segment", func() {
+			It("sets the cookie path up to the wildcard", func() {
+				ln := registerHandlerWithInstanceId(r, "app.com/users/*/avatar", "", responseWithJSessionID, "instance-id-1")
+				defer ln.Close()
+
+				conn := dialProxy(proxyServer)
+				req := test_util.NewRequest("GET", "app.com", "/users/42/avatar", nil)
+				conn.WriteRequest(req)
+
+				Eventually(done).Should(Receive())
+
+				resp, _ := conn.ReadResponse()
+				cookie := getCookie(proxy.VcapCookieId, resp.Cookies())
+				Expect(cookie).ToNot(BeNil())
+				Expect(cookie.Path).To(Equal("/users"))
+				Expect(cookie.Value).To(Equal("instance-id-1"))
+			})
+		})
+
 	})
 
 	Context("first request", func() {
@@ -361,6 +381,53 @@ var _ = Describe("Session Affinity", func() {
 			})
 		})
 	})
+
+	Context("with the hash balancing algorithm", func() {
+		var servedBy chan string
+
+		respondAs := func(instanceId string) connHandler {
+			return func(x *test_util.HttpConn) {
+				_, err := http.ReadRequest(x.Reader)
+				Expect(err).ToNot(HaveOccurred())
+
+				x.WriteResponse(test_util.NewResponse(http.StatusOK))
+				x.Close()
+				servedBy <- instanceId
+			}
+		}
+
+		BeforeEach(func() {
+			servedBy = make(chan string, 1)
+			conf.LoadBalance = config.LOAD_BALANCE_HASH
+			conf.HashBalancing = config.HashBalancingConfig{Key: config.HASH_KEY_HEADER, Header: "X-User"}
+		})
+
+		It("routes requests with the same key to the same instance without cookies", func() {
+			for _, id := range []string{"instance-id-1", "instance-id-2", "instance-id-3"} {
+				ln := registerHandlerWithInstanceId(r, "app", "", respondAs(id), id)
+				defer ln.Close()
+			}
+
+			var first string
+			for i := 0; i < 5; i++ {
+				conn := dialProxy(proxyServer)
+				req := test_util.NewRequest("GET", "app", "/", nil)
+				req.Header.Set("X-User", "some-user")
+				conn.WriteRequest(req)
+
+				var id string
+				Eventually(servedBy).Should(Receive(&id))
+				if i == 0 {
+					first = id
+				}
+				Expect(id).To(Equal(first))
+
+				resp, _ := conn.ReadResponse()
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+				Expect(getCookie(proxy.VcapCookieId, resp.Cookies())).To(BeNil())
+			}
+		})
+	})
 })
 
 func getCookie(name string, cookies []*http.Cookie) *http.Cookie {
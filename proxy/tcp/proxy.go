@@ -0,0 +1,140 @@
+package tcp
+
+import (
+	"io"
+	"net"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/common/proxyprotocol"
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/proxy/handler"
+	"code.cloudfoundry.org/gorouter/proxy/utils"
+	"code.cloudfoundry.org/gorouter/registry"
+	"code.cloudfoundry.org/gorouter/route"
+	"github.com/uber-go/zap"
+)
+
+const dialTimeout = 5 * time.Second
+
+// Proxy forwards raw TCP connections accepted on a router port to the
+// endpoints registered for that port.
+type Proxy struct {
+	logger               logger.Logger
+	registry             registry.Registry
+	loadBalance          string
+	proxyProtocolVersion int
+}
+
+// NewProxy returns a new TCP Proxy. When proxyProtocolVersion is 1 or 2, the
+// connections to endpoints start with a PROXY protocol header of that
+// version carrying the addresses of the client connection.
+func NewProxy(logger logger.Logger, registry registry.Registry, loadBalance string, proxyProtocolVersion int) *Proxy {
+	return &Proxy{
+		logger:               logger,
+		registry:             registry,
+		loadBalance:          loadBalance,
+		proxyProtocolVersion: proxyProtocolVersion,
+	}
+}
+
+// Serve accepts connections on the listener and proxies them to the
+// endpoints registered for port until the listener is closed.
+func (p *Proxy) Serve(listener net.Listener, port uint16) error {
+	var tempDelay time.Duration // how long to sleep on accept failure
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if tempDelay == 0 {
+					tempDelay = 5 * time.Millisecond
+				} else {
+					tempDelay *= 2
+				}
+				if max := 1 * time.Second; tempDelay > max {
+					tempDelay = max
+				}
+				p.logger.Error("tcp-accept-error", zap.Error(err), zap.Duration("retry-in", tempDelay))
+				time.Sleep(tempDelay)
+				continue
+			}
+			return err
+		}
+		tempDelay = 0
+
+		go p.handleConn(conn, port)
+	}
+}
+
+func (p *Proxy) handleConn(client net.Conn, port uint16) {
+	defer client.Close()
+
+	logger := p.logger.With(
+		zap.Uint("port", uint(port)),
+		zap.String("RemoteAddr", client.RemoteAddr().String()),
+	)
+
+	pool := p.registry.LookupTCP(port)
+	if pool == nil {
+		logger.Info("unknown-tcp-route")
+		return
+	}
+
+	// the client IP is the only attribute of a TCP connection to hash
+	clientIP, _, _ := net.SplitHostPort(client.RemoteAddr().String())
+	iter := pool.Endpoints(p.loadBalance, "", clientIP)
+	backend, endpoint, err := dial(iter, logger)
+	if err != nil {
+		logger.Error("tcp-route-failed", zap.Error(err))
+		return
+	}
+	defer backend.Close()
+	// the connection holds its slot for the lifetime of the stream
+	defer iter.PostRequest(endpoint)
+
+	if p.proxyProtocolVersion != 0 {
+		header := proxyprotocol.Header(p.proxyProtocolVersion, client.RemoteAddr(), client.LocalAddr())
+		if _, err := backend.Write(header); err != nil {
+			logger.Error("tcp-proxy-protocol-header-failed", zap.Error(err))
+			return
+		}
+	}
+
+	forwardIO(client, backend)
+}
+
+func dial(iter route.EndpointIterator, logger logger.Logger) (net.Conn, *route.Endpoint, error) {
+	var err error
+	for retry := 0; retry < handler.MaxRetries; retry++ {
+		endpoint := handler.NextEndpoint(iter)
+		if endpoint == nil {
+			return nil, nil, handler.NoEndpointsAvailable
+		}
+
+		var conn net.Conn
+		conn, err = utils.DialEndpoint("tcp", endpoint.CanonicalAddr(), dialTimeout)
+		if err == nil {
+			iter.EndpointSucceeded()
+			return conn, endpoint, nil
+		}
+
+		iter.EndpointFailed()
+		iter.PostRequest(endpoint)
+		logger.Error("tcp-connection-failed", zap.String("backend", endpoint.CanonicalAddr()), zap.Error(err))
+	}
+	return nil, nil, err
+}
+
+func forwardIO(a, b net.Conn) {
+	done := make(chan bool, 2)
+
+	copy := func(dst io.Writer, src io.Reader) {
+		// don't care about errors here
+		utils.Buffers.Copy(dst, src)
+		done <- true
+	}
+
+	go copy(a, b)
+	go copy(b, a)
+
+	<-done
+}
@@ -0,0 +1,196 @@
+package tcp_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/proxy/tcp"
+	"code.cloudfoundry.org/gorouter/registry/fakes"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/routing-api/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Proxy", func() {
+	var (
+		proxy    *tcp.Proxy
+		registry *fakes.FakeRegistry
+		pool     *route.Pool
+		listener net.Listener
+		backend  net.Listener
+		served   chan error
+	)
+
+	newEndpoint := func(addr string) *route.Endpoint {
+		host, portStr, err := net.SplitHostPort(addr)
+		Expect(err).ToNot(HaveOccurred())
+		port, err := strconv.Atoi(portStr)
+		Expect(err).ToNot(HaveOccurred())
+		return route.NewEndpoint("", host, uint16(port), "", "", nil, -1, "", models.ModificationTag{}, "")
+	}
+
+	startEchoBackend := func() net.Listener {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer conn.Close()
+					io.Copy(conn, conn)
+				}()
+			}
+		}()
+		return ln
+	}
+
+	BeforeEach(func() {
+		registry = new(fakes.FakeRegistry)
+		pool = route.NewPool(1*time.Second, "")
+		registry.LookupTCPReturns(pool)
+
+		backend = startEchoBackend()
+		pool.Put(newEndpoint(backend.Addr().String()))
+
+		proxy = tcp.NewProxy(test_util.NewTestZapLogger("tcp-proxy"), registry, "", 0)
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+
+		done := make(chan error, 1)
+		go func(proxy *tcp.Proxy, listener net.Listener) {
+			done <- proxy.Serve(listener, 61000)
+		}(proxy, listener)
+		served = done
+	})
+
+	AfterEach(func() {
+		listener.Close()
+		backend.Close()
+	})
+
+	It("forwards bytes to and from the registered endpoint", func() {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		_, err = conn.Write([]byte("hello\n"))
+		Expect(err).ToNot(HaveOccurred())
+
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		Expect(err).ToNot(HaveOccurred())
+		Expect(line).To(Equal("hello\n"))
+
+		Expect(registry.LookupTCPCallCount()).To(Equal(1))
+		Expect(registry.LookupTCPArgsForCall(0)).To(Equal(uint16(61000)))
+	})
+
+	Context("when using the least-connection algorithm", func() {
+		BeforeEach(func() {
+			proxy = tcp.NewProxy(test_util.NewTestZapLogger("tcp-proxy"), registry, config.LOAD_BALANCE_LC, 0)
+		})
+
+		It("tracks the connection on the endpoint for its lifetime", func() {
+			var endpoint *route.Endpoint
+			pool.Each(func(e *route.Endpoint) { endpoint = e })
+
+			conn, err := net.Dial("tcp", listener.Addr().String())
+			Expect(err).ToNot(HaveOccurred())
+
+			Eventually(endpoint.Stats.NumberConnections.Count).Should(BeEquivalentTo(1))
+
+			conn.Close()
+			Eventually(endpoint.Stats.NumberConnections.Count).Should(BeEquivalentTo(0))
+		})
+	})
+
+	Context("when a PROXY protocol version is configured", func() {
+		BeforeEach(func() {
+			proxy = tcp.NewProxy(test_util.NewTestZapLogger("tcp-proxy"), registry, "", 1)
+		})
+
+		It("sends the addresses of the client connection to the endpoint first", func() {
+			conn, err := net.Dial("tcp", listener.Addr().String())
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+
+			_, err = conn.Write([]byte("hello\n"))
+			Expect(err).ToNot(HaveOccurred())
+
+			reader := bufio.NewReader(conn)
+			header, err := reader.ReadString('\n')
+			Expect(err).ToNot(HaveOccurred())
+			Expect(header).To(Equal(fmt.Sprintf("PROXY TCP4 127.0.0.1 127.0.0.1 %d %d\r\n",
+				conn.LocalAddr().(*net.TCPAddr).Port, listener.Addr().(*net.TCPAddr).Port)))
+
+			line, err := reader.ReadString('\n')
+			Expect(err).ToNot(HaveOccurred())
+			Expect(line).To(Equal("hello\n"))
+		})
+	})
+
+	Context("when the first endpoint cannot be dialed", func() {
+		BeforeEach(func() {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			unavailable := ln.Addr().String()
+			ln.Close()
+
+			pool = route.NewPool(1*time.Second, "")
+			pool.Put(newEndpoint(unavailable))
+			pool.Put(newEndpoint(backend.Addr().String()))
+			registry.LookupTCPReturns(pool)
+		})
+
+		It("retries another endpoint", func() {
+			for i := 0; i < 2; i++ {
+				conn, err := net.Dial("tcp", listener.Addr().String())
+				Expect(err).ToNot(HaveOccurred())
+
+				_, err = conn.Write([]byte("hello\n"))
+				Expect(err).ToNot(HaveOccurred())
+
+				line, err := bufio.NewReader(conn).ReadString('\n')
+				Expect(err).ToNot(HaveOccurred())
+				Expect(line).To(Equal("hello\n"))
+				conn.Close()
+			}
+		})
+	})
+
+	Context("when no endpoints are registered for the port", func() {
+		BeforeEach(func() {
+			registry.LookupTCPReturns(nil)
+		})
+
+		It("closes the connection", func() {
+			conn, err := net.Dial("tcp", listener.Addr().String())
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+
+			_, err = bufio.NewReader(conn).ReadByte()
+			Expect(err).To(Equal(io.EOF))
+		})
+	})
+
+	Context("when the listener is closed", func() {
+		It("stops serving", func() {
+			listener.Close()
+			Eventually(served).Should(Receive(HaveOccurred()))
+		})
+	})
+})
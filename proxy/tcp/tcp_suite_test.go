@@ -0,0 +1,13 @@
+package tcp_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestTcp(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "TCP Proxy Suite")
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// BufferSize is the size of the buffers of the Buffers pool, the size of the
+// buffers used by io.Copy.
+const BufferSize = 32 * 1024
+
+// Buffers is the pool of the buffers used to copy the response bodies and the
+// streams of upgraded connections.
+var Buffers = NewBufferPool(BufferSize)
+
+// BufferPool is a pool of buffers of a fixed size, which implements
+// httputil.BufferPool.
+type BufferPool struct {
+	size int
+	pool sync.Pool
+
+	gets        int64
+	allocations int64
+	inUse       int64
+}
+
+// BufferPoolStats are the usage counts of a BufferPool.
+type BufferPoolStats struct {
+	// Gets is the number of buffers taken from the pool.
+	Gets int64
+	// Allocations is the number of buffers allocated because the pool was
+	// empty.
+	Allocations int64
+	// InUse is the number of buffers taken and not yet returned.
+	InUse int64
+}
+
+// NewBufferPool creates a pool of buffers of the size.
+func NewBufferPool(size int) *BufferPool {
+	return &BufferPool{size: size}
+}
+
+// Get returns a buffer from the pool, or a new one when the pool is empty.
+func (b *BufferPool) Get() []byte {
+	atomic.AddInt64(&b.gets, 1)
+	atomic.AddInt64(&b.inUse, 1)
+	if buf, ok := b.pool.Get().(*[]byte); ok {
+		return *buf
+	}
+	atomic.AddInt64(&b.allocations, 1)
+	return make([]byte, b.size)
+}
+
+// Put returns a buffer taken by Get to the pool.
+func (b *BufferPool) Put(buf []byte) {
+	atomic.AddInt64(&b.inUse, -1)
+	// buffers resliced by their users are not reused
+	if len(buf) != b.size {
+		return
+	}
+	b.pool.Put(&buf)
+}
+
+// Stats returns the usage counts of the pool.
+func (b *BufferPool) Stats() BufferPoolStats {
+	return BufferPoolStats{
+		Gets:        atomic.LoadInt64(&b.gets),
+		Allocations: atomic.LoadInt64(&b.allocations),
+		InUse:       atomic.LoadInt64(&b.inUse),
+	}
+}
+
+// Copy copies from src to dst until EOF or an error, like io.Copy. Copies
+// between TCP connections are left to io.Copy, which splices them in the
+// kernel where the platform supports it. Other copies use a buffer of the
+// pool.
+func (b *BufferPool) Copy(dst io.Writer, src io.Reader) (int64, error) {
+	if _, ok := src.(*net.TCPConn); ok {
+		if _, ok := dst.(*net.TCPConn); ok {
+			return io.Copy(dst, src)
+		}
+	}
+
+	buf := b.Get()
+	defer b.Put(buf)
+	// hide ReadFrom and WriteTo, which would copy with buffers of their own
+	return io.CopyBuffer(writerOnly{dst}, readerOnly{src}, buf)
+}
+
+type writerOnly struct {
+	io.Writer
+}
+
+type readerOnly struct {
+	io.Reader
+}
@@ -0,0 +1,85 @@
+package utils_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"code.cloudfoundry.org/gorouter/proxy/utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BufferPool", func() {
+	var pool *utils.BufferPool
+
+	BeforeEach(func() {
+		pool = utils.NewBufferPool(16)
+	})
+
+	It("returns buffers of its size", func() {
+		Expect(pool.Get()).To(HaveLen(16))
+	})
+
+	It("counts the buffers taken, allocated and in use", func() {
+		buf := pool.Get()
+		other := pool.Get()
+		Expect(pool.Stats()).To(Equal(utils.BufferPoolStats{Gets: 2, Allocations: 2, InUse: 2}))
+
+		pool.Put(buf)
+		pool.Put(other)
+		Expect(pool.Stats().InUse).To(BeZero())
+	})
+
+	It("does not reuse resliced buffers", func() {
+		pool.Put(pool.Get()[:8])
+		Expect(pool.Get()).To(HaveLen(16))
+	})
+
+	Describe("Copy", func() {
+		It("copies with a buffer of the pool", func() {
+			var dst bytes.Buffer
+			data := strings.Repeat("some data ", 10)
+
+			n, err := pool.Copy(&dst, strings.NewReader(data))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(BeEquivalentTo(len(data)))
+			Expect(dst.String()).To(Equal(data))
+			Expect(pool.Stats()).To(Equal(utils.BufferPoolStats{Gets: 1, Allocations: 1, InUse: 0}))
+		})
+
+		It("copies between TCP connections without a buffer", func() {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			defer ln.Close()
+
+			go func() {
+				defer GinkgoRecover()
+				conn, err := net.Dial("tcp", ln.Addr().String())
+				Expect(err).ToNot(HaveOccurred())
+				conn.Write([]byte("some data"))
+				conn.Close()
+			}()
+			src, err := ln.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			defer src.Close()
+
+			dst, err := net.Dial("tcp", ln.Addr().String())
+			Expect(err).ToNot(HaveOccurred())
+			peer, err := ln.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			defer peer.Close()
+
+			n, err := pool.Copy(dst, src)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(BeEquivalentTo(9))
+			dst.Close()
+
+			data, err := ioutil.ReadAll(peer)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(Equal("some data"))
+			Expect(pool.Stats().Gets).To(BeZero())
+		})
+	})
+})
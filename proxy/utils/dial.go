@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/route"
+)
+
+// DialFunc dials the address of an endpoint, whose host is an IP or a
+// hostname, like net.DialTimeout.
+type DialFunc func(network, address string, timeout time.Duration) (net.Conn, error)
+
+// Dial dials the endpoints of HTTP, WebSocket and TCP routes. It is replaced
+// by the dial of the backend DNS resolver when the resolver is enabled.
+var Dial DialFunc = net.DialTimeout
+
+// DialEndpoint dials the unix socket of endpoints reached over one, and
+// other endpoints with Dial. HTTP transports bracket the address of unix
+// sockets and add a port, which is ignored.
+func DialEndpoint(network, address string, timeout time.Duration) (net.Conn, error) {
+	socket := address
+	if host, _, err := net.SplitHostPort(address); err == nil && strings.HasPrefix(host, route.UnixSocketPrefix) {
+		socket = host
+	}
+	if strings.HasPrefix(socket, route.UnixSocketPrefix) {
+		return net.DialTimeout("unix", strings.TrimPrefix(socket, route.UnixSocketPrefix), timeout)
+	}
+	return Dial(network, address, timeout)
+}
@@ -0,0 +1,126 @@
+package registry
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/route"
+	"github.com/uber-go/zap"
+)
+
+// AuditAction is the change to the routing table recorded by an AuditEvent.
+type AuditAction string
+
+const (
+	AuditRegister   AuditAction = "register"
+	AuditUnregister AuditAction = "unregister"
+	AuditPrune      AuditAction = "prune"
+)
+
+// AuditEvent records an endpoint added to, or removed from, the routing
+// table. Route is set for HTTP routes and Port for TCP routes.
+type AuditEvent struct {
+	Time       time.Time         `json:"time"`
+	Action     AuditAction       `json:"action"`
+	Route      route.Uri         `json:"route,omitempty"`
+	Port       uint16            `json:"port,omitempty"`
+	Endpoint   string            `json:"endpoint"`
+	Source     string            `json:"source,omitempty"`
+	AppID      string            `json:"app_id,omitempty"`
+	InstanceID string            `json:"instance_id,omitempty"`
+	Tags       map[string]string `json:"tags,omitempty"`
+}
+
+// AuditPublisher publishes the audit events, such as a NATS connection.
+type AuditPublisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// auditLog keeps the last audit events in a ring, logs them and publishes
+// them if it has a publisher.
+type auditLog struct {
+	logger  logger.Logger
+	subject string
+
+	lock      sync.Mutex
+	events    []AuditEvent
+	next      int
+	full      bool
+	publisher AuditPublisher
+}
+
+func newAuditLog(logger logger.Logger, maxEvents int, subject string) *auditLog {
+	return &auditLog{
+		logger:  logger,
+		subject: subject,
+		events:  make([]AuditEvent, maxEvents),
+	}
+}
+
+func newAuditEvent(action AuditAction, uri route.Uri, port uint16, endpoint *route.Endpoint) AuditEvent {
+	return AuditEvent{
+		Time:       time.Now(),
+		Action:     action,
+		Route:      uri,
+		Port:       port,
+		Endpoint:   endpoint.CanonicalAddr(),
+		Source:     endpoint.Source,
+		AppID:      endpoint.ApplicationId,
+		InstanceID: endpoint.PrivateInstanceId,
+		Tags:       endpoint.Tags,
+	}
+}
+
+func (a *auditLog) record(e AuditEvent) {
+	a.lock.Lock()
+	a.events[a.next] = e
+	a.next = (a.next + 1) % len(a.events)
+	if a.next == 0 {
+		a.full = true
+	}
+	publisher := a.publisher
+	a.lock.Unlock()
+
+	a.logger.Info("route-audit",
+		zap.String("action", string(e.Action)),
+		zap.Stringer("uri", e.Route),
+		zap.Uint("port", uint(e.Port)),
+		zap.String("backend", e.Endpoint),
+		zap.String("source", e.Source),
+		zap.String("app_id", e.AppID),
+		zap.String("instance_id", e.InstanceID),
+		zap.Object("tags", e.Tags),
+	)
+
+	if publisher == nil || a.subject == "" {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err == nil {
+		err = publisher.Publish(a.subject, data)
+	}
+	if err != nil {
+		a.logger.Error("route-audit-publish-failed", zap.String("subject", a.subject), zap.Error(err))
+	}
+}
+
+func (a *auditLog) setPublisher(publisher AuditPublisher) {
+	a.lock.Lock()
+	a.publisher = publisher
+	a.lock.Unlock()
+}
+
+// all returns the events, oldest first.
+func (a *auditLog) all() []AuditEvent {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if !a.full {
+		return append([]AuditEvent{}, a.events[:a.next]...)
+	}
+	events := make([]AuditEvent, 0, len(a.events))
+	events = append(events, a.events[a.next:]...)
+	return append(events, a.events[:a.next]...)
+}
@@ -6,6 +6,9 @@ import (
 	"code.cloudfoundry.org/gorouter/route"
 )
 
+// WildcardSegment is the path segment that matches any single segment.
+const WildcardSegment = "*"
+
 // package name inspired by golang package that includes heap, list and ring.
 type Trie struct {
 	Segment    string
@@ -45,42 +48,36 @@ func (r *Trie) Find(uri route.Uri) *route.Pool {
 }
 
 // MatchUri returns the longest route that matches the URI parameter, nil if nothing matches.
+// A path segment of "*" in a route matches any single segment of the URI, so
+// that a route ending in "*" matches every path below it. Segments that match
+// exactly take precedence over wildcards.
 func (r *Trie) MatchUri(uri route.Uri) *route.Pool {
 	key := strings.TrimPrefix(uri.String(), "/")
-	node := r
-	var lastPool *route.Pool
-
-	for {
-		pathParts := parts(key)
-		SegmentValue := pathParts[0]
-
-		matchingChild, ok := node.ChildNodes[SegmentValue]
-		if !ok {
-			break
-		}
-
-		node = matchingChild
-
-		if nil != node.Pool {
-			lastPool = node.Pool
-		}
-
-		if len(pathParts) <= 1 {
-			break
-		}
+	return r.match(strings.Split(key, "/"))
+}
 
-		key = pathParts[1]
+func (r *Trie) match(segments []string) *route.Pool {
+	if len(segments) == 0 {
+		return r.Pool
 	}
 
-	if nil != node.Pool {
-		return node.Pool
+	if matchingChild, ok := r.ChildNodes[segments[0]]; ok {
+		if pool := matchingChild.match(segments[1:]); pool != nil {
+			return pool
+		}
 	}
 
-	if nil != lastPool {
-		return lastPool
+	// the first segment is the host, for which wildcards are looked up by
+	// the registry
+	if !r.isRoot() {
+		if wildcardChild, ok := r.ChildNodes[WildcardSegment]; ok {
+			if pool := wildcardChild.match(segments[1:]); pool != nil {
+				return pool
+			}
+		}
 	}
 
-	return nil
+	return r.Pool
 }
 
 func (r *Trie) Insert(uri route.Uri, value *route.Pool) *Trie {
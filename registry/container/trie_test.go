@@ -97,6 +97,47 @@ var _ = Describe("Trie", func() {
 			node := r.MatchUri("/foo/bar")
 			Expect(node).To(Equal(p1))
 		})
+
+		It("matches any segment with a wildcard segment", func() {
+			p := route.NewPool(42, "")
+			r.Insert("/foo/*/bar", p)
+			Expect(r.MatchUri("/foo/baz/bar")).To(Equal(p))
+			Expect(r.MatchUri("/foo/baz/bar/qux")).To(Equal(p))
+			Expect(r.MatchUri("/foo/baz/qux")).To(BeNil())
+			Expect(r.MatchUri("/foo/baz")).To(BeNil())
+		})
+
+		It("matches every path below a trailing wildcard segment", func() {
+			p1 := route.NewPool(42, "")
+			p2 := route.NewPool(42, "")
+			r.Insert("/foo", p1)
+			r.Insert("/foo/bar/*", p2)
+			Expect(r.MatchUri("/foo/bar/baz/qux")).To(Equal(p2))
+			Expect(r.MatchUri("/foo/bar")).To(Equal(p1))
+		})
+
+		It("prefers exact segments to wildcard segments", func() {
+			p1 := route.NewPool(42, "")
+			p2 := route.NewPool(42, "")
+			r.Insert("/foo/*/baz", p1)
+			r.Insert("/foo/bar/baz", p2)
+			Expect(r.MatchUri("/foo/bar/baz")).To(Equal(p2))
+			Expect(r.MatchUri("/foo/qux/baz")).To(Equal(p1))
+		})
+
+		It("falls back to a wildcard segment when the exact segment does not match", func() {
+			p1 := route.NewPool(42, "")
+			p2 := route.NewPool(42, "")
+			r.Insert("/foo/*/baz", p1)
+			r.Insert("/foo/bar/qux", p2)
+			Expect(r.MatchUri("/foo/bar/baz")).To(Equal(p1))
+		})
+
+		It("does not match hosts with a wildcard segment", func() {
+			p := route.NewPool(42, "")
+			r.Insert("*", p)
+			Expect(r.MatchUri("foo.com")).To(BeNil())
+		})
 	})
 
 	Describe(".Insert", func() {
@@ -0,0 +1,86 @@
+package registry
+
+import (
+	"container/heap"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/route"
+)
+
+// expirationKey identifies an endpoint of an HTTP route, by the route key, or
+// of a TCP route, by the router port.
+type expirationKey struct {
+	uri     route.Uri
+	port    uint16
+	address string
+}
+
+type expiration struct {
+	key   expirationKey
+	at    time.Time
+	index int
+}
+
+// expirationQueue is a priority queue of the times endpoints become stale,
+// earliest first, so that pruning only looks at the endpoints that are due.
+// The times are scheduled when endpoints are registered. They are not
+// removed when endpoints are unregistered or refreshed in bulk, so the
+// endpoints that are due must be checked against their pools.
+type expirationQueue struct {
+	items expirationHeap
+	byKey map[expirationKey]*expiration
+}
+
+func newExpirationQueue() *expirationQueue {
+	return &expirationQueue{
+		byKey: make(map[expirationKey]*expiration),
+	}
+}
+
+// schedule sets the time the endpoint becomes stale.
+func (q *expirationQueue) schedule(key expirationKey, at time.Time) {
+	if e, ok := q.byKey[key]; ok {
+		e.at = at
+		heap.Fix(&q.items, e.index)
+		return
+	}
+	e := &expiration{key: key, at: at}
+	heap.Push(&q.items, e)
+	q.byKey[key] = e
+}
+
+// due removes and returns the endpoints that become stale at or before now.
+func (q *expirationQueue) due(now time.Time) []expirationKey {
+	var keys []expirationKey
+	for len(q.items) > 0 && !q.items[0].at.After(now) {
+		e := heap.Pop(&q.items).(*expiration)
+		delete(q.byKey, e.key)
+		keys = append(keys, e.key)
+	}
+	return keys
+}
+
+type expirationHeap []*expiration
+
+func (h expirationHeap) Len() int           { return len(h) }
+func (h expirationHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+
+func (h expirationHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expirationHeap) Push(x interface{}) {
+	e := x.(*expiration)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *expirationHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
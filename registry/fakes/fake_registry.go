@@ -64,6 +64,26 @@ type FakeRegistry struct {
 		result1 []byte
 		result2 error
 	}
+	RegisterTCPStub        func(port uint16, endpoint *route.Endpoint)
+	registerTCPMutex       sync.RWMutex
+	registerTCPArgsForCall []struct {
+		port     uint16
+		endpoint *route.Endpoint
+	}
+	UnregisterTCPStub        func(port uint16, endpoint *route.Endpoint)
+	unregisterTCPMutex       sync.RWMutex
+	unregisterTCPArgsForCall []struct {
+		port     uint16
+		endpoint *route.Endpoint
+	}
+	LookupTCPStub        func(port uint16) *route.Pool
+	lookupTCPMutex       sync.RWMutex
+	lookupTCPArgsForCall []struct {
+		port uint16
+	}
+	lookupTCPReturns struct {
+		result1 *route.Pool
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
@@ -289,6 +309,88 @@ func (fake *FakeRegistry) MarshalJSONReturns(result1 []byte, result2 error) {
 	}{result1, result2}
 }
 
+func (fake *FakeRegistry) RegisterTCP(port uint16, endpoint *route.Endpoint) {
+	fake.registerTCPMutex.Lock()
+	fake.registerTCPArgsForCall = append(fake.registerTCPArgsForCall, struct {
+		port     uint16
+		endpoint *route.Endpoint
+	}{port, endpoint})
+	fake.recordInvocation("RegisterTCP", []interface{}{port, endpoint})
+	fake.registerTCPMutex.Unlock()
+	if fake.RegisterTCPStub != nil {
+		fake.RegisterTCPStub(port, endpoint)
+	}
+}
+
+func (fake *FakeRegistry) RegisterTCPCallCount() int {
+	fake.registerTCPMutex.RLock()
+	defer fake.registerTCPMutex.RUnlock()
+	return len(fake.registerTCPArgsForCall)
+}
+
+func (fake *FakeRegistry) RegisterTCPArgsForCall(i int) (uint16, *route.Endpoint) {
+	fake.registerTCPMutex.RLock()
+	defer fake.registerTCPMutex.RUnlock()
+	return fake.registerTCPArgsForCall[i].port, fake.registerTCPArgsForCall[i].endpoint
+}
+
+func (fake *FakeRegistry) UnregisterTCP(port uint16, endpoint *route.Endpoint) {
+	fake.unregisterTCPMutex.Lock()
+	fake.unregisterTCPArgsForCall = append(fake.unregisterTCPArgsForCall, struct {
+		port     uint16
+		endpoint *route.Endpoint
+	}{port, endpoint})
+	fake.recordInvocation("UnregisterTCP", []interface{}{port, endpoint})
+	fake.unregisterTCPMutex.Unlock()
+	if fake.UnregisterTCPStub != nil {
+		fake.UnregisterTCPStub(port, endpoint)
+	}
+}
+
+func (fake *FakeRegistry) UnregisterTCPCallCount() int {
+	fake.unregisterTCPMutex.RLock()
+	defer fake.unregisterTCPMutex.RUnlock()
+	return len(fake.unregisterTCPArgsForCall)
+}
+
+func (fake *FakeRegistry) UnregisterTCPArgsForCall(i int) (uint16, *route.Endpoint) {
+	fake.unregisterTCPMutex.RLock()
+	defer fake.unregisterTCPMutex.RUnlock()
+	return fake.unregisterTCPArgsForCall[i].port, fake.unregisterTCPArgsForCall[i].endpoint
+}
+
+func (fake *FakeRegistry) LookupTCP(port uint16) *route.Pool {
+	fake.lookupTCPMutex.Lock()
+	fake.lookupTCPArgsForCall = append(fake.lookupTCPArgsForCall, struct {
+		port uint16
+	}{port})
+	fake.recordInvocation("LookupTCP", []interface{}{port})
+	fake.lookupTCPMutex.Unlock()
+	if fake.LookupTCPStub != nil {
+		return fake.LookupTCPStub(port)
+	}
+	return fake.lookupTCPReturns.result1
+}
+
+func (fake *FakeRegistry) LookupTCPCallCount() int {
+	fake.lookupTCPMutex.RLock()
+	defer fake.lookupTCPMutex.RUnlock()
+	return len(fake.lookupTCPArgsForCall)
+}
+
+func (fake *FakeRegistry) LookupTCPArgsForCall(i int) uint16 {
+	fake.lookupTCPMutex.RLock()
+	defer fake.lookupTCPMutex.RUnlock()
+	return fake.lookupTCPArgsForCall[i].port
+}
+
+func (fake *FakeRegistry) LookupTCPReturns(result1 *route.Pool) {
+	fake.LookupTCPStub = nil
+	fake.lookupTCPReturns = struct {
+		result1 *route.Pool
+	}{result1}
+}
+
 func (fake *FakeRegistry) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
@@ -310,6 +412,12 @@ func (fake *FakeRegistry) Invocations() map[string][][]interface{} {
 	defer fake.numEndpointsMutex.RUnlock()
 	fake.marshalJSONMutex.RLock()
 	defer fake.marshalJSONMutex.RUnlock()
+	fake.registerTCPMutex.RLock()
+	defer fake.registerTCPMutex.RUnlock()
+	fake.unregisterTCPMutex.RLock()
+	defer fake.unregisterTCPMutex.RUnlock()
+	fake.lookupTCPMutex.RLock()
+	defer fake.lookupTCPMutex.RUnlock()
 	return fake.invocations
 }
 
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/uber-go/zap"
@@ -21,6 +22,9 @@ type Registry interface {
 	Unregister(uri route.Uri, endpoint *route.Endpoint)
 	Lookup(uri route.Uri) *route.Pool
 	LookupWithInstance(uri route.Uri, appID, appIndex string) *route.Pool
+	RegisterTCP(port uint16, endpoint *route.Endpoint)
+	UnregisterTCP(port uint16, endpoint *route.Endpoint)
+	LookupTCP(port uint16) *route.Pool
 	StartPruningCycle()
 	StopPruningCycle()
 	NumUris() int
@@ -35,13 +39,37 @@ const (
 	DISCONNECTED
 )
 
+// numShards is the number of shards of the HTTP routes.
+const numShards = 64
+
+// shard holds the HTTP routes of the hosts hashed to it. Access to the Trie
+// datastructure and the expirations should be governed by the RWMutex of the
+// shard.
+type shard struct {
+	sync.RWMutex
+	byURI       *container.Trie
+	expirations *expirationQueue
+}
+
 type RouteRegistry struct {
+	// unix nanoseconds, accessed atomically; first to be 64-bit aligned
+	timeOfLastUpdate int64
+
+	// The RWMutex of RouteRegistry governs the state set through the admin
+	// API and the pruning state. Registrations only read that state, so that
+	// they run concurrently, and lock the shard of their route only.
 	sync.RWMutex
 
 	logger logger.Logger
 
-	// Access to the Trie datastructure should be governed by the RWMutex of RouteRegistry
-	byURI *container.Trie
+	// HTTP routes are sharded by host, so that registrations only block the
+	// lookups of the routes in the same shard
+	shards [numShards]*shard
+
+	// TCP routes are keyed by the router port they are served on
+	portLock        sync.RWMutex
+	byPort          map[uint16]*route.Pool
+	portExpirations *expirationQueue
 
 	// used for ability to suspend pruning
 	suspendPruning func() bool
@@ -52,17 +80,43 @@ type RouteRegistry struct {
 
 	reporter metrics.RouteRegistryReporter
 
-	ticker           *time.Ticker
-	timeOfLastUpdate time.Time
+	ticker *time.Ticker
 
 	routingTableShardingMode string
 	isolationSegments        []string
+
+	circuitBreaker  config.CircuitBreakerConfig
+	latencyOutliers config.LatencyOutlierConfig
+	// the zone whose endpoints pools prefer, if locality aware balancing is
+	// enabled
+	localZone string
+
+	// routes whose endpoints are only changed through the admin API
+	frozen map[route.Uri]bool
+
+	// addresses of the endpoints that are draining
+	draining map[string]bool
+
+	// maintenance responses of routes put in maintenance through the admin
+	// API, kept when the pools of the routes are recreated
+	maintenance map[route.Uri]*route.Maintenance
+
+	// the endpoints added to and removed from the routing table, if the
+	// route audit is enabled
+	audit *auditLog
 }
 
 func NewRouteRegistry(logger logger.Logger, c *config.Config, reporter metrics.RouteRegistryReporter) *RouteRegistry {
 	r := &RouteRegistry{}
 	r.logger = logger
-	r.byURI = container.NewTrie()
+	for i := range r.shards {
+		r.shards[i] = &shard{byURI: container.NewTrie(), expirations: newExpirationQueue()}
+	}
+	r.byPort = make(map[uint16]*route.Pool)
+	r.portExpirations = newExpirationQueue()
+	r.frozen = make(map[route.Uri]bool)
+	r.draining = make(map[string]bool)
+	r.maintenance = make(map[route.Uri]*route.Maintenance)
 
 	r.pruneStaleDropletsInterval = c.PruneStaleDropletsInterval
 	r.dropletStaleThreshold = c.DropletStaleThreshold
@@ -73,54 +127,140 @@ func NewRouteRegistry(logger logger.Logger, c *config.Config, reporter metrics.R
 	r.routingTableShardingMode = c.RoutingTableShardingMode
 	r.isolationSegments = c.IsolationSegments
 
+	r.circuitBreaker = c.CircuitBreaker
+	r.latencyOutliers = c.LatencyOutliers
+	if c.LocalityAwareBalancing {
+		r.localZone = c.Zone
+	}
+
+	if c.RouteAudit.Enabled {
+		r.audit = newAuditLog(logger, c.RouteAudit.MaxEvents, c.RouteAudit.NatsSubject)
+	}
+
 	return r
 }
 
+// SetAuditPublisher publishes the route audit events on the NATS subject of
+// the route audit, if the route audit is enabled.
+func (r *RouteRegistry) SetAuditPublisher(publisher AuditPublisher) {
+	if r.audit != nil {
+		r.audit.setPublisher(publisher)
+	}
+}
+
+// AuditEvents returns the last endpoints added to and removed from the
+// routing table, oldest first, or none if the route audit is disabled.
+func (r *RouteRegistry) AuditEvents() []AuditEvent {
+	if r.audit == nil {
+		return nil
+	}
+	return r.audit.all()
+}
+
+// recordAudit records the change to the routing table, if the route audit is
+// enabled.
+func (r *RouteRegistry) recordAudit(action AuditAction, uri route.Uri, port uint16, endpoint *route.Endpoint) {
+	if r.audit != nil {
+		r.audit.record(newAuditEvent(action, uri, port, endpoint))
+	}
+}
+
 func (r *RouteRegistry) Register(uri route.Uri, endpoint *route.Endpoint) {
+	r.register(uri, endpoint, false)
+}
+
+// ForceRegister registers the endpoint even if the route is frozen.
+func (r *RouteRegistry) ForceRegister(uri route.Uri, endpoint *route.Endpoint) {
+	r.register(uri, endpoint, true)
+}
+
+func (r *RouteRegistry) register(uri route.Uri, endpoint *route.Endpoint, force bool) {
 	if !r.endpointInRouterShard(endpoint) {
 		return
 	}
 
 	t := time.Now()
 
-	r.Lock()
+	r.RLock()
 
 	routekey := uri.RouteKey()
+	if r.frozen[routekey] && !force {
+		r.RUnlock()
+		r.logger.Debug("endpoint-not-registered-route-frozen", zapData(uri, endpoint)...)
+		return
+	}
 
-	pool := r.byURI.Find(routekey)
+	s := r.shard(routekey)
+	s.Lock()
+	pool := s.byURI.Find(routekey)
 	if pool == nil {
 		contextPath := parseContextPath(uri)
 		pool = route.NewPool(r.dropletStaleThreshold/4, contextPath)
-		r.byURI.Insert(routekey, pool)
+		pool.SetCircuitBreaker(r.circuitBreaker)
+		pool.SetLatencyOutliers(r.latencyOutliers)
+		pool.SetLocalZone(r.localZone)
+		pool.SetMaintenance(r.maintenance[routekey])
+		s.byURI.Insert(routekey, pool)
 		r.logger.Debug("uri-added", zap.Stringer("uri", routekey))
 	}
 
+	// endpoints are registered again to be kept alive, which is not a change
+	// to the routing table
+	newEndpoint := !pool.Contains(endpoint.CanonicalAddr())
 	endpointAdded := pool.Put(endpoint)
+	if endpointAdded {
+		key := expirationKey{uri: routekey, address: endpoint.CanonicalAddr()}
+		s.expirations.schedule(key, t.Add(endpoint.StaleThreshold(r.dropletStaleThreshold)))
+	}
+	if r.draining[endpoint.CanonicalAddr()] {
+		pool.SetEndpointDraining(endpoint.CanonicalAddr(), true)
+	}
+	s.Unlock()
 
-	r.timeOfLastUpdate = t
-	r.Unlock()
+	r.RUnlock()
+	r.setTimeOfLastUpdate(t)
 
 	r.reporter.CaptureRegistryMessage(endpoint)
 
 	if endpointAdded {
 		r.logger.Debug("endpoint-registered", zapData(uri, endpoint)...)
+		if newEndpoint {
+			r.recordAudit(AuditRegister, routekey, 0, endpoint)
+		}
 	} else {
 		r.logger.Debug("endpoint-not-registered", zapData(uri, endpoint)...)
 	}
 }
 
 func (r *RouteRegistry) Unregister(uri route.Uri, endpoint *route.Endpoint) {
+	r.unregister(uri, endpoint, false)
+}
+
+// ForceUnregister unregisters the endpoint even if the route is frozen.
+func (r *RouteRegistry) ForceUnregister(uri route.Uri, endpoint *route.Endpoint) {
+	r.unregister(uri, endpoint, true)
+}
+
+func (r *RouteRegistry) unregister(uri route.Uri, endpoint *route.Endpoint, force bool) {
 	if !r.endpointInRouterShard(endpoint) {
 		return
 	}
 
-	r.Lock()
+	r.RLock()
 
 	uri = uri.RouteKey()
+	if r.frozen[uri] && !force {
+		r.RUnlock()
+		r.logger.Debug("endpoint-not-unregistered-route-frozen", zapData(uri, endpoint)...)
+		return
+	}
 
-	pool := r.byURI.Find(uri)
+	s := r.shard(uri)
+	s.Lock()
+	pool := s.byURI.Find(uri)
+	endpointRemoved := false
 	if pool != nil {
-		endpointRemoved := pool.Remove(endpoint)
+		endpointRemoved = pool.Remove(endpoint)
 		if endpointRemoved {
 			r.logger.Debug("endpoint-unregistered", zapData(uri, endpoint)...)
 		} else {
@@ -128,33 +268,281 @@ func (r *RouteRegistry) Unregister(uri route.Uri, endpoint *route.Endpoint) {
 		}
 
 		if pool.IsEmpty() {
-			r.byURI.Delete(uri)
+			s.byURI.Delete(uri)
 		}
 	}
+	s.Unlock()
 
-	r.Unlock()
+	r.RUnlock()
 	r.reporter.CaptureUnregistryMessage(endpoint)
+	if endpointRemoved {
+		r.recordAudit(AuditUnregister, uri, 0, endpoint)
+	}
 }
 
-func (r *RouteRegistry) Lookup(uri route.Uri) *route.Pool {
-	started := time.Now()
+// RemoveRoute removes the route and all of its endpoints. Returns false if
+// the route is not registered.
+func (r *RouteRegistry) RemoveRoute(uri route.Uri) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	uri = uri.RouteKey()
+	s := r.shard(uri)
+	s.Lock()
+	defer s.Unlock()
 
+	pool := s.byURI.Find(uri)
+	if pool == nil {
+		return false
+	}
+	if r.audit != nil {
+		// routes are only removed through the admin API
+		pool.Each(func(e *route.Endpoint) {
+			event := newAuditEvent(AuditUnregister, uri, 0, e)
+			event.Source = "admin"
+			r.audit.record(event)
+		})
+	}
+	s.byURI.Delete(uri)
+	delete(r.maintenance, uri)
+	r.setTimeOfLastUpdate(time.Now())
+	r.logger.Info("route-removed", zap.Stringer("uri", uri))
+	return true
+}
+
+// Freeze sets whether the route is frozen. The endpoints of frozen routes are
+// not changed by registration messages nor pruned when they are stale.
+func (r *RouteRegistry) Freeze(uri route.Uri, frozen bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	uri = uri.RouteKey()
+	if frozen {
+		r.frozen[uri] = true
+	} else {
+		delete(r.frozen, uri)
+	}
+	r.logger.Info("route-frozen", zap.Stringer("uri", uri), zap.Bool("frozen", frozen))
+}
+
+// FrozenRoutes returns the frozen routes, which need not be registered.
+func (r *RouteRegistry) FrozenRoutes() []route.Uri {
+	r.RLock()
+	defer r.RUnlock()
+
+	uris := make([]route.Uri, 0, len(r.frozen))
+	for uri := range r.frozen {
+		uris = append(uris, uri)
+	}
+	return uris
+}
+
+// SetMaintenance puts the route in maintenance with the response m, or takes
+// it out of maintenance when m is nil. Routes that are in maintenance through
+// the registration of their endpoints stay in maintenance. Returns false if
+// the route is not registered.
+func (r *RouteRegistry) SetMaintenance(uri route.Uri, m *route.Maintenance) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	uri = uri.RouteKey()
+	s := r.shard(uri)
+	s.RLock()
+	pool := s.byURI.Find(uri)
+	s.RUnlock()
+	if pool == nil {
+		return false
+	}
+	pool.SetMaintenance(m)
+	if m != nil {
+		r.maintenance[uri] = m
+	} else {
+		delete(r.maintenance, uri)
+	}
+	r.logger.Info("route-maintenance", zap.Stringer("uri", uri), zap.Bool("maintenance", m != nil))
+	return true
+}
+
+// SetEndpointDraining sets whether the endpoint at the address, given as
+// host:port, is draining in every pool. Draining endpoints are not selected
+// for new requests but stay registered, and are also draining in the pools
+// of routes they are registered for later. Returns false if the endpoint is
+// neither registered nor draining.
+func (r *RouteRegistry) SetEndpointDraining(address string, draining bool) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	found := r.draining[address]
+	r.eachNodeWithPool(func(t *container.Trie) {
+		if t.Pool.SetEndpointDraining(address, draining) {
+			found = true
+		}
+	})
+	r.portLock.RLock()
+	for _, pool := range r.byPort {
+		if pool.SetEndpointDraining(address, draining) {
+			found = true
+		}
+	}
+	r.portLock.RUnlock()
+	if !found {
+		return false
+	}
+
+	if draining {
+		r.draining[address] = true
+	} else {
+		delete(r.draining, address)
+	}
+	r.logger.Info("endpoint-draining", zap.String("address", address), zap.Bool("draining", draining))
+	return true
+}
+
+// DrainingEndpoints returns the addresses of the draining endpoints.
+func (r *RouteRegistry) DrainingEndpoints() []string {
 	r.RLock()
+	defer r.RUnlock()
+
+	addresses := make([]string, 0, len(r.draining))
+	for address := range r.draining {
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
+func (r *RouteRegistry) Lookup(uri route.Uri) *route.Pool {
+	started := time.Now()
 
 	uri = uri.RouteKey()
 	var err error
-	pool := r.byURI.MatchUri(uri)
+	pool := r.match(uri)
 	for pool == nil && err == nil {
 		uri, err = uri.NextWildcard()
-		pool = r.byURI.MatchUri(uri)
+		pool = r.match(uri)
 	}
 
-	r.RUnlock()
 	endLookup := time.Now()
 	r.reporter.CaptureLookupTime(endLookup.Sub(started))
 	return pool
 }
 
+func (r *RouteRegistry) match(uri route.Uri) *route.Pool {
+	s := r.shard(uri)
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.byURI.MatchUri(uri)
+}
+
+// shard returns the shard of the route key, chosen by an FNV-1a hash of its
+// host.
+func (r *RouteRegistry) shard(uri route.Uri) *shard {
+	host := string(uri)
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+
+	h := uint32(2166136261)
+	for i := 0; i < len(host); i++ {
+		h ^= uint32(host[i])
+		h *= 16777619
+	}
+	return r.shards[h%numShards]
+}
+
+// eachNodeWithPool calls f with the trie node of every HTTP route, with the
+// shard of the route locked.
+func (r *RouteRegistry) eachNodeWithPool(f func(t *container.Trie)) {
+	for _, s := range r.shards {
+		s.RLock()
+		s.byURI.EachNodeWithPool(f)
+		s.RUnlock()
+	}
+}
+
+func (r *RouteRegistry) RegisterTCP(port uint16, endpoint *route.Endpoint) {
+	if !r.endpointInRouterShard(endpoint) {
+		return
+	}
+
+	t := time.Now()
+
+	r.RLock()
+	r.portLock.Lock()
+
+	pool, ok := r.byPort[port]
+	if !ok {
+		pool = route.NewPool(r.dropletStaleThreshold/4, "")
+		pool.SetCircuitBreaker(r.circuitBreaker)
+		pool.SetLatencyOutliers(r.latencyOutliers)
+		pool.SetLocalZone(r.localZone)
+		r.byPort[port] = pool
+		r.logger.Debug("tcp-port-added", zap.Uint("port", uint(port)))
+	}
+
+	newEndpoint := !pool.Contains(endpoint.CanonicalAddr())
+	endpointAdded := pool.Put(endpoint)
+	if endpointAdded {
+		key := expirationKey{port: port, address: endpoint.CanonicalAddr()}
+		r.portExpirations.schedule(key, t.Add(endpoint.StaleThreshold(r.dropletStaleThreshold)))
+	}
+	if r.draining[endpoint.CanonicalAddr()] {
+		pool.SetEndpointDraining(endpoint.CanonicalAddr(), true)
+	}
+
+	r.portLock.Unlock()
+	r.RUnlock()
+	r.setTimeOfLastUpdate(t)
+
+	r.reporter.CaptureRegistryMessage(endpoint)
+
+	if endpointAdded {
+		r.logger.Debug("tcp-endpoint-registered", zapTCPData(port, endpoint)...)
+		if newEndpoint {
+			r.recordAudit(AuditRegister, "", port, endpoint)
+		}
+	} else {
+		r.logger.Debug("tcp-endpoint-not-registered", zapTCPData(port, endpoint)...)
+	}
+}
+
+func (r *RouteRegistry) UnregisterTCP(port uint16, endpoint *route.Endpoint) {
+	if !r.endpointInRouterShard(endpoint) {
+		return
+	}
+
+	r.portLock.Lock()
+
+	pool, ok := r.byPort[port]
+	endpointRemoved := false
+	if ok {
+		endpointRemoved = pool.Remove(endpoint)
+		if endpointRemoved {
+			r.logger.Debug("tcp-endpoint-unregistered", zapTCPData(port, endpoint)...)
+		} else {
+			r.logger.Debug("tcp-endpoint-not-unregistered", zapTCPData(port, endpoint)...)
+		}
+
+		if pool.IsEmpty() {
+			delete(r.byPort, port)
+		}
+	}
+
+	r.portLock.Unlock()
+	r.reporter.CaptureUnregistryMessage(endpoint)
+	if endpointRemoved {
+		r.recordAudit(AuditUnregister, "", port, endpoint)
+	}
+}
+
+func (r *RouteRegistry) LookupTCP(port uint16) *route.Pool {
+	r.portLock.RLock()
+	pool := r.byPort[port]
+	r.portLock.RUnlock()
+
+	return pool
+}
+
 func (r *RouteRegistry) endpointInRouterShard(endpoint *route.Endpoint) bool {
 	if r.routingTableShardingMode == config.SHARD_ALL {
 		return true
@@ -189,6 +577,11 @@ func (r *RouteRegistry) LookupWithInstance(uri route.Uri, appID string, appIndex
 			surgicalPool.Put(e)
 		}
 	})
+	if surgicalPool != nil {
+		surgicalPool.SetMaintenance(p.Maintenance())
+		surgicalPool.SetAuth(p.Auth())
+		surgicalPool.SetIPAccess(p.IPAccess())
+	}
 	return surgicalPool
 }
 
@@ -222,44 +615,76 @@ func (r *RouteRegistry) StopPruningCycle() {
 }
 
 func (registry *RouteRegistry) NumUris() int {
-	registry.RLock()
-	uriCount := registry.byURI.PoolCount()
-	registry.RUnlock()
+	uriCount := 0
+	for _, s := range registry.shards {
+		s.RLock()
+		uriCount += s.byURI.PoolCount()
+		s.RUnlock()
+	}
 
 	return uriCount
 }
 
 func (r *RouteRegistry) TimeOfLastUpdate() time.Time {
-	r.RLock()
-	t := r.timeOfLastUpdate
-	r.RUnlock()
+	t := atomic.LoadInt64(&r.timeOfLastUpdate)
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, t)
+}
 
-	return t
+func (r *RouteRegistry) setTimeOfLastUpdate(t time.Time) {
+	atomic.StoreInt64(&r.timeOfLastUpdate, t.UnixNano())
 }
 
 func (r *RouteRegistry) NumEndpoints() int {
-	r.RLock()
-	count := r.byURI.EndpointCount()
-	r.RUnlock()
+	// endpoints registered for routes of several shards are counted once
+	addresses := make(map[string]struct{})
+	r.eachNodeWithPool(func(t *container.Trie) {
+		t.Pool.Each(func(e *route.Endpoint) {
+			addresses[e.CanonicalAddr()] = struct{}{}
+		})
+	})
+
+	return len(addresses)
+}
+
+// EachPool calls f with the pool of every HTTP route. f is called with the
+// shard of the route locked and must not call back into the registry.
+func (r *RouteRegistry) EachPool(f func(pool *route.Pool)) {
+	r.eachNodeWithPool(func(t *container.Trie) {
+		f(t.Pool)
+	})
+}
 
-	return count
+// EachRoute calls f with every HTTP route and its pool. f is called with the
+// shard of the route locked and must not call back into the registry.
+func (r *RouteRegistry) EachRoute(f func(uri route.Uri, pool *route.Pool)) {
+	for _, s := range r.shards {
+		s.RLock()
+		for uri, pool := range s.byURI.ToMap() {
+			f(uri, pool)
+		}
+		s.RUnlock()
+	}
 }
 
 func (r *RouteRegistry) MarshalJSON() ([]byte, error) {
-	r.RLock()
-	defer r.RUnlock()
+	routes := make(map[route.Uri]*route.Pool)
+	r.EachRoute(func(uri route.Uri, pool *route.Pool) {
+		routes[uri] = pool
+	})
 
-	return json.Marshal(r.byURI.ToMap())
+	return json.Marshal(routes)
 }
 
 func (r *RouteRegistry) pruneStaleDroplets() {
 	r.Lock()
-	defer r.Unlock()
-
 	// suspend pruning if option enabled and if NATS is unavailable
 	if r.suspendPruning() {
 		r.logger.Info("prune-suspended")
 		r.pruningStatus = DISCONNECTED
+		r.Unlock()
 		return
 	}
 	if r.pruningStatus == DISCONNECTED {
@@ -270,26 +695,98 @@ func (r *RouteRegistry) pruneStaleDroplets() {
 		r.logger.Debug("prune-unsuspended-refresh-routes-complete")
 	}
 	r.pruningStatus = CONNECTED
+	r.Unlock()
+
+	r.RLock()
+	defer r.RUnlock()
+
+	// the shards are pruned one by one, so that only the registrations and
+	// lookups of the routes of the shard being pruned wait
+	now := time.Now()
+	for _, s := range r.shards {
+		s.Lock()
+		r.pruneShard(s, now)
+		s.Unlock()
+	}
+
+	r.portLock.Lock()
+	defer r.portLock.Unlock()
+
+	pruned := make(map[uint16][]*route.Endpoint)
+	for _, key := range r.portExpirations.due(now) {
+		pool, ok := r.byPort[key.port]
+		if !ok {
+			continue
+		}
+		pruned[key.port] = append(pruned[key.port], pool.PruneEndpoints(r.dropletStaleThreshold)...)
+		if pool.IsEmpty() {
+			delete(r.byPort, key.port)
+		} else if at, ok := pool.StaleAt(key.address, r.dropletStaleThreshold); ok {
+			r.portExpirations.schedule(key, at)
+		}
+	}
+
+	for port, endpoints := range pruned {
+		if len(endpoints) > 0 {
+			addresses := []string{}
+			for _, e := range endpoints {
+				addresses = append(addresses, e.CanonicalAddr())
+				r.recordAudit(AuditPrune, "", port, e)
+			}
+			r.logger.Info("pruned-tcp-route",
+				zap.Uint("port", uint(port)),
+				zap.Object("endpoints", addresses),
+			)
+		}
+	}
+}
+
+// pruneShard prunes the endpoints of the shard that are due to become stale,
+// and schedules the endpoints that were refreshed since their expiration was
+// scheduled.
+func (r *RouteRegistry) pruneShard(s *shard, now time.Time) {
+	pruned := make(map[route.Uri][]*route.Endpoint)
+	var frozen []expirationKey
+	for _, key := range s.expirations.due(now) {
+		pool := s.byURI.Find(key.uri)
+		if pool == nil {
+			continue
+		}
+		if r.frozen[key.uri] {
+			frozen = append(frozen, key)
+			continue
+		}
+		pruned[key.uri] = append(pruned[key.uri], pool.PruneEndpoints(r.dropletStaleThreshold)...)
+		if pool.IsEmpty() {
+			s.byURI.Delete(key.uri)
+		} else if at, ok := pool.StaleAt(key.address, r.dropletStaleThreshold); ok {
+			s.expirations.schedule(key, at)
+		}
+	}
+	// the endpoints of frozen routes are checked again on the next cycle,
+	// in case their routes are unfrozen
+	for _, key := range frozen {
+		s.expirations.schedule(key, now)
+	}
 
-	r.byURI.EachNodeWithPool(func(t *container.Trie) {
-		endpoints := t.Pool.PruneEndpoints(r.dropletStaleThreshold)
-		t.Snip()
+	for uri, endpoints := range pruned {
 		if len(endpoints) > 0 {
 			addresses := []string{}
 			for _, e := range endpoints {
 				addresses = append(addresses, e.CanonicalAddr())
+				r.recordAudit(AuditPrune, uri, 0, e)
 			}
 			isolationSegment := endpoints[0].IsolationSegment
 			if isolationSegment == "" {
 				isolationSegment = "-"
 			}
 			r.logger.Info("pruned-route",
-				zap.String("uri", t.ToPath()),
+				zap.String("uri", uri.String()),
 				zap.Object("endpoints", addresses),
 				zap.Object("isolation_segment", isolationSegment),
 			)
 		}
-	})
+	}
 }
 
 func (r *RouteRegistry) SuspendPruning(f func() bool) {
@@ -301,9 +798,14 @@ func (r *RouteRegistry) SuspendPruning(f func() bool) {
 // bulk update to mark pool / endpoints as updated
 func (r *RouteRegistry) freshenRoutes() {
 	now := time.Now()
-	r.byURI.EachNodeWithPool(func(t *container.Trie) {
+	r.eachNodeWithPool(func(t *container.Trie) {
 		t.Pool.MarkUpdated(now)
 	})
+	r.portLock.RLock()
+	for _, pool := range r.byPort {
+		pool.MarkUpdated(now)
+	}
+	r.portLock.RUnlock()
 }
 
 func parseContextPath(uri route.Uri) string {
@@ -321,6 +823,14 @@ func parseContextPath(uri route.Uri) string {
 	return contextPath
 }
 
+func zapTCPData(port uint16, endpoint *route.Endpoint) []zap.Field {
+	return []zap.Field{
+		zap.Uint("port", uint(port)),
+		zap.String("backend", endpoint.CanonicalAddr()),
+		zap.Object("modification_tag", endpoint.ModificationTag),
+	}
+}
+
 func zapData(uri route.Uri, endpoint *route.Endpoint) []zap.Field {
 	isoSegField := zap.String("isolation_segment", "-")
 	if endpoint.IsolationSegment != "" {
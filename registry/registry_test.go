@@ -16,6 +16,7 @@ import (
 	"code.cloudfoundry.org/gorouter/route"
 
 	"encoding/json"
+	"sync"
 	"time"
 )
 
@@ -300,7 +301,7 @@ var _ = Describe("RouteRegistry", func() {
 					Expect(r.NumEndpoints()).To(Equal(1))
 
 					p := r.Lookup("foo.com")
-					Expect(p.Endpoints("", "").Next().ModificationTag).To(Equal(modTag))
+					Expect(p.Endpoints("", "", "").Next().ModificationTag).To(Equal(modTag))
 				})
 			})
 
@@ -322,7 +323,7 @@ var _ = Describe("RouteRegistry", func() {
 						Expect(r.NumEndpoints()).To(Equal(1))
 
 						p := r.Lookup("foo.com")
-						Expect(p.Endpoints("", "").Next().ModificationTag).To(Equal(modTag))
+						Expect(p.Endpoints("", "", "").Next().ModificationTag).To(Equal(modTag))
 					})
 
 					Context("updating an existing route with an older modification tag", func() {
@@ -342,7 +343,7 @@ var _ = Describe("RouteRegistry", func() {
 							Expect(r.NumEndpoints()).To(Equal(1))
 
 							p := r.Lookup("foo.com")
-							ep := p.Endpoints("", "").Next()
+							ep := p.Endpoints("", "", "").Next()
 							Expect(ep.ModificationTag).To(Equal(modTag))
 							Expect(ep).To(Equal(endpoint2))
 						})
@@ -361,7 +362,7 @@ var _ = Describe("RouteRegistry", func() {
 						Expect(r.NumEndpoints()).To(Equal(1))
 
 						p := r.Lookup("foo.com")
-						Expect(p.Endpoints("", "").Next().ModificationTag).To(Equal(modTag))
+						Expect(p.Endpoints("", "", "").Next().ModificationTag).To(Equal(modTag))
 					})
 				})
 			})
@@ -575,7 +576,7 @@ var _ = Describe("RouteRegistry", func() {
 			Expect(r.NumUris()).To(Equal(1))
 
 			p1 := r.Lookup("foo/bar")
-			iter := p1.Endpoints("", "")
+			iter := p1.Endpoints("", "", "")
 			Expect(iter.Next().CanonicalAddr()).To(Equal("192.168.1.1:1234"))
 
 			p2 := r.Lookup("foo")
@@ -672,7 +673,7 @@ var _ = Describe("RouteRegistry", func() {
 			p2 := r.Lookup("FOO")
 			Expect(p1).To(Equal(p2))
 
-			iter := p1.Endpoints("", "")
+			iter := p1.Endpoints("", "", "")
 			Expect(iter.Next().CanonicalAddr()).To(Equal("192.168.1.1:1234"))
 		})
 
@@ -691,7 +692,7 @@ var _ = Describe("RouteRegistry", func() {
 
 			p := r.Lookup("bar")
 			Expect(p).ToNot(BeNil())
-			e := p.Endpoints("", "").Next()
+			e := p.Endpoints("", "", "").Next()
 			Expect(e).ToNot(BeNil())
 			Expect(e.CanonicalAddr()).To(MatchRegexp("192.168.1.1:123[4|5]"))
 		})
@@ -705,13 +706,13 @@ var _ = Describe("RouteRegistry", func() {
 
 			p := r.Lookup("foo.wild.card")
 			Expect(p).ToNot(BeNil())
-			e := p.Endpoints("", "").Next()
+			e := p.Endpoints("", "", "").Next()
 			Expect(e).ToNot(BeNil())
 			Expect(e.CanonicalAddr()).To(Equal("192.168.1.2:1234"))
 
 			p = r.Lookup("foo.space.wild.card")
 			Expect(p).ToNot(BeNil())
-			e = p.Endpoints("", "").Next()
+			e = p.Endpoints("", "", "").Next()
 			Expect(e).ToNot(BeNil())
 			Expect(e.CanonicalAddr()).To(Equal("192.168.1.2:1234"))
 		})
@@ -725,7 +726,7 @@ var _ = Describe("RouteRegistry", func() {
 
 			p := r.Lookup("not.wild.card")
 			Expect(p).ToNot(BeNil())
-			e := p.Endpoints("", "").Next()
+			e := p.Endpoints("", "", "").Next()
 			Expect(e).ToNot(BeNil())
 			Expect(e.CanonicalAddr()).To(Equal("192.168.1.1:1234"))
 		})
@@ -757,7 +758,7 @@ var _ = Describe("RouteRegistry", func() {
 				p := r.Lookup("dora.app.com/env?foo=bar")
 
 				Expect(p).ToNot(BeNil())
-				iter := p.Endpoints("", "")
+				iter := p.Endpoints("", "", "")
 				Expect(iter.Next().CanonicalAddr()).To(Equal("192.168.1.1:1234"))
 			})
 
@@ -766,7 +767,7 @@ var _ = Describe("RouteRegistry", func() {
 				p := r.Lookup("dora.app.com/env/abc?foo=bar&baz=bing")
 
 				Expect(p).ToNot(BeNil())
-				iter := p.Endpoints("", "")
+				iter := p.Endpoints("", "", "")
 				Expect(iter.Next().CanonicalAddr()).To(Equal("192.168.1.1:1234"))
 			})
 		})
@@ -800,7 +801,7 @@ var _ = Describe("RouteRegistry", func() {
 			Expect(r.NumEndpoints()).To(Equal(2))
 
 			p := r.LookupWithInstance("bar", appId, appIndex)
-			e := p.Endpoints("", "").Next()
+			e := p.Endpoints("", "", "").Next()
 
 			Expect(e).ToNot(BeNil())
 			Expect(e.CanonicalAddr()).To(MatchRegexp("192.168.1.1:1234"))
@@ -809,6 +810,26 @@ var _ = Describe("RouteRegistry", func() {
 			Expect(r.NumEndpoints()).To(Equal(2))
 		})
 
+		It("requires the authentication of the route for an instance registered without it", func() {
+			auth := &route.Auth{Type: route.AuthBasic, Htpasswd: "users"}
+			m3 := route.NewEndpoint("app-3-ID", "192.168.1.3", 1236, "", "0", nil, -1, "", modTag, "")
+			m3.Auth = auth
+			r.Register("bar", m3)
+
+			p := r.LookupWithInstance("bar", appId, appIndex)
+			Expect(p.Auth()).To(Equal(auth))
+		})
+
+		It("restricts an instance registered without IP access lists to those of the route", func() {
+			access := &route.IPAccess{Allow: []string{"10.0.0.0/8"}}
+			m3 := route.NewEndpoint("app-3-ID", "192.168.1.3", 1236, "", "0", nil, -1, "", modTag, "")
+			m3.IPAccess = access
+			r.Register("bar", m3)
+
+			p := r.LookupWithInstance("bar", appId, appIndex)
+			Expect(p.IPAccess()).To(Equal(access))
+		})
+
 		Context("when lookup fails to find any routes", func() {
 			It("returns nil", func() {
 				p := r.LookupWithInstance("foo", appId, appIndex)
@@ -845,6 +866,246 @@ var _ = Describe("RouteRegistry", func() {
 		})
 	})
 
+	Context("EachPool", func() {
+		It("calls the function with the pool of every HTTP route", func() {
+			r.Register("foo", fooEndpoint)
+			r.Register("bar", barEndpoint)
+			r.RegisterTCP(61000, bar2Endpoint)
+
+			pools := []*route.Pool{}
+			r.EachPool(func(pool *route.Pool) {
+				pools = append(pools, pool)
+			})
+			Expect(pools).To(ConsistOf(r.Lookup("foo"), r.Lookup("bar")))
+		})
+	})
+
+	Context("EachRoute", func() {
+		It("calls the function with every HTTP route and its pool", func() {
+			r.Register("foo", fooEndpoint)
+			r.Register("bar.com/path", barEndpoint)
+
+			uris := []route.Uri{}
+			r.EachRoute(func(uri route.Uri, pool *route.Pool) {
+				uris = append(uris, uri)
+				Expect(pool).To(Equal(r.Lookup(uri)))
+			})
+			Expect(uris).To(ConsistOf(route.Uri("foo"), route.Uri("bar.com/path")))
+		})
+	})
+
+	Context("RemoveRoute", func() {
+		It("removes the route and its endpoints", func() {
+			r.Register("foo", fooEndpoint)
+			r.Register("foo", barEndpoint)
+			r.Register("bar", barEndpoint)
+
+			Expect(r.RemoveRoute("FOO")).To(BeTrue())
+			Expect(r.Lookup("foo")).To(BeNil())
+			Expect(r.NumUris()).To(Equal(1))
+		})
+
+		It("returns false when the route is not registered", func() {
+			Expect(r.RemoveRoute("foo")).To(BeFalse())
+		})
+	})
+
+	Context("Frozen routes", func() {
+		BeforeEach(func() {
+			r.Register("foo", fooEndpoint)
+			r.Freeze("Foo", true)
+		})
+
+		It("lists the frozen routes", func() {
+			r.Freeze("bar", true)
+
+			Expect(r.FrozenRoutes()).To(ConsistOf(route.Uri("foo"), route.Uri("bar")))
+		})
+
+		It("ignores registrations of the route", func() {
+			r.Register("foo", barEndpoint)
+			r.Unregister("foo", fooEndpoint)
+
+			var addresses []string
+			r.Lookup("foo").Each(func(e *route.Endpoint) {
+				addresses = append(addresses, e.CanonicalAddr())
+			})
+			Expect(addresses).To(ConsistOf("192.168.1.1:1234"))
+		})
+
+		It("changes the route when forced", func() {
+			r.ForceRegister("foo", barEndpoint)
+			r.ForceUnregister("foo", fooEndpoint)
+
+			var addresses []string
+			r.Lookup("foo").Each(func(e *route.Endpoint) {
+				addresses = append(addresses, e.CanonicalAddr())
+			})
+			Expect(addresses).To(ConsistOf("192.168.1.2:4321"))
+		})
+
+		It("does not prune the endpoints of the route", func() {
+			r.Register("bar", barEndpoint)
+
+			r.StartPruningCycle()
+			defer r.StopPruningCycle()
+			time.Sleep(2 * configObj.PruneStaleDropletsInterval)
+
+			Expect(r.Lookup("foo")).NotTo(BeNil())
+			Expect(r.Lookup("bar")).To(BeNil())
+		})
+
+		It("changes the route again once unfrozen", func() {
+			r.Freeze("foo", false)
+			r.Unregister("foo", fooEndpoint)
+
+			Expect(r.FrozenRoutes()).To(BeEmpty())
+			Expect(r.Lookup("foo")).To(BeNil())
+		})
+	})
+
+	Context("Maintenance", func() {
+		It("puts the route in maintenance until it is taken out of maintenance", func() {
+			r.Register("foo", fooEndpoint)
+			m := &route.Maintenance{Body: "back soon"}
+
+			Expect(r.SetMaintenance("FOO", m)).To(BeTrue())
+			Expect(r.Lookup("foo").Maintenance()).To(Equal(m))
+
+			Expect(r.SetMaintenance("foo", nil)).To(BeTrue())
+			Expect(r.Lookup("foo").Maintenance()).To(BeNil())
+		})
+
+		It("keeps the route in maintenance when it is registered again", func() {
+			r.Register("foo", fooEndpoint)
+			m := &route.Maintenance{Body: "back soon"}
+			r.SetMaintenance("foo", m)
+
+			r.Unregister("foo", fooEndpoint)
+			Expect(r.Lookup("foo")).To(BeNil())
+
+			r.Register("foo", fooEndpoint)
+			Expect(r.Lookup("foo").Maintenance()).To(Equal(m))
+			Expect(r.LookupWithInstance("foo", "12345", "0").Maintenance()).To(Equal(m))
+		})
+
+		It("returns false for routes that are not registered", func() {
+			Expect(r.SetMaintenance("foo", &route.Maintenance{})).To(BeFalse())
+		})
+	})
+
+	Context("Draining endpoints", func() {
+		It("drains the endpoint in every pool", func() {
+			r.Register("foo", fooEndpoint)
+			r.Register("foo", barEndpoint)
+			r.Register("bar", fooEndpoint)
+			r.Register("bar", barEndpoint)
+
+			Expect(r.SetEndpointDraining("192.168.1.1:1234", true)).To(BeTrue())
+			Expect(r.DrainingEndpoints()).To(ConsistOf("192.168.1.1:1234"))
+
+			for _, uri := range []route.Uri{"foo", "bar"} {
+				iter := r.Lookup(uri).Endpoints("", "", "")
+				Expect(iter.Next()).To(Equal(barEndpoint))
+				Expect(iter.Next()).To(Equal(barEndpoint))
+			}
+			Expect(r.NumEndpoints()).To(Equal(2))
+		})
+
+		It("drains the endpoint in the pools of routes it is registered for later", func() {
+			r.Register("foo", fooEndpoint)
+			r.SetEndpointDraining("192.168.1.1:1234", true)
+
+			r.Register("bar", fooEndpoint)
+			r.Register("bar", barEndpoint)
+
+			iter := r.Lookup("bar").Endpoints("", "", "")
+			Expect(iter.Next()).To(Equal(barEndpoint))
+			Expect(iter.Next()).To(Equal(barEndpoint))
+		})
+
+		It("re-enables the endpoint", func() {
+			r.Register("foo", fooEndpoint)
+			r.SetEndpointDraining("192.168.1.1:1234", true)
+
+			Expect(r.SetEndpointDraining("192.168.1.1:1234", false)).To(BeTrue())
+			Expect(r.DrainingEndpoints()).To(BeEmpty())
+			Expect(r.Lookup("foo").Endpoints("", "", "").Next()).To(Equal(fooEndpoint))
+		})
+
+		It("returns false for endpoints that are not registered", func() {
+			Expect(r.SetEndpointDraining("192.168.1.1:1234", true)).To(BeFalse())
+			Expect(r.DrainingEndpoints()).To(BeEmpty())
+		})
+	})
+
+	Context("TCP routes", func() {
+		It("registers endpoints by port", func() {
+			r.RegisterTCP(61000, fooEndpoint)
+			r.RegisterTCP(61000, barEndpoint)
+			r.RegisterTCP(61001, bar2Endpoint)
+
+			p := r.LookupTCP(61000)
+			Expect(p).ToNot(BeNil())
+			Expect(p.Endpoints("", "", "").Next()).To(BeElementOf(fooEndpoint, barEndpoint))
+
+			p = r.LookupTCP(61001)
+			Expect(p).ToNot(BeNil())
+			Expect(p.Endpoints("", "", "").Next()).To(Equal(bar2Endpoint))
+
+			Expect(reporter.CaptureRegistryMessageCallCount()).To(Equal(3))
+		})
+
+		It("does not register tcp routes as uris", func() {
+			r.RegisterTCP(61000, fooEndpoint)
+
+			Expect(r.NumUris()).To(Equal(0))
+			Expect(r.Lookup("61000")).To(BeNil())
+		})
+
+		It("returns nil for ports without routes", func() {
+			Expect(r.LookupTCP(61000)).To(BeNil())
+		})
+
+		It("unregisters endpoints by port", func() {
+			r.RegisterTCP(61000, fooEndpoint)
+			r.RegisterTCP(61000, barEndpoint)
+
+			r.UnregisterTCP(61000, fooEndpoint)
+			p := r.LookupTCP(61000)
+			Expect(p).ToNot(BeNil())
+			Expect(p.Endpoints("", "", "").Next()).To(Equal(barEndpoint))
+
+			r.UnregisterTCP(61000, barEndpoint)
+			Expect(r.LookupTCP(61000)).To(BeNil())
+			Expect(reporter.CaptureUnregistryMessageCallCount()).To(Equal(2))
+		})
+
+		Context("when the endpoint is not in the router shard", func() {
+			BeforeEach(func() {
+				configObj.RoutingTableShardingMode = config.SHARD_SEGMENTS
+				r = NewRouteRegistry(logger, configObj, reporter)
+				fooEndpoint.IsolationSegment = "baz"
+			})
+
+			It("does not register the endpoint", func() {
+				r.RegisterTCP(61000, fooEndpoint)
+				Expect(r.LookupTCP(61000)).To(BeNil())
+			})
+		})
+
+		It("prunes stale endpoints", func() {
+			r.RegisterTCP(61000, fooEndpoint)
+			Expect(r.LookupTCP(61000)).ToNot(BeNil())
+
+			r.StartPruningCycle()
+			defer r.StopPruningCycle()
+
+			Eventually(func() *route.Pool { return r.LookupTCP(61000) }).Should(BeNil())
+			Eventually(logger).Should(gbytes.Say(`pruned-tcp-route.*61000`))
+		})
+	})
+
 	Context("Prunes Stale Droplets", func() {
 		AfterEach(func() {
 			r.StopPruningCycle()
@@ -937,7 +1198,7 @@ var _ = Describe("RouteRegistry", func() {
 
 			p := r.Lookup("foo")
 			Expect(p).ToNot(BeNil())
-			Expect(p.Endpoints("", "").Next()).To(Equal(endpoint))
+			Expect(p.Endpoints("", "", "").Next()).To(Equal(endpoint))
 
 			p = r.Lookup("bar")
 			Expect(p).To(BeNil())
@@ -1011,6 +1272,28 @@ var _ = Describe("RouteRegistry", func() {
 			})
 		})
 
+		Context("when endpoints have a TTL", func() {
+			It("prunes each endpoint after its own TTL", func() {
+				shortLived := route.NewEndpoint("", "192.168.1.1", 1234, "", "", nil, -1, "", modTag, "")
+				shortLived.TTL = time.Millisecond
+				longLived := route.NewEndpoint("", "192.168.1.2", 1234, "", "", nil, -1, "", modTag, "")
+				longLived.TTL = time.Hour
+
+				r.Register("foo", shortLived)
+				r.Register("foo", longLived)
+				r.Register("bar", longLived)
+				r.RegisterTCP(1024, longLived)
+
+				r.StartPruningCycle()
+				time.Sleep(configObj.PruneStaleDropletsInterval + configObj.DropletStaleThreshold)
+
+				Expect(r.NumUris()).To(Equal(2))
+				Expect(r.NumEndpoints()).To(Equal(1))
+				Expect(r.LookupTCP(1024)).ToNot(BeNil())
+				Expect(r.Lookup("foo").Endpoints("", "", "").Next()).To(Equal(longLived))
+			})
+		})
+
 		Context("when suspend pruning is triggered (i.e. nats offline)", func() {
 			var totalRoutes int
 
@@ -1058,6 +1341,135 @@ var _ = Describe("RouteRegistry", func() {
 
 	})
 
+	Context("Route audit", func() {
+		var publisher *auditPublisher
+
+		BeforeEach(func() {
+			configObj.RouteAudit = config.RouteAuditConfig{Enabled: true, MaxEvents: 3, NatsSubject: "router.audit"}
+			r = NewRouteRegistry(logger, configObj, reporter)
+			publisher = &auditPublisher{}
+			r.SetAuditPublisher(publisher)
+			fooEndpoint.Source = "nats"
+		})
+
+		AfterEach(func() {
+			r.StopPruningCycle()
+		})
+
+		It("records the endpoints registered and unregistered", func() {
+			r.Register("foo", fooEndpoint)
+			r.Register("foo", fooEndpoint)
+			r.Unregister("foo", fooEndpoint)
+
+			events := r.AuditEvents()
+			Expect(events).To(HaveLen(2))
+			Expect(events[0].Action).To(Equal(AuditRegister))
+			Expect(events[0].Route).To(Equal(route.Uri("foo")))
+			Expect(events[0].Endpoint).To(Equal("192.168.1.1:1234"))
+			Expect(events[0].Source).To(Equal("nats"))
+			Expect(events[0].AppID).To(Equal("12345"))
+			Expect(events[0].InstanceID).To(Equal("id1"))
+			Expect(events[0].Tags).To(HaveKeyWithValue("framework", "sinatra"))
+			Expect(events[1].Action).To(Equal(AuditUnregister))
+			Expect(logger).To(gbytes.Say(`route-audit.*"action":"register".*"source":"nats"`))
+		})
+
+		It("records the endpoints of TCP routes", func() {
+			r.RegisterTCP(61000, fooEndpoint)
+			r.UnregisterTCP(61000, fooEndpoint)
+
+			events := r.AuditEvents()
+			Expect(events).To(HaveLen(2))
+			Expect(events[0].Port).To(Equal(uint16(61000)))
+			Expect(events[1].Action).To(Equal(AuditUnregister))
+		})
+
+		It("records the endpoints of routes removed through the admin API", func() {
+			r.Register("foo", fooEndpoint)
+			r.RemoveRoute("foo")
+
+			events := r.AuditEvents()
+			Expect(events).To(HaveLen(2))
+			Expect(events[1].Action).To(Equal(AuditUnregister))
+			Expect(events[1].Source).To(Equal("admin"))
+		})
+
+		It("records the endpoints pruned", func() {
+			r.Register("foo", fooEndpoint)
+			r.StartPruningCycle()
+
+			Eventually(func() []AuditEvent { return r.AuditEvents() }).Should(HaveLen(2))
+			Expect(r.AuditEvents()[1].Action).To(Equal(AuditPrune))
+			Expect(r.AuditEvents()[1].Source).To(Equal("nats"))
+		})
+
+		It("keeps the last events", func() {
+			r.Register("foo", fooEndpoint)
+			r.Register("bar", barEndpoint)
+			r.Register("baz", bar2Endpoint)
+			r.Unregister("foo", fooEndpoint)
+
+			events := r.AuditEvents()
+			Expect(events).To(HaveLen(3))
+			Expect(events[0].Route).To(Equal(route.Uri("bar")))
+			Expect(events[2].Action).To(Equal(AuditUnregister))
+		})
+
+		It("publishes the events", func() {
+			r.Register("foo", fooEndpoint)
+
+			Expect(publisher.subjects).To(Equal([]string{"router.audit"}))
+			var event AuditEvent
+			Expect(json.Unmarshal(publisher.data[0], &event)).To(Succeed())
+			Expect(event.Action).To(Equal(AuditRegister))
+			Expect(event.Endpoint).To(Equal("192.168.1.1:1234"))
+		})
+
+		It("records nothing when it is disabled", func() {
+			configObj.RouteAudit.Enabled = false
+			r = NewRouteRegistry(logger, configObj, reporter)
+			r.Register("foo", fooEndpoint)
+
+			Expect(r.AuditEvents()).To(BeEmpty())
+		})
+	})
+
+	Context("Concurrent registrations", func() {
+		It("registers and looks up the routes of many hosts concurrently", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer GinkgoRecover()
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						uri := route.Uri(fmt.Sprintf("app-%d-%d.example.com/path", i, j))
+						r.Register(uri, fooEndpoint)
+						Expect(r.Lookup(uri)).ToNot(BeNil())
+						Expect(r.Lookup("other.example.com")).To(BeNil())
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			Expect(r.NumUris()).To(Equal(1000))
+			Expect(r.NumEndpoints()).To(Equal(1))
+
+			routes := 0
+			r.EachRoute(func(uri route.Uri, pool *route.Pool) {
+				routes++
+			})
+			Expect(routes).To(Equal(1000))
+		})
+
+		It("looks up wildcard routes of other hosts", func() {
+			r.Register("*.example.com", fooEndpoint)
+			for i := 0; i < 100; i++ {
+				Expect(r.Lookup(route.Uri(fmt.Sprintf("app-%d.example.com", i)))).ToNot(BeNil())
+			}
+		})
+	})
+
 	Context("Varz data", func() {
 		It("NumUris", func() {
 			r.Register("bar", barEndpoint)
@@ -1105,3 +1517,14 @@ var _ = Describe("RouteRegistry", func() {
 		Expect(string(marshalled)).To(Equal(`{}`))
 	})
 })
+
+type auditPublisher struct {
+	subjects []string
+	data     [][]byte
+}
+
+func (p *auditPublisher) Publish(subject string, data []byte) error {
+	p.subjects = append(p.subjects, subject)
+	p.data = append(p.data, data)
+	return nil
+}
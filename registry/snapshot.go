@@ -0,0 +1,240 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/routing-api/models"
+	"github.com/uber-go/zap"
+)
+
+// ErrSnapshotTooOld is returned by LoadSnapshot for snapshots older than the
+// maximum age.
+var ErrSnapshotTooOld = errors.New("snapshot is too old")
+
+type snapshot struct {
+	Time      time.Time          `json:"time"`
+	Routes    []snapshotRoute    `json:"routes"`
+	TCPRoutes []snapshotTCPRoute `json:"tcp_routes"`
+}
+
+type snapshotRoute struct {
+	Uri       route.Uri          `json:"uri"`
+	Endpoints []snapshotEndpoint `json:"endpoints"`
+}
+
+type snapshotTCPRoute struct {
+	Port      uint16             `json:"port"`
+	Endpoints []snapshotEndpoint `json:"endpoints"`
+}
+
+// snapshotEndpoint holds the registration of an endpoint. The stale
+// thresholds and TTLs of endpoints are not kept, so that the endpoints of a
+// snapshot are pruned after the router's stale threshold unless they are
+// registered again.
+type snapshotEndpoint struct {
+	App                  string                      `json:"app,omitempty"`
+	Address              string                      `json:"address"`
+	Tags                 map[string]string           `json:"tags,omitempty"`
+	PrivateInstanceID    string                      `json:"private_instance_id,omitempty"`
+	PrivateInstanceIndex string                      `json:"private_instance_index,omitempty"`
+	ModificationTag      models.ModificationTag      `json:"modification_tag"`
+	RouteServiceURL      string                      `json:"route_service_url,omitempty"`
+	RouteServiceURLs     []string                    `json:"route_service_urls,omitempty"`
+	IsolationSegment     string                      `json:"isolation_segment,omitempty"`
+	Weight               int                         `json:"weight,omitempty"`
+	Protocol             string                      `json:"protocol,omitempty"`
+	TLS                  bool                        `json:"tls,omitempty"`
+	ServerCertDomainSAN  string                      `json:"server_cert_domain_san,omitempty"`
+	EndpointTimeoutMs    int64                       `json:"endpoint_timeout_ms,omitempty"`
+	DialTimeoutMs        int64                       `json:"endpoint_dial_timeout_ms,omitempty"`
+	HeaderTimeoutMs      int64                       `json:"endpoint_response_header_timeout_ms,omitempty"`
+	IdleTimeoutMs        int64                       `json:"endpoint_idle_timeout_ms,omitempty"`
+	MaxConnections       int                         `json:"max_connections_per_endpoint,omitempty"`
+	MaxQueueDepth        int                         `json:"max_queue_depth,omitempty"`
+	MaxRequestBodySize   int64                       `json:"max_request_body_size_bytes,omitempty"`
+	CacheResponses       bool                        `json:"cache_responses,omitempty"`
+	RequestBuffering     string                      `json:"request_buffering,omitempty"`
+	StripPathPrefix      bool                        `json:"strip_path_prefix,omitempty"`
+	Group                string                      `json:"group,omitempty"`
+	Backup               bool                        `json:"backup,omitempty"`
+	Zone                 string                      `json:"availability_zone,omitempty"`
+	TrafficRules         []route.TrafficRule         `json:"traffic_rules,omitempty"`
+	Mirror               *route.Mirror               `json:"mirror,omitempty"`
+	HeaderRewrites       *config.HeaderRewriteConfig `json:"header_rewrites,omitempty"`
+	Maintenance          *route.Maintenance          `json:"maintenance,omitempty"`
+	Auth                 *route.Auth                 `json:"auth,omitempty"`
+	IPAccess             *route.IPAccess             `json:"ip_access,omitempty"`
+	WasmFilters          []string                    `json:"wasm_filters,omitempty"`
+	ForceHTTPS           bool                        `json:"force_https,omitempty"`
+}
+
+func newSnapshotEndpoint(e *route.Endpoint) snapshotEndpoint {
+	return snapshotEndpoint{
+		App:                  e.ApplicationId,
+		Address:              e.CanonicalAddr(),
+		Tags:                 e.Tags,
+		PrivateInstanceID:    e.PrivateInstanceId,
+		PrivateInstanceIndex: e.PrivateInstanceIndex,
+		ModificationTag:      e.ModificationTag,
+		RouteServiceURL:      e.RouteServiceUrl,
+		RouteServiceURLs:     e.RouteServiceChain,
+		IsolationSegment:     e.IsolationSegment,
+		Weight:               e.Weight,
+		Protocol:             e.Protocol,
+		TLS:                  e.UseTLS,
+		ServerCertDomainSAN:  e.ServerCertDomainSAN,
+		EndpointTimeoutMs:    int64(e.Timeout / time.Millisecond),
+		DialTimeoutMs:        int64(e.DialTimeout / time.Millisecond),
+		HeaderTimeoutMs:      int64(e.ResponseHeaderTimeout / time.Millisecond),
+		IdleTimeoutMs:        int64(e.IdleTimeout / time.Millisecond),
+		MaxConnections:       e.MaxConnections,
+		MaxQueueDepth:        e.MaxQueueDepth,
+		MaxRequestBodySize:   e.MaxRequestBodySize,
+		CacheResponses:       e.CacheResponses,
+		RequestBuffering:     e.RequestBuffering,
+		StripPathPrefix:      e.StripPathPrefix,
+		Group:                e.Group,
+		Backup:               e.Backup,
+		Zone:                 e.Zone,
+		TrafficRules:         e.TrafficRules,
+		Mirror:               e.Mirror,
+		HeaderRewrites:       e.HeaderRewrites,
+		Maintenance:          e.Maintenance,
+		Auth:                 e.Auth,
+		IPAccess:             e.IPAccess,
+		WasmFilters:          e.WasmFilters,
+		ForceHTTPS:           e.ForceHTTPS,
+	}
+}
+
+func (s snapshotEndpoint) endpoint() (*route.Endpoint, error) {
+	host, port := s.Address, uint64(0)
+	if !strings.HasPrefix(s.Address, route.UnixSocketPrefix) {
+		var portString string
+		var err error
+		host, portString, err = net.SplitHostPort(s.Address)
+		if err != nil {
+			return nil, err
+		}
+		port, err = strconv.ParseUint(portString, 10, 16)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	e := route.NewEndpoint(
+		s.App,
+		host,
+		uint16(port),
+		s.PrivateInstanceID,
+		s.PrivateInstanceIndex,
+		s.Tags,
+		-1,
+		s.RouteServiceURL,
+		s.ModificationTag,
+		s.IsolationSegment,
+	)
+	e.Weight = s.Weight
+	e.Protocol = s.Protocol
+	e.UseTLS = s.TLS
+	e.ServerCertDomainSAN = s.ServerCertDomainSAN
+	e.RouteServiceChain = s.RouteServiceURLs
+	e.Timeout = time.Duration(s.EndpointTimeoutMs) * time.Millisecond
+	e.DialTimeout = time.Duration(s.DialTimeoutMs) * time.Millisecond
+	e.ResponseHeaderTimeout = time.Duration(s.HeaderTimeoutMs) * time.Millisecond
+	e.IdleTimeout = time.Duration(s.IdleTimeoutMs) * time.Millisecond
+	e.MaxConnections = s.MaxConnections
+	e.MaxQueueDepth = s.MaxQueueDepth
+	e.MaxRequestBodySize = s.MaxRequestBodySize
+	e.CacheResponses = s.CacheResponses
+	e.RequestBuffering = s.RequestBuffering
+	e.StripPathPrefix = s.StripPathPrefix
+	e.Group = s.Group
+	e.Backup = s.Backup
+	e.Zone = s.Zone
+	e.TrafficRules = s.TrafficRules
+	e.Mirror = s.Mirror
+	e.HeaderRewrites = s.HeaderRewrites
+	e.Maintenance = s.Maintenance
+	e.Auth = s.Auth
+	e.IPAccess = s.IPAccess
+	e.WasmFilters = s.WasmFilters
+	e.ForceHTTPS = s.ForceHTTPS
+	e.Source = "snapshot"
+	return e, nil
+}
+
+// WriteSnapshot writes the HTTP and TCP routes and their endpoints as JSON,
+// to be loaded by LoadSnapshot.
+func (r *RouteRegistry) WriteSnapshot(w io.Writer) error {
+	snap := snapshot{Time: time.Now()}
+
+	r.EachRoute(func(uri route.Uri, pool *route.Pool) {
+		sr := snapshotRoute{Uri: uri}
+		pool.Each(func(e *route.Endpoint) {
+			sr.Endpoints = append(sr.Endpoints, newSnapshotEndpoint(e))
+		})
+		snap.Routes = append(snap.Routes, sr)
+	})
+
+	r.portLock.RLock()
+	for port, pool := range r.byPort {
+		sr := snapshotTCPRoute{Port: port}
+		pool.Each(func(e *route.Endpoint) {
+			sr.Endpoints = append(sr.Endpoints, newSnapshotEndpoint(e))
+		})
+		snap.TCPRoutes = append(snap.TCPRoutes, sr)
+	}
+	r.portLock.RUnlock()
+
+	return json.NewEncoder(w).Encode(snap)
+}
+
+// LoadSnapshot registers the endpoints of a snapshot written by
+// WriteSnapshot, unless the snapshot is older than maxAge. The endpoints are
+// registered as if they had just been registered, and are pruned after the
+// router's stale threshold unless they are registered again. Returns the
+// number of endpoints registered.
+func (r *RouteRegistry) LoadSnapshot(reader io.Reader, maxAge time.Duration) (int, error) {
+	var snap snapshot
+	err := json.NewDecoder(reader).Decode(&snap)
+	if err != nil {
+		return 0, err
+	}
+	if time.Since(snap.Time) > maxAge {
+		return 0, ErrSnapshotTooOld
+	}
+
+	count := 0
+	for _, sr := range snap.Routes {
+		for _, se := range sr.Endpoints {
+			e, err := se.endpoint()
+			if err != nil {
+				r.logger.Error("invalid-snapshot-endpoint", zap.String("address", se.Address), zap.Error(err))
+				continue
+			}
+			r.Register(sr.Uri, e)
+			count++
+		}
+	}
+	for _, sr := range snap.TCPRoutes {
+		for _, se := range sr.Endpoints {
+			e, err := se.endpoint()
+			if err != nil {
+				r.logger.Error("invalid-snapshot-endpoint", zap.String("address", se.Address), zap.Error(err))
+				continue
+			}
+			r.RegisterTCP(sr.Port, e)
+			count++
+		}
+	}
+	return count, nil
+}
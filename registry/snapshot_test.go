@@ -0,0 +1,84 @@
+package registry_test
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/metrics/fakes"
+	. "code.cloudfoundry.org/gorouter/registry"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/routing-api/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Snapshot", func() {
+	var (
+		r, loaded *RouteRegistry
+		endpoint  *route.Endpoint
+		buf       *bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		cfg := config.DefaultConfig()
+		r = NewRouteRegistry(test_util.NewTestZapLogger("test"), cfg, new(fakes.FakeRouteRegistryReporter))
+		loaded = NewRouteRegistry(test_util.NewTestZapLogger("test"), cfg, new(fakes.FakeRouteRegistryReporter))
+
+		endpoint = route.NewEndpoint("app-guid", "10.0.16.4", 8080, "instance-id", "2",
+			map[string]string{"component": "app"}, 30, "https://rs.example.com",
+			models.ModificationTag{Guid: "abc", Index: 3}, "")
+		endpoint.Weight = 5
+		endpoint.Timeout = 3 * time.Second
+		endpoint.ResponseHeaderTimeout = time.Second
+		endpoint.IdleTimeout = 10 * time.Second
+		endpoint.Maintenance = &route.Maintenance{Status: 503}
+		buf = new(bytes.Buffer)
+	})
+
+	It("loads the routes of a snapshot", func() {
+		r.Register("foo.example.com/path", endpoint)
+		r.RegisterTCP(1024, endpoint)
+		Expect(r.WriteSnapshot(buf)).To(Succeed())
+
+		count, err := loaded.LoadSnapshot(buf, time.Minute)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(count).To(Equal(2))
+
+		pool := loaded.Lookup("foo.example.com/path")
+		Expect(pool).ToNot(BeNil())
+		e := pool.Endpoints("", "", "").Next()
+		Expect(e.CanonicalAddr()).To(Equal("10.0.16.4:8080"))
+		Expect(e.ApplicationId).To(Equal("app-guid"))
+		Expect(e.PrivateInstanceId).To(Equal("instance-id"))
+		Expect(e.PrivateInstanceIndex).To(Equal("2"))
+		Expect(e.Tags).To(Equal(map[string]string{"component": "app"}))
+		Expect(e.RouteServiceUrl).To(Equal("https://rs.example.com"))
+		Expect(e.ModificationTag).To(Equal(models.ModificationTag{Guid: "abc", Index: 3}))
+		Expect(e.Weight).To(Equal(5))
+		Expect(e.Timeout).To(Equal(3 * time.Second))
+		Expect(e.ResponseHeaderTimeout).To(Equal(time.Second))
+		Expect(e.IdleTimeout).To(Equal(10 * time.Second))
+		Expect(e.Maintenance).To(Equal(&route.Maintenance{Status: 503}))
+		Expect(pool.ContextPath()).To(Equal("/path"))
+
+		Expect(loaded.LookupTCP(1024)).ToNot(BeNil())
+	})
+
+	It("does not load snapshots older than the maximum age", func() {
+		r.Register("foo.example.com", endpoint)
+		Expect(r.WriteSnapshot(buf)).To(Succeed())
+		time.Sleep(10 * time.Millisecond)
+
+		_, err := loaded.LoadSnapshot(buf, time.Millisecond)
+		Expect(err).To(Equal(ErrSnapshotTooOld))
+		Expect(loaded.NumUris()).To(BeZero())
+	})
+
+	It("fails for invalid snapshots", func() {
+		_, err := loaded.LoadSnapshot(strings.NewReader("{"), time.Minute)
+		Expect(err).To(HaveOccurred())
+	})
+})
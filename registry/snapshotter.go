@@ -0,0 +1,96 @@
+package registry
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"github.com/uber-go/zap"
+)
+
+// Snapshotter persists the routing table of a registry to a file and loads
+// it at startup.
+type Snapshotter struct {
+	logger   logger.Logger
+	registry *RouteRegistry
+	config   config.RouteSnapshotConfig
+	clock    clock.Clock
+}
+
+func NewSnapshotter(logger logger.Logger, registry *RouteRegistry, cfg config.RouteSnapshotConfig, clock clock.Clock) *Snapshotter {
+	return &Snapshotter{
+		logger:   logger,
+		registry: registry,
+		config:   cfg,
+		clock:    clock,
+	}
+}
+
+// Run loads the snapshot file, if there is one, before it is ready. It then
+// writes the snapshot every interval, and once more when it is signaled.
+func (s *Snapshotter) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	s.Load()
+
+	ticker := s.clock.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	close(ready)
+	for {
+		select {
+		case <-ticker.C():
+			s.Save()
+		case <-signals:
+			s.Save()
+			return nil
+		}
+	}
+}
+
+// Load registers the endpoints of the snapshot file.
+func (s *Snapshotter) Load() {
+	f, err := os.Open(s.config.Path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		s.logger.Error("failed-to-load-route-snapshot", zap.String("path", s.config.Path), zap.Error(err))
+		return
+	}
+	defer f.Close()
+
+	count, err := s.registry.LoadSnapshot(f, s.config.MaxAge)
+	if err != nil {
+		s.logger.Error("failed-to-load-route-snapshot", zap.String("path", s.config.Path), zap.Error(err))
+		return
+	}
+	s.logger.Info("route-snapshot-loaded", zap.String("path", s.config.Path), zap.Int("endpoints", count))
+}
+
+// Save writes the snapshot to a temporary file that replaces the snapshot
+// file, so that the snapshot file is never partially written.
+func (s *Snapshotter) Save() {
+	err := s.save()
+	if err != nil {
+		s.logger.Error("failed-to-save-route-snapshot", zap.String("path", s.config.Path), zap.Error(err))
+	}
+}
+
+func (s *Snapshotter) save() error {
+	f, err := ioutil.TempFile(filepath.Dir(s.config.Path), filepath.Base(s.config.Path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	err = s.registry.WriteSnapshot(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.config.Path)
+}
@@ -0,0 +1,82 @@
+package registry_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/metrics/fakes"
+	. "code.cloudfoundry.org/gorouter/registry"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/routing-api/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Snapshotter", func() {
+	var (
+		r        *RouteRegistry
+		cfg      *config.Config
+		dir      string
+		clock    *fakeclock.FakeClock
+		process  ifrit.Process
+		endpoint *route.Endpoint
+	)
+
+	newRegistry := func() *RouteRegistry {
+		return NewRouteRegistry(test_util.NewTestZapLogger("test"), cfg, new(fakes.FakeRouteRegistryReporter))
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "route-snapshot")
+		Expect(err).ToNot(HaveOccurred())
+
+		cfg = config.DefaultConfig()
+		cfg.RouteSnapshot.Path = filepath.Join(dir, "routes.json")
+		clock = fakeclock.NewFakeClock(time.Now())
+		r = newRegistry()
+		endpoint = route.NewEndpoint("", "10.0.16.4", 8080, "", "", nil, -1, "", models.ModificationTag{}, "")
+	})
+
+	AfterEach(func() {
+		if process != nil {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive())
+		}
+		os.RemoveAll(dir)
+	})
+
+	It("saves the snapshot every interval", func() {
+		process = ifrit.Invoke(NewSnapshotter(test_util.NewTestZapLogger("test"), r, cfg.RouteSnapshot, clock))
+		Expect(cfg.RouteSnapshot.Path).ToNot(BeAnExistingFile())
+
+		r.Register("foo.example.com", endpoint)
+		Eventually(func() bool {
+			clock.WaitForWatcherAndIncrement(cfg.RouteSnapshot.Interval)
+			_, err := os.Stat(cfg.RouteSnapshot.Path)
+			return err == nil
+		}).Should(BeTrue())
+	})
+
+	It("saves the snapshot when it stops and loads it when it starts", func() {
+		process = ifrit.Invoke(NewSnapshotter(test_util.NewTestZapLogger("test"), r, cfg.RouteSnapshot, clock))
+		r.Register("foo.example.com", endpoint)
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+
+		restarted := newRegistry()
+		process = ifrit.Invoke(NewSnapshotter(test_util.NewTestZapLogger("test"), restarted, cfg.RouteSnapshot, clock))
+		Expect(restarted.Lookup("foo.example.com")).ToNot(BeNil())
+	})
+
+	It("starts without a snapshot file", func() {
+		process = ifrit.Invoke(NewSnapshotter(test_util.NewTestZapLogger("test"), r, cfg.RouteSnapshot, clock))
+		Expect(r.NumUris()).To(BeZero())
+	})
+})
@@ -0,0 +1,475 @@
+package resolver
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"github.com/uber-go/zap"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	checkInterval = time.Second
+	// the addresses of the other family are dialed when those of the first
+	// family did not connect within fallbackDelay, like by net.Dialer
+	fallbackDelay = 300 * time.Millisecond
+	// hostnames that are not dialed for idleTimeout are no longer resolved
+	idleTimeout    = 10 * time.Minute
+	resolvConfPath = "/etc/resolv.conf"
+	maxMessageSize = 65535
+)
+
+var errMismatchedID = errors.New("resolver: response does not match the query")
+
+// Resolver resolves the hostnames of endpoints with their A and AAAA
+// records, and caches their addresses until the records expire. Expired
+// hostnames are resolved again in the background by Run, so that only the
+// first connection to a hostname waits for its resolution, and the addresses
+// are kept while the nameservers fail.
+type Resolver struct {
+	config      config.BackendDNSConfig
+	nameservers []string
+	logger      logger.Logger
+	clock       clock.Clock
+
+	lock  sync.Mutex
+	hosts map[string]*host
+}
+
+// host is a hostname and its current addresses.
+type host struct {
+	// resolved is closed once the hostname is first resolved
+	resolved  chan struct{}
+	resolving bool
+	addrs     []net.IP
+	err       error
+	expiresAt time.Time
+	usedAt    time.Time
+	next      uint32
+}
+
+// NewResolver returns a resolver querying the configured nameservers, or the
+// nameservers of /etc/resolv.conf if none are configured.
+func NewResolver(logger logger.Logger, cfg config.BackendDNSConfig, clock clock.Clock) (*Resolver, error) {
+	nameservers := cfg.Nameservers
+	if len(nameservers) == 0 {
+		var err error
+		nameservers, err = systemNameservers(resolvConfPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	addrs := make([]string, 0, len(nameservers))
+	for _, nameserver := range nameservers {
+		if _, _, err := net.SplitHostPort(nameserver); err != nil {
+			nameserver = net.JoinHostPort(nameserver, "53")
+		}
+		addrs = append(addrs, nameserver)
+	}
+
+	return &Resolver{
+		config:      cfg,
+		nameservers: addrs,
+		logger:      logger,
+		clock:       clock,
+		hosts:       map[string]*host{},
+	}, nil
+}
+
+// DialTimeout dials the address like net.DialTimeout, resolving its hostname
+// with the resolver. Successive connections to a hostname are balanced
+// across its addresses, and the next address is dialed when one fails. The
+// addresses of hostnames with IPv4 and IPv6 addresses are dialed with Happy
+// Eyeballs (RFC 8305): the family of the address balanced to is dialed
+// first, and the other family after a short delay, or as soon as the first
+// family fails.
+func (r *Resolver) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	hostname, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(hostname) != nil {
+		return net.DialTimeout(network, address, timeout)
+	}
+
+	h, err := r.lookup(hostname)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+	r.lock.Lock()
+	addrs := h.addrs
+	r.lock.Unlock()
+
+	start := int(atomic.AddUint32(&h.next, 1))
+	var primaries, fallbacks []string
+	for i := range addrs {
+		addr := addrs[(start+i)%len(addrs)]
+		if (addr.To4() != nil) == (addrs[start%len(addrs)].To4() != nil) {
+			primaries = append(primaries, net.JoinHostPort(addr.String(), port))
+		} else {
+			fallbacks = append(fallbacks, net.JoinHostPort(addr.String(), port))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if len(fallbacks) == 0 {
+		return dialSerial(ctx, network, primaries)
+	}
+	return dialParallel(ctx, network, primaries, fallbacks)
+}
+
+// dialSerial dials the addresses in turn until one connects.
+func dialSerial(ctx context.Context, network string, addrs []string) (net.Conn, error) {
+	var dialer net.Dialer
+	var err error
+	for _, addr := range addrs {
+		var conn net.Conn
+		conn, err = dialer.DialContext(ctx, network, addr)
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// dialParallel dials the primary addresses, and the fallback addresses after
+// fallbackDelay or once the primary addresses failed, and returns the first
+// connection.
+func dialParallel(ctx context.Context, network string, primaries, fallbacks []string) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result)
+	done := make(chan struct{})
+	defer close(done)
+	dial := func(addrs []string) {
+		conn, err := dialSerial(ctx, network, addrs)
+		select {
+		case results <- result{conn: conn, err: err}:
+		case <-done:
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}
+
+	go dial(primaries)
+	fallback := time.NewTimer(fallbackDelay)
+	defer fallback.Stop()
+	pending, fallen := 1, false
+	var firstErr error
+	for {
+		select {
+		case <-fallback.C:
+			if !fallen {
+				fallen = true
+				pending++
+				go dial(fallbacks)
+			}
+		case res := <-results:
+			if res.err == nil {
+				return res.conn, nil
+			}
+			pending--
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			if !fallen {
+				fallen = true
+				pending++
+				go dial(fallbacks)
+			}
+			if pending == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
+
+// Lookup returns the current addresses of the hostname, resolving it if it
+// was not resolved before.
+func (r *Resolver) Lookup(hostname string) ([]net.IP, error) {
+	h, err := r.lookup(hostname)
+	if err != nil {
+		return nil, err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return h.addrs, nil
+}
+
+func (r *Resolver) lookup(hostname string) (*host, error) {
+	hostname = strings.ToLower(hostname)
+	r.lock.Lock()
+	h, ok := r.hosts[hostname]
+	if !ok {
+		h = &host{resolved: make(chan struct{}), resolving: true}
+		r.hosts[hostname] = h
+	}
+	h.usedAt = r.clock.Now()
+	r.lock.Unlock()
+
+	if !ok {
+		r.resolve(hostname, h)
+		close(h.resolved)
+	}
+	<-h.resolved
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(h.addrs) == 0 {
+		return nil, h.err
+	}
+	return h, nil
+}
+
+func (r *Resolver) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ticker := r.clock.NewTicker(checkInterval)
+	r.logger.Info("dns-resolver-started", zap.String("nameservers", strings.Join(r.nameservers, ",")))
+
+	close(ready)
+	for {
+		select {
+		case <-ticker.C():
+			r.Refresh()
+		case <-signals:
+			r.logger.Info("stopping")
+			ticker.Stop()
+			return nil
+		}
+	}
+}
+
+// Refresh resolves the hostnames whose records expired, and drops the
+// hostnames that were not dialed for ten minutes.
+func (r *Resolver) Refresh() {
+	now := r.clock.Now()
+	due := map[string]*host{}
+	r.lock.Lock()
+	for hostname, h := range r.hosts {
+		switch {
+		case h.resolving:
+		case now.Sub(h.usedAt) >= idleTimeout:
+			delete(r.hosts, hostname)
+		case !now.Before(h.expiresAt):
+			h.resolving = true
+			due[hostname] = h
+		}
+	}
+	r.lock.Unlock()
+
+	var wg sync.WaitGroup
+	for hostname, h := range due {
+		wg.Add(1)
+		go func(hostname string, h *host) {
+			defer wg.Done()
+			r.resolve(hostname, h)
+		}(hostname, h)
+	}
+	wg.Wait()
+}
+
+// resolve queries the addresses of the hostname. When the query fails, the
+// current addresses are kept, and the hostname is resolved again after the
+// minimum TTL.
+func (r *Resolver) resolve(hostname string, h *host) {
+	addrs, ttl, err := r.query(hostname)
+	if ttl < r.config.MinTTL {
+		ttl = r.config.MinTTL
+	}
+	if ttl > r.config.MaxTTL {
+		ttl = r.config.MaxTTL
+	}
+
+	r.lock.Lock()
+	h.resolving = false
+	h.err = err
+	h.expiresAt = r.clock.Now().Add(ttl)
+	if err == nil {
+		h.addrs = addrs
+	}
+	r.lock.Unlock()
+
+	if err != nil {
+		r.logger.Error("dns-resolution-failed", zap.String("hostname", hostname), zap.Error(err))
+		return
+	}
+	r.logger.Debug("dns-resolved", zap.String("hostname", hostname), zap.Int("addresses", len(addrs)), zap.Duration("ttl", ttl))
+}
+
+// query asks the nameservers in turn for the A and AAAA records of the
+// hostname, and returns their addresses and lowest TTL.
+func (r *Resolver) query(hostname string) ([]net.IP, time.Duration, error) {
+	name, err := dnsmessage.NewName(strings.TrimSuffix(hostname, ".") + ".")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for _, nameserver := range r.nameservers {
+		var addrs []net.IP
+		var ttl time.Duration
+		addrs, ttl, err = r.queryNameserver(nameserver, name)
+		if err == nil {
+			return addrs, ttl, nil
+		}
+	}
+	return nil, 0, err
+}
+
+type answer struct {
+	addrs []net.IP
+	ttl   time.Duration
+	err   error
+}
+
+func (r *Resolver) queryNameserver(nameserver string, name dnsmessage.Name) ([]net.IP, time.Duration, error) {
+	answers := make(chan answer, 2)
+	for _, t := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		go func(t dnsmessage.Type) {
+			answers <- r.ask(nameserver, name, t)
+		}(t)
+	}
+
+	var result answer
+	for i := 0; i < 2; i++ {
+		a := <-answers
+		if a.err != nil {
+			result.err = a.err
+			continue
+		}
+		if len(a.addrs) > 0 && (len(result.addrs) == 0 || a.ttl < result.ttl) {
+			result.ttl = a.ttl
+		}
+		result.addrs = append(result.addrs, a.addrs...)
+	}
+	// the addresses of one type are used when the query of the other fails
+	if len(result.addrs) > 0 {
+		return result.addrs, result.ttl, nil
+	}
+	if result.err == nil {
+		result.err = fmt.Errorf("resolver: no addresses for %s", name.String())
+	}
+	return nil, 0, result.err
+}
+
+// ask queries the records of the type over UDP, and over TCP if the response
+// is truncated. A name without records of the type has no addresses.
+func (r *Resolver) ask(nameserver string, name dnsmessage.Name, t dnsmessage.Type) answer {
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: uint16(rand.Uint32()), RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: t, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return answer{err: err}
+	}
+
+	response, err := r.exchange("udp", nameserver, query.Header.ID, packed)
+	if err == nil && response.Truncated {
+		response, err = r.exchange("tcp", nameserver, query.Header.ID, packed)
+	}
+	if err != nil {
+		return answer{err: err}
+	}
+	switch response.RCode {
+	case dnsmessage.RCodeSuccess, dnsmessage.RCodeNameError:
+	default:
+		return answer{err: fmt.Errorf("resolver: %s responded with %s", nameserver, response.RCode)}
+	}
+
+	var a answer
+	for _, resource := range response.Answers {
+		var addr net.IP
+		switch body := resource.Body.(type) {
+		case *dnsmessage.AResource:
+			addr = net.IP(body.A[:])
+		case *dnsmessage.AAAAResource:
+			addr = net.IP(body.AAAA[:])
+		default:
+			continue
+		}
+		ttl := time.Duration(resource.Header.TTL) * time.Second
+		if len(a.addrs) == 0 || ttl < a.ttl {
+			a.ttl = ttl
+		}
+		a.addrs = append(a.addrs, addr)
+	}
+	return a
+}
+
+func (r *Resolver) exchange(network, nameserver string, id uint16, query []byte) (*dnsmessage.Message, error) {
+	conn, err := net.DialTimeout(network, nameserver, r.config.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	err = conn.SetDeadline(time.Now().Add(r.config.Timeout))
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, maxMessageSize)
+	var n int
+	if network == "tcp" {
+		// messages over TCP are prefixed with their length
+		length := make([]byte, 2)
+		binary.BigEndian.PutUint16(length, uint16(len(query)))
+		if _, err = conn.Write(append(length, query...)); err != nil {
+			return nil, err
+		}
+		if _, err = io.ReadFull(conn, length); err != nil {
+			return nil, err
+		}
+		n = int(binary.BigEndian.Uint16(length))
+		_, err = io.ReadFull(conn, buf[:n])
+	} else {
+		if _, err = conn.Write(query); err != nil {
+			return nil, err
+		}
+		n, err = conn.Read(buf)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var response dnsmessage.Message
+	if err := response.Unpack(buf[:n]); err != nil {
+		return nil, err
+	}
+	if response.ID != id || !response.Response {
+		return nil, errMismatchedID
+	}
+	return &response, nil
+}
+
+// systemNameservers returns the nameservers of the resolv.conf file.
+func systemNameservers(path string) ([]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var nameservers []string
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			nameservers = append(nameservers, fields[1])
+		}
+	}
+	if len(nameservers) == 0 {
+		return nil, fmt.Errorf("resolver: no nameservers in %s", path)
+	}
+	return nameservers, nil
+}
@@ -0,0 +1,313 @@
+package resolver_test
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/resolver"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"golang.org/x/net/dns/dnsmessage"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+// fakeNameserver answers the A and AAAA queries of the hostnames in records
+// over UDP.
+type fakeNameserver struct {
+	conn    net.PacketConn
+	queries int32
+
+	lock    sync.Mutex
+	records map[string][]string
+	ttl     uint32
+	failing bool
+}
+
+func newFakeNameserver() *fakeNameserver {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	Expect(err).ToNot(HaveOccurred())
+	ns := &fakeNameserver{conn: conn, records: map[string][]string{}, ttl: 10}
+	go ns.serve()
+	return ns
+}
+
+func (ns *fakeNameserver) set(hostname string, addrs ...string) {
+	ns.lock.Lock()
+	defer ns.lock.Unlock()
+	ns.records[hostname+"."] = addrs
+}
+
+func (ns *fakeNameserver) fail(failing bool) {
+	ns.lock.Lock()
+	defer ns.lock.Unlock()
+	ns.failing = failing
+}
+
+func (ns *fakeNameserver) Queries() int32 {
+	return atomic.LoadInt32(&ns.queries)
+}
+
+func (ns *fakeNameserver) serve() {
+	defer GinkgoRecover()
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := ns.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var query dnsmessage.Message
+		Expect(query.Unpack(buf[:n])).To(Succeed())
+		atomic.AddInt32(&ns.queries, 1)
+
+		response := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: query.ID, Response: true, RCode: dnsmessage.RCodeSuccess},
+			Questions: query.Questions,
+		}
+		question := query.Questions[0]
+		ns.lock.Lock()
+		addrs, ok := ns.records[question.Name.String()]
+		switch {
+		case ns.failing:
+			response.RCode = dnsmessage.RCodeServerFailure
+		case !ok:
+			response.RCode = dnsmessage.RCodeNameError
+		}
+		for _, addr := range addrs {
+			ip := net.ParseIP(addr)
+			header := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: ns.ttl}
+			switch {
+			case ip.To4() != nil && question.Type == dnsmessage.TypeA:
+				header.Type = dnsmessage.TypeA
+				a := &dnsmessage.AResource{}
+				copy(a.A[:], ip.To4())
+				response.Answers = append(response.Answers, dnsmessage.Resource{Header: header, Body: a})
+			case ip.To4() == nil && question.Type == dnsmessage.TypeAAAA:
+				header.Type = dnsmessage.TypeAAAA
+				aaaa := &dnsmessage.AAAAResource{}
+				copy(aaaa.AAAA[:], ip)
+				response.Answers = append(response.Answers, dnsmessage.Resource{Header: header, Body: aaaa})
+			}
+		}
+		ns.lock.Unlock()
+
+		packed, err := response.Pack()
+		Expect(err).ToNot(HaveOccurred())
+		ns.conn.WriteTo(packed, addr)
+	}
+}
+
+var _ = Describe("Resolver", func() {
+	var (
+		logger     *test_util.TestZapLogger
+		clock      *fakeclock.FakeClock
+		nameserver *fakeNameserver
+		cfg        config.BackendDNSConfig
+		r          *resolver.Resolver
+	)
+
+	BeforeEach(func() {
+		logger = test_util.NewTestZapLogger("test")
+		clock = fakeclock.NewFakeClock(time.Now())
+		nameserver = newFakeNameserver()
+		cfg = config.BackendDNSConfig{
+			Enabled:     true,
+			Nameservers: []string{nameserver.conn.LocalAddr().String()},
+			Timeout:     time.Second,
+			MinTTL:      time.Second,
+			MaxTTL:      time.Hour,
+		}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		r, err = resolver.NewResolver(logger, cfg, clock)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		nameserver.conn.Close()
+	})
+
+	It("resolves the A and AAAA records of hostnames", func() {
+		nameserver.set("app.example.com", "10.0.0.1", "10.0.0.2", "fd00::1")
+
+		addrs, err := r.Lookup("app.example.com")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(addrs).To(ConsistOf(
+			net.ParseIP("10.0.0.1").To4(),
+			net.ParseIP("10.0.0.2").To4(),
+			net.ParseIP("fd00::1"),
+		))
+	})
+
+	It("returns an error for hostnames without records", func() {
+		_, err := r.Lookup("missing.example.com")
+		Expect(err).To(MatchError(ContainSubstring("no addresses")))
+	})
+
+	It("caches the addresses until their records expire", func() {
+		nameserver.set("app.example.com", "10.0.0.1")
+		_, err := r.Lookup("app.example.com")
+		Expect(err).ToNot(HaveOccurred())
+		queries := nameserver.Queries()
+
+		nameserver.set("app.example.com", "10.0.0.2")
+		clock.Increment(9 * time.Second)
+		r.Refresh()
+		addrs, err := r.Lookup("app.example.com")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(addrs).To(Equal([]net.IP{net.ParseIP("10.0.0.1").To4()}))
+		Expect(nameserver.Queries()).To(Equal(queries))
+
+		clock.Increment(time.Second)
+		r.Refresh()
+		addrs, err = r.Lookup("app.example.com")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(addrs).To(Equal([]net.IP{net.ParseIP("10.0.0.2").To4()}))
+	})
+
+	Context("when the TTL of the records is above the maximum", func() {
+		BeforeEach(func() {
+			cfg.MaxTTL = 5 * time.Second
+		})
+
+		It("resolves the hostnames again after the maximum", func() {
+			nameserver.set("app.example.com", "10.0.0.1")
+			_, err := r.Lookup("app.example.com")
+			Expect(err).ToNot(HaveOccurred())
+
+			nameserver.set("app.example.com", "10.0.0.2")
+			clock.Increment(5 * time.Second)
+			r.Refresh()
+			addrs, err := r.Lookup("app.example.com")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(addrs).To(Equal([]net.IP{net.ParseIP("10.0.0.2").To4()}))
+		})
+	})
+
+	It("keeps the addresses when the nameserver fails", func() {
+		nameserver.set("app.example.com", "10.0.0.1")
+		_, err := r.Lookup("app.example.com")
+		Expect(err).ToNot(HaveOccurred())
+
+		nameserver.fail(true)
+		clock.Increment(10 * time.Second)
+		r.Refresh()
+		Expect(logger.Buffer()).To(gbytes.Say("dns-resolution-failed"))
+		addrs, err := r.Lookup("app.example.com")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(addrs).To(Equal([]net.IP{net.ParseIP("10.0.0.1").To4()}))
+	})
+
+	It("stops resolving hostnames that are not dialed", func() {
+		nameserver.set("app.example.com", "10.0.0.1")
+		_, err := r.Lookup("app.example.com")
+		Expect(err).ToNot(HaveOccurred())
+
+		clock.Increment(10 * time.Minute)
+		r.Refresh()
+		queries := nameserver.Queries()
+		clock.Increment(10 * time.Second)
+		r.Refresh()
+		Expect(nameserver.Queries()).To(Equal(queries))
+	})
+
+	Describe("DialTimeout", func() {
+		var listener net.Listener
+
+		BeforeEach(func() {
+			var err error
+			listener, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			go func(listener net.Listener) {
+				for {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+					conn.Close()
+				}
+			}(listener)
+		})
+
+		AfterEach(func() {
+			listener.Close()
+		})
+
+		port := func() string {
+			_, port, err := net.SplitHostPort(listener.Addr().String())
+			Expect(err).ToNot(HaveOccurred())
+			return port
+		}
+
+		It("dials the addresses of the hostname", func() {
+			nameserver.set("app.example.com", "127.0.0.1")
+
+			conn, err := r.DialTimeout("tcp", net.JoinHostPort("app.example.com", port()), time.Second)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(conn.RemoteAddr().String()).To(Equal(listener.Addr().String()))
+			conn.Close()
+		})
+
+		It("balances the connections across the addresses", func() {
+			all, err := net.Listen("tcp", ":0")
+			Expect(err).ToNot(HaveOccurred())
+			defer all.Close()
+			_, allPort, err := net.SplitHostPort(all.Addr().String())
+			Expect(err).ToNot(HaveOccurred())
+			nameserver.set("app.example.com", "127.0.0.1", "127.0.0.2")
+
+			dialed := map[string]bool{}
+			for i := 0; i < 2; i++ {
+				conn, err := r.DialTimeout("tcp", net.JoinHostPort("app.example.com", allPort), time.Second)
+				Expect(err).ToNot(HaveOccurred())
+				dialed[conn.RemoteAddr().(*net.TCPAddr).IP.String()] = true
+				conn.Close()
+			}
+			Expect(dialed).To(HaveLen(2))
+		})
+
+		It("dials the next address when one fails", func() {
+			// nothing listens on 127.0.0.2
+			nameserver.set("app.example.com", "127.0.0.1", "127.0.0.2")
+
+			for i := 0; i < 2; i++ {
+				conn, err := r.DialTimeout("tcp", net.JoinHostPort("app.example.com", port()), time.Second)
+				Expect(err).ToNot(HaveOccurred())
+				conn.Close()
+			}
+		})
+
+		It("falls back to the other family without waiting for the timeout", func() {
+			// fd00::1 is unreachable, which may only show after the timeout
+			nameserver.set("app.example.com", "fd00::1", "127.0.0.1")
+
+			for i := 0; i < 2; i++ {
+				start := time.Now()
+				conn, err := r.DialTimeout("tcp", net.JoinHostPort("app.example.com", port()), 5*time.Second)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(conn.RemoteAddr().String()).To(Equal(listener.Addr().String()))
+				Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+				conn.Close()
+			}
+		})
+
+		It("dials IP addresses without resolving them", func() {
+			conn, err := r.DialTimeout("tcp", listener.Addr().String(), time.Second)
+			Expect(err).ToNot(HaveOccurred())
+			conn.Close()
+			Expect(nameserver.Queries()).To(BeZero())
+		})
+
+		It("returns an error when the hostname cannot be resolved", func() {
+			_, err := r.DialTimeout("tcp", net.JoinHostPort("missing.example.com", port()), time.Second)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,47 @@
+package route
+
+// Authentication schemes that routes can require.
+const (
+	AuthBasic = "basic"
+	AuthJWT   = "jwt"
+)
+
+// Auth requires requests for a route to be authenticated by the router before
+// they are proxied.
+type Auth struct {
+	// Type is AuthBasic, for HTTP Basic authentication against an htpasswd
+	// file of the router, or AuthJWT, for bearer tokens issued by the UAA.
+	Type string `json:"type"`
+	// Htpasswd is the name of the htpasswd file of the router whose users
+	// may access the route, for basic authentication.
+	Htpasswd string `json:"htpasswd,omitempty"`
+	// Scopes are the scopes of which tokens must have at least one, for
+	// JWT authentication.
+	Scopes []string `json:"scopes,omitempty"`
+	// Realm is the realm of the WWW-Authenticate header of responses to
+	// requests that are not authenticated, the host of the request when it
+	// is empty.
+	Realm string `json:"realm,omitempty"`
+	// ClaimHeaders maps the names of headers to the claims of the token
+	// whose values they are set to on requests proxied with JWT
+	// authentication, replacing any headers of the names that clients send.
+	ClaimHeaders map[string]string `json:"claim_headers,omitempty"`
+}
+
+// Valid reports whether basic authentication names an htpasswd file and has
+// no claim headers, and JWT authentication has scopes and names the header
+// and claim of each claim header.
+func (a *Auth) Valid() bool {
+	switch a.Type {
+	case AuthBasic:
+		return a.Htpasswd != "" && len(a.ClaimHeaders) == 0
+	case AuthJWT:
+		for header, claim := range a.ClaimHeaders {
+			if header == "" || claim == "" {
+				return false
+			}
+		}
+		return len(a.Scopes) > 0
+	}
+	return false
+}
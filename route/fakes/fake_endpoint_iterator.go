@@ -3,6 +3,7 @@ package fakes
 
 import (
 	"sync"
+	"time"
 
 	"code.cloudfoundry.org/gorouter/route"
 )
@@ -17,16 +18,30 @@ type FakeEndpointIterator struct {
 	EndpointFailedStub        func()
 	endpointFailedMutex       sync.RWMutex
 	endpointFailedArgsForCall []struct{}
-	PreRequestStub            func(e *route.Endpoint)
+	PreRequestStub            func(e *route.Endpoint) bool
 	preRequestMutex           sync.RWMutex
 	preRequestArgsForCall     []struct {
 		e *route.Endpoint
 	}
+	preRequestReturns struct {
+		result1 bool
+	}
 	PostRequestStub        func(e *route.Endpoint)
 	postRequestMutex       sync.RWMutex
 	postRequestArgsForCall []struct {
 		e *route.Endpoint
 	}
+	EndpointErroredStub          func()
+	endpointErroredMutex         sync.RWMutex
+	endpointErroredArgsForCall   []struct{}
+	EndpointSucceededStub        func()
+	endpointSucceededMutex       sync.RWMutex
+	endpointSucceededArgsForCall []struct{}
+	EndpointRespondedStub        func(latency time.Duration)
+	endpointRespondedMutex       sync.RWMutex
+	endpointRespondedArgsForCall []struct {
+		latency time.Duration
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
@@ -71,7 +86,7 @@ func (fake *FakeEndpointIterator) EndpointFailedCallCount() int {
 	return len(fake.endpointFailedArgsForCall)
 }
 
-func (fake *FakeEndpointIterator) PreRequest(e *route.Endpoint) {
+func (fake *FakeEndpointIterator) PreRequest(e *route.Endpoint) bool {
 	fake.preRequestMutex.Lock()
 	fake.preRequestArgsForCall = append(fake.preRequestArgsForCall, struct {
 		e *route.Endpoint
@@ -79,8 +94,9 @@ func (fake *FakeEndpointIterator) PreRequest(e *route.Endpoint) {
 	fake.recordInvocation("PreRequest", []interface{}{e})
 	fake.preRequestMutex.Unlock()
 	if fake.PreRequestStub != nil {
-		fake.PreRequestStub(e)
+		return fake.PreRequestStub(e)
 	}
+	return fake.preRequestReturns.result1
 }
 
 func (fake *FakeEndpointIterator) PreRequestCallCount() int {
@@ -95,6 +111,13 @@ func (fake *FakeEndpointIterator) PreRequestArgsForCall(i int) *route.Endpoint {
 	return fake.preRequestArgsForCall[i].e
 }
 
+func (fake *FakeEndpointIterator) PreRequestReturns(result1 bool) {
+	fake.PreRequestStub = nil
+	fake.preRequestReturns = struct {
+		result1 bool
+	}{result1}
+}
+
 func (fake *FakeEndpointIterator) PostRequest(e *route.Endpoint) {
 	fake.postRequestMutex.Lock()
 	fake.postRequestArgsForCall = append(fake.postRequestArgsForCall, struct {
@@ -119,6 +142,62 @@ func (fake *FakeEndpointIterator) PostRequestArgsForCall(i int) *route.Endpoint
 	return fake.postRequestArgsForCall[i].e
 }
 
+func (fake *FakeEndpointIterator) EndpointErrored() {
+	fake.endpointErroredMutex.Lock()
+	fake.endpointErroredArgsForCall = append(fake.endpointErroredArgsForCall, struct{}{})
+	fake.recordInvocation("EndpointErrored", []interface{}{})
+	fake.endpointErroredMutex.Unlock()
+	if fake.EndpointErroredStub != nil {
+		fake.EndpointErroredStub()
+	}
+}
+
+func (fake *FakeEndpointIterator) EndpointErroredCallCount() int {
+	fake.endpointErroredMutex.RLock()
+	defer fake.endpointErroredMutex.RUnlock()
+	return len(fake.endpointErroredArgsForCall)
+}
+
+func (fake *FakeEndpointIterator) EndpointSucceeded() {
+	fake.endpointSucceededMutex.Lock()
+	fake.endpointSucceededArgsForCall = append(fake.endpointSucceededArgsForCall, struct{}{})
+	fake.recordInvocation("EndpointSucceeded", []interface{}{})
+	fake.endpointSucceededMutex.Unlock()
+	if fake.EndpointSucceededStub != nil {
+		fake.EndpointSucceededStub()
+	}
+}
+
+func (fake *FakeEndpointIterator) EndpointSucceededCallCount() int {
+	fake.endpointSucceededMutex.RLock()
+	defer fake.endpointSucceededMutex.RUnlock()
+	return len(fake.endpointSucceededArgsForCall)
+}
+
+func (fake *FakeEndpointIterator) EndpointResponded(latency time.Duration) {
+	fake.endpointRespondedMutex.Lock()
+	fake.endpointRespondedArgsForCall = append(fake.endpointRespondedArgsForCall, struct {
+		latency time.Duration
+	}{latency})
+	fake.recordInvocation("EndpointResponded", []interface{}{latency})
+	fake.endpointRespondedMutex.Unlock()
+	if fake.EndpointRespondedStub != nil {
+		fake.EndpointRespondedStub(latency)
+	}
+}
+
+func (fake *FakeEndpointIterator) EndpointRespondedCallCount() int {
+	fake.endpointRespondedMutex.RLock()
+	defer fake.endpointRespondedMutex.RUnlock()
+	return len(fake.endpointRespondedArgsForCall)
+}
+
+func (fake *FakeEndpointIterator) EndpointRespondedArgsForCall(i int) time.Duration {
+	fake.endpointRespondedMutex.RLock()
+	defer fake.endpointRespondedMutex.RUnlock()
+	return fake.endpointRespondedArgsForCall[i].latency
+}
+
 func (fake *FakeEndpointIterator) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
@@ -130,6 +209,12 @@ func (fake *FakeEndpointIterator) Invocations() map[string][][]interface{} {
 	defer fake.preRequestMutex.RUnlock()
 	fake.postRequestMutex.RLock()
 	defer fake.postRequestMutex.RUnlock()
+	fake.endpointErroredMutex.RLock()
+	defer fake.endpointErroredMutex.RUnlock()
+	fake.endpointSucceededMutex.RLock()
+	defer fake.endpointSucceededMutex.RUnlock()
+	fake.endpointRespondedMutex.RLock()
+	defer fake.endpointRespondedMutex.RUnlock()
 	return fake.invocations
 }
 
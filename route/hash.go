@@ -0,0 +1,154 @@
+package route
+
+import (
+	"hash/fnv"
+	"math"
+	"time"
+)
+
+// Hash selects endpoints by rendezvous hashing of a request attribute, such
+// as the client IP, so that requests with the same key reach the same
+// endpoint without a cookie. Every endpoint is scored against the key and
+// the highest score wins, which only remaps the keys of endpoints that come
+// and go. Scores are scaled by weight.
+type Hash struct {
+	pool *Pool
+	key  string
+
+	initialEndpoint string
+	lastEndpoint    *Endpoint
+
+	groupFilter
+}
+
+func NewHash(p *Pool, initial, key string) EndpointIterator {
+	return &Hash{
+		pool:            p,
+		key:             key,
+		initialEndpoint: initial,
+	}
+}
+
+func (r *Hash) Next() *Endpoint {
+	var e *Endpoint
+	if r.initialEndpoint != "" {
+		e = r.pool.findById(r.initialEndpoint)
+		r.initialEndpoint = ""
+		if e != nil && !r.selects(e) {
+			e = nil
+		}
+	}
+
+	if e == nil {
+		e = r.next()
+	}
+
+	r.lastEndpoint = e
+	return e
+}
+
+func (r *Hash) next() *Endpoint {
+	r.pool.lock.Lock()
+	defer r.pool.lock.Unlock()
+
+	if len(r.pool.endpoints) == 0 {
+		return nil
+	}
+
+	selected := r.pool.pickAvailable(&r.groupFilter, r.highestScore)
+	if selected == nil {
+		// all endpoints are at their connection limit
+		return nil
+	}
+	return selected.endpoint
+}
+
+// highestScore returns the available endpoint with the highest score for
+// the key.
+// pool.lock must be held.
+func (r *Hash) highestScore() *endpointElem {
+	var selected *endpointElem
+	var selectedScore float64
+
+	curTime := time.Now()
+	for _, e := range r.pool.endpoints {
+		if !r.selects(e.endpoint) {
+			continue
+		}
+		if e.failedAt != nil {
+			if curTime.Sub(*e.failedAt) > r.pool.retryAfterFailure {
+				// exipired failure window
+				e.failedAt = nil
+			} else {
+				continue
+			}
+		}
+		if r.excludes(e, curTime) {
+			continue
+		}
+
+		score := hashScore(r.key, e.endpoint)
+		if selected == nil || score > selectedScore {
+			selected = e
+			selectedScore = score
+		}
+	}
+	return selected
+}
+
+// hashScore is the weighted rendezvous score of the endpoint for the key:
+// the hash is mapped to a uniform value u in (0, 1) and scored as
+// -weight / ln(u), so an endpoint wins keys in proportion to its weight.
+func hashScore(key string, e *Endpoint) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h.Write([]byte{0})
+	h.Write([]byte(e.CanonicalAddr()))
+
+	u := (float64(mix(h.Sum64())>>11) + 0.5) / (1 << 53)
+	return -float64(e.weight()) / math.Log(u)
+}
+
+// mix spreads the bits of FNV hashes of similar inputs, as FNV alone
+// distributes them poorly.
+func mix(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+func (r *Hash) EndpointFailed() {
+	if r.lastEndpoint != nil {
+		r.pool.endpointFailed(r.lastEndpoint)
+	}
+}
+
+func (r *Hash) EndpointErrored() {
+	if r.lastEndpoint != nil {
+		r.pool.endpointErrored(r.lastEndpoint)
+	}
+}
+
+func (r *Hash) EndpointSucceeded() {
+	if r.lastEndpoint != nil {
+		r.pool.endpointSucceeded(r.lastEndpoint)
+	}
+}
+
+func (r *Hash) EndpointResponded(latency time.Duration) {
+	if r.lastEndpoint != nil {
+		r.pool.endpointResponded(r.lastEndpoint, latency)
+	}
+}
+
+func (r *Hash) PreRequest(e *Endpoint) bool {
+	return e.acquire()
+}
+
+func (r *Hash) PostRequest(e *Endpoint) {
+	e.Stats.NumberConnections.Decrement()
+	r.pool.endpointReleased(e)
+}
@@ -0,0 +1,136 @@
+package route_test
+
+import (
+	"fmt"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/routing-api/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Hash", func() {
+	var (
+		pool       *route.Pool
+		modTag     models.ModificationTag
+		e1, e2, e3 *route.Endpoint
+	)
+
+	// pick returns the endpoint selected for each key
+	pick := func(keys []string) map[string]*route.Endpoint {
+		picks := map[string]*route.Endpoint{}
+		for _, key := range keys {
+			picks[key] = route.NewHash(pool, "", key).Next()
+		}
+		return picks
+	}
+
+	keys := make([]string, 3000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("10.0.%d.%d", i/256, i%256)
+	}
+
+	BeforeEach(func() {
+		pool = route.NewPool(2*time.Minute, "")
+		modTag = models.ModificationTag{}
+
+		e1 = route.NewEndpoint("", "1.2.3.4", 5678, "a", "", nil, -1, "", modTag, "")
+		e2 = route.NewEndpoint("", "5.6.7.8", 1234, "b", "", nil, -1, "", modTag, "")
+		e3 = route.NewEndpoint("", "1.2.7.8", 1234, "c", "", nil, -1, "", modTag, "")
+		pool.Put(e1)
+		pool.Put(e2)
+		pool.Put(e3)
+	})
+
+	Describe("Next", func() {
+		It("selects the same endpoint for the same key", func() {
+			first := route.NewHash(pool, "", "client-1").Next()
+			for i := 0; i < 10; i++ {
+				Expect(route.NewHash(pool, "", "client-1").Next()).To(Equal(first))
+			}
+		})
+
+		It("spreads keys evenly across the endpoints", func() {
+			counts := map[*route.Endpoint]int{}
+			for _, e := range pick(keys) {
+				counts[e]++
+			}
+
+			for _, e := range []*route.Endpoint{e1, e2, e3} {
+				Expect(counts[e]).To(BeNumerically("~", len(keys)/3, len(keys)/20))
+			}
+		})
+
+		It("only remaps the keys of a removed endpoint", func() {
+			before := pick(keys)
+			pool.Remove(e3)
+			after := pick(keys)
+
+			for _, key := range keys {
+				if before[key] != e3 {
+					Expect(after[key]).To(Equal(before[key]))
+				}
+			}
+		})
+
+		It("spreads keys in proportion to weight", func() {
+			e1.Weight = 2
+			counts := map[*route.Endpoint]int{}
+			for _, e := range pick(keys) {
+				counts[e]++
+			}
+
+			Expect(counts[e1]).To(BeNumerically("~", len(keys)/2, len(keys)/20))
+			Expect(counts[e2]).To(BeNumerically("~", len(keys)/4, len(keys)/20))
+		})
+
+		It("selects another endpoint after the selected one failed", func() {
+			iter := route.NewHash(pool, "", "client-1")
+			first := iter.Next()
+			iter.EndpointFailed()
+
+			second := iter.Next()
+			Expect(second).ToNot(BeNil())
+			Expect(second).ToNot(Equal(first))
+			Expect(route.NewHash(pool, "", "client-1").Next()).To(Equal(second))
+		})
+
+		It("finds the initial endpoint by private id", func() {
+			for _, id := range []string{"a", "b", "c"} {
+				e := route.NewHash(pool, id, "client-1").Next()
+				Expect(e.PrivateInstanceId).To(Equal(id))
+			}
+		})
+
+		It("returns nil when no endpoints exist", func() {
+			pool = route.NewPool(2*time.Minute, "")
+			Expect(route.NewHash(pool, "", "client-1").Next()).To(BeNil())
+		})
+
+		It("selects another endpoint while the selected one is at its connection limit", func() {
+			iter := route.NewHash(pool, "", "client-1")
+			first := iter.Next()
+			first.MaxConnections = 1
+			iter.PreRequest(first)
+
+			second := route.NewHash(pool, "", "client-1").Next()
+			Expect(second).ToNot(BeNil())
+			Expect(second).ToNot(Equal(first))
+
+			iter.PostRequest(first)
+			Expect(route.NewHash(pool, "", "client-1").Next()).To(Equal(first))
+		})
+	})
+
+	Describe("Pool.Endpoints", func() {
+		It("returns a hash iterator for the hash algorithm", func() {
+			Expect(pool.Endpoints(config.LOAD_BALANCE_HASH, "", "client-1")).To(BeAssignableToTypeOf(&route.Hash{}))
+		})
+
+		It("falls back to round-robin without a key", func() {
+			Expect(pool.Endpoints(config.LOAD_BALANCE_HASH, "", "")).To(BeAssignableToTypeOf(&route.RoundRobin{}))
+		})
+	})
+})
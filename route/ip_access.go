@@ -0,0 +1,73 @@
+package route
+
+import (
+	"net"
+	"sync"
+)
+
+// IPAccess restricts the clients that requests for a route may come from by
+// their IP address. Clients in one of the Deny CIDRs are denied, and when
+// Allow has CIDRs, clients must be in one of them.
+type IPAccess struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+
+	// the parsed CIDRs, parsed on first use
+	once      sync.Once
+	allowNets []*net.IPNet
+	denyNets  []*net.IPNet
+}
+
+// Valid reports whether the CIDRs are valid.
+func (a *IPAccess) Valid() bool {
+	_, err := parseCIDRs(a.Allow)
+	if err != nil {
+		return false
+	}
+	_, err = parseCIDRs(a.Deny)
+	return err == nil
+}
+
+// Allowed reports whether requests from the client IP are allowed. IPs that
+// cannot be parsed are not allowed.
+func (a *IPAccess) Allowed(ip net.IP) bool {
+	a.once.Do(func() {
+		a.allowNets, _ = parseCIDRs(a.Allow)
+		a.denyNets, _ = parseCIDRs(a.Deny)
+	})
+	return IPAllowed(ip, a.allowNets, a.denyNets)
+}
+
+// IPAllowed reports whether the IP is in none of the denied networks and,
+// when there are allowed networks, in one of them.
+func IPAllowed(ip net.IP, allowNets, denyNets []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range denyNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	if len(allowNets) == 0 {
+		return true
+	}
+	for _, n := range allowNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
@@ -0,0 +1,35 @@
+package route_test
+
+import (
+	"net"
+
+	"code.cloudfoundry.org/gorouter/route"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IPAccess", func() {
+	It("denies clients in a denied network", func() {
+		access := &route.IPAccess{Deny: []string{"10.0.16.0/24"}}
+		Expect(access.Allowed(net.ParseIP("10.0.16.4"))).To(BeFalse())
+		Expect(access.Allowed(net.ParseIP("10.0.17.4"))).To(BeTrue())
+	})
+
+	It("allows only clients in an allowed network when there are any", func() {
+		access := &route.IPAccess{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.0.16.0/24"}}
+		Expect(access.Allowed(net.ParseIP("10.0.17.4"))).To(BeTrue())
+		Expect(access.Allowed(net.ParseIP("10.0.16.4"))).To(BeFalse())
+		Expect(access.Allowed(net.ParseIP("192.168.0.1"))).To(BeFalse())
+	})
+
+	It("does not allow clients without an IP", func() {
+		access := &route.IPAccess{}
+		Expect(access.Allowed(nil)).To(BeFalse())
+	})
+
+	It("is not valid with a CIDR that does not parse", func() {
+		Expect((&route.IPAccess{Allow: []string{"10.0.0.0/8"}}).Valid()).To(BeTrue())
+		Expect((&route.IPAccess{Allow: []string{"10.0.0.1"}}).Valid()).To(BeFalse())
+		Expect((&route.IPAccess{Deny: []string{"10.0.0.0/33"}}).Valid()).To(BeFalse())
+	})
+})
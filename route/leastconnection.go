@@ -11,6 +11,8 @@ type LeastConnection struct {
 	pool            *Pool
 	initialEndpoint string
 	lastEndpoint    *Endpoint
+
+	groupFilter
 }
 
 func NewLeastConnection(p *Pool, initial string) EndpointIterator {
@@ -25,6 +27,9 @@ func (r *LeastConnection) Next() *Endpoint {
 	if r.initialEndpoint != "" {
 		e = r.pool.findById(r.initialEndpoint)
 		r.initialEndpoint = ""
+		if e != nil && !r.selects(e) {
+			e = nil
+		}
 	}
 
 	if e == nil {
@@ -35,55 +40,102 @@ func (r *LeastConnection) Next() *Endpoint {
 	return e
 }
 
-func (r *LeastConnection) PreRequest(e *Endpoint) {
-	e.Stats.NumberConnections.Increment()
+func (r *LeastConnection) PreRequest(e *Endpoint) bool {
+	return e.acquire()
 }
 
 func (r *LeastConnection) PostRequest(e *Endpoint) {
 	e.Stats.NumberConnections.Decrement()
+	r.pool.endpointReleased(e)
 }
 
 func (r *LeastConnection) next() *Endpoint {
 	r.pool.lock.Lock()
 	defer r.pool.lock.Unlock()
 
-	var selected *Endpoint
-
 	// none
 	total := len(r.pool.endpoints)
 	if total == 0 {
 		return nil
 	}
 
-	// single endpoint
-	if total == 1 {
-		return r.pool.endpoints[0].endpoint
-	}
-
-	// more than 1 endpoint
 	// select the least connection endpoint OR
 	// random one within the least connection endpoints
 	randIndices := randomize.Perm(total)
 
-	for i := 0; i < total; i++ {
-		randIdx := randIndices[i]
-		cur := r.pool.endpoints[randIdx].endpoint
+	selected := r.pool.pickAvailable(&r.groupFilter, func() *endpointElem {
+		return r.leastConnected(randIndices)
+	})
+	if selected == nil {
+		// all endpoints are at their connection limit
+		return nil
+	}
 
-		// our first is the least
-		if i == 0 {
-			selected = cur
+	return selected.endpoint
+}
+
+// leastConnected returns the endpoint with the fewest in-flight requests
+// relative to its weight that is not within its failure window, ejected or
+// unhealthy.
+// pool.lock must be held.
+func (r *LeastConnection) leastConnected(indices []int) *endpointElem {
+	var selected *endpointElem
+
+	curTime := time.Now()
+	for _, idx := range indices {
+		cur := r.pool.endpoints[idx]
+		if !r.selects(cur.endpoint) {
 			continue
 		}
 
-		if cur.Stats.NumberConnections.Count() < selected.Stats.NumberConnections.Count() {
+		if cur.failedAt != nil {
+			if curTime.Sub(*cur.failedAt) > r.pool.retryAfterFailure {
+				// exipired failure window
+				cur.failedAt = nil
+			} else {
+				continue
+			}
+		}
+		if r.excludes(cur, curTime) {
+			continue
+		}
+
+		if selected == nil || fewerConnections(cur.endpoint, selected.endpoint) {
 			selected = cur
 		}
 	}
+
 	return selected
 }
 
+// fewerConnections compares connections per unit of weight without dividing,
+// so a weight 2 endpoint is considered as loaded as a weight 1 endpoint with
+// half as many connections.
+func fewerConnections(a, b *Endpoint) bool {
+	return a.Stats.NumberConnections.Count()*int64(b.weight()) <
+		b.Stats.NumberConnections.Count()*int64(a.weight())
+}
+
 func (r *LeastConnection) EndpointFailed() {
 	if r.lastEndpoint != nil {
 		r.pool.endpointFailed(r.lastEndpoint)
 	}
 }
+
+func (r *LeastConnection) EndpointErrored() {
+	if r.lastEndpoint != nil {
+		r.pool.endpointErrored(r.lastEndpoint)
+	}
+}
+
+func (r *LeastConnection) EndpointSucceeded() {
+	if r.lastEndpoint != nil {
+		r.pool.endpointSucceeded(r.lastEndpoint)
+	}
+}
+
+func (r *LeastConnection) EndpointResponded(latency time.Duration) {
+	if r.lastEndpoint != nil {
+		r.pool.endpointResponded(r.lastEndpoint, latency)
+	}
+}
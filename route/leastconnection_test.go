@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 
+	"code.cloudfoundry.org/gorouter/config"
 	"code.cloudfoundry.org/gorouter/route"
 	"code.cloudfoundry.org/routing-api/models"
 	. "github.com/onsi/ginkgo"
@@ -122,6 +123,213 @@ var _ = Describe("LeastConnection", func() {
 					Expect(okRandoms).Should(ContainElement(iter.Next().CanonicalAddr()))
 				})
 			})
+
+			Context("when endpoints have weights", func() {
+				It("selects the endpoint with the fewest connections relative to its weight", func() {
+					endpoints[0].Weight = 4
+					setConnectionCount(endpoints, []int{3, 1, 1, 1, 1})
+					iter := route.NewLeastConnection(pool, "")
+					Expect(iter.Next()).To(Equal(endpoints[0]))
+
+					setConnectionCount(endpoints, []int{5, 1, 1, 1, 1})
+					okRandoms := []string{
+						"10.0.1.1:60000",
+						"10.0.1.2:60000",
+						"10.0.1.3:60000",
+						"10.0.1.4:60000",
+					}
+					Expect(okRandoms).Should(ContainElement(iter.Next().CanonicalAddr()))
+				})
+			})
+
+			Context("when endpoints have failed", func() {
+				It("skips failed endpoints", func() {
+					setConnectionCount(endpoints, []int{0, 1, 1, 1, 1})
+					iter := route.NewLeastConnection(pool, "")
+					Expect(iter.Next()).To(Equal(endpoints[0]))
+
+					iter.EndpointFailed()
+
+					okRandoms := []string{
+						"10.0.1.1:60000",
+						"10.0.1.2:60000",
+						"10.0.1.3:60000",
+						"10.0.1.4:60000",
+					}
+					Expect(okRandoms).Should(ContainElement(iter.Next().CanonicalAddr()))
+				})
+
+				It("resets when all endpoints are failed", func() {
+					iter := route.NewLeastConnection(pool, "")
+					for i := 0; i < total; i++ {
+						Expect(iter.Next()).NotTo(BeNil())
+						iter.EndpointFailed()
+					}
+
+					setConnectionCount(endpoints, []int{1, 1, 0, 1, 1})
+					Expect(iter.Next()).To(Equal(endpoints[2]))
+				})
+
+				It("resets failed endpoints after exceeding failure duration", func() {
+					pool = route.NewPool(50*time.Millisecond, "")
+					for _, e := range endpoints {
+						pool.Put(e)
+					}
+
+					setConnectionCount(endpoints, []int{0, 1, 1, 1, 1})
+					iter := route.NewLeastConnection(pool, "")
+					Expect(iter.Next()).To(Equal(endpoints[0]))
+					iter.EndpointFailed()
+					Expect(iter.Next()).NotTo(Equal(endpoints[0]))
+
+					time.Sleep(50 * time.Millisecond)
+
+					Expect(iter.Next()).To(Equal(endpoints[0]))
+				})
+			})
+
+			Context("when an endpoint has been ejected", func() {
+				It("skips the endpoint until its ejection time has passed", func() {
+					pool.SetCircuitBreaker(config.CircuitBreakerConfig{
+						ConsecutiveFailures: 1,
+						BaseEjectionTime:    50 * time.Millisecond,
+						MaxEjectionTime:     time.Second,
+					})
+
+					setConnectionCount(endpoints, []int{0, 1, 1, 1, 1})
+					iter := route.NewLeastConnection(pool, "")
+					Expect(iter.Next()).To(Equal(endpoints[0]))
+					iter.EndpointErrored()
+					Expect(iter.Next()).NotTo(Equal(endpoints[0]))
+
+					time.Sleep(50 * time.Millisecond)
+
+					Expect(iter.Next()).To(Equal(endpoints[0]))
+				})
+			})
+		})
+	})
+
+	Describe("Backup", func() {
+		var primary, backup *route.Endpoint
+
+		BeforeEach(func() {
+			primary = route.NewEndpoint("", "10.0.1.1", 60000, "", "", nil, -1, "", models.ModificationTag{}, "")
+			backup = route.NewEndpoint("", "10.0.1.2", 60000, "", "", nil, -1, "", models.ModificationTag{}, "")
+			backup.Backup = true
+			pool.Put(primary)
+			pool.Put(backup)
+		})
+
+		It("selects the primary endpoint even when it has more connections", func() {
+			primary.Stats.NumberConnections.Increment()
+			iter := route.NewLeastConnection(pool, "")
+			Expect(iter.Next()).To(Equal(primary))
+		})
+
+		It("selects the backup endpoint when the primary endpoint is unavailable", func() {
+			pool.SetEndpointHealthy(primary, false)
+			iter := route.NewLeastConnection(pool, "")
+			Expect(iter.Next()).To(Equal(backup))
+		})
+	})
+
+	Describe("LocalZone", func() {
+		var local, remote *route.Endpoint
+
+		BeforeEach(func() {
+			local = route.NewEndpoint("", "10.0.1.1", 60000, "", "", nil, -1, "", models.ModificationTag{}, "")
+			local.Zone = "z1"
+			remote = route.NewEndpoint("", "10.0.1.2", 60000, "", "", nil, -1, "", models.ModificationTag{}, "")
+			remote.Zone = "z2"
+			pool.Put(local)
+			pool.Put(remote)
+			pool.SetLocalZone("z1")
+		})
+
+		It("selects the endpoint in the local zone even when it has more connections", func() {
+			local.Stats.NumberConnections.Increment()
+			iter := route.NewLeastConnection(pool, "")
+			Expect(iter.Next()).To(Equal(local))
+		})
+
+		It("selects the endpoint in another zone when the local one is unavailable", func() {
+			pool.SetEndpointHealthy(local, false)
+			iter := route.NewLeastConnection(pool, "")
+			Expect(iter.Next()).To(Equal(remote))
+		})
+	})
+
+	Describe("MaxConnections", func() {
+		It("skips endpoints at their connection limit", func() {
+			e1 := route.NewEndpoint("", "10.0.1.1", 60000, "", "", nil, -1, "", models.ModificationTag{}, "")
+			e1.MaxConnections = 1
+			e2 := route.NewEndpoint("", "10.0.1.2", 60000, "", "", nil, -1, "", models.ModificationTag{}, "")
+			pool.Put(e1)
+			pool.Put(e2)
+			setConnectionCount([]*route.Endpoint{e1, e2}, []int{1, 5})
+
+			iter := route.NewLeastConnection(pool, "")
+			Expect(iter.Next()).To(Equal(e2))
+		})
+
+		It("returns nil when all endpoints are at their connection limit", func() {
+			e1 := route.NewEndpoint("", "10.0.1.1", 60000, "", "", nil, -1, "", models.ModificationTag{}, "")
+			e1.MaxConnections = 1
+			e2 := route.NewEndpoint("", "10.0.1.2", 60000, "", "", nil, -1, "", models.ModificationTag{}, "")
+			e2.MaxConnections = 2
+			pool.Put(e1)
+			pool.Put(e2)
+			setConnectionCount([]*route.Endpoint{e1, e2}, []int{1, 2})
+
+			iter := route.NewLeastConnection(pool, "")
+			Expect(iter.Next()).To(BeNil())
+		})
+
+		It("returns nil when the only endpoint is at its connection limit", func() {
+			e := route.NewEndpoint("", "10.0.1.1", 60000, "", "", nil, -1, "", models.ModificationTag{}, "")
+			e.MaxConnections = 1
+			pool.Put(e)
+
+			iter := route.NewLeastConnection(pool, "")
+			iter.PreRequest(e)
+			Expect(iter.Next()).To(BeNil())
+		})
+	})
+
+	Describe("SetEndpointDraining", func() {
+		It("does not select the only endpoint while it is draining", func() {
+			e := route.NewEndpoint("", "10.0.1.1", 60000, "", "", nil, -1, "", models.ModificationTag{}, "")
+			pool.Put(e)
+			Expect(pool.SetEndpointDraining("10.0.1.1:60000", true)).To(BeTrue())
+
+			Expect(route.NewLeastConnection(pool, "").Next()).To(BeNil())
+
+			Expect(pool.SetEndpointDraining("10.0.1.1:60000", false)).To(BeTrue())
+			Expect(route.NewLeastConnection(pool, "").Next()).To(Equal(e))
+		})
+	})
+
+	Describe("PreRequest", func() {
+		It("increments the connection count of the endpoint", func() {
+			e := route.NewEndpoint("", "10.0.1.1", 60000, "", "", nil, -1, "", models.ModificationTag{}, "")
+			pool.Put(e)
+
+			iter := route.NewLeastConnection(pool, "")
+			iter.PreRequest(e)
+			Expect(e.Stats.NumberConnections.Count()).To(Equal(int64(1)))
+		})
+	})
+
+	Describe("PostRequest", func() {
+		It("decrements the connection count of the endpoint", func() {
+			e := route.NewEndpoint("", "10.0.1.1", 60000, "", "", nil, -1, "", models.ModificationTag{}, "")
+			pool.Put(e)
+
+			iter := route.NewLeastConnection(pool, "")
+			iter.PreRequest(e)
+			iter.PostRequest(e)
+			Expect(e.Stats.NumberConnections.Count()).To(Equal(int64(0)))
 		})
 	})
 })
@@ -0,0 +1,21 @@
+package route
+
+// Maintenance is the static response served for a route that is in
+// maintenance, instead of proxying its requests.
+type Maintenance struct {
+	// Status is the status code of the response, 503 when it is 0.
+	Status int `json:"status,omitempty"`
+	// ContentType is the content type of the body, text/plain when it is
+	// empty.
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body,omitempty"`
+	// RetryAfterSeconds sets the Retry-After header when it is greater than
+	// zero.
+	RetryAfterSeconds int `json:"retry_after_seconds,omitempty"`
+}
+
+// Valid reports whether the status is a valid status code, if set, and the
+// retry after is not negative.
+func (m *Maintenance) Valid() bool {
+	return (m.Status == 0 || (m.Status >= 200 && m.Status <= 599)) && m.RetryAfterSeconds >= 0
+}
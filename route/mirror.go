@@ -0,0 +1,16 @@
+package route
+
+// Mirror designates the route that a percentage of the requests for a route
+// are copied to.
+type Mirror struct {
+	Uri Uri `json:"uri"`
+	// Percentage is the share of the requests that are mirrored. All of them
+	// are when it is nil, and none when it is 0.
+	Percentage *float64 `json:"percentage,omitempty"`
+}
+
+// Valid reports whether the mirror names a route and, if it has one, has a
+// percentage between 0 and 100.
+func (m *Mirror) Valid() bool {
+	return m.Uri != "" && (m.Percentage == nil || (*m.Percentage >= 0 && *m.Percentage <= 100))
+}
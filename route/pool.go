@@ -2,7 +2,9 @@ package route
 
 import (
 	"encoding/json"
-	"fmt"
+	"net"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -13,6 +15,24 @@ import (
 	"code.cloudfoundry.org/routing-api/models"
 )
 
+const DefaultEndpointWeight = 1
+
+// latencyWeight is the weight of each response in the moving average of the
+// latency of an endpoint.
+const latencyWeight = 0.2
+
+const (
+	ProtocolHTTP1 = "http1"
+	ProtocolHTTP2 = "http2"
+)
+
+// The request_buffering modes of routes, which override the router's
+// request_buffering.enabled.
+const (
+	RequestBufferingBuffer = "buffer"
+	RequestBufferingStream = "stream"
+)
+
 type Counter struct {
 	value int64
 }
@@ -31,6 +51,20 @@ func (c *Counter) Count() int64 {
 	return atomic.LoadInt64(&c.value)
 }
 
+// IncrementBelow increments the counter unless it is at max already, and
+// returns whether it did.
+func (c *Counter) IncrementBelow(max int64) bool {
+	for {
+		value := atomic.LoadInt64(&c.value)
+		if value >= max {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&c.value, value, value+1) {
+			return true
+		}
+	}
+}
+
 type Stats struct {
 	NumberConnections *Counter
 }
@@ -52,13 +86,104 @@ type Endpoint struct {
 	ModificationTag      models.ModificationTag
 	Stats                *Stats
 	IsolationSegment     string
+	Weight               int
+	Protocol             string
+	UseTLS               bool
+	ServerCertDomainSAN  string
+	// RouteServiceChain are the route services that requests for the route
+	// of the endpoint pass through in order, when there are more than one.
+	// RouteServiceUrl is the first of them.
+	RouteServiceChain []string
+	// Timeout overrides the router's endpoint_timeout for requests to the
+	// endpoint when it is greater than zero.
+	Timeout time.Duration
+	// DialTimeout, ResponseHeaderTimeout and IdleTimeout override the
+	// router's endpoint_dial_timeout, endpoint_response_header_timeout and
+	// endpoint_idle_timeout for requests to the endpoint when they are
+	// greater than zero.
+	DialTimeout           time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleTimeout           time.Duration
+	// MaxConnections limits the requests in flight to the endpoint when it
+	// is greater than zero.
+	MaxConnections int
+	// MaxQueueDepth overrides the router's request_queue.max_queue_depth
+	// for the route of the endpoint when it is greater than zero.
+	MaxQueueDepth int
+	// MaxRequestBodySize overrides the router's max_request_body_size_bytes
+	// for requests for the route of the endpoint when it is greater than
+	// zero.
+	MaxRequestBodySize int64
+	// CacheResponses opts the route of the endpoint in to the response
+	// cache.
+	CacheResponses bool
+	// RequestBuffering is RequestBufferingBuffer to buffer the bodies of
+	// requests for the route of the endpoint before they are proxied, or
+	// RequestBufferingStream to stream them, regardless of the router's
+	// request_buffering. The router's setting applies when it is empty.
+	RequestBuffering string
+	// StripPathPrefix removes the context path of the route of the endpoint
+	// from the path of requests before they are proxied to the endpoint.
+	StripPathPrefix bool
+	// Group is the traffic group of the endpoint, selected by the traffic
+	// rules of its route.
+	Group string
+	// Backup endpoints only receive requests for their route when none of
+	// the primary endpoints is available.
+	Backup bool
+	// Zone is the availability zone of the endpoint. Routers that prefer
+	// endpoints in their own zone spill requests to endpoints in other
+	// zones only when none in theirs is available.
+	Zone string
+	// TrafficRules route requests for the route of the endpoint to groups
+	// of its endpoints.
+	TrafficRules []TrafficRule
+	// Mirror is the route that requests for the route of the endpoint are
+	// copied to, if any.
+	Mirror *Mirror
+	// HeaderRewrites are the header rules of the route of the endpoint,
+	// applied after the rules configured for all routes.
+	HeaderRewrites *config.HeaderRewriteConfig
+	// Maintenance puts the route of the endpoint in maintenance, if set.
+	Maintenance *Maintenance
+	// Auth requires requests for the route of the endpoint to be
+	// authenticated, if set.
+	Auth *Auth
+	// IPAccess restricts the clients that requests for the route of the
+	// endpoint may come from, if set.
+	IPAccess *IPAccess
+	// WasmFilters are the names of the WebAssembly filters that requests
+	// for the route of the endpoint pass through after the global ones.
+	WasmFilters []string
+	// ForceHTTPS redirects plain HTTP requests for the route of the endpoint
+	// to HTTPS.
+	ForceHTTPS bool
+	// TTL, when greater than zero, is the endpoint's stale threshold, even
+	// when it is longer than the router's.
+	TTL time.Duration
+	// Source is where the endpoint was registered from, such as nats or
+	// routing-api, as recorded in the route audit.
+	Source string
 }
 
 //go:generate counterfeiter -o fakes/fake_endpoint_iterator.go . EndpointIterator
 type EndpointIterator interface {
 	Next() *Endpoint
+	// EndpointFailed reports that the last endpoint could not be connected
+	// to. The endpoint is skipped until its failure window has expired.
 	EndpointFailed()
-	PreRequest(e *Endpoint)
+	// EndpointErrored reports that the last endpoint responded with a server
+	// error.
+	EndpointErrored()
+	// EndpointSucceeded reports that the last endpoint handled a request.
+	EndpointSucceeded()
+	// EndpointResponded reports the time the last endpoint took to respond
+	// with the headers of its response.
+	EndpointResponded(latency time.Duration)
+	// PreRequest takes a connection slot of the endpoint for a request, and
+	// returns false without taking one when the endpoint is at its
+	// connection limit. Slots are given back with PostRequest.
+	PreRequest(e *Endpoint) bool
 	PostRequest(e *Endpoint)
 }
 
@@ -67,6 +192,27 @@ type endpointElem struct {
 	index    int
 	updated  time.Time
 	failedAt *time.Time
+
+	// used by the circuit breaker
+	consecutiveFailures int
+	ejections           int
+	ejectedUntil        time.Time
+
+	// used by latency outlier detection: the moving average of the latency
+	// of the endpoint, the responses it has seen, and until when it is
+	// deprioritized
+	latency   float64
+	responses int
+	slowUntil time.Time
+
+	// set by active health checks
+	unhealthy bool
+
+	// set through the admin API
+	draining bool
+
+	// used by weighted round-robin selection
+	currentWeight int
 }
 
 type Pool struct {
@@ -79,6 +225,34 @@ type Pool struct {
 
 	retryAfterFailure time.Duration
 	nextIdx           int
+
+	circuitBreaker  config.CircuitBreakerConfig
+	latencyOutliers config.LatencyOutlierConfig
+	localZone       string
+
+	// set through the admin API
+	maintenance *Maintenance
+
+	// carried over from the route of the instance of a per-instance pool
+	auth     *Auth
+	ipAccess *IPAccess
+
+	// requests waiting for an endpoint while all of them are at their
+	// connection limit, in order
+	queue []chan struct{}
+}
+
+// UnixSocketPrefix starts the address of endpoints reached over a unix socket,
+// whose path follows it. They are created with the address as their host.
+const UnixSocketPrefix = "unix:"
+
+// endpointAddr returns the address of the endpoint, bracketing IPv6 hosts,
+// which may be registered with or without brackets.
+func endpointAddr(host string, port uint16) string {
+	if strings.HasPrefix(host, UnixSocketPrefix) {
+		return host
+	}
+	return net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"), strconv.Itoa(int(port)))
 }
 
 func NewEndpoint(
@@ -95,7 +269,7 @@ func NewEndpoint(
 ) *Endpoint {
 	return &Endpoint{
 		ApplicationId:        appId,
-		addr:                 fmt.Sprintf("%s:%d", host, port),
+		addr:                 endpointAddr(host, port),
 		Tags:                 tags,
 		PrivateInstanceId:    privateInstanceId,
 		PrivateInstanceIndex: privateInstanceIndex,
@@ -117,6 +291,30 @@ func NewPool(retryAfterFailure time.Duration, contextPath string) *Pool {
 	}
 }
 
+// SetCircuitBreaker configures when endpoints of the pool are ejected after
+// consecutive failures.
+func (p *Pool) SetCircuitBreaker(circuitBreaker config.CircuitBreakerConfig) {
+	p.lock.Lock()
+	p.circuitBreaker = circuitBreaker
+	p.lock.Unlock()
+}
+
+// SetLatencyOutliers configures when endpoints of the pool are deprioritized
+// for their latency.
+func (p *Pool) SetLatencyOutliers(latencyOutliers config.LatencyOutlierConfig) {
+	p.lock.Lock()
+	p.latencyOutliers = latencyOutliers
+	p.lock.Unlock()
+}
+
+// SetLocalZone makes the pool prefer endpoints in the zone, when it is not
+// empty, over endpoints in other zones.
+func (p *Pool) SetLocalZone(zone string) {
+	p.lock.Lock()
+	p.localZone = zone
+	p.lock.Unlock()
+}
+
 func (p *Pool) ContextPath() string {
 	return p.contextPath
 }
@@ -126,6 +324,10 @@ func (p *Pool) Put(endpoint *Endpoint) bool {
 	p.lock.Lock()
 	defer p.lock.Unlock()
 
+	if endpoint.Stats == nil {
+		endpoint.Stats = NewStats()
+	}
+
 	e, found := p.index[endpoint.CanonicalAddr()]
 	if found {
 		if e.endpoint != endpoint {
@@ -134,6 +336,10 @@ func (p *Pool) Put(endpoint *Endpoint) bool {
 			}
 
 			oldEndpoint := e.endpoint
+			if endpoint.Stats != oldEndpoint.Stats {
+				// keep counting the requests in flight across re-registrations
+				endpoint.Stats = oldEndpoint.Stats
+			}
 			e.endpoint = endpoint
 
 			if oldEndpoint.PrivateInstanceId != endpoint.PrivateInstanceId {
@@ -158,6 +364,15 @@ func (p *Pool) Put(endpoint *Endpoint) bool {
 	return true
 }
 
+// Contains reports whether the endpoint with the address is in the pool.
+func (p *Pool) Contains(address string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	_, found := p.index[address]
+	return found
+}
+
 func (p *Pool) RouteServiceUrl() string {
 	p.lock.Lock()
 	defer p.lock.Unlock()
@@ -170,6 +385,228 @@ func (p *Pool) RouteServiceUrl() string {
 	}
 }
 
+// RouteServiceChain returns the route services that requests for the route
+// pass through in order, if any.
+func (p *Pool) RouteServiceChain() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.endpoints) == 0 {
+		return nil
+	}
+	endpt := p.endpoints[0].endpoint
+	if len(endpt.RouteServiceChain) > 0 {
+		return endpt.RouteServiceChain
+	}
+	if endpt.RouteServiceUrl != "" {
+		return []string{endpt.RouteServiceUrl}
+	}
+	return nil
+}
+
+// ApplicationId returns the application the endpoints of the route are
+// registered for.
+func (p *Pool) ApplicationId() string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.endpoints) > 0 {
+		return p.endpoints[0].endpoint.ApplicationId
+	}
+	return ""
+}
+
+// CacheResponses returns whether responses for the route may be cached.
+func (p *Pool) CacheResponses() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.endpoints) > 0 {
+		return p.endpoints[0].endpoint.CacheResponses
+	}
+	return false
+}
+
+// RequestBuffering returns the request buffering mode of the registration of
+// the endpoints of the route, or "" when it has none.
+func (p *Pool) RequestBuffering() string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.endpoints) > 0 {
+		return p.endpoints[0].endpoint.RequestBuffering
+	}
+	return ""
+}
+
+// StripPathPrefix returns whether the context path of the route is removed
+// from requests before they are proxied.
+func (p *Pool) StripPathPrefix() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.endpoints) > 0 {
+		return p.endpoints[0].endpoint.StripPathPrefix
+	}
+	return false
+}
+
+// TrafficRules returns the traffic rules of the route, if any.
+func (p *Pool) TrafficRules() []TrafficRule {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.endpoints) > 0 {
+		return p.endpoints[0].endpoint.TrafficRules
+	}
+	return nil
+}
+
+// Mirror returns the mirror of the route, if any.
+func (p *Pool) Mirror() *Mirror {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.endpoints) > 0 {
+		return p.endpoints[0].endpoint.Mirror
+	}
+	return nil
+}
+
+// HeaderRewrites returns the header rules of the route, if any.
+func (p *Pool) HeaderRewrites() *config.HeaderRewriteConfig {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.endpoints) > 0 {
+		return p.endpoints[0].endpoint.HeaderRewrites
+	}
+	return nil
+}
+
+// Maintenance returns the maintenance response of the route if the route is
+// in maintenance, either through SetMaintenance or the registration of its
+// endpoints.
+func (p *Pool) Maintenance() *Maintenance {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.maintenance != nil {
+		return p.maintenance
+	}
+	if len(p.endpoints) > 0 {
+		return p.endpoints[0].endpoint.Maintenance
+	}
+	return nil
+}
+
+// Auth returns the authentication required by the route: the one set with
+// SetAuth, or else that of the first endpoint registered with one. The route
+// requires authentication as long as any of its endpoints does.
+func (p *Pool) Auth() *Auth {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.auth != nil {
+		return p.auth
+	}
+	for _, e := range p.endpoints {
+		if e.endpoint.Auth != nil {
+			return e.endpoint.Auth
+		}
+	}
+	return nil
+}
+
+// SetAuth requires the authentication a for the route, whatever the
+// registration of its endpoints.
+func (p *Pool) SetAuth(a *Auth) {
+	p.lock.Lock()
+	p.auth = a
+	p.lock.Unlock()
+}
+
+// MaxRequestBodySize returns the maximum request body size of the
+// registration of the endpoints of the route, or 0 when it has none.
+func (p *Pool) MaxRequestBodySize() int64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.endpoints) > 0 {
+		return p.endpoints[0].endpoint.MaxRequestBodySize
+	}
+	return 0
+}
+
+// MaxQueueDepth returns the maximum queue depth of the registration of the
+// endpoints of the route, or 0 when it has none.
+func (p *Pool) MaxQueueDepth() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.endpoints) > 0 {
+		return p.endpoints[0].endpoint.MaxQueueDepth
+	}
+	return 0
+}
+
+// IPAccess returns the client IP restrictions of the route: those set with
+// SetIPAccess, or else those of the first endpoint registered with some. The
+// route is restricted as long as any of its endpoints is.
+func (p *Pool) IPAccess() *IPAccess {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.ipAccess != nil {
+		return p.ipAccess
+	}
+	for _, e := range p.endpoints {
+		if e.endpoint.IPAccess != nil {
+			return e.endpoint.IPAccess
+		}
+	}
+	return nil
+}
+
+// SetIPAccess restricts the route to the client IPs of a, whatever the
+// registration of its endpoints.
+func (p *Pool) SetIPAccess(a *IPAccess) {
+	p.lock.Lock()
+	p.ipAccess = a
+	p.lock.Unlock()
+}
+
+// WasmFilters returns the names of the WebAssembly filters of the route.
+func (p *Pool) WasmFilters() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.endpoints) > 0 {
+		return p.endpoints[0].endpoint.WasmFilters
+	}
+	return nil
+}
+
+// ForceHTTPS returns whether plain HTTP requests for the route are
+// redirected to HTTPS.
+func (p *Pool) ForceHTTPS() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.endpoints) > 0 {
+		return p.endpoints[0].endpoint.ForceHTTPS
+	}
+	return false
+}
+
+// SetMaintenance puts the route in maintenance with the response m, or takes
+// it out of the maintenance set before when m is nil.
+func (p *Pool) SetMaintenance(m *Maintenance) {
+	p.lock.Lock()
+	p.maintenance = m
+	p.lock.Unlock()
+}
+
 func (p *Pool) PruneEndpoints(defaultThreshold time.Duration) []*Endpoint {
 	p.lock.Lock()
 
@@ -181,11 +618,7 @@ func (p *Pool) PruneEndpoints(defaultThreshold time.Duration) []*Endpoint {
 	for i := 0; i < last; {
 		e := p.endpoints[i]
 
-		staleTime := now.Add(-defaultThreshold)
-		if e.endpoint.staleThreshold > 0 && e.endpoint.staleThreshold < defaultThreshold {
-			staleTime = now.Add(-e.endpoint.staleThreshold)
-		}
-
+		staleTime := now.Add(-e.endpoint.StaleThreshold(defaultThreshold))
 		if e.updated.Before(staleTime) {
 			p.removeEndpoint(e)
 			prunedEndpoints = append(prunedEndpoints, e.endpoint)
@@ -232,20 +665,51 @@ func (p *Pool) removeEndpoint(e *endpointElem) {
 	delete(p.index, e.endpoint.PrivateInstanceId)
 }
 
-func (p *Pool) Endpoints(defaultLoadBalance, initial string) EndpointIterator {
+// weighted returns true if any endpoint in the pool has a non-default weight.
+// pool.lock must be held.
+func (p *Pool) weighted() bool {
+	for _, e := range p.endpoints {
+		if e.endpoint.weight() != DefaultEndpointWeight {
+			return true
+		}
+	}
+	return false
+}
+
+// Endpoints returns an iterator over the endpoints of the pool for the load
+// balancing algorithm. The hash algorithm hashes hashKey, and falls back to
+// round-robin when it is empty.
+func (p *Pool) Endpoints(defaultLoadBalance, initial, hashKey string) EndpointIterator {
+	return p.endpointIterator(groupFilter{}, defaultLoadBalance, initial, hashKey)
+}
+
+// GroupEndpoints returns an iterator like Endpoints over the endpoints of the
+// pool in the traffic group.
+func (p *Pool) GroupEndpoints(group, defaultLoadBalance, initial, hashKey string) EndpointIterator {
+	return p.endpointIterator(groupFilter{grouped: true, group: group}, defaultLoadBalance, initial, hashKey)
+}
+
+func (p *Pool) endpointIterator(filter groupFilter, defaultLoadBalance, initial, hashKey string) EndpointIterator {
 	switch defaultLoadBalance {
 	case config.LOAD_BALANCE_LC:
-		return NewLeastConnection(p, initial)
+		return &LeastConnection{pool: p, initialEndpoint: initial, groupFilter: filter}
+	case config.LOAD_BALANCE_HASH:
+		if hashKey != "" {
+			return &Hash{pool: p, key: hashKey, initialEndpoint: initial, groupFilter: filter}
+		}
+		return &RoundRobin{pool: p, initialEndpoint: initial, groupFilter: filter}
 	default:
-		return NewRoundRobin(p, initial)
+		return &RoundRobin{pool: p, initialEndpoint: initial, groupFilter: filter}
 	}
 }
 
+// findById returns the endpoint with the id, unless it is at its connection
+// limit.
 func (p *Pool) findById(id string) *Endpoint {
 	var endpoint *Endpoint
 	p.lock.Lock()
 	e := p.index[id]
-	if e != nil {
+	if e != nil && !e.endpoint.saturated() {
 		endpoint = e.endpoint
 	}
 	p.lock.Unlock()
@@ -261,6 +725,105 @@ func (p *Pool) IsEmpty() bool {
 	return l == 0
 }
 
+// Saturated reports whether every endpoint of the pool is at its connection
+// limit.
+func (p *Pool) Saturated() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.saturated()
+}
+
+// saturated reports whether every endpoint of the pool is at its connection
+// limit. pool.lock must be held.
+func (p *Pool) saturated() bool {
+	for _, e := range p.endpoints {
+		if !e.endpoint.saturated() {
+			return false
+		}
+	}
+	return len(p.endpoints) > 0
+}
+
+// Enqueue queues a request for an endpoint of the pool, unless maxDepth
+// requests are queued already. The returned channel is closed once an
+// endpoint of the pool completes a request, or right away when not every
+// endpoint is at its connection limit. A request that stops waiting before
+// the channel is closed must be removed with Dequeue.
+func (p *Pool) Enqueue(maxDepth int) (chan struct{}, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	wait := make(chan struct{})
+	if !p.saturated() {
+		close(wait)
+		return wait, true
+	}
+	if len(p.queue) >= maxDepth {
+		return nil, false
+	}
+	p.queue = append(p.queue, wait)
+	return wait, true
+}
+
+// Dequeue removes a request that stopped waiting from the queue. When the
+// request has already been released, the next request in the queue is
+// released in its place.
+func (p *Pool) Dequeue(wait chan struct{}) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for i, w := range p.queue {
+		if w == wait {
+			p.queue = append(p.queue[:i], p.queue[i+1:]...)
+			return
+		}
+	}
+	p.release()
+}
+
+// QueueDepth returns the number of requests waiting for an endpoint of the
+// pool.
+func (p *Pool) QueueDepth() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return len(p.queue)
+}
+
+// endpointReleased releases the first queued request once an endpoint with a
+// connection limit completes a request.
+func (p *Pool) endpointReleased(endpoint *Endpoint) {
+	if endpoint.MaxConnections <= 0 {
+		return
+	}
+	p.lock.Lock()
+	p.release()
+	p.lock.Unlock()
+}
+
+// release releases the first queued request, if any. pool.lock must be held.
+func (p *Pool) release() {
+	if len(p.queue) == 0 {
+		return
+	}
+	close(p.queue[0])
+	p.queue = p.queue[1:]
+}
+
+// StaleAt returns the time the endpoint at the address becomes stale, and
+// false if there is no such endpoint in the pool.
+func (p *Pool) StaleAt(address string, defaultThreshold time.Duration) (time.Time, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	e, ok := p.index[address]
+	if !ok {
+		return time.Time{}, false
+	}
+	return e.updated.Add(e.endpoint.StaleThreshold(defaultThreshold)), true
+}
+
 func (p *Pool) MarkUpdated(t time.Time) {
 	p.lock.Lock()
 	for _, e := range p.endpoints {
@@ -274,10 +837,188 @@ func (p *Pool) endpointFailed(endpoint *Endpoint) {
 	e := p.index[endpoint.CanonicalAddr()]
 	if e != nil {
 		e.failed()
+		p.recordFailure(e)
 	}
 	p.lock.Unlock()
 }
 
+func (p *Pool) endpointErrored(endpoint *Endpoint) {
+	p.lock.Lock()
+	e := p.index[endpoint.CanonicalAddr()]
+	if e != nil {
+		p.recordFailure(e)
+	}
+	p.lock.Unlock()
+}
+
+func (p *Pool) endpointSucceeded(endpoint *Endpoint) {
+	p.lock.Lock()
+	e := p.index[endpoint.CanonicalAddr()]
+	if e != nil {
+		e.consecutiveFailures = 0
+		e.ejections = 0
+	}
+	p.lock.Unlock()
+}
+
+func (p *Pool) endpointResponded(endpoint *Endpoint, latency time.Duration) {
+	p.lock.Lock()
+	e := p.index[endpoint.CanonicalAddr()]
+	if e != nil {
+		p.recordLatency(e, latency)
+	}
+	p.lock.Unlock()
+}
+
+// recordLatency adds the latency to the moving average of the endpoint, and
+// deprioritizes the endpoint when its average exceeds multiplier times the
+// median of the averages of the endpoints that have seen min_requests
+// responses. The average of an endpoint starts over once it is no longer
+// deprioritized. pool.lock must be held.
+func (p *Pool) recordLatency(e *endpointElem, latency time.Duration) {
+	if !p.latencyOutliers.Enabled {
+		return
+	}
+
+	now := time.Now()
+	if !e.slowUntil.IsZero() && !e.slow(now) {
+		e.latency, e.responses, e.slowUntil = 0, 0, time.Time{}
+	}
+	if e.responses == 0 {
+		e.latency = float64(latency)
+	} else {
+		e.latency = latencyWeight*float64(latency) + (1-latencyWeight)*e.latency
+	}
+	e.responses++
+
+	if e.responses < p.latencyOutliers.MinRequests || e.slow(now) {
+		return
+	}
+	// the average exceeds multiplier times the median when it exceeds
+	// multiplier times the averages of more than half of the endpoints
+	var measured, faster int
+	for _, other := range p.endpoints {
+		if other.responses < p.latencyOutliers.MinRequests {
+			continue
+		}
+		measured++
+		if p.latencyOutliers.Multiplier*other.latency < e.latency {
+			faster++
+		}
+	}
+	if 2*faster > measured {
+		e.slowUntil = now.Add(p.latencyOutliers.DeprioritizationTime)
+	}
+}
+
+// recordFailure ejects the endpoint once it has failed consecutive_failures
+// times in a row. Every further ejection without a success in between lasts
+// twice as long, up to max_ejection_time; as the failure count is only reset
+// by a success, a re-admitted endpoint is ejected again on its next failure.
+// pool.lock must be held.
+func (p *Pool) recordFailure(e *endpointElem) {
+	if p.circuitBreaker.ConsecutiveFailures <= 0 {
+		return
+	}
+
+	e.consecutiveFailures++
+	now := time.Now()
+	if e.consecutiveFailures < p.circuitBreaker.ConsecutiveFailures || e.ejected(now) {
+		return
+	}
+
+	ejection := p.circuitBreaker.BaseEjectionTime
+	for i := 0; i < e.ejections && ejection < p.circuitBreaker.MaxEjectionTime; i++ {
+		ejection *= 2
+	}
+	if ejection > p.circuitBreaker.MaxEjectionTime {
+		ejection = p.circuitBreaker.MaxEjectionTime
+	}
+
+	e.ejectedUntil = now.Add(ejection)
+	e.ejections++
+}
+
+// pickAvailable returns the endpoint that pick selects from the available
+// primary endpoints of the filter or, when none is available, from the
+// available backup endpoints. When the pool has a local zone, endpoints in it
+// are picked from before endpoints in other zones, for primary and backup
+// endpoints alike, and endpoints deprioritized for their latency are only
+// picked when no other endpoint of their kind is available. When no endpoint
+// is available at all, the availability of the endpoints is reset and they are
+// picked from again. p.lock must be held.
+func (p *Pool) pickAvailable(filter *groupFilter, pick func() *endpointElem) *endpointElem {
+	defer func() { filter.backups, filter.zone, filter.fast = false, "", false }()
+
+	for _, reset := range []bool{false, true} {
+		if reset {
+			// all endpoints are unavailable so reset everything to available
+			p.resetAvailability()
+		}
+		for _, backups := range []bool{false, true} {
+			filter.backups = backups
+			for _, local := range []bool{true, false} {
+				filter.zone, filter.local = p.localZone, local
+				for _, fast := range []bool{true, false} {
+					filter.fast = fast
+					if e := pick(); e != nil {
+						return e
+					}
+					if !p.latencyOutliers.Enabled {
+						break
+					}
+				}
+				if p.localZone == "" {
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// resetAvailability makes every endpoint available again. It is used when all
+// endpoints have failed, been ejected or are unhealthy, as routing to one of
+// them is better than routing to none. Endpoints at their connection limit
+// or draining remain unavailable. pool.lock must be held.
+func (p *Pool) resetAvailability() {
+	for _, e := range p.endpoints {
+		e.failedAt = nil
+		e.ejectedUntil = time.Time{}
+		e.unhealthy = false
+	}
+}
+
+// SetEndpointHealthy records the result of a health check of the endpoint.
+// Unhealthy endpoints are not selected until they are healthy again. Returns
+// true if the health of the endpoint changed.
+func (p *Pool) SetEndpointHealthy(endpoint *Endpoint, healthy bool) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	e := p.index[endpoint.CanonicalAddr()]
+	if e == nil || e.unhealthy == !healthy {
+		return false
+	}
+	e.unhealthy = !healthy
+	return true
+}
+
+// SetEndpointDraining sets whether the endpoint at the address is draining.
+// Draining endpoints are not selected for new requests, but remain in the
+// pool. Returns false if the endpoint is not in the pool.
+func (p *Pool) SetEndpointDraining(address string, draining bool) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	e := p.index[address]
+	if e == nil || e.endpoint.CanonicalAddr() != address {
+		return false
+	}
+	e.draining = draining
+	return true
+}
+
 func (p *Pool) Each(f func(endpoint *Endpoint)) {
 	p.lock.Lock()
 	for _, e := range p.endpoints {
@@ -286,6 +1027,16 @@ func (p *Pool) Each(f func(endpoint *Endpoint)) {
 	p.lock.Unlock()
 }
 
+// EachWithUpdateTime calls f with every endpoint and the time it was last
+// registered.
+func (p *Pool) EachWithUpdateTime(f func(endpoint *Endpoint, updated time.Time)) {
+	p.lock.Lock()
+	for _, e := range p.endpoints {
+		f(e.endpoint, e.updated)
+	}
+	p.lock.Unlock()
+}
+
 func (p *Pool) MarshalJSON() ([]byte, error) {
 	p.lock.Lock()
 	endpoints := make([]Endpoint, 0, len(p.endpoints))
@@ -302,27 +1053,151 @@ func (e *endpointElem) failed() {
 	e.failedAt = &t
 }
 
+func (e *endpointElem) ejected(now time.Time) bool {
+	return now.Before(e.ejectedUntil)
+}
+
+// slow reports whether the endpoint is deprioritized for its latency.
+func (e *endpointElem) slow(now time.Time) bool {
+	return now.Before(e.slowUntil)
+}
+
+// excluded reports whether the endpoint is draining, ejected, unhealthy or at
+// its connection limit.
+func (e *endpointElem) excluded(now time.Time) bool {
+	return e.draining || e.unhealthy || e.ejected(now) || e.endpoint.saturated()
+}
+
+// StaleThreshold returns the time after its last registration the endpoint
+// is pruned: its TTL if it has one, its stale threshold if it is shorter than
+// the default threshold, or the default threshold.
+func (e *Endpoint) StaleThreshold(defaultThreshold time.Duration) time.Duration {
+	if e.TTL > 0 {
+		return e.TTL
+	}
+	if e.staleThreshold > 0 && e.staleThreshold < defaultThreshold {
+		return e.staleThreshold
+	}
+	return defaultThreshold
+}
+
+// saturated reports whether the endpoint has as many requests in flight as
+// it accepts.
+func (e *Endpoint) saturated() bool {
+	return e.MaxConnections > 0 && e.Stats.NumberConnections.Count() >= int64(e.MaxConnections)
+}
+
+// acquire counts a request in flight to the endpoint, unless it is at its
+// connection limit, and returns whether it did. The limit is checked and the
+// request counted at once, so concurrent requests cannot exceed it.
+func (e *Endpoint) acquire() bool {
+	if e.MaxConnections <= 0 {
+		e.Stats.NumberConnections.Increment()
+		return true
+	}
+	return e.Stats.NumberConnections.IncrementBelow(int64(e.MaxConnections))
+}
+
 func (e *Endpoint) MarshalJSON() ([]byte, error) {
 	var jsonObj struct {
-		Address          string            `json:"address"`
-		TTL              int               `json:"ttl"`
-		RouteServiceUrl  string            `json:"route_service_url,omitempty"`
-		Tags             map[string]string `json:"tags"`
-		IsolationSegment string            `json:"isolation_segment,omitempty"`
+		Address             string                      `json:"address"`
+		TTL                 int                         `json:"ttl"`
+		RouteServiceUrl     string                      `json:"route_service_url,omitempty"`
+		RouteServiceUrls    []string                    `json:"route_service_urls,omitempty"`
+		Tags                map[string]string           `json:"tags"`
+		IsolationSegment    string                      `json:"isolation_segment,omitempty"`
+		Weight              int                         `json:"weight,omitempty"`
+		Protocol            string                      `json:"protocol,omitempty"`
+		TLS                 bool                        `json:"tls,omitempty"`
+		ServerCertDomainSAN string                      `json:"server_cert_domain_san,omitempty"`
+		EndpointTimeoutMs   int64                       `json:"endpoint_timeout_ms,omitempty"`
+		DialTimeoutMs       int64                       `json:"endpoint_dial_timeout_ms,omitempty"`
+		HeaderTimeoutMs     int64                       `json:"endpoint_response_header_timeout_ms,omitempty"`
+		IdleTimeoutMs       int64                       `json:"endpoint_idle_timeout_ms,omitempty"`
+		MaxConnections      int                         `json:"max_connections_per_endpoint,omitempty"`
+		MaxQueueDepth       int                         `json:"max_queue_depth,omitempty"`
+		MaxRequestBodySize  int64                       `json:"max_request_body_size_bytes,omitempty"`
+		CacheResponses      bool                        `json:"cache_responses,omitempty"`
+		RequestBuffering    string                      `json:"request_buffering,omitempty"`
+		StripPathPrefix     bool                        `json:"strip_path_prefix,omitempty"`
+		Group               string                      `json:"group,omitempty"`
+		Backup              bool                        `json:"backup,omitempty"`
+		Zone                string                      `json:"availability_zone,omitempty"`
+		TrafficRules        []TrafficRule               `json:"traffic_rules,omitempty"`
+		Mirror              *Mirror                     `json:"mirror,omitempty"`
+		HeaderRewrites      *config.HeaderRewriteConfig `json:"header_rewrites,omitempty"`
+		Maintenance         *Maintenance                `json:"maintenance,omitempty"`
+		Auth                *Auth                       `json:"auth,omitempty"`
+		IPAccess            *IPAccess                   `json:"ip_access,omitempty"`
+		WasmFilters         []string                    `json:"wasm_filters,omitempty"`
+		ForceHTTPS          bool                        `json:"force_https,omitempty"`
 	}
 
 	jsonObj.Address = e.addr
 	jsonObj.RouteServiceUrl = e.RouteServiceUrl
+	jsonObj.RouteServiceUrls = e.RouteServiceChain
 	jsonObj.TTL = int(e.staleThreshold.Seconds())
+	if e.TTL > 0 {
+		jsonObj.TTL = int(e.TTL.Seconds())
+	}
 	jsonObj.Tags = e.Tags
 	jsonObj.IsolationSegment = e.IsolationSegment
+	jsonObj.Weight = e.Weight
+	jsonObj.Protocol = e.Protocol
+	jsonObj.TLS = e.UseTLS
+	jsonObj.ServerCertDomainSAN = e.ServerCertDomainSAN
+	jsonObj.EndpointTimeoutMs = int64(e.Timeout / time.Millisecond)
+	jsonObj.DialTimeoutMs = int64(e.DialTimeout / time.Millisecond)
+	jsonObj.HeaderTimeoutMs = int64(e.ResponseHeaderTimeout / time.Millisecond)
+	jsonObj.IdleTimeoutMs = int64(e.IdleTimeout / time.Millisecond)
+	jsonObj.MaxConnections = e.MaxConnections
+	jsonObj.MaxQueueDepth = e.MaxQueueDepth
+	jsonObj.MaxRequestBodySize = e.MaxRequestBodySize
+	jsonObj.CacheResponses = e.CacheResponses
+	jsonObj.RequestBuffering = e.RequestBuffering
+	jsonObj.StripPathPrefix = e.StripPathPrefix
+	jsonObj.Group = e.Group
+	jsonObj.Backup = e.Backup
+	jsonObj.Zone = e.Zone
+	jsonObj.TrafficRules = e.TrafficRules
+	jsonObj.Mirror = e.Mirror
+	jsonObj.HeaderRewrites = e.HeaderRewrites
+	jsonObj.Maintenance = e.Maintenance
+	jsonObj.Auth = e.Auth
+	jsonObj.IPAccess = e.IPAccess
+	jsonObj.WasmFilters = e.WasmFilters
+	jsonObj.ForceHTTPS = e.ForceHTTPS
 	return json.Marshal(jsonObj)
 }
 
+// IsHTTP2 returns true if the endpoint expects requests to be proxied over
+// HTTP/2, as is the case for gRPC applications.
+func (e *Endpoint) IsHTTP2() bool {
+	return e.Protocol == ProtocolHTTP2
+}
+
+// weight returns the relative share of traffic the endpoint should receive.
+// Endpoints registered without a weight get DefaultEndpointWeight.
+func (e *Endpoint) weight() int {
+	if e.Weight <= 0 {
+		return DefaultEndpointWeight
+	}
+	return e.Weight
+}
+
 func (e *Endpoint) CanonicalAddr() string {
 	return e.addr
 }
 
+// UnixSocket returns the path of the unix socket of the endpoint, or "" when
+// it is reached over TCP.
+func (e *Endpoint) UnixSocket() string {
+	if !strings.HasPrefix(e.addr, UnixSocketPrefix) {
+		return ""
+	}
+	return strings.TrimPrefix(e.addr, UnixSocketPrefix)
+}
+
 func (rm *Endpoint) Component() string {
 	return rm.Tags["component"]
 }
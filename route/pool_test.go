@@ -2,6 +2,8 @@ package route_test
 
 import (
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"code.cloudfoundry.org/gorouter/route"
@@ -59,7 +61,7 @@ var _ = Describe("Pool", func() {
 			It("updates an endpoint with modification tag", func() {
 				endpoint := route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "", modTag2, "")
 				Expect(pool.Put(endpoint)).To(BeTrue())
-				Expect(pool.Endpoints("", "").Next().ModificationTag).To(Equal(modTag2))
+				Expect(pool.Endpoints("", "", "").Next().ModificationTag).To(Equal(modTag2))
 			})
 
 			Context("when modification_tag is older", func() {
@@ -74,7 +76,7 @@ var _ = Describe("Pool", func() {
 					endpoint := route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "", olderModTag, "")
 
 					Expect(pool.Put(endpoint)).To(BeFalse())
-					Expect(pool.Endpoints("", "").Next().ModificationTag).To(Equal(modTag2))
+					Expect(pool.Endpoints("", "", "").Next().ModificationTag).To(Equal(modTag2))
 				})
 			})
 		})
@@ -104,6 +106,97 @@ var _ = Describe("Pool", func() {
 		})
 	})
 
+	Context("RouteServiceChain", func() {
+		It("returns the route services of the endpoints of the pool", func() {
+			Expect(pool.RouteServiceChain()).To(BeEmpty())
+
+			pool.Put(&route.Endpoint{})
+			Expect(pool.RouteServiceChain()).To(BeEmpty())
+
+			pool.Put(&route.Endpoint{RouteServiceUrl: "https://rs.example.com"})
+			Expect(pool.RouteServiceChain()).To(Equal([]string{"https://rs.example.com"}))
+
+			pool.Put(&route.Endpoint{
+				RouteServiceUrl:   "https://waf.example.com",
+				RouteServiceChain: []string{"https://waf.example.com", "https://auth.example.com"},
+			})
+			Expect(pool.RouteServiceChain()).To(Equal([]string{"https://waf.example.com", "https://auth.example.com"}))
+		})
+	})
+
+	Context("CacheResponses", func() {
+		It("returns whether the endpoints of the pool opted in to caching", func() {
+			Expect(pool.CacheResponses()).To(BeFalse())
+
+			pool.Put(&route.Endpoint{})
+			Expect(pool.CacheResponses()).To(BeFalse())
+
+			pool.Put(&route.Endpoint{CacheResponses: true})
+			Expect(pool.CacheResponses()).To(BeTrue())
+		})
+	})
+
+	Context("RequestBuffering", func() {
+		It("returns the request buffering mode of the endpoints of the pool", func() {
+			Expect(pool.RequestBuffering()).To(BeEmpty())
+
+			pool.Put(&route.Endpoint{RequestBuffering: route.RequestBufferingBuffer})
+			Expect(pool.RequestBuffering()).To(Equal(route.RequestBufferingBuffer))
+		})
+	})
+
+	Context("StripPathPrefix", func() {
+		It("returns whether the endpoints of the pool strip the context path", func() {
+			Expect(pool.StripPathPrefix()).To(BeFalse())
+
+			pool.Put(&route.Endpoint{})
+			Expect(pool.StripPathPrefix()).To(BeFalse())
+
+			pool.Put(&route.Endpoint{StripPathPrefix: true})
+			Expect(pool.StripPathPrefix()).To(BeTrue())
+		})
+	})
+
+	Context("Auth", func() {
+		It("requires authentication while any endpoint of the pool does", func() {
+			auth := &route.Auth{Type: route.AuthBasic, Htpasswd: "users"}
+			e1 := route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "", modTag, "")
+			e2 := route.NewEndpoint("", "5.6.7.8", 5678, "", "", nil, -1, "", modTag, "")
+			e2.Auth = auth
+
+			pool.Put(e1)
+			Expect(pool.Auth()).To(BeNil())
+
+			pool.Put(e2)
+			Expect(pool.Auth()).To(Equal(auth))
+
+			pool.Remove(e2)
+			Expect(pool.Auth()).To(BeNil())
+		})
+
+		It("requires the authentication set for the pool", func() {
+			auth := &route.Auth{Type: route.AuthBasic, Htpasswd: "users"}
+			pool.Put(route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "", modTag, ""))
+			pool.SetAuth(auth)
+			Expect(pool.Auth()).To(Equal(auth))
+		})
+	})
+
+	Context("IPAccess", func() {
+		It("restricts the route while any endpoint of the pool is restricted", func() {
+			access := &route.IPAccess{Allow: []string{"10.0.0.0/8"}}
+			e1 := route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "", modTag, "")
+			e2 := route.NewEndpoint("", "5.6.7.8", 5678, "", "", nil, -1, "", modTag, "")
+			e2.IPAccess = access
+
+			pool.Put(e1)
+			Expect(pool.IPAccess()).To(BeNil())
+
+			pool.Put(e2)
+			Expect(pool.IPAccess()).To(Equal(access))
+		})
+	})
+
 	Context("Remove", func() {
 		It("removes endpoints", func() {
 			endpoint := &route.Endpoint{}
@@ -271,6 +364,23 @@ var _ = Describe("Pool", func() {
 			})
 		})
 
+		Context("when an endpoint has a TTL", func() {
+			It("prunes the endpoint after its TTL, also when it is longer than the default threshold", func() {
+				e1 := route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, 20, "", modTag, "")
+				e1.TTL = 2 * time.Minute
+				e2 := route.NewEndpoint("", "1.2.3.4", 1234, "", "", nil, -1, "", modTag, "")
+				e2.TTL = 30 * time.Second
+
+				pool.Put(e1)
+				pool.Put(e2)
+				pool.MarkUpdated(time.Now().Add(-90 * time.Second))
+
+				prunedEndpoints := pool.PruneEndpoints(defaultThreshold)
+				Expect(prunedEndpoints).To(ConsistOf(e2))
+				Expect(pool.IsEmpty()).To(BeFalse())
+			})
+		})
+
 		Context("when an endpoint does NOT have a custom stale time", func() {
 			Context("and it has passed the stale threshold", func() {
 				It("prunes the endpoint", func() {
@@ -302,6 +412,22 @@ var _ = Describe("Pool", func() {
 		})
 	})
 
+	Context("StaleAt", func() {
+		It("returns the time the endpoint becomes stale", func() {
+			e1 := route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, 20, "", modTag, "")
+			pool.Put(e1)
+			updated := time.Now().Add(-5 * time.Second)
+			pool.MarkUpdated(updated)
+
+			staleAt, ok := pool.StaleAt("1.2.3.4:5678", time.Minute)
+			Expect(ok).To(BeTrue())
+			Expect(staleAt).To(BeTemporally("==", updated.Add(20*time.Second)))
+
+			_, ok = pool.StaleAt("1.2.3.4:1234", time.Minute)
+			Expect(ok).To(BeFalse())
+		})
+	})
+
 	Context("MarkUpdated", func() {
 		It("updates all endpoints", func() {
 			e1 := route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "", modTag, "")
@@ -340,6 +466,22 @@ var _ = Describe("Pool", func() {
 		})
 	})
 
+	Context("EachWithUpdateTime", func() {
+		It("applies a function to each endpoint and the time it was last registered", func() {
+			e1 := route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "", modTag, "")
+			pool.Put(e1)
+			updatedAt := time.Now().Add(-time.Minute)
+			pool.MarkUpdated(updatedAt)
+
+			var updated []time.Time
+			pool.EachWithUpdateTime(func(e *route.Endpoint, t time.Time) {
+				Expect(e).To(Equal(e1))
+				updated = append(updated, t)
+			})
+			Expect(updated).To(Equal([]time.Time{updatedAt}))
+		})
+	})
+
 	Context("Stats", func() {
 		Context("NumberConnections", func() {
 			It("increments number of connections", func() {
@@ -370,6 +512,139 @@ var _ = Describe("Pool", func() {
 		})
 	})
 
+	Context("Saturated", func() {
+		It("is false when the pool is empty", func() {
+			Expect(pool.Saturated()).To(BeFalse())
+		})
+
+		It("is true when every endpoint is at its connection limit", func() {
+			e1 := route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "", modTag, "")
+			e1.MaxConnections = 1
+			e2 := route.NewEndpoint("", "5.6.7.8", 5678, "", "", nil, -1, "", modTag, "")
+			pool.Put(e1)
+			pool.Put(e2)
+
+			e1.Stats.NumberConnections.Increment()
+			Expect(pool.Saturated()).To(BeFalse())
+
+			e2.MaxConnections = 1
+			e2.Stats.NumberConnections.Increment()
+			Expect(pool.Saturated()).To(BeTrue())
+		})
+
+		It("keeps counting connections when an endpoint is registered again", func() {
+			e1 := route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "", modTag, "")
+			e1.MaxConnections = 1
+			pool.Put(e1)
+			e1.Stats.NumberConnections.Increment()
+
+			e2 := route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "", modTag, "")
+			e2.MaxConnections = 1
+			pool.Put(e2)
+			Expect(e2.Stats.NumberConnections.Count()).To(Equal(int64(1)))
+			Expect(pool.Saturated()).To(BeTrue())
+		})
+	})
+
+	Context("PreRequest", func() {
+		It("never takes more connection slots of an endpoint than its limit", func() {
+			e := route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "", modTag, "")
+			e.MaxConnections = 5
+			pool.Put(e)
+
+			var taken int64
+			var wg sync.WaitGroup
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					iter := pool.Endpoints("", "", "")
+					if iter.PreRequest(e) {
+						atomic.AddInt64(&taken, 1)
+					}
+				}()
+			}
+			wg.Wait()
+
+			Expect(taken).To(Equal(int64(5)))
+			Expect(e.Stats.NumberConnections.Count()).To(Equal(int64(5)))
+		})
+
+		It("takes slots without limit when the endpoint has none", func() {
+			e := route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "", modTag, "")
+			pool.Put(e)
+
+			iter := pool.Endpoints("", "", "")
+			for i := 0; i < 10; i++ {
+				Expect(iter.PreRequest(e)).To(BeTrue())
+			}
+			Expect(e.Stats.NumberConnections.Count()).To(Equal(int64(10)))
+		})
+	})
+
+	Context("Enqueue", func() {
+		var endpoint *route.Endpoint
+
+		BeforeEach(func() {
+			endpoint = route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "", modTag, "")
+			endpoint.MaxConnections = 1
+			pool.Put(endpoint)
+		})
+
+		It("releases requests right away when an endpoint is below its limit", func() {
+			wait, ok := pool.Enqueue(1)
+			Expect(ok).To(BeTrue())
+			Expect(wait).To(BeClosed())
+			Expect(pool.QueueDepth()).To(BeZero())
+		})
+
+		Context("when every endpoint is at its connection limit", func() {
+			var iter route.EndpointIterator
+
+			BeforeEach(func() {
+				iter = pool.Endpoints("", "", "")
+				iter.PreRequest(endpoint)
+			})
+
+			It("releases queued requests in order as endpoints complete requests", func() {
+				first, ok := pool.Enqueue(2)
+				Expect(ok).To(BeTrue())
+				second, ok := pool.Enqueue(2)
+				Expect(ok).To(BeTrue())
+				Expect(pool.QueueDepth()).To(Equal(2))
+
+				iter.PostRequest(endpoint)
+				Expect(first).To(BeClosed())
+				Expect(second).ToNot(BeClosed())
+				Expect(pool.QueueDepth()).To(Equal(1))
+			})
+
+			It("does not queue more than the maximum depth", func() {
+				_, ok := pool.Enqueue(1)
+				Expect(ok).To(BeTrue())
+				_, ok = pool.Enqueue(1)
+				Expect(ok).To(BeFalse())
+			})
+
+			It("removes requests that stop waiting", func() {
+				wait, _ := pool.Enqueue(1)
+				pool.Dequeue(wait)
+				Expect(pool.QueueDepth()).To(BeZero())
+			})
+
+			It("passes the release of requests that stopped waiting on", func() {
+				first, _ := pool.Enqueue(2)
+				iter.PostRequest(endpoint)
+				iter.PreRequest(endpoint)
+				second, _ := pool.Enqueue(2)
+
+				pool.Dequeue(first)
+				Expect(second).To(BeClosed())
+			})
+		})
+	})
+
 	It("marshals json", func() {
 		e := route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "https://my-rs.com", modTag, "")
 		e2 := route.NewEndpoint("", "5.6.7.8", 5678, "", "", nil, -1, "", modTag, "")
@@ -397,6 +672,112 @@ var _ = Describe("Pool", func() {
 		})
 	})
 
+	Context("when endpoints have an IPv6 host", func() {
+		It("brackets the host in the address", func() {
+			e := route.NewEndpoint("", "fd00::1", 5678, "", "", nil, -1, "", modTag, "")
+			Expect(e.CanonicalAddr()).To(Equal("[fd00::1]:5678"))
+		})
+
+		It("accepts hosts registered with brackets", func() {
+			e := route.NewEndpoint("", "[fd00::1]", 5678, "", "", nil, -1, "", modTag, "")
+			Expect(e.CanonicalAddr()).To(Equal("[fd00::1]:5678"))
+		})
+	})
+
+	Context("when endpoints are reached over a unix socket", func() {
+		It("uses the prefixed path of the socket as the address", func() {
+			e := route.NewEndpoint("", "unix:/var/run/app.sock", 0, "", "", nil, -1, "", modTag, "")
+			Expect(e.CanonicalAddr()).To(Equal("unix:/var/run/app.sock"))
+			Expect(e.UnixSocket()).To(Equal("/var/run/app.sock"))
+		})
+
+		It("has no socket for TCP endpoints", func() {
+			e := route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "", modTag, "")
+			Expect(e.UnixSocket()).To(BeEmpty())
+		})
+	})
+
+	Context("when endpoints have a weight", func() {
+		var e *route.Endpoint
+		BeforeEach(func() {
+			e = route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "", modTag, "")
+			e.Weight = 3
+		})
+		It("marshals json ", func() {
+			pool.Put(e)
+			json, err := pool.MarshalJSON()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(json)).To(Equal(`[{"address":"1.2.3.4:5678","ttl":-1,"tags":null,"weight":3}]`))
+		})
+	})
+
+	Context("when endpoints have a protocol", func() {
+		var e *route.Endpoint
+		BeforeEach(func() {
+			e = route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "", modTag, "")
+			e.Protocol = route.ProtocolHTTP2
+		})
+		It("marshals json ", func() {
+			pool.Put(e)
+			json, err := pool.MarshalJSON()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(json)).To(Equal(`[{"address":"1.2.3.4:5678","ttl":-1,"tags":null,"protocol":"http2"}]`))
+		})
+	})
+
+	Context("when endpoints use TLS", func() {
+		var e *route.Endpoint
+		BeforeEach(func() {
+			e = route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "", modTag, "")
+			e.UseTLS = true
+			e.ServerCertDomainSAN = "some-san"
+		})
+		It("marshals json ", func() {
+			pool.Put(e)
+			json, err := pool.MarshalJSON()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(json)).To(Equal(`[{"address":"1.2.3.4:5678","ttl":-1,"tags":null,"tls":true,"server_cert_domain_san":"some-san"}]`))
+		})
+	})
+
+	Context("when endpoints have a timeout", func() {
+		var e *route.Endpoint
+		BeforeEach(func() {
+			e = route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "", modTag, "")
+			e.Timeout = 1500 * time.Millisecond
+		})
+		It("marshals json ", func() {
+			pool.Put(e)
+			json, err := pool.MarshalJSON()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(json)).To(Equal(`[{"address":"1.2.3.4:5678","ttl":-1,"tags":null,"endpoint_timeout_ms":1500}]`))
+		})
+
+		It("marshals the dial, response header and idle timeouts", func() {
+			e.DialTimeout = 100 * time.Millisecond
+			e.ResponseHeaderTimeout = 2 * time.Second
+			e.IdleTimeout = 30 * time.Second
+			pool.Put(e)
+			json, err := pool.MarshalJSON()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(json)).To(Equal(`[{"address":"1.2.3.4:5678","ttl":-1,"tags":null,"endpoint_timeout_ms":1500,"endpoint_dial_timeout_ms":100,"endpoint_response_header_timeout_ms":2000,"endpoint_idle_timeout_ms":30000}]`))
+		})
+	})
+
+	Context("when endpoints have a connection limit", func() {
+		var e *route.Endpoint
+		BeforeEach(func() {
+			e = route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "", modTag, "")
+			e.MaxConnections = 10
+		})
+		It("marshals json ", func() {
+			pool.Put(e)
+			json, err := pool.MarshalJSON()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(json)).To(Equal(`[{"address":"1.2.3.4:5678","ttl":-1,"tags":null,"max_connections_per_endpoint":10}]`))
+		})
+	})
+
 	Context("when endpoints have empty tags", func() {
 		var e *route.Endpoint
 		BeforeEach(func() {
@@ -12,6 +12,8 @@ type RoundRobin struct {
 
 	initialEndpoint string
 	lastEndpoint    *Endpoint
+
+	groupFilter
 }
 
 func NewRoundRobin(p *Pool, initial string) EndpointIterator {
@@ -26,6 +28,9 @@ func (r *RoundRobin) Next() *Endpoint {
 	if r.initialEndpoint != "" {
 		e = r.pool.findById(r.initialEndpoint)
 		r.initialEndpoint = ""
+		if e != nil && !r.selects(e) {
+			e = nil
+		}
 	}
 
 	if e == nil {
@@ -46,6 +51,10 @@ func (r *RoundRobin) next() *Endpoint {
 		return nil
 	}
 
+	if r.pool.weighted() {
+		return r.nextWeighted()
+	}
+
 	if r.pool.nextIdx == -1 {
 		r.pool.nextIdx = random.Intn(last)
 	} else if r.pool.nextIdx >= last {
@@ -53,14 +62,24 @@ func (r *RoundRobin) next() *Endpoint {
 	}
 
 	startIdx := r.pool.nextIdx
-	curIdx := startIdx
-	for {
-		e := r.pool.endpoints[curIdx]
+	selected := r.pool.pickAvailable(&r.groupFilter, func() *endpointElem {
+		return r.nextAvailable(startIdx)
+	})
+	if selected == nil {
+		// all endpoints are at their connection limit
+		return nil
+	}
+	return selected.endpoint
+}
 
-		curIdx++
-		if curIdx == last {
-			curIdx = 0
-		}
+// nextAvailable returns the first available endpoint from the index on, and
+// moves the index of the pool past it.
+// pool.lock must be held.
+func (r *RoundRobin) nextAvailable(startIdx int) *endpointElem {
+	last := len(r.pool.endpoints)
+	for i := 0; i < last; i++ {
+		curIdx := (startIdx + i) % last
+		e := r.pool.endpoints[curIdx]
 
 		if e.failedAt != nil {
 			curTime := time.Now()
@@ -70,18 +89,68 @@ func (r *RoundRobin) next() *Endpoint {
 			}
 		}
 
-		if e.failedAt == nil {
-			r.pool.nextIdx = curIdx
-			return e.endpoint
+		if e.failedAt == nil && !r.excludes(e, time.Now()) && r.selects(e.endpoint) {
+			r.pool.nextIdx = (curIdx + 1) % last
+			return e
 		}
+	}
+	return nil
+}
+
+// nextWeighted implements smooth weighted round-robin: every available
+// endpoint gains its weight on each pick and the chosen one is set back by the
+// sum of all weights, which spreads picks evenly in proportion to weight.
+// pool.lock must be held.
+func (r *RoundRobin) nextWeighted() *Endpoint {
+	var total int
+	selected := r.pool.pickAvailable(&r.groupFilter, func() *endpointElem {
+		var e *endpointElem
+		e, total = r.heaviest()
+		return e
+	})
+	if selected == nil {
+		// all endpoints are at their connection limit
+		return nil
+	}
+
+	selected.currentWeight -= total
+	return selected.endpoint
+}
 
-		if curIdx == startIdx {
-			// all endpoints are marked failed so reset everything to available
-			for _, e2 := range r.pool.endpoints {
-				e2.failedAt = nil
+// heaviest adds the weight of each available endpoint to its current weight,
+// and returns the endpoint with the largest current weight and the sum of the
+// weights.
+// pool.lock must be held.
+func (r *RoundRobin) heaviest() (*endpointElem, int) {
+	var selected *endpointElem
+	total := 0
+
+	curTime := time.Now()
+	for _, e := range r.pool.endpoints {
+		if !r.selects(e.endpoint) {
+			continue
+		}
+		if e.failedAt != nil {
+			if curTime.Sub(*e.failedAt) > r.pool.retryAfterFailure {
+				// exipired failure window
+				e.failedAt = nil
+			} else {
+				continue
 			}
 		}
+		if r.excludes(e, curTime) {
+			continue
+		}
+
+		w := e.endpoint.weight()
+		e.currentWeight += w
+		total += w
+		if selected == nil || e.currentWeight > selected.currentWeight {
+			selected = e
+		}
 	}
+
+	return selected, total
 }
 
 func (r *RoundRobin) EndpointFailed() {
@@ -90,8 +159,29 @@ func (r *RoundRobin) EndpointFailed() {
 	}
 }
 
-func (r *RoundRobin) PreRequest(e *Endpoint) {
+func (r *RoundRobin) EndpointErrored() {
+	if r.lastEndpoint != nil {
+		r.pool.endpointErrored(r.lastEndpoint)
+	}
+}
+
+func (r *RoundRobin) EndpointSucceeded() {
+	if r.lastEndpoint != nil {
+		r.pool.endpointSucceeded(r.lastEndpoint)
+	}
+}
+
+func (r *RoundRobin) EndpointResponded(latency time.Duration) {
+	if r.lastEndpoint != nil {
+		r.pool.endpointResponded(r.lastEndpoint, latency)
+	}
+}
+
+func (r *RoundRobin) PreRequest(e *Endpoint) bool {
+	return e.acquire()
 }
 
 func (r *RoundRobin) PostRequest(e *Endpoint) {
+	e.Stats.NumberConnections.Decrement()
+	r.pool.endpointReleased(e)
 }
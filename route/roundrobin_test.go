@@ -3,6 +3,7 @@ package route_test
 import (
 	"time"
 
+	"code.cloudfoundry.org/gorouter/config"
 	"code.cloudfoundry.org/gorouter/route"
 	"code.cloudfoundry.org/routing-api/models"
 	. "github.com/onsi/ginkgo"
@@ -134,6 +135,60 @@ var _ = Describe("RoundRobin", func() {
 		})
 	})
 
+	Describe("Weighted", func() {
+		It("distributes requests in proportion to endpoint weights", func() {
+			e1 := route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "", modTag, "")
+			e1.Weight = 1
+			e2 := route.NewEndpoint("", "5.6.7.8", 1234, "", "", nil, -1, "", modTag, "")
+			e2.Weight = 3
+			pool.Put(e1)
+			pool.Put(e2)
+
+			iter := route.NewRoundRobin(pool, "")
+
+			counts := map[*route.Endpoint]int{}
+			for i := 0; i < 40; i++ {
+				counts[iter.Next()]++
+			}
+
+			Expect(counts[e1]).To(Equal(10))
+			Expect(counts[e2]).To(Equal(30))
+		})
+
+		It("treats endpoints without a weight as having the default weight", func() {
+			e1 := route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "", modTag, "")
+			e2 := route.NewEndpoint("", "5.6.7.8", 1234, "", "", nil, -1, "", modTag, "")
+			e2.Weight = 2
+			pool.Put(e1)
+			pool.Put(e2)
+
+			iter := route.NewRoundRobin(pool, "")
+
+			counts := map[*route.Endpoint]int{}
+			for i := 0; i < 30; i++ {
+				counts[iter.Next()]++
+			}
+
+			Expect(counts[e1]).To(Equal(10))
+			Expect(counts[e2]).To(Equal(20))
+		})
+
+		It("skips failed endpoints", func() {
+			e1 := route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "", modTag, "")
+			e1.Weight = 5
+			e2 := route.NewEndpoint("", "5.6.7.8", 1234, "", "", nil, -1, "", modTag, "")
+			pool.Put(e1)
+			pool.Put(e2)
+
+			iter := route.NewRoundRobin(pool, "")
+			Expect(iter.Next()).To(Equal(e1))
+			iter.EndpointFailed()
+
+			Expect(iter.Next()).To(Equal(e2))
+			Expect(iter.Next()).To(Equal(e2))
+		})
+	})
+
 	Describe("Failed", func() {
 		It("skips failed endpoints", func() {
 			e1 := route.NewEndpoint("", "1.2.3.4", 5678, "", "", nil, -1, "", modTag, "")
@@ -199,4 +254,423 @@ var _ = Describe("RoundRobin", func() {
 			Expect(n1).ToNot(Equal(n2))
 		})
 	})
+
+	Describe("CircuitBreaker", func() {
+		var e1, e2 *route.Endpoint
+
+		// errored reports n consecutive errors for the endpoint with the given
+		// private instance id
+		errored := func(id string, n int) {
+			for i := 0; i < n; i++ {
+				iter := route.NewRoundRobin(pool, id)
+				Expect(iter.Next().PrivateInstanceId).To(Equal(id))
+				iter.EndpointErrored()
+			}
+		}
+
+		nextTwo := func() []*route.Endpoint {
+			iter := route.NewRoundRobin(pool, "")
+			return []*route.Endpoint{iter.Next(), iter.Next()}
+		}
+
+		BeforeEach(func() {
+			pool.SetCircuitBreaker(config.CircuitBreakerConfig{
+				ConsecutiveFailures: 2,
+				BaseEjectionTime:    50 * time.Millisecond,
+				MaxEjectionTime:     time.Second,
+			})
+
+			e1 = route.NewEndpoint("", "1.2.3.4", 5678, "id1", "", nil, -1, "", modTag, "")
+			e2 = route.NewEndpoint("", "5.6.7.8", 1234, "id2", "", nil, -1, "", modTag, "")
+			pool.Put(e1)
+			pool.Put(e2)
+		})
+
+		It("does not eject an endpoint below the threshold", func() {
+			errored("id1", 1)
+			Expect(nextTwo()).To(ConsistOf(e1, e2))
+		})
+
+		It("ejects an endpoint after consecutive errors", func() {
+			errored("id1", 2)
+			Expect(nextTwo()).To(Equal([]*route.Endpoint{e2, e2}))
+		})
+
+		It("counts connection failures towards the threshold", func() {
+			pool = route.NewPool(0, "")
+			pool.SetCircuitBreaker(config.CircuitBreakerConfig{
+				ConsecutiveFailures: 2,
+				BaseEjectionTime:    time.Minute,
+				MaxEjectionTime:     time.Minute,
+			})
+			pool.Put(e1)
+			pool.Put(e2)
+
+			for i := 0; i < 2; i++ {
+				iter := route.NewRoundRobin(pool, "id1")
+				Expect(iter.Next()).To(Equal(e1))
+				iter.EndpointFailed()
+			}
+			Expect(nextTwo()).To(Equal([]*route.Endpoint{e2, e2}))
+		})
+
+		It("resets the consecutive errors when the endpoint succeeds", func() {
+			errored("id1", 1)
+
+			iter := route.NewRoundRobin(pool, "id1")
+			Expect(iter.Next()).To(Equal(e1))
+			iter.EndpointSucceeded()
+
+			errored("id1", 1)
+			Expect(nextTwo()).To(ConsistOf(e1, e2))
+		})
+
+		It("re-admits the endpoint with an exponentially growing ejection time", func() {
+			errored("id1", 2)
+			Expect(nextTwo()).To(Equal([]*route.Endpoint{e2, e2}))
+
+			time.Sleep(60 * time.Millisecond)
+			Expect(nextTwo()).To(ConsistOf(e1, e2))
+
+			// a re-admitted endpoint is ejected again on its next error
+			errored("id1", 1)
+			Expect(nextTwo()).To(Equal([]*route.Endpoint{e2, e2}))
+
+			time.Sleep(60 * time.Millisecond)
+			Expect(nextTwo()).To(Equal([]*route.Endpoint{e2, e2}))
+
+			time.Sleep(50 * time.Millisecond)
+			Expect(nextTwo()).To(ConsistOf(e1, e2))
+		})
+
+		It("resets when all endpoints are ejected", func() {
+			errored("id1", 2)
+			errored("id2", 2)
+			Expect(nextTwo()).To(ConsistOf(e1, e2))
+		})
+
+		It("does not eject endpoints when disabled", func() {
+			pool.SetCircuitBreaker(config.CircuitBreakerConfig{})
+			errored("id1", 5)
+			Expect(nextTwo()).To(ConsistOf(e1, e2))
+		})
+	})
+
+	Describe("SetEndpointHealthy", func() {
+		var e1, e2 *route.Endpoint
+
+		BeforeEach(func() {
+			e1 = route.NewEndpoint("", "1.2.3.4", 5678, "id1", "", nil, -1, "", modTag, "")
+			e2 = route.NewEndpoint("", "5.6.7.8", 1234, "id2", "", nil, -1, "", modTag, "")
+			pool.Put(e1)
+			pool.Put(e2)
+		})
+
+		It("skips unhealthy endpoints until they are healthy again", func() {
+			Expect(pool.SetEndpointHealthy(e1, false)).To(BeTrue())
+			Expect(pool.SetEndpointHealthy(e1, false)).To(BeFalse())
+
+			iter := route.NewRoundRobin(pool, "")
+			Expect(iter.Next()).To(Equal(e2))
+			Expect(iter.Next()).To(Equal(e2))
+
+			Expect(pool.SetEndpointHealthy(e1, true)).To(BeTrue())
+			Expect([]*route.Endpoint{iter.Next(), iter.Next()}).To(ConsistOf(e1, e2))
+		})
+
+		It("resets when all endpoints are unhealthy", func() {
+			pool.SetEndpointHealthy(e1, false)
+			pool.SetEndpointHealthy(e2, false)
+
+			iter := route.NewRoundRobin(pool, "")
+			Expect([]*route.Endpoint{iter.Next(), iter.Next()}).To(ConsistOf(e1, e2))
+		})
+
+		It("ignores endpoints that are not in the pool", func() {
+			e3 := route.NewEndpoint("", "9.9.9.9", 1234, "id3", "", nil, -1, "", modTag, "")
+			Expect(pool.SetEndpointHealthy(e3, false)).To(BeFalse())
+		})
+	})
+
+	Describe("SetEndpointDraining", func() {
+		var e1, e2 *route.Endpoint
+
+		BeforeEach(func() {
+			e1 = route.NewEndpoint("", "1.2.3.4", 5678, "id1", "", nil, -1, "", modTag, "")
+			e2 = route.NewEndpoint("", "5.6.7.8", 1234, "id2", "", nil, -1, "", modTag, "")
+			pool.Put(e1)
+			pool.Put(e2)
+		})
+
+		It("skips draining endpoints until they are re-enabled", func() {
+			Expect(pool.SetEndpointDraining("1.2.3.4:5678", true)).To(BeTrue())
+
+			iter := route.NewRoundRobin(pool, "")
+			Expect(iter.Next()).To(Equal(e2))
+			Expect(iter.Next()).To(Equal(e2))
+
+			Expect(pool.SetEndpointDraining("1.2.3.4:5678", false)).To(BeTrue())
+			Expect([]*route.Endpoint{iter.Next(), iter.Next()}).To(ConsistOf(e1, e2))
+		})
+
+		It("does not select any endpoint when all endpoints are draining", func() {
+			pool.SetEndpointDraining("1.2.3.4:5678", true)
+			pool.SetEndpointDraining("5.6.7.8:1234", true)
+
+			iter := route.NewRoundRobin(pool, "")
+			Expect(iter.Next()).To(BeNil())
+		})
+
+		It("keeps draining when the endpoint is registered again", func() {
+			pool.SetEndpointDraining("1.2.3.4:5678", true)
+			pool.Put(route.NewEndpoint("", "1.2.3.4", 5678, "id1", "", nil, -1, "", modTag, ""))
+
+			iter := route.NewRoundRobin(pool, "")
+			Expect(iter.Next()).To(Equal(e2))
+			Expect(iter.Next()).To(Equal(e2))
+		})
+
+		It("ignores endpoints that are not in the pool", func() {
+			Expect(pool.SetEndpointDraining("9.9.9.9:1234", true)).To(BeFalse())
+			Expect(pool.SetEndpointDraining("id1", true)).To(BeFalse())
+		})
+	})
+
+	Describe("Backup", func() {
+		var primary1, primary2, backup *route.Endpoint
+
+		BeforeEach(func() {
+			primary1 = route.NewEndpoint("", "1.2.3.4", 5678, "id1", "", nil, -1, "", modTag, "")
+			primary2 = route.NewEndpoint("", "5.6.7.8", 1234, "id2", "", nil, -1, "", modTag, "")
+			backup = route.NewEndpoint("", "9.9.9.9", 1234, "id3", "", nil, -1, "", modTag, "")
+			backup.Backup = true
+			pool.Put(primary1)
+			pool.Put(primary2)
+			pool.Put(backup)
+		})
+
+		It("does not select backup endpoints while primary endpoints are available", func() {
+			iter := route.NewRoundRobin(pool, "")
+			for i := 0; i < 10; i++ {
+				Expect(iter.Next()).ToNot(Equal(backup))
+			}
+		})
+
+		It("selects backup endpoints when all primary endpoints are unavailable", func() {
+			pool.SetEndpointHealthy(primary1, false)
+			iter := route.NewRoundRobin(pool, "")
+			Expect(iter.Next()).To(Equal(primary2))
+			iter.EndpointFailed()
+
+			Expect(iter.Next()).To(Equal(backup))
+			Expect(iter.Next()).To(Equal(backup))
+
+			pool.SetEndpointHealthy(primary1, true)
+			Expect(iter.Next()).To(Equal(primary1))
+		})
+
+		It("does not keep sticky sessions on backup endpoints", func() {
+			iter := route.NewRoundRobin(pool, "id3")
+			Expect(iter.Next()).ToNot(Equal(backup))
+		})
+
+		It("resets the primary endpoints when all endpoints are unavailable", func() {
+			pool.SetEndpointHealthy(primary1, false)
+			pool.SetEndpointHealthy(primary2, false)
+			pool.SetEndpointHealthy(backup, false)
+
+			iter := route.NewRoundRobin(pool, "")
+			Expect([]*route.Endpoint{iter.Next(), iter.Next()}).To(ConsistOf(primary1, primary2))
+		})
+
+		Context("with weights", func() {
+			BeforeEach(func() {
+				primary1.Weight = 2
+			})
+
+			It("selects backup endpoints when all primary endpoints are unavailable", func() {
+				pool.SetEndpointHealthy(primary1, false)
+				pool.SetEndpointHealthy(primary2, false)
+
+				iter := route.NewRoundRobin(pool, "")
+				Expect(iter.Next()).To(Equal(backup))
+			})
+		})
+	})
+
+	Describe("LatencyOutliers", func() {
+		var e1, e2, e3 *route.Endpoint
+
+		respond := func(e *route.Endpoint, latency time.Duration) {
+			iter := route.NewRoundRobin(pool, e.PrivateInstanceId)
+			Expect(iter.Next()).To(Equal(e))
+			iter.EndpointResponded(latency)
+		}
+
+		BeforeEach(func() {
+			e1 = route.NewEndpoint("", "1.2.3.4", 5678, "id1", "", nil, -1, "", modTag, "")
+			e2 = route.NewEndpoint("", "5.6.7.8", 1234, "id2", "", nil, -1, "", modTag, "")
+			e3 = route.NewEndpoint("", "9.9.9.9", 1234, "id3", "", nil, -1, "", modTag, "")
+			pool.Put(e1)
+			pool.Put(e2)
+			pool.Put(e3)
+			pool.SetLatencyOutliers(config.LatencyOutlierConfig{
+				Enabled:              true,
+				Multiplier:           2,
+				MinRequests:          1,
+				DeprioritizationTime: 50 * time.Millisecond,
+			})
+			respond(e1, 10*time.Millisecond)
+			respond(e2, 10*time.Millisecond)
+		})
+
+		It("deprioritizes endpoints whose latency exceeds the multiplier of the median", func() {
+			respond(e3, 100*time.Millisecond)
+
+			iter := route.NewRoundRobin(pool, "")
+			for i := 0; i < 10; i++ {
+				Expect(iter.Next()).ToNot(Equal(e3))
+			}
+		})
+
+		It("selects deprioritized endpoints when no other endpoint is available", func() {
+			respond(e3, 100*time.Millisecond)
+			pool.SetEndpointHealthy(e1, false)
+			pool.SetEndpointHealthy(e2, false)
+
+			iter := route.NewRoundRobin(pool, "")
+			Expect(iter.Next()).To(Equal(e3))
+		})
+
+		It("does not deprioritize endpoints within the multiplier of the median", func() {
+			respond(e3, 15*time.Millisecond)
+
+			iter := route.NewRoundRobin(pool, "")
+			Expect([]*route.Endpoint{iter.Next(), iter.Next(), iter.Next()}).To(ConsistOf(e1, e2, e3))
+		})
+
+		It("selects endpoints again after the deprioritization time", func() {
+			respond(e3, 100*time.Millisecond)
+			time.Sleep(60 * time.Millisecond)
+
+			iter := route.NewRoundRobin(pool, "")
+			Expect([]*route.Endpoint{iter.Next(), iter.Next(), iter.Next()}).To(ConsistOf(e1, e2, e3))
+		})
+
+		It("does not deprioritize endpoints when it is disabled", func() {
+			pool.SetLatencyOutliers(config.LatencyOutlierConfig{})
+			respond(e3, 100*time.Millisecond)
+
+			iter := route.NewRoundRobin(pool, "")
+			Expect([]*route.Endpoint{iter.Next(), iter.Next(), iter.Next()}).To(ConsistOf(e1, e2, e3))
+		})
+	})
+
+	Describe("LocalZone", func() {
+		var local1, local2, remote *route.Endpoint
+
+		BeforeEach(func() {
+			local1 = route.NewEndpoint("", "1.2.3.4", 5678, "id1", "", nil, -1, "", modTag, "")
+			local1.Zone = "z1"
+			local2 = route.NewEndpoint("", "5.6.7.8", 1234, "id2", "", nil, -1, "", modTag, "")
+			local2.Zone = "z1"
+			remote = route.NewEndpoint("", "9.9.9.9", 1234, "id3", "", nil, -1, "", modTag, "")
+			remote.Zone = "z2"
+			pool.Put(local1)
+			pool.Put(local2)
+			pool.Put(remote)
+			pool.SetLocalZone("z1")
+		})
+
+		It("selects endpoints in the local zone while they are available", func() {
+			iter := route.NewRoundRobin(pool, "")
+			for i := 0; i < 10; i++ {
+				Expect(iter.Next()).ToNot(Equal(remote))
+			}
+		})
+
+		It("selects endpoints in other zones when none in the local zone is available", func() {
+			pool.SetEndpointHealthy(local1, false)
+			pool.SetEndpointHealthy(local2, false)
+
+			iter := route.NewRoundRobin(pool, "")
+			Expect(iter.Next()).To(Equal(remote))
+
+			pool.SetEndpointHealthy(local2, true)
+			Expect(iter.Next()).To(Equal(local2))
+		})
+
+		It("prefers primary endpoints in other zones over backup endpoints in the local zone", func() {
+			local2.Backup = true
+			pool.SetEndpointHealthy(local1, false)
+
+			iter := route.NewRoundRobin(pool, "")
+			Expect(iter.Next()).To(Equal(remote))
+		})
+
+		It("keeps sticky sessions on endpoints in other zones", func() {
+			iter := route.NewRoundRobin(pool, "id3")
+			Expect(iter.Next()).To(Equal(remote))
+		})
+
+		It("balances across all zones without a local zone", func() {
+			pool.SetLocalZone("")
+			iter := route.NewRoundRobin(pool, "")
+			Expect([]*route.Endpoint{iter.Next(), iter.Next(), iter.Next()}).To(ConsistOf(local1, local2, remote))
+		})
+	})
+
+	Describe("MaxConnections", func() {
+		var e1, e2 *route.Endpoint
+
+		BeforeEach(func() {
+			e1 = route.NewEndpoint("", "1.2.3.4", 5678, "id1", "", nil, -1, "", modTag, "")
+			e1.MaxConnections = 1
+			e2 = route.NewEndpoint("", "5.6.7.8", 1234, "id2", "", nil, -1, "", modTag, "")
+			e2.MaxConnections = 1
+			pool.Put(e1)
+			pool.Put(e2)
+		})
+
+		It("skips endpoints at their connection limit", func() {
+			iter := route.NewRoundRobin(pool, "")
+			iter.PreRequest(e1)
+			Expect(iter.Next()).To(Equal(e2))
+			Expect(iter.Next()).To(Equal(e2))
+
+			iter.PostRequest(e1)
+			Expect([]*route.Endpoint{iter.Next(), iter.Next()}).To(ConsistOf(e1, e2))
+		})
+
+		It("skips a sticky endpoint at its connection limit", func() {
+			iter := route.NewRoundRobin(pool, "id1")
+			iter.PreRequest(e1)
+			Expect(iter.Next()).To(Equal(e2))
+		})
+
+		It("returns nil when all endpoints are at their connection limit", func() {
+			iter := route.NewRoundRobin(pool, "")
+			iter.PreRequest(e1)
+			iter.PreRequest(e2)
+			Expect(iter.Next()).To(BeNil())
+			Expect(pool.Saturated()).To(BeTrue())
+		})
+
+		It("returns nil when weighted endpoints are all at their connection limit", func() {
+			e1.Weight = 2
+			iter := route.NewRoundRobin(pool, "")
+			iter.PreRequest(e1)
+			iter.PreRequest(e2)
+			Expect(iter.Next()).To(BeNil())
+		})
+
+		It("does not reset endpoints at their connection limit with the failed ones", func() {
+			iter := route.NewRoundRobin(pool, "")
+			iter.PreRequest(e1)
+			Expect(iter.Next()).To(Equal(e2))
+			iter.EndpointFailed()
+
+			Expect(iter.Next()).To(Equal(e2))
+		})
+	})
 })
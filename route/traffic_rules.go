@@ -0,0 +1,101 @@
+package route
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// TrafficRule routes the requests that match all of its conditions to the
+// endpoints of a group.
+type TrafficRule struct {
+	Group  string        `json:"group"`
+	Header *TrafficMatch `json:"header,omitempty"`
+	Query  *TrafficMatch `json:"query,omitempty"`
+	// Percentage is the share of the matching requests that are routed to
+	// the group. All of them are when it is 0.
+	Percentage float64 `json:"percentage,omitempty"`
+}
+
+// TrafficMatch matches requests with a header or query parameter of the
+// name. When Value is empty, any value matches.
+type TrafficMatch struct {
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
+}
+
+// Valid reports whether the rule names a group and the headers or query
+// parameters it matches, and has a percentage between 0 and 100.
+func (r TrafficRule) Valid() bool {
+	return r.Group != "" &&
+		(r.Header == nil || r.Header.Name != "") &&
+		(r.Query == nil || r.Query.Name != "") &&
+		r.Percentage >= 0 && r.Percentage <= 100
+}
+
+func (r TrafficRule) matches(request *http.Request) bool {
+	if r.Header != nil {
+		values, ok := request.Header[http.CanonicalHeaderKey(r.Header.Name)]
+		if !ok || !r.Header.matches(values) {
+			return false
+		}
+	}
+	if r.Query != nil {
+		values, ok := request.URL.Query()[r.Query.Name]
+		if !ok || !r.Query.matches(values) {
+			return false
+		}
+	}
+	return r.Percentage == 0 || rand.Float64()*100 < r.Percentage
+}
+
+func (m *TrafficMatch) matches(values []string) bool {
+	if m.Value == "" {
+		return true
+	}
+	for _, v := range values {
+		if v == m.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// TrafficGroup returns the group of the first rule that matches the request,
+// or "" for the endpoints that are not in a group when no rule matches.
+func TrafficGroup(rules []TrafficRule, request *http.Request) string {
+	for _, rule := range rules {
+		if rule.matches(request) {
+			return rule.Group
+		}
+	}
+	return ""
+}
+
+// groupFilter restricts an endpoint iterator to the endpoints of a group, and
+// to the primary endpoints or, while backups is set, the backup endpoints.
+// While zone is set, it is further restricted to the endpoints in the zone
+// or, unless local is set, to the endpoints in other zones, and while fast is
+// set, to the endpoints that are not deprioritized for their latency.
+type groupFilter struct {
+	grouped bool
+	group   string
+	backups bool
+	zone    string
+	local   bool
+	fast    bool
+}
+
+func (f groupFilter) selects(e *Endpoint) bool {
+	return f.inGroup(e) && e.Backup == f.backups && (f.zone == "" || (e.Zone == f.zone) == f.local)
+}
+
+// excludes reports whether the endpoint is excluded from being picked, or is
+// deprioritized while fast is set.
+func (f groupFilter) excludes(e *endpointElem, now time.Time) bool {
+	return e.excluded(now) || f.fast && e.slow(now)
+}
+
+func (f groupFilter) inGroup(e *Endpoint) bool {
+	return !f.grouped || e.Group == f.group
+}
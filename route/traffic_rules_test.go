@@ -0,0 +1,103 @@
+package route_test
+
+import (
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/routing-api/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TrafficRules", func() {
+	Describe("TrafficGroup", func() {
+		rules := []route.TrafficRule{
+			{Group: "beta", Header: &route.TrafficMatch{Name: "X-Beta"}},
+			{Group: "canary", Header: &route.TrafficMatch{Name: "x-canary", Value: "true"}},
+			{Group: "v2", Query: &route.TrafficMatch{Name: "version", Value: "2"}},
+		}
+
+		It("returns the group of the first rule that matches", func() {
+			req := httptest.NewRequest("GET", "http://example.com/?version=2", nil)
+			Expect(route.TrafficGroup(rules, req)).To(Equal("v2"))
+
+			req.Header.Set("X-Canary", "true")
+			Expect(route.TrafficGroup(rules, req)).To(Equal("canary"))
+
+			req.Header.Set("X-Beta", "")
+			Expect(route.TrafficGroup(rules, req)).To(Equal("beta"))
+		})
+
+		It("returns no group when no rule matches", func() {
+			req := httptest.NewRequest("GET", "http://example.com/?version=1", nil)
+			req.Header.Set("X-Canary", "false")
+			Expect(route.TrafficGroup(rules, req)).To(BeEmpty())
+		})
+
+		It("routes a percentage of the matching requests to the group", func() {
+			rules := []route.TrafficRule{{Group: "canary", Percentage: 25}}
+			req := httptest.NewRequest("GET", "http://example.com/", nil)
+
+			canary := 0
+			for i := 0; i < 4000; i++ {
+				if route.TrafficGroup(rules, req) == "canary" {
+					canary++
+				}
+			}
+			Expect(canary).To(BeNumerically("~", 1000, 150))
+		})
+	})
+
+	Describe("Valid", func() {
+		It("requires a group, match names and a percentage up to 100", func() {
+			Expect(route.TrafficRule{Group: "a", Header: &route.TrafficMatch{Name: "X-A"}, Percentage: 100}.Valid()).To(BeTrue())
+			Expect(route.TrafficRule{Header: &route.TrafficMatch{Name: "X-A"}}.Valid()).To(BeFalse())
+			Expect(route.TrafficRule{Group: "a", Header: &route.TrafficMatch{Value: "a"}}.Valid()).To(BeFalse())
+			Expect(route.TrafficRule{Group: "a", Query: &route.TrafficMatch{}}.Valid()).To(BeFalse())
+			Expect(route.TrafficRule{Group: "a", Percentage: 101}.Valid()).To(BeFalse())
+			Expect(route.TrafficRule{Group: "a", Percentage: -1}.Valid()).To(BeFalse())
+		})
+	})
+
+	Describe("GroupEndpoints", func() {
+		var (
+			pool             *route.Pool
+			stable, v2a, v2b *route.Endpoint
+		)
+
+		BeforeEach(func() {
+			pool = route.NewPool(2*time.Minute, "")
+			stable = route.NewEndpoint("", "1.2.3.4", 5678, "stable", "", nil, -1, "", models.ModificationTag{}, "")
+			v2a = route.NewEndpoint("", "5.6.7.8", 1234, "v2a", "", nil, -1, "", models.ModificationTag{}, "")
+			v2a.Group = "v2"
+			v2b = route.NewEndpoint("", "5.6.7.9", 1234, "v2b", "", nil, -1, "", models.ModificationTag{}, "")
+			v2b.Group = "v2"
+			pool.Put(stable)
+			pool.Put(v2a)
+			pool.Put(v2b)
+		})
+
+		for _, lb := range []string{config.LOAD_BALANCE_RR, config.LOAD_BALANCE_LC, config.LOAD_BALANCE_HASH} {
+			lb := lb
+
+			It("selects only endpoints of the group with "+lb, func() {
+				for i := 0; i < 10; i++ {
+					Expect(pool.GroupEndpoints("v2", lb, "", "10.0.0.1").Next()).To(SatisfyAny(Equal(v2a), Equal(v2b)))
+					Expect(pool.GroupEndpoints("", lb, "", "10.0.0.1").Next()).To(Equal(stable))
+				}
+			})
+		}
+
+		It("does not select a sticky endpoint of another group", func() {
+			Expect(pool.GroupEndpoints("v2", config.LOAD_BALANCE_RR, "stable", "").Next()).ToNot(Equal(stable))
+			Expect(pool.GroupEndpoints("v2", config.LOAD_BALANCE_RR, "v2b", "").Next()).To(Equal(v2b))
+		})
+
+		It("returns nil when the group has no endpoints", func() {
+			Expect(pool.GroupEndpoints("v3", config.LOAD_BALANCE_RR, "", "").Next()).To(BeNil())
+			Expect(pool.GroupEndpoints("v3", config.LOAD_BALANCE_LC, "", "").Next()).To(BeNil())
+		})
+	})
+})
@@ -158,18 +158,7 @@ func (r *RouteFetcher) subscribeToEvents(token *schema.Token) error {
 func (r *RouteFetcher) HandleEvent(e routing_api.Event) {
 	eventRoute := e.Route
 	uri := route.Uri(eventRoute.Route)
-	endpoint := route.NewEndpoint(
-		eventRoute.LogGuid,
-		eventRoute.IP,
-		uint16(eventRoute.Port),
-		eventRoute.LogGuid,
-		"",
-		nil,
-		eventRoute.GetTTL(),
-		eventRoute.RouteServiceUrl,
-		eventRoute.ModificationTag,
-		"",
-	)
+	endpoint := newEndpoint(eventRoute)
 	switch e.Action {
 	case "Delete":
 		r.RouteRegistry.Unregister(uri, endpoint)
@@ -229,18 +218,7 @@ func (r *RouteFetcher) refreshEndpoints(validRoutes []models.Route) {
 	for _, aRoute := range r.endpoints {
 		r.RouteRegistry.Register(
 			route.Uri(aRoute.Route),
-			route.NewEndpoint(
-				aRoute.LogGuid,
-				aRoute.IP,
-				uint16(aRoute.Port),
-				aRoute.LogGuid,
-				"",
-				nil,
-				aRoute.GetTTL(),
-				aRoute.RouteServiceUrl,
-				aRoute.ModificationTag,
-				"",
-			))
+			newEndpoint(aRoute))
 	}
 }
 
@@ -265,21 +243,28 @@ func (r *RouteFetcher) deleteEndpoints(validRoutes []models.Route) {
 	for _, aRoute := range diff {
 		r.RouteRegistry.Unregister(
 			route.Uri(aRoute.Route),
-			route.NewEndpoint(
-				aRoute.LogGuid,
-				aRoute.IP,
-				uint16(aRoute.Port),
-				aRoute.LogGuid,
-				"",
-				nil,
-				aRoute.GetTTL(),
-				aRoute.RouteServiceUrl,
-				aRoute.ModificationTag,
-				"",
-			))
+			newEndpoint(aRoute))
 	}
 }
 
+// newEndpoint returns the endpoint of the route from the Routing API.
+func newEndpoint(r models.Route) *route.Endpoint {
+	endpoint := route.NewEndpoint(
+		r.LogGuid,
+		r.IP,
+		uint16(r.Port),
+		r.LogGuid,
+		"",
+		nil,
+		r.GetTTL(),
+		r.RouteServiceUrl,
+		r.ModificationTag,
+		"",
+	)
+	endpoint.Source = "routing-api"
+	return endpoint
+}
+
 func routeEquals(current, desired models.Route) bool {
 	if current.Route == desired.Route && current.IP == desired.IP && current.Port == desired.Port {
 		return true
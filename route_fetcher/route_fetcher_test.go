@@ -144,17 +144,18 @@ var _ = Describe("RouteFetcher", func() {
 				expectedRoute := response[i]
 				uri, endpoint := registry.RegisterArgsForCall(i)
 				Expect(uri).To(Equal(route.Uri(expectedRoute.Route)))
-				Expect(endpoint).To(Equal(
-					route.NewEndpoint(expectedRoute.LogGuid,
-						expectedRoute.IP, uint16(expectedRoute.Port),
-						expectedRoute.LogGuid,
-						"",
-						nil,
-						*expectedRoute.TTL,
-						expectedRoute.RouteServiceUrl,
-						expectedRoute.ModificationTag,
-						"",
-					)))
+				expectedEndpoint := route.NewEndpoint(expectedRoute.LogGuid,
+					expectedRoute.IP, uint16(expectedRoute.Port),
+					expectedRoute.LogGuid,
+					"",
+					nil,
+					*expectedRoute.TTL,
+					expectedRoute.RouteServiceUrl,
+					expectedRoute.ModificationTag,
+					"",
+				)
+				expectedEndpoint.Source = "routing-api"
+				Expect(endpoint).To(Equal(expectedEndpoint))
 			}
 		})
 
@@ -217,18 +218,19 @@ var _ = Describe("RouteFetcher", func() {
 				expectedRoute := expectedUnregisteredRoutes[i]
 				uri, endpoint := registry.UnregisterArgsForCall(i)
 				Expect(uri).To(Equal(route.Uri(expectedRoute.Route)))
-				Expect(endpoint).To(Equal(
-					route.NewEndpoint(expectedRoute.LogGuid,
-						expectedRoute.IP,
-						uint16(expectedRoute.Port),
-						expectedRoute.LogGuid,
-						"",
-						nil,
-						*expectedRoute.TTL,
-						expectedRoute.RouteServiceUrl,
-						expectedRoute.ModificationTag,
-						"",
-					)))
+				expectedEndpoint := route.NewEndpoint(expectedRoute.LogGuid,
+					expectedRoute.IP,
+					uint16(expectedRoute.Port),
+					expectedRoute.LogGuid,
+					"",
+					nil,
+					*expectedRoute.TTL,
+					expectedRoute.RouteServiceUrl,
+					expectedRoute.ModificationTag,
+					"",
+				)
+				expectedEndpoint.Source = "routing-api"
+				Expect(endpoint).To(Equal(expectedEndpoint))
 			}
 		})
 
@@ -453,19 +455,20 @@ var _ = Describe("RouteFetcher", func() {
 				Expect(registry.RegisterCallCount()).To(Equal(1))
 				uri, endpoint := registry.RegisterArgsForCall(0)
 				Expect(uri).To(Equal(route.Uri(eventRoute.Route)))
-				Expect(endpoint).To(Equal(
-					route.NewEndpoint(
-						eventRoute.LogGuid,
-						eventRoute.IP,
-						uint16(eventRoute.Port),
-						eventRoute.LogGuid,
-						"",
-						nil,
-						*eventRoute.TTL,
-						eventRoute.RouteServiceUrl,
-						eventRoute.ModificationTag,
-						"",
-					)))
+				expectedEndpoint := route.NewEndpoint(
+					eventRoute.LogGuid,
+					eventRoute.IP,
+					uint16(eventRoute.Port),
+					eventRoute.LogGuid,
+					"",
+					nil,
+					*eventRoute.TTL,
+					eventRoute.RouteServiceUrl,
+					eventRoute.ModificationTag,
+					"",
+				)
+				expectedEndpoint.Source = "routing-api"
+				Expect(endpoint).To(Equal(expectedEndpoint))
 			})
 		})
 
@@ -489,19 +492,20 @@ var _ = Describe("RouteFetcher", func() {
 				Expect(registry.UnregisterCallCount()).To(Equal(1))
 				uri, endpoint := registry.UnregisterArgsForCall(0)
 				Expect(uri).To(Equal(route.Uri(eventRoute.Route)))
-				Expect(endpoint).To(Equal(
-					route.NewEndpoint(
-						eventRoute.LogGuid,
-						eventRoute.IP,
-						uint16(eventRoute.Port),
-						eventRoute.LogGuid,
-						"",
-						nil,
-						*eventRoute.TTL,
-						eventRoute.RouteServiceUrl,
-						eventRoute.ModificationTag,
-						"",
-					)))
+				expectedEndpoint := route.NewEndpoint(
+					eventRoute.LogGuid,
+					eventRoute.IP,
+					uint16(eventRoute.Port),
+					eventRoute.LogGuid,
+					"",
+					nil,
+					*eventRoute.TTL,
+					eventRoute.RouteServiceUrl,
+					eventRoute.ModificationTag,
+					"",
+				)
+				expectedEndpoint.Source = "routing-api"
+				Expect(endpoint).To(Equal(expectedEndpoint))
 			})
 		})
 	})
@@ -0,0 +1,26 @@
+package router
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// acceptCounter counts the connections accepted by a listener.
+type acceptCounter struct {
+	net.Listener
+	accepted uint64
+}
+
+func (l *acceptCounter) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddUint64(&l.accepted, 1)
+	return conn, nil
+}
+
+// Accepted returns the number of connections accepted by the listener.
+func (l *acceptCounter) Accepted() uint64 {
+	return atomic.LoadUint64(&l.accepted)
+}
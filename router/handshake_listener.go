@@ -0,0 +1,146 @@
+package router
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/metrics"
+	"github.com/uber-go/zap"
+)
+
+const tlsHandshakeTimeout = 10 * time.Second
+
+var errListenerClosed = errors.New("router: listener closed")
+
+// handshakeListener is a TLS listener that completes the handshake of each
+// connection before returning it from Accept, so that the negotiated version
+// and cipher suite of successful handshakes, and the reason of failed ones,
+// can be reported. Connections are handshaken concurrently, so that a slow
+// client does not hold up the others.
+type handshakeListener struct {
+	net.Listener
+	config   *tls.Config
+	reporter metrics.TLSReporter
+	logger   logger.Logger
+
+	conns     chan net.Conn
+	errs      chan error
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newHandshakeListener(listener net.Listener, cfg *tls.Config, reporter metrics.TLSReporter, logger logger.Logger) *handshakeListener {
+	l := &handshakeListener{
+		Listener: listener,
+		config:   cfg,
+		reporter: reporter,
+		logger:   logger,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error),
+		closed:   make(chan struct{}),
+	}
+	go l.acceptLoop()
+	return l
+}
+
+func (l *handshakeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.closed:
+		return nil, errListenerClosed
+	}
+}
+
+func (l *handshakeListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return l.Listener.Close()
+}
+
+func (l *handshakeListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.errs <- err:
+			case <-l.closed:
+				return
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		go l.handshake(conn)
+	}
+}
+
+func (l *handshakeListener) handshake(conn net.Conn) {
+	tlsConn := tls.Server(conn, l.config)
+	tlsConn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		reason := handshakeFailureReason(err)
+		l.logger.Debug("tls-handshake-failed", zap.String("reason", reason), zap.Error(err))
+		l.reporter.CaptureTLSHandshakeFailure(reason)
+		tlsConn.Close()
+		return
+	}
+	tlsConn.SetDeadline(noDeadline)
+
+	state := tlsConn.ConnectionState()
+	l.reporter.CaptureTLSHandshake(tlsVersionName(state.Version), tls.CipherSuiteName(state.CipherSuite), state.DidResume)
+
+	select {
+	case l.conns <- tlsConn:
+	case <-l.closed:
+		tlsConn.Close()
+	}
+}
+
+// handshakeFailureReason classifies the error of a failed handshake.
+func handshakeFailureReason(err error) string {
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return "timeout"
+	}
+	if _, ok := err.(tls.RecordHeaderError); ok {
+		return "not_tls"
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return "eof"
+	}
+
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "remote error"):
+		return "remote_alert"
+	case strings.Contains(msg, "unsupported versions"), strings.Contains(msg, "protocol version"):
+		return "unsupported_version"
+	case strings.Contains(msg, "no cipher suite"):
+		return "no_shared_cipher"
+	case strings.Contains(msg, "certificate"):
+		return "client_certificate"
+	case strings.Contains(msg, "connection reset"), strings.HasSuffix(msg, "EOF"):
+		return "eof"
+	}
+	return "other"
+}
+
+// tlsVersionName returns the name of the version as accepted in
+// min_tls_version.
+func tlsVersionName(version uint16) string {
+	for name, v := range config.TLSVersions {
+		if v == version {
+			return name
+		}
+	}
+	return "unknown"
+}
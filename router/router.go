@@ -3,7 +3,9 @@ package router
 import (
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -19,16 +21,21 @@ import (
 	"time"
 
 	"code.cloudfoundry.org/gorouter/common"
+	"code.cloudfoundry.org/gorouter/common/connlimit"
 	"code.cloudfoundry.org/gorouter/common/health"
+	"code.cloudfoundry.org/gorouter/common/proxyprotocol"
+	"code.cloudfoundry.org/gorouter/common/reuseport"
 	"code.cloudfoundry.org/gorouter/common/schema"
 	"code.cloudfoundry.org/gorouter/config"
 	"code.cloudfoundry.org/gorouter/handlers"
+	"code.cloudfoundry.org/gorouter/handoff"
 	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/metrics"
 	"code.cloudfoundry.org/gorouter/metrics/monitor"
 	"code.cloudfoundry.org/gorouter/proxy"
+	"code.cloudfoundry.org/gorouter/proxy/tcp"
 	"code.cloudfoundry.org/gorouter/registry"
 	"code.cloudfoundry.org/gorouter/varz"
-	"github.com/armon/go-proxyproto"
 	"github.com/cloudfoundry/dropsonde"
 	"github.com/nats-io/nats"
 	"github.com/uber-go/zap"
@@ -45,21 +52,38 @@ var noDeadline = time.Time{}
 
 type Router struct {
 	config     *config.Config
+	reloadable *config.ReloadableConfig
 	proxy      proxy.Proxy
 	mbusClient *nats.Conn
 	registry   *registry.RouteRegistry
 	varz       varz.Varz
 	component  *common.VcapComponent
 
-	listener         net.Listener
-	tlsListener      net.Listener
+	listeners        []net.Listener
+	tlsListeners     []net.Listener
+	tcpListeners     []net.Listener
+	connLimiters     []*connlimit.Listener
+	acceptCounters   map[string]*acceptCounter
 	closeConnections bool
 	connLock         sync.Mutex
 	idleConns        map[net.Conn]struct{}
 	activeConns      map[net.Conn]struct{}
 	drainDone        chan struct{}
-	serveDone        chan struct{}
-	tlsServeDone     chan struct{}
+	serveDone        sync.WaitGroup
+	tlsServeDone     sync.WaitGroup
+	tcpServeDone     sync.WaitGroup
+	tlsConfig        atomic.Value
+	certLock         sync.Mutex
+	certificates     []tls.Certificate
+	certsByHostname  map[string]*tls.Certificate
+	acmeCertificates map[string]*tls.Certificate
+	ocspStapler      OCSPStapler
+	ticketKeys       [][32]byte
+	tlsReporter      metrics.TLSReporter
+	tlsConns         int
+	reloadSignals    chan os.Signal
+	drainRequests    chan struct{}
+	handOffs         chan struct{}
 	stopping         bool
 	stopLock         sync.Mutex
 	uptimeMonitor    *monitor.Uptime
@@ -70,11 +94,11 @@ type Router struct {
 }
 
 func NewRouter(logger logger.Logger, cfg *config.Config, p proxy.Proxy, mbusClient *nats.Conn, r *registry.RouteRegistry,
-	v varz.Varz, heartbeatOK *int32, logCounter *schema.LogCounter, errChan chan error) (*Router, error) {
+	v varz.Varz, heartbeatOK *int32, logCounter *schema.LogCounter, statusHandlers map[string]http.Handler, errChan chan error) (*Router, error) {
 
 	var host string
 	if cfg.Status.Port != 0 {
-		host = fmt.Sprintf("%s:%d", cfg.Status.Host, cfg.Status.Port)
+		host = net.JoinHostPort(cfg.Status.Host, strconv.Itoa(int(cfg.Status.Port)))
 	}
 
 	varz := &health.Varz{
@@ -107,22 +131,35 @@ func NewRouter(logger logger.Logger, cfg *config.Config, p proxy.Proxy, mbusClie
 	}
 
 	router := &Router{
-		config:       cfg,
-		proxy:        p,
-		mbusClient:   mbusClient,
-		registry:     r,
-		varz:         v,
-		component:    component,
-		serveDone:    make(chan struct{}),
-		tlsServeDone: make(chan struct{}),
-		idleConns:    make(map[net.Conn]struct{}),
-		activeConns:  make(map[net.Conn]struct{}),
-		logger:       logger,
-		errChan:      routerErrChan,
-		HeartbeatOK:  heartbeatOK,
-		stopping:     false,
+		config:         cfg,
+		reloadable:     config.NewReloadableConfig(cfg),
+		proxy:          p,
+		mbusClient:     mbusClient,
+		registry:       r,
+		varz:           v,
+		component:      component,
+		acceptCounters: make(map[string]*acceptCounter),
+		idleConns:      make(map[net.Conn]struct{}),
+		activeConns:    make(map[net.Conn]struct{}),
+		logger:         logger,
+		errChan:        routerErrChan,
+		HeartbeatOK:    heartbeatOK,
+		stopping:       false,
+
+		drainRequests: make(chan struct{}, 1),
+		handOffs:      make(chan struct{}, 1),
+	}
+	component.Handlers = map[string]http.Handler{
+		"/drain":        http.HandlerFunc(router.handleDrain),
+		"/health/live":  handlers.NewLiveness(),
+		"/health/ready": handlers.NewReadiness(heartbeatOK, readinessChecks(cfg.Readiness, mbusClient, r), logger),
+	}
+	for path, handler := range statusHandlers {
+		component.Handlers[path] = handler
 	}
 
+	router.reloadable.OnReload(router.reloadTLSConfig)
+
 	if err := router.component.Start(); err != nil {
 		return nil, err
 	}
@@ -140,6 +177,41 @@ func (h *gorouterHandler) ServeHTTP(res http.ResponseWriter, req *http.Request)
 	h.handler.ServeHTTP(res, req)
 }
 
+// readinessChecks returns the checks of the readiness endpoint that are
+// configured.
+func readinessChecks(cfg config.ReadinessConfig, mbusClient *nats.Conn, r *registry.RouteRegistry) map[string]handlers.ReadinessCheck {
+	checks := map[string]handlers.ReadinessCheck{}
+	if cfg.CheckNATS && mbusClient != nil {
+		checks["nats"] = func() error {
+			if !mbusClient.IsConnected() {
+				return errors.New("not connected")
+			}
+			return nil
+		}
+	}
+	if cfg.MinRoutes > 0 {
+		checks["routes"] = func() error {
+			if n := r.NumUris(); n < cfg.MinRoutes {
+				return fmt.Errorf("%d of %d routes", n, cfg.MinRoutes)
+			}
+			return nil
+		}
+	}
+	if cfg.MaxRouteTableAge > 0 {
+		checks["route_table"] = func() error {
+			updated := r.TimeOfLastUpdate()
+			if updated.IsZero() {
+				return errors.New("never updated")
+			}
+			if age := time.Since(updated); age > cfg.MaxRouteTableAge {
+				return fmt.Errorf("not updated for %s", age)
+			}
+			return nil
+		}
+	}
+	return checks
+}
+
 func (r *Router) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
 	r.registry.StartPruningCycle()
 
@@ -154,9 +226,11 @@ func (r *Router) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
 	handler := gorouterHandler{handler: dropsonde.InstrumentedHandler(r.proxy), logger: r.logger}
 
 	server := &http.Server{
-		Handler:     &handler,
-		ConnState:   r.HandleConnState,
-		IdleTimeout: 5 * time.Second,
+		Handler:           &handler,
+		ConnState:         r.HandleConnState,
+		IdleTimeout:       5 * time.Second,
+		ReadHeaderTimeout: r.config.ClientConnections.ReadHeaderTimeout,
+		MaxHeaderBytes:    r.config.ClientConnections.MaxHeaderBytes,
 	}
 
 	err := r.serveHTTP(server, r.errChan)
@@ -169,6 +243,15 @@ func (r *Router) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
 		r.errChan <- err
 		return err
 	}
+	err = r.serveTCP(r.errChan)
+	if err != nil {
+		r.errChan <- err
+		return err
+	}
+
+	if r.config.ConfigFile != "" {
+		r.handleReloadSignals()
+	}
 
 	atomic.StoreInt32(r.HeartbeatOK, 1)
 	// create pid file
@@ -205,15 +288,19 @@ func (r *Router) OnErrOrSignal(signals <-chan os.Signal, errChan chan error) {
 			r.logger.Error("Error occurred", zap.Error(err))
 			r.DrainAndStop()
 		}
+	case <-r.drainRequests:
+		go r.ignoreSignals(signals)
+		r.DrainAndStop()
+		r.logger.Info("gorouter.exited")
+	case <-r.handOffs:
+		go r.ignoreSignals(signals)
+		drainTimeout := r.reloadable.Get().DrainTimeout
+		r.logger.Info("gorouter-handing-off", zap.Float64("timeout_seconds", drainTimeout.Seconds()))
+		r.drainConnections(drainTimeout)
+		r.Stop()
+		r.logger.Info("gorouter.exited")
 	case sig := <-signals:
-		go func() {
-			for sig := range signals {
-				r.logger.Info(
-					"gorouter.signal.ignored",
-					zap.String("signal", sig.String()),
-				)
-			}
-		}()
+		go r.ignoreSignals(signals)
 		if sig == syscall.SIGUSR1 {
 			r.DrainAndStop()
 		} else {
@@ -223,9 +310,36 @@ func (r *Router) OnErrOrSignal(signals <-chan os.Signal, errChan chan error) {
 	}
 }
 
+func (r *Router) ignoreSignals(signals <-chan os.Signal) {
+	for sig := range signals {
+		r.logger.Info(
+			"gorouter.signal.ignored",
+			zap.String("signal", sig.String()),
+		)
+	}
+}
+
+// handleDrain serves the /drain endpoint of the status server. A POST drains
+// the router the same way SIGUSR1 does, after which the router exits.
+func (r *Router) handleDrain(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	select {
+	case r.drainRequests <- struct{}{}:
+		r.logger.Info("drain-requested")
+	default:
+		// a drain is already in progress
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
 func (r *Router) DrainAndStop() {
-	drainWait := r.config.DrainWait
-	drainTimeout := r.config.DrainTimeout
+	drainWait := r.reloadable.Get().DrainWait
+	drainTimeout := r.reloadable.Get().DrainTimeout
 	r.logger.Info(
 		"gorouter-draining",
 		zap.Float64("wait_seconds", drainWait.Seconds()),
@@ -240,79 +354,483 @@ func (r *Router) DrainAndStop() {
 func (r *Router) serveHTTPS(server *http.Server, errChan chan error) error {
 	if r.config.EnableSSL {
 
+		r.setCertificates(r.config.SSLCertificates, r.config.SSLCertificatesByHostname)
+
+		// the config is looked up per handshake so that certificates can be
+		// reloaded without restarting the listener
 		tlsConfig := &tls.Config{
-			Certificates: r.config.SSLCertificates,
-			CipherSuites: r.config.CipherSuites,
-			MinVersion:   tls.VersionTLS12,
+			GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+				return r.tlsConfig.Load().(*tlsConfigs).forServerName(hello.ServerName), nil
+			},
 		}
 
-		tlsConfig.BuildNameToCertificate()
-
-		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", r.config.SSLPort))
+		listeners, err := r.listen("https", r.config.SSLPort)
 		if err != nil {
 			r.logger.Fatal("tcp-listener-error", zap.Error(err))
 			return err
 		}
 
 		if r.config.EnablePROXY {
-			listener = &proxyproto.Listener{
-				Listener:           listener,
-				ProxyHeaderTimeout: proxyProtocolHeaderTimeout,
+			listeners = withProxyProtocol(listeners)
+		}
+		listeners = r.limitConnections(listeners)
+
+		for _, listener := range listeners {
+			if r.tlsReporter != nil {
+				listener = newHandshakeListener(listener, tlsConfig, r.tlsReporter, r.logger)
+			} else {
+				listener = tls.NewListener(listener, tlsConfig)
 			}
+			r.tlsListeners = append(r.tlsListeners, listener)
 		}
 
-		r.tlsListener = tls.NewListener(listener, tlsConfig)
+		r.logger.Info("tls-listener-started", zap.Object("address", r.tlsListeners[0].Addr()), zap.Int("listeners", len(r.tlsListeners)))
+
+		for _, listener := range r.tlsListeners {
+			r.tlsServeDone.Add(1)
+			go func(listener net.Listener) {
+				err := server.Serve(listener)
+				r.stopLock.Lock()
+				if !r.stopping {
+					errChan <- err
+				}
+				r.stopLock.Unlock()
+				r.tlsServeDone.Done()
+			}(listener)
+		}
+	}
+	return nil
+}
 
-		r.logger.Info("tls-listener-started", zap.Object("address", r.tlsListener.Addr()))
+// setCertificates serves the configured certificates, along with the
+// certificates obtained over ACME, on new TLS connections.
+func (r *Router) setCertificates(certificates []tls.Certificate, byHostname map[string]*tls.Certificate) {
+	r.certLock.Lock()
+	defer r.certLock.Unlock()
+	r.certificates = certificates
+	r.certsByHostname = byHostname
+	r.tlsConfig.Store(r.buildTLSConfig(certificates, byHostname, r.acmeCertificates))
+}
 
-		go func() {
-			err := server.Serve(r.tlsListener)
-			r.stopLock.Lock()
-			if !r.stopping {
-				errChan <- err
+// SetACMECertificates serves the certificates obtained over ACME for their
+// hostnames on new TLS connections. They take precedence over the names of
+// the configured certificates, but not over their hostnames.
+func (r *Router) SetACMECertificates(byHostname map[string]*tls.Certificate) {
+	r.certLock.Lock()
+	defer r.certLock.Unlock()
+	r.acmeCertificates = byHostname
+	r.rebuildTLSConfig()
+}
+
+// OCSPStapler staples OCSP responses to the certificates served by the
+// router.
+type OCSPStapler interface {
+	// Update is called with the served certificates whenever they change.
+	Update(certificates []*tls.Certificate)
+	// Staple returns the certificate with its OCSP response.
+	Staple(certificate *tls.Certificate) *tls.Certificate
+}
+
+// SetOCSPStapler staples the OCSP responses of the stapler to the
+// certificates served on new TLS connections.
+func (r *Router) SetOCSPStapler(stapler OCSPStapler) {
+	r.certLock.Lock()
+	defer r.certLock.Unlock()
+	r.ocspStapler = stapler
+	r.rebuildTLSConfig()
+}
+
+// SetSessionTicketKeys sets the keys of the session tickets of new TLS
+// connections. The first key encrypts tickets, and all keys decrypt them.
+func (r *Router) SetSessionTicketKeys(keys [][32]byte) {
+	r.certLock.Lock()
+	defer r.certLock.Unlock()
+	r.ticketKeys = keys
+	r.rebuildTLSConfig()
+}
+
+// rebuildTLSConfig rebuilds the config of the TLS listener once it has been
+// built, as the TLS listener builds it when it starts. It must be called with
+// certLock held.
+func (r *Router) rebuildTLSConfig() {
+	if r.tlsConfig.Load() != nil {
+		r.tlsConfig.Store(r.buildTLSConfig(r.certificates, r.certsByHostname, r.acmeCertificates))
+	}
+}
+
+// reloadTLSConfig rebuilds the config of the TLS listener with the cipher
+// suites and TLS versions of the reloaded config.
+func (r *Router) reloadTLSConfig(*config.Config) {
+	r.certLock.Lock()
+	defer r.certLock.Unlock()
+	r.rebuildTLSConfig()
+}
+
+func (r *Router) buildTLSConfig(certificates []tls.Certificate, byHostname, acmeByHostname map[string]*tls.Certificate) *tlsConfigs {
+	reloaded := r.reloadable.Get()
+	tlsConfig := &tls.Config{
+		Certificates: certificates,
+		CipherSuites: reloaded.CipherSuites,
+		MinVersion:   reloaded.MinTLSVersion,
+		MaxVersion:   reloaded.MaxTLSVersion,
+	}
+	if tlsConfig.MinVersion == 0 {
+		tlsConfig.MinVersion = tls.VersionTLS12
+	}
+
+	if r.config.ForwardedClientCert == config.FORWARD || r.config.ForwardedClientCert == config.SANITIZE_SET {
+		// client certificates are only requested when they are forwarded to
+		// backends, as browsers may prompt users to select a certificate
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		tlsConfig.ClientCAs = r.config.CAPool
+	}
+
+	if r.config.EnableHTTP2 {
+		// net/http serves HTTP/2 on connections that negotiate h2 via ALPN
+		tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+	}
+
+	tlsConfig.BuildNameToCertificate()
+	for hostname, certificate := range acmeByHostname {
+		tlsConfig.NameToCertificate[hostname] = certificate
+	}
+	for hostname, certificate := range byHostname {
+		tlsConfig.NameToCertificate[hostname] = certificate
+	}
+	tlsConfig.GetCertificate = getCertificate(tlsConfig.Certificates, tlsConfig.NameToCertificate)
+
+	if r.ocspStapler != nil {
+		r.ocspStapler.Update(servedCertificates(certificates, byHostname, acmeByHostname))
+		tlsConfig.GetCertificate = stapleCertificate(r.ocspStapler, tlsConfig.GetCertificate)
+		// without certificates, GetCertificate also selects the certificate of
+		// clients that send no server name
+		tlsConfig.Certificates = nil
+	}
+
+	if len(r.ticketKeys) > 0 {
+		tlsConfig.SetSessionTicketKeys(r.ticketKeys)
+	}
+
+	return newTLSConfigs(tlsConfig, reloaded.TLSDomains)
+}
+
+// tlsConfigs are the configs of the TLS listener: the config of the SNI
+// hostnames of router.tls_domains, and the default config.
+type tlsConfigs struct {
+	defaultConfig *tls.Config
+	byHostname    map[string]*tls.Config
+}
+
+// newTLSConfigs derives the config of each of the domains from the default
+// config, overriding its TLS versions and cipher suites.
+func newTLSConfigs(defaultConfig *tls.Config, domains []config.TLSDomainConfig) *tlsConfigs {
+	configs := &tlsConfigs{
+		defaultConfig: defaultConfig,
+		byHostname:    make(map[string]*tls.Config),
+	}
+	for _, domain := range domains {
+		domainConfig := defaultConfig.Clone()
+		domainConfig.CipherSuites = domain.CipherSuites
+		domainConfig.MinVersion = domain.MinTLSVersion
+		domainConfig.MaxVersion = domain.MaxTLSVersion
+		for _, hostname := range domain.Hostnames {
+			configs.byHostname[hostname] = domainConfig
+		}
+	}
+	return configs
+}
+
+// forServerName returns the config of the SNI hostname of the client. An
+// exact match is preferred over a wildcard match; the default config is used
+// when neither matches.
+func (c *tlsConfigs) forServerName(serverName string) *tls.Config {
+	if len(c.byHostname) == 0 {
+		return c.defaultConfig
+	}
+	hostname := strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if domainConfig, ok := c.byHostname[hostname]; ok {
+		return domainConfig
+	}
+	if i := strings.Index(hostname, "."); i > 0 {
+		if domainConfig, ok := c.byHostname["*"+hostname[i:]]; ok {
+			return domainConfig
+		}
+	}
+	return c.defaultConfig
+}
+
+// servedCertificates returns the configured certificates and the
+// certificates obtained over ACME.
+func servedCertificates(certificates []tls.Certificate, byHostname, acmeByHostname map[string]*tls.Certificate) []*tls.Certificate {
+	served := make([]*tls.Certificate, 0, len(certificates)+len(byHostname)+len(acmeByHostname))
+	for i := range certificates {
+		served = append(served, &certificates[i])
+	}
+	for _, certificate := range byHostname {
+		served = append(served, certificate)
+	}
+	for _, certificate := range acmeByHostname {
+		served = append(served, certificate)
+	}
+	return served
+}
+
+// stapleCertificate staples the OCSP response of the certificate selected by
+// getCertificate.
+func stapleCertificate(stapler OCSPStapler, getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		certificate, err := getCertificate(hello)
+		if err != nil {
+			return nil, err
+		}
+		return stapler.Staple(certificate), nil
+	}
+}
+
+// getCertificate selects a certificate by the SNI hostname of the client. An
+// exact match is preferred over a wildcard match; the first certificate is
+// used when neither matches.
+func getCertificate(certificates []tls.Certificate, byHostname map[string]*tls.Certificate) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		hostname := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+
+		if certificate, ok := byHostname[hostname]; ok {
+			return certificate, nil
+		}
+
+		if i := strings.Index(hostname, "."); i > 0 {
+			if certificate, ok := byHostname["*"+hostname[i:]]; ok {
+				return certificate, nil
 			}
-			r.stopLock.Unlock()
-			close(r.tlsServeDone)
-		}()
+		}
+
+		if len(certificates) == 0 {
+			return nil, errors.New("router: no certificates configured")
+		}
+		return &certificates[0], nil
+	}
+}
+
+// ReloadCertificates reads router.tls_pem and router.tls_certificates from the
+// config file and serves the certificates they contain on new TLS
+// connections. The current certificates are kept if the new ones cannot be
+// loaded.
+func (r *Router) ReloadCertificates() error {
+	if r.config.ConfigFile == "" {
+		return errors.New("router: config was not loaded from a file")
+	}
+
+	certificates, byHostname, err := config.LoadCertificatesFromFile(r.config.ConfigFile)
+	if err != nil {
+		r.logger.Error("tls-certificates-reload-failed", zap.Error(err))
+		return err
+	}
+
+	r.setCertificates(certificates, byHostname)
+	r.logger.Info("tls-certificates-reloaded", zap.Int("count", len(certificates)))
+	return nil
+}
+
+// SetReloadableConfig shares the settings reloaded by ReloadConfig with the
+// other components using them, e.g. the proxy. It must be called before Run.
+func (r *Router) SetReloadableConfig(reloadable *config.ReloadableConfig) {
+	r.reloadable = reloadable
+	r.reloadable.OnReload(r.reloadTLSConfig)
+}
+
+// ReloadConfig reads the config file and applies the settings that do not
+// require listening again, which are listed by config.ReloadableConfig. The
+// current settings are kept if the config file is not valid.
+func (r *Router) ReloadConfig() error {
+	if r.config.ConfigFile == "" {
+		return errors.New("router: config was not loaded from a file")
+	}
+
+	c, err := config.ReloadConfigFromFile(r.config.ConfigFile)
+	if err != nil {
+		r.logger.Error("config-reload-failed", zap.Error(err))
+		return err
 	}
+
+	r.reloadable.Set(c)
+	r.logger.Info("config-reloaded")
 	return nil
 }
 
+func (r *Router) handleReloadSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	r.reloadSignals = signals
+
+	go func() {
+		for range signals {
+			r.ReloadConfig()
+			if r.config.EnableSSL {
+				r.ReloadCertificates()
+			}
+		}
+	}()
+}
+
+// listenAddr returns the address of the listener on the port, on the listen
+// IP, or on all the IPv4 and IPv6 addresses of the host without one.
+func (r *Router) listenAddr(port uint16) string {
+	return net.JoinHostPort(r.config.ListenIP, strconv.Itoa(int(port)))
+}
+
+// listen opens the listeners of the port, or takes them over from the process
+// it upgrades. There is a single listener unless client_connections.listeners
+// is more than one, in which case that many listeners share the port with
+// SO_REUSEPORT, so that each is served by its own accept loop. The listeners
+// are named with the name and their index, under which their accepted
+// connections are counted and they are handed off.
+func (r *Router) listen(name string, port uint16) ([]net.Listener, error) {
+	n := r.config.ClientConnections.Listeners
+	if n <= 1 {
+		listener, err := handoff.Listen(name+"-0", r.listenAddr(port), net.Listen)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{r.countAccepts(name+"-0", listener)}, nil
+	}
+
+	listeners := make([]net.Listener, 0, n)
+	addr := r.listenAddr(port)
+	for i := 0; i < n; i++ {
+		listenerName := fmt.Sprintf("%s-%d", name, i)
+		listener, err := handoff.Listen(listenerName, addr, reuseport.Listen)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		// the listeners share the port picked for the first one
+		addr = listener.Addr().String()
+		listeners = append(listeners, r.countAccepts(listenerName, listener))
+	}
+	return listeners, nil
+}
+
+func (r *Router) countAccepts(name string, listener net.Listener) net.Listener {
+	counter := &acceptCounter{Listener: listener}
+	r.connLock.Lock()
+	r.acceptCounters[name] = counter
+	r.connLock.Unlock()
+	return counter
+}
+
+// AcceptedConnections returns the number of connections accepted by each
+// listener, by the name and index of the listener, such as http-0.
+func (r *Router) AcceptedConnections() map[string]uint64 {
+	r.connLock.Lock()
+	defer r.connLock.Unlock()
+
+	accepted := make(map[string]uint64, len(r.acceptCounters))
+	for name, counter := range r.acceptCounters {
+		accepted[name] = counter.Accepted()
+	}
+	return accepted
+}
+
+func withProxyProtocol(listeners []net.Listener) []net.Listener {
+	wrapped := make([]net.Listener, len(listeners))
+	for i, listener := range listeners {
+		wrapped[i] = &proxyprotocol.Listener{
+			Listener:      listener,
+			HeaderTimeout: proxyProtocolHeaderTimeout,
+		}
+	}
+	return wrapped
+}
+
 func (r *Router) serveHTTP(server *http.Server, errChan chan error) error {
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", r.config.Port))
+	listeners, err := r.listen("http", r.config.Port)
 	if err != nil {
 		r.logger.Fatal("tcp-listener-error", zap.Error(err))
 		return err
 	}
 
-	r.listener = listener
 	if r.config.EnablePROXY {
-		r.listener = &proxyproto.Listener{
-			Listener:           listener,
-			ProxyHeaderTimeout: proxyProtocolHeaderTimeout,
-		}
+		listeners = withProxyProtocol(listeners)
 	}
+	r.listeners = r.limitConnections(listeners)
 
-	r.logger.Info("tcp-listener-started", zap.Object("address", r.listener.Addr()))
+	r.logger.Info("tcp-listener-started", zap.Object("address", r.listeners[0].Addr()), zap.Int("listeners", len(r.listeners)))
 
-	go func() {
-		err := server.Serve(r.listener)
-		r.stopLock.Lock()
-		if !r.stopping {
-			errChan <- err
+	for _, listener := range r.listeners {
+		r.serveDone.Add(1)
+		go func(listener net.Listener) {
+			err := server.Serve(listener)
+			r.stopLock.Lock()
+			if !r.stopping {
+				errChan <- err
+			}
+			r.stopLock.Unlock()
+
+			r.serveDone.Done()
+		}(listener)
+	}
+	return nil
+}
+
+func (r *Router) serveTCP(errChan chan error) error {
+	tcpProxy := tcp.NewProxy(r.logger.Session("tcp-proxy"), r.registry, r.config.LoadBalance, r.config.Backends.ProxyProtocolVersion)
+
+	for _, port := range r.config.TCPRoutePorts {
+		listeners, err := r.listen("tcp-"+strconv.Itoa(int(port)), port)
+		if err != nil {
+			r.logger.Fatal("tcp-route-listener-error", zap.Error(err))
+			return err
 		}
-		r.stopLock.Unlock()
 
-		close(r.serveDone)
-	}()
+		if r.config.EnablePROXY {
+			listeners = withProxyProtocol(listeners)
+		}
+
+		r.tcpListeners = append(r.tcpListeners, listeners...)
+
+		r.logger.Info("tcp-route-listener-started", zap.Object("address", listeners[0].Addr()), zap.Int("listeners", len(listeners)))
+
+		for _, listener := range listeners {
+			r.tcpServeDone.Add(1)
+			go func(listener net.Listener, port uint16) {
+				err := tcpProxy.Serve(listener, port)
+				r.stopLock.Lock()
+				if !r.stopping {
+					errChan <- err
+				}
+				r.stopLock.Unlock()
+				r.tcpServeDone.Done()
+			}(listener, port)
+		}
+	}
 	return nil
 }
 
+// HandOff stops the router once the new process of an upgrade serves its
+// listeners. As the new process accepts the connections of the listeners and
+// answers the health checks, the router stops listening right away without
+// failing its health check, and exits once its connections are served or the
+// drain timeout.
+func (r *Router) HandOff() {
+	select {
+	case r.handOffs <- struct{}{}:
+	default:
+	}
+}
+
 func (r *Router) Drain(drainWait, drainTimeout time.Duration) error {
 	atomic.StoreInt32(r.HeartbeatOK, 0)
 
 	<-time.After(drainWait)
 
+	return r.drainConnections(drainTimeout)
+}
+
+// drainConnections stops listening and waits up to drainTimeout for the
+// active connections to be served.
+func (r *Router) drainConnections(drainTimeout time.Duration) error {
 	r.stopListening()
 
 	drained := make(chan struct{})
@@ -348,6 +866,11 @@ func (r *Router) Stop() {
 
 	r.stopListening()
 
+	if r.reloadSignals != nil {
+		signal.Stop(r.reloadSignals)
+		close(r.reloadSignals)
+	}
+
 	r.connLock.Lock()
 	r.closeIdleConns()
 	r.connLock.Unlock()
@@ -374,14 +897,21 @@ func (r *Router) stopListening() {
 	r.stopping = true
 	r.stopLock.Unlock()
 
-	r.listener.Close()
+	for _, listener := range r.listeners {
+		listener.Close()
+	}
 
-	if r.tlsListener != nil {
-		r.tlsListener.Close()
-		<-r.tlsServeDone
+	for _, listener := range r.tlsListeners {
+		listener.Close()
 	}
+	r.tlsServeDone.Wait()
 
-	<-r.serveDone
+	for _, listener := range r.tcpListeners {
+		listener.Close()
+	}
+	r.tcpServeDone.Wait()
+
+	r.serveDone.Wait()
 }
 
 func (r *Router) RegisterComponent() {
@@ -408,11 +938,60 @@ func (r *Router) ScheduleFlushApps() {
 	}()
 }
 
+// limitConnections limits the connections of each client IP of the listeners
+// of a port to client_connections.max_per_ip, when it is set. The connections
+// are counted across the listeners.
+func (r *Router) limitConnections(listeners []net.Listener) []net.Listener {
+	if r.config.ClientConnections.MaxPerIP == 0 {
+		return listeners
+	}
+	limiter := connlimit.NewListener(listeners[0], r.config.ClientConnections.MaxPerIP)
+	r.connLock.Lock()
+	r.connLimiters = append(r.connLimiters, limiter)
+	r.connLock.Unlock()
+
+	limited := []net.Listener{limiter}
+	for _, listener := range listeners[1:] {
+		limited = append(limited, limiter.Share(listener))
+	}
+	return limited
+}
+
+// RejectedConnections returns the number of client connections closed
+// because their client IP had client_connections.max_per_ip connections open.
+func (r *Router) RejectedConnections() uint64 {
+	r.connLock.Lock()
+	defer r.connLock.Unlock()
+
+	var rejected uint64
+	for _, limiter := range r.connLimiters {
+		rejected += limiter.Rejected()
+	}
+	return rejected
+}
+
+// SetTLSReporter reports the handshakes and the active connections of the TLS
+// listener to the reporter. It must be called before Run.
+func (r *Router) SetTLSReporter(reporter metrics.TLSReporter) {
+	r.tlsReporter = reporter
+}
+
 func (r *Router) HandleConnState(conn net.Conn, state http.ConnState) {
-	endpointTimeout := r.config.EndpointTimeout
+	endpointTimeout := r.reloadable.Get().EndpointTimeout
 
 	r.connLock.Lock()
 
+	if _, ok := conn.(*tls.Conn); ok && r.tlsReporter != nil {
+		switch state {
+		case http.StateNew:
+			r.tlsConns++
+			r.tlsReporter.CaptureTLSConnections(r.tlsConns)
+		case http.StateHijacked, http.StateClosed:
+			r.tlsConns--
+			r.tlsReporter.CaptureTLSConnections(r.tlsConns)
+		}
+	}
+
 	switch state {
 	case http.StateActive:
 		r.activeConns[conn] = struct{}{}
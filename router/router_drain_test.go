@@ -213,18 +213,18 @@ var _ = Describe("Router", func() {
 		logcounter := schema.NewLogCounter()
 		atomic.StoreInt32(&healthCheck, 0)
 
-		varz = vvarz.NewVarz(registry)
+		varz = vvarz.NewVarz(registry, nil)
 		sender := new(fakeMetrics.MetricSender)
 		batcher := new(fakeMetrics.MetricBatcher)
 		metricReporter := metrics.NewMetricsReporter(sender, batcher)
 		combinedReporter = metrics.NewCompositeReporter(varz, metricReporter)
 		config.HealthCheckUserAgent = "HTTP-Monitor/1.1"
 		p = proxy.NewProxy(logger, &access_log.NullAccessLogger{}, config, registry, combinedReporter,
-			&routeservice.RouteServiceConfig{}, &tls.Config{}, &healthCheck)
+			&routeservice.RouteServiceConfig{}, &tls.Config{}, &healthCheck, nil, nil, nil, nil, nil, nil)
 
 		errChan := make(chan error, 2)
 		var err error
-		rtr, err = router.NewRouter(logger, config, p, mbusClient, registry, varz, &healthCheck, logcounter, errChan)
+		rtr, err = router.NewRouter(logger, config, p, mbusClient, registry, varz, &healthCheck, logcounter, nil, errChan)
 		Expect(err).ToNot(HaveOccurred())
 
 		opts := &mbus.SubscriberOpts{
@@ -232,7 +232,7 @@ var _ = Describe("Router", func() {
 			MinimumRegisterIntervalInSeconds: int(config.StartResponseDelayInterval.Seconds()),
 			PruneThresholdInSeconds:          int(config.DropletStaleThreshold.Seconds()),
 		}
-		subscriber = ifrit.Background(mbus.NewSubscriber(logger.Session("subscriber"), mbusClient, registry, nil, opts))
+		subscriber = ifrit.Background(mbus.NewSubscriber(logger.Session("subscriber"), mbusClient, registry, nil, opts, new(fakes.FakeRouteRegistryReporter)))
 		<-subscriber.Ready()
 	})
 
@@ -468,11 +468,11 @@ var _ = Describe("Router", func() {
 				healthCheck = 0
 				config.HealthCheckUserAgent = "HTTP-Monitor/1.1"
 				proxy := proxy.NewProxy(logger, &access_log.NullAccessLogger{}, config, registry, combinedReporter,
-					&routeservice.RouteServiceConfig{}, &tls.Config{}, &healthCheck)
+					&routeservice.RouteServiceConfig{}, &tls.Config{}, &healthCheck, nil, nil, nil, nil, nil, nil)
 
 				errChan = make(chan error, 2)
 				var err error
-				rtr, err = router.NewRouter(logger, config, proxy, mbusClient, registry, varz, &healthCheck, logcounter, errChan)
+				rtr, err = router.NewRouter(logger, config, proxy, mbusClient, registry, varz, &healthCheck, logcounter, nil, errChan)
 				Expect(err).ToNot(HaveOccurred())
 				runRouter(rtr)
 			})
@@ -500,6 +500,41 @@ var _ = Describe("Router", func() {
 			})
 		})
 
+		Context("when a drain is requested from the status server", func() {
+			var drainURL string
+
+			BeforeEach(func() {
+				runRouter(rtr)
+				drainURL = fmt.Sprintf("http://%s:%d/drain", config.Ip, config.Status.Port)
+			})
+
+			It("it drains and stops the router", func() {
+				testRouterDrain(config, mbusClient, registry, func() {
+					defer GinkgoRecover()
+					req, err := http.NewRequest("POST", drainURL, nil)
+					Expect(err).ToNot(HaveOccurred())
+					req.SetBasicAuth(config.Status.User, config.Status.Pass)
+
+					resp, err := http.DefaultClient.Do(req)
+					Expect(err).ToNot(HaveOccurred())
+					resp.Body.Close()
+					Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+				})
+			})
+
+			It("only accepts POST requests", func() {
+				req, err := http.NewRequest("GET", drainURL, nil)
+				Expect(err).ToNot(HaveOccurred())
+				req.SetBasicAuth(config.Status.User, config.Status.Pass)
+
+				resp, err := http.DefaultClient.Do(req)
+				Expect(err).ToNot(HaveOccurred())
+				resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+				Expect(healthCheckWithEndpointReceives()).To(Equal(http.StatusOK))
+			})
+		})
+
 		Context("when a SIGTERM signal is sent", func() {
 			It("it drains and stops the router", func() {
 				signals, closeChannel := runRouter(rtr)
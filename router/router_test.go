@@ -17,10 +17,12 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"os"
+	"sync"
 	"syscall"
 	"time"
 
 	"code.cloudfoundry.org/gorouter/access_log"
+	"code.cloudfoundry.org/gorouter/common/proxyprotocol"
 	"code.cloudfoundry.org/gorouter/common/schema"
 	cfg "code.cloudfoundry.org/gorouter/config"
 	"code.cloudfoundry.org/gorouter/handlers"
@@ -41,11 +43,14 @@ import (
 	"github.com/tedsuo/ifrit"
 	"github.com/tedsuo/ifrit/grouper"
 	"github.com/tedsuo/ifrit/sigmon"
+	"golang.org/x/net/http2"
+	yaml "gopkg.in/yaml.v2"
 
 	fakeMetrics "code.cloudfoundry.org/gorouter/metrics/fakes"
 
 	"code.cloudfoundry.org/gorouter/logger"
 	testcommon "code.cloudfoundry.org/gorouter/test/common"
+	"code.cloudfoundry.org/routing-api/models"
 )
 
 var _ = Describe("Router", func() {
@@ -63,6 +68,8 @@ var _ = Describe("Router", func() {
 		logger     logger.Logger
 		statusPort uint16
 		natsPort   uint16
+
+		tlsReporter metrics.TLSReporter
 	)
 
 	BeforeEach(func() {
@@ -82,8 +89,8 @@ var _ = Describe("Router", func() {
 		mbusClient = natsRunner.MessageBus
 		logger = test_util.NewTestZapLogger("router-test")
 		registry = rregistry.NewRouteRegistry(logger, config, new(fakeMetrics.FakeRouteRegistryReporter))
-		varz = vvarz.NewVarz(registry)
-
+		varz = vvarz.NewVarz(registry, nil)
+		tlsReporter = nil
 	})
 
 	JustBeforeEach(func() {
@@ -94,13 +101,16 @@ var _ = Describe("Router", func() {
 
 		router, err = initializeRouter(config, registry, varz, mbusClient, logger)
 		Expect(err).ToNot(HaveOccurred())
+		if tlsReporter != nil {
+			router.SetTLSReporter(tlsReporter)
+		}
 
 		opts := &mbus.SubscriberOpts{
 			ID: "test",
 			MinimumRegisterIntervalInSeconds: int(config.StartResponseDelayInterval.Seconds()),
 			PruneThresholdInSeconds:          int(config.DropletStaleThreshold.Seconds()),
 		}
-		subscriber := mbus.NewSubscriber(logger.Session("subscriber"), mbusClient, registry, nil, opts)
+		subscriber := mbus.NewSubscriber(logger.Session("subscriber"), mbusClient, registry, nil, opts, new(fakeMetrics.FakeRouteRegistryReporter))
 
 		members := grouper.Members{
 			{Name: "subscriber", Runner: subscriber},
@@ -182,6 +192,39 @@ var _ = Describe("Router", func() {
 		})
 	})
 
+	Context("liveness and readiness", func() {
+		healthStatus := func(path string) int {
+			resp, err := http.Get(fmt.Sprintf("http://%s:%d%s", config.Ip, statusPort, path))
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			return resp.StatusCode
+		}
+
+		BeforeEach(func() {
+			config.Readiness.MinRoutes = 1
+		})
+
+		It("is live without credentials", func() {
+			Expect(healthStatus("/health/live")).To(Equal(http.StatusOK))
+		})
+
+		It("is ready once the routing table has the minimum routes", func() {
+			Expect(healthStatus("/health/ready")).To(Equal(http.StatusServiceUnavailable))
+
+			registry.Register("foo.vcap.me", route.NewEndpoint("", "10.0.0.1", 8080, "", "", nil, -1, "", models.ModificationTag{}, ""))
+			Expect(healthStatus("/health/ready")).To(Equal(http.StatusOK))
+		})
+
+		It("is not ready while NATS is disconnected", func() {
+			registry.Register("foo.vcap.me", route.NewEndpoint("", "10.0.0.1", 8080, "", "", nil, -1, "", models.ModificationTag{}, ""))
+			natsRunner.Stop()
+			natsRunner = nil
+
+			Eventually(func() int { return healthStatus("/health/ready") }).Should(Equal(http.StatusServiceUnavailable))
+			Expect(healthStatus("/health/live")).To(Equal(http.StatusOK))
+		})
+	})
+
 	It("registry contains last updated varz", func() {
 		app1 := test.NewGreetApp([]route.Uri{"test1.vcap.me"}, config.Port, mbusClient, nil)
 		app1.Listen()
@@ -528,6 +571,36 @@ var _ = Describe("Router", func() {
 			Expect(rr).To(Equal("192.168.0.1"))
 		})
 
+		It("sets the X-Forwarded-For header from version 2 headers", func() {
+			app := testcommon.NewTestApp([]route.Uri{"proxy.vcap.me"}, config.Port, mbusClient, nil, "")
+
+			rCh := make(chan string)
+			app.AddHandler("/", func(w http.ResponseWriter, r *http.Request) {
+				rCh <- r.Header.Get("X-Forwarded-For")
+			})
+			app.Listen()
+			Eventually(func() bool {
+				return appRegistered(registry, app)
+			}).Should(BeTrue())
+
+			host := fmt.Sprintf("proxy.vcap.me:%d", config.Port)
+			conn, err := net.DialTimeout("tcp", host, 10*time.Second)
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+
+			conn.Write(proxyprotocol.Header(2,
+				&net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 12345},
+				&net.TCPAddr{IP: net.ParseIP("192.168.0.2"), Port: 80},
+			))
+			fmt.Fprintf(conn, "GET / HTTP/1.0\r\n"+
+				"Host: %s\r\n"+
+				"\r\n", host)
+
+			var rr string
+			Eventually(rCh).Should(Receive(&rr))
+			Expect(rr).To(Equal("192.168.0.1"))
+		})
+
 		It("sets the x-Forwarded-Proto header to https", func() {
 			app := test.NewGreetApp([]route.Uri{"test.vcap.me"}, config.Port, mbusClient, nil)
 			app.Listen()
@@ -818,6 +891,77 @@ var _ = Describe("Router", func() {
 		})
 	})
 
+	Context("client connection limits", func() {
+		Context("when a client is slow to send the request headers", func() {
+			BeforeEach(func() {
+				config.ClientConnections.ReadHeaderTimeout = 100 * time.Millisecond
+			})
+
+			It("closes the connection", func() {
+				conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", config.Port), 10*time.Second)
+				Expect(err).ToNot(HaveOccurred())
+				defer conn.Close()
+
+				fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: app.vcap.me\r\n")
+
+				conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				_, err = ioutil.ReadAll(conn)
+				Expect(err).ToNot(HaveOccurred())
+			})
+		})
+
+		Context("when a client IP has the maximum number of connections open", func() {
+			BeforeEach(func() {
+				config.ClientConnections.MaxPerIP = 1
+			})
+
+			It("closes new connections of the client IP", func() {
+				host := fmt.Sprintf("127.0.0.1:%d", config.Port)
+				existingConn, err := net.DialTimeout("tcp", host, 10*time.Second)
+				Expect(err).ToNot(HaveOccurred())
+				defer existingConn.Close()
+				fmt.Fprintf(existingConn, "GET / HTTP/1.1\r\n")
+
+				Eventually(func() uint64 {
+					newConn, err := net.DialTimeout("tcp", host, 10*time.Second)
+					Expect(err).ToNot(HaveOccurred())
+					defer newConn.Close()
+					fmt.Fprintf(newConn, "GET / HTTP/1.1\r\nHost: app.vcap.me\r\n\r\n")
+
+					newConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+					ioutil.ReadAll(newConn)
+					return router.RejectedConnections()
+				}).Should(BeNumerically(">", 0))
+			})
+		})
+
+		Context("when the ports have several listeners", func() {
+			BeforeEach(func() {
+				config.ClientConnections.Listeners = 4
+			})
+
+			It("accepts the connections of the port on all of them", func() {
+				host := fmt.Sprintf("127.0.0.1:%d", config.Port)
+				Eventually(func() map[string]uint64 {
+					conn, err := net.DialTimeout("tcp", host, 10*time.Second)
+					Expect(err).ToNot(HaveOccurred())
+					defer conn.Close()
+					fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: app.vcap.me\r\n\r\n")
+
+					conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+					_, err = http.ReadResponse(bufio.NewReader(conn), nil)
+					Expect(err).ToNot(HaveOccurred())
+					return router.AcceptedConnections()
+				}).Should(SatisfyAll(
+					HaveKeyWithValue("http-0", BeNumerically(">", 0)),
+					HaveKeyWithValue("http-1", BeNumerically(">", 0)),
+					HaveKeyWithValue("http-2", BeNumerically(">", 0)),
+					HaveKeyWithValue("http-3", BeNumerically(">", 0)),
+				))
+			})
+		})
+	})
+
 	Context("serving https", func() {
 		BeforeEach(func() {
 			config.SSLCertificates = append(config.SSLCertificates, createCert("test.vcap.me"))
@@ -850,6 +994,88 @@ var _ = Describe("Router", func() {
 			defer resp.Body.Close()
 		})
 
+		It("does not negotiate HTTP/2 by default", func() {
+			app := test.NewGreetApp([]route.Uri{"test.vcap.me"}, config.Port, mbusClient, nil)
+			app.Listen()
+			Eventually(func() bool {
+				return appRegistered(registry, app)
+			}).Should(BeTrue())
+
+			uri := fmt.Sprintf("https://test.vcap.me:%d/", config.SSLPort)
+			req, _ := http.NewRequest("GET", uri, nil)
+			tr := &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			}
+			Expect(http2.ConfigureTransport(tr)).To(Succeed())
+
+			client := http.Client{Transport: tr}
+
+			resp, err := client.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.ProtoMajor).To(Equal(1))
+		})
+
+		Context("when HTTP/2 is enabled", func() {
+			BeforeEach(func() {
+				config.EnableHTTP2 = true
+				config.CipherSuites = []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}
+			})
+
+			It("serves HTTP/2 traffic", func() {
+				app := test.NewGreetApp([]route.Uri{"test.vcap.me"}, config.Port, mbusClient, nil)
+				app.Listen()
+				Eventually(func() bool {
+					return appRegistered(registry, app)
+				}).Should(BeTrue())
+
+				uri := fmt.Sprintf("https://test.vcap.me:%d/", config.SSLPort)
+				req, _ := http.NewRequest("GET", uri, nil)
+				tr := &http.Transport{
+					TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+				}
+				Expect(http2.ConfigureTransport(tr)).To(Succeed())
+
+				client := http.Client{Transport: tr}
+
+				resp, err := client.Do(req)
+				Expect(err).ToNot(HaveOccurred())
+				defer resp.Body.Close()
+
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+				Expect(resp.Proto).To(Equal("HTTP/2.0"))
+
+				bytes, err := ioutil.ReadAll(resp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(bytes).To(ContainSubstring("Hello"))
+			})
+
+			It("still serves HTTP/1.1 clients", func() {
+				app := test.NewGreetApp([]route.Uri{"test.vcap.me"}, config.Port, mbusClient, nil)
+				app.Listen()
+				Eventually(func() bool {
+					return appRegistered(registry, app)
+				}).Should(BeTrue())
+
+				uri := fmt.Sprintf("https://test.vcap.me:%d/", config.SSLPort)
+				req, _ := http.NewRequest("GET", uri, nil)
+				tr := &http.Transport{
+					TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+				}
+
+				client := http.Client{Transport: tr}
+
+				resp, err := client.Do(req)
+				Expect(err).ToNot(HaveOccurred())
+				defer resp.Body.Close()
+
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+				Expect(resp.ProtoMajor).To(Equal(1))
+			})
+		})
+
 		It("fails when the client uses an unsupported cipher suite", func() {
 			app := test.NewGreetApp([]route.Uri{"test.vcap.me"}, config.Port, mbusClient, nil)
 			app.Listen()
@@ -1011,9 +1237,470 @@ var _ = Describe("Router", func() {
 				Expect(certs[0].Subject.CommonName).To(Equal("default"))
 			})
 		})
+
+		Context("client certificates", func() {
+			requestsClientCertificate := func() bool {
+				requested := false
+				uri := fmt.Sprintf("127.0.0.1:%d", config.SSLPort)
+				conn, err := tls.Dial("tcp", uri, &tls.Config{
+					InsecureSkipVerify: true,
+					GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+						requested = true
+						return &tls.Certificate{}, nil
+					},
+				})
+				Expect(err).ToNot(HaveOccurred())
+				conn.Close()
+				return requested
+			}
+
+			It("does not request a client certificate by default", func() {
+				Expect(requestsClientCertificate()).To(BeFalse())
+			})
+
+			Context("when forwarded_client_cert is sanitize_set", func() {
+				BeforeEach(func() {
+					config.ForwardedClientCert = cfg.SANITIZE_SET
+				})
+
+				It("requests a client certificate", func() {
+					Expect(requestsClientCertificate()).To(BeTrue())
+				})
+			})
+
+			Context("when forwarded_client_cert is forward", func() {
+				BeforeEach(func() {
+					config.ForwardedClientCert = cfg.FORWARD
+				})
+
+				It("requests a client certificate", func() {
+					Expect(requestsClientCertificate()).To(BeTrue())
+				})
+			})
+		})
+
+		Context("when TLS versions are configured", func() {
+			negotiatedVersion := func(serverName string) (uint16, error) {
+				uri := fmt.Sprintf("127.0.0.1:%d", config.SSLPort)
+				conn, err := tls.Dial("tcp", uri, &tls.Config{
+					InsecureSkipVerify: true,
+					ServerName:         serverName,
+					CipherSuites:       config.CipherSuites,
+				})
+				if err != nil {
+					return 0, err
+				}
+				defer conn.Close()
+				return conn.ConnectionState().Version, nil
+			}
+
+			BeforeEach(func() {
+				config.CipherSuites = []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}
+				config.MaxTLSVersion = tls.VersionTLS12
+				config.TLSDomains = []cfg.TLSDomainConfig{
+					{
+						Hostnames:     []string{"*.modern.vcap.me"},
+						CipherSuites:  config.CipherSuites,
+						MinTLSVersion: tls.VersionTLS13,
+					},
+				}
+			})
+
+			It("negotiates a version up to the maximum TLS version", func() {
+				version, err := negotiatedVersion("test.vcap.me")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(version).To(Equal(uint16(tls.VersionTLS12)))
+			})
+
+			It("uses the TLS versions of the domain of the SNI hostname", func() {
+				version, err := negotiatedVersion("app.modern.vcap.me")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(version).To(Equal(uint16(tls.VersionTLS13)))
+
+				uri := fmt.Sprintf("127.0.0.1:%d", config.SSLPort)
+				_, err = tls.Dial("tcp", uri, &tls.Config{
+					InsecureSkipVerify: true,
+					ServerName:         "app.modern.vcap.me",
+					MaxVersion:         tls.VersionTLS12,
+				})
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("when certificates are configured for hostnames", func() {
+			peerCommonName := func(serverName string) string {
+				uri := fmt.Sprintf("127.0.0.1:%d", config.SSLPort)
+				conn, err := tls.Dial("tcp", uri, &tls.Config{
+					InsecureSkipVerify: true,
+					ServerName:         serverName,
+				})
+				Expect(err).ToNot(HaveOccurred())
+				defer conn.Close()
+
+				certs := conn.ConnectionState().PeerCertificates
+				Expect(certs).To(HaveLen(1))
+				return certs[0].Subject.CommonName
+			}
+
+			BeforeEach(func() {
+				wildcardCert := createCert("wildcard")
+				pinnedCert := createCert("pinned")
+				config.SSLCertificates = append(config.SSLCertificates, wildcardCert, pinnedCert)
+				config.SSLCertificatesByHostname = map[string]*tls.Certificate{
+					"*.vcap.me":        &wildcardCert,
+					"pinned.vcap.me":   &pinnedCert,
+					"*.pinned.vcap.me": &pinnedCert,
+				}
+			})
+
+			It("serves the certificate for a matching hostname", func() {
+				Expect(peerCommonName("pinned.vcap.me")).To(Equal("pinned"))
+				Expect(peerCommonName("PINNED.vcap.me")).To(Equal("pinned"))
+			})
+
+			It("serves the certificate for a matching wildcard hostname", func() {
+				Expect(peerCommonName("other.vcap.me")).To(Equal("wildcard"))
+				Expect(peerCommonName("app.pinned.vcap.me")).To(Equal("pinned"))
+			})
+
+			It("prefers a certificate with an exact name over a wildcard hostname", func() {
+				Expect(peerCommonName("test.vcap.me")).To(Equal("test.vcap.me"))
+			})
+
+			It("serves the default certificate when no hostname matches", func() {
+				Expect(peerCommonName("a.b.vcap.me")).To(Equal("default"))
+				Expect(peerCommonName("not-here.com")).To(Equal("default"))
+			})
+
+			It("serves certificates obtained over ACME for their hostnames", func() {
+				acmeCert := createCert("acme")
+				router.SetACMECertificates(map[string]*tls.Certificate{
+					"acme.vcap.me":   &acmeCert,
+					"pinned.vcap.me": &acmeCert,
+				})
+
+				Expect(peerCommonName("acme.vcap.me")).To(Equal("acme"))
+				Expect(peerCommonName("pinned.vcap.me")).To(Equal("pinned"))
+				Expect(peerCommonName("other.vcap.me")).To(Equal("wildcard"))
+			})
+		})
+
+		Context("when the certificates are reloaded", func() {
+			var configFile string
+
+			writeConfig := func(cname string) {
+				keyPEM, certPEM := test_util.CreateKeyPair(cname)
+				tlsPEMYML, err := yaml.Marshal([]string{string(certPEM) + string(keyPEM)})
+				Expect(err).ToNot(HaveOccurred())
+				err = ioutil.WriteFile(configFile, []byte(fmt.Sprintf("tls_pem:\n%s", tlsPEMYML)), 0644)
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			peerCommonName := func() string {
+				uri := fmt.Sprintf("127.0.0.1:%d", config.SSLPort)
+				conn, err := tls.Dial("tcp", uri, &tls.Config{InsecureSkipVerify: true})
+				Expect(err).ToNot(HaveOccurred())
+				defer conn.Close()
+
+				certs := conn.ConnectionState().PeerCertificates
+				Expect(certs).To(HaveLen(1))
+				return certs[0].Subject.CommonName
+			}
+
+			BeforeEach(func() {
+				f, err := ioutil.TempFile("", "gorouter-test-config-")
+				Expect(err).ToNot(HaveOccurred())
+				f.Close()
+				configFile = f.Name()
+				config.ConfigFile = configFile
+			})
+
+			AfterEach(func() {
+				os.Remove(configFile)
+			})
+
+			It("serves the new certificates", func() {
+				Expect(peerCommonName()).To(Equal("default"))
+
+				writeConfig("reloaded")
+				Expect(router.ReloadCertificates()).To(Succeed())
+
+				Expect(peerCommonName()).To(Equal("reloaded"))
+			})
+
+			It("keeps the current certificates if the new ones are invalid", func() {
+				err := ioutil.WriteFile(configFile, []byte("tls_pem: [\"invalid\"]\n"), 0644)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(router.ReloadCertificates()).ToNot(Succeed())
+				Expect(logger).To(gbytes.Say("tls-certificates-reload-failed"))
+
+				Expect(peerCommonName()).To(Equal("default"))
+			})
+		})
+
+		Context("when the config is reloaded", func() {
+			var configFile string
+
+			writeConfig := func(cipherSuites string, settings string) {
+				keyPEM, certPEM := test_util.CreateKeyPair("reloaded")
+				tlsPEMYML, err := yaml.Marshal([]string{string(certPEM) + string(keyPEM)})
+				Expect(err).ToNot(HaveOccurred())
+				contents := fmt.Sprintf("enable_ssl: true\ncipher_suites: %s\n%stls_pem:\n%s", cipherSuites, settings, tlsPEMYML)
+				err = ioutil.WriteFile(configFile, []byte(contents), 0644)
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			negotiatedCipherSuite := func(serverName string) uint16 {
+				uri := fmt.Sprintf("127.0.0.1:%d", config.SSLPort)
+				conn, err := tls.Dial("tcp", uri, &tls.Config{
+					InsecureSkipVerify: true,
+					ServerName:         serverName,
+					MaxVersion:         tls.VersionTLS12,
+					CipherSuites:       []uint16{tls.TLS_RSA_WITH_AES_256_CBC_SHA, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384},
+				})
+				Expect(err).ToNot(HaveOccurred())
+				defer conn.Close()
+				return conn.ConnectionState().CipherSuite
+			}
+
+			BeforeEach(func() {
+				f, err := ioutil.TempFile("", "gorouter-test-config-")
+				Expect(err).ToNot(HaveOccurred())
+				f.Close()
+				configFile = f.Name()
+				config.ConfigFile = configFile
+			})
+
+			AfterEach(func() {
+				os.Remove(configFile)
+			})
+
+			It("serves new connections with the new cipher suites", func() {
+				Expect(negotiatedCipherSuite("test.vcap.me")).To(Equal(tls.TLS_RSA_WITH_AES_256_CBC_SHA))
+
+				writeConfig("TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", "")
+				Expect(router.ReloadConfig()).To(Succeed())
+				Expect(logger).To(gbytes.Say("config-reloaded"))
+
+				Expect(negotiatedCipherSuite("test.vcap.me")).To(Equal(tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384))
+			})
+
+			Context("when SNI hostnames inherit the cipher suites", func() {
+				BeforeEach(func() {
+					config.TLSDomains = []cfg.TLSDomainConfig{
+						{
+							Hostnames:    []string{"inherit.vcap.me"},
+							CipherSuites: config.CipherSuites,
+						},
+					}
+				})
+
+				It("serves new connections to them with the new cipher suites", func() {
+					Expect(negotiatedCipherSuite("inherit.vcap.me")).To(Equal(tls.TLS_RSA_WITH_AES_256_CBC_SHA))
+
+					writeConfig("TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", "tls_domains:\n- hostnames: [inherit.vcap.me]\n")
+					Expect(router.ReloadConfig()).To(Succeed())
+					Expect(logger).To(gbytes.Say("config-reloaded"))
+
+					Expect(negotiatedCipherSuite("inherit.vcap.me")).To(Equal(tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384))
+				})
+			})
+
+			It("keeps the current settings if the config is invalid", func() {
+				writeConfig("NOT-A-CIPHER", "")
+
+				Expect(router.ReloadConfig()).ToNot(Succeed())
+				Expect(logger).To(gbytes.Say("config-reload-failed"))
+
+				Expect(negotiatedCipherSuite("test.vcap.me")).To(Equal(tls.TLS_RSA_WITH_AES_256_CBC_SHA))
+			})
+		})
+
+		Context("when an OCSP stapler is set", func() {
+			var stapler *fakeOCSPStapler
+
+			JustBeforeEach(func() {
+				stapler = &fakeOCSPStapler{}
+				router.SetOCSPStapler(stapler)
+			})
+
+			It("staples the OCSP responses of the served certificates", func() {
+				Expect(stapler.Updated()).ToNot(BeEmpty())
+
+				for _, serverName := range []string{"test.vcap.me", ""} {
+					uri := fmt.Sprintf("127.0.0.1:%d", config.SSLPort)
+					conn, err := tls.Dial("tcp", uri, &tls.Config{
+						InsecureSkipVerify: true,
+						ServerName:         serverName,
+					})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(conn.OCSPResponse()).To(Equal([]byte("ocsp-response")))
+					conn.Close()
+				}
+			})
+		})
+
+		Context("when a TLS reporter is set", func() {
+			var reporter *fakeTLSReporter
+
+			BeforeEach(func() {
+				reporter = &fakeTLSReporter{failures: map[string]int{}}
+				tlsReporter = reporter
+				config.CipherSuites = []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}
+			})
+
+			It("reports the negotiated version and cipher suite of handshakes", func() {
+				uri := fmt.Sprintf("127.0.0.1:%d", config.SSLPort)
+				conn, err := tls.Dial("tcp", uri, &tls.Config{
+					InsecureSkipVerify: true,
+					MaxVersion:         tls.VersionTLS12,
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				Eventually(reporter.Handshakes).Should(Equal([]string{"TLSv1.2 TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}))
+				conn.Close()
+			})
+
+			It("reports the active TLS connections", func() {
+				uri := fmt.Sprintf("127.0.0.1:%d", config.SSLPort)
+				conn, err := tls.Dial("tcp", uri, &tls.Config{InsecureSkipVerify: true})
+				Expect(err).ToNot(HaveOccurred())
+				Eventually(reporter.Connections).Should(Equal(1))
+
+				conn.Close()
+				Eventually(reporter.Connections).Should(Equal(0))
+			})
+
+			It("reports failed handshakes by reason", func() {
+				uri := fmt.Sprintf("127.0.0.1:%d", config.SSLPort)
+				_, err := tls.Dial("tcp", uri, &tls.Config{
+					InsecureSkipVerify: true,
+					MinVersion:         tls.VersionTLS10,
+					MaxVersion:         tls.VersionTLS11,
+				})
+				Expect(err).To(HaveOccurred())
+				Eventually(func() int { return reporter.Failures("unsupported_version") }).Should(Equal(1))
+
+				conn, err := net.Dial("tcp", uri)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+				Expect(err).ToNot(HaveOccurred())
+				Eventually(func() int { return reporter.Failures("not_tls") }).Should(Equal(1))
+				conn.Close()
+			})
+		})
+
+		Context("when session ticket keys are set", func() {
+			var keys [][32]byte
+
+			resumes := func(sessionCache tls.ClientSessionCache) bool {
+				uri := fmt.Sprintf("127.0.0.1:%d", config.SSLPort)
+				conn, err := tls.Dial("tcp", uri, &tls.Config{
+					InsecureSkipVerify: true,
+					MaxVersion:         tls.VersionTLS12,
+					ClientSessionCache: sessionCache,
+				})
+				Expect(err).ToNot(HaveOccurred())
+				defer conn.Close()
+				return conn.ConnectionState().DidResume
+			}
+
+			JustBeforeEach(func() {
+				keys = make([][32]byte, 2)
+				for i := range keys {
+					_, err := rand.Read(keys[i][:])
+					Expect(err).ToNot(HaveOccurred())
+				}
+				router.SetSessionTicketKeys(keys[:1])
+			})
+
+			It("resumes sessions whose tickets are encrypted with one of the keys", func() {
+				sessionCache := tls.NewLRUClientSessionCache(1)
+				Expect(resumes(sessionCache)).To(BeFalse())
+				Expect(resumes(sessionCache)).To(BeTrue())
+
+				router.SetSessionTicketKeys([][32]byte{keys[1], keys[0]})
+				Expect(resumes(sessionCache)).To(BeTrue())
+			})
+
+			It("does not resume sessions after the keys are rotated out", func() {
+				sessionCache := tls.NewLRUClientSessionCache(1)
+				Expect(resumes(sessionCache)).To(BeFalse())
+
+				router.SetSessionTicketKeys(keys[1:])
+				Expect(resumes(sessionCache)).To(BeFalse())
+			})
+		})
 	})
 })
 
+type fakeTLSReporter struct {
+	lock        sync.Mutex
+	handshakes  []string
+	failures    map[string]int
+	connections int
+}
+
+func (r *fakeTLSReporter) CaptureTLSHandshake(version, cipherSuite string, resumed bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.handshakes = append(r.handshakes, version+" "+cipherSuite)
+}
+
+func (r *fakeTLSReporter) CaptureTLSHandshakeFailure(reason string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.failures[reason]++
+}
+
+func (r *fakeTLSReporter) CaptureTLSConnections(active int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.connections = active
+}
+
+func (r *fakeTLSReporter) Handshakes() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.handshakes
+}
+
+func (r *fakeTLSReporter) Failures(reason string) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.failures[reason]
+}
+
+func (r *fakeTLSReporter) Connections() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.connections
+}
+
+type fakeOCSPStapler struct {
+	lock    sync.Mutex
+	updated []*tls.Certificate
+}
+
+func (s *fakeOCSPStapler) Update(certificates []*tls.Certificate) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.updated = certificates
+}
+
+func (s *fakeOCSPStapler) Updated() []*tls.Certificate {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.updated
+}
+
+func (s *fakeOCSPStapler) Staple(certificate *tls.Certificate) *tls.Certificate {
+	stapled := *certificate
+	stapled.OCSPStaple = []byte("ocsp-response")
+	return &stapled
+}
+
 func createCert(cname string) tls.Certificate {
 	// generate a random serial number (a real cert authority would have some logic behind this)
 	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
@@ -1059,12 +1746,12 @@ func initializeRouter(config *cfg.Config, registry *rregistry.RouteRegistry, var
 	combinedReporter := metrics.NewCompositeReporter(varz, metricReporter)
 
 	p := proxy.NewProxy(logger, &access_log.NullAccessLogger{}, config, registry, combinedReporter,
-		&routeservice.RouteServiceConfig{}, &tls.Config{}, nil)
+		&routeservice.RouteServiceConfig{}, &tls.Config{}, nil, nil, nil, nil, nil, nil, nil)
 
 	var healthCheck int32
 	healthCheck = 0
 	logcounter := schema.NewLogCounter()
-	return NewRouter(logger, config, p, mbusClient, registry, varz, &healthCheck, logcounter, nil)
+	return NewRouter(logger, config, p, mbusClient, registry, varz, &healthCheck, logcounter, nil, nil)
 }
 
 func readVarz(v vvarz.Varz) map[string]interface{} {
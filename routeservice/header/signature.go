@@ -12,6 +12,9 @@ import (
 type Signature struct {
 	ForwardedUrl  string    `json:"forwarded_url"`
 	RequestedTime time.Time `json:"requested_time"`
+	// Hop is the position in the chain of route services of the route
+	// service the request was sent to.
+	Hop int `json:"hop,omitempty"`
 }
 
 type Metadata struct {
@@ -68,8 +68,15 @@ func (rs *RouteServiceConfig) RouteServiceRecommendHttps() bool {
 }
 
 func (rs *RouteServiceConfig) Request(rsUrl, forwardedUrl string) (RouteServiceRequest, error) {
+	return rs.HopRequest(rsUrl, forwardedUrl, 0)
+}
+
+// HopRequest builds the request to the route service at position hop in the
+// chain of route services of a route. The hop is signed with the forwarded
+// URL, so that route services cannot skip the route services after them.
+func (rs *RouteServiceConfig) HopRequest(rsUrl, forwardedUrl string, hop int) (RouteServiceRequest, error) {
 	var routeServiceArgs RouteServiceRequest
-	sig, metadata, err := rs.generateSignatureAndMetadata(forwardedUrl)
+	sig, metadata, err := rs.generateSignatureAndMetadata(forwardedUrl, hop)
 	if err != nil {
 		return routeServiceArgs, err
 	}
@@ -89,6 +96,14 @@ func (rs *RouteServiceConfig) Request(rsUrl, forwardedUrl string) (RouteServiceR
 }
 
 func (rs *RouteServiceConfig) ValidateSignature(headers *http.Header, requestUrl string) error {
+	_, err := rs.ValidateHopSignature(headers, requestUrl)
+	return err
+}
+
+// ValidateHopSignature validates the signature of a request returning from a
+// route service, and returns the position of that route service in the chain
+// of route services of the route.
+func (rs *RouteServiceConfig) ValidateHopSignature(headers *http.Header, requestUrl string) (int, error) {
 	metadataHeader := headers.Get(RouteServiceMetadata)
 	signatureHeader := headers.Get(RouteServiceSignature)
 
@@ -96,7 +111,7 @@ func (rs *RouteServiceConfig) ValidateSignature(headers *http.Header, requestUrl
 	if err != nil {
 		if rs.cryptoPrev == nil {
 			rs.logger.Error("proxy-route-service-current-key", zap.Error(err))
-			return err
+			return 0, err
 		}
 
 		rs.logger.Debug("proxy-route-service-current-key", zap.String("message", "Decrypt-only secret used to validate route service signature header"))
@@ -105,19 +120,23 @@ func (rs *RouteServiceConfig) ValidateSignature(headers *http.Header, requestUrl
 
 		if err != nil {
 			rs.logger.Error("proxy-route-service-previous-key", zap.Error(err))
-			return err
+			return 0, err
 		}
 	}
 
 	err = rs.validateSignatureTimeout(signature)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return rs.validateForwardedURL(signature, requestUrl)
+	err = rs.validateForwardedURL(signature, requestUrl)
+	if err != nil {
+		return 0, err
+	}
+	return signature.Hop, nil
 }
 
-func (rs *RouteServiceConfig) generateSignatureAndMetadata(forwardedUrlRaw string) (string, string, error) {
+func (rs *RouteServiceConfig) generateSignatureAndMetadata(forwardedUrlRaw string, hop int) (string, string, error) {
 	decodedURL, err := url.QueryUnescape(forwardedUrlRaw)
 	if err != nil {
 		rs.logger.Error("proxy-route-service-invalidForwardedURL", zap.Error(err))
@@ -126,6 +145,7 @@ func (rs *RouteServiceConfig) generateSignatureAndMetadata(forwardedUrlRaw strin
 	signature := &header.Signature{
 		RequestedTime: time.Now(),
 		ForwardedUrl:  decodedURL,
+		Hop:           hop,
 	}
 
 	signatureHeader, metadataHeader, err := header.BuildSignatureAndMetadata(rs.crypto, signature)
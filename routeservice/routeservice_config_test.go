@@ -115,6 +115,33 @@ var _ = Describe("Route Service Config", func() {
 		})
 	})
 
+	Describe("HopRequest", func() {
+		It("signs the hop with the forwarded URL", func() {
+			args, err := config.HopRequest("https://example.com", "https://forwarded.example.com", 2)
+			Expect(err).NotTo(HaveOccurred())
+
+			signature, err := header.SignatureFromHeaders(args.Signature, args.Metadata, crypto)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(signature.Hop).To(Equal(2))
+
+			headers := http.Header{}
+			headers.Set(routeservice.RouteServiceSignature, args.Signature)
+			headers.Set(routeservice.RouteServiceMetadata, args.Metadata)
+			hop, err := config.ValidateHopSignature(&headers, "https://forwarded.example.com")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hop).To(Equal(2))
+		})
+
+		It("signs requests to the first route service as hop 0", func() {
+			args, err := config.Request("https://example.com", "https://forwarded.example.com")
+			Expect(err).NotTo(HaveOccurred())
+
+			signature, err := header.SignatureFromHeaders(args.Signature, args.Metadata, crypto)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(signature.Hop).To(BeZero())
+		})
+	})
+
 	Describe("ValidateSignature", func() {
 		var (
 			signatureHeader string
@@ -267,6 +294,19 @@ var _ = Describe("Route Service Config", func() {
 					Expect(err).NotTo(HaveOccurred())
 				})
 
+				Context("when the previous keys are a keyring", func() {
+					BeforeEach(func() {
+						older, err := secure.NewAesGCM([]byte("older-key-123456"))
+						Expect(err).ToNot(HaveOccurred())
+						config = routeservice.NewRouteServiceConfig(logger, true, 1*time.Hour, crypto, secure.Keyring{older, cryptoPrev}, recommendHttps)
+					})
+
+					It("validates the signature with any of the previous keys", func() {
+						err := config.ValidateSignature(headers, requestUrl)
+						Expect(err).NotTo(HaveOccurred())
+					})
+				})
+
 				Context("when a request has an expired Route service signature header", func() {
 					BeforeEach(func() {
 						signature = &header.Signature{
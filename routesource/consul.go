@@ -0,0 +1,202 @@
+package routesource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/routing-api/models"
+	"github.com/uber-go/zap"
+)
+
+const (
+	// ConsulTagPrefix marks the tags of Consul services that are routed to.
+	// A service tagged gorouter:app.example.com is registered for
+	// app.example.com.
+	ConsulTagPrefix = "gorouter:"
+
+	// ConsulRetryInterval is how long to wait before watching the catalog
+	// again after a failed request.
+	ConsulRetryInterval = 5 * time.Second
+
+	consulWaitTime = 5 * time.Minute
+)
+
+// Consul is a RouteSource of HTTP routes for the services of a Consul
+// catalog tagged with ConsulTagPrefix. It watches the catalog with blocking
+// queries, so changes are delivered as soon as Consul sees them.
+type Consul struct {
+	logger logger.Logger
+	config config.ConsulConfig
+	client *http.Client
+	clock  clock.Clock
+
+	// only accessed by the goroutine watching the catalog
+	routes map[string]Route
+}
+
+type consulServiceInstance struct {
+	Address        string
+	ServiceID      string
+	ServiceName    string
+	ServiceAddress string
+	ServicePort    int
+	ServiceTags    []string
+}
+
+func NewConsul(logger logger.Logger, cfg config.ConsulConfig, clock clock.Clock) *Consul {
+	return &Consul{
+		logger: logger,
+		config: cfg,
+		client: &http.Client{Timeout: consulWaitTime + 30*time.Second},
+		clock:  clock,
+	}
+}
+
+// Snapshot returns a route for each tag with ConsulTagPrefix of each
+// instance of the services in the catalog.
+func (c *Consul) Snapshot() ([]Route, error) {
+	var tagsByService map[string][]string
+	_, err := c.get(context.Background(), "/v1/catalog/services", url.Values{}, &tagsByService)
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []Route
+	for service, tags := range tagsByService {
+		if !hasRouteTag(tags) {
+			continue
+		}
+
+		var instances []consulServiceInstance
+		_, err := c.get(context.Background(), "/v1/catalog/service/"+url.PathEscape(service), url.Values{}, &instances)
+		if err != nil {
+			return nil, err
+		}
+		for _, instance := range instances {
+			routes = append(routes, instance.routes()...)
+		}
+	}
+	return routes, nil
+}
+
+// Subscribe watches the catalog until stop is closed, and delivers the
+// changes to its routes each time the catalog changes.
+func (c *Consul) Subscribe(events chan<- Event, stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	go func() {
+		index := ""
+		for {
+			newIndex, err := c.waitForChange(ctx, index)
+			if err == nil && newIndex != index {
+				var snapshot []Route
+				snapshot, err = c.Snapshot()
+				if err == nil {
+					index = newIndex
+					c.routes = sendChanges(events, stop, c.routes, snapshot)
+				}
+			}
+			if err == nil {
+				continue
+			}
+
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			c.logger.Error("failed-to-watch-consul-catalog", zap.Error(err))
+			select {
+			case <-c.clock.After(ConsulRetryInterval):
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// waitForChange blocks until the catalog index is past index, and returns
+// the new index. It returns immediately for an empty index.
+func (c *Consul) waitForChange(ctx context.Context, index string) (string, error) {
+	query := url.Values{}
+	if index != "" {
+		query.Set("index", index)
+		query.Set("wait", fmt.Sprintf("%.0fs", consulWaitTime.Seconds()))
+	}
+
+	var tagsByService map[string][]string
+	return c.get(ctx, "/v1/catalog/services", query, &tagsByService)
+}
+
+// get decodes the response of the Consul API at path into v and returns the
+// catalog index of the response.
+func (c *Consul) get(ctx context.Context, path string, query url.Values, v interface{}) (string, error) {
+	if c.config.Datacenter != "" {
+		query.Set("dc", c.config.Datacenter)
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(c.config.Address, "/")+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.config.Token != "" {
+		req.Header.Set("X-Consul-Token", c.config.Token)
+	}
+
+	res, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("consul responded to %s with %s", path, res.Status)
+	}
+	err = json.NewDecoder(res.Body).Decode(v)
+	if err != nil {
+		return "", err
+	}
+	return res.Header.Get("X-Consul-Index"), nil
+}
+
+func (i consulServiceInstance) routes() []Route {
+	host := i.ServiceAddress
+	if host == "" {
+		host = i.Address
+	}
+	if host == "" || i.ServicePort <= 0 || i.ServicePort > 65535 {
+		return nil
+	}
+
+	var routes []Route
+	endpoint := route.NewEndpoint(i.ServiceName, host, uint16(i.ServicePort), i.ServiceID, "", nil, 0, "", models.ModificationTag{}, "")
+	for _, tag := range i.ServiceTags {
+		if uri := strings.TrimPrefix(tag, ConsulTagPrefix); uri != tag && uri != "" {
+			routes = append(routes, Route{Uri: route.Uri(uri), Endpoint: endpoint})
+		}
+	}
+	return routes
+}
+
+func hasRouteTag(tags []string) bool {
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, ConsulTagPrefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,222 @@
+package routesource_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/route"
+	. "code.cloudfoundry.org/gorouter/routesource"
+	"code.cloudfoundry.org/gorouter/test_util"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+type fakeConsul struct {
+	sync.Mutex
+	index     int
+	changed   chan struct{}
+	instances map[string][]map[string]interface{}
+	requests  []*http.Request
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.Lock()
+	f.requests = append(f.requests, req)
+	changed := f.changed
+	index := f.index
+	f.Unlock()
+
+	if req.URL.Path == "/v1/catalog/services" && req.URL.Query().Get("index") == strconv.Itoa(index) {
+		select {
+		case <-changed:
+		case <-req.Context().Done():
+			return
+		}
+	}
+
+	f.Lock()
+	defer f.Unlock()
+	w.Header().Set("X-Consul-Index", strconv.Itoa(f.index))
+	switch req.URL.Path {
+	case "/v1/catalog/services":
+		tagsByService := map[string][]string{}
+		for name, instances := range f.instances {
+			for _, instance := range instances {
+				for _, tag := range instance["ServiceTags"].([]string) {
+					tagsByService[name] = append(tagsByService[name], tag)
+				}
+			}
+		}
+		json.NewEncoder(w).Encode(tagsByService)
+	default:
+		name := req.URL.Path[len("/v1/catalog/service/"):]
+		json.NewEncoder(w).Encode(f.instances[name])
+	}
+}
+
+func (f *fakeConsul) setInstances(instances map[string][]map[string]interface{}) {
+	f.Lock()
+	defer f.Unlock()
+	f.instances = instances
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+var _ = Describe("Consul", func() {
+	var (
+		logger *test_util.TestZapLogger
+		clock  *fakeclock.FakeClock
+		fake   *fakeConsul
+		server *httptest.Server
+		cfg    config.ConsulConfig
+		consul *Consul
+	)
+
+	BeforeEach(func() {
+		logger = test_util.NewTestZapLogger("test")
+		clock = fakeclock.NewFakeClock(time.Now())
+		fake = &fakeConsul{
+			index:   1,
+			changed: make(chan struct{}),
+			instances: map[string][]map[string]interface{}{
+				"web": {
+					{"Address": "10.0.0.1", "ServiceID": "web-1", "ServiceName": "web", "ServiceAddress": "10.0.1.1", "ServicePort": 8080, "ServiceTags": []string{"gorouter:web.example.com", "gorouter:www.example.com"}},
+					{"Address": "10.0.0.2", "ServiceID": "web-2", "ServiceName": "web", "ServiceAddress": "", "ServicePort": 8080, "ServiceTags": []string{"gorouter:web.example.com"}},
+				},
+				"db": {
+					{"Address": "10.0.0.3", "ServiceID": "db-1", "ServiceName": "db", "ServicePort": 5432, "ServiceTags": []string{"primary"}},
+				},
+			},
+		}
+		server = httptest.NewServer(fake)
+		cfg = config.ConsulConfig{Address: server.URL, Datacenter: "dc1", Token: "secret"}
+	})
+
+	JustBeforeEach(func() {
+		consul = NewConsul(logger, cfg, clock)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("Snapshot", func() {
+		It("returns a route for each routing tag of each instance", func() {
+			routes, err := consul.Snapshot()
+			Expect(err).ToNot(HaveOccurred())
+
+			var addrs []string
+			for _, r := range routes {
+				addrs = append(addrs, string(r.Uri)+"|"+r.Endpoint.CanonicalAddr())
+			}
+			Expect(addrs).To(ConsistOf(
+				"web.example.com|10.0.1.1:8080",
+				"www.example.com|10.0.1.1:8080",
+				"web.example.com|10.0.0.2:8080",
+			))
+		})
+
+		It("queries the configured datacenter with the token", func() {
+			_, err := consul.Snapshot()
+			Expect(err).ToNot(HaveOccurred())
+
+			fake.Lock()
+			defer fake.Unlock()
+			for _, req := range fake.requests {
+				Expect(req.URL.Query().Get("dc")).To(Equal("dc1"))
+				Expect(req.Header.Get("X-Consul-Token")).To(Equal("secret"))
+			}
+		})
+
+		Context("when consul responds with an error", func() {
+			BeforeEach(func() {
+				server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					w.WriteHeader(http.StatusForbidden)
+				})
+			})
+
+			It("returns an error", func() {
+				_, err := consul.Snapshot()
+				Expect(err).To(MatchError(ContainSubstring("403")))
+			})
+		})
+	})
+
+	Describe("Subscribe", func() {
+		var (
+			events chan Event
+			stop   chan struct{}
+		)
+
+		receiveAll := func(n int) []string {
+			var received []string
+			for i := 0; i < n; i++ {
+				var e Event
+				Eventually(events).Should(Receive(&e))
+				action := "register"
+				if e.Action == Unregister {
+					action = "unregister"
+				}
+				received = append(received, action+" "+string(e.Route.Uri)+"|"+e.Route.Endpoint.CanonicalAddr())
+			}
+			return received
+		}
+
+		JustBeforeEach(func() {
+			events = make(chan Event, 10)
+			stop = make(chan struct{})
+			Expect(consul.Subscribe(events, stop)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			close(stop)
+		})
+
+		It("delivers the routes and then the changes to the catalog", func() {
+			Expect(receiveAll(3)).To(HaveLen(3))
+			Consistently(events).ShouldNot(Receive())
+
+			fake.setInstances(map[string][]map[string]interface{}{
+				"web": {
+					{"Address": "10.0.0.2", "ServiceID": "web-2", "ServiceName": "web", "ServicePort": 8080, "ServiceTags": []string{"gorouter:web.example.com"}},
+				},
+			})
+
+			Expect(receiveAll(3)).To(ConsistOf(
+				"register web.example.com|10.0.0.2:8080",
+				"unregister web.example.com|10.0.1.1:8080",
+				"unregister www.example.com|10.0.1.1:8080",
+			))
+		})
+
+		Context("when consul cannot be reached", func() {
+			BeforeEach(func() {
+				server.Close()
+			})
+
+			It("logs the error and retries", func() {
+				Eventually(logger.Buffer()).Should(gbytes.Say("failed-to-watch-consul-catalog"))
+				clock.WaitForWatcherAndIncrement(ConsulRetryInterval)
+				Eventually(logger.Buffer()).Should(gbytes.Say("failed-to-watch-consul-catalog"))
+			})
+		})
+	})
+
+	It("ignores instances without a valid port", func() {
+		fake.instances["web"][0]["ServicePort"] = 0
+		routes, err := consul.Snapshot()
+		Expect(err).ToNot(HaveOccurred())
+		for _, r := range routes {
+			Expect(r.Uri).ToNot(Equal(route.Uri("www.example.com")))
+		}
+	})
+})
@@ -0,0 +1,344 @@
+package routesource
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/routing-api/models"
+	"github.com/uber-go/zap"
+)
+
+const (
+	// KubernetesRoutesAnnotation lists the comma separated URIs a Service is
+	// routed for.
+	KubernetesRoutesAnnotation = "gorouter.cloudfoundry.org/routes"
+	// KubernetesPortAnnotation names the port of a Service that is routed
+	// to, when the Service has more than one.
+	KubernetesPortAnnotation = "gorouter.cloudfoundry.org/port"
+
+	// KubernetesRetryInterval is how long to wait before watching a
+	// resource again after its watch failed.
+	KubernetesRetryInterval = 5 * time.Second
+
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	serviceNameLabel  = "kubernetes.io/service-name"
+	servicesPath      = "/api/v1/services"
+	slicesPath        = "/apis/discovery.k8s.io/v1/endpointslices"
+)
+
+// Kubernetes is a RouteSource of HTTP routes for Kubernetes Services
+// annotated with KubernetesRoutesAnnotation. The ready endpoints of the
+// EndpointSlices of a Service are registered for each of its routes, so pods
+// are routed to directly rather than through the Service.
+type Kubernetes struct {
+	logger logger.Logger
+	config config.KubernetesConfig
+	client *http.Client
+	clock  clock.Clock
+
+	// only accessed by the goroutine syncing the routes
+	routes map[string]Route
+}
+
+type kubernetesMetadata struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	Labels          map[string]string `json:"labels"`
+	Annotations     map[string]string `json:"annotations"`
+	ResourceVersion string            `json:"resourceVersion"`
+}
+
+type kubernetesList struct {
+	Metadata kubernetesMetadata `json:"metadata"`
+}
+
+type kubernetesService struct {
+	Metadata kubernetesMetadata `json:"metadata"`
+}
+
+type kubernetesServiceList struct {
+	kubernetesList
+	Items []kubernetesService `json:"items"`
+}
+
+type kubernetesEndpointSlice struct {
+	Metadata    kubernetesMetadata `json:"metadata"`
+	AddressType string             `json:"addressType"`
+	Endpoints   []struct {
+		Addresses  []string `json:"addresses"`
+		Conditions struct {
+			Ready *bool `json:"ready"`
+		} `json:"conditions"`
+	} `json:"endpoints"`
+	Ports []struct {
+		Name     string `json:"name"`
+		Port     *int32 `json:"port"`
+		Protocol string `json:"protocol"`
+	} `json:"ports"`
+}
+
+type kubernetesEndpointSliceList struct {
+	kubernetesList
+	Items []kubernetesEndpointSlice `json:"items"`
+}
+
+// NewKubernetes returns a Kubernetes source for the configured API server.
+// Without an API server it uses the one of the cluster it runs in, with the
+// credentials of its service account.
+func NewKubernetes(logger logger.Logger, cfg config.KubernetesConfig, clock clock.Clock) (*Kubernetes, error) {
+	if cfg.APIServer == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, errors.New("kubernetes.api_server is not set and gorouter is not running in a cluster")
+		}
+		cfg.APIServer = "https://" + net.JoinHostPort(host, port)
+		if cfg.TokenFile == "" {
+			cfg.TokenFile = serviceAccountDir + "/token"
+		}
+		if cfg.CACertFile == "" {
+			cfg.CACertFile = serviceAccountDir + "/ca.crt"
+		}
+	}
+
+	tlsConfig := &tls.Config{}
+	if cfg.CACertFile != "" {
+		pem, err := ioutil.ReadFile(cfg.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CACertFile)
+		}
+	}
+
+	return &Kubernetes{
+		logger: logger,
+		config: cfg,
+		client: &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+		clock:  clock,
+	}, nil
+}
+
+// Snapshot returns a route for each ready endpoint of each annotated Service.
+func (k *Kubernetes) Snapshot() ([]Route, error) {
+	var services kubernetesServiceList
+	err := k.get(context.Background(), servicesPath, &services)
+	if err != nil {
+		return nil, err
+	}
+	var slices kubernetesEndpointSliceList
+	err = k.get(context.Background(), slicesPath, &slices)
+	if err != nil {
+		return nil, err
+	}
+
+	servicesByName := map[string]kubernetesService{}
+	for _, s := range services.Items {
+		if s.Metadata.Annotations[KubernetesRoutesAnnotation] != "" {
+			servicesByName[s.Metadata.Namespace+"/"+s.Metadata.Name] = s
+		}
+	}
+
+	var routes []Route
+	for _, slice := range slices.Items {
+		service, ok := servicesByName[slice.Metadata.Namespace+"/"+slice.Metadata.Labels[serviceNameLabel]]
+		if ok {
+			routes = append(routes, slice.routes(service)...)
+		}
+	}
+	return routes, nil
+}
+
+// Subscribe watches Services and EndpointSlices until stop is closed, and
+// delivers the changes to the routes each time either of them changes.
+func (k *Kubernetes) Subscribe(events chan<- Event, stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	changed := make(chan struct{}, 1)
+	go k.watch(ctx, servicesPath, changed)
+	go k.watch(ctx, slicesPath, changed)
+
+	go func() {
+		for {
+			select {
+			case <-changed:
+				snapshot, err := k.Snapshot()
+				if err != nil {
+					k.logger.Error("failed-to-fetch-kubernetes-routes", zap.Error(err))
+					continue
+				}
+				k.routes = sendChanges(events, stop, k.routes, snapshot)
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// watch signals changed each time the resources at path change, until ctx
+// is done.
+func (k *Kubernetes) watch(ctx context.Context, path string, changed chan<- struct{}) {
+	for {
+		err := k.watchOnce(ctx, path, changed)
+		if ctx.Err() != nil {
+			return
+		}
+		k.logger.Error("failed-to-watch-kubernetes", zap.String("path", path), zap.Error(err))
+
+		select {
+		case <-k.clock.After(KubernetesRetryInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (k *Kubernetes) watchOnce(ctx context.Context, path string, changed chan<- struct{}) error {
+	var list kubernetesList
+	err := k.get(ctx, path, &list)
+	if err != nil {
+		return err
+	}
+	signal(changed)
+
+	res, err := k.do(ctx, path, "watch=true&resourceVersion="+list.Metadata.ResourceVersion)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var event struct {
+			Type string `json:"type"`
+		}
+		err := json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			return err
+		}
+		if event.Type == "ERROR" {
+			return fmt.Errorf("watch of %s failed: %s", path, scanner.Text())
+		}
+		signal(changed)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("watch of " + path + " ended")
+}
+
+func (k *Kubernetes) get(ctx context.Context, path string, v interface{}) error {
+	res, err := k.do(ctx, path, "")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func (k *Kubernetes) do(ctx context.Context, path string, query string) (*http.Response, error) {
+	if k.config.Namespace != "" {
+		// resources of a namespace are at <group>/namespaces/<namespace>/<resource>
+		i := strings.LastIndex(path, "/")
+		path = path[:i] + "/namespaces/" + k.config.Namespace + path[i:]
+	}
+	if query != "" {
+		path += "?" + query
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(k.config.APIServer, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if k.config.TokenFile != "" {
+		// the token is read on each request as service account tokens are
+		// rotated
+		token, err := ioutil.ReadFile(k.config.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	res, err := k.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("kubernetes responded to %s with %s", path, res.Status)
+	}
+	return res, nil
+}
+
+func (s kubernetesEndpointSlice) routes(service kubernetesService) []Route {
+	// FQDN endpoints are deprecated
+	if s.AddressType != "IPv4" && s.AddressType != "IPv6" {
+		return nil
+	}
+
+	portName := service.Metadata.Annotations[KubernetesPortAnnotation]
+	var port int32
+	for _, p := range s.Ports {
+		if p.Port != nil && (p.Protocol == "" || p.Protocol == "TCP") && (portName == "" || p.Name == portName) {
+			port = *p.Port
+			break
+		}
+	}
+	if port <= 0 || port > 65535 {
+		return nil
+	}
+
+	var uris []route.Uri
+	for _, uri := range strings.Split(service.Metadata.Annotations[KubernetesRoutesAnnotation], ",") {
+		if uri = strings.TrimSpace(uri); uri != "" {
+			uris = append(uris, route.Uri(uri))
+		}
+	}
+
+	var routes []Route
+	for _, e := range s.Endpoints {
+		// endpoints without a ready condition are ready
+		if e.Conditions.Ready != nil && !*e.Conditions.Ready {
+			continue
+		}
+		for _, addr := range e.Addresses {
+			endpoint := route.NewEndpoint(service.Metadata.Namespace+"/"+service.Metadata.Name, addr, uint16(port), "", "", nil, 0, "", models.ModificationTag{}, "")
+			for _, uri := range uris {
+				routes = append(routes, Route{Uri: uri, Endpoint: endpoint})
+			}
+		}
+	}
+	return routes
+}
+
+// signal notifies changed without blocking, as one pending notification is
+// enough to sync all changes.
+func signal(changed chan<- struct{}) {
+	select {
+	case changed <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,304 @@
+package routesource_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/gorouter/config"
+	. "code.cloudfoundry.org/gorouter/routesource"
+	"code.cloudfoundry.org/gorouter/test_util"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+type fakeKubernetes struct {
+	sync.Mutex
+	services   []interface{}
+	slices     []interface{}
+	watchers   map[string]chan string
+	paths      []string
+	authHeader string
+}
+
+func (f *fakeKubernetes) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.Lock()
+	f.paths = append(f.paths, req.URL.Path)
+	f.authHeader = req.Header.Get("Authorization")
+	var items []interface{}
+	switch filepath.Base(req.URL.Path) {
+	case "services":
+		items = f.services
+	case "endpointslices":
+		items = f.slices
+	default:
+		f.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	watcher := f.watchers[filepath.Base(req.URL.Path)]
+	f.Unlock()
+
+	if req.URL.Query().Get("watch") != "true" {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"metadata": map[string]string{"resourceVersion": "1"},
+			"items":    items,
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	for {
+		select {
+		case event := <-watcher:
+			w.Write([]byte(event + "\n"))
+			w.(http.Flusher).Flush()
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+func (f *fakeKubernetes) setSlices(slices ...interface{}) {
+	f.Lock()
+	f.slices = slices
+	watcher := f.watchers["endpointslices"]
+	f.Unlock()
+	watcher <- `{"type":"MODIFIED","object":{}}`
+}
+
+func kubernetesService(namespace, name string, annotations map[string]string) map[string]interface{} {
+	return map[string]interface{}{
+		"metadata": map[string]interface{}{"namespace": namespace, "name": name, "annotations": annotations},
+	}
+}
+
+func kubernetesSlice(namespace, service string, ports []map[string]interface{}, endpoints ...map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"namespace": namespace,
+			"name":      service + "-abcde",
+			"labels":    map[string]string{"kubernetes.io/service-name": service},
+		},
+		"addressType": "IPv4",
+		"endpoints":   endpoints,
+		"ports":       ports,
+	}
+}
+
+func kubernetesEndpoint(ready bool, addresses ...string) map[string]interface{} {
+	return map[string]interface{}{
+		"addresses":  addresses,
+		"conditions": map[string]interface{}{"ready": ready},
+	}
+}
+
+var _ = Describe("Kubernetes", func() {
+	var (
+		logger     *test_util.TestZapLogger
+		clock      *fakeclock.FakeClock
+		fake       *fakeKubernetes
+		server     *httptest.Server
+		cfg        config.KubernetesConfig
+		kubernetes *Kubernetes
+		tokenFile  string
+		httpPorts  []map[string]interface{}
+	)
+
+	routeAddrs := func(routes []Route) []string {
+		var addrs []string
+		for _, r := range routes {
+			addrs = append(addrs, string(r.Uri)+"|"+r.Endpoint.CanonicalAddr())
+		}
+		return addrs
+	}
+
+	BeforeEach(func() {
+		logger = test_util.NewTestZapLogger("test")
+		clock = fakeclock.NewFakeClock(time.Now())
+
+		httpPorts = []map[string]interface{}{{"name": "http", "port": 8080, "protocol": "TCP"}}
+		fake = &fakeKubernetes{
+			services: []interface{}{
+				kubernetesService("default", "web", map[string]string{KubernetesRoutesAnnotation: "web.example.com, www.example.com"}),
+				kubernetesService("default", "internal", nil),
+			},
+			slices: []interface{}{
+				kubernetesSlice("default", "web", httpPorts,
+					kubernetesEndpoint(true, "10.1.0.1"),
+					kubernetesEndpoint(false, "10.1.0.2"),
+				),
+				kubernetesSlice("default", "internal", httpPorts, kubernetesEndpoint(true, "10.1.0.3")),
+				kubernetesSlice("other", "web", httpPorts, kubernetesEndpoint(true, "10.1.0.4")),
+			},
+			watchers: map[string]chan string{
+				"services":       make(chan string),
+				"endpointslices": make(chan string),
+			},
+		}
+		server = httptest.NewServer(fake)
+
+		f, err := ioutil.TempFile("", "token")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = f.WriteString("my-token\n")
+		Expect(err).ToNot(HaveOccurred())
+		f.Close()
+		tokenFile = f.Name()
+
+		cfg = config.KubernetesConfig{Enabled: true, APIServer: server.URL, TokenFile: tokenFile}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		kubernetes, err = NewKubernetes(logger, cfg, clock)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.CloseClientConnections()
+		server.Close()
+		os.Remove(tokenFile)
+	})
+
+	Describe("Snapshot", func() {
+		It("returns a route for each ready endpoint of each annotated service", func() {
+			routes, err := kubernetes.Snapshot()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(routeAddrs(routes)).To(ConsistOf("web.example.com|10.1.0.1:8080", "www.example.com|10.1.0.1:8080"))
+		})
+
+		It("authenticates with the token", func() {
+			_, err := kubernetes.Snapshot()
+			Expect(err).ToNot(HaveOccurred())
+
+			fake.Lock()
+			defer fake.Unlock()
+			Expect(fake.authHeader).To(Equal("Bearer my-token"))
+		})
+
+		Context("when the service names a port", func() {
+			BeforeEach(func() {
+				fake.services = []interface{}{
+					kubernetesService("default", "web", map[string]string{
+						KubernetesRoutesAnnotation: "web.example.com",
+						KubernetesPortAnnotation:   "admin",
+					}),
+				}
+				fake.slices = []interface{}{
+					kubernetesSlice("default", "web",
+						[]map[string]interface{}{{"name": "http", "port": 8080}, {"name": "admin", "port": 9090}},
+						kubernetesEndpoint(true, "10.1.0.1"),
+					),
+				}
+			})
+
+			It("routes to that port", func() {
+				routes, err := kubernetes.Snapshot()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(routeAddrs(routes)).To(ConsistOf("web.example.com|10.1.0.1:9090"))
+			})
+		})
+
+		Context("when the endpoints are IPv6", func() {
+			BeforeEach(func() {
+				slice := kubernetesSlice("default", "web", httpPorts, kubernetesEndpoint(true, "fd00::1"))
+				slice["addressType"] = "IPv6"
+				fake.slices = []interface{}{slice}
+			})
+
+			It("routes to the bracketed addresses", func() {
+				routes, err := kubernetes.Snapshot()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(routeAddrs(routes)).To(ConsistOf("web.example.com|[fd00::1]:8080", "www.example.com|[fd00::1]:8080"))
+			})
+		})
+
+		Context("when a namespace is configured", func() {
+			BeforeEach(func() {
+				cfg.Namespace = "default"
+			})
+
+			It("only lists the resources of the namespace", func() {
+				_, err := kubernetes.Snapshot()
+				Expect(err).ToNot(HaveOccurred())
+
+				fake.Lock()
+				defer fake.Unlock()
+				Expect(fake.paths).To(ConsistOf(
+					"/api/v1/namespaces/default/services",
+					"/apis/discovery.k8s.io/v1/namespaces/default/endpointslices",
+				))
+			})
+		})
+	})
+
+	Describe("Subscribe", func() {
+		var (
+			events chan Event
+			stop   chan struct{}
+		)
+
+		JustBeforeEach(func() {
+			events = make(chan Event, 10)
+			stop = make(chan struct{})
+			Expect(kubernetes.Subscribe(events, stop)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			close(stop)
+		})
+
+		It("delivers the changes when the endpoints change", func() {
+			received := map[Action][]string{}
+			receive := func() map[Action][]string {
+				for {
+					select {
+					case e := <-events:
+						received[e.Action] = append(received[e.Action], string(e.Route.Uri)+"|"+e.Route.Endpoint.CanonicalAddr())
+					default:
+						return received
+					}
+				}
+			}
+			Eventually(receive).Should(HaveKeyWithValue(Register, ContainElement("web.example.com|10.1.0.1:8080")))
+			Expect(received[Register]).To(ContainElement("www.example.com|10.1.0.1:8080"))
+
+			fake.setSlices(kubernetesSlice("default", "web", httpPorts,
+				kubernetesEndpoint(true, "10.1.0.2"),
+			))
+
+			Eventually(receive).Should(HaveKeyWithValue(Unregister, ConsistOf("web.example.com|10.1.0.1:8080", "www.example.com|10.1.0.1:8080")))
+			Expect(received[Register]).To(ContainElement("web.example.com|10.1.0.2:8080"))
+			Expect(received[Register]).To(ContainElement("www.example.com|10.1.0.2:8080"))
+		})
+
+		Context("when the API server cannot be reached", func() {
+			BeforeEach(func() {
+				cfg.APIServer = "http://127.0.0.1:1"
+			})
+
+			It("logs the error and retries", func() {
+				Eventually(logger.Buffer()).Should(gbytes.Say("failed-to-watch-kubernetes"))
+				clock.Increment(KubernetesRetryInterval)
+				Eventually(logger.Buffer()).Should(gbytes.Say("failed-to-watch-kubernetes"))
+			})
+		})
+	})
+
+	Context("when no API server is configured outside a cluster", func() {
+		It("returns an error", func() {
+			os.Unsetenv("KUBERNETES_SERVICE_HOST")
+			_, err := NewKubernetes(logger, config.KubernetesConfig{Enabled: true}, clock)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,181 @@
+package routesource
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/registry"
+	"code.cloudfoundry.org/gorouter/route"
+	"github.com/uber-go/zap"
+)
+
+// Route is a route known to a RouteSource. It is a TCP route on
+// ExternalPort when ExternalPort is set, and an HTTP route for Uri otherwise.
+type Route struct {
+	Uri          route.Uri
+	ExternalPort uint16
+	Endpoint     *route.Endpoint
+}
+
+func (r Route) key() string {
+	if r.ExternalPort != 0 {
+		return fmt.Sprintf("tcp:%d|%s", r.ExternalPort, r.Endpoint.CanonicalAddr())
+	}
+	return string(r.Uri.RouteKey()) + "|" + r.Endpoint.CanonicalAddr()
+}
+
+type Action int
+
+const (
+	Register Action = iota
+	Unregister
+)
+
+// Event is a change to the routes of a RouteSource.
+type Event struct {
+	Action Action
+	Route  Route
+}
+
+// RouteSource is a source of routes for the registry, such as NATS or the
+// Routing API. Sources are composed by running each of them with a Runner
+// against the same registry.
+type RouteSource interface {
+	// Snapshot returns all routes currently known to the source. Sources
+	// whose routes are kept alive by repeated registration return no routes.
+	Snapshot() ([]Route, error)
+	// Subscribe delivers changes to the routes of the source on events until
+	// stop is closed. It returns once the subscription is established.
+	Subscribe(events chan<- Event, stop <-chan struct{}) error
+}
+
+// Apply makes the change described by the event in the registry.
+func Apply(registry registry.Registry, e Event) {
+	r := e.Route
+	switch {
+	case e.Action == Register && r.ExternalPort != 0:
+		registry.RegisterTCP(r.ExternalPort, r.Endpoint)
+	case e.Action == Register:
+		registry.Register(r.Uri, r.Endpoint)
+	case r.ExternalPort != 0:
+		registry.UnregisterTCP(r.ExternalPort, r.Endpoint)
+	default:
+		registry.Unregister(r.Uri, r.Endpoint)
+	}
+}
+
+// Runner keeps the registry up to date with a RouteSource. It applies the
+// events of the source as they arrive and, every sync interval, registers
+// the snapshot of the source and unregisters the routes that have left it.
+type Runner struct {
+	logger       logger.Logger
+	source       RouteSource
+	registry     registry.Registry
+	syncInterval time.Duration
+	clock        clock.Clock
+
+	routes map[string]Route
+}
+
+// NewRunner returns a Runner for the source. A zero sync interval syncs the
+// snapshot only once, on start.
+func NewRunner(
+	logger logger.Logger,
+	source RouteSource,
+	registry registry.Registry,
+	syncInterval time.Duration,
+	clock clock.Clock,
+) *Runner {
+	return &Runner{
+		logger:       logger,
+		source:       source,
+		registry:     registry,
+		syncInterval: syncInterval,
+		clock:        clock,
+		routes:       map[string]Route{},
+	}
+}
+
+func (r *Runner) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	events := make(chan Event, 1024)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	err := r.source.Subscribe(events, stop)
+	if err != nil {
+		return err
+	}
+	r.Sync()
+
+	var tick <-chan time.Time
+	if r.syncInterval > 0 {
+		ticker := r.clock.NewTicker(r.syncInterval)
+		defer ticker.Stop()
+		tick = ticker.C()
+	}
+
+	close(ready)
+	r.logger.Info("route-source-started")
+	for {
+		select {
+		case e := <-events:
+			Apply(r.registry, e)
+		case <-tick:
+			r.Sync()
+		case <-signals:
+			r.logger.Info("stopping")
+			return nil
+		}
+	}
+}
+
+// Sync registers the snapshot of the source and unregisters the routes of
+// the previous snapshot that are no longer in it.
+func (r *Runner) Sync() {
+	snapshot, err := r.source.Snapshot()
+	if err != nil {
+		r.logger.Error("failed-to-fetch-snapshot", zap.Error(err))
+		return
+	}
+
+	routes, events := changes(r.routes, snapshot)
+	for _, e := range events {
+		Apply(r.registry, e)
+	}
+	r.routes = routes
+}
+
+// changes returns the routes of the snapshot keyed by route and endpoint,
+// and the events that register all of them and unregister the routes of
+// previous that are not in the snapshot.
+func changes(previous map[string]Route, snapshot []Route) (map[string]Route, []Event) {
+	routes := make(map[string]Route, len(snapshot))
+	events := make([]Event, 0, len(snapshot))
+	for _, route := range snapshot {
+		routes[route.key()] = route
+		events = append(events, Event{Action: Register, Route: route})
+	}
+	for key, route := range previous {
+		if _, ok := routes[key]; !ok {
+			events = append(events, Event{Action: Unregister, Route: route})
+		}
+	}
+	return routes, events
+}
+
+// sendChanges delivers the events that turn the previous routes into the
+// routes of the snapshot, and returns the routes of the snapshot.
+func sendChanges(events chan<- Event, stop <-chan struct{}, previous map[string]Route, snapshot []Route) map[string]Route {
+	routes, diff := changes(previous, snapshot)
+	for _, e := range diff {
+		select {
+		case events <- e:
+		case <-stop:
+			return routes
+		}
+	}
+	return routes
+}
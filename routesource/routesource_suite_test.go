@@ -0,0 +1,13 @@
+package routesource_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestRouteSource(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "RouteSource Suite")
+}
@@ -0,0 +1,174 @@
+package routesource_test
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/gorouter/registry/fakes"
+	"code.cloudfoundry.org/gorouter/route"
+	. "code.cloudfoundry.org/gorouter/routesource"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/routing-api/models"
+	"github.com/tedsuo/ifrit"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+type fakeSource struct {
+	sync.Mutex
+	routes       []Route
+	snapshotErr  error
+	subscribeErr error
+	events       chan<- Event
+	stop         <-chan struct{}
+}
+
+func (s *fakeSource) Snapshot() ([]Route, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.routes, s.snapshotErr
+}
+
+func (s *fakeSource) Subscribe(events chan<- Event, stop <-chan struct{}) error {
+	s.Lock()
+	defer s.Unlock()
+	s.events = events
+	s.stop = stop
+	return s.subscribeErr
+}
+
+func (s *fakeSource) setRoutes(routes ...Route) {
+	s.Lock()
+	defer s.Unlock()
+	s.routes = routes
+}
+
+var _ = Describe("Runner", func() {
+	var (
+		logger   *test_util.TestZapLogger
+		source   *fakeSource
+		registry *fakes.FakeRegistry
+		clock    *fakeclock.FakeClock
+		runner   *Runner
+		process  ifrit.Process
+
+		routeA, routeB, tcpRoute Route
+	)
+
+	newEndpoint := func(port uint16) *route.Endpoint {
+		return route.NewEndpoint("", "1.1.1.1", port, "", "", nil, -1, "", models.ModificationTag{}, "")
+	}
+
+	BeforeEach(func() {
+		logger = test_util.NewTestZapLogger("test")
+		source = &fakeSource{}
+		registry = &fakes.FakeRegistry{}
+		clock = fakeclock.NewFakeClock(time.Now())
+
+		routeA = Route{Uri: "a.example.com", Endpoint: newEndpoint(1234)}
+		routeB = Route{Uri: "b.example.com", Endpoint: newEndpoint(1234)}
+		tcpRoute = Route{ExternalPort: 61000, Endpoint: newEndpoint(5678)}
+	})
+
+	JustBeforeEach(func() {
+		runner = NewRunner(logger, source, registry, time.Minute, clock)
+		process = ifrit.Background(runner)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+	})
+
+	Context("when the source has routes", func() {
+		BeforeEach(func() {
+			source.setRoutes(routeA, tcpRoute)
+		})
+
+		It("registers the snapshot on start", func() {
+			Eventually(process.Ready()).Should(BeClosed())
+
+			Expect(registry.RegisterCallCount()).To(Equal(1))
+			uri, endpoint := registry.RegisterArgsForCall(0)
+			Expect(uri).To(Equal(routeA.Uri))
+			Expect(endpoint).To(Equal(routeA.Endpoint))
+
+			Expect(registry.RegisterTCPCallCount()).To(Equal(1))
+			port, endpoint := registry.RegisterTCPArgsForCall(0)
+			Expect(port).To(Equal(uint16(61000)))
+			Expect(endpoint).To(Equal(tcpRoute.Endpoint))
+		})
+
+		It("unregisters the routes that leave the snapshot on the next sync", func() {
+			Eventually(process.Ready()).Should(BeClosed())
+			source.setRoutes(routeB)
+
+			clock.WaitForWatcherAndIncrement(time.Minute)
+
+			Eventually(registry.UnregisterCallCount).Should(Equal(1))
+			uri, _ := registry.UnregisterArgsForCall(0)
+			Expect(uri).To(Equal(routeA.Uri))
+			Expect(registry.UnregisterTCPCallCount()).To(Equal(1))
+
+			Expect(registry.RegisterCallCount()).To(Equal(2))
+			uri, _ = registry.RegisterArgsForCall(1)
+			Expect(uri).To(Equal(routeB.Uri))
+		})
+	})
+
+	Context("when fetching the snapshot fails", func() {
+		BeforeEach(func() {
+			source.setRoutes(routeA)
+			source.snapshotErr = errors.New("boom")
+		})
+
+		It("logs the error and keeps running", func() {
+			Eventually(process.Ready()).Should(BeClosed())
+			Expect(logger.Buffer()).To(gbytes.Say("failed-to-fetch-snapshot"))
+			Expect(registry.RegisterCallCount()).To(BeZero())
+		})
+	})
+
+	It("applies the events of the source", func() {
+		Eventually(process.Ready()).Should(BeClosed())
+
+		source.Lock()
+		events := source.events
+		source.Unlock()
+		events <- Event{Action: Register, Route: routeA}
+		events <- Event{Action: Unregister, Route: routeA}
+		events <- Event{Action: Unregister, Route: tcpRoute}
+
+		Eventually(registry.UnregisterTCPCallCount).Should(Equal(1))
+		Expect(registry.RegisterCallCount()).To(Equal(1))
+		Expect(registry.UnregisterCallCount()).To(Equal(1))
+	})
+
+	It("stops the subscription when signaled", func() {
+		Eventually(process.Ready()).Should(BeClosed())
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+
+		source.Lock()
+		stop := source.stop
+		source.Unlock()
+		Expect(stop).To(BeClosed())
+	})
+
+	Context("when subscribing fails", func() {
+		BeforeEach(func() {
+			source.subscribeErr = errors.New("boom")
+		})
+
+		It("exits with the error", func() {
+			var err error
+			Eventually(process.Wait()).Should(Receive(&err))
+			Expect(err).To(MatchError("boom"))
+		})
+	})
+})
@@ -0,0 +1,141 @@
+package routesource
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/routing-api/models"
+	"github.com/uber-go/zap"
+	"gopkg.in/yaml.v2"
+)
+
+// StaticFilePollInterval is how often a StaticFile checks its file for
+// changes.
+const StaticFilePollInterval = time.Second
+
+// StaticFile is a RouteSource of HTTP routes read from a YAML file that maps
+// URIs to lists of host:port addresses, for example:
+//
+//	legacy.example.com:
+//	- 10.0.16.4:8080
+//	- 10.0.16.5:8080
+//
+// The file is reloaded when it changes.
+type StaticFile struct {
+	logger logger.Logger
+	path   string
+	clock  clock.Clock
+
+	// only accessed by the goroutine watching the file
+	modTime time.Time
+	size    int64
+	routes  map[string]Route
+}
+
+func NewStaticFile(logger logger.Logger, path string, clock clock.Clock) *StaticFile {
+	return &StaticFile{
+		logger: logger,
+		path:   path,
+		clock:  clock,
+	}
+}
+
+// Snapshot reads the routes of the file.
+func (f *StaticFile) Snapshot() ([]Route, error) {
+	b, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+	return parseStaticRoutes(b)
+}
+
+// Subscribe delivers the changes to the routes of the file each time it is
+// modified, until stop is closed.
+func (f *StaticFile) Subscribe(events chan<- Event, stop <-chan struct{}) error {
+	if f.changed() {
+		snapshot, err := f.Snapshot()
+		if err == nil {
+			f.routes, _ = changes(nil, snapshot)
+		}
+	}
+
+	go func() {
+		ticker := f.clock.NewTicker(StaticFilePollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C():
+				if f.changed() {
+					f.reload(events, stop)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// changed reports whether the file was modified since it was last checked.
+func (f *StaticFile) changed() bool {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false
+	}
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return false
+	}
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	return true
+}
+
+func (f *StaticFile) reload(events chan<- Event, stop <-chan struct{}) {
+	snapshot, err := f.Snapshot()
+	if err != nil {
+		f.logger.Error("failed-to-reload-static-routes", zap.String("path", f.path), zap.Error(err))
+		return
+	}
+
+	f.logger.Info("static-routes-reloaded", zap.String("path", f.path), zap.Int("number-of-routes", len(snapshot)))
+	f.routes = sendChanges(events, stop, f.routes, snapshot)
+}
+
+func parseStaticRoutes(b []byte) ([]Route, error) {
+	var addrsByURI map[string][]string
+	err := yaml.Unmarshal(b, &addrsByURI)
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []Route
+	for uri, addrs := range addrsByURI {
+		for _, addr := range addrs {
+			if strings.HasPrefix(addr, route.UnixSocketPrefix+"/") {
+				endpoint := route.NewEndpoint("", addr, 0, "", "", nil, 0, "", models.ModificationTag{}, "")
+				routes = append(routes, Route{Uri: route.Uri(uri), Endpoint: endpoint})
+				continue
+			}
+			host, portStr, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q for %s: %s", addr, uri, err)
+			}
+			port, err := strconv.ParseUint(portStr, 10, 16)
+			if err != nil || port == 0 {
+				return nil, fmt.Errorf("invalid port in address %q for %s", addr, uri)
+			}
+
+			endpoint := route.NewEndpoint("", host, uint16(port), "", "", nil, 0, "", models.ModificationTag{}, "")
+			routes = append(routes, Route{Uri: route.Uri(uri), Endpoint: endpoint})
+		}
+	}
+	return routes, nil
+}
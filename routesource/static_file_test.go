@@ -0,0 +1,146 @@
+package routesource_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/gorouter/route"
+	. "code.cloudfoundry.org/gorouter/routesource"
+	"code.cloudfoundry.org/gorouter/test_util"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("StaticFile", func() {
+	var (
+		logger     *test_util.TestZapLogger
+		clock      *fakeclock.FakeClock
+		dir, path  string
+		staticFile *StaticFile
+	)
+
+	writeFile := func(contents string) {
+		err := ioutil.WriteFile(path, []byte(contents), 0644)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	routeAddrs := func(routes []Route) map[route.Uri][]string {
+		addrs := map[route.Uri][]string{}
+		for _, r := range routes {
+			addrs[r.Uri] = append(addrs[r.Uri], r.Endpoint.CanonicalAddr())
+		}
+		return addrs
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "static-routes")
+		Expect(err).ToNot(HaveOccurred())
+		path = filepath.Join(dir, "routes.yml")
+
+		logger = test_util.NewTestZapLogger("test")
+		clock = fakeclock.NewFakeClock(time.Now())
+		staticFile = NewStaticFile(logger, path, clock)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("Snapshot", func() {
+		It("returns a route for each address of each uri", func() {
+			writeFile(`
+legacy.example.com:
+- 10.0.16.4:8080
+- 10.0.16.5:8080
+other.example.com/path:
+- 10.0.16.6:80
+`)
+			routes, err := staticFile.Snapshot()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(routeAddrs(routes)).To(Equal(map[route.Uri][]string{
+				"legacy.example.com":     {"10.0.16.4:8080", "10.0.16.5:8080"},
+				"other.example.com/path": {"10.0.16.6:80"},
+			}))
+		})
+
+		It("returns an error when an address has no port", func() {
+			writeFile("legacy.example.com: [10.0.16.4]")
+			_, err := staticFile.Snapshot()
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("returns an error when a port is invalid", func() {
+			writeFile("legacy.example.com: ['10.0.16.4:99999']")
+			_, err := staticFile.Snapshot()
+			Expect(err).To(MatchError(ContainSubstring("invalid port")))
+		})
+
+		It("returns an error when the file does not exist", func() {
+			_, err := staticFile.Snapshot()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Subscribe", func() {
+		var (
+			events chan Event
+			stop   chan struct{}
+		)
+
+		BeforeEach(func() {
+			writeFile("legacy.example.com: ['10.0.16.4:8080', '10.0.16.5:8080']")
+
+			events = make(chan Event, 10)
+			stop = make(chan struct{})
+			Expect(staticFile.Subscribe(events, stop)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			close(stop)
+		})
+
+		It("does not deliver events while the file is unchanged", func() {
+			clock.WaitForWatcherAndIncrement(StaticFilePollInterval)
+			Consistently(events).ShouldNot(Receive())
+		})
+
+		It("delivers the changes when the file is modified", func() {
+			writeFile("legacy.example.com: ['10.0.16.4:8080']\nnew.example.com: ['10.0.16.9:8080']")
+			clock.WaitForWatcherAndIncrement(StaticFilePollInterval)
+
+			var received []Event
+			for i := 0; i < 3; i++ {
+				var e Event
+				Eventually(events).Should(Receive(&e))
+				received = append(received, e)
+			}
+
+			var registered, unregistered []string
+			for _, e := range received {
+				addr := string(e.Route.Uri) + "|" + e.Route.Endpoint.CanonicalAddr()
+				if e.Action == Register {
+					registered = append(registered, addr)
+				} else {
+					unregistered = append(unregistered, addr)
+				}
+			}
+			Expect(registered).To(ConsistOf("legacy.example.com|10.0.16.4:8080", "new.example.com|10.0.16.9:8080"))
+			Expect(unregistered).To(ConsistOf("legacy.example.com|10.0.16.5:8080"))
+			Eventually(logger.Buffer()).Should(gbytes.Say("static-routes-reloaded"))
+		})
+
+		It("logs and keeps the routes when the modified file is invalid", func() {
+			writeFile("legacy.example.com: [not-an-address]")
+			clock.WaitForWatcherAndIncrement(StaticFilePollInterval)
+
+			Eventually(logger.Buffer()).Should(gbytes.Say("failed-to-reload-static-routes"))
+			Consistently(events).ShouldNot(Receive())
+		})
+	})
+})
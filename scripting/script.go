@@ -0,0 +1,139 @@
+package scripting
+
+import (
+	"fmt"
+	"net/http"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/route"
+	"github.com/uber-go/zap"
+	"go.starlark.net/starlark"
+)
+
+// Script is a Starlark script defining hooks that the router calls:
+//
+//	on_request(req)                   before the request is routed
+//	on_backend_select(req, endpoints) before the request is sent to an endpoint
+//	on_response(req, resp)            before the response is returned
+//
+// on_request may change the method, host, path, query and headers of the
+// request, or respond to it itself by returning response(status, body,
+// headers). on_backend_select may return the endpoint the request is sent to
+// first. on_response may change the status and headers of the response. Hooks
+// that the script does not define are not called.
+type Script struct {
+	onRequest       starlark.Callable
+	onBackendSelect starlark.Callable
+	onResponse      starlark.Callable
+	maxSteps        uint64
+	logger          logger.Logger
+}
+
+// NewScript executes the script once to define its hooks. Its global values
+// are frozen afterwards, so that the hooks can be called concurrently.
+func NewScript(cfg config.ScriptingConfig, logger logger.Logger) (*Script, error) {
+	s := &Script{
+		maxSteps: cfg.MaxSteps,
+		logger:   logger,
+	}
+	globals, err := starlark.ExecFile(s.thread("load"), cfg.Path, cfg.Source, builtins)
+	if err != nil {
+		return nil, err
+	}
+	globals.Freeze()
+
+	hooks := map[string]*starlark.Callable{
+		"on_request":        &s.onRequest,
+		"on_backend_select": &s.onBackendSelect,
+		"on_response":       &s.onResponse,
+	}
+	for name, hook := range hooks {
+		v, ok := globals[name]
+		if !ok {
+			continue
+		}
+		fn, ok := v.(starlark.Callable)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a function, not %s", name, v.Type())
+		}
+		*hook = fn
+	}
+	return s, nil
+}
+
+// OnRequest calls on_request with the request for the route of the pool. It
+// returns the response of the hook when the hook responds to the request
+// itself.
+func (s *Script) OnRequest(req *http.Request, pool *route.Pool) (*http.Response, error) {
+	if s.onRequest == nil {
+		return nil, nil
+	}
+	v, err := s.call("on_request", s.onRequest, newRequest(req, pool))
+	if err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case *response:
+		v.res.Request = req
+		return v.res, nil
+	}
+	return nil, fmt.Errorf("on_request returned a %s, not a response or None", v.Type())
+}
+
+// OnBackendSelect calls on_backend_select with the request and the endpoints
+// of the pool. It returns the endpoint the hook selected, or nil when the
+// hook leaves the selection to the load balancing algorithm.
+func (s *Script) OnBackendSelect(req *http.Request, pool *route.Pool) (*route.Endpoint, error) {
+	if s.onBackendSelect == nil {
+		return nil, nil
+	}
+	var endpoints []starlark.Value
+	pool.Each(func(e *route.Endpoint) {
+		endpoints = append(endpoints, &endpoint{e: e})
+	})
+	v, err := s.call("on_backend_select", s.onBackendSelect, newRequest(req, pool), starlark.NewList(endpoints))
+	if err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case *endpoint:
+		return v.e, nil
+	}
+	return nil, fmt.Errorf("on_backend_select returned a %s, not an endpoint or None", v.Type())
+}
+
+// OnResponse calls on_response with the response to a request for the route
+// of the pool.
+func (s *Script) OnResponse(res *http.Response, pool *route.Pool) error {
+	if s.onResponse == nil || res.Request == nil {
+		return nil
+	}
+	_, err := s.call("on_response", s.onResponse, newRequest(res.Request, pool), &response{res: res})
+	return err
+}
+
+func (s *Script) call(hook string, fn starlark.Callable, args ...starlark.Value) (starlark.Value, error) {
+	v, err := starlark.Call(s.thread(hook), fn, args, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", hook, err)
+	}
+	return v, nil
+}
+
+// thread returns a thread for a call of the hook, which fails when it
+// executes more than the maximum steps. Printed messages are logged.
+func (s *Script) thread(hook string) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: hook,
+		Print: func(_ *starlark.Thread, msg string) {
+			s.logger.Info("script-print", zap.String("hook", hook), zap.String("message", msg))
+		},
+	}
+	thread.SetMaxExecutionSteps(s.maxSteps)
+	return thread
+}
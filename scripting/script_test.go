@@ -0,0 +1,206 @@
+package scripting_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/route"
+	"code.cloudfoundry.org/gorouter/scripting"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/routing-api/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Script", func() {
+	var (
+		cfg    config.ScriptingConfig
+		logger *test_util.TestZapLogger
+		script *scripting.Script
+		pool   *route.Pool
+		req    *http.Request
+	)
+
+	BeforeEach(func() {
+		cfg = config.ScriptingConfig{Path: "test.star", MaxSteps: 1000}
+		logger = test_util.NewTestZapLogger("scripting-test")
+		pool = route.NewPool(2*time.Minute, "/legacy")
+		pool.Put(route.NewEndpoint("app-guid", "10.0.16.4", 8080, "instance-0", "0", map[string]string{"version": "v1"}, -1, "", models.ModificationTag{}, ""))
+		pool.Put(route.NewEndpoint("app-guid", "10.0.16.5", 8080, "instance-1", "1", map[string]string{"version": "v2"}, -1, "", models.ModificationTag{}, ""))
+		req = test_util.NewRequest("GET", "example.com", "/legacy/page?id=1", nil)
+		req.Header.Set("X-Foo", "foo")
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		script, err = scripting.NewScript(cfg, logger)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	Context("when the script does not define hooks", func() {
+		BeforeEach(func() {
+			cfg.Source = []byte("x = 1\n")
+		})
+
+		It("does not change requests or responses", func() {
+			res, err := script.OnRequest(req, pool)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(BeNil())
+
+			endpoint, err := script.OnBackendSelect(req, pool)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(endpoint).To(BeNil())
+
+			Expect(script.OnResponse(&http.Response{StatusCode: 200, Header: http.Header{}, Request: req}, pool)).To(Succeed())
+		})
+	})
+
+	Describe("on_request", func() {
+		BeforeEach(func() {
+			cfg.Source = []byte(`
+def on_request(req):
+    print("request for", req.route.app_id, req.route.context_path)
+    if req.path.startswith("/legacy/"):
+        req.path = "/v2/" + req.path[len("/legacy/"):]
+        req.headers["X-Rewritten"] = "true"
+        req.headers.remove("X-Foo")
+    if req.headers.get("X-Deny", "") == "yes":
+        return response(403, "denied", {"Content-Type": "text/plain"})
+`)
+		})
+
+		It("rewrites the request", func() {
+			res, err := script.OnRequest(req, pool)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res).To(BeNil())
+
+			Expect(req.URL.Path).To(Equal("/v2/page"))
+			Expect(req.URL.RawQuery).To(Equal("id=1"))
+			Expect(req.Header.Get("X-Rewritten")).To(Equal("true"))
+			Expect(req.Header).ToNot(HaveKey("X-Foo"))
+		})
+
+		It("gives the hook the route of the request", func() {
+			_, err := script.OnRequest(req, pool)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(logger).To(gbytes.Say(`"message":"request for app-guid /legacy"`))
+		})
+
+		It("responds with the response of the hook", func() {
+			req.Header.Set("X-Deny", "yes")
+
+			res, err := script.OnRequest(req, pool)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res.StatusCode).To(Equal(http.StatusForbidden))
+			Expect(res.Header.Get("Content-Type")).To(Equal("text/plain"))
+			body, err := ioutil.ReadAll(res.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(Equal("denied"))
+		})
+
+		Context("when the hook fails", func() {
+			BeforeEach(func() {
+				cfg.Source = []byte(`
+def on_request(req):
+    req.path = 1
+`)
+			})
+
+			It("returns an error", func() {
+				_, err := script.OnRequest(req, pool)
+				Expect(err).To(MatchError(ContainSubstring("request.path must be a string")))
+			})
+		})
+
+		Context("when the hook executes too many steps", func() {
+			BeforeEach(func() {
+				cfg.Source = []byte(`
+def on_request(req):
+    for i in range(100000):
+        pass
+`)
+			})
+
+			It("returns an error", func() {
+				_, err := script.OnRequest(req, pool)
+				Expect(err).To(MatchError(ContainSubstring("too many steps")))
+			})
+		})
+	})
+
+	Describe("on_backend_select", func() {
+		BeforeEach(func() {
+			cfg.Source = []byte(`
+def on_backend_select(req, endpoints):
+    version = req.headers.get("X-Version")
+    for e in endpoints:
+        if e.tags.get("version") == version:
+            return e
+`)
+		})
+
+		It("returns the endpoint selected by the hook", func() {
+			req.Header.Set("X-Version", "v2")
+
+			endpoint, err := script.OnBackendSelect(req, pool)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(endpoint.PrivateInstanceId).To(Equal("instance-1"))
+		})
+
+		It("returns nil when the hook selects no endpoint", func() {
+			endpoint, err := script.OnBackendSelect(req, pool)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(endpoint).To(BeNil())
+		})
+
+		Context("when the hook returns something else", func() {
+			BeforeEach(func() {
+				cfg.Source = []byte(`
+def on_backend_select(req, endpoints):
+    return endpoints[0].address
+`)
+			})
+
+			It("returns an error", func() {
+				_, err := script.OnBackendSelect(req, pool)
+				Expect(err).To(MatchError(ContainSubstring("returned a string")))
+			})
+		})
+	})
+
+	Describe("on_response", func() {
+		BeforeEach(func() {
+			cfg.Source = []byte(`
+def on_response(req, resp):
+    if resp.status == 404 and req.path.startswith("/legacy/"):
+        resp.status = 410
+    resp.headers.add("X-Served-By", req.route.app_id)
+`)
+		})
+
+		It("changes the response", func() {
+			res := &http.Response{StatusCode: http.StatusNotFound, Header: http.Header{}, Request: req}
+
+			Expect(script.OnResponse(res, pool)).To(Succeed())
+			Expect(res.StatusCode).To(Equal(http.StatusGone))
+			Expect(res.Status).To(Equal("410 Gone"))
+			Expect(res.Header.Get("X-Served-By")).To(Equal("app-guid"))
+		})
+	})
+
+	Context("when the script is invalid", func() {
+		It("fails to load it", func() {
+			_, err := scripting.NewScript(config.ScriptingConfig{Path: "test.star", MaxSteps: 1000, Source: []byte("def on_request(:\n")}, logger)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("fails when a hook is not a function", func() {
+			_, err := scripting.NewScript(config.ScriptingConfig{Path: "test.star", MaxSteps: 1000, Source: []byte("on_request = 1\n")}, logger)
+			Expect(err).To(MatchError("on_request must be a function, not int"))
+		})
+	})
+})
@@ -0,0 +1,331 @@
+package scripting
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/gorouter/route"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// builtins are the values predeclared for scripts.
+var builtins = starlark.StringDict{
+	"response": starlark.NewBuiltin("response", newLocalResponse),
+}
+
+// request is a request passed to the hooks. Its method, host, path and query
+// can be assigned, and its headers changed.
+type request struct {
+	req  *http.Request
+	pool *route.Pool
+}
+
+var (
+	_ starlark.HasAttrs    = (*request)(nil)
+	_ starlark.HasSetField = (*request)(nil)
+)
+
+func newRequest(req *http.Request, pool *route.Pool) *request {
+	return &request{req: req, pool: pool}
+}
+
+func (r *request) String() string {
+	return fmt.Sprintf("<request %s %s%s>", r.req.Method, r.req.Host, r.req.URL.RequestURI())
+}
+func (r *request) Type() string          { return "request" }
+func (r *request) Freeze()               {}
+func (r *request) Truth() starlark.Bool  { return starlark.True }
+func (r *request) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: request") }
+
+func (r *request) AttrNames() []string {
+	return []string{"headers", "host", "method", "path", "query", "remote_addr", "route"}
+}
+
+func (r *request) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "headers":
+		return &headers{h: r.req.Header}, nil
+	case "host":
+		return starlark.String(r.req.Host), nil
+	case "method":
+		return starlark.String(r.req.Method), nil
+	case "path":
+		return starlark.String(r.req.URL.Path), nil
+	case "query":
+		return starlark.String(r.req.URL.RawQuery), nil
+	case "remote_addr":
+		return starlark.String(r.req.RemoteAddr), nil
+	case "route":
+		if r.pool == nil {
+			return starlark.None, nil
+		}
+		return starlarkstruct.FromStringDict(starlark.String("route"), starlark.StringDict{
+			"app_id":            starlark.String(r.pool.ApplicationId()),
+			"context_path":      starlark.String(r.pool.ContextPath()),
+			"route_service_url": starlark.String(r.pool.RouteServiceUrl()),
+		}), nil
+	}
+	return nil, nil
+}
+
+func (r *request) SetField(name string, v starlark.Value) error {
+	s, ok := starlark.AsString(v)
+	if !ok {
+		return fmt.Errorf("request.%s must be a string, not a %s", name, v.Type())
+	}
+	switch name {
+	case "host":
+		r.req.Host = s
+	case "method":
+		r.req.Method = s
+	case "path":
+		r.req.URL.Path, r.req.URL.RawPath = s, ""
+	case "query":
+		r.req.URL.RawQuery = s
+	default:
+		return starlark.NoSuchAttrError(fmt.Sprintf("can't assign to .%s field of request", name))
+	}
+	return nil
+}
+
+// response is the response of a backend passed to on_response, whose status
+// can be assigned and whose headers can be changed, or a response created by
+// on_request with the response builtin.
+type response struct {
+	res *http.Response
+}
+
+var (
+	_ starlark.HasAttrs    = (*response)(nil)
+	_ starlark.HasSetField = (*response)(nil)
+)
+
+// newLocalResponse implements response(status, body="", headers={}).
+func newLocalResponse(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var status int
+	var body string
+	var hdrs *starlark.Dict
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "status", &status, "body?", &body, "headers?", &hdrs); err != nil {
+		return nil, err
+	}
+	if status < 100 || status > 999 {
+		return nil, fmt.Errorf("%s: invalid status %d", b.Name(), status)
+	}
+
+	header := http.Header{}
+	if hdrs != nil {
+		for _, item := range hdrs.Items() {
+			name, ok1 := starlark.AsString(item[0])
+			value, ok2 := starlark.AsString(item[1])
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("%s: headers must map strings to strings", b.Name())
+			}
+			header.Set(name, value)
+		}
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	return &response{res: &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader([]byte(body))),
+		ContentLength: int64(len(body)),
+	}}, nil
+}
+
+func (r *response) String() string        { return fmt.Sprintf("<response %d>", r.res.StatusCode) }
+func (r *response) Type() string          { return "response" }
+func (r *response) Freeze()               {}
+func (r *response) Truth() starlark.Bool  { return starlark.True }
+func (r *response) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: response") }
+
+func (r *response) AttrNames() []string {
+	return []string{"headers", "status"}
+}
+
+func (r *response) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "headers":
+		return &headers{h: r.res.Header}, nil
+	case "status":
+		return starlark.MakeInt(r.res.StatusCode), nil
+	}
+	return nil, nil
+}
+
+func (r *response) SetField(name string, v starlark.Value) error {
+	if name != "status" {
+		return starlark.NoSuchAttrError(fmt.Sprintf("can't assign to .%s field of response", name))
+	}
+	var status int
+	if err := starlark.AsInt(v, &status); err != nil || status < 100 || status > 999 {
+		return fmt.Errorf("response.status must be an HTTP status, not %s", v)
+	}
+	r.res.StatusCode = status
+	r.res.Status = fmt.Sprintf("%d %s", status, http.StatusText(status))
+	return nil
+}
+
+// headers are the headers of a request or response. Indexing them returns
+// the values of a header joined by commas, and assigning to them replaces the
+// values of a header.
+type headers struct {
+	h http.Header
+}
+
+var (
+	_ starlark.Mapping   = (*headers)(nil)
+	_ starlark.HasSetKey = (*headers)(nil)
+	_ starlark.HasAttrs  = (*headers)(nil)
+	_ starlark.Iterable  = (*headers)(nil)
+)
+
+func (h *headers) String() string        { return fmt.Sprintf("<headers %d>", len(h.h)) }
+func (h *headers) Type() string          { return "headers" }
+func (h *headers) Freeze()               {}
+func (h *headers) Truth() starlark.Bool  { return starlark.Bool(len(h.h) > 0) }
+func (h *headers) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: headers") }
+
+func (h *headers) Get(k starlark.Value) (starlark.Value, bool, error) {
+	name, ok := starlark.AsString(k)
+	if !ok {
+		return nil, false, fmt.Errorf("header names are strings, not %s", k.Type())
+	}
+	values, found := h.h[http.CanonicalHeaderKey(name)]
+	if !found {
+		return nil, false, nil
+	}
+	return starlark.String(strings.Join(values, ",")), true, nil
+}
+
+func (h *headers) SetKey(k, v starlark.Value) error {
+	name, ok1 := starlark.AsString(k)
+	value, ok2 := starlark.AsString(v)
+	if !ok1 || !ok2 {
+		return fmt.Errorf("headers map strings to strings, not %s to %s", k.Type(), v.Type())
+	}
+	h.h.Set(name, value)
+	return nil
+}
+
+func (h *headers) Iterate() starlark.Iterator {
+	names := make([]starlark.Value, 0, len(h.h))
+	for _, name := range h.names() {
+		names = append(names, starlark.String(name))
+	}
+	return starlark.NewList(names).Iterate()
+}
+
+func (h *headers) names() []string {
+	names := make([]string, 0, len(h.h))
+	for name := range h.h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (h *headers) AttrNames() []string {
+	return []string{"add", "get", "remove"}
+}
+
+func (h *headers) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "add":
+		return starlark.NewBuiltin("add", h.add).BindReceiver(h), nil
+	case "get":
+		return starlark.NewBuiltin("get", h.get).BindReceiver(h), nil
+	case "remove":
+		return starlark.NewBuiltin("remove", h.remove).BindReceiver(h), nil
+	}
+	return nil, nil
+}
+
+func (h *headers) add(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name, value string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &name, &value); err != nil {
+		return nil, err
+	}
+	h.h.Add(name, value)
+	return starlark.None, nil
+}
+
+func (h *headers) get(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name starlark.Value
+	var def starlark.Value = starlark.None
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &name, &def); err != nil {
+		return nil, err
+	}
+	v, found, err := h.Get(name)
+	if err != nil || !found {
+		return def, err
+	}
+	return v, nil
+}
+
+func (h *headers) remove(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &name); err != nil {
+		return nil, err
+	}
+	h.h.Del(name)
+	return starlark.None, nil
+}
+
+// endpoint is an endpoint of a route passed to on_backend_select.
+type endpoint struct {
+	e *route.Endpoint
+}
+
+var _ starlark.HasAttrs = (*endpoint)(nil)
+
+func (e *endpoint) String() string        { return fmt.Sprintf("<endpoint %s>", e.e.CanonicalAddr()) }
+func (e *endpoint) Type() string          { return "endpoint" }
+func (e *endpoint) Freeze()               {}
+func (e *endpoint) Truth() starlark.Bool  { return starlark.True }
+func (e *endpoint) Hash() (uint32, error) { return starlark.String(e.e.CanonicalAddr()).Hash() }
+
+func (e *endpoint) AttrNames() []string {
+	return []string{"address", "app_id", "backup", "connections", "group", "index", "instance_id", "tags", "weight", "zone"}
+}
+
+func (e *endpoint) Attr(name string) (starlark.Value, error) {
+	switch name {
+	case "address":
+		return starlark.String(e.e.CanonicalAddr()), nil
+	case "app_id":
+		return starlark.String(e.e.ApplicationId), nil
+	case "backup":
+		return starlark.Bool(e.e.Backup), nil
+	case "connections":
+		return starlark.MakeInt64(e.e.Stats.NumberConnections.Count()), nil
+	case "group":
+		return starlark.String(e.e.Group), nil
+	case "index":
+		return starlark.String(e.e.PrivateInstanceIndex), nil
+	case "instance_id":
+		return starlark.String(e.e.PrivateInstanceId), nil
+	case "tags":
+		tags := starlark.NewDict(len(e.e.Tags))
+		for k, v := range e.e.Tags {
+			tags.SetKey(starlark.String(k), starlark.String(v))
+		}
+		tags.Freeze()
+		return tags, nil
+	case "weight":
+		return starlark.MakeInt(e.e.Weight), nil
+	case "zone":
+		return starlark.String(e.e.Zone), nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,337 @@
+package sessiontickets
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/gorouter/common/secure"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"github.com/nats-io/nats"
+	"github.com/uber-go/zap"
+)
+
+// Subject is the NATS subject on which routers share their session ticket
+// keys.
+const Subject = "gorouter.session_ticket_keys"
+
+// KeyStore uses the keys of a Rotator to encrypt and decrypt session tickets.
+// The first key encrypts tickets, and all keys decrypt them.
+type KeyStore interface {
+	SetSessionTicketKeys(keys [][32]byte)
+}
+
+// Message is a session ticket key shared over NATS. Key is encrypted with the
+// shared secret.
+type Message struct {
+	Epoch int64  `json:"epoch"`
+	Key   []byte `json:"key"`
+	Nonce []byte `json:"nonce"`
+}
+
+// Rotator rotates the session ticket keys of a store every rotation
+// interval.
+//
+// Time is divided into epochs of one rotation interval, so that routers whose
+// clocks agree rotate their keys together. For the nats source, each router
+// generates a key for the current and the next epoch unless it has received
+// one, and publishes it. When routers publish different keys for an epoch,
+// the lowest key encrypts tickets, and the others only decrypt them. A router
+// receiving a key it does not have publishes its keys of the epoch again, so
+// that routers starting later learn the keys of the others, and all routers
+// agree on the lowest key.
+type Rotator struct {
+	config     config.SessionTicketsConfig
+	store      KeyStore
+	natsClient *nats.Conn
+	crypto     secure.Crypto
+	logger     logger.Logger
+	clock      clock.Clock
+
+	lock         sync.Mutex
+	keys         map[int64][][32]byte
+	subscription *nats.Subscription
+}
+
+// NewRotator passes the first keys to the store. For the file source, it
+// returns an error if the file cannot be read.
+func NewRotator(
+	logger logger.Logger,
+	cfg config.SessionTicketsConfig,
+	store KeyStore,
+	natsClient *nats.Conn,
+	clock clock.Clock,
+) (*Rotator, error) {
+	r := &Rotator{
+		config:     cfg,
+		store:      store,
+		natsClient: natsClient,
+		logger:     logger,
+		clock:      clock,
+		keys:       map[int64][][32]byte{},
+	}
+
+	switch cfg.Source {
+	case config.SESSION_TICKET_KEYS_FILE:
+		keys, err := readKeys(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		store.SetSessionTicketKeys(keys)
+		return r, nil
+	case config.SESSION_TICKET_KEYS_NATS:
+		if natsClient == nil {
+			return nil, errors.New("sessiontickets: the nats source requires a NATS client")
+		}
+		crypto, err := secure.NewAesGCM(secure.NewPbkdf2([]byte(cfg.Secret), 16))
+		if err != nil {
+			return nil, err
+		}
+		r.crypto = crypto
+	}
+
+	if _, err := r.rotate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Rotator) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	if r.config.Source == config.SESSION_TICKET_KEYS_NATS {
+		subscription, err := r.natsClient.Subscribe(Subject, func(msg *nats.Msg) {
+			r.receive(msg.Data)
+		})
+		if err != nil {
+			return err
+		}
+		r.subscription = subscription
+		r.publishAll()
+	}
+
+	timer := r.clock.NewTimer(r.untilNextEpoch())
+	r.logger.Info("session-ticket-rotator-started", zap.String("source", r.config.Source))
+
+	close(ready)
+	for {
+		select {
+		case <-timer.C():
+			r.tick()
+			timer.Reset(r.untilNextEpoch())
+		case <-signals:
+			r.logger.Info("stopping")
+			timer.Stop()
+			if r.subscription != nil {
+				_ = r.subscription.Unsubscribe()
+			}
+			return nil
+		}
+	}
+}
+
+// tick reads the file of the file source again, or rotates the keys of the
+// other sources.
+func (r *Rotator) tick() {
+	if r.config.Source == config.SESSION_TICKET_KEYS_FILE {
+		keys, err := readKeys(r.config.File)
+		if err != nil {
+			r.logger.Error("session-ticket-keys-file-failed", zap.String("file", r.config.File), zap.Error(err))
+			return
+		}
+		r.store.SetSessionTicketKeys(keys)
+		r.logger.Info("session-ticket-keys-reloaded", zap.Int("keys", len(keys)))
+		return
+	}
+
+	generated, err := r.rotate()
+	if err != nil {
+		r.logger.Error("session-ticket-key-generation-failed", zap.Error(err))
+		return
+	}
+	for _, epoch := range generated {
+		r.publish(epoch)
+	}
+	r.logger.Info("session-ticket-keys-rotated", zap.Int64("epoch", r.epoch()))
+}
+
+// rotate generates the keys of the current epoch, and of the next epoch for
+// the nats source, unless they exist, drops the keys of epochs that are too
+// old, and passes the keys to the store. It returns the epochs whose keys it
+// generated.
+func (r *Rotator) rotate() ([]int64, error) {
+	current := r.epoch()
+	epochs := []int64{current}
+	if r.config.Source == config.SESSION_TICKET_KEYS_NATS {
+		epochs = append(epochs, current+1)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var generated []int64
+	for _, epoch := range epochs {
+		if len(r.keys[epoch]) > 0 {
+			continue
+		}
+		var key [32]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return nil, err
+		}
+		r.keys[epoch] = [][32]byte{key}
+		generated = append(generated, epoch)
+	}
+	for epoch := range r.keys {
+		if !r.keep(epoch, current) {
+			delete(r.keys, epoch)
+		}
+	}
+	r.updateStore(current)
+	return generated, nil
+}
+
+// receive adds a key published by a router, and publishes the keys of its
+// epoch again if it is new.
+func (r *Rotator) receive(data []byte) {
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		r.logger.Error("session-ticket-key-invalid", zap.Error(err))
+		return
+	}
+	plainText, err := r.crypto.Decrypt(msg.Key, msg.Nonce)
+	if err != nil || len(plainText) != 32 {
+		r.logger.Error("session-ticket-key-undecryptable", zap.Int64("epoch", msg.Epoch))
+		return
+	}
+	var key [32]byte
+	copy(key[:], plainText)
+
+	current := r.epoch()
+	r.lock.Lock()
+	if !r.keep(msg.Epoch, current) || contains(r.keys[msg.Epoch], key) {
+		r.lock.Unlock()
+		return
+	}
+	republish := len(r.keys[msg.Epoch]) > 0
+	keys := append(r.keys[msg.Epoch], key)
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i][:], keys[j][:]) < 0 })
+	r.keys[msg.Epoch] = keys
+	r.updateStore(current)
+	r.lock.Unlock()
+
+	r.logger.Debug("session-ticket-key-received", zap.Int64("epoch", msg.Epoch))
+	if republish {
+		r.publish(msg.Epoch)
+	}
+}
+
+// publishAll publishes the keys of the current and the next epoch.
+func (r *Rotator) publishAll() {
+	current := r.epoch()
+	r.publish(current)
+	r.publish(current + 1)
+}
+
+// publish publishes the keys of the epoch.
+func (r *Rotator) publish(epoch int64) {
+	if r.config.Source != config.SESSION_TICKET_KEYS_NATS {
+		return
+	}
+	r.lock.Lock()
+	keys := append([][32]byte{}, r.keys[epoch]...)
+	r.lock.Unlock()
+
+	for _, key := range keys {
+		if err := r.publishKey(epoch, key); err != nil {
+			r.logger.Error("session-ticket-key-publish-failed", zap.Int64("epoch", epoch), zap.Error(err))
+		}
+	}
+}
+
+func (r *Rotator) publishKey(epoch int64, key [32]byte) error {
+	cipherText, nonce, err := r.crypto.Encrypt(key[:])
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(Message{Epoch: epoch, Key: cipherText, Nonce: nonce})
+	if err != nil {
+		return err
+	}
+	return r.natsClient.Publish(Subject, data)
+}
+
+// updateStore passes the keys to the store, with the key encrypting tickets
+// first, followed by the other keys of the current epoch, the keys of the
+// next epoch, which routers whose clocks are ahead already encrypt with, and
+// the keys of previous epochs. It must be called with the lock held.
+func (r *Rotator) updateStore(current int64) {
+	var keys [][32]byte
+	keys = append(keys, r.keys[current]...)
+	keys = append(keys, r.keys[current+1]...)
+	for epoch := current - 1; epoch >= current-int64(r.config.PreviousKeys); epoch-- {
+		keys = append(keys, r.keys[epoch]...)
+	}
+	r.store.SetSessionTicketKeys(keys)
+}
+
+// keep returns whether the keys of the epoch are kept in the current epoch.
+func (r *Rotator) keep(epoch, current int64) bool {
+	return epoch >= current-int64(r.config.PreviousKeys) && epoch <= current+1
+}
+
+func (r *Rotator) epoch() int64 {
+	return r.clock.Now().UnixNano() / int64(r.config.RotationInterval)
+}
+
+// untilNextEpoch returns the time until the next epoch starts.
+func (r *Rotator) untilNextEpoch() time.Duration {
+	if r.config.Source == config.SESSION_TICKET_KEYS_FILE {
+		return r.config.RotationInterval
+	}
+	next := time.Unix(0, (r.epoch()+1)*int64(r.config.RotationInterval))
+	return next.Sub(r.clock.Now())
+}
+
+func contains(keys [][32]byte, key [32]byte) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// readKeys reads the keys in the file, which has one base64 encoded 32 byte
+// key per line. The first key encrypts tickets.
+func readKeys(path string) ([][32]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys [][32]byte
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(line)
+		if err != nil || len(decoded) != 32 {
+			return nil, fmt.Errorf("sessiontickets: line %d of %s is not a base64 encoded 32 byte key", i+1, path)
+		}
+		var key [32]byte
+		copy(key[:], decoded)
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("sessiontickets: %s has no keys", path)
+	}
+	return keys, nil
+}
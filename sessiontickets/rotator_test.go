@@ -0,0 +1,285 @@
+package sessiontickets_test
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/sessiontickets"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"github.com/nats-io/nats"
+	"github.com/tedsuo/ifrit"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+type fakeKeyStore struct {
+	lock sync.Mutex
+	keys [][32]byte
+}
+
+func (s *fakeKeyStore) SetSessionTicketKeys(keys [][32]byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.keys = keys
+}
+
+func (s *fakeKeyStore) Keys() [][32]byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.keys
+}
+
+func (s *fakeKeyStore) FirstKey() [32]byte {
+	keys := s.Keys()
+	if len(keys) == 0 {
+		return [32]byte{}
+	}
+	return keys[0]
+}
+
+func sameKeys(keys, otherKeys [][32]byte) bool {
+	if len(keys) != len(otherKeys) {
+		return false
+	}
+	for _, key := range keys {
+		found := false
+		for _, otherKey := range otherKeys {
+			found = found || key == otherKey
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+var _ = Describe("Rotator", func() {
+	var (
+		logger    *test_util.TestZapLogger
+		clock     *fakeclock.FakeClock
+		store     *fakeKeyStore
+		cfg       config.SessionTicketsConfig
+		rotator   *sessiontickets.Rotator
+		processes []ifrit.Process
+	)
+
+	run := func(r *sessiontickets.Rotator) {
+		process := ifrit.Invoke(r)
+		Eventually(process.Ready()).Should(BeClosed())
+		processes = append(processes, process)
+	}
+
+	BeforeEach(func() {
+		logger = test_util.NewTestZapLogger("test")
+		// the start of an epoch
+		clock = fakeclock.NewFakeClock(time.Unix(1000*60*60, 0))
+		store = &fakeKeyStore{}
+		cfg = config.SessionTicketsConfig{
+			RotationInterval: time.Hour,
+			PreviousKeys:     2,
+		}
+		processes = nil
+	})
+
+	AfterEach(func() {
+		for _, process := range processes {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive())
+		}
+	})
+
+	Context("with the local source", func() {
+		BeforeEach(func() {
+			cfg.Source = config.SESSION_TICKET_KEYS_LOCAL
+			var err error
+			rotator, err = sessiontickets.NewRotator(logger, cfg, store, nil, clock)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("sets a generated key", func() {
+			Expect(store.Keys()).To(HaveLen(1))
+			Expect(store.FirstKey()).ToNot(Equal([32]byte{}))
+		})
+
+		It("rotates the key every rotation interval, keeping the previous keys", func() {
+			first := store.FirstKey()
+			run(rotator)
+
+			clock.WaitForWatcherAndIncrement(time.Hour)
+			Eventually(store.Keys).Should(HaveLen(2))
+			Expect(store.FirstKey()).ToNot(Equal(first))
+			Expect(store.Keys()[1]).To(Equal(first))
+
+			clock.WaitForWatcherAndIncrement(time.Hour)
+			Eventually(store.Keys).Should(HaveLen(3))
+			Expect(store.Keys()[2]).To(Equal(first))
+
+			clock.WaitForWatcherAndIncrement(time.Hour)
+			Eventually(store.Keys).ShouldNot(ContainElement(first))
+			Expect(store.Keys()).To(HaveLen(3))
+		})
+	})
+
+	Context("with the file source", func() {
+		var (
+			tmpDir string
+			keys   [][32]byte
+		)
+
+		writeKeys := func(keys ...[32]byte) {
+			var b []byte
+			for _, key := range keys {
+				b = append(b, []byte(base64.StdEncoding.EncodeToString(key[:])+"\n")...)
+			}
+			Expect(ioutil.WriteFile(cfg.File, b, 0600)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "sessiontickets")
+			Expect(err).ToNot(HaveOccurred())
+
+			keys = make([][32]byte, 3)
+			for i := range keys {
+				_, err := rand.Read(keys[i][:])
+				Expect(err).ToNot(HaveOccurred())
+			}
+			cfg.Source = config.SESSION_TICKET_KEYS_FILE
+			cfg.File = filepath.Join(tmpDir, "keys")
+			writeKeys(keys[0], keys[1])
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(tmpDir)
+		})
+
+		It("sets the keys in the file", func() {
+			_, err := sessiontickets.NewRotator(logger, cfg, store, nil, clock)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(store.Keys()).To(Equal(keys[:2]))
+		})
+
+		It("returns an error when the file does not exist", func() {
+			cfg.File = filepath.Join(tmpDir, "missing")
+			_, err := sessiontickets.NewRotator(logger, cfg, store, nil, clock)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("returns an error when a key is invalid", func() {
+			Expect(ioutil.WriteFile(cfg.File, []byte("not-a-key\n"), 0600)).To(Succeed())
+			_, err := sessiontickets.NewRotator(logger, cfg, store, nil, clock)
+			Expect(err).To(MatchError(ContainSubstring("line 1")))
+		})
+
+		Context("when the file changes", func() {
+			BeforeEach(func() {
+				var err error
+				rotator, err = sessiontickets.NewRotator(logger, cfg, store, nil, clock)
+				Expect(err).ToNot(HaveOccurred())
+				run(rotator)
+			})
+
+			It("reads the file again every rotation interval", func() {
+				writeKeys(keys[2], keys[0])
+				clock.WaitForWatcherAndIncrement(time.Hour)
+				Eventually(store.Keys).Should(Equal([][32]byte{keys[2], keys[0]}))
+			})
+
+			It("keeps the keys when the file is invalid", func() {
+				Expect(ioutil.WriteFile(cfg.File, []byte{}, 0600)).To(Succeed())
+				clock.WaitForWatcherAndIncrement(time.Hour)
+				Eventually(logger.Buffer()).Should(gbytes.Say("session-ticket-keys-file-failed"))
+				Expect(store.Keys()).To(Equal(keys[:2]))
+			})
+		})
+	})
+
+	Context("with the nats source", func() {
+		var (
+			natsRunner *test_util.NATSRunner
+			natsClient *nats.Conn
+		)
+
+		newRotator := func(cfg config.SessionTicketsConfig, store *fakeKeyStore) *sessiontickets.Rotator {
+			r, err := sessiontickets.NewRotator(logger, cfg, store, natsClient, clock)
+			Expect(err).ToNot(HaveOccurred())
+			return r
+		}
+
+		BeforeEach(func() {
+			natsRunner = test_util.NewNATSRunner(int(test_util.NextAvailPort()))
+			natsRunner.Start()
+			natsClient = natsRunner.MessageBus
+
+			cfg.Source = config.SESSION_TICKET_KEYS_NATS
+			cfg.Secret = "super-secret"
+		})
+
+		AfterEach(func() {
+			natsRunner.Stop()
+		})
+
+		It("returns an error without a NATS client", func() {
+			_, err := sessiontickets.NewRotator(logger, cfg, store, nil, clock)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("sets the generated keys of the current and the next epoch", func() {
+			newRotator(cfg, store)
+			Expect(store.Keys()).To(HaveLen(2))
+		})
+
+		Context("with several routers", func() {
+			var otherStore *fakeKeyStore
+
+			BeforeEach(func() {
+				otherStore = &fakeKeyStore{}
+				run(newRotator(cfg, store))
+				run(newRotator(cfg, otherStore))
+			})
+
+			It("encrypts tickets with the same key on all routers", func() {
+				Eventually(store.Keys).Should(HaveLen(4))
+				Eventually(otherStore.Keys).Should(HaveLen(4))
+				Eventually(store.FirstKey).Should(Equal(otherStore.FirstKey()))
+				Expect(otherStore.Keys()).To(ConsistOf(store.Keys()))
+			})
+
+			It("shares the keys of the next epoch when rotating", func() {
+				Eventually(otherStore.Keys).Should(HaveLen(4))
+				Eventually(store.FirstKey).Should(Equal(otherStore.FirstKey()))
+
+				previous := store.Keys()
+				clock.WaitForNWatchersAndIncrement(time.Hour, 2)
+				// a router receiving the key of the next epoch before rotating
+				// does not generate its own
+				Eventually(func() bool {
+					keys := store.Keys()
+					return len(keys) >= 5 && sameKeys(keys, otherStore.Keys())
+				}).Should(BeTrue())
+				Expect(store.FirstKey()).To(Equal(otherStore.FirstKey()))
+				Expect(store.Keys()).To(ContainElement(previous[0]))
+			})
+
+			It("ignores the keys of routers with another secret", func() {
+				Eventually(store.Keys).Should(HaveLen(4))
+				cfg.Secret = "other-secret"
+				strangerStore := &fakeKeyStore{}
+				run(newRotator(cfg, strangerStore))
+
+				Eventually(logger.Buffer()).Should(gbytes.Say("session-ticket-key-undecryptable"))
+				Consistently(store.Keys).Should(HaveLen(4))
+				Expect(store.Keys()).ToNot(ContainElement(strangerStore.FirstKey()))
+			})
+		})
+	})
+})
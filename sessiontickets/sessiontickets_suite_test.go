@@ -0,0 +1,13 @@
+package sessiontickets_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestSessionTickets(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "SessionTickets Suite")
+}
@@ -0,0 +1,250 @@
+package stapling
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"github.com/uber-go/zap"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	checkInterval   = time.Minute
+	retryInterval   = time.Minute
+	maxResponseSize = 1024 * 1024
+)
+
+var errNotStapleable = errors.New("stapling: certificate has no issuer or OCSP responder")
+
+// Stapler fetches the OCSP responses of certificates from the responders
+// named in them, and staples the responses that certify a certificate as good
+// to its handshakes, so that clients do not have to ask the responders
+// themselves.
+type Stapler struct {
+	config config.OCSPStaplingConfig
+	client *http.Client
+	logger logger.Logger
+	clock  clock.Clock
+
+	lock    sync.RWMutex
+	entries map[[sha256.Size]byte]*entry
+	updated chan struct{}
+}
+
+// entry is a certificate and its current OCSP response.
+type entry struct {
+	certificate *tls.Certificate
+	response    []byte
+	nextUpdate  time.Time
+	refreshAt   time.Time
+}
+
+func NewStapler(logger logger.Logger, cfg config.OCSPStaplingConfig, clock clock.Clock) *Stapler {
+	return &Stapler{
+		config:  cfg,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		logger:  logger,
+		clock:   clock,
+		entries: map[[sha256.Size]byte]*entry{},
+		updated: make(chan struct{}, 1),
+	}
+}
+
+// Update sets the certificates whose responses are stapled. The responses of
+// other certificates are dropped, and the responses of new certificates are
+// fetched by Run.
+func (s *Stapler) Update(certificates []*tls.Certificate) {
+	s.lock.Lock()
+	entries := make(map[[sha256.Size]byte]*entry, len(certificates))
+	for _, certificate := range certificates {
+		if len(certificate.Certificate) == 0 {
+			continue
+		}
+		fingerprint := sha256.Sum256(certificate.Certificate[0])
+		if e, ok := s.entries[fingerprint]; ok {
+			entries[fingerprint] = e
+			continue
+		}
+		entries[fingerprint] = &entry{certificate: certificate}
+	}
+	s.entries = entries
+	s.lock.Unlock()
+
+	select {
+	case s.updated <- struct{}{}:
+	default:
+	}
+}
+
+// Staple returns a copy of the certificate with its OCSP response, or the
+// certificate if it has no current response.
+func (s *Stapler) Staple(certificate *tls.Certificate) *tls.Certificate {
+	if len(certificate.Certificate) == 0 {
+		return certificate
+	}
+	s.lock.RLock()
+	e, ok := s.entries[sha256.Sum256(certificate.Certificate[0])]
+	var response []byte
+	if ok && s.clock.Now().Before(e.nextUpdate) {
+		response = e.response
+	}
+	s.lock.RUnlock()
+
+	if response == nil {
+		return certificate
+	}
+	stapled := *certificate
+	stapled.OCSPStaple = response
+	return &stapled
+}
+
+func (s *Stapler) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ticker := s.clock.NewTicker(checkInterval)
+	s.logger.Info("ocsp-stapler-started")
+
+	close(ready)
+	for {
+		select {
+		case <-s.updated:
+			s.Refresh()
+		case <-ticker.C():
+			s.Refresh()
+		case <-signals:
+			s.logger.Info("stopping")
+			ticker.Stop()
+			return nil
+		}
+	}
+}
+
+// Refresh fetches the responses that are due. A response that cannot be
+// fetched is retried a minute later, and the current response is stapled
+// until its next update.
+func (s *Stapler) Refresh() {
+	now := s.clock.Now()
+	due := map[[sha256.Size]byte]*entry{}
+	s.lock.RLock()
+	for fingerprint, e := range s.entries {
+		if !now.Before(e.refreshAt) {
+			due[fingerprint] = e
+		}
+	}
+	s.lock.RUnlock()
+
+	for fingerprint, e := range due {
+		response, err := s.fetch(e.certificate)
+
+		s.lock.Lock()
+		// the certificate may have been dropped while its response was fetched
+		if s.entries[fingerprint] != e {
+			s.lock.Unlock()
+			continue
+		}
+		switch {
+		case err == errNotStapleable:
+			e.refreshAt = now.Add(s.config.RefreshInterval)
+		case err != nil:
+			e.refreshAt = now.Add(retryInterval)
+		case response.Status != ocsp.Good:
+			e.response = nil
+			e.refreshAt = now.Add(s.config.RefreshInterval)
+		default:
+			e.response = response.Raw
+			e.nextUpdate = response.NextUpdate
+			e.refreshAt = s.refreshTime(now, response)
+		}
+		s.lock.Unlock()
+
+		subject := certificateSubject(e.certificate)
+		switch {
+		case err == errNotStapleable:
+			s.logger.Debug("ocsp-not-stapleable", zap.String("subject", subject))
+		case err != nil:
+			s.logger.Error("ocsp-fetch-failed", zap.String("subject", subject), zap.Error(err))
+		case response.Status != ocsp.Good:
+			s.logger.Error("ocsp-certificate-not-good", zap.String("subject", subject), zap.Int("status", response.Status))
+		default:
+			s.logger.Debug("ocsp-response-fetched", zap.String("subject", subject), zap.Time("next_update", response.NextUpdate))
+		}
+	}
+}
+
+// refreshTime returns when the response is fetched again, which is after the
+// refresh interval, or halfway to its next update if that is sooner.
+func (s *Stapler) refreshTime(now time.Time, response *ocsp.Response) time.Time {
+	refreshAt := now.Add(s.config.RefreshInterval)
+	if response.NextUpdate.IsZero() {
+		// responses without a next update are never stapled
+		return refreshAt
+	}
+	halfway := response.ThisUpdate.Add(response.NextUpdate.Sub(response.ThisUpdate) / 2)
+	if halfway.Before(refreshAt) {
+		refreshAt = halfway
+	}
+	if min := now.Add(retryInterval); refreshAt.Before(min) {
+		refreshAt = min
+	}
+	return refreshAt
+}
+
+// fetch requests the OCSP response of the certificate from the first
+// responder named in it.
+func (s *Stapler) fetch(certificate *tls.Certificate) (*ocsp.Response, error) {
+	if len(certificate.Certificate) < 2 {
+		return nil, errNotStapleable
+	}
+	leaf := certificate.Leaf
+	if leaf == nil {
+		var err error
+		leaf, err = x509.ParseCertificate(certificate.Certificate[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(leaf.OCSPServer) == 0 {
+		return nil, errNotStapleable
+	}
+	issuer, err := x509.ParseCertificate(certificate.Certificate[1])
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.client.Post(leaf.OCSPServer[0], "application/ocsp-request", bytes.NewReader(request))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("stapling: OCSP responder responded with %d", res.StatusCode)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	return ocsp.ParseResponseForCert(body, leaf, issuer)
+}
+
+func certificateSubject(certificate *tls.Certificate) string {
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return ""
+	}
+	return leaf.Subject.String()
+}
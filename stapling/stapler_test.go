@@ -0,0 +1,216 @@
+package stapling_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/stapling"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"golang.org/x/crypto/ocsp"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Stapler", func() {
+	var (
+		logger      *test_util.TestZapLogger
+		clock       *fakeclock.FakeClock
+		stapler     *stapling.Stapler
+		responder   *httptest.Server
+		caKey       *ecdsa.PrivateKey
+		caCert      *x509.Certificate
+		certificate *tls.Certificate
+		status      int32
+		failing     int32
+		requests    int32
+	)
+
+	createCertificate := func(ocspServer string) *tls.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: "example.com"},
+			DNSNames:     []string{"example.com"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+			OCSPServer:   []string{ocspServer},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		Expect(err).ToNot(HaveOccurred())
+		return &tls.Certificate{Certificate: [][]byte{der, caCert.Raw}, PrivateKey: key}
+	}
+
+	stapledResponse := func() *ocsp.Response {
+		stapled := stapler.Staple(certificate)
+		if stapled.OCSPStaple == nil {
+			return nil
+		}
+		response, err := ocsp.ParseResponse(stapled.OCSPStaple, caCert)
+		Expect(err).ToNot(HaveOccurred())
+		return response
+	}
+
+	BeforeEach(func() {
+		var err error
+		caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "CA"},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+		Expect(err).ToNot(HaveOccurred())
+		caCert, err = x509.ParseCertificate(der)
+		Expect(err).ToNot(HaveOccurred())
+
+		atomic.StoreInt32(&status, ocsp.Good)
+		atomic.StoreInt32(&failing, 0)
+		atomic.StoreInt32(&requests, 0)
+		responder = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			atomic.AddInt32(&requests, 1)
+			if atomic.LoadInt32(&failing) == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			body, err := ioutil.ReadAll(r.Body)
+			Expect(err).ToNot(HaveOccurred())
+			request, err := ocsp.ParseRequest(body)
+			Expect(err).ToNot(HaveOccurred())
+
+			now := clock.Now()
+			response, err := ocsp.CreateResponse(caCert, caCert, ocsp.Response{
+				Status:       int(atomic.LoadInt32(&status)),
+				SerialNumber: request.SerialNumber,
+				ThisUpdate:   now,
+				NextUpdate:   now.Add(4 * time.Hour),
+				RevokedAt:    now,
+			}, caKey)
+			Expect(err).ToNot(HaveOccurred())
+			w.Write(response)
+		}))
+
+		logger = test_util.NewTestZapLogger("test")
+		clock = fakeclock.NewFakeClock(time.Now())
+		stapler = stapling.NewStapler(logger, config.OCSPStaplingConfig{
+			Enabled:         true,
+			Timeout:         time.Second,
+			RefreshInterval: time.Hour,
+		}, clock)
+		certificate = createCertificate(responder.URL)
+		stapler.Update([]*tls.Certificate{certificate})
+	})
+
+	AfterEach(func() {
+		responder.Close()
+	})
+
+	It("does not staple certificates before their response is fetched", func() {
+		Expect(stapledResponse()).To(BeNil())
+	})
+
+	Context("when the responses are fetched", func() {
+		BeforeEach(func() {
+			stapler.Refresh()
+		})
+
+		It("staples the response to a copy of the certificate", func() {
+			response := stapledResponse()
+			Expect(response).ToNot(BeNil())
+			Expect(response.Status).To(Equal(ocsp.Good))
+			Expect(certificate.OCSPStaple).To(BeNil())
+		})
+
+		It("does not fetch responses again before they are due", func() {
+			clock.Increment(59 * time.Minute)
+			stapler.Refresh()
+			Expect(atomic.LoadInt32(&requests)).To(Equal(int32(1)))
+
+			clock.Increment(time.Minute)
+			stapler.Refresh()
+			Expect(atomic.LoadInt32(&requests)).To(Equal(int32(2)))
+		})
+
+		It("keeps the response until its next update when the responder fails", func() {
+			atomic.StoreInt32(&failing, 1)
+			clock.Increment(time.Hour)
+			stapler.Refresh()
+			Expect(logger.Buffer()).To(gbytes.Say("ocsp-fetch-failed"))
+			Expect(stapledResponse()).ToNot(BeNil())
+
+			clock.Increment(time.Minute)
+			stapler.Refresh()
+			Expect(atomic.LoadInt32(&requests)).To(Equal(int32(3)))
+
+			clock.Increment(3 * time.Hour)
+			Expect(stapledResponse()).To(BeNil())
+		})
+
+		It("stops stapling the responses of certificates that are no longer served", func() {
+			stapler.Update(nil)
+			Expect(stapledResponse()).To(BeNil())
+		})
+	})
+
+	Context("when the certificate is revoked", func() {
+		BeforeEach(func() {
+			atomic.StoreInt32(&status, ocsp.Revoked)
+			stapler.Refresh()
+		})
+
+		It("does not staple the response", func() {
+			Expect(logger.Buffer()).To(gbytes.Say("ocsp-certificate-not-good"))
+			Expect(stapledResponse()).To(BeNil())
+		})
+	})
+
+	Context("when the certificate has no issuer", func() {
+		BeforeEach(func() {
+			certificate.Certificate = certificate.Certificate[:1]
+			stapler.Update([]*tls.Certificate{certificate})
+			stapler.Refresh()
+		})
+
+		It("does not request its response", func() {
+			Expect(atomic.LoadInt32(&requests)).To(Equal(int32(0)))
+			Expect(stapledResponse()).To(BeNil())
+		})
+	})
+
+	Describe("Run", func() {
+		It("fetches the responses of updated certificates", func() {
+			signals := make(chan os.Signal)
+			ready := make(chan struct{})
+			errChan := make(chan error)
+			go func() {
+				errChan <- stapler.Run(signals, ready)
+			}()
+			Eventually(ready).Should(BeClosed())
+			Eventually(stapledResponse).ShouldNot(BeNil())
+
+			signals <- os.Interrupt
+			Eventually(errChan).Should(Receive(BeNil()))
+		})
+	})
+})
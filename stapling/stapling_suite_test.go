@@ -0,0 +1,13 @@
+package stapling_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestStapling(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Stapling Suite")
+}
@@ -0,0 +1,175 @@
+;; A proxy-wasm filter for the tests of the WebAssembly filters. Build with
+;;   wat2wasm filter.wat -o filter.wasm
+;;
+;; It adds the x-wasm-filter header with its plugin configuration to requests
+;; and responses. It denies requests with the x-wasm-deny header, appends "!"
+;; to the bodies of requests with the x-wasm-body header, and prefixes "wasm:"
+;; to the bodies of responses with it. It fails to start when it is configured
+;; with "fail".
+(module
+  (import "env" "proxy_log" (func $proxy_log (param i32 i32 i32) (result i32)))
+  (import "env" "proxy_get_buffer_bytes" (func $proxy_get_buffer_bytes (param i32 i32 i32 i32 i32) (result i32)))
+  (import "env" "proxy_set_buffer_bytes" (func $proxy_set_buffer_bytes (param i32 i32 i32 i32 i32) (result i32)))
+  (import "env" "proxy_get_header_map_value" (func $proxy_get_header_map_value (param i32 i32 i32 i32 i32) (result i32)))
+  (import "env" "proxy_add_header_map_value" (func $proxy_add_header_map_value (param i32 i32 i32 i32 i32) (result i32)))
+  (import "env" "proxy_send_local_response" (func $proxy_send_local_response (param i32 i32 i32 i32 i32 i32 i32 i32) (result i32)))
+
+  (memory (export "memory") 2)
+
+  (global $heap (mut i32) (i32.const 4096))
+  (global $config (mut i32) (i32.const 0))
+  (global $config_size (mut i32) (i32.const 0))
+
+  (data (i32.const 0) "x-wasm-filter")
+  (data (i32.const 16) "x-wasm-deny")
+  (data (i32.const 32) "x-wasm-body")
+  (data (i32.const 48) "denied")
+  (data (i32.const 56) "!")
+  (data (i32.const 64) "wasm:")
+  (data (i32.const 80) "configured")
+
+  (func (export "proxy_abi_version_0_2_1"))
+
+  ;; memory is allocated from the heap and never freed
+  (func (export "proxy_on_memory_allocate") (param $size i32) (result i32)
+    global.get $heap
+    local.get $size
+    i32.add
+    memory.size
+    i32.const 16
+    i32.shl
+    i32.gt_u
+    if
+      local.get $size
+      i32.const 16
+      i32.shr_u
+      i32.const 1
+      i32.add
+      memory.grow
+      drop
+    end
+    global.get $heap
+    global.get $heap
+    local.get $size
+    i32.add
+    global.set $heap)
+
+  (func (export "proxy_on_context_create") (param $context_id i32) (param $parent_id i32))
+
+  (func (export "proxy_on_vm_start") (param $root_id i32) (param $size i32) (result i32)
+    i32.const 1)
+
+  ;; the plugin configuration is kept at $config
+  (func (export "proxy_on_configure") (param $root_id i32) (param $size i32) (result i32)
+    i32.const 7
+    i32.const 0
+    local.get $size
+    i32.const 256
+    i32.const 260
+    call $proxy_get_buffer_bytes
+    drop
+    i32.const 256
+    i32.load
+    global.set $config
+    i32.const 260
+    i32.load
+    global.set $config_size
+    global.get $config_size
+    i32.const 4
+    i32.eq
+    if
+      global.get $config
+      i32.load
+      i32.const 0x6c696166
+      i32.eq
+      if
+        i32.const 0
+        return
+      end
+    end
+    i32.const 2
+    i32.const 80
+    i32.const 10
+    call $proxy_log
+    drop
+    i32.const 1)
+
+  (func (export "proxy_on_request_headers") (param $context_id i32) (param $headers i32) (param $end_of_stream i32) (result i32)
+    i32.const 0
+    i32.const 0
+    i32.const 13
+    global.get $config
+    global.get $config_size
+    call $proxy_add_header_map_value
+    drop
+    i32.const 0
+    i32.const 16
+    i32.const 11
+    i32.const 256
+    i32.const 260
+    call $proxy_get_header_map_value
+    i32.eqz
+    if
+      i32.const 403
+      i32.const 0
+      i32.const 0
+      i32.const 48
+      i32.const 6
+      i32.const 0
+      i32.const 0
+      i32.const -1
+      call $proxy_send_local_response
+      drop
+      i32.const 1
+      return
+    end
+    i32.const 0
+    i32.const 32
+    i32.const 11
+    i32.const 256
+    i32.const 260
+    call $proxy_get_header_map_value
+    i32.eqz)
+
+  (func (export "proxy_on_request_body") (param $context_id i32) (param $size i32) (param $end_of_stream i32) (result i32)
+    i32.const 0
+    local.get $size
+    i32.const 0
+    i32.const 56
+    i32.const 1
+    call $proxy_set_buffer_bytes
+    drop
+    i32.const 0)
+
+  (func (export "proxy_on_response_headers") (param $context_id i32) (param $headers i32) (param $end_of_stream i32) (result i32)
+    i32.const 2
+    i32.const 0
+    i32.const 13
+    global.get $config
+    global.get $config_size
+    call $proxy_add_header_map_value
+    drop
+    i32.const 2
+    i32.const 32
+    i32.const 11
+    i32.const 256
+    i32.const 260
+    call $proxy_get_header_map_value
+    i32.eqz)
+
+  (func (export "proxy_on_response_body") (param $context_id i32) (param $size i32) (param $end_of_stream i32) (result i32)
+    i32.const 1
+    i32.const 0
+    i32.const 0
+    i32.const 64
+    i32.const 5
+    call $proxy_set_buffer_bytes
+    drop
+    i32.const 0)
+
+  (func (export "proxy_on_done") (param $context_id i32) (result i32)
+    i32.const 1)
+
+  (func (export "proxy_on_log") (param $context_id i32))
+
+  (func (export "proxy_on_delete") (param $context_id i32)))
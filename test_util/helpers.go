@@ -90,9 +90,7 @@ func generateConfig(statusPort, proxyPort uint16, natsPorts ...uint16) *config.C
 
 	c.RouteServiceSecret = "kCvXxNMB0JO2vinxoru9Hg=="
 
-	c.Tracing = config.Tracing{
-		EnableZipkin: true,
-	}
+	c.Tracing.EnableZipkin = true
 
 	return c
 }
@@ -104,13 +102,16 @@ func CreateKeyPair(cname string) (keyPEM, certPEM []byte) {
 	Expect(err).ToNot(HaveOccurred())
 
 	subject := pkix.Name{Organization: []string{"xyz, Inc."}}
+	var dnsNames []string
 	if cname != "" {
 		subject.CommonName = cname
+		dnsNames = []string{cname}
 	}
 
 	tmpl := x509.Certificate{
 		SerialNumber:          serialNumber,
 		Subject:               subject,
+		DNSNames:              dnsNames,
 		SignatureAlgorithm:    x509.SHA256WithRSA,
 		NotBefore:             time.Now(),
 		NotAfter:              time.Now().Add(time.Hour), // valid for an hour
@@ -2,6 +2,7 @@ package test_util
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"strconv"
@@ -17,6 +18,9 @@ var natsCommand *exec.Cmd
 
 type NATSRunner struct {
 	port        int
+	command     string
+	jetStream   bool
+	storeDir    string
 	natsSession *gexec.Session
 	natsUrls    []string
 	MessageBus  *nats.Conn
@@ -24,7 +28,19 @@ type NATSRunner struct {
 
 func NewNATSRunner(port int) *NATSRunner {
 	return &NATSRunner{
-		port: port,
+		port:    port,
+		command: "gnatsd",
+	}
+}
+
+// NewJetStreamNATSRunner returns a runner of nats-server with JetStream
+// enabled, storing its streams in a temporary directory that is kept across
+// restarts.
+func NewJetStreamNATSRunner(port int) *NATSRunner {
+	return &NATSRunner{
+		port:      port,
+		command:   "nats-server",
+		jetStream: true,
 	}
 }
 
@@ -33,19 +49,27 @@ func (runner *NATSRunner) Start() {
 		panic("starting an already started NATS runner!!!")
 	}
 
-	_, err := exec.LookPath("gnatsd")
+	_, err := exec.LookPath(runner.command)
 	if err != nil {
-		fmt.Println("You need gnatsd installed!")
+		fmt.Printf("You need %s installed!\n", runner.command)
 		os.Exit(1)
 	}
 
-	cmd := exec.Command("gnatsd", "-p", strconv.Itoa(runner.port))
+	args := []string{"-p", strconv.Itoa(runner.port)}
+	if runner.jetStream {
+		if runner.storeDir == "" {
+			runner.storeDir, err = ioutil.TempDir("", "jetstream")
+			Expect(err).NotTo(HaveOccurred())
+		}
+		args = append(args, "-js", "-sd", runner.storeDir)
+	}
+	cmd := exec.Command(runner.command, args...)
 	sess, err := gexec.Start(
 		cmd,
-		gexec.NewPrefixedWriter("\x1b[32m[o]\x1b[34m[gnatsd]\x1b[0m ", ginkgo.GinkgoWriter),
-		gexec.NewPrefixedWriter("\x1b[91m[e]\x1b[34m[gnatsd]\x1b[0m ", ginkgo.GinkgoWriter),
+		gexec.NewPrefixedWriter("\x1b[32m[o]\x1b[34m["+runner.command+"]\x1b[0m ", ginkgo.GinkgoWriter),
+		gexec.NewPrefixedWriter("\x1b[91m[e]\x1b[34m["+runner.command+"]\x1b[0m ", ginkgo.GinkgoWriter),
 	)
-	Expect(err).NotTo(HaveOccurred(), "Make sure to have gnatsd on your path")
+	Expect(err).NotTo(HaveOccurred(), "Make sure to have "+runner.command+" on your path")
 
 	runner.natsSession = sess
 
@@ -64,6 +88,15 @@ func (runner *NATSRunner) Stop() {
 	runner.KillWithFire()
 }
 
+// Cleanup stops the server and removes the streams of a JetStream runner.
+func (runner *NATSRunner) Cleanup() {
+	runner.KillWithFire()
+	if runner.storeDir != "" {
+		os.RemoveAll(runner.storeDir)
+		runner.storeDir = ""
+	}
+}
+
 func (runner *NATSRunner) KillWithFire() {
 	if runner.natsSession != nil {
 		runner.natsSession.Kill().Wait(5 * time.Second)
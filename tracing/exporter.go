@@ -0,0 +1,216 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"github.com/uber-go/zap"
+)
+
+//go:generate counterfeiter -o fakes/fake_exporter.go . Exporter
+type Exporter interface {
+	Export(span *Span)
+}
+
+// OTLPExporter exports spans in batches to an OpenTelemetry collector over
+// OTLP/HTTP with JSON encoding. Spans are dropped when the queue of spans
+// waiting for export is full, and batches are dropped when they cannot be
+// posted.
+type OTLPExporter struct {
+	config config.OTLPConfig
+	client *http.Client
+	logger logger.Logger
+	queue  chan *Span
+}
+
+func NewOTLPExporter(logger logger.Logger, cfg config.OTLPConfig) *OTLPExporter {
+	return &OTLPExporter{
+		config: cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		logger: logger,
+		queue:  make(chan *Span, cfg.MaxQueueSize),
+	}
+}
+
+func (e *OTLPExporter) Export(span *Span) {
+	select {
+	case e.queue <- span:
+	default:
+		e.logger.Debug("span-dropped", zap.String("trace-id", span.TraceID.String()))
+	}
+}
+
+func (e *OTLPExporter) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ticker := time.NewTicker(e.config.FlushInterval)
+	defer ticker.Stop()
+	e.logger.Info("otlp-exporter-started", zap.String("endpoint", e.config.Endpoint))
+
+	close(ready)
+	batch := make([]*Span, 0, e.config.BatchSize)
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= e.config.BatchSize {
+				e.post(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				e.post(batch)
+				batch = batch[:0]
+			}
+		case <-signals:
+			e.logger.Info("stopping")
+			// export the spans of requests that completed before the
+			// router stopped
+			for len(e.queue) > 0 && len(batch) < e.config.MaxQueueSize {
+				batch = append(batch, <-e.queue)
+			}
+			if len(batch) > 0 {
+				e.post(batch)
+			}
+			return nil
+		}
+	}
+}
+
+func (e *OTLPExporter) post(spans []*Span) {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		e.logger.Error("otlp-marshal-failed", zap.Error(err))
+		return
+	}
+
+	req, err := http.NewRequest("POST", e.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		e.logger.Error("otlp-export-failed", zap.Error(err))
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		e.logger.Error("otlp-export-failed", zap.Error(err), zap.Int("spans", len(spans)))
+		return
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		err := fmt.Errorf("collector responded with status %d", res.StatusCode)
+		e.logger.Error("otlp-export-failed", zap.Error(err), zap.Int("spans", len(spans)))
+	}
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code int `json:"code,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func (e *OTLPExporter) request(spans []*Span) otlpRequest {
+	otlpSpans := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.TraceID.String(),
+			SpanID:            s.SpanID.String(),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes),
+			Status:            otlpStatus{Code: s.Status},
+		}
+		if s.ParentSpanID.IsValid() {
+			span.ParentSpanID = s.ParentSpanID.String()
+		}
+		otlpSpans = append(otlpSpans, span)
+	}
+
+	return otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: otlpAttributes(map[string]interface{}{"service.name": e.config.ServiceName}),
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "gorouter"},
+				Spans: otlpSpans,
+			}},
+		}},
+	}
+}
+
+// otlpAttributes returns the attributes as OTLP key values, sorted by key.
+func otlpAttributes(attributes map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		var value map[string]interface{}
+		switch v := attributes[k].(type) {
+		case string:
+			value = map[string]interface{}{"stringValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		kvs = append(kvs, otlpKeyValue{Key: k, Value: value})
+	}
+	return kvs
+}
@@ -0,0 +1,171 @@
+package tracing_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/gorouter/tracing"
+	"github.com/tedsuo/ifrit"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+type exportRequest struct {
+	header http.Header
+	body   map[string]interface{}
+}
+
+var _ = Describe("OTLPExporter", func() {
+	var (
+		logger    *test_util.TestZapLogger
+		cfg       config.OTLPConfig
+		collector *httptest.Server
+		requests  chan exportRequest
+		status    int
+		exporter  *tracing.OTLPExporter
+		process   ifrit.Process
+		span      *tracing.Span
+	)
+
+	BeforeEach(func() {
+		logger = test_util.NewTestZapLogger("test")
+		requests = make(chan exportRequest, 10)
+		status = http.StatusOK
+		collector = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, err := ioutil.ReadAll(r.Body)
+			Expect(err).ToNot(HaveOccurred())
+			var body map[string]interface{}
+			Expect(json.Unmarshal(b, &body)).To(Succeed())
+			requests <- exportRequest{header: r.Header, body: body}
+			w.WriteHeader(status)
+		}))
+
+		cfg = config.OTLPConfig{
+			Enabled:       true,
+			Endpoint:      collector.URL + "/v1/traces",
+			Headers:       map[string]string{"Authorization": "Bearer token"},
+			ServiceName:   "router",
+			BatchSize:     2,
+			MaxQueueSize:  10,
+			FlushInterval: time.Hour,
+			Timeout:       time.Second,
+		}
+
+		traceID, _ := tracing.ParseTraceID("0af7651916cd43dd8448eb211c80319c")
+		spanID, _ := tracing.ParseSpanID("b7ad6b7169203331")
+		parentID, _ := tracing.ParseSpanID("00f067aa0ba902b7")
+		span = &tracing.Span{
+			TraceID:      traceID,
+			SpanID:       spanID,
+			ParentSpanID: parentID,
+			Name:         "GET",
+			Kind:         tracing.SpanKindServer,
+			Start:        time.Unix(1, 0),
+			End:          time.Unix(1, 500),
+			Attributes: map[string]interface{}{
+				"url.path":                  "/foo",
+				"http.response.status_code": 502,
+			},
+			Status: tracing.StatusError,
+		}
+	})
+
+	JustBeforeEach(func() {
+		exporter = tracing.NewOTLPExporter(logger, cfg)
+		process = ifrit.Invoke(exporter)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+		collector.Close()
+	})
+
+	It("posts full batches of spans as OTLP JSON", func() {
+		exporter.Export(span)
+		Consistently(requests).ShouldNot(Receive())
+		exporter.Export(span)
+
+		var req exportRequest
+		Eventually(requests).Should(Receive(&req))
+		Expect(req.header.Get("Content-Type")).To(Equal("application/json"))
+		Expect(req.header.Get("Authorization")).To(Equal("Bearer token"))
+
+		resourceSpans := req.body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+		Expect(resourceSpans["resource"]).To(Equal(map[string]interface{}{
+			"attributes": []interface{}{
+				map[string]interface{}{"key": "service.name", "value": map[string]interface{}{"stringValue": "router"}},
+			},
+		}))
+
+		scopeSpans := resourceSpans["scopeSpans"].([]interface{})[0].(map[string]interface{})
+		spans := scopeSpans["spans"].([]interface{})
+		Expect(spans).To(HaveLen(2))
+		Expect(spans[0]).To(Equal(map[string]interface{}{
+			"traceId":           "0af7651916cd43dd8448eb211c80319c",
+			"spanId":            "b7ad6b7169203331",
+			"parentSpanId":      "00f067aa0ba902b7",
+			"name":              "GET",
+			"kind":              float64(2),
+			"startTimeUnixNano": "1000000000",
+			"endTimeUnixNano":   "1000000500",
+			"attributes": []interface{}{
+				map[string]interface{}{"key": "http.response.status_code", "value": map[string]interface{}{"intValue": "502"}},
+				map[string]interface{}{"key": "url.path", "value": map[string]interface{}{"stringValue": "/foo"}},
+			},
+			"status": map[string]interface{}{"code": float64(2)},
+		}))
+	})
+
+	Context("when the flush interval passes", func() {
+		BeforeEach(func() {
+			cfg.FlushInterval = 50 * time.Millisecond
+		})
+
+		It("posts the spans waiting for export", func() {
+			exporter.Export(span)
+			Eventually(requests).Should(Receive())
+		})
+	})
+
+	It("posts the spans waiting for export when signaled", func() {
+		exporter.Export(span)
+		process.Signal(os.Interrupt)
+		Eventually(requests).Should(Receive())
+	})
+
+	Context("when the collector responds with an error", func() {
+		BeforeEach(func() {
+			status = http.StatusServiceUnavailable
+		})
+
+		It("logs the failure", func() {
+			exporter.Export(span)
+			exporter.Export(span)
+			Eventually(logger.Buffer()).Should(gbytes.Say("otlp-export-failed"))
+		})
+	})
+})
+
+var _ = Describe("ParseTraceID", func() {
+	It("pads 64-bit trace IDs", func() {
+		id, ok := tracing.ParseTraceID("463ac35c9f6413ad")
+		Expect(ok).To(BeTrue())
+		Expect(id.String()).To(Equal("0000000000000000463ac35c9f6413ad"))
+	})
+
+	It("rejects invalid trace IDs", func() {
+		for _, s := range []string{"", "xyz", "00000000000000000000000000000000", "463ac35c9f6413a"} {
+			_, ok := tracing.ParseTraceID(s)
+			Expect(ok).To(BeFalse(), s)
+		}
+	})
+})
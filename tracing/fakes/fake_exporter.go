@@ -0,0 +1,41 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/gorouter/tracing"
+)
+
+type FakeExporter struct {
+	ExportStub        func(span *tracing.Span)
+	exportMutex       sync.RWMutex
+	exportArgsForCall []struct {
+		span *tracing.Span
+	}
+}
+
+func (fake *FakeExporter) Export(span *tracing.Span) {
+	fake.exportMutex.Lock()
+	fake.exportArgsForCall = append(fake.exportArgsForCall, struct {
+		span *tracing.Span
+	}{span})
+	fake.exportMutex.Unlock()
+	if fake.ExportStub != nil {
+		fake.ExportStub(span)
+	}
+}
+
+func (fake *FakeExporter) ExportCallCount() int {
+	fake.exportMutex.RLock()
+	defer fake.exportMutex.RUnlock()
+	return len(fake.exportArgsForCall)
+}
+
+func (fake *FakeExporter) ExportArgsForCall(i int) *tracing.Span {
+	fake.exportMutex.RLock()
+	defer fake.exportMutex.RUnlock()
+	return fake.exportArgsForCall[i].span
+}
+
+var _ tracing.Exporter = new(FakeExporter)
@@ -0,0 +1,106 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"time"
+
+	"code.cloudfoundry.org/gorouter/common/secure"
+)
+
+// SpanKindServer is the OTLP kind of spans of requests received by the
+// router.
+const SpanKindServer = 2
+
+// Status codes of spans, as in OTLP.
+const (
+	StatusUnset = 0
+	StatusOK    = 1
+	StatusError = 2
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// NewTraceID returns a random trace ID.
+func NewTraceID() (TraceID, error) {
+	var t TraceID
+	b, err := secure.RandomBytes(uint(len(t)))
+	if err != nil {
+		return t, err
+	}
+	copy(t[:], b)
+	return t, nil
+}
+
+// NewSpanID returns a random span ID.
+func NewSpanID() (SpanID, error) {
+	var s SpanID
+	b, err := secure.RandomBytes(uint(len(s)))
+	if err != nil {
+		return s, err
+	}
+	copy(s[:], b)
+	return s, nil
+}
+
+// ParseTraceID parses a trace ID of 16 or 32 hex digits. IDs of 16 digits,
+// as used by Zipkin, are padded with zeros.
+func ParseTraceID(s string) (TraceID, bool) {
+	var t TraceID
+	if len(s) != 16 && len(s) != 32 {
+		return t, false
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return t, false
+	}
+	copy(t[len(t)-len(b):], b)
+	return t, t.IsValid()
+}
+
+// ParseSpanID parses a span ID of 16 hex digits.
+func ParseSpanID(s string) (SpanID, bool) {
+	var id SpanID
+	if len(s) != 16 {
+		return id, false
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return id, false
+	}
+	copy(id[:], b)
+	return id, id.IsValid()
+}
+
+// Span is a timed operation within a trace, with attributes whose values are
+// strings, ints, float64s or bools.
+type Span struct {
+	TraceID      TraceID
+	SpanID       SpanID
+	ParentSpanID SpanID
+	Name         string
+	Kind         int
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]interface{}
+	Status       int
+}
@@ -0,0 +1,60 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"strings"
+)
+
+// ParseTraceparent parses the value of a W3C Trace Context traceparent
+// header, returning the trace ID, the ID of the parent span and whether the
+// caller sampled the trace.
+func ParseTraceparent(s string) (TraceID, SpanID, bool, bool) {
+	var (
+		traceID TraceID
+		spanID  SpanID
+	)
+
+	// version 00 has exactly four fields; later versions may append fields
+	parts := strings.SplitN(strings.TrimSpace(s), "-", 5)
+	if len(parts) < 4 {
+		return traceID, spanID, false, false
+	}
+	version, flags := parts[0], parts[3]
+	if len(version) != 2 || !isLowerHex(version) || version == "ff" ||
+		(version == "00" && len(parts) != 4) {
+		return traceID, spanID, false, false
+	}
+	if len(parts[1]) != 32 || !isLowerHex(parts[1]) || len(parts[2]) != 16 || !isLowerHex(parts[2]) ||
+		len(flags) != 2 || !isLowerHex(flags) {
+		return traceID, spanID, false, false
+	}
+
+	traceID, ok := ParseTraceID(parts[1])
+	if !ok {
+		return traceID, spanID, false, false
+	}
+	spanID, ok = ParseSpanID(parts[2])
+	if !ok {
+		return traceID, spanID, false, false
+	}
+	f, _ := hex.DecodeString(flags)
+	return traceID, spanID, f[0]&1 == 1, true
+}
+
+// FormatTraceparent returns the value of a version 00 traceparent header.
+func FormatTraceparent(traceID TraceID, spanID SpanID, sampled bool) string {
+	flags := "00"
+	if sampled {
+		flags = "01"
+	}
+	return "00-" + traceID.String() + "-" + spanID.String() + "-" + flags
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
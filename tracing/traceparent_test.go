@@ -0,0 +1,50 @@
+package tracing_test
+
+import (
+	"code.cloudfoundry.org/gorouter/tracing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Traceparent", func() {
+	It("parses traceparent headers", func() {
+		traceID, spanID, sampled, ok := tracing.ParseTraceparent("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+		Expect(ok).To(BeTrue())
+		Expect(traceID.String()).To(Equal("0af7651916cd43dd8448eb211c80319c"))
+		Expect(spanID.String()).To(Equal("b7ad6b7169203331"))
+		Expect(sampled).To(BeTrue())
+
+		_, _, sampled, ok = tracing.ParseTraceparent("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00")
+		Expect(ok).To(BeTrue())
+		Expect(sampled).To(BeFalse())
+	})
+
+	It("accepts fields appended by later versions", func() {
+		_, _, _, ok := tracing.ParseTraceparent("01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-extra")
+		Expect(ok).To(BeTrue())
+	})
+
+	It("rejects invalid traceparent headers", func() {
+		for _, s := range []string{
+			"",
+			"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331",
+			"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-extra",
+			"ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+			"00-0AF7651916CD43DD8448EB211C80319C-b7ad6b7169203331-01",
+			"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+			"00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01",
+			"00-463ac35c9f6413ad-b7ad6b7169203331-01",
+		} {
+			_, _, _, ok := tracing.ParseTraceparent(s)
+			Expect(ok).To(BeFalse(), s)
+		}
+	})
+
+	It("formats traceparent headers", func() {
+		traceID, _ := tracing.ParseTraceID("0af7651916cd43dd8448eb211c80319c")
+		spanID, _ := tracing.ParseSpanID("b7ad6b7169203331")
+		Expect(tracing.FormatTraceparent(traceID, spanID, true)).To(Equal("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"))
+		Expect(tracing.FormatTraceparent(traceID, spanID, false)).To(Equal("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00"))
+	})
+})
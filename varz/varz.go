@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	router_metrics "code.cloudfoundry.org/gorouter/metrics"
 	"code.cloudfoundry.org/gorouter/registry"
 	"code.cloudfoundry.org/gorouter/route"
 	"code.cloudfoundry.org/gorouter/stats"
@@ -34,6 +35,26 @@ type varz struct {
 	TopApps []topAppsEntry `json:"top10_app_requests"`
 
 	MillisSinceLastRegistryUpdate int64 `json:"ms_since_last_registry_update"`
+
+	Routes map[string]routeMetric `json:"routes,omitempty"`
+
+	TLS tlsMetric `json:"tls"`
+}
+
+// tlsMetric counts the handshakes of the TLS listener.
+type tlsMetric struct {
+	Handshakes        int64            `json:"handshakes"`
+	ResumedHandshakes int64            `json:"resumed_handshakes"`
+	ResumptionRate    float64          `json:"resumption_rate"`
+	Versions          map[string]int64 `json:"versions"`
+	CipherSuites      map[string]int64 `json:"cipher_suites"`
+	HandshakeFailures map[string]int64 `json:"handshake_failures"`
+	Connections       int              `json:"connections"`
+}
+
+type routeMetric struct {
+	Requests int64              `json:"requests"`
+	Latency  map[string]float64 `json:"latency"`
 }
 
 type httpMetric struct {
@@ -162,18 +183,22 @@ type Varz interface {
 	CaptureBadGateway()
 	CaptureRoutingRequest(b *route.Endpoint)
 	CaptureRoutingResponseLatency(b *route.Endpoint, statusCode int, startedAt time.Time, d time.Duration)
+	CaptureRouteResponseLatency(route string, d time.Duration)
 }
 
 type RealVarz struct {
 	sync.Mutex
-	r          *registry.RouteRegistry
-	activeApps *stats.ActiveApps
-	topApps    *stats.TopApps
+	r              *registry.RouteRegistry
+	routeLatencies *router_metrics.RouteLatencies
+	activeApps     *stats.ActiveApps
+	topApps        *stats.TopApps
 	varz
 }
 
-func NewVarz(r *registry.RouteRegistry) Varz {
-	x := &RealVarz{r: r}
+// NewVarz creates a Varz that also reports the latency percentiles of each
+// route when routeLatencies is not nil.
+func NewVarz(r *registry.RouteRegistry, routeLatencies *router_metrics.RouteLatencies) Varz {
+	x := &RealVarz{r: r, routeLatencies: routeLatencies}
 
 	x.activeApps = stats.NewActiveApps()
 	x.topApps = stats.NewTopApps()
@@ -181,6 +206,10 @@ func NewVarz(r *registry.RouteRegistry) Varz {
 	x.All = NewHttpMetric()
 	x.Tags.Component = make(map[string]*HttpMetric)
 
+	x.TLS.Versions = make(map[string]int64)
+	x.TLS.CipherSuites = make(map[string]int64)
+	x.TLS.HandshakeFailures = make(map[string]int64)
+
 	return x
 }
 
@@ -196,6 +225,10 @@ func (x *RealVarz) MarshalJSON() ([]byte, error) {
 	x.varz.MillisSinceLastRegistryUpdate = time.Since(x.r.TimeOfLastUpdate()).Nanoseconds() / millis_per_nano
 
 	x.updateTop()
+	x.updateRoutes()
+	if x.varz.TLS.Handshakes > 0 {
+		x.varz.TLS.ResumptionRate = float64(x.varz.TLS.ResumedHandshakes) / float64(x.varz.TLS.Handshakes)
+	}
 
 	d := make(map[string]interface{})
 	transform(x.varz.All, d)
@@ -219,6 +252,24 @@ func (x *RealVarz) updateTop() {
 	}
 }
 
+func (x *RealVarz) updateRoutes() {
+	if x.routeLatencies == nil {
+		return
+	}
+
+	x.varz.Routes = make(map[string]routeMetric)
+	for route, l := range x.routeLatencies.Snapshot() {
+		x.varz.Routes[route] = routeMetric{
+			Requests: l.Requests,
+			Latency: map[string]float64{
+				"50": l.P50.Seconds(),
+				"95": l.P95.Seconds(),
+				"99": l.P99.Seconds(),
+			},
+		}
+	}
+}
+
 func (x *RealVarz) ActiveApps() *stats.ActiveApps {
 	return x.activeApps
 }
@@ -275,6 +326,35 @@ func (x *RealVarz) CaptureRoutingResponseLatency(endpoint *route.Endpoint, statu
 	x.Unlock()
 }
 
+func (x *RealVarz) CaptureRouteResponseLatency(route string, d time.Duration) {
+	if x.routeLatencies != nil {
+		x.routeLatencies.CaptureRouteResponseLatency(route, d)
+	}
+}
+
+func (x *RealVarz) CaptureTLSHandshake(version, cipherSuite string, resumed bool) {
+	x.Lock()
+	x.varz.TLS.Handshakes++
+	x.varz.TLS.Versions[version]++
+	x.varz.TLS.CipherSuites[cipherSuite]++
+	if resumed {
+		x.varz.TLS.ResumedHandshakes++
+	}
+	x.Unlock()
+}
+
+func (x *RealVarz) CaptureTLSHandshakeFailure(reason string) {
+	x.Lock()
+	x.varz.TLS.HandshakeFailures[reason]++
+	x.Unlock()
+}
+
+func (x *RealVarz) CaptureTLSConnections(active int) {
+	x.Lock()
+	x.varz.TLS.Connections = active
+	x.Unlock()
+}
+
 func transform(x interface{}, y map[string]interface{}) error {
 	var b []byte
 	var err error
@@ -3,6 +3,7 @@ package varz_test
 import (
 	"code.cloudfoundry.org/gorouter/config"
 	"code.cloudfoundry.org/gorouter/logger"
+	"code.cloudfoundry.org/gorouter/metrics"
 	"code.cloudfoundry.org/gorouter/metrics/fakes"
 	"code.cloudfoundry.org/gorouter/registry"
 	"code.cloudfoundry.org/gorouter/route"
@@ -26,7 +27,7 @@ var _ = Describe("Varz", func() {
 	BeforeEach(func() {
 		logger = test_util.NewTestZapLogger("test")
 		Registry = registry.NewRouteRegistry(logger, config.DefaultConfig(), new(fakes.FakeRouteRegistryReporter))
-		Varz = NewVarz(Registry)
+		Varz = NewVarz(Registry, nil)
 	})
 
 	It("contains the following items", func() {
@@ -191,6 +192,50 @@ var _ = Describe("Varz", func() {
 		Expect(findValue(Varz, "latency", "95").(float64)).To(Equal(float64(duration) / float64(time.Second)))
 		Expect(findValue(Varz, "latency", "99").(float64)).To(Equal(float64(duration) / float64(time.Second)))
 	})
+
+	It("does not report routes unless their latencies are tracked", func() {
+		Varz.CaptureRouteResponseLatency("example.com", time.Millisecond)
+
+		b, err := json.Marshal(Varz)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(b)).ToNot(ContainSubstring(`"routes"`))
+	})
+
+	It("reports the handshakes and connections of the TLS listener", func() {
+		tlsReporter, ok := Varz.(metrics.TLSReporter)
+		Expect(ok).To(BeTrue())
+
+		tlsReporter.CaptureTLSHandshake("TLSv1.3", "TLS_AES_128_GCM_SHA256", false)
+		tlsReporter.CaptureTLSHandshake("TLSv1.3", "TLS_AES_128_GCM_SHA256", true)
+		tlsReporter.CaptureTLSHandshake("TLSv1.2", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", false)
+		tlsReporter.CaptureTLSHandshake("TLSv1.2", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", true)
+		tlsReporter.CaptureTLSHandshakeFailure("timeout")
+		tlsReporter.CaptureTLSConnections(3)
+
+		Expect(findValue(Varz, "tls", "handshakes")).To(Equal(float64(4)))
+		Expect(findValue(Varz, "tls", "resumed_handshakes")).To(Equal(float64(2)))
+		Expect(findValue(Varz, "tls", "resumption_rate")).To(Equal(0.5))
+		Expect(findValue(Varz, "tls", "versions", "TLSv1.3")).To(Equal(float64(2)))
+		Expect(findValue(Varz, "tls", "cipher_suites", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256")).To(Equal(float64(2)))
+		Expect(findValue(Varz, "tls", "handshake_failures", "timeout")).To(Equal(float64(1)))
+		Expect(findValue(Varz, "tls", "connections")).To(Equal(float64(3)))
+	})
+
+	Context("when the latencies of routes are tracked", func() {
+		BeforeEach(func() {
+			Varz = NewVarz(Registry, metrics.NewRouteLatencies(10))
+		})
+
+		It("reports latency percentiles per route", func() {
+			Varz.CaptureRouteResponseLatency("example.com", 2*time.Millisecond)
+			Varz.CaptureRouteResponseLatency("example.com", 2*time.Millisecond)
+
+			Expect(findValue(Varz, "routes", "example.com", "requests")).To(Equal(float64(2)))
+			Expect(findValue(Varz, "routes", "example.com", "latency", "50")).To(Equal(0.002))
+			Expect(findValue(Varz, "routes", "example.com", "latency", "95")).To(Equal(0.002))
+			Expect(findValue(Varz, "routes", "example.com", "latency", "99")).To(Equal(0.002))
+		})
+	})
 })
 
 // Extract value using key(s) from JSON data
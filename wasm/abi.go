@@ -0,0 +1,399 @@
+package wasm
+
+import (
+	"context"
+	"encoding/binary"
+	"net/http"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/uber-go/zap"
+)
+
+// Statuses returned by the host functions.
+const (
+	statusOK              = 0
+	statusNotFound        = 1
+	statusBadArgument     = 2
+	statusInternalFailure = 10
+	statusUnimplemented   = 12
+)
+
+// Buffers that the host functions read and modify.
+const (
+	bufferRequestBody         = 0
+	bufferResponseBody        = 1
+	bufferVMConfiguration     = 6
+	bufferPluginConfiguration = 7
+)
+
+// Log levels of proxy_log.
+const (
+	logLevelTrace = 0
+	logLevelInfo  = 2
+	logLevelWarn  = 3
+)
+
+// hostFunction is a function of the proxy-wasm ABI that modules import from
+// the host. All of them return a status.
+type hostFunction struct {
+	name   string
+	params []api.ValueType
+	fn     func(ctx context.Context, mod api.Module, params []uint64) uint32
+}
+
+var (
+	i32 = api.ValueTypeI32
+	i64 = api.ValueTypeI64
+)
+
+// hostFunctions are the functions of the ABI. Timers, metrics, shared data,
+// queues and calls to other services are not implemented; the functions are
+// provided so that modules that import them can be instantiated.
+var hostFunctions = []hostFunction{
+	{"proxy_log", []api.ValueType{i32, i32, i32}, proxyLog},
+	{"proxy_get_log_level", []api.ValueType{i32}, proxyGetLogLevel},
+	{"proxy_get_current_time_nanoseconds", []api.ValueType{i32}, proxyGetCurrentTimeNanoseconds},
+	{"proxy_get_property", []api.ValueType{i32, i32, i32, i32}, notFound},
+	{"proxy_set_property", []api.ValueType{i32, i32, i32, i32}, unimplemented},
+	{"proxy_get_buffer_bytes", []api.ValueType{i32, i32, i32, i32, i32}, proxyGetBufferBytes},
+	{"proxy_set_buffer_bytes", []api.ValueType{i32, i32, i32, i32, i32}, proxySetBufferBytes},
+	{"proxy_get_header_map_pairs", []api.ValueType{i32, i32, i32}, proxyGetHeaderMapPairs},
+	{"proxy_set_header_map_pairs", []api.ValueType{i32, i32, i32}, proxySetHeaderMapPairs},
+	{"proxy_get_header_map_value", []api.ValueType{i32, i32, i32, i32, i32}, proxyGetHeaderMapValue},
+	{"proxy_add_header_map_value", []api.ValueType{i32, i32, i32, i32, i32}, proxyAddHeaderMapValue},
+	{"proxy_replace_header_map_value", []api.ValueType{i32, i32, i32, i32, i32}, proxyReplaceHeaderMapValue},
+	{"proxy_remove_header_map_value", []api.ValueType{i32, i32, i32}, proxyRemoveHeaderMapValue},
+	{"proxy_send_local_response", []api.ValueType{i32, i32, i32, i32, i32, i32, i32, i32}, proxySendLocalResponse},
+	{"proxy_continue_stream", []api.ValueType{i32}, ok},
+	{"proxy_close_stream", []api.ValueType{i32}, ok},
+	{"proxy_set_effective_context", []api.ValueType{i32}, ok},
+	{"proxy_done", nil, ok},
+	{"proxy_set_tick_period_milliseconds", []api.ValueType{i32}, unimplemented},
+	{"proxy_http_call", []api.ValueType{i32, i32, i32, i32, i32, i32, i32, i32, i32, i32}, unimplemented},
+	{"proxy_call_foreign_function", []api.ValueType{i32, i32, i32, i32, i32, i32}, unimplemented},
+	{"proxy_define_metric", []api.ValueType{i32, i32, i32, i32}, unimplemented},
+	{"proxy_increment_metric", []api.ValueType{i32, i64}, unimplemented},
+	{"proxy_record_metric", []api.ValueType{i32, i64}, unimplemented},
+	{"proxy_get_metric", []api.ValueType{i32, i32}, unimplemented},
+	{"proxy_get_shared_data", []api.ValueType{i32, i32, i32, i32, i32}, unimplemented},
+	{"proxy_set_shared_data", []api.ValueType{i32, i32, i32, i32, i32}, unimplemented},
+	{"proxy_register_shared_queue", []api.ValueType{i32, i32, i32}, unimplemented},
+	{"proxy_resolve_shared_queue", []api.ValueType{i32, i32, i32, i32, i32}, unimplemented},
+	{"proxy_dequeue_shared_queue", []api.ValueType{i32, i32, i32}, unimplemented},
+	{"proxy_enqueue_shared_queue", []api.ValueType{i32, i32, i32}, unimplemented},
+}
+
+// instantiateHost instantiates the host functions as the env module, which
+// modules implementing the ABI import them from.
+func instantiateHost(ctx context.Context, r wazero.Runtime) error {
+	b := r.NewHostModuleBuilder("env")
+	for _, f := range hostFunctions {
+		fn := f.fn
+		b.NewFunctionBuilder().
+			WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, mod api.Module, stack []uint64) {
+				stack[0] = api.EncodeU32(fn(ctx, mod, stack))
+			}), f.params, []api.ValueType{i32}).
+			Export(f.name)
+	}
+	_, err := b.Instantiate(ctx)
+	return err
+}
+
+func ok(context.Context, api.Module, []uint64) uint32 {
+	return statusOK
+}
+
+func notFound(context.Context, api.Module, []uint64) uint32 {
+	return statusNotFound
+}
+
+func unimplemented(context.Context, api.Module, []uint64) uint32 {
+	return statusUnimplemented
+}
+
+func proxyLog(ctx context.Context, mod api.Module, params []uint64) uint32 {
+	ex := exchangeOf(ctx)
+	msg, found := read(mod, params[1], params[2])
+	if ex == nil || !found {
+		return statusBadArgument
+	}
+
+	level := api.DecodeU32(params[0])
+	switch {
+	case level < logLevelInfo:
+		ex.plugin.logger.Debug("wasm-log", zap.String("message", string(msg)))
+	case level < logLevelWarn:
+		ex.plugin.logger.Info("wasm-log", zap.String("message", string(msg)))
+	default:
+		ex.plugin.logger.Error("wasm-log", zap.String("message", string(msg)))
+	}
+	return statusOK
+}
+
+// proxyGetLogLevel returns the lowest level, so that the messages of all
+// levels are passed to the logger of the router, which filters them.
+func proxyGetLogLevel(ctx context.Context, mod api.Module, params []uint64) uint32 {
+	if !mod.Memory().WriteUint32Le(api.DecodeU32(params[0]), logLevelTrace) {
+		return statusBadArgument
+	}
+	return statusOK
+}
+
+func proxyGetCurrentTimeNanoseconds(ctx context.Context, mod api.Module, params []uint64) uint32 {
+	if !mod.Memory().WriteUint64Le(api.DecodeU32(params[0]), uint64(time.Now().UnixNano())) {
+		return statusBadArgument
+	}
+	return statusOK
+}
+
+func proxyGetBufferBytes(ctx context.Context, mod api.Module, params []uint64) uint32 {
+	ex := exchangeOf(ctx)
+	if ex == nil {
+		return statusBadArgument
+	}
+	buf, found := ex.buffer(api.DecodeU32(params[0]))
+	if !found {
+		return statusNotFound
+	}
+
+	start, size := int(api.DecodeU32(params[1])), int(api.DecodeU32(params[2]))
+	if start > len(*buf) {
+		return statusBadArgument
+	}
+	end := len(*buf)
+	if size < end-start {
+		end = start + size
+	}
+	return ex.write(ctx, mod, (*buf)[start:end], params[3], params[4])
+}
+
+// proxySetBufferBytes replaces the bytes of the buffer from start to start
+// plus size with the data.
+func proxySetBufferBytes(ctx context.Context, mod api.Module, params []uint64) uint32 {
+	ex := exchangeOf(ctx)
+	if ex == nil {
+		return statusBadArgument
+	}
+	buf, found := ex.buffer(api.DecodeU32(params[0]))
+	if !found {
+		return statusNotFound
+	}
+	data, found := read(mod, params[3], params[4])
+	if !found {
+		return statusBadArgument
+	}
+
+	start, size := int(api.DecodeU32(params[1])), int(api.DecodeU32(params[2]))
+	if start > len(*buf) {
+		start = len(*buf)
+	}
+	end := len(*buf)
+	if size < end-start {
+		end = start + size
+	}
+	b := make([]byte, 0, len(*buf)-(end-start)+len(data))
+	b = append(b, (*buf)[:start]...)
+	b = append(b, data...)
+	b = append(b, (*buf)[end:]...)
+	*buf = b
+	return statusOK
+}
+
+func proxyGetHeaderMapPairs(ctx context.Context, mod api.Module, params []uint64) uint32 {
+	ex := exchangeOf(ctx)
+	if ex == nil {
+		return statusBadArgument
+	}
+	pairs, found := ex.pairs(api.DecodeU32(params[0]))
+	if !found {
+		return statusNotFound
+	}
+	return ex.write(ctx, mod, encodePairs(pairs), params[1], params[2])
+}
+
+func proxySetHeaderMapPairs(ctx context.Context, mod api.Module, params []uint64) uint32 {
+	ex := exchangeOf(ctx)
+	data, found := read(mod, params[1], params[2])
+	if ex == nil || !found {
+		return statusBadArgument
+	}
+	pairs, valid := decodePairs(data)
+	if !valid {
+		return statusBadArgument
+	}
+	if !ex.setPairs(api.DecodeU32(params[0]), pairs) {
+		return statusNotFound
+	}
+	return statusOK
+}
+
+func proxyGetHeaderMapValue(ctx context.Context, mod api.Module, params []uint64) uint32 {
+	ex := exchangeOf(ctx)
+	name, found := read(mod, params[1], params[2])
+	if ex == nil || !found {
+		return statusBadArgument
+	}
+	value, found := ex.get(api.DecodeU32(params[0]), string(name))
+	if !found {
+		return statusNotFound
+	}
+	return ex.write(ctx, mod, []byte(value), params[3], params[4])
+}
+
+func proxyAddHeaderMapValue(ctx context.Context, mod api.Module, params []uint64) uint32 {
+	return setHeaderMapValue(ctx, mod, params, true)
+}
+
+func proxyReplaceHeaderMapValue(ctx context.Context, mod api.Module, params []uint64) uint32 {
+	return setHeaderMapValue(ctx, mod, params, false)
+}
+
+func setHeaderMapValue(ctx context.Context, mod api.Module, params []uint64, add bool) uint32 {
+	ex := exchangeOf(ctx)
+	name, nameFound := read(mod, params[1], params[2])
+	value, valueFound := read(mod, params[3], params[4])
+	if ex == nil || !nameFound || !valueFound {
+		return statusBadArgument
+	}
+	if !ex.set(api.DecodeU32(params[0]), string(name), string(value), add) {
+		return statusNotFound
+	}
+	return statusOK
+}
+
+func proxyRemoveHeaderMapValue(ctx context.Context, mod api.Module, params []uint64) uint32 {
+	ex := exchangeOf(ctx)
+	name, found := read(mod, params[1], params[2])
+	if ex == nil || !found {
+		return statusBadArgument
+	}
+	if !ex.remove(api.DecodeU32(params[0]), string(name)) {
+		return statusNotFound
+	}
+	return statusOK
+}
+
+func proxySendLocalResponse(ctx context.Context, mod api.Module, params []uint64) uint32 {
+	ex := exchangeOf(ctx)
+	if ex == nil || ex.request == nil {
+		return statusBadArgument
+	}
+	body, bodyFound := read(mod, params[3], params[4])
+	headers, headersFound := read(mod, params[5], params[6])
+	if !bodyFound || !headersFound {
+		return statusBadArgument
+	}
+	pairs, valid := decodePairs(headers)
+	if !valid {
+		return statusBadArgument
+	}
+
+	header := http.Header{}
+	for _, p := range pairs {
+		header.Add(p[0], p[1])
+	}
+	ex.setLocalResponse(int(api.DecodeU32(params[0])), header, append([]byte{}, body...))
+	return statusOK
+}
+
+// read returns the bytes of the memory of the module at ptr, which are only
+// valid until the module is called again. Empty data is valid anywhere.
+func read(mod api.Module, ptr, size uint64) ([]byte, bool) {
+	if api.DecodeU32(size) == 0 {
+		return nil, true
+	}
+	return mod.Memory().Read(api.DecodeU32(ptr), api.DecodeU32(size))
+}
+
+// write copies b to memory allocated by the module, and writes the address
+// and size of the copy to dataPtr and sizePtr.
+func (ex *exchange) write(ctx context.Context, mod api.Module, b []byte, dataPtr, sizePtr uint64) uint32 {
+	var addr uint32
+	if len(b) > 0 {
+		results, err := ex.instance.alloc.Call(ctx, uint64(len(b)))
+		if err != nil || len(results) == 0 {
+			return statusInternalFailure
+		}
+		addr = api.DecodeU32(results[0])
+		if !mod.Memory().Write(addr, b) {
+			return statusInternalFailure
+		}
+	}
+	if !mod.Memory().WriteUint32Le(api.DecodeU32(dataPtr), addr) || !mod.Memory().WriteUint32Le(api.DecodeU32(sizePtr), uint32(len(b))) {
+		return statusBadArgument
+	}
+	return statusOK
+}
+
+// buffer returns the buffer of the type. The bodies of requests and responses
+// are only available once they have been buffered for the plugin.
+func (ex *exchange) buffer(bufferType uint32) (*[]byte, bool) {
+	switch bufferType {
+	case bufferRequestBody:
+		return &ex.requestBody, ex.requestBuffered
+	case bufferResponseBody:
+		return &ex.responseBody, ex.responseBuffered
+	case bufferVMConfiguration:
+		return &[]byte{}, true
+	case bufferPluginConfiguration:
+		configuration := ex.plugin.configuration
+		return &configuration, true
+	}
+	return nil, false
+}
+
+// encodePairs serializes header pairs as the ABI does: the number of pairs,
+// the sizes of the name and the value of each pair, and then the name and the
+// value of each pair, each followed by a NUL byte.
+func encodePairs(pairs [][2]string) []byte {
+	size := 4
+	for _, p := range pairs {
+		size += 8 + len(p[0]) + len(p[1]) + 2
+	}
+	b := make([]byte, 4, size)
+	binary.LittleEndian.PutUint32(b, uint32(len(pairs)))
+	for _, p := range pairs {
+		b = appendUint32(b, uint32(len(p[0])))
+		b = appendUint32(b, uint32(len(p[1])))
+	}
+	for _, p := range pairs {
+		b = append(append(b, p[0]...), 0)
+		b = append(append(b, p[1]...), 0)
+	}
+	return b
+}
+
+// decodePairs deserializes header pairs serialized by encodePairs.
+func decodePairs(b []byte) ([][2]string, bool) {
+	if len(b) == 0 {
+		return nil, true
+	}
+	if len(b) < 4 {
+		return nil, false
+	}
+	n := int(binary.LittleEndian.Uint32(b))
+	if n > (len(b)-4)/8 {
+		return nil, false
+	}
+	sizes, data := b[4:4+8*n], b[4+8*n:]
+	pairs := make([][2]string, n)
+	for i := range pairs {
+		for j := 0; j < 2; j++ {
+			size := int(binary.LittleEndian.Uint32(sizes[8*i+4*j:]))
+			if size+1 > len(data) {
+				return nil, false
+			}
+			pairs[i][j] = string(data[:size])
+			data = data[size+1:]
+		}
+	}
+	return pairs, true
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
@@ -0,0 +1,235 @@
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/tetratelabs/wazero/api"
+)
+
+// Actions returned by the plugin from the callbacks of the headers and bodies
+// of requests and responses.
+const (
+	actionContinue = 0
+	actionPause    = 1
+)
+
+var errBodyTooLarge = errors.New("body is larger than wasm.max_body_size_bytes")
+
+type exchangeKey struct{}
+
+// exchange is the request and response that an instance is filtering, which
+// the host functions it calls read and modify.
+type exchange struct {
+	plugin   *Plugin
+	instance *instance
+
+	request         *http.Request
+	requestBody     []byte
+	requestBuffered bool
+
+	response         *http.Response
+	responseBody     []byte
+	responseBuffered bool
+
+	// local is the response the plugin sent instead of passing the request
+	// on, if any.
+	local *http.Response
+}
+
+// call calls fn of the instance, if the module exports it, with the exchange
+// available to the host functions. It returns the result of fn, or 0 when fn
+// does not return one. The instance is not used again after a call fails.
+func (ex *exchange) call(ctx context.Context, fn api.Function, params ...uint64) (uint64, error) {
+	if fn == nil {
+		return 0, nil
+	}
+	results, err := fn.Call(context.WithValue(ctx, exchangeKey{}, ex), params...)
+	if err != nil {
+		ex.instance.failed = true
+		return 0, err
+	}
+	if len(results) == 0 {
+		return 0, nil
+	}
+	return results[0], nil
+}
+
+func exchangeOf(ctx context.Context) *exchange {
+	ex, _ := ctx.Value(exchangeKey{}).(*exchange)
+	return ex
+}
+
+// Filter passes a request and its response through an instance of a plugin.
+// The headers of requests and responses are passed to the plugin. Their body
+// is only buffered and passed to the plugin when it pauses in the callback of
+// their headers.
+type Filter struct {
+	ctx context.Context
+	ex  *exchange
+	id  uint32
+}
+
+// NewFilter creates the context of a request in an idle instance of the
+// plugin. The filter must be closed to return the instance.
+func (p *Plugin) NewFilter(ctx context.Context) (*Filter, error) {
+	in, err := p.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	in.nextID++
+	f := &Filter{
+		ctx: ctx,
+		ex:  &exchange{plugin: p, instance: in},
+		id:  in.nextID,
+	}
+	if _, err := f.ex.call(ctx, in.onContextCreate, uint64(f.id), rootContextID); err != nil {
+		p.put(ctx, in)
+		return nil, err
+	}
+	return f, nil
+}
+
+// OnRequest passes the request to the plugin, which may modify it. It returns
+// the response of the plugin when the plugin responds to the request itself.
+func (f *Filter) OnRequest(req *http.Request) (*http.Response, error) {
+	ex, in := f.ex, f.ex.instance
+	ex.request = req
+
+	endOfStream := !hasBody(req.Body, req.ContentLength)
+	headers, _ := ex.pairs(mapRequestHeaders)
+	action, err := ex.call(f.ctx, in.onRequestHeaders, uint64(f.id), uint64(len(headers)), boolParam(endOfStream))
+	if err != nil || ex.local != nil || action != actionPause || endOfStream {
+		return ex.local, err
+	}
+
+	body, err := readBody(req.Body, f.ex.plugin.maxBodySize)
+	if err == errBodyTooLarge {
+		return newResponse(req, http.StatusRequestEntityTooLarge, nil, nil), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ex.requestBody, ex.requestBuffered = body, true
+	_, err = ex.call(f.ctx, in.onRequestBody, uint64(f.id), uint64(len(body)), boolParam(true))
+	if err != nil || ex.local != nil {
+		return ex.local, err
+	}
+
+	body = ex.requestBody
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.ContentLength = int64(len(body))
+	req.TransferEncoding = nil
+	return nil, nil
+}
+
+// OnResponse passes the response to the request to the plugin, which may
+// modify it. It returns the response to pass on, which is the response of the
+// plugin when the plugin replaces the response.
+func (f *Filter) OnResponse(res *http.Response) (*http.Response, error) {
+	ex, in := f.ex, f.ex.instance
+	ex.response = res
+
+	endOfStream := !hasBody(res.Body, res.ContentLength)
+	headers, _ := ex.pairs(mapResponseHeaders)
+	action, err := ex.call(f.ctx, in.onResponseHeaders, uint64(f.id), uint64(len(headers)), boolParam(endOfStream))
+	if err == nil && ex.local == nil && action == actionPause && !endOfStream {
+		err = f.onResponseBody(res)
+	}
+	if err != nil || ex.local != nil {
+		if res.Body != nil {
+			res.Body.Close()
+		}
+		return ex.local, err
+	}
+	return res, nil
+}
+
+func (f *Filter) onResponseBody(res *http.Response) error {
+	ex := f.ex
+	body, err := readBody(res.Body, ex.plugin.maxBodySize)
+	if err != nil {
+		return err
+	}
+	ex.responseBody, ex.responseBuffered = body, true
+	_, err = ex.call(f.ctx, ex.instance.onResponseBody, uint64(f.id), uint64(len(body)), boolParam(true))
+	if err != nil {
+		return err
+	}
+
+	body = ex.responseBody
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	res.ContentLength = int64(len(body))
+	res.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	res.TransferEncoding = nil
+	return nil
+}
+
+// Close deletes the context of the request, and returns the instance to the
+// plugin.
+func (f *Filter) Close() {
+	ex, in := f.ex, f.ex.instance
+	id := uint64(f.id)
+	if _, err := ex.call(f.ctx, in.onDone, id); err == nil {
+		if _, err := ex.call(f.ctx, in.onLog, id); err == nil {
+			ex.call(f.ctx, in.onDelete, id)
+		}
+	}
+	ex.plugin.put(f.ctx, in)
+}
+
+// setLocalResponse makes the plugin respond to the request.
+func (ex *exchange) setLocalResponse(status int, header http.Header, body []byte) {
+	ex.local = newResponse(ex.request, status, header, body)
+}
+
+func newResponse(req *http.Request, status int, header http.Header, body []byte) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+func hasBody(body io.ReadCloser, contentLength int64) bool {
+	return body != nil && body != http.NoBody && contentLength != 0
+}
+
+// readBody reads and closes the body, which must not be larger than max.
+func readBody(body io.ReadCloser, max int64) ([]byte, error) {
+	defer body.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(body, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > max {
+		return nil, errBodyTooLarge
+	}
+	return b, nil
+}
+
+func boolParam(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,208 @@
+package wasm_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/test_util"
+	"code.cloudfoundry.org/gorouter/wasm"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Filter", func() {
+	var (
+		code    []byte
+		cfg     config.WasmConfig
+		logger  *test_util.TestZapLogger
+		plugins *wasm.Plugins
+		filter  *wasm.Filter
+		req     *http.Request
+	)
+
+	BeforeEach(func() {
+		var err error
+		code, err = ioutil.ReadFile("../test/assets/wasm/filter.wasm")
+		Expect(err).ToNot(HaveOccurred())
+
+		cfg = config.WasmConfig{
+			Filters:          []config.WasmFilterConfig{{Name: "test", Code: code, Configuration: "test-filter"}},
+			MaxBodySizeBytes: 1024,
+		}
+		logger = test_util.NewTestZapLogger("wasm-test")
+		req = test_util.NewRequest("GET", "example.com", "/foo?bar=baz", nil)
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		plugins, err = wasm.NewPlugins(context.Background(), cfg, logger)
+		Expect(err).ToNot(HaveOccurred())
+
+		chain, err := plugins.Chain([]string{"test"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(chain).To(HaveLen(1))
+		filter, err = chain[0].NewFilter(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		filter.Close()
+		plugins.Close(context.Background())
+	})
+
+	It("starts the plugin with its configuration", func() {
+		Expect(logger).To(gbytes.Say("configured"))
+	})
+
+	It("passes the request to the plugin", func() {
+		res, err := filter.OnRequest(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(BeNil())
+		Expect(req.Header.Get("X-Wasm-Filter")).To(Equal("test-filter"))
+	})
+
+	It("returns the response of the plugin when it responds to the request", func() {
+		req.Header.Set("X-Wasm-Deny", "true")
+
+		res, err := filter.OnRequest(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.StatusCode).To(Equal(http.StatusForbidden))
+		body, _ := ioutil.ReadAll(res.Body)
+		Expect(string(body)).To(Equal("denied"))
+	})
+
+	It("passes the body of the request to the plugin when it pauses", func() {
+		req = test_util.NewRequest("POST", "example.com", "/", strings.NewReader("hello"))
+		req.Header.Set("X-Wasm-Body", "true")
+
+		res, err := filter.OnRequest(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(BeNil())
+		body, _ := ioutil.ReadAll(req.Body)
+		Expect(string(body)).To(Equal("hello!"))
+		Expect(req.ContentLength).To(Equal(int64(6)))
+	})
+
+	It("does not pass the body of the request to the plugin when it continues", func() {
+		req = test_util.NewRequest("POST", "example.com", "/", strings.NewReader("hello"))
+
+		_, err := filter.OnRequest(req)
+		Expect(err).ToNot(HaveOccurred())
+		body, _ := ioutil.ReadAll(req.Body)
+		Expect(string(body)).To(Equal("hello"))
+	})
+
+	It("responds with 413 when the body of the request is too large for the plugin", func() {
+		req = test_util.NewRequest("POST", "example.com", "/", strings.NewReader(strings.Repeat("a", 1025)))
+		req.Header.Set("X-Wasm-Body", "true")
+
+		res, err := filter.OnRequest(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.StatusCode).To(Equal(http.StatusRequestEntityTooLarge))
+	})
+
+	It("passes the response to the plugin", func() {
+		_, err := filter.OnRequest(req)
+		Expect(err).ToNot(HaveOccurred())
+
+		res := &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{"X-Wasm-Body": {"true"}},
+			Body:          ioutil.NopCloser(strings.NewReader("hello")),
+			ContentLength: 5,
+		}
+		res, err = filter.OnResponse(res)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Header.Get("X-Wasm-Filter")).To(Equal("test-filter"))
+		body, _ := ioutil.ReadAll(res.Body)
+		Expect(string(body)).To(Equal("wasm:hello"))
+		Expect(res.ContentLength).To(Equal(int64(10)))
+		Expect(res.Header.Get("Content-Length")).To(Equal("10"))
+	})
+
+	It("fails when the body of the response is too large for the plugin", func() {
+		res := &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{"X-Wasm-Body": {"true"}},
+			Body:          ioutil.NopCloser(strings.NewReader(strings.Repeat("a", 1025))),
+			ContentLength: 1025,
+		}
+		_, err := filter.OnResponse(res)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("reuses instances for the following requests", func() {
+		filter.Close()
+
+		var err error
+		chain, err := plugins.Chain([]string{"test"})
+		Expect(err).ToNot(HaveOccurred())
+		filter, err = chain[0].NewFilter(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		_, err = filter.OnRequest(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(req.Header["X-Wasm-Filter"]).To(Equal([]string{"test-filter"}))
+	})
+})
+
+var _ = Describe("Plugins", func() {
+	var (
+		code   []byte
+		logger *test_util.TestZapLogger
+	)
+
+	BeforeEach(func() {
+		var err error
+		code, err = ioutil.ReadFile("../test/assets/wasm/filter.wasm")
+		Expect(err).ToNot(HaveOccurred())
+		logger = test_util.NewTestZapLogger("wasm-test")
+	})
+
+	It("chains the global plugins and the named plugins", func() {
+		plugins, err := wasm.NewPlugins(context.Background(), config.WasmConfig{
+			Filters: []config.WasmFilterConfig{
+				{Name: "global", Code: code, Global: true},
+				{Name: "first", Code: code},
+				{Name: "second", Code: code},
+			},
+			MaxBodySizeBytes: 1024,
+		}, logger)
+		Expect(err).ToNot(HaveOccurred())
+		defer plugins.Close(context.Background())
+
+		names := func(chain []*wasm.Plugin, err error) []string {
+			Expect(err).ToNot(HaveOccurred())
+			var names []string
+			for _, p := range chain {
+				names = append(names, p.Name())
+			}
+			return names
+		}
+		Expect(names(plugins.Chain(nil))).To(Equal([]string{"global"}))
+		Expect(names(plugins.Chain([]string{"second", "global", "first"}))).To(Equal([]string{"global", "second", "first"}))
+
+		_, err = plugins.Chain([]string{"second", "unknown"})
+		Expect(err).To(MatchError(ContainSubstring("wasm filter unknown is not configured")))
+	})
+
+	It("fails when a plugin rejects its configuration", func() {
+		_, err := wasm.NewPlugins(context.Background(), config.WasmConfig{
+			Filters:          []config.WasmFilterConfig{{Name: "test", Code: code, Configuration: "fail"}},
+			MaxBodySizeBytes: 1024,
+		}, logger)
+		Expect(err).To(MatchError(ContainSubstring("wasm filter test")))
+	})
+
+	It("fails when a module does not implement the ABI", func() {
+		_, err := wasm.NewPlugins(context.Background(), config.WasmConfig{
+			Filters:          []config.WasmFilterConfig{{Name: "test", Code: []byte("\x00asm\x01\x00\x00\x00")}},
+			MaxBodySizeBytes: 1024,
+		}, logger)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,167 @@
+package wasm
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Header maps that the host functions read and modify.
+const (
+	mapRequestHeaders  = 0
+	mapResponseHeaders = 2
+)
+
+// The pseudo-headers of requests and responses, which precede their headers.
+const (
+	headerMethod    = ":method"
+	headerPath      = ":path"
+	headerAuthority = ":authority"
+	headerScheme    = ":scheme"
+	headerStatus    = ":status"
+)
+
+// header returns the headers of the map.
+func (ex *exchange) header(mapType uint32) (http.Header, bool) {
+	switch {
+	case mapType == mapRequestHeaders && ex.request != nil:
+		return ex.request.Header, true
+	case mapType == mapResponseHeaders && ex.response != nil:
+		return ex.response.Header, true
+	}
+	return nil, false
+}
+
+// pairs returns the pseudo-headers and headers of the map, with lower-case
+// names as in HTTP/2.
+func (ex *exchange) pairs(mapType uint32) ([][2]string, bool) {
+	header, found := ex.header(mapType)
+	if !found {
+		return nil, false
+	}
+
+	var pairs [][2]string
+	if mapType == mapRequestHeaders {
+		for _, name := range []string{headerMethod, headerPath, headerAuthority, headerScheme} {
+			value, _ := ex.pseudoHeader(mapType, name)
+			pairs = append(pairs, [2]string{name, value})
+		}
+	} else {
+		pairs = append(pairs, [2]string{headerStatus, strconv.Itoa(ex.response.StatusCode)})
+	}
+
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			pairs = append(pairs, [2]string{strings.ToLower(name), value})
+		}
+	}
+	return pairs, true
+}
+
+// get returns the values of the header of the map joined by commas.
+func (ex *exchange) get(mapType uint32, name string) (string, bool) {
+	header, found := ex.header(mapType)
+	if !found {
+		return "", false
+	}
+	if strings.HasPrefix(name, ":") {
+		return ex.pseudoHeader(mapType, name)
+	}
+	values, found := header[http.CanonicalHeaderKey(name)]
+	return strings.Join(values, ","), found
+}
+
+// set adds the value to the header of the map, or replaces its values.
+func (ex *exchange) set(mapType uint32, name, value string, add bool) bool {
+	header, found := ex.header(mapType)
+	if !found {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(name, ":"):
+		ex.setPseudoHeader(mapType, name, value)
+	case add:
+		header.Add(name, value)
+	default:
+		header.Set(name, value)
+	}
+	return true
+}
+
+// remove removes the header of the map.
+func (ex *exchange) remove(mapType uint32, name string) bool {
+	header, found := ex.header(mapType)
+	if !found {
+		return false
+	}
+	header.Del(name)
+	return true
+}
+
+// setPairs replaces the headers of the map with the pairs.
+func (ex *exchange) setPairs(mapType uint32, pairs [][2]string) bool {
+	header, found := ex.header(mapType)
+	if !found {
+		return false
+	}
+	for name := range header {
+		delete(header, name)
+	}
+	for _, p := range pairs {
+		if strings.HasPrefix(p[0], ":") {
+			ex.setPseudoHeader(mapType, p[0], p[1])
+		} else {
+			header.Add(p[0], p[1])
+		}
+	}
+	return true
+}
+
+func (ex *exchange) pseudoHeader(mapType uint32, name string) (string, bool) {
+	if mapType == mapResponseHeaders {
+		return strconv.Itoa(ex.response.StatusCode), name == headerStatus
+	}
+	switch name {
+	case headerMethod:
+		return ex.request.Method, true
+	case headerPath:
+		return ex.request.URL.RequestURI(), true
+	case headerAuthority:
+		return ex.request.Host, true
+	case headerScheme:
+		if proto := ex.request.Header.Get("X-Forwarded-Proto"); proto != "" {
+			return proto, true
+		}
+		return "http", true
+	}
+	return "", false
+}
+
+// setPseudoHeader changes the method, path or host of the request, or the
+// status of the response. Other pseudo-headers cannot be changed.
+func (ex *exchange) setPseudoHeader(mapType uint32, name, value string) {
+	if mapType == mapResponseHeaders {
+		if status, err := strconv.Atoi(value); name == headerStatus && err == nil {
+			ex.response.StatusCode = status
+			ex.response.Status = strconv.Itoa(status) + " " + http.StatusText(status)
+		}
+		return
+	}
+	switch name {
+	case headerMethod:
+		ex.request.Method = value
+	case headerPath:
+		if u, err := url.ParseRequestURI(value); err == nil {
+			ex.request.URL.Path, ex.request.URL.RawPath, ex.request.URL.RawQuery = u.Path, u.RawPath, u.RawQuery
+		}
+	case headerAuthority:
+		ex.request.Host = value
+	}
+}
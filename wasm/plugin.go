@@ -0,0 +1,265 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"code.cloudfoundry.org/gorouter/config"
+	"code.cloudfoundry.org/gorouter/logger"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/uber-go/zap"
+)
+
+// rootContextID is the ID of the root context of each instance, which the
+// plugin is started and configured with. The contexts of requests follow it.
+const rootContextID = 1
+
+// Plugins are the plugins of the WebAssembly filters of the router, which
+// share a runtime.
+type Plugins struct {
+	runtime wazero.Runtime
+	byName  map[string]*Plugin
+	global  []*Plugin
+	logger  logger.Logger
+
+	// the names of the unknown filters routes were registered with, which
+	// have been logged
+	unknown sync.Map
+}
+
+// NewPlugins compiles and starts the plugins of the filters. It fails when a
+// module does not implement the proxy-wasm ABI, or its plugin rejects its
+// configuration.
+func NewPlugins(ctx context.Context, cfg config.WasmConfig, logger logger.Logger) (*Plugins, error) {
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+		r.Close(ctx)
+		return nil, err
+	}
+	if err := instantiateHost(ctx, r); err != nil {
+		r.Close(ctx)
+		return nil, err
+	}
+
+	plugins := &Plugins{
+		runtime: r,
+		byName:  make(map[string]*Plugin, len(cfg.Filters)),
+		logger:  logger,
+	}
+	for _, f := range cfg.Filters {
+		plugin, err := newPlugin(ctx, r, f, cfg.MaxBodySizeBytes, logger.With(zap.String("filter", f.Name)))
+		if err != nil {
+			r.Close(ctx)
+			return nil, fmt.Errorf("wasm filter %s: %s", f.Name, err)
+		}
+		plugins.byName[f.Name] = plugin
+		if f.Global {
+			plugins.global = append(plugins.global, plugin)
+		}
+	}
+	return plugins, nil
+}
+
+// Chain returns the plugins that filter requests for a route with the named
+// filters: the global plugins followed by the named ones that are not global.
+// It fails when a filter is not configured, so that requests the route
+// expects to be filtered are not proxied unfiltered; each unknown filter is
+// logged once.
+func (p *Plugins) Chain(names []string) ([]*Plugin, error) {
+	if p == nil {
+		return nil, nil
+	}
+	if len(names) == 0 {
+		return p.global, nil
+	}
+
+	chain := append([]*Plugin{}, p.global...)
+	for _, name := range names {
+		plugin, ok := p.byName[name]
+		if !ok {
+			if _, logged := p.unknown.LoadOrStore(name, struct{}{}); !logged {
+				p.logger.Error("wasm-filter-not-found", zap.String("filter", name))
+			}
+			return nil, fmt.Errorf("wasm filter %s is not configured", name)
+		}
+		if !containsPlugin(chain, plugin) {
+			chain = append(chain, plugin)
+		}
+	}
+	return chain, nil
+}
+
+// Close closes the instances of all plugins.
+func (p *Plugins) Close(ctx context.Context) error {
+	return p.runtime.Close(ctx)
+}
+
+func containsPlugin(plugins []*Plugin, plugin *Plugin) bool {
+	for _, p := range plugins {
+		if p == plugin {
+			return true
+		}
+	}
+	return false
+}
+
+// Plugin is a compiled WebAssembly module implementing the proxy-wasm ABI and
+// the configuration it is started with. Instances of the module filter one
+// request at a time; idle instances are kept for the following requests.
+type Plugin struct {
+	name          string
+	configuration []byte
+	maxBodySize   int64
+	runtime       wazero.Runtime
+	module        wazero.CompiledModule
+	instances     chan *instance
+	logger        logger.Logger
+}
+
+func newPlugin(ctx context.Context, r wazero.Runtime, cfg config.WasmFilterConfig, maxBodySize int64, logger logger.Logger) (*Plugin, error) {
+	module, err := r.CompileModule(ctx, cfg.Code)
+	if err != nil {
+		return nil, err
+	}
+	exports := module.ExportedFunctions()
+	if _, ok := exports["proxy_abi_version_0_2_1"]; !ok {
+		if _, ok := exports["proxy_abi_version_0_2_0"]; !ok {
+			return nil, errors.New("module does not implement proxy-wasm ABI version 0.2")
+		}
+	}
+
+	p := &Plugin{
+		name:          cfg.Name,
+		configuration: []byte(cfg.Configuration),
+		maxBodySize:   maxBodySize,
+		runtime:       r,
+		module:        module,
+		instances:     make(chan *instance, runtime.GOMAXPROCS(0)),
+		logger:        logger,
+	}
+
+	// starting the first instance reports errors of the configuration
+	in, err := p.newInstance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.put(ctx, in)
+	return p, nil
+}
+
+// Name returns the name of the filter of the plugin.
+func (p *Plugin) Name() string {
+	return p.name
+}
+
+// get returns an idle instance, or a new one when there is none.
+func (p *Plugin) get(ctx context.Context) (*instance, error) {
+	select {
+	case in := <-p.instances:
+		return in, nil
+	default:
+		return p.newInstance(ctx)
+	}
+}
+
+// put keeps an instance for the following requests, unless it has failed or
+// enough instances are idle.
+func (p *Plugin) put(ctx context.Context, in *instance) {
+	if in.failed {
+		in.module.Close(ctx)
+		return
+	}
+	select {
+	case p.instances <- in:
+	default:
+		in.module.Close(ctx)
+	}
+}
+
+// instance is an instance of the module of a plugin, and the functions it
+// exports.
+type instance struct {
+	module api.Module
+	alloc  api.Function
+	nextID uint32
+	failed bool
+
+	onContextCreate   api.Function
+	onRequestHeaders  api.Function
+	onRequestBody     api.Function
+	onResponseHeaders api.Function
+	onResponseBody    api.Function
+	onDone            api.Function
+	onLog             api.Function
+	onDelete          api.Function
+}
+
+// newInstance instantiates the module, and starts and configures the plugin
+// in its root context.
+func (p *Plugin) newInstance(ctx context.Context) (*instance, error) {
+	module, err := p.runtime.InstantiateModule(ctx, p.module, wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize", "_start"))
+	if err != nil {
+		return nil, err
+	}
+	if module == nil {
+		return nil, errors.New("module exited when it was started")
+	}
+
+	in := &instance{
+		module:            module,
+		nextID:            rootContextID,
+		onContextCreate:   module.ExportedFunction("proxy_on_context_create"),
+		onRequestHeaders:  module.ExportedFunction("proxy_on_request_headers"),
+		onRequestBody:     module.ExportedFunction("proxy_on_request_body"),
+		onResponseHeaders: module.ExportedFunction("proxy_on_response_headers"),
+		onResponseBody:    module.ExportedFunction("proxy_on_response_body"),
+		onDone:            module.ExportedFunction("proxy_on_done"),
+		onLog:             module.ExportedFunction("proxy_on_log"),
+		onDelete:          module.ExportedFunction("proxy_on_delete"),
+	}
+	in.alloc = module.ExportedFunction("proxy_on_memory_allocate")
+	if in.alloc == nil {
+		in.alloc = module.ExportedFunction("malloc")
+	}
+	if in.alloc == nil {
+		module.Close(ctx)
+		return nil, errors.New("module does not export proxy_on_memory_allocate or malloc")
+	}
+
+	ex := &exchange{plugin: p, instance: in}
+	if _, err := ex.call(ctx, in.onContextCreate, rootContextID, 0); err != nil {
+		module.Close(ctx)
+		return nil, err
+	}
+	if err := ex.start(ctx, "proxy_on_vm_start", 0); err != nil {
+		module.Close(ctx)
+		return nil, err
+	}
+	if err := ex.start(ctx, "proxy_on_configure", uint64(len(p.configuration))); err != nil {
+		module.Close(ctx)
+		return nil, err
+	}
+	return in, nil
+}
+
+// start calls the function starting or configuring the plugin in the root
+// context, if the module exports it, and fails when the plugin does.
+func (ex *exchange) start(ctx context.Context, function string, size uint64) error {
+	fn := ex.instance.module.ExportedFunction(function)
+	if fn == nil {
+		return nil
+	}
+	ok, err := ex.call(ctx, fn, rootContextID, size)
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return fmt.Errorf("plugin failed in %s", function)
+	}
+	return nil
+}